@@ -0,0 +1,377 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	MaxAbuseReports         = 1000 // Reported secrets remembered; the least recently reported is dropped beyond it
+	MaxAbuseReportDetails   = 500  // Maximum length of a reporter's description
+	MaxAbuseDetailsPerEntry = 10   // Descriptions kept per reported secret
+	MaxBlocklistNoteLength  = 200
+)
+
+// Blocklist entry types
+const (
+	BlockByID      = "id"      // A secret ID, taken down and kept from being served again
+	BlockByCreator = "creator" // A creator hash: secrets created from the same network
+	BlockByContent = "content" // A content hash: secrets holding the same encrypted content
+)
+
+// abuseReasons are the reasons a report may give
+var abuseReasons = map[string]bool{"phishing": true, "malware": true, "spam": true, "other": true}
+
+var ErrBlockNotFound = errors.New("blocklist entry not found")
+
+// Fingerprints identify who created a secret and what it holds without keeping either, so
+// reported secrets can be matched against the blocklist after they are gone
+type Fingerprints struct {
+	Creator string // Keyed hash of the creator's network, see AbuseDesk.CreatorHash
+	Content string // SHA-256 of the encrypted content as submitted
+}
+
+// contentHash returns the content fingerprint of encrypted content as submitted
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	var buf [sha256.Size * 2]byte
+	hex.Encode(buf[:], sum[:])
+	return string(buf[:])
+}
+
+// AbuseReport collects the reports received for one secret
+type AbuseReport struct {
+	SecretID    string         `json:"secret_id"`
+	Reasons     map[string]int `json:"reasons"`           // Number of reports per reason
+	Details     []string       `json:"details,omitempty"` // Reporters' descriptions, the first MaxAbuseDetailsPerEntry
+	Count       int            `json:"count"`
+	FirstAt     time.Time      `json:"first_reported_at"`
+	LastAt      time.Time      `json:"last_reported_at"`
+	CreatorHash string         `json:"creator_hash,omitempty"` // Blocklist values for the secret's creator and content
+	ContentHash string         `json:"content_hash,omitempty"`
+}
+
+// BlocklistEntry keeps secrets matching Value from being created or served
+type BlocklistEntry struct {
+	Type      string    `json:"type"`
+	Value     string    `json:"value"`
+	Note      string    `json:"note,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Removed   int       `json:"removed"` // Secrets taken down when the entry was added
+}
+
+// AbuseDesk holds abuse reports and the blocklist in memory
+type AbuseDesk struct {
+	mu        sync.Mutex
+	reports   map[string]*AbuseReport
+	blocklist map[[2]string]BlocklistEntry // Keyed by type and value
+	key       []byte                       // Keys creator hashes, so they can't be reversed by hashing every address
+}
+
+func NewAbuseDesk() *AbuseDesk {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return &AbuseDesk{
+		reports:   make(map[string]*AbuseReport),
+		blocklist: make(map[[2]string]BlocklistEntry),
+		key:       key,
+	}
+}
+
+// CreatorHash returns the fingerprint of a creator's address. Addresses are grouped into the
+// networks the lookup throttle uses, as an IPv6 client can pick any address in its /64.
+func (desk *AbuseDesk) CreatorHash(addr netip.Addr) string {
+	if !addr.IsValid() {
+		return ""
+	}
+	mac := hmac.New(sha256.New, desk.key)
+	mac.Write([]byte(throttleKey(addr).String()))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// Report records a report against a secret
+func (desk *AbuseDesk) Report(id, reason, details string, prints Fingerprints, now time.Time) {
+	desk.mu.Lock()
+	defer desk.mu.Unlock()
+
+	report, ok := desk.reports[id]
+	if !ok {
+		if len(desk.reports) >= MaxAbuseReports {
+			desk.dropOldest()
+		}
+		report = &AbuseReport{SecretID: id, Reasons: map[string]int{}, FirstAt: now}
+		desk.reports[id] = report
+	}
+	report.Reasons[reason]++
+	report.Count++
+	report.LastAt = now
+	if details != "" && len(report.Details) < MaxAbuseDetailsPerEntry {
+		report.Details = append(report.Details, details)
+	}
+	if prints.Creator != "" {
+		report.CreatorHash = prints.Creator
+	}
+	if prints.Content != "" {
+		report.ContentHash = prints.Content
+	}
+}
+
+// dropOldest forgets the least recently reported secret. Must be called with desk.mu held.
+func (desk *AbuseDesk) dropOldest() {
+	var oldest *AbuseReport
+	for _, report := range desk.reports {
+		if oldest == nil || report.LastAt.Before(oldest.LastAt) {
+			oldest = report
+		}
+	}
+	if oldest != nil {
+		delete(desk.reports, oldest.SecretID)
+	}
+}
+
+// Reports returns copies of the reports, most reported first
+func (desk *AbuseDesk) Reports() []AbuseReport {
+	desk.mu.Lock()
+	defer desk.mu.Unlock()
+
+	reports := make([]AbuseReport, 0, len(desk.reports))
+	for _, report := range desk.reports {
+		r := *report
+		r.Reasons = make(map[string]int, len(report.Reasons))
+		for reason, n := range report.Reasons {
+			r.Reasons[reason] = n
+		}
+		r.Details = append([]string(nil), report.Details...)
+		reports = append(reports, r)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if reports[i].Count != reports[j].Count {
+			return reports[i].Count > reports[j].Count
+		}
+		return reports[i].LastAt.After(reports[j].LastAt)
+	})
+	return reports
+}
+
+// Dismiss forgets the reports against a secret
+func (desk *AbuseDesk) Dismiss(id string) bool {
+	desk.mu.Lock()
+	defer desk.mu.Unlock()
+	_, ok := desk.reports[id]
+	delete(desk.reports, id)
+	return ok
+}
+
+// Block adds or replaces a blocklist entry
+func (desk *AbuseDesk) Block(entry BlocklistEntry) {
+	desk.mu.Lock()
+	defer desk.mu.Unlock()
+	desk.blocklist[[2]string{entry.Type, entry.Value}] = entry
+}
+
+// Unblock removes a blocklist entry
+func (desk *AbuseDesk) Unblock(kind, value string) error {
+	desk.mu.Lock()
+	defer desk.mu.Unlock()
+	key := [2]string{kind, value}
+	if _, ok := desk.blocklist[key]; !ok {
+		return ErrBlockNotFound
+	}
+	delete(desk.blocklist, key)
+	return nil
+}
+
+// Blocked reports whether value is on the blocklist as kind. Empty values never are.
+func (desk *AbuseDesk) Blocked(kind, value string) bool {
+	if value == "" {
+		return false
+	}
+	desk.mu.Lock()
+	defer desk.mu.Unlock()
+	_, ok := desk.blocklist[[2]string{kind, value}]
+	return ok
+}
+
+// Blocklist returns the entries, newest first
+func (desk *AbuseDesk) Blocklist() []BlocklistEntry {
+	desk.mu.Lock()
+	defer desk.mu.Unlock()
+
+	entries := make([]BlocklistEntry, 0, len(desk.blocklist))
+	for _, entry := range desk.blocklist {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].CreatedAt.After(entries[j].CreatedAt) })
+	return entries
+}
+
+// Fingerprints returns the fingerprints of a secret, which outlive it as long as its final
+// status is remembered
+func (s *SecretStore) Fingerprints(id string) (Fingerprints, bool) {
+	sh, key := s.shardFor(id), keyOf(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if secret, ok := sh.secrets[key]; ok {
+		return secret.Fingerprints, true
+	}
+	if t, ok := sh.tombstones[key]; ok {
+		return t.fingerprints, true
+	}
+	return Fingerprints{}, false
+}
+
+// RemoveBlocked wipes and removes every secret matching entry with StatusBlocked, and burns
+// them on the other nodes of a cluster. Returns the number of secrets removed.
+func (s *SecretStore) RemoveBlocked(entry BlocklistEntry) int {
+	var ids []string
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for _, secret := range sh.secrets {
+			if entry.matches(secret.ID, secret.Fingerprints) {
+				ids = append(ids, secret.ID)
+				s.remove(sh, secret.ID, secret, StatusBlocked)
+			}
+		}
+		sh.mu.Unlock()
+	}
+	if replicator := s.getReplicator(); replicator != nil {
+		for _, id := range ids {
+			replicator.Burn(id)
+		}
+	}
+	return len(ids)
+}
+
+func (entry BlocklistEntry) matches(id string, prints Fingerprints) bool {
+	switch entry.Type {
+	case BlockByID:
+		return id == entry.Value
+	case BlockByCreator:
+		return prints.Creator == entry.Value
+	case BlockByContent:
+		return prints.Content == entry.Value
+	}
+	return false
+}
+
+// ReportRequest is the body of a public abuse report
+type ReportRequest struct {
+	Reason  string `json:"reason"`
+	Details string `json:"details"`
+}
+
+// reportHandler records a visitor's report against a secret link. The secret need not exist
+// any more: phishing links are often reported after they were opened.
+func (srv *Server) reportHandler(w http.ResponseWriter, r *http.Request) {
+	if !srv.config.AbuseReports {
+		localizedError(w, r, http.StatusNotFound, "error.not_found")
+		return
+	}
+
+	var req ReportRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "error.invalid_json")
+		return
+	}
+	if !abuseReasons[req.Reason] {
+		localizedError(w, r, http.StatusBadRequest, "error.report_reason_invalid")
+		return
+	}
+	if len(req.Details) > MaxAbuseReportDetails {
+		localizedError(w, r, http.StatusBadRequest, "error.report_details_too_long", MaxAbuseReportDetails)
+		return
+	}
+
+	id, signed := srv.verifyID(mux.Vars(r)["id"])
+	if !signed {
+		localizedError(w, r, http.StatusNotFound, "error.not_found")
+		return
+	}
+	prints, _ := srv.store.Fingerprints(id)
+	srv.abuse.Report(id, req.Reason, req.Details, prints, time.Now())
+	srv.logger.Warn("Abuse report received", "reason", req.Reason)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// blockedCreation reports whether a creator or content hash is on the blocklist
+func (srv *Server) blockedCreation(prints Fingerprints) bool {
+	return srv.abuse.Blocked(BlockByCreator, prints.Creator) || srv.abuse.Blocked(BlockByContent, prints.Content)
+}
+
+func (srv *Server) adminListReportsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(srv.abuse.Reports())
+}
+
+// adminDismissReportHandler forgets the reports against a secret without blocking it
+func (srv *Server) adminDismissReportHandler(w http.ResponseWriter, r *http.Request) {
+	if !srv.abuse.Dismiss(mux.Vars(r)["id"]) {
+		apiError(w, r, http.StatusNotFound, "report not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (srv *Server) adminListBlocklistHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(srv.abuse.Blocklist())
+}
+
+// adminBlockHandler adds a blocklist entry and takes down the secrets it matches
+func (srv *Server) adminBlockHandler(w http.ResponseWriter, r *http.Request) {
+	var entry BlocklistEntry
+	if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+		apiError(w, r, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if entry.Type != BlockByID && entry.Type != BlockByCreator && entry.Type != BlockByContent {
+		apiError(w, r, http.StatusBadRequest, "type must be id, creator or content")
+		return
+	}
+	if entry.Value == "" {
+		apiError(w, r, http.StatusBadRequest, "value is required")
+		return
+	}
+	if entry.Type == BlockByID {
+		// Accept IDs copied from signed links
+		if id, signed := srv.verifyID(entry.Value); signed {
+			entry.Value = id
+		}
+	}
+	if len(entry.Note) > MaxBlocklistNoteLength {
+		apiError(w, r, http.StatusBadRequest, "note is too long")
+		return
+	}
+
+	entry.CreatedAt = time.Now().UTC()
+	entry.Removed = srv.store.RemoveBlocked(entry)
+	srv.abuse.Block(entry)
+	srv.logger.Warn("Blocklist entry added", "type", entry.Type, "removed", entry.Removed)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(entry)
+}
+
+func (srv *Server) adminUnblockHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if err := srv.abuse.Unblock(vars["type"], vars["value"]); err != nil {
+		apiError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
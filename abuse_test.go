@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAbuseReports_BlockCreator(t *testing.T) {
+	_, server := setupAdminTestServer(t, func(cfg *Config) { cfg.AbuseReports = true })
+	defer server.Close()
+
+	create := func() (*http.Response, CreateSecretResponse) {
+		resp, err := http.Post(server.URL+"/api/secrets", "application/json", strings.NewReader(`{"content": "encrypted"}`))
+		if err != nil {
+			t.Fatalf("Failed to create secret: %v", err)
+		}
+		defer resp.Body.Close()
+		var created CreateSecretResponse
+		json.NewDecoder(resp.Body).Decode(&created)
+		return resp, created
+	}
+	_, created := create()
+
+	for body, want := range map[string]int{
+		`{"reason": "phishing", "details": "Asks for my bank login"}`: http.StatusAccepted,
+		`{"reason": "phishing"}`: http.StatusAccepted,
+		`{"reason": "boring"}`:   http.StatusBadRequest,
+	} {
+		resp, err := http.Post(server.URL+"/report/"+created.ID, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to report: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("%s: expected %d, got %d", body, want, resp.StatusCode)
+		}
+	}
+
+	resp := adminRequest(t, server, "GET", "/admin/api/reports", testAdminKey, nil)
+	var reports []AbuseReport
+	json.NewDecoder(resp.Body).Decode(&reports)
+	resp.Body.Close()
+	if len(reports) != 1 || reports[0].SecretID != created.ID || reports[0].Count != 2 || reports[0].Reasons["phishing"] != 2 {
+		t.Fatalf("Expected two phishing reports against the secret, got %+v", reports)
+	}
+	if len(reports[0].Details) != 1 || reports[0].CreatorHash == "" || reports[0].ContentHash != contentHash([]byte("encrypted")) {
+		t.Errorf("Expected the details and fingerprints to be reported, got %+v", reports[0])
+	}
+
+	entry, _ := json.Marshal(BlocklistEntry{Type: BlockByCreator, Value: reports[0].CreatorHash})
+	resp = adminRequest(t, server, "POST", "/admin/api/blocklist", testAdminKey, entry)
+	var added BlocklistEntry
+	json.NewDecoder(resp.Body).Decode(&added)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || added.Removed != 1 {
+		t.Fatalf("Expected the entry to take the secret down, got %d %+v", resp.StatusCode, added)
+	}
+
+	resp, err := http.Get(server.URL + "/api/secrets/" + created.ID + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status SecretStatusResponse
+	json.NewDecoder(resp.Body).Decode(&status)
+	resp.Body.Close()
+	if status.Status != string(StatusBlocked) {
+		t.Errorf("Expected status blocked, got %q", status.Status)
+	}
+
+	if resp, _ := create(); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected creates from a blocked creator to be rejected, got %d", resp.StatusCode)
+	}
+
+	resp = adminRequest(t, server, "DELETE", "/admin/api/blocklist/creator/"+reports[0].CreatorHash, testAdminKey, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected the entry to be removed, got %d", resp.StatusCode)
+	}
+	if resp, _ := create(); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected creates to be accepted once unblocked, got %d", resp.StatusCode)
+	}
+}
+
+func TestAbuseReports_BlockID(t *testing.T) {
+	srv, server := setupAdminTestServer(t)
+	defer server.Close()
+
+	id, _ := srv.store.Store("encrypted", time.Hour)
+	entry, _ := json.Marshal(BlocklistEntry{Type: BlockByID, Value: id, Note: "malware"})
+	resp := adminRequest(t, server, "POST", "/admin/api/blocklist", testAdminKey, entry)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected the entry to be added, got %d", resp.StatusCode)
+	}
+
+	resp, err := http.Get(server.URL + "/api/secrets/" + id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGone {
+		t.Errorf("Expected a blocked ID to be gone, got %d", resp.StatusCode)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/s/"+id, nil))
+	if strings.Contains(rec.Body.String(), `id="revealBtn"`) {
+		t.Error("Expected the view page of a blocked secret to offer no reveal button")
+	}
+}
+
+func TestReportHandler_Disabled(t *testing.T) {
+	srv := newTestServer(t)
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("POST", "/report/abc", strings.NewReader(`{"reason": "spam"}`)))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected reports to be disabled by default, got %d", rec.Code)
+	}
+}
+
+func TestAbuseDesk_DropsOldestReports(t *testing.T) {
+	desk := NewAbuseDesk()
+	start := time.Now()
+	for i := 0; i <= MaxAbuseReports; i++ {
+		desk.Report(strconv.Itoa(i), "spam", "", Fingerprints{}, start.Add(time.Duration(i)*time.Second))
+	}
+	reports := desk.Reports()
+	if len(reports) != MaxAbuseReports {
+		t.Fatalf("Expected %d reports, got %d", MaxAbuseReports, len(reports))
+	}
+	for _, report := range reports {
+		if report.FirstAt.Equal(start) {
+			t.Fatal("Expected the oldest report to be dropped")
+		}
+	}
+}
+
+func TestLoadConfig_AbuseReportsNeedAdminKey(t *testing.T) {
+	if _, err := loadConfig([]string{"--abuse-reports"}, envMap(nil)); err == nil {
+		t.Error("Expected abuse reports without an admin key to be rejected")
+	}
+	if _, err := loadConfig([]string{"--abuse-reports", "--admin-api-key", testAdminKey}, envMap(nil)); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
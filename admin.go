@@ -0,0 +1,165 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const MinAdminAPIKeyLength = 16 // Minimum length of the admin API key
+
+// StoreStats is a snapshot of store usage
+type StoreStats struct {
+	Count           int           // Number of unread secrets
+	BytesUsed       int           // Total size of stored (encrypted) content
+	OldestSecretAge time.Duration // Age of the oldest unread secret; zero when empty
+	Tombstones      int           // Number of remembered final statuses
+}
+
+// Stats returns a snapshot of store usage
+func (s *SecretStore) Stats() StoreStats {
+	var stats StoreStats
+
+	now := time.Now()
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		stats.Count += len(sh.secrets)
+		stats.Tombstones += len(sh.tombstones)
+		for _, secret := range sh.secrets {
+			stats.BytesUsed += len(secret.Content)
+			if age := now.Sub(secret.CreatedAt); age > stats.OldestSecretAge {
+				stats.OldestSecretAge = age
+			}
+		}
+		sh.mu.Unlock()
+	}
+
+	return stats
+}
+
+type AdminStatsResponse struct {
+	Count                  int    `json:"count"`
+	BytesUsed              int    `json:"bytes_used"`
+	OldestSecretAgeSeconds int64  `json:"oldest_secret_age_seconds"`
+	Tombstones             int    `json:"tombstones"`
+	Limits                 Limits `json:"limits"`
+}
+
+type AdminCountResponse struct {
+	Count int `json:"count"`
+}
+
+// requireAdminKey rejects requests without a valid "Authorization: Bearer <admin key>" header.
+// The admin API responds 404 when no admin key is configured.
+func (srv *Server) requireAdminKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if srv.config.AdminAPIKey == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || !srv.checkAdminKey(token) {
+			apiError(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAdminLogin guards admin pages opened in a browser, which can't send a bearer token.
+// The admin key is accepted as the HTTP Basic password, with any user name, and with single
+// sign-on a session of one of the admin accounts is too. The sign-in routes are public, so
+// single sign-on is left out when the admin pages are on the management listener.
+func (srv *Server) requireAdminLogin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if srv.oidc != nil && len(srv.config.OIDC.AdminEmails) > 0 && srv.config.ManagementListen == "" {
+			identity, signedIn := srv.requestIdentity(r)
+			if signedIn && srv.oidc.IsAdmin(identity) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !signedIn && r.Header.Get("Authorization") == "" {
+				http.Redirect(w, r, srv.loginURL(r.URL.Path), http.StatusFound)
+				return
+			}
+		}
+		if srv.config.AdminAPIKey == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		_, password, ok := r.BasicAuth()
+		if !ok || !srv.checkAdminKey(password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="picosend admin", charset="UTF-8"`)
+			apiError(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkAdminKey compares key with the configured admin key in constant time
+func (srv *Server) checkAdminKey(key string) bool {
+	expected := sha256.Sum256([]byte(srv.config.AdminAPIKey))
+	provided := sha256.Sum256([]byte(key))
+	return subtle.ConstantTimeCompare(expected[:], provided[:]) == 1
+}
+
+func (srv *Server) adminStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats := srv.store.Stats()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AdminStatsResponse{
+		Count:                  stats.Count,
+		BytesUsed:              stats.BytesUsed,
+		OldestSecretAgeSeconds: int64(stats.OldestSecretAge / time.Second),
+		Tombstones:             stats.Tombstones,
+		Limits:                 srv.store.Limits(),
+	})
+}
+
+// adminCleanupHandler removes expired secrets immediately instead of waiting for the cleanup worker
+func (srv *Server) adminCleanupHandler(w http.ResponseWriter, r *http.Request) {
+	count := srv.store.CleanupExpired()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AdminCountResponse{Count: count})
+}
+
+// adminPurgeHandler wipes every secret in the store, on every node of a cluster
+func (srv *Server) adminPurgeHandler(w http.ResponseWriter, r *http.Request) {
+	count := srv.store.Purge()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AdminCountResponse{Count: count})
+}
+
+func (srv *Server) adminGetLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(srv.store.Limits())
+}
+
+// adminSetLimitsHandler adjusts store limits without a restart. Omitted fields keep their current value.
+func (srv *Server) adminSetLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	limits := srv.store.Limits()
+	if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+		apiError(w, r, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+
+	if err := limits.Validate(); err != nil {
+		apiError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	srv.store.SetLimits(limits)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(limits)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testAdminKey = "test-admin-key-0123456789"
+
+func adminRequest(t *testing.T, server *httptest.Server, method, path, key string, body []byte) *http.Response {
+	req, err := http.NewRequest(method, server.URL+path, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	return resp
+}
+
+// setupAdminTestServer serves a test Server with the admin API enabled, adjusted by configure
+func setupAdminTestServer(t *testing.T, configure ...func(*Config)) (*Server, *httptest.Server) {
+	t.Helper()
+	return setupTestServer(t, append([]func(*Config){func(cfg *Config) { cfg.AdminAPIKey = testAdminKey }}, configure...)...)
+}
+
+func TestAdminAPI_DisabledWithoutKey(t *testing.T) {
+	_, server := setupTestServer(t)
+	defer server.Close()
+
+	resp := adminRequest(t, server, "GET", "/admin/api/stats", "", nil)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404 when admin API is disabled, got %d", resp.StatusCode)
+	}
+}
+
+func TestAdminAPI_RequiresKey(t *testing.T) {
+	_, server := setupAdminTestServer(t)
+	defer server.Close()
+
+	for _, key := range []string{"", "wrong-key"} {
+		resp := adminRequest(t, server, "GET", "/admin/api/stats", key, nil)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected status 401 for key %q, got %d", key, resp.StatusCode)
+		}
+	}
+}
+
+func TestAdminAPI_Stats(t *testing.T) {
+	srv, server := setupAdminTestServer(t)
+	defer server.Close()
+
+	srv.store.Store("12345", 24*time.Hour)
+	srv.store.Store("1234567890", 24*time.Hour)
+
+	resp := adminRequest(t, server, "GET", "/admin/api/stats", testAdminKey, nil)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	var stats AdminStatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode stats: %v", err)
+	}
+	if stats.Count != 2 {
+		t.Errorf("Expected count 2, got %d", stats.Count)
+	}
+	if stats.BytesUsed != 15 {
+		t.Errorf("Expected 15 bytes used, got %d", stats.BytesUsed)
+	}
+	if stats.Limits != DefaultLimits() {
+		t.Errorf("Expected default limits, got %+v", stats.Limits)
+	}
+}
+
+func TestAdminAPI_CleanupAndPurge(t *testing.T) {
+	srv, server := setupAdminTestServer(t)
+	defer server.Close()
+
+	srv.store.Store("expired", time.Millisecond)
+	srv.store.Store("valid", 24*time.Hour)
+	srv.store.Store("valid", 24*time.Hour)
+	time.Sleep(5 * time.Millisecond)
+
+	var result AdminCountResponse
+
+	resp := adminRequest(t, server, "POST", "/admin/api/cleanup", testAdminKey, nil)
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if result.Count != 1 || srv.store.Count() != 2 {
+		t.Errorf("Expected 1 secret cleaned and 2 remaining, got %d cleaned and %d remaining", result.Count, srv.store.Count())
+	}
+
+	resp = adminRequest(t, server, "POST", "/admin/api/purge", testAdminKey, nil)
+	json.NewDecoder(resp.Body).Decode(&result)
+	resp.Body.Close()
+	if result.Count != 2 || srv.store.Count() != 0 {
+		t.Errorf("Expected 2 secrets purged and none remaining, got %d purged and %d remaining", result.Count, srv.store.Count())
+	}
+}
+
+func TestAdminAPI_SetLimits(t *testing.T) {
+	srv, server := setupAdminTestServer(t)
+	defer server.Close()
+
+	resp := adminRequest(t, server, "PUT", "/admin/api/limits", testAdminKey, []byte(`{"max_unread_secrets": 1}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	limits := srv.store.Limits()
+	if limits.MaxUnreadSecrets != 1 || limits.MaxSecretLength != MaxSecretLength {
+		t.Errorf("Expected only max_unread_secrets to change, got %+v", limits)
+	}
+
+	if _, err := srv.store.Store("first", time.Hour); err != nil {
+		t.Fatalf("Expected first secret to be stored, got %v", err)
+	}
+	if _, err := srv.store.Store("second", time.Hour); err == nil {
+		t.Error("Expected the new limit to be enforced")
+	}
+
+	resp = adminRequest(t, server, "PUT", "/admin/api/limits", testAdminKey, []byte(`{"max_secret_length": 0}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for non-positive limit, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// ErrorResponse is the body of every error returned by the API
+type ErrorResponse struct {
+	Error     string `json:"error"`      // Message in the client's language where translated
+	Code      string `json:"code"`       // Stable identifier to branch on, such as invalid_pin
+	RequestID string `json:"request_id"` // Same as the X-Request-ID header, for finding the request in server logs
+}
+
+// writeError replies with an ErrorResponse on API routes. Pages and other routes keep a
+// plain-text body, as browsers show it as is.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if !isAPIPath(r.URL.Path) {
+		http.Error(w, message, status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error:     message,
+		Code:      code,
+		RequestID: requestIDFromContext(r.Context()),
+	})
+}
+
+// apiError replies with an untranslated message and a code named after the status, for
+// errors without a locale key such as those of the admin API
+func apiError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	writeError(w, r, status, statusErrorCode(status), message)
+}
+
+// statusErrorCode turns a status into an error code, e.g. 404 into not_found
+func statusErrorCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(strings.ToLower(text))
+}
+
+// keyErrorCode turns a locale key into an error code, e.g. error.invalid_pin into invalid_pin
+func keyErrorCode(key string) string {
+	return strings.TrimPrefix(key, "error.")
+}
+
+// notFoundHandler answers requests no route matched. The router skips its middleware for
+// them, so the request ID is assigned here.
+func notFoundHandler() http.Handler {
+	return requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiError(w, r, http.StatusNotFound, "404 page not found")
+	}))
+}
+
+// methodNotAllowedHandler answers requests to a route that exists for other methods
+func methodNotAllowedHandler() http.Handler {
+	return requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiError(w, r, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+	}))
+}
+
+// isAPIPath reports whether path is served by the JSON API rather than a page
+func isAPIPath(path string) bool {
+	return strings.HasPrefix(path, "/api/") || strings.HasPrefix(path, "/admin/api/")
+}
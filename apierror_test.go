@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIErrors_Envelope(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.AdminAPIKey = testAdminKey })
+	id, _ := srv.store.StoreWithOptions("content", time.Hour, SecretOptions{})
+
+	for _, tt := range []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{"translated", "POST", "/api/secrets/" + id + "/claim", `{}`, http.StatusForbidden, "claim_token_required"},
+		{"missing secret", "GET", "/api/secrets/missing", "", http.StatusNotFound, "not_found"},
+		{"untranslated", "POST", "/admin/api/cleanup", "", http.StatusUnauthorized, "unauthorized"},
+		{"unknown route", "GET", "/admin/api/nothing-here", "", http.StatusNotFound, "not_found"},
+		{"wrong method", "PUT", "/api/config", "", http.StatusMethodNotAllowed, "method_not_allowed"},
+	} {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(RequestIDHeader, "trace-"+strings.ReplaceAll(tt.name, " ", "-"))
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, req)
+
+		var body ErrorResponse
+		if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+			t.Errorf("%s: body is not JSON: %v", tt.name, err)
+			continue
+		}
+		if rec.Code != tt.status || body.Code != tt.code {
+			t.Errorf("%s: got %d %q, want %d %q", tt.name, rec.Code, body.Code, tt.status, tt.code)
+		}
+		if body.Error == "" {
+			t.Errorf("%s: error message is empty", tt.name)
+		}
+		if want := req.Header.Get(RequestIDHeader); body.RequestID != want || rec.Header().Get(RequestIDHeader) != want {
+			t.Errorf("%s: request ID %q, header %q, want %q", tt.name, body.RequestID, rec.Header().Get(RequestIDHeader), want)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s: Content-Type = %q", tt.name, ct)
+		}
+	}
+}
+
+func TestAPIErrors_PagesStayPlainText(t *testing.T) {
+	srv := newTestServer(t)
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/no/such/page", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %q, want text/plain", ct)
+	}
+}
+
+func TestStatusErrorCode(t *testing.T) {
+	for status, want := range map[int]string{
+		http.StatusBadRequest:            "bad_request",
+		http.StatusTooManyRequests:       "too_many_requests",
+		http.StatusRequestEntityTooLarge: "request_entity_too_large",
+		http.StatusTeapot:                "im_a_teapot",
+		599:                              "error",
+	} {
+		if got := statusErrorCode(status); got != want {
+			t.Errorf("statusErrorCode(%d) = %q, want %q", status, got, want)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// APIKeyQuotaWindow is the period over which an API key's creation quota is counted
+const APIKeyQuotaWindow = 24 * time.Hour
+
+var (
+	ErrAPIKeyNotFound      = errors.New("API key not found")
+	ErrAPIKeyQuotaExceeded = errors.New("API key quota exceeded")
+)
+
+// APIKeyLimits restrict what can be created with a key. Zero means the server-wide limit applies.
+type APIKeyLimits struct {
+	DailyQuota      int `json:"daily_quota"`       // Secrets that can be created per APIKeyQuotaWindow
+	MaxLifetime     int `json:"max_lifetime"`      // Minutes
+	MaxSecretLength int `json:"max_secret_length"` // Characters
+}
+
+// Validate checks that no limit is negative
+func (l APIKeyLimits) Validate() error {
+	if l.DailyQuota < 0 || l.MaxLifetime < 0 || l.MaxSecretLength < 0 {
+		return errors.New("API key limits must not be negative")
+	}
+	return nil
+}
+
+// APIKey is an issued key. Only a hash of the token is kept.
+type APIKey struct {
+	ID        string
+	Name      string
+	Tenant    string // Secrets created with the key are scoped to this tenant; empty for none
+	Limits    APIKeyLimits
+	CreatedAt time.Time
+
+	hash        [sha256.Size]byte
+	windowStart time.Time // Start of the current quota window
+	used        int       // Secrets created in the current quota window
+}
+
+// APIKeyInfo is the non-secret view of a key returned by the admin API
+type APIKeyInfo struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Tenant    string `json:"tenant,omitempty"`
+	CreatedAt string `json:"created_at"`
+	Used      int    `json:"used"` // Secrets created in the current quota window
+	APIKeyLimits
+}
+
+// APIKeyRegistry stores issued keys in memory and tracks their quota usage
+type APIKeyRegistry struct {
+	mu     sync.Mutex
+	keys   map[string]*APIKey
+	byHash map[[sha256.Size]byte]*APIKey
+}
+
+func NewAPIKeyRegistry() *APIKeyRegistry {
+	return &APIKeyRegistry{
+		keys:   make(map[string]*APIKey),
+		byHash: make(map[[sha256.Size]byte]*APIKey),
+	}
+}
+
+// Create issues a new key and returns it along with the token, which is not stored and can't be recovered
+func (reg *APIKeyRegistry) Create(name, tenant string, limits APIKeyLimits) (APIKeyInfo, string) {
+	token := "psk_" + generateToken()
+	key := &APIKey{
+		ID:        generateID(),
+		Name:      name,
+		Tenant:    tenant,
+		Limits:    limits,
+		CreatedAt: time.Now(),
+		hash:      sha256.Sum256([]byte(token)),
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.keys[key.ID] = key
+	reg.byHash[key.hash] = key
+	return key.info(), token
+}
+
+// Authenticate returns the key matching token. Lookup is by hash so tokens aren't compared byte by byte.
+func (reg *APIKeyRegistry) Authenticate(token string) (*APIKey, bool) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	key, ok := reg.byHash[sha256.Sum256([]byte(token))]
+	return key, ok
+}
+
+// Active reports whether key is still issued, i.e. has not been revoked
+func (reg *APIKeyRegistry) Active(key *APIKey) bool {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return reg.keys[key.ID] == key
+}
+
+// Consume counts one created secret against the key's quota
+func (reg *APIKeyRegistry) Consume(key *APIKey, now time.Time) error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if now.Sub(key.windowStart) >= APIKeyQuotaWindow {
+		key.windowStart = now
+		key.used = 0
+	}
+	if key.Limits.DailyQuota > 0 && key.used >= key.Limits.DailyQuota {
+		return ErrAPIKeyQuotaExceeded
+	}
+	key.used++
+	return nil
+}
+
+// Refund returns a consumed unit when the secret could not be stored after all
+func (reg *APIKeyRegistry) Refund(key *APIKey) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if key.used > 0 {
+		key.used--
+	}
+}
+
+// List returns all keys ordered by creation time
+func (reg *APIKeyRegistry) List() []APIKeyInfo {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	keys := make([]*APIKey, 0, len(reg.keys))
+	for _, key := range reg.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+
+	infos := make([]APIKeyInfo, len(keys))
+	for i, key := range keys {
+		infos[i] = key.info()
+	}
+	return infos
+}
+
+// Update replaces the limits of a key. Usage in the current window is kept.
+func (reg *APIKeyRegistry) Update(id string, limits APIKeyLimits) (APIKeyInfo, error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	key, ok := reg.keys[id]
+	if !ok {
+		return APIKeyInfo{}, ErrAPIKeyNotFound
+	}
+	key.Limits = limits
+	return key.info(), nil
+}
+
+// Revoke deletes a key so it can no longer be used
+func (reg *APIKeyRegistry) Revoke(id string) error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	key, ok := reg.keys[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	delete(reg.keys, id)
+	delete(reg.byHash, key.hash)
+	return nil
+}
+
+// info must be called with the registry lock held
+func (key *APIKey) info() APIKeyInfo {
+	used := key.used
+	if time.Since(key.windowStart) >= APIKeyQuotaWindow {
+		used = 0
+	}
+	return APIKeyInfo{
+		ID:           key.ID,
+		Name:         key.Name,
+		Tenant:       key.Tenant,
+		CreatedAt:    key.CreatedAt.UTC().Format(time.RFC3339),
+		Used:         used,
+		APIKeyLimits: key.Limits,
+	}
+}
+
+// requestAPIKey resolves the "Authorization: Bearer <key>" header of a create request.
+// Returns a nil key for anonymous or signed-in requests when keys are optional, and false after
+// replying with 401. With single sign-on, requests without a key must come from a session.
+func (srv *Server) requestAPIKey(w http.ResponseWriter, r *http.Request) (*APIKey, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		token = ""
+	}
+	key, reqErr := srv.creatorAPIKey(r, token)
+	if reqErr != nil {
+		reqErr.reply(w, r)
+		return nil, false
+	}
+	return key, true
+}
+
+// creatorAPIKey resolves the API key token a create request came with, empty when it has none,
+// like requestAPIKey
+func (srv *Server) creatorAPIKey(r *http.Request, token string) (*APIKey, *requestError) {
+	if token == "" {
+		// With single sign-on, browsers create secrets as a signed-in user and scripts with a key
+		if srv.oidc != nil {
+			if _, signedIn := srv.requestIdentity(r); !signedIn {
+				return nil, &requestError{Code: http.StatusUnauthorized, Key: "error.login_required"}
+			}
+			return nil, nil
+		}
+		if srv.config.RequireAPIKeys {
+			return nil, &requestError{Code: http.StatusUnauthorized, Key: "error.api_key_required"}
+		}
+		return nil, nil
+	}
+
+	key, found := srv.apiKeys.Authenticate(token)
+	if !found {
+		return nil, &requestError{Code: http.StatusUnauthorized, Key: "error.invalid_api_key"}
+	}
+	return key, nil
+}
+
+// secretLimits returns the store limits tightened by apiKey and its tenant. A nil key gets the
+// server-wide limits.
+func (srv *Server) secretLimits(apiKey *APIKey) Limits {
+	limits := srv.store.Limits()
+	if apiKey == nil {
+		return limits
+	}
+	limits = limits.restrict(apiKey.Limits.MaxLifetime, apiKey.Limits.MaxSecretLength)
+	if tenantLimits, found := srv.tenants.Limits(apiKey.Tenant); found {
+		limits = limits.restrict(tenantLimits.MaxLifetime, tenantLimits.MaxSecretLength)
+	}
+	return limits
+}
+
+type AdminCreateAPIKeyRequest struct {
+	Name   string `json:"name"`
+	Tenant string `json:"tenant,omitempty"` // Existing tenant the key's secrets are scoped to
+	APIKeyLimits
+}
+
+type AdminCreateAPIKeyResponse struct {
+	Key string `json:"key"` // Shown only once
+	APIKeyInfo
+}
+
+func (srv *Server) adminListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(srv.apiKeys.List())
+}
+
+func (srv *Server) adminCreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req AdminCreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, r, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		apiError(w, r, http.StatusBadRequest, "name is required")
+		return
+	}
+	if err := req.APIKeyLimits.Validate(); err != nil {
+		apiError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.Tenant != "" {
+		if _, found := srv.tenants.Limits(req.Tenant); !found {
+			apiError(w, r, http.StatusBadRequest, ErrTenantNotFound.Error())
+			return
+		}
+	}
+
+	info, token := srv.apiKeys.Create(strings.TrimSpace(req.Name), req.Tenant, req.APIKeyLimits)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(AdminCreateAPIKeyResponse{Key: token, APIKeyInfo: info})
+}
+
+// adminUpdateAPIKeyHandler replaces the limits of a key
+func (srv *Server) adminUpdateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var limits APIKeyLimits
+	if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+		apiError(w, r, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if err := limits.Validate(); err != nil {
+		apiError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	info, err := srv.apiKeys.Update(mux.Vars(r)["id"], limits)
+	if err != nil {
+		apiError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+func (srv *Server) adminRevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if err := srv.apiKeys.Revoke(mux.Vars(r)["id"]); err != nil {
+		apiError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
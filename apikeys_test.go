@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyRegistry_Quota(t *testing.T) {
+	reg := NewAPIKeyRegistry()
+	info, token := reg.Create("team-a", "", APIKeyLimits{DailyQuota: 2})
+
+	key, ok := reg.Authenticate(token)
+	if !ok || key.ID != info.ID {
+		t.Fatal("Expected the issued token to authenticate")
+	}
+	if _, ok := reg.Authenticate(token + "x"); ok {
+		t.Error("Expected a wrong token to be rejected")
+	}
+
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := reg.Consume(key, now); err != nil {
+			t.Fatalf("Expected creation %d to be within quota, got %v", i+1, err)
+		}
+	}
+	if err := reg.Consume(key, now); err != ErrAPIKeyQuotaExceeded {
+		t.Errorf("Expected quota to be exceeded, got %v", err)
+	}
+
+	reg.Refund(key)
+	if err := reg.Consume(key, now); err != nil {
+		t.Errorf("Expected refunded unit to be usable, got %v", err)
+	}
+
+	// The quota resets once the window has passed
+	if err := reg.Consume(key, now.Add(APIKeyQuotaWindow)); err != nil {
+		t.Errorf("Expected quota to reset after the window, got %v", err)
+	}
+}
+
+func TestAPIKeyRegistry_Revoke(t *testing.T) {
+	reg := NewAPIKeyRegistry()
+	info, token := reg.Create("team-a", "", APIKeyLimits{})
+
+	if err := reg.Revoke(info.ID); err != nil {
+		t.Fatalf("Expected revoke to succeed, got %v", err)
+	}
+	if _, ok := reg.Authenticate(token); ok {
+		t.Error("Expected revoked key to be rejected")
+	}
+	if err := reg.Revoke(info.ID); err != ErrAPIKeyNotFound {
+		t.Errorf("Expected ErrAPIKeyNotFound, got %v", err)
+	}
+}
+
+func TestAPIKeys_CreateSecret(t *testing.T) {
+	_, server := setupAdminTestServer(t, func(cfg *Config) { cfg.RequireAPIKeys = true })
+	defer server.Close()
+
+	resp := adminRequest(t, server, "POST", "/admin/api/keys", testAdminKey, []byte(`{"name": "team-a", "daily_quota": 1, "max_lifetime": 60}`))
+	var created AdminCreateAPIKeyResponse
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || !strings.HasPrefix(created.Key, "psk_") {
+		t.Fatalf("Expected key to be created, got %d %+v", resp.StatusCode, created)
+	}
+
+	body := []byte(`{"content": "encrypted", "lifetime": 60}`)
+	tests := []struct {
+		name     string
+		key      string
+		body     []byte
+		expected int
+	}{
+		{"missing key", "", body, http.StatusUnauthorized},
+		{"invalid key", "psk_wrong", body, http.StatusUnauthorized},
+		{"lifetime above key limit", created.Key, []byte(`{"content": "encrypted", "lifetime": 1440}`), http.StatusBadRequest},
+		{"valid key", created.Key, body, http.StatusOK},
+		{"quota exceeded", created.Key, body, http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		resp := adminRequest(t, server, "POST", "/api/secrets", tt.key, tt.body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expected, resp.StatusCode)
+		}
+	}
+
+	resp = adminRequest(t, server, "GET", "/admin/api/keys", testAdminKey, nil)
+	var keys []APIKeyInfo
+	json.NewDecoder(resp.Body).Decode(&keys)
+	resp.Body.Close()
+	if len(keys) != 1 || keys[0].Used != 1 || keys[0].Name != "team-a" {
+		t.Errorf("Expected one key with one use, got %+v", keys)
+	}
+
+	resp = adminRequest(t, server, "PUT", "/admin/api/keys/"+created.ID, testAdminKey, []byte(`{"daily_quota": 5}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected update to succeed, got %d", resp.StatusCode)
+	}
+	resp = adminRequest(t, server, "POST", "/api/secrets", created.Key, body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected raised quota to allow another secret, got %d", resp.StatusCode)
+	}
+
+	resp = adminRequest(t, server, "DELETE", "/admin/api/keys/"+created.ID, testAdminKey, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected revoke to return 204, got %d", resp.StatusCode)
+	}
+	resp = adminRequest(t, server, "POST", "/api/secrets", created.Key, body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected revoked key to be rejected, got %d", resp.StatusCode)
+	}
+}
+
+func TestAPIKeys_OptionalByDefault(t *testing.T) {
+	_, server := setupTestServer(t)
+	defer server.Close()
+
+	resp := adminRequest(t, server, "POST", "/api/secrets", "", []byte(`{"content": "encrypted"}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected anonymous creation to be allowed, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// FailAttempt counts a wrong passphrase, PIN or TOTP code against a secret with an attempt
+// limit and destroys the secret once none are left, so a leaked link can't be guessed at
+// indefinitely. Its sender learns of it through the status and a destroyed event. Returns true
+// if this attempt destroyed the secret.
+func (s *SecretStore) FailAttempt(id string) bool {
+	if !s.failAttempt(id) {
+		return false
+	}
+	if replicator := s.getReplicator(); replicator != nil {
+		replicator.Burn(id)
+	}
+	return true
+}
+
+func (s *SecretStore) failAttempt(id string) bool {
+	sh := s.shardFor(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	secret, exists := sh.secrets[keyOf(id)]
+	if !exists || secret.AttemptsLeft == 0 {
+		return false
+	}
+	if time.Now().After(secret.ExpiresAt) {
+		s.remove(sh, id, secret, StatusExpired)
+		return false
+	}
+
+	secret.AttemptsLeft--
+	if secret.AttemptsLeft > 0 {
+		return false
+	}
+	s.remove(sh, id, secret, StatusDestroyed)
+	return true
+}
+
+// wrongAnswer replies to a wrong passphrase, PIN or TOTP code with key, or with 410 when the
+// attempt used up the secret's limit and destroyed it
+func (srv *Server) wrongAnswer(w http.ResponseWriter, r *http.Request, id, key string) {
+	srv.wrongAnswerError(r, id, key).reply(w, r)
+}
+
+// wrongAnswerError counts a wrong answer like wrongAnswer and returns the error to reply with
+func (srv *Server) wrongAnswerError(r *http.Request, id, key string) *requestError {
+	if srv.store.FailAttempt(id) {
+		srv.audit(r, string(StatusDestroyed), id)
+		return &requestError{Code: http.StatusGone, Key: "error.secret_destroyed"}
+	}
+	return &requestError{Code: http.StatusForbidden, Key: key}
+}
+
+// checkAnswer compares a passphrase or PIN with its hash. It returns nil when they match,
+// the error for key when none was given, and counts a wrong one like wrongAnswerError. When
+// too many are being hashed to check it in time the answer is not counted, and the reader
+// gets 503.
+func (srv *Server) checkAnswer(r *http.Request, id string, hash *PassphraseHash, answer, key string) *requestError {
+	if hash != nil && answer == "" {
+		return &requestError{Code: http.StatusForbidden, Key: key}
+	}
+	matches, err := hash.Matches(answer)
+	switch {
+	case err != nil:
+		return &requestError{Code: http.StatusServiceUnavailable, Key: "error.hashing_busy"}
+	case !matches:
+		return srv.wrongAnswerError(r, id, key)
+	}
+	return nil
+}
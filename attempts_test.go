@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClaimSecretHandler_MaxAttempts(t *testing.T) {
+	srv := newTestServer(t)
+	var events []SecretStatus
+	srv.store.Subscribe(func(event SecretEvent) { events = append(events, event.Type) })
+
+	jsonBody, _ := json.Marshal(CreateSecretRequest{Content: "encrypted", Lifetime: 60, RequirePIN: true, MaxAttempts: 3})
+	w := httptest.NewRecorder()
+	srv.createSecretHandler(w, httptest.NewRequest("POST", "/api/secrets", bytes.NewBuffer(jsonBody)))
+	var created CreateSecretResponse
+	json.NewDecoder(w.Body).Decode(&created)
+
+	// A missing PIN isn't a wrong one and doesn't count
+	if w := claimSecret(t, srv, created.ID, ClaimSecretRequest{}); w.Code != http.StatusForbidden {
+		t.Fatalf("Expected status 403 without a PIN, got %d", w.Code)
+	}
+	for i := 0; i < 2; i++ {
+		if w := claimSecret(t, srv, created.ID, ClaimSecretRequest{PIN: "000000"}); w.Code != http.StatusForbidden {
+			t.Fatalf("Attempt %d: expected status 403, got %d", i+1, w.Code)
+		}
+	}
+
+	w = claimSecret(t, srv, created.ID, ClaimSecretRequest{PIN: "000000"})
+	var body ErrorResponse
+	json.NewDecoder(w.Body).Decode(&body)
+	if w.Code != http.StatusGone || body.Code != "secret_destroyed" {
+		t.Fatalf("Expected secret_destroyed on the last attempt, got %d %q", w.Code, body.Code)
+	}
+	if _, found := srv.store.Peek(created.ID); found {
+		t.Error("Expected the secret to be wiped")
+	}
+	if state, found := srv.store.Status(created.ID); !found || state.Status != StatusDestroyed {
+		t.Errorf("Expected status destroyed, got %+v", state)
+	}
+	if len(events) != 1 || events[0] != StatusDestroyed {
+		t.Errorf("Expected one destroyed event, got %v", events)
+	}
+}
+
+func TestPlainText_PINAttemptsLimitedByDefault(t *testing.T) {
+	srv := newTestServer(t)
+
+	rec := createPlainText(t, srv, "require_pin=true", "token", http.Header{"Accept": {"application/json"}})
+	var created CreateSecretResponse
+	json.NewDecoder(rec.Body).Decode(&created)
+	wrong := "000000"
+	if created.PIN == wrong {
+		wrong = "111111"
+	}
+
+	// Neither the sender nor the server set a limit, but a PIN can't be guessed at indefinitely
+	for i := 1; i < DefaultPINAttempts; i++ {
+		if rec := readPlainTextLink(t, srv, created.Link, http.Header{PickupPINHeader: {wrong}}); rec.Code != http.StatusForbidden {
+			t.Fatalf("Attempt %d: expected status 403, got %d", i, rec.Code)
+		}
+	}
+	if rec := readPlainTextLink(t, srv, created.Link, http.Header{PickupPINHeader: {wrong}}); rec.Code != http.StatusGone {
+		t.Errorf("Expected the last attempt to destroy the secret, got %d", rec.Code)
+	}
+	if state, found := srv.store.Status(created.ID); !found || state.Status != StatusDestroyed {
+		t.Errorf("Expected status destroyed, got %+v", state)
+	}
+}
+
+func TestClaimSecretHandler_HashingBusy(t *testing.T) {
+	srv := newTestServer(t)
+	id, _ := srv.store.StoreWithOptions("encrypted", time.Hour, SecretOptions{PassphraseHash: "hash", MaxAttempts: 1})
+
+	// With every hashing slot taken, the passphrase can't be checked and doesn't count
+	for i := 0; i < cap(argon2Slots); i++ {
+		argon2Slots <- struct{}{}
+	}
+	rec := claimSecret(t, srv, id, ClaimSecretRequest{PassphraseHash: "wrong"})
+	for i := 0; i < cap(argon2Slots); i++ {
+		<-argon2Slots
+	}
+	var body ErrorResponse
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusServiceUnavailable || body.Code != "hashing_busy" {
+		t.Errorf("Expected hashing_busy, got %d %q", rec.Code, body.Code)
+	}
+
+	if rec := claimSecret(t, srv, id, ClaimSecretRequest{PassphraseHash: "hash"}); rec.Code != http.StatusOK {
+		t.Errorf("Expected the passphrase to be checked once a slot is free, got %d", rec.Code)
+	}
+}
+
+func TestSecretStore_FailAttemptWithoutLimit(t *testing.T) {
+	store := NewSecretStore()
+	id, _ := store.StoreWithOptions("secret", time.Hour, SecretOptions{PassphraseHash: "hash"})
+
+	for i := 0; i < 10; i++ {
+		if store.FailAttempt(id) {
+			t.Fatal("Expected a secret without a limit never to be destroyed")
+		}
+	}
+	if _, found := store.Peek(id); !found {
+		t.Error("Expected the secret to be kept")
+	}
+}
+
+func TestCreateSecretHandler_MaxAttempts(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.MaxAttempts = 5 })
+
+	for _, tt := range []struct {
+		maxAttempts int
+		want        int
+	}{
+		{0, 5},
+		{2, 2},
+	} {
+		jsonBody, _ := json.Marshal(CreateSecretRequest{Content: "encrypted", Lifetime: 60, MaxAttempts: tt.maxAttempts})
+		w := httptest.NewRecorder()
+		srv.createSecretHandler(w, httptest.NewRequest("POST", "/api/secrets", bytes.NewBuffer(jsonBody)))
+		var created CreateSecretResponse
+		json.NewDecoder(w.Body).Decode(&created)
+		if meta, found := srv.store.Peek(created.ID); !found || meta.AttemptsLeft != tt.want {
+			t.Errorf("max_attempts %d: expected %d attempts, got %+v", tt.maxAttempts, tt.want, meta)
+		}
+	}
+
+	jsonBody, _ := json.Marshal(CreateSecretRequest{Content: "encrypted", Lifetime: 60, MaxAttempts: MaxAttemptsLimit + 1})
+	w := httptest.NewRecorder()
+	srv.createSecretHandler(w, httptest.NewRequest("POST", "/api/secrets", bytes.NewBuffer(jsonBody)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 above the limit, got %d", w.Code)
+	}
+}
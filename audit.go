@@ -0,0 +1,256 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AuditEventCreated       = "created"
+	DefaultAuditMaxSize     = 100 << 20           // Size in bytes at which the audit file is rotated
+	DefaultAuditRetention   = 30 * 24 * time.Hour // How long rotated audit files are kept
+	AuditRotationInterval   = 24 * time.Hour      // The audit file is also rotated daily
+	MaxAuditUserAgentLength = 256
+	auditTimestampFormat    = "20060102T150405.000Z"
+
+	AuditFormatJSON = "json" // One JSON object per record
+	AuditFormatCEF  = "cef"  // ArcSight Common Event Format, for SIEMs such as QRadar
+)
+
+// AuditConfig configures the audit trail of secret lifecycle events
+type AuditConfig struct {
+	Target    string        // File path, "syslog" for the local daemon or syslog://, syslog+tcp:// or syslog+tls://host:port; "" disables auditing
+	Format    string        // json or cef
+	MaxSize   int64         // Rotate the file once it reaches this many bytes
+	Retention time.Duration // Delete rotated files older than this
+	IPKey     []byte        // HMAC key for client address hashes; random per process when nil
+}
+
+// Enabled reports whether an audit target is configured
+func (c AuditConfig) Enabled() bool {
+	return c.Target != ""
+}
+
+// Validate checks the record format is known and a remote syslog target names its server
+func (c AuditConfig) Validate() error {
+	if c.Format != AuditFormatJSON && c.Format != AuditFormatCEF {
+		return fmt.Errorf("unknown audit-format %q (expected %s or %s)", c.Format, AuditFormatJSON, AuditFormatCEF)
+	}
+	if network, addr, ok := remoteSyslogTarget(c.Target); ok {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("audit-log %s target must be host:port", network)
+		}
+	}
+	return nil
+}
+
+// AuditRecord is one line of the audit trail. It identifies the secret and the requester
+// without ever including content, passphrases or raw client addresses.
+type AuditRecord struct {
+	Time      string `json:"time"`
+	Event     string `json:"event"` // created, read, burned or expired
+	ID        string `json:"id"`
+	ClientIP  string `json:"client_ip_hash,omitempty"` // Keyed hash of the client address
+	UserAgent string `json:"user_agent,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// AuditLog writes audit records as JSON or CEF lines to a file or syslog
+type AuditLog struct {
+	mu     sync.Mutex
+	out    io.WriteCloser
+	format string
+	ipKey  []byte
+	now    func() time.Time
+}
+
+// NewAuditLog opens the configured audit target
+func NewAuditLog(cfg AuditConfig) (*AuditLog, error) {
+	var out io.WriteCloser
+	var err error
+	if network, addr, ok := remoteSyslogTarget(cfg.Target); ok {
+		out, err = newRemoteSyslogWriter(network, addr)
+	} else if cfg.Target == "syslog" {
+		out, err = newSyslogWriter()
+	} else {
+		out, err = newRotatingFile(cfg.Target, cfg.MaxSize, cfg.Retention)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ipKey := cfg.IPKey
+	if ipKey == nil {
+		ipKey = make([]byte, 32)
+		rand.Read(ipKey)
+	}
+	format := cfg.Format
+	if format == "" {
+		format = AuditFormatJSON
+	}
+	return &AuditLog{out: out, format: format, ipKey: ipKey, now: time.Now}, nil
+}
+
+// hashAddr returns a keyed hash of addr, so records from the same client can be correlated
+// without the log revealing who the client was
+func (a *AuditLog) hashAddr(addr netip.Addr) string {
+	if !addr.IsValid() {
+		return ""
+	}
+	mac := hmac.New(sha256.New, a.ipKey)
+	mac.Write(addr.AsSlice())
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// Record writes one event. r and addr describe the requester and may be nil and zero for
+// events without a request, such as expiry.
+func (a *AuditLog) Record(event, id string, r *http.Request, addr netip.Addr) {
+	if a == nil {
+		return
+	}
+
+	record := AuditRecord{
+		Time:     a.now().UTC().Format(time.RFC3339Nano),
+		Event:    event,
+		ID:       id,
+		ClientIP: a.hashAddr(addr),
+	}
+	if r != nil {
+		record.UserAgent = r.UserAgent()
+		if len(record.UserAgent) > MaxAuditUserAgentLength {
+			record.UserAgent = record.UserAgent[:MaxAuditUserAgentLength]
+		}
+		record.RequestID = requestIDFromContext(r.Context())
+	}
+
+	var line []byte
+	if a.format == AuditFormatCEF {
+		line = formatCEF(record)
+	} else {
+		var err error
+		if line, err = json.Marshal(record); err != nil {
+			return
+		}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.out.Write(append(line, '\n'))
+}
+
+// HandleEvent records expiry, eviction and blocking, the lifecycle events not caused by a sender
+// or recipient; reads and burns are recorded by the handlers, which know the requester. Safe to
+// use as a store listener.
+func (a *AuditLog) HandleEvent(event SecretEvent) {
+	if event.Type == StatusExpired || event.Type == StatusEvicted || event.Type == StatusBlocked {
+		a.Record(string(event.Type), event.ID, nil, netip.Addr{})
+	}
+}
+
+// Close flushes and closes the audit target
+func (a *AuditLog) Close() error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.out.Close()
+}
+
+// audit records a request-driven event if auditing is enabled
+func (srv *Server) audit(r *http.Request, event, id string) {
+	if srv.auditLog == nil {
+		return
+	}
+	srv.auditLog.Record(event, id, r, clientAddr(r, srv.config.TrustedProxies))
+}
+
+// rotatingFile appends to a file, moving it aside with a timestamp suffix once it grows past
+// maxSize or is a day old, and deleting moved-aside files older than retention
+type rotatingFile struct {
+	path      string
+	maxSize   int64
+	retention time.Duration
+	now       func() time.Time
+
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+func newRotatingFile(path string, maxSize int64, retention time.Duration) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, retention: retention, now: time.Now}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	f.prune()
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	f.file, f.size, f.opened = file, info.Size(), f.now()
+	return nil
+}
+
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	if f.size > 0 && (f.size+int64(len(p)) > f.maxSize || f.now().Sub(f.opened) >= AuditRotationInterval) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate moves the current file aside and starts a new one
+func (f *rotatingFile) rotate() error {
+	f.file.Close()
+	if err := os.Rename(f.path, f.path+"."+f.now().UTC().Format(auditTimestampFormat)); err != nil {
+		// Keep appending to the old file rather than losing records
+		slog.Error("Failed to rotate audit log", "error", err)
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.prune()
+	return nil
+}
+
+// prune deletes rotated files whose timestamp suffix is older than the retention period
+func (f *rotatingFile) prune() {
+	matches, _ := filepath.Glob(f.path + ".*")
+	cutoff := f.now().Add(-f.retention)
+	for _, match := range matches {
+		rotated, err := time.Parse(auditTimestampFormat, strings.TrimPrefix(match, f.path+"."))
+		if err == nil && rotated.Before(cutoff) {
+			os.Remove(match)
+		}
+	}
+}
+
+func (f *rotatingFile) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// cefSeverities rates audit events on CEF's 0-10 scale; other events are 3
+var cefSeverities = map[string]int{
+	string(StatusEvicted):   4,
+	string(StatusBlocked):   5,
+	"exported":              6,
+	"imported":              6,
+	string(StatusDestroyed): 7, // Too many wrong passphrases, PINs or codes
+	string(EventCanary):     9,
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+// formatCEF renders a record as a CEF line. The secret ID, client address hash and request ID
+// go in custom string fields, as the hash is not an address.
+func formatCEF(record AuditRecord) []byte {
+	severity, ok := cefSeverities[record.Event]
+	if !ok {
+		severity = 3
+	}
+	header := []string{"CEF:0", "picosend", "picosend", Version, record.Event, "Secret " + record.Event, fmt.Sprint(severity)}
+	for i := 1; i < 6; i++ {
+		header[i] = cefHeaderEscaper.Replace(header[i])
+	}
+
+	extension := []string{"act=" + cefExtensionEscaper.Replace(record.Event)}
+	if t, err := time.Parse(time.RFC3339Nano, record.Time); err == nil {
+		extension = append(extension, fmt.Sprintf("rt=%d", t.UnixMilli()))
+	}
+	fields := []struct{ key, label, value string }{
+		{"cs1", "secretId", record.ID},
+		{"cs2", "clientIpHash", record.ClientIP},
+		{"cs3", "requestId", record.RequestID},
+	}
+	for _, field := range fields {
+		if field.value != "" {
+			extension = append(extension, field.key+"Label="+field.label, field.key+"="+cefExtensionEscaper.Replace(field.value))
+		}
+	}
+	if record.UserAgent != "" {
+		extension = append(extension, "requestClientApplication="+cefExtensionEscaper.Replace(record.UserAgent))
+	}
+	return []byte(strings.Join(header, "|") + "|" + strings.Join(extension, " "))
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	SyslogTimeout = 5 * time.Second // Timeout for connecting to and writing to a remote syslog server
+	// syslogPriority is the authpriv facility (10) at informational severity (6)
+	syslogPriority = 10*8 + 6
+)
+
+// remoteSyslogTarget splits a syslog://, syslog+tcp:// or syslog+tls:// audit target into its
+// network and address
+func remoteSyslogTarget(target string) (network, addr string, ok bool) {
+	for _, network := range []string{"udp", "tcp", "tls"} {
+		prefix := "syslog+" + network + "://"
+		if network == "udp" {
+			prefix = "syslog://"
+		}
+		if addr, ok := strings.CutPrefix(target, prefix); ok {
+			return network, addr, true
+		}
+	}
+	return "", "", false
+}
+
+// remoteSyslogWriter sends each line written to it to a syslog server as an RFC 5424 message:
+// one datagram per message over UDP, octet-counted framing (RFC 6587) over TCP and TLS.
+// A broken stream connection is redialled once per message.
+type remoteSyslogWriter struct {
+	network  string
+	addr     string
+	hostname string
+	procID   string
+	conn     net.Conn
+}
+
+func newRemoteSyslogWriter(network, addr string) (*remoteSyslogWriter, error) {
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	w := &remoteSyslogWriter{network: network, addr: addr, hostname: hostname, procID: fmt.Sprint(os.Getpid())}
+	if err := w.dial(); err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return w, nil
+}
+
+func (w *remoteSyslogWriter) dial() error {
+	dialer := &net.Dialer{Timeout: SyslogTimeout}
+	var conn net.Conn
+	var err error
+	if w.network == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", w.addr, nil)
+	} else {
+		conn, err = dialer.Dial(w.network, w.addr)
+	}
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	return nil
+}
+
+// Write sends p, without its trailing newline, as the MSG of one message with the NILVALUE
+// for MSGID and structured data
+func (w *remoteSyslogWriter) Write(p []byte) (int, error) {
+	msg := fmt.Sprintf("<%d>1 %s %s picosend %s - - %s", syslogPriority,
+		time.Now().UTC().Format("2006-01-02T15:04:05.000000Z"), w.hostname, w.procID, bytes.TrimRight(p, "\n"))
+	frame := []byte(msg)
+	if w.network != "udp" {
+		frame = []byte(fmt.Sprintf("%d %s", len(msg), msg))
+	}
+
+	// A connection the server closed only fails on a later write, so redial once
+	if w.conn != nil {
+		if err := w.send(frame); err == nil {
+			return len(p), nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	if err := w.dial(); err != nil {
+		return 0, err
+	}
+	if err := w.send(frame); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// send writes one frame, with a deadline so a stalled server can't hold up the requests being
+// audited
+func (w *remoteSyslogWriter) send(frame []byte) error {
+	w.conn.SetWriteDeadline(time.Now().Add(SyslogTimeout))
+	_, err := w.conn.Write(frame)
+	return err
+}
+
+func (w *remoteSyslogWriter) Close() error {
+	if w.conn == nil {
+		return nil
+	}
+	return w.conn.Close()
+}
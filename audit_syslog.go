@@ -0,0 +1,19 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+)
+
+// newSyslogWriter connects to the local syslog daemon. Records are sent to the authpriv
+// facility, which is usually readable only by root.
+func newSyslogWriter() (io.WriteCloser, error) {
+	w, err := syslog.New(syslog.LOG_AUTHPRIV|syslog.LOG_INFO, "picosend")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return w, nil
+}
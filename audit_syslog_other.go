@@ -0,0 +1,14 @@
+//go:build windows || plan9
+
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+// The local syslog daemon is not available on this platform, audit to a file or a remote
+// syslog server instead
+func newSyslogWriter() (io.WriteCloser, error) {
+	return nil, errors.New("local syslog is not supported on this platform")
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readAuditRecords parses every record written to an audit file
+func readAuditRecords(t *testing.T, path string) []AuditRecord {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	var records []AuditRecord
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Invalid audit line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestAuditLog_Lifecycle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.Audit.Target = path
+		cfg.Audit.IPKey = []byte("test key")
+	})
+	router := srv.routes()
+
+	create := func() string {
+		req := httptest.NewRequest("POST", "/api/secrets", strings.NewReader(`{"content":"top secret","lifetime":5}`))
+		req.RemoteAddr = "203.0.113.7:5000"
+		req.Header.Set("User-Agent", "audit-test")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		var resp CreateSecretResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return resp.ID
+	}
+
+	readID := create()
+	body, _ := json.Marshal(ClaimSecretRequest{ClaimToken: srv.claims.Issue(readID, time.Now())})
+	req := httptest.NewRequest("POST", "/api/secrets/"+readID+"/claim", bytes.NewReader(body))
+	req.RemoteAddr = "198.51.100.2:6000"
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	burnID := create()
+	req = httptest.NewRequest("DELETE", "/api/secrets/"+burnID, nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	expiredID, _ := srv.store.Store("expiring", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	srv.store.CleanupExpired()
+
+	srv.Close()
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "top secret") || strings.Contains(string(data), "expiring") {
+		t.Fatal("Audit log contains secret content")
+	}
+	if strings.Contains(string(data), "203.0.113.7") {
+		t.Fatal("Audit log contains a raw client address")
+	}
+
+	records := readAuditRecords(t, path)
+	want := []struct{ event, id string }{
+		{"created", readID},
+		{"read", readID},
+		{"created", burnID},
+		{"expired", expiredID},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("Expected %d records, got %d: %+v", len(want), len(records), records)
+	}
+	for i, w := range want {
+		if records[i].Event != w.event || records[i].ID != w.id {
+			t.Errorf("Record %d: expected %s %s, got %s %s", i, w.event, w.id, records[i].Event, records[i].ID)
+		}
+	}
+
+	if records[0].UserAgent != "audit-test" || records[0].RequestID == "" {
+		t.Errorf("Expected user agent and request ID on create, got %+v", records[0])
+	}
+	if records[0].ClientIP == "" || records[0].ClientIP != records[2].ClientIP {
+		t.Error("Expected the same client to hash to the same value")
+	}
+	if records[0].ClientIP == records[1].ClientIP {
+		t.Error("Expected different clients to hash to different values")
+	}
+	if records[3].ClientIP != "" {
+		t.Error("Expected no client on expiry")
+	}
+}
+
+func TestAuditLog_Burn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	srv := newTestServer(t, func(cfg *Config) { cfg.Audit.Target = path })
+
+	id, _ := srv.store.StoreWithOptions("content", time.Hour, SecretOptions{ManagementToken: "token"})
+	req := httptest.NewRequest("DELETE", "/api/secrets/"+id, nil)
+	req.Header.Set("Authorization", "Bearer token")
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", rec.Code)
+	}
+
+	srv.Close()
+	records := readAuditRecords(t, path)
+	if len(records) != 1 || records[0].Event != "burned" || records[0].ID != id {
+		t.Errorf("Expected one burned record, got %+v", records)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// A rotated file from long ago is pruned on the next rotation
+	stale := path + "." + now.Add(-40*24*time.Hour).Format(auditTimestampFormat)
+	os.WriteFile(stale, []byte("old\n"), 0o600)
+
+	f, err := newRotatingFile(path, 10, 30*24*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer f.Close()
+	f.now = func() time.Time { return now }
+
+	f.Write([]byte("12345678\n"))
+	f.Write([]byte("abcdefgh\n")) // Exceeds maxSize, rotates first
+
+	rotated := path + "." + now.Format(auditTimestampFormat)
+	if data, _ := os.ReadFile(rotated); string(data) != "12345678\n" {
+		t.Errorf("Expected first line in rotated file, got %q", data)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "abcdefgh\n" {
+		t.Errorf("Expected second line in current file, got %q", data)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("Expected file older than retention to be deleted")
+	}
+
+	// A day later the file rotates even though it is small
+	now = now.Add(AuditRotationInterval)
+	f.Write([]byte("x\n"))
+	if data, _ := os.ReadFile(path); string(data) != "x\n" {
+		t.Errorf("Expected daily rotation, got %q", data)
+	}
+}
+
+func TestFormatCEF(t *testing.T) {
+	line := string(formatCEF(AuditRecord{
+		Time:      "2024-01-01T12:00:00Z",
+		Event:     "destroyed",
+		ID:        "abc123",
+		ClientIP:  "9f2c",
+		UserAgent: "evil=agent\nforged|line",
+	}))
+	want := `CEF:0|picosend|picosend|` + Version + `|destroyed|Secret destroyed|7|act=destroyed rt=1704110400000 cs1Label=secretId cs1=abc123 cs2Label=clientIpHash cs2=9f2c requestClientApplication=evil\=agent\nforged|line`
+	if line != want {
+		t.Errorf("Unexpected CEF line\n got %s\nwant %s", line, want)
+	}
+}
+
+func TestAuditLog_RemoteSyslog(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		var size int
+		fmt.Fscanf(reader, "%d ", &size)
+		frame := make([]byte, size)
+		io.ReadFull(reader, frame)
+		received <- string(frame)
+	}()
+
+	auditLog, err := NewAuditLog(AuditConfig{Target: "syslog+tcp://" + listener.Addr().String(), Format: AuditFormatCEF})
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer auditLog.Close()
+	auditLog.Record("read", "abc123", nil, netip.Addr{})
+
+	select {
+	case msg := <-received:
+		if !strings.HasPrefix(msg, "<86>1 ") || !strings.Contains(msg, " picosend ") || !strings.Contains(msg, " - - CEF:0|picosend|picosend|"+Version+"|read|Secret read|3|act=read rt=") {
+			t.Errorf("Unexpected syslog message %q", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a syslog message")
+	}
+}
+
+func TestAuditConfig_Validate(t *testing.T) {
+	valid := []AuditConfig{
+		{Target: "/var/log/picosend/audit.log", Format: AuditFormatJSON},
+		{Target: "syslog", Format: AuditFormatCEF},
+		{Target: "syslog+tls://siem.example.com:6514", Format: AuditFormatCEF},
+	}
+	for _, cfg := range valid {
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", cfg, err)
+		}
+	}
+	invalid := []AuditConfig{
+		{Target: "syslog", Format: "leef"},
+		{Target: "syslog+tcp://siem.example.com", Format: AuditFormatJSON},
+	}
+	for _, cfg := range invalid {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", cfg)
+		}
+	}
+}
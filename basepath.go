@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// normalizeBasePath turns a user supplied prefix like "tools/picosend/" into "/tools/picosend".
+// "" and "/" mean the root and normalize to "".
+func normalizeBasePath(prefix string) (string, error) {
+	prefix = strings.Trim(strings.TrimSpace(prefix), "/")
+	if prefix == "" {
+		return "", nil
+	}
+	if strings.ContainsAny(prefix, "?#%\\ ") || strings.Contains(prefix, "//") {
+		return "", fmt.Errorf("invalid base-path %q", prefix)
+	}
+	for _, segment := range strings.Split(prefix, "/") {
+		if segment == "." || segment == ".." {
+			return "", fmt.Errorf("invalid base-path %q", prefix)
+		}
+	}
+	return "/" + prefix, nil
+}
+
+// normalizePublicURL checks a public URL is a bare http or https origin and strips any
+// trailing slash. The base path is added to it separately.
+func normalizePublicURL(raw string) (string, error) {
+	raw = strings.TrimSuffix(strings.TrimSpace(raw), "/")
+	if raw == "" {
+		return "", nil
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" ||
+		parsed.Path != "" || parsed.RawQuery != "" || parsed.Fragment != "" || parsed.User != nil {
+		return "", fmt.Errorf("invalid public-url %q (expected an origin such as https://secrets.example.com)", raw)
+	}
+	return raw, nil
+}
+
+// mountHandler serves h under prefix, stripping it before routing. The bare prefix
+// redirects to prefix + "/" so relative links resolve, and anything outside it is a 404.
+func mountHandler(prefix string, h http.Handler) http.Handler {
+	if prefix == "" {
+		return h
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(prefix+"/", http.StripPrefix(prefix, h))
+	mux.Handle(prefix, http.RedirectHandler(prefix+"/", http.StatusMovedPermanently))
+	return mux
+}
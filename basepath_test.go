@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMountHandler(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.BasePath = "/tools/picosend" })
+
+	server := httptest.NewServer(srv.Handler())
+	defer server.Close()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	resp, err := client.Get(server.URL + "/tools/picosend")
+	if err != nil {
+		t.Fatalf("Failed to get base path: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != "/tools/picosend/" {
+		t.Errorf("Expected redirect to /tools/picosend/, got %d %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	resp, err = client.Get(server.URL + "/tools/picosend/")
+	if err != nil {
+		t.Fatalf("Failed to get home page: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(string(body), `href="/tools/picosend/static/css/pico.min.`) {
+		t.Error("Expected static asset links to include the base path")
+	}
+	if !strings.Contains(string(body), `const BASE_PATH = "/tools/picosend";`) {
+		t.Error("Expected page script to know the base path")
+	}
+
+	for path, expected := range map[string]int{
+		"/tools/picosend/static/css/pico.min.css": http.StatusOK,
+		"/tools/picosend/api/config":              http.StatusOK,
+		"/api/config":                             http.StatusNotFound,
+	} {
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != expected {
+			t.Errorf("%s: expected status %d, got %d", path, expected, resp.StatusCode)
+		}
+	}
+
+	resp, err = client.Get(server.URL + "/tools/picosend/api/openapi.json")
+	if err != nil {
+		t.Fatalf("Failed to get OpenAPI document: %v", err)
+	}
+	var doc struct {
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+	}
+	json.NewDecoder(resp.Body).Decode(&doc)
+	resp.Body.Close()
+	if len(doc.Servers) != 1 || doc.Servers[0].URL != "/tools/picosend" {
+		t.Errorf("Expected OpenAPI server /tools/picosend, got %+v", doc.Servers)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+const MaxBatchSecrets = 100 // Maximum number of secrets created by one batch request
+
+type BatchCreateSecretsRequest struct {
+	Secrets []CreateSecretRequest `json:"secrets"`
+}
+
+// BatchSecretResult is the outcome of one item of a batch, in request order
+type BatchSecretResult struct {
+	*CreateSecretResponse        // Set when the secret was created
+	Status                int    `json:"status"` // HTTP status the item would have got as a single request
+	Error                 string `json:"error,omitempty"`
+}
+
+type BatchCreateSecretsResponse struct {
+	Results []BatchSecretResult `json:"results"`
+}
+
+// batchCreateSecretsHandler creates several secrets in one request. Each item is validated and
+// stored on its own, so an invalid item doesn't prevent the others from being created.
+func (srv *Server) batchCreateSecretsHandler(w http.ResponseWriter, r *http.Request) {
+	apiKey, ok := srv.requestAPIKey(w, r)
+	if !ok {
+		return
+	}
+
+	var req BatchCreateSecretsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "error.invalid_json")
+		return
+	}
+	if len(req.Secrets) == 0 {
+		localizedError(w, r, http.StatusBadRequest, "error.batch_empty")
+		return
+	}
+	if len(req.Secrets) > MaxBatchSecrets {
+		localizedError(w, r, http.StatusBadRequest, "error.batch_too_large", MaxBatchSecrets)
+		return
+	}
+
+	locale := requestLocale(w, r)
+	results := make([]BatchSecretResult, len(req.Secrets))
+	for i, item := range req.Secrets {
+		// Chunked uploads need follow-up requests per secret, which defeats batching
+		if item.Chunked {
+			results[i] = BatchSecretResult{Status: http.StatusBadRequest, Error: locale.T("error.batch_chunked")}
+			continue
+		}
+		response, reqErr := srv.createSecret(r, apiKey, item)
+		if reqErr != nil {
+			results[i] = BatchSecretResult{Status: reqErr.Code, Error: reqErr.text(locale)}
+			continue
+		}
+		results[i] = BatchSecretResult{CreateSecretResponse: &response, Status: http.StatusOK}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BatchCreateSecretsResponse{Results: results})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBatchCreateSecretsHandler(t *testing.T) {
+	srv := newTestServer(t)
+	router := srv.routes()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/secrets/batch", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := post(`{"secrets": [{"content": "first"}, {"content": ""}, {"content": "third", "max_reads": 1000}, {"chunked": true}, {"content": "fifth"}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp BatchCreateSecretsResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if len(resp.Results) != 5 {
+		t.Fatalf("Expected 5 results, got %d", len(resp.Results))
+	}
+	for i, expected := range []int{200, 400, 400, 400, 200} {
+		result := resp.Results[i]
+		if result.Status != expected {
+			t.Errorf("Item %d: expected status %d, got %d (%s)", i, expected, result.Status, result.Error)
+		}
+		if created := result.CreateSecretResponse != nil; created != (expected == 200) || created == (result.Error != "") {
+			t.Errorf("Item %d: unexpected result %+v", i, result)
+		}
+	}
+	if srv.store.Count() != 2 {
+		t.Errorf("Expected 2 secrets stored, got %d", srv.store.Count())
+	}
+	if _, found := srv.store.Peek(resp.Results[4].ID); !found {
+		t.Error("Expected the returned ID to be stored")
+	}
+
+	if rec := post(`{"secrets": []}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an empty batch to be rejected, got %d", rec.Code)
+	}
+	tooMany := `{"secrets": [` + strings.Repeat(`{"content": "x"},`, MaxBatchSecrets) + `{"content": "x"}]}`
+	if rec := post(tooMany); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an oversized batch to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestBatchCreateSecretsHandler_APIKeyQuota(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.apiKeys.Create("onboarding", "", APIKeyLimits{DailyQuota: 2})
+
+	req := httptest.NewRequest("POST", "/api/secrets/batch", strings.NewReader(`{"secrets": [{"content": "a"}, {"content": "b"}, {"content": "c"}]}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+
+	var resp BatchCreateSecretsResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if len(resp.Results) != 3 || resp.Results[1].Status != http.StatusOK || resp.Results[2].Status != http.StatusTooManyRequests {
+		t.Errorf("Expected the quota to stop the third item, got %+v", resp.Results)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+const (
+	DefaultBlobThreshold = 4096             // Content at least this large is moved to the blob store
+	BlobRequestTimeout   = 30 * time.Second // Timeout for a single blob store operation
+)
+
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore keeps large encrypted payloads outside process memory. Only secret
+// metadata stays in the SecretStore; the content is addressed by secret ID.
+type BlobStore interface {
+	// Put stores data under id. expiresAt is a hint for backends with native expiry.
+	// data is wiped once Put returns, so it must not be retained.
+	Put(ctx context.Context, id string, data []byte, expiresAt time.Time) error
+	// Get returns a copy of the data stored under id, or ErrBlobNotFound. The caller wipes it.
+	Get(ctx context.Context, id string) ([]byte, error)
+	// Delete removes the data stored under id. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, id string) error
+}
+
+// BlobExpirer is implemented by blob stores that expire content natively, so an expiry changed
+// after Put carries over. createdAt is when the secret was stored.
+type BlobExpirer interface {
+	SetExpiry(ctx context.Context, id string, createdAt, expiresAt time.Time) error
+}
+
+// SetBlobStore moves content of at least threshold bytes to blobs for secrets stored from now on
+func (s *SecretStore) SetBlobStore(blobs BlobStore, threshold int) {
+	s.updateSettings(func(settings *storeSettings) {
+		settings.blobs = blobs
+		settings.blobThreshold = threshold
+	})
+}
+
+// blobStoreFor returns the blob store if content of this size should be offloaded, nil otherwise
+func (s *SecretStore) blobStoreFor(size int) BlobStore {
+	settings := s.settings.Load()
+	if settings.blobs == nil || size < settings.blobThreshold {
+		return nil
+	}
+	return settings.blobs
+}
+
+func (s *SecretStore) getBlobStore() BlobStore {
+	return s.settings.Load().blobs
+}
+
+// fetchBlob loads offloaded content, deleting the blob when this was the last read
+func (s *SecretStore) fetchBlob(id string, lastRead bool) ([]byte, error) {
+	blobs := s.getBlobStore()
+	if blobs == nil {
+		return nil, ErrBlobNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), BlobRequestTimeout)
+	defer cancel()
+
+	data, err := blobs.Get(ctx, id)
+	if lastRead {
+		if err := blobs.Delete(ctx, id); err != nil {
+			slog.Warn("Failed to delete blob", "error", err)
+		}
+	}
+	return data, err
+}
+
+// deleteBlobAsync removes offloaded content without blocking the caller, which may hold a shard lock.
+// Failures are only logged, the backend's lifecycle expiry is the safety net.
+func (s *SecretStore) deleteBlobAsync(id string) {
+	blobs := s.getBlobStore()
+	if blobs == nil {
+		return
+	}
+
+	s.blobDeletes.Add(1)
+	go func() {
+		defer s.blobDeletes.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), BlobRequestTimeout)
+		defer cancel()
+		if err := blobs.Delete(ctx, id); err != nil {
+			slog.Warn("Failed to delete blob", "error", err)
+		}
+	}()
+}
+
+// updateBlobExpiryAsync passes a changed expiry on to blob stores with native expiry, without
+// blocking the caller, which holds a shard lock
+func (s *SecretStore) updateBlobExpiryAsync(id string, createdAt, expiresAt time.Time) {
+	expirer, ok := s.getBlobStore().(BlobExpirer)
+	if !ok {
+		return
+	}
+
+	s.blobDeletes.Add(1)
+	go func() {
+		defer s.blobDeletes.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), BlobRequestTimeout)
+		defer cancel()
+		if err := expirer.SetExpiry(ctx, id, createdAt, expiresAt); err != nil {
+			slog.Warn("Failed to update blob expiry", "error", err)
+		}
+	}()
+}
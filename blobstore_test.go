@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryBlobStore is an in-memory BlobStore for tests
+type memoryBlobStore struct {
+	mu    sync.Mutex
+	blobs map[string][]byte
+}
+
+func newMemoryBlobStore() *memoryBlobStore {
+	return &memoryBlobStore{blobs: make(map[string][]byte)}
+}
+
+func (m *memoryBlobStore) Put(ctx context.Context, id string, data []byte, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blobs[id] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *memoryBlobStore) Get(ctx context.Context, id string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.blobs[id]
+	if !ok {
+		return nil, ErrBlobNotFound
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (m *memoryBlobStore) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.blobs, id)
+	return nil
+}
+
+func (m *memoryBlobStore) len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.blobs)
+}
+
+func TestSecretStore_OffloadsLargeContent(t *testing.T) {
+	s := NewSecretStore()
+	blobs := newMemoryBlobStore()
+	s.SetBlobStore(blobs, 100)
+
+	small, err := s.Store("small", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to store secret: %v", err)
+	}
+	large := strings.Repeat("x", 100)
+	id, err := s.StoreWithOptions(large, time.Hour, SecretOptions{MaxReads: 2})
+	if err != nil {
+		t.Fatalf("Failed to store secret: %v", err)
+	}
+
+	if blobs.len() != 1 {
+		t.Fatalf("Expected only the large secret in the blob store, got %d blobs", blobs.len())
+	}
+	if len(s.shardFor(id).secrets[keyOf(id)].Content) != 0 {
+		t.Error("Expected offloaded content not to be kept in memory")
+	}
+	if string(s.shardFor(small).secrets[keyOf(small)].Content) != "small" {
+		t.Error("Expected small content to stay in memory")
+	}
+
+	// The blob survives until the last read
+	for i := 0; i < 2; i++ {
+		secret, found := s.Get(id)
+		if !found || string(secret.Content) != large {
+			t.Fatalf("Expected read %d to return the content", i+1)
+		}
+	}
+	if blobs.len() != 0 {
+		t.Errorf("Expected blob to be deleted after the last read, got %d blobs", blobs.len())
+	}
+}
+
+func TestSecretStore_BlobDeletedOnBurnAndExpiry(t *testing.T) {
+	s := NewSecretStore()
+	blobs := newMemoryBlobStore()
+	s.SetBlobStore(blobs, 0)
+
+	burned, _ := s.StoreWithOptions("burn me", time.Hour, SecretOptions{ManagementToken: "token"})
+	s.Store("expire me", -time.Minute)
+
+	if err := s.Burn(burned, "token"); err != nil {
+		t.Fatalf("Failed to burn secret: %v", err)
+	}
+	s.CleanupExpired()
+	s.blobDeletes.Wait()
+
+	if blobs.len() != 0 {
+		t.Errorf("Expected burned and expired blobs to be deleted, got %d blobs", blobs.len())
+	}
+}
+
+func TestSecretStore_WipeAllDeletesBlobs(t *testing.T) {
+	s := NewSecretStore()
+	blobs := newMemoryBlobStore()
+	s.SetBlobStore(blobs, 0)
+
+	s.Store("one", time.Hour)
+	s.Store("two", time.Hour)
+
+	if wiped := s.WipeAll(); wiped != 2 {
+		t.Errorf("Expected 2 secrets wiped, got %d", wiped)
+	}
+	if blobs.len() != 0 {
+		t.Errorf("Expected all blobs deleted, got %d", blobs.len())
+	}
+}
+
+// slowBlobStore holds every Put until release is closed, so creates overlap
+type slowBlobStore struct {
+	*memoryBlobStore
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *slowBlobStore) Put(ctx context.Context, id string, data []byte, expiresAt time.Time) error {
+	b.started <- struct{}{}
+	<-b.release
+	return b.memoryBlobStore.Put(ctx, id, data, expiresAt)
+}
+
+func TestSecretStore_SlugRaceKeepsBlob(t *testing.T) {
+	s := NewSecretStore()
+	blobs := &slowBlobStore{memoryBlobStore: newMemoryBlobStore(), started: make(chan struct{}, 2), release: make(chan struct{})}
+	s.SetBlobStore(blobs, 0)
+
+	done := make(chan error)
+	go func() {
+		_, err := s.StoreWithOptions("first", time.Hour, SecretOptions{ID: "slug"})
+		done <- err
+	}()
+	<-blobs.started
+
+	// A second create of the slug fails while the first is still offloading, before its own Put
+	if _, err := s.StoreWithOptions("second", time.Hour, SecretOptions{ID: "slug"}); !errors.Is(err, ErrIDTaken) {
+		t.Errorf("Expected ErrIDTaken, got %v", err)
+	}
+	close(blobs.release)
+	if err := <-done; err != nil {
+		t.Fatalf("Expected the first create to succeed, got %v", err)
+	}
+	s.blobDeletes.Wait()
+	if secret, found := s.Get("slug"); !found || string(secret.Content) != "first" {
+		t.Error("Expected the first create's content to survive")
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// DefaultProductName is shown in page titles and headers unless the instance is rebranded
+const DefaultProductName = "PicoSend"
+
+var accentColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// Branding customizes how the web pages present the instance, so it can be white-labeled
+type Branding struct {
+	ProductName  string // Shown in page titles and headers
+	LogoURL      string // Image shown in the header next to the product name; empty for none
+	AccentColor  string // Hex color for buttons and links; empty keeps the default theme
+	FooterText   string // Replaces the default footer line; empty keeps it
+	TemplatesDir string // Directory of page templates overriding the embedded ones with the same name
+	StaticDir    string // Directory of files served under /static, overriding embedded files with the same path
+}
+
+// Validate checks the accent color and that override directories exist
+func (b Branding) Validate() error {
+	if b.ProductName == "" {
+		return fmt.Errorf("brand-name must not be empty")
+	}
+	if b.AccentColor != "" && !accentColorPattern.MatchString(b.AccentColor) {
+		return fmt.Errorf("invalid brand-accent-color %q (expected a hex color like #0b7285)", b.AccentColor)
+	}
+	for flag, dir := range map[string]string{"templates-dir": b.TemplatesDir, "static-dir": b.StaticDir} {
+		if dir == "" {
+			continue
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return fmt.Errorf("%s %q is not a directory", flag, dir)
+		}
+	}
+	return nil
+}
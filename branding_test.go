@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBranding_Pages(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.Branding.ProductName = "Acme Vault"
+		cfg.Branding.LogoURL = "/static/images/acme.svg"
+		cfg.Branding.AccentColor = "#0b7285"
+		cfg.Branding.FooterText = "Internal use only"
+	})
+	router := srv.routes()
+
+	for _, path := range []string{"/", "/s/unknown"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		body := rec.Body.String()
+		for _, expected := range []string{"<title>Acme Vault", `src="/static/images/acme.svg"`, "--pico-primary: #0b7285;", "Internal use only"} {
+			if !strings.Contains(body, expected) {
+				t.Errorf("%s: expected page to contain %q", path, expected)
+			}
+		}
+		if strings.Contains(body, "PicoSend") {
+			t.Errorf("%s: expected the default product name to be replaced", path)
+		}
+	}
+}
+
+func TestBranding_OverrideDirectories(t *testing.T) {
+	templatesDir, staticDir := t.TempDir(), t.TempDir()
+	os.WriteFile(filepath.Join(templatesDir, "brand.html"), []byte(`{{define "brand-title"}}<span>custom header</span>{{end}}{{define "brand-style"}}{{end}}`), 0o644)
+	os.MkdirAll(filepath.Join(staticDir, "css"), 0o755)
+	os.WriteFile(filepath.Join(staticDir, "css", "pico.min.css"), []byte("body { color: red; }"), 0o644)
+	os.WriteFile(filepath.Join(staticDir, "logo.svg"), []byte("<svg></svg>"), 0o644)
+
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.Branding.TemplatesDir = templatesDir
+		cfg.Branding.StaticDir = staticDir
+	})
+	router := srv.routes()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(rec.Body.String(), "<span>custom header</span>") {
+		t.Error("Expected the overriding template to be used")
+	}
+
+	for path, expected := range map[string]string{
+		"/static/css/pico.min.css": "body { color: red; }",
+		"/static/logo.svg":         "<svg></svg>",
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Body.String() != expected {
+			t.Errorf("%s: expected the overriding file, got %q", path, rec.Body.String())
+		}
+	}
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/robots.txt", nil))
+	if rec.Code != 200 {
+		t.Errorf("Expected embedded files without an override to be served, got %d", rec.Code)
+	}
+}
+
+func TestBranding_Validate(t *testing.T) {
+	for _, branding := range []Branding{
+		{ProductName: ""},
+		{ProductName: "Acme", AccentColor: "red"},
+		{ProductName: "Acme", AccentColor: "#abc"},
+		{ProductName: "Acme", StaticDir: filepath.Join(t.TempDir(), "missing")},
+	} {
+		if err := branding.Validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", branding)
+		}
+	}
+	if err := (Branding{ProductName: "Acme", AccentColor: "#0B7285", TemplatesDir: t.TempDir()}).Validate(); err != nil {
+		t.Errorf("Expected valid branding, got %v", err)
+	}
+}
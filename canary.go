@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// EventCanary is emitted each time a canary secret is revealed. Canaries are decoys, such as
+// fake credentials left in a shared folder or mailbox, that nobody should open: every reveal
+// means someone is looking where they shouldn't.
+const EventCanary SecretStatus = "canary"
+
+// MaxCanaryUserAgentLength caps the User-Agent passed on with a canary alert
+const MaxCanaryUserAgentLength = 512
+
+// CanaryHit describes who revealed a canary. Unlike a ReadRecord it carries the client's full
+// address and User-Agent, as the sender set the secret up to catch whoever opens it.
+type CanaryHit struct {
+	ClientIP  string
+	UserAgent string
+	Country   string // Empty when no GeoIP database is configured
+}
+
+// canaryHit describes the client of r for a canary alert
+func (srv *Server) canaryHit(r *http.Request) CanaryHit {
+	addr := clientAddr(r, srv.config.TrustedProxies)
+	hit := CanaryHit{UserAgent: r.UserAgent(), Country: srv.geoIP.Country(addr)}
+	if addr.IsValid() {
+		hit.ClientIP = addr.String()
+	}
+	if len(hit.UserAgent) > MaxCanaryUserAgentLength {
+		hit.UserAgent = hit.UserAgent[:MaxCanaryUserAgentLength]
+	}
+	return hit
+}
+
+// TripCanary returns a copy of a canary secret like Get, but without using up a read, so the
+// decoy keeps working, and alerts its sender with hit through a canary event
+func (s *SecretStore) TripCanary(id string, hit CanaryHit) (*Secret, bool) {
+	s.sealing.RLock()
+	defer s.sealing.RUnlock()
+	secret, found := s.tripCanary(id, hit)
+	if !found {
+		return nil, false
+	}
+	if secret, found = s.open(id, secret); !found {
+		return nil, false
+	}
+
+	// Answer as if a read was used up, so the response doesn't give the canary away. Only
+	// after open, which would take this for the last read and delete offloaded content.
+	secret.ReadsRemaining--
+	return secret, true
+}
+
+func (s *SecretStore) tripCanary(id string, hit CanaryHit) (*Secret, bool) {
+	sh := s.shardFor(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	secret, exists := sh.secrets[keyOf(id)]
+	if !exists || !secret.Canary {
+		return nil, false
+	}
+	now := time.Now()
+	if now.After(secret.ExpiresAt) {
+		s.remove(sh, id, secret, StatusExpired)
+		return nil, false
+	}
+
+	s.emitCanary(EventCanary, id, secret, now, &hit)
+	return secret.readCopy(), true
+}
+
+// readSecret releases a secret's content to the client of r: a read for ordinary secrets,
+// recorded for the sender, and an alert for canaries
+func (srv *Server) readSecret(r *http.Request, id string, meta *Secret) (*Secret, bool) {
+	if meta.Canary {
+		secret, found := srv.store.TripCanary(id, srv.canaryHit(r))
+		if found {
+			srv.audit(r, string(EventCanary), id)
+		}
+		return secret, found
+	}
+	secret, found := srv.store.GetWithReader(id, srv.readRecord(r))
+	if found {
+		srv.audit(r, string(StatusRead), id)
+	}
+	return secret, found
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClaimSecretHandler_Canary(t *testing.T) {
+	srv := newTestServer(t)
+	var hits []CanaryHit
+	srv.store.Subscribe(func(event SecretEvent) {
+		if event.Type == EventCanary {
+			hits = append(hits, *event.Canary)
+		}
+	})
+
+	id, _ := srv.store.StoreWithOptions("decoy", time.Hour, SecretOptions{Canary: true})
+
+	// Every reveal alerts and looks like the last read, but the decoy stays in place
+	for i := 0; i < 2; i++ {
+		w := claimSecret(t, srv, id, ClaimSecretRequest{})
+		var resp GetSecretResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		if w.Code != http.StatusOK || resp.Content != "decoy" || resp.ReadsRemaining != 0 {
+			t.Fatalf("Reveal %d: got %d %+v", i+1, w.Code, resp)
+		}
+	}
+	if meta, found := srv.store.Peek(id); !found || meta.ReadsRemaining != 1 {
+		t.Errorf("Expected the canary to keep its read, got %+v", meta)
+	}
+	if len(hits) != 2 || hits[0].ClientIP != "192.0.2.1" {
+		t.Errorf("Expected two hits from 192.0.2.1, got %+v", hits)
+	}
+
+	// The metadata doesn't tell a canary apart
+	w := httptest.NewRecorder()
+	srv.routes().ServeHTTP(w, httptest.NewRequest("GET", "/api/secrets/"+id, nil))
+	if strings.Contains(w.Body.String(), "canary") {
+		t.Errorf("Expected metadata not to mention the canary: %s", w.Body.String())
+	}
+
+	// A canary nobody hears about is pointless
+	jsonBody, _ := json.Marshal(CreateSecretRequest{Content: "decoy", Lifetime: 60, Canary: true})
+	w = httptest.NewRecorder()
+	srv.createSecretHandler(w, httptest.NewRequest("POST", "/api/secrets", bytes.NewBuffer(jsonBody)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without an alert target, got %d", w.Code)
+	}
+}
+
+func TestCanaryAlerts(t *testing.T) {
+	rec := &webhookRecorder{key: "key", t: t}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	webhooks := newTestNotifier()
+	emails, sent := newTestEmailNotifier(t)
+	testStore := NewSecretStore()
+	testStore.Subscribe(webhooks.HandleEvent)
+	testStore.Subscribe(emails.HandleEvent)
+
+	id, _ := testStore.StoreWithOptions("decoy", time.Hour, SecretOptions{
+		Canary:      true,
+		Webhook:     &Webhook{URL: server.URL, SigningKey: "key"},
+		NotifyEmail: "soc@example.com",
+		Label:       "finance share",
+	})
+	testStore.TripCanary(id, CanaryHit{ClientIP: "203.0.113.7", UserAgent: "curl/8.5.0"})
+	webhooks.Close()
+	emails.Close()
+
+	if len(rec.payloads) != 1 || rec.payloads[0].Event != "canary" || rec.payloads[0].Requester == nil || rec.payloads[0].Requester.ClientIP != "203.0.113.7" {
+		t.Errorf("Expected a canary webhook with the requester, got %+v", rec.payloads)
+	}
+	mails := sent()
+	if len(mails) != 1 || !strings.Contains(mails[0].msg, "canary secret was opened") || !strings.Contains(mails[0].msg, "From address: 203.0.113.7") {
+		t.Errorf("Expected a canary email with the requester, got %+v", mails)
+	}
+
+	// Ordinary secrets can't be tripped
+	plain, _ := testStore.Store("secret", time.Hour)
+	if _, found := testStore.TripCanary(plain, CanaryHit{}); found {
+		t.Error("Expected TripCanary to refuse an ordinary secret")
+	}
+}
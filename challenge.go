@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Reveal challenge modes
+const (
+	ChallengeNone      = "none"      // Reading only needs the link
+	ChallengeToken     = "token"     // The reveal button fetches a short-lived token first
+	ChallengePOW       = "pow"       // The browser solves a SHA-256 proof of work
+	ChallengeTurnstile = "turnstile" // Cloudflare Turnstile
+	ChallengeHCaptcha  = "hcaptcha"  // hCaptcha
+)
+
+const (
+	ChallengeTTL         = 10 * time.Minute // How long an issued challenge can be answered
+	DefaultPOWDifficulty = 16               // Leading zero bits, about 65k hashes on average
+	MaxPOWDifficulty     = 32
+	CaptchaVerifyTimeout = 10 * time.Second
+)
+
+// captchaProvider describes where a captcha widget is loaded from and answers are verified
+type captchaProvider struct {
+	script    string   // Widget script URL
+	widget    string   // CSS class of the widget element
+	verifyURL string   // Server-side siteverify endpoint
+	hosts     []string // Origins the widget loads scripts and frames from, for the CSP
+}
+
+var captchaProviders = map[string]captchaProvider{
+	ChallengeTurnstile: {
+		script:    "https://challenges.cloudflare.com/turnstile/v0/api.js",
+		widget:    "cf-turnstile",
+		verifyURL: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+		hosts:     []string{"https://challenges.cloudflare.com"},
+	},
+	ChallengeHCaptcha: {
+		script:    "https://js.hcaptcha.com/1/api.js",
+		widget:    "h-captcha",
+		verifyURL: "https://api.hcaptcha.com/siteverify",
+		hosts:     []string{"https://hcaptcha.com", "https://*.hcaptcha.com"},
+	},
+}
+
+var (
+	ErrChallengeRequired = errors.New("challenge required")
+	ErrChallengeFailed   = errors.New("challenge failed")
+)
+
+// ChallengeConfig configures the check run before a secret is revealed, so link previews
+// and mail scanners that fetch URLs can't consume secrets
+type ChallengeConfig struct {
+	Mode          string // none, token, pow, turnstile or hcaptcha
+	POWDifficulty int    // Leading zero bits required in pow mode
+	SiteKey       string // Captcha site key, shown to browsers
+	SecretKey     string // Captcha secret key, used to verify answers
+}
+
+// Enabled reports whether reading a secret needs a solved challenge
+func (c ChallengeConfig) Enabled() bool {
+	return c.Mode != "" && c.Mode != ChallengeNone
+}
+
+// Validate checks the mode and that a captcha mode has its keys
+func (c ChallengeConfig) Validate() error {
+	switch c.Mode {
+	case "", ChallengeNone, ChallengeToken:
+	case ChallengePOW:
+		if c.POWDifficulty < 1 || c.POWDifficulty > MaxPOWDifficulty {
+			return fmt.Errorf("pow-difficulty must be between 1 and %d", MaxPOWDifficulty)
+		}
+	case ChallengeTurnstile, ChallengeHCaptcha:
+		if c.SiteKey == "" || c.SecretKey == "" {
+			return fmt.Errorf("captcha-site-key and captcha-secret-key are required for %s", c.Mode)
+		}
+	default:
+		return fmt.Errorf("invalid reveal-challenge %q (expected none, token, pow, turnstile or hcaptcha)", c.Mode)
+	}
+	return nil
+}
+
+// ChallengeResponse is returned by GET /api/secrets/{id}/challenge
+type ChallengeResponse struct {
+	Mode       string `json:"mode"`
+	Token      string `json:"token,omitempty"`      // Send back as challenge
+	Difficulty int    `json:"difficulty,omitempty"` // pow: leading zero bits of SHA-256(token + ":" + solution)
+	SiteKey    string `json:"site_key,omitempty"`   // turnstile and hcaptcha
+}
+
+// Challenger issues and checks reveal challenges
+type Challenger struct {
+	config    ChallengeConfig
+	signer    tokenSigner
+	client    *http.Client
+	verifyURL string
+	now       func() time.Time
+}
+
+// NewChallenger creates a challenger for the configured mode, signing its tokens with key or a
+// random one when it is nil
+func NewChallenger(cfg ChallengeConfig, key []byte) *Challenger {
+	return &Challenger{
+		config:    cfg,
+		signer:    newTokenSigner(key),
+		client:    &http.Client{Timeout: CaptchaVerifyTimeout},
+		verifyURL: captchaProviders[cfg.Mode].verifyURL,
+		now:       time.Now,
+	}
+}
+
+// Issue creates a challenge for reading secret id
+func (c *Challenger) Issue(id string) ChallengeResponse {
+	resp := ChallengeResponse{Mode: c.config.Mode, Token: c.signer.sign(id, c.now().Add(ChallengeTTL))}
+	switch c.config.Mode {
+	case ChallengePOW:
+		resp.Difficulty = c.config.POWDifficulty
+	case ChallengeTurnstile, ChallengeHCaptcha:
+		resp.SiteKey = c.config.SiteKey
+	}
+	return resp
+}
+
+// Verify checks that token was issued for id and is unexpired, and that solution answers it
+func (c *Challenger) Verify(ctx context.Context, id, token, solution string, client netip.Addr) error {
+	if token == "" {
+		return ErrChallengeRequired
+	}
+	if _, ok := c.signer.verify(id, token, c.now()); !ok {
+		return ErrChallengeFailed
+	}
+
+	switch c.config.Mode {
+	case ChallengePOW:
+		if !solvesPOW(token, solution, c.config.POWDifficulty) {
+			return ErrChallengeFailed
+		}
+	case ChallengeTurnstile, ChallengeHCaptcha:
+		return c.verifyCaptcha(ctx, solution, client)
+	}
+	return nil
+}
+
+// solvesPOW reports whether SHA-256(token + ":" + solution) starts with difficulty zero bits
+func solvesPOW(token, solution string, difficulty int) bool {
+	if solution == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(token + ":" + solution))
+	zeros := 0
+	for _, b := range sum {
+		zeros += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	return zeros >= difficulty
+}
+
+// solvePOW finds a solution for a pow token by brute force
+func solvePOW(token string, difficulty int) string {
+	for n := 0; ; n++ {
+		if solution := strconv.Itoa(n); solvesPOW(token, solution, difficulty) {
+			return solution
+		}
+	}
+}
+
+// verifyCaptcha asks the captcha provider whether answer is a valid, unused response
+func (c *Challenger) verifyCaptcha(ctx context.Context, answer string, client netip.Addr) error {
+	if answer == "" {
+		return ErrChallengeRequired
+	}
+	form := url.Values{"secret": {c.config.SecretKey}, "response": {answer}}
+	if client.IsValid() {
+		form.Set("remoteip", client.String())
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.verifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("captcha verification failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("captcha verification failed: %w", err)
+	}
+	if !result.Success {
+		return ErrChallengeFailed
+	}
+	return nil
+}
+
+// challengeHandler issues a reveal challenge for a secret
+func (srv *Server) challengeHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, found := srv.store.Peek(id); !found {
+		localizedError(w, r, http.StatusNotFound, "error.not_found")
+		return
+	}
+
+	resp := ChallengeResponse{Mode: ChallengeNone}
+	if srv.challenger != nil {
+		resp = srv.challenger.Issue(id)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// checkChallenge writes an error and returns false unless the request answers a reveal
+// challenge for id. Always passes when no challenge is configured.
+func (srv *Server) checkChallenge(w http.ResponseWriter, r *http.Request, id, token, solution string) bool {
+	if srv.challenger == nil {
+		return true
+	}
+	err := srv.challenger.Verify(r.Context(), id, token, solution, clientAddr(r, srv.config.TrustedProxies))
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrChallengeRequired):
+		localizedError(w, r, http.StatusForbidden, "error.challenge_required")
+	case errors.Is(err, ErrChallengeFailed):
+		localizedError(w, r, http.StatusForbidden, "error.challenge_failed")
+	default:
+		srv.logger.Error("Failed to verify reveal challenge", "error", err)
+		localizedError(w, r, http.StatusBadGateway, "error.challenge_unavailable")
+	}
+	return false
+}
+
+// captchaContentSecurityPolicy allows the captcha provider's scripts and frames in policy
+func captchaContentSecurityPolicy(policy string, provider captchaProvider) string {
+	sources := " " + strings.Join(provider.hosts, " ")
+	directives := strings.Split(policy, ";")
+	found := map[string]bool{}
+	for i, directive := range directives {
+		name, _, _ := strings.Cut(strings.TrimSpace(directive), " ")
+		switch name {
+		case "script-src", "frame-src", "connect-src", "style-src":
+			directives[i] = strings.TrimRight(directive, " ") + sources
+			found[name] = true
+		}
+	}
+	for _, name := range []string{"script-src", "frame-src", "connect-src"} {
+		if !found[name] {
+			directives = append(directives, " "+name+" 'self'"+sources)
+		}
+	}
+	return strings.Join(directives, ";")
+}
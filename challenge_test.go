@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fetchChallenge requests a reveal challenge for id through the router
+func fetchChallenge(t *testing.T, srv *Server, id string) ChallengeResponse {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/api/secrets/"+id+"/challenge", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 for challenge, got %d", rec.Code)
+	}
+	var challenge ChallengeResponse
+	json.NewDecoder(rec.Body).Decode(&challenge)
+	return challenge
+}
+
+// claimWithChallenge claims id with a challenge answer and returns the status code
+func claimWithChallenge(t *testing.T, srv *Server, id, token, solution string) int {
+	return claimSecret(t, srv, id, ClaimSecretRequest{Challenge: token, ChallengeSolution: solution}).Code
+}
+
+func TestChallenge_None(t *testing.T) {
+	srv := newTestServer(t)
+	id, _ := srv.store.Store("content", time.Hour)
+
+	if challenge := fetchChallenge(t, srv, id); challenge.Mode != ChallengeNone || challenge.Token != "" {
+		t.Errorf("Expected no challenge, got %+v", challenge)
+	}
+	if code := claimWithChallenge(t, srv, id, "", ""); code != http.StatusOK {
+		t.Errorf("Expected 200 without a challenge, got %d", code)
+	}
+}
+
+func TestChallenge_Token(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.Challenge.Mode = ChallengeToken })
+	id, _ := srv.store.Store("content", time.Hour)
+	other, _ := srv.store.Store("other", time.Hour)
+
+	// A scanner that even claims the secret gets nothing and the secret survives
+	if code := claimWithChallenge(t, srv, id, "", ""); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for claim without challenge, got %d", code)
+	}
+
+	// Tokens are bound to the secret they were issued for
+	if code := claimWithChallenge(t, srv, id, fetchChallenge(t, srv, other).Token, ""); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for another secret's token, got %d", code)
+	}
+
+	challenge := fetchChallenge(t, srv, id)
+	if challenge.Mode != ChallengeToken || challenge.Token == "" {
+		t.Fatalf("Expected a token challenge, got %+v", challenge)
+	}
+	if code := claimWithChallenge(t, srv, id, challenge.Token, ""); code != http.StatusOK {
+		t.Errorf("Expected 200 with challenge, got %d", code)
+	}
+}
+
+func TestChallenge_TokenExpires(t *testing.T) {
+	challenger := NewChallenger(ChallengeConfig{Mode: ChallengeToken}, nil)
+	now := time.Now()
+	challenger.now = func() time.Time { return now }
+	token := challenger.Issue("abc").Token
+
+	if err := challenger.Verify(context.Background(), "abc", token, "", netip.Addr{}); err != nil {
+		t.Errorf("Expected fresh token to verify, got %v", err)
+	}
+	now = now.Add(ChallengeTTL + time.Second)
+	if err := challenger.Verify(context.Background(), "abc", token, "", netip.Addr{}); err != ErrChallengeFailed {
+		t.Errorf("Expected expired token to fail, got %v", err)
+	}
+	if err := challenger.Verify(context.Background(), "abc", "garbage", "", netip.Addr{}); err != ErrChallengeFailed {
+		t.Errorf("Expected malformed token to fail, got %v", err)
+	}
+}
+
+func TestChallenge_ProofOfWork(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.Challenge.Mode = ChallengePOW
+		cfg.Challenge.POWDifficulty = 8
+	})
+	id, _ := srv.store.Store("content", time.Hour)
+
+	challenge := fetchChallenge(t, srv, id)
+	if challenge.Difficulty != 8 {
+		t.Fatalf("Expected difficulty 8, got %d", challenge.Difficulty)
+	}
+
+	solution := solvePOW(challenge.Token, challenge.Difficulty)
+	wrong := solution + "0"
+	for solvesPOW(challenge.Token, wrong, challenge.Difficulty) {
+		wrong += "0"
+	}
+	if code := claimWithChallenge(t, srv, id, challenge.Token, wrong); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a wrong solution, got %d", code)
+	}
+	if code := claimWithChallenge(t, srv, id, challenge.Token, solution); code != http.StatusOK {
+		t.Errorf("Expected 200 for a valid solution, got %d", code)
+	}
+}
+
+func TestChallenge_Captcha(t *testing.T) {
+	var gotSecret, gotIP string
+	verifier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		gotSecret, gotIP = r.PostForm.Get("secret"), r.PostForm.Get("remoteip")
+		json.NewEncoder(w).Encode(map[string]bool{"success": r.PostForm.Get("response") == "human"})
+	}))
+	defer verifier.Close()
+
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.Challenge = ChallengeConfig{Mode: ChallengeTurnstile, SiteKey: "site", SecretKey: "server-secret"}
+	})
+	srv.challenger.verifyURL = verifier.URL
+	id, _ := srv.store.Store("content", time.Hour)
+
+	challenge := fetchChallenge(t, srv, id)
+	if challenge.SiteKey != "site" {
+		t.Errorf("Expected site key in challenge, got %+v", challenge)
+	}
+	if code := claimWithChallenge(t, srv, id, challenge.Token, "bot"); code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a rejected captcha, got %d", code)
+	}
+	if code := claimWithChallenge(t, srv, id, challenge.Token, "human"); code != http.StatusOK {
+		t.Errorf("Expected 200 for an accepted captcha, got %d", code)
+	}
+	if gotSecret != "server-secret" || gotIP != "192.0.2.1" {
+		t.Errorf("Expected secret key and client IP sent to verifier, got %q %q", gotSecret, gotIP)
+	}
+
+	// The view page loads the widget and allows it in the CSP
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/s/"+id, nil))
+	if !strings.Contains(rec.Body.String(), `class="cf-turnstile" data-sitekey="site"`) {
+		t.Error("Expected Turnstile widget on the view page")
+	}
+	if csp := rec.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "frame-src 'self' https://challenges.cloudflare.com") {
+		t.Errorf("Expected CSP to allow the Turnstile frame, got %q", csp)
+	}
+}
+
+func TestChallengeConfig_Validate(t *testing.T) {
+	tests := []struct {
+		config ChallengeConfig
+		valid  bool
+	}{
+		{ChallengeConfig{Mode: ChallengeNone}, true},
+		{ChallengeConfig{Mode: ChallengeToken}, true},
+		{ChallengeConfig{Mode: ChallengePOW, POWDifficulty: 16}, true},
+		{ChallengeConfig{Mode: ChallengePOW, POWDifficulty: 0}, false},
+		{ChallengeConfig{Mode: ChallengePOW, POWDifficulty: MaxPOWDifficulty + 1}, false},
+		{ChallengeConfig{Mode: ChallengeHCaptcha, SiteKey: "a", SecretKey: "b"}, true},
+		{ChallengeConfig{Mode: ChallengeHCaptcha, SiteKey: "a"}, false},
+		{ChallengeConfig{Mode: "recaptcha"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.config.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate(%+v) = %v, expected valid %v", tt.config, err, tt.valid)
+		}
+	}
+}
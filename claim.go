@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClaimTokenTTL is how long a claim token handed out with a secret's metadata can be redeemed
+const ClaimTokenTTL = time.Hour
+
+// tokenSigner creates tokens binding a subject to an expiry. Tokens are signed with a key
+// generated at startup, so they don't need to be stored and stop working after a restart. The
+// nodes of a cluster share a key derived from the cluster key instead, so a token issued by
+// one node is accepted by the others.
+type tokenSigner struct {
+	key []byte
+}
+
+// newTokenSigner signs with key, or with a random key when it is nil
+func newTokenSigner(key []byte) tokenSigner {
+	if key == nil {
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	return tokenSigner{key: key}
+}
+
+// sign creates a token for subject, with a random nonce so every token is different
+func (s tokenSigner) sign(subject string, expires time.Time) string {
+	payload := make([]byte, 16)
+	binary.BigEndian.PutUint64(payload, uint64(expires.Unix()))
+	rand.Read(payload[8:])
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + s.mac(subject, encoded)
+}
+
+// verify checks that token was signed for subject and hasn't expired, and returns its expiry
+func (s tokenSigner) verify(subject, token string, now time.Time) (time.Time, bool) {
+	payload, signature, ok := strings.Cut(token, ".")
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if !ok || err != nil || len(data) != 16 || !hmac.Equal([]byte(signature), []byte(s.mac(subject, payload))) {
+		return time.Time{}, false
+	}
+	expires := time.Unix(int64(binary.BigEndian.Uint64(data)), 0)
+	return expires, !now.After(expires)
+}
+
+func (s tokenSigner) mac(subject, payload string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(subject + "." + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ClaimTokens issues the one-time tokens needed to claim a secret's content. Only redeemed
+// tokens are remembered, until they expire, so fetching metadata costs no memory.
+type ClaimTokens struct {
+	signer tokenSigner
+
+	mu       sync.Mutex
+	redeemed map[string]time.Time // Token to its expiry
+}
+
+// NewClaimTokens signs claim tokens with key, nil for a random one
+func NewClaimTokens(key []byte) *ClaimTokens {
+	return &ClaimTokens{signer: newTokenSigner(key), redeemed: make(map[string]time.Time)}
+}
+
+// Issue creates a claim token for secret id
+func (c *ClaimTokens) Issue(id string, now time.Time) string {
+	return c.signer.sign(id, now.Add(ClaimTokenTTL))
+}
+
+// Valid reports whether token can still be redeemed for id
+func (c *ClaimTokens) Valid(id, token string, now time.Time) bool {
+	if _, ok := c.signer.verify(id, token, now); !ok {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, used := c.redeemed[token]
+	return !used
+}
+
+// Redeem marks token as used. Returns false if it is invalid or was already redeemed.
+func (c *ClaimTokens) Redeem(id, token string, now time.Time) bool {
+	expires, ok := c.signer.verify(id, token, now)
+	if !ok {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, used := c.redeemed[token]; used {
+		return false
+	}
+	c.redeemed[token] = expires
+	return true
+}
+
+// Prune forgets redeemed tokens that have expired anyway. Returns the number removed.
+func (c *ClaimTokens) Prune(now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	count := 0
+	for token, expires := range c.redeemed {
+		if now.After(expires) {
+			delete(c.redeemed, token)
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,706 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultServerURL = "http://localhost:8080" // Server used by the CLI when --server and PICOSEND_URL are unset
+	CLITimeout       = 30 * time.Second
+	CLIChunkSize     = 512 << 10 // Size of the chunks large secrets are uploaded in
+)
+
+// runCLI runs the send/read/keygen/register/export/import/rekey/version client subcommands and returns the process exit code
+func runCLI(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var err error
+	switch args[0] {
+	case "send":
+		err = runSend(args[1:], stdin, stdout, stderr)
+	case "read":
+		err = runRead(args[1:], stdout, stderr)
+	case "keygen":
+		err = runKeygen(args[1:], stdout, stderr)
+	case "register":
+		err = runRegister(args[1:], stdout, stderr)
+	case "export":
+		err = runExport(args[1:], stdout, stderr)
+	case "import":
+		err = runImport(args[1:], stdin, stdout, stderr)
+	case "rekey":
+		err = runRekey(args[1:], stdout, stderr)
+	case "version":
+		build := currentBuild()
+		fmt.Fprintf(stdout, "picosend %s %s %s %s\n", build.Version, build.Commit, build.BuildDate, build.GoVersion)
+	default:
+		err = fmt.Errorf("unknown command %q", args[0])
+	}
+
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+// runSend encrypts stdin locally, uploads the ciphertext and prints the share URL
+func runSend(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("picosend send", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	server := fs.String("server", envOr("PICOSEND_URL", DefaultServerURL), "picosend server URL (env PICOSEND_URL)")
+	lifetime := fs.Int("lifetime", 1440, "Secret lifetime in minutes")
+	maxReads := fs.Int("max-reads", 1, "Number of times the secret can be read")
+	passphrase := fs.String("passphrase", "", "Passphrase the recipient must enter")
+	to := fs.String("to", "", "Encrypt to this recipient from the server's key directory instead of a key in the link")
+	requirePIN := fs.Bool("pin", false, "Generate a pickup PIN the recipient must enter, to be sent separately from the link")
+	totpSecret := fs.String("totp-secret", "", "Base32 TOTP seed the recipient holds; each read then needs a current authenticator code")
+	apiKey := fs.String("api-key", envOr("PICOSEND_API_KEY", ""), "API key, for servers that require one (env PICOSEND_API_KEY)")
+	notBefore := fs.String("not-before", "", "RFC 3339 time before which the secret can't be read, e.g. 2024-06-01T09:00:00Z")
+	secretType := fs.String("type", SecretTypeText, "Secret type: text, or credentials to send a JSON object with username, password, url and notes")
+	label := fs.String("label", "", "Note for yourself, returned in receipts and the status but never shown to the recipient")
+	reference := fs.String("reference", "", "Your reference, such as a ticket number, returned like the label")
+	deletionMessage := fs.String("deletion-message", "", "Public note shown on the link once the secret is burned or expired")
+	hideAfter := fs.Int("hide-after", 0, "Seconds the view page shows the secret once revealed, 0 to keep it shown")
+	holdToView := fs.Bool("hold-to-view", false, "Only show the secret on the view page while the recipient holds a button down")
+	maxAttempts := fs.Int("max-attempts", 0, "Wrong passphrases, PINs or codes after which the secret is destroyed, 0 for the server default")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: picosend send [flags] < secret.txt")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Secrets too large for a single request are uploaded in chunks, up to the server's
+	// default upload size once encrypted and base64 encoded
+	maxPlaintext := DefaultUploadSize / 4 * 3
+	plaintext, err := io.ReadAll(io.LimitReader(stdin, int64(maxPlaintext)+1))
+	if err != nil {
+		return err
+	}
+	if len(plaintext) == 0 {
+		return errors.New("secret is empty")
+	}
+	if len(plaintext) > maxPlaintext-aes.BlockSize*2 {
+		return fmt.Errorf("secret exceeds maximum length of %d bytes", maxPlaintext-aes.BlockSize*2)
+	}
+	switch *secretType {
+	case SecretTypeText:
+	case SecretTypeCredentials:
+		var credentials Credentials
+		if err := json.Unmarshal(plaintext, &credentials); err != nil {
+			return fmt.Errorf("credentials must be a JSON object: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown secret type %q", *secretType)
+	}
+
+	// Secrets for a directory recipient are sealed to their public key, so the link carries no key
+	var key []byte
+	var content string
+	if *to != "" {
+		var recipient RecipientInfo
+		if err := getJSON(strings.TrimRight(*server, "/")+"/api/recipients/"+url.PathEscape(*to), &recipient); err != nil {
+			return err
+		}
+		publicKey, err := parseRecipientKey(recipient.PublicKey)
+		if err != nil {
+			return err
+		}
+		if content, err = sealToRecipient(plaintext, publicKey); err != nil {
+			return err
+		}
+		fmt.Fprintf(stderr, "Encrypted to %s (%s)\n", recipient.Name, recipient.Fingerprint)
+	} else {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return err
+		}
+		if content, err = encryptContent(plaintext, key); err != nil {
+			return err
+		}
+	}
+
+	req := CreateSecretRequest{Content: content, Type: *secretType, Lifetime: *lifetime, MaxReads: *maxReads, NotBefore: *notBefore, RequirePIN: *requirePIN, TOTPSecret: *totpSecret, Recipient: *to, Label: *label, Reference: *reference, DeletionMessage: *deletionMessage, HideAfter: *hideAfter, HoldToView: *holdToView, MaxAttempts: *maxAttempts}
+	if *passphrase != "" {
+		req.PassphraseHash = hashPassphraseForTransport(*passphrase)
+	}
+	chunked := len(content) > MaxSecretLength*2
+	if chunked {
+		req.Content, req.Chunked = "", true
+	}
+
+	var created CreateSecretResponse
+	if err := postJSON(strings.TrimRight(*server, "/")+"/api/secrets", *apiKey, req, &created); err != nil {
+		return err
+	}
+	if chunked {
+		if err := uploadChunks(strings.TrimRight(*server, "/")+"/api/secrets/"+created.ID, created.ManagementToken, content); err != nil {
+			return err
+		}
+	}
+
+	if key != nil {
+		fmt.Fprintf(stdout, "%s/s/%s#%s\n", strings.TrimRight(*server, "/"), created.ID, base64.StdEncoding.EncodeToString(key))
+	} else {
+		fmt.Fprintf(stdout, "%s/s/%s\n", strings.TrimRight(*server, "/"), created.ID)
+	}
+	fmt.Fprintf(stderr, "Management token: %s\n", created.ManagementToken)
+	if created.PIN != "" {
+		fmt.Fprintf(stderr, "Pickup PIN: %s\n", created.PIN)
+	}
+	return nil
+}
+
+// runRead fetches the secret behind a share URL, decrypts it locally and prints it
+func runRead(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("picosend read", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	passphrase := fs.String("passphrase", "", "Passphrase, if the secret is protected")
+	pin := fs.String("pin", "", "Pickup PIN, if the sender was given one")
+	totp := fs.String("totp", "", "Current authenticator code, if the secret is bound to a TOTP seed")
+	identityFile := fs.String("identity", "", "age or X25519 identity file, for secrets encrypted to a recipient key")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: picosend read [flags] <share-url>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("share URL is required")
+	}
+
+	shareURL, err := url.Parse(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid share URL: %w", err)
+	}
+	var identity *ecdh.PrivateKey
+	if *identityFile != "" {
+		data, err := os.ReadFile(*identityFile)
+		if err != nil {
+			return err
+		}
+		if identity, err = parseIdentity(data); err != nil {
+			return err
+		}
+	}
+	key, err := base64.StdEncoding.DecodeString(shareURL.Fragment)
+	if identity == nil && (err != nil || len(key) != 32) {
+		return errors.New("share URL is missing a valid decryption key")
+	}
+	prefix, id, found := strings.Cut(shareURL.Path, "/s/")
+	if !found || id == "" || strings.Contains(id, "/") {
+		return errors.New("share URL must point to /s/<id>")
+	}
+
+	apiURL := *shareURL
+	apiURL.Path = prefix + "/api/secrets/" + id
+	apiURL.Fragment = ""
+	secretURL := apiURL.String()
+
+	// Reading takes two steps: metadata with a claim token, then the claim releasing the content
+	var meta SecretMetadataResponse
+	if err := getJSON(secretURL, &meta); err != nil {
+		return err
+	}
+	if meta.PassphraseRequired && *passphrase == "" {
+		return errors.New("secret is protected by a passphrase, use --passphrase")
+	}
+	if meta.PINRequired && *pin == "" {
+		return errors.New("secret requires a pickup PIN, use --pin")
+	}
+	if meta.TOTPRequired && *totp == "" {
+		return errors.New("secret requires an authenticator code, use --totp")
+	}
+	// Check the identity before claiming, so a wrong one doesn't use up a read
+	if meta.RecipientFingerprint != "" {
+		if identity == nil {
+			return fmt.Errorf("secret is encrypted to recipient key %s, use --identity", meta.RecipientFingerprint)
+		}
+		if keyFingerprint([32]byte(identity.PublicKey().Bytes())) != meta.RecipientFingerprint {
+			return ErrWrongRecipientIdentity
+		}
+	} else if len(key) != 32 {
+		return errors.New("share URL is missing a valid decryption key")
+	}
+	if unlocksAt, err := time.Parse(time.RFC3339, meta.NotBefore); err == nil && time.Now().Before(unlocksAt) {
+		return fmt.Errorf("secret is locked until %s", unlocksAt.Local().Format(time.RFC1123))
+	}
+
+	req := ClaimSecretRequest{ClaimToken: meta.ClaimToken, PIN: *pin, TOTP: *totp}
+	if *passphrase != "" {
+		req.PassphraseHash = hashPassphraseForTransport(*passphrase)
+	}
+	if req.Challenge, req.ChallengeSolution, err = answerChallenge(secretURL + "/challenge"); err != nil {
+		return err
+	}
+
+	var secret GetSecretResponse
+	if err := postJSON(secretURL+"/claim", "", req, &secret); err != nil {
+		return err
+	}
+
+	var plaintext []byte
+	if secret.RecipientFingerprint != "" {
+		plaintext, err = openWithIdentity(secret.Content, identity)
+	} else {
+		plaintext, err = decryptContent(secret.Content, key)
+	}
+	if err != nil {
+		return err
+	}
+
+	var credentials Credentials
+	if secret.Type == SecretTypeCredentials && json.Unmarshal(plaintext, &credentials) == nil {
+		credentials.print(stdout)
+		return nil
+	}
+	stdout.Write(plaintext)
+	return nil
+}
+
+// runKeygen creates an X25519 identity in age format, for receiving secrets sealed to its public key
+func runKeygen(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("picosend keygen", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: picosend keygen > key.txt")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	identity, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	publicKey := encodeAgeRecipient([32]byte(identity.PublicKey().Bytes()))
+	fmt.Fprintf(stdout, "# created: %s\n# public key: %s\n%s\n", time.Now().Format(time.RFC3339), publicKey, encodeAgeIdentity(identity))
+	fmt.Fprintf(stderr, "Public key: %s\n", publicKey)
+	return nil
+}
+
+// runRegister adds a public key to the server's recipient directory under a name senders use with send --to
+func runRegister(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("picosend register", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	server := fs.String("server", envOr("PICOSEND_URL", DefaultServerURL), "picosend server URL (env PICOSEND_URL)")
+	name := fs.String("name", "", "Name senders look the key up by, e.g. an email address")
+	publicKey := fs.String("public-key", "", "age recipient (age1...) or base64 X25519 public key")
+	apiKey := fs.String("api-key", envOr("PICOSEND_API_KEY", ""), "API key, for servers that require one (env PICOSEND_API_KEY)")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: picosend register --name <name> --public-key <key>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" || *publicKey == "" {
+		fs.Usage()
+		return errors.New("--name and --public-key are required")
+	}
+
+	var registered RegisterRecipientResponse
+	req := RegisterRecipientRequest{Name: *name, PublicKey: *publicKey}
+	if err := postJSON(strings.TrimRight(*server, "/")+"/api/recipients", *apiKey, req, &registered); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Registered %s (%s)\n", registered.Name, registered.Fingerprint)
+	fmt.Fprintf(stderr, "Management token: %s\n", registered.ManagementToken)
+	return nil
+}
+
+// runExport saves every pending secret of a server for runImport, e.g. when moving hosts
+func runExport(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("picosend export", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	server := fs.String("server", envOr("PICOSEND_URL", DefaultServerURL), "picosend server URL (env PICOSEND_URL)")
+	adminKey := fs.String("admin-key", envOr("PICOSEND_ADMIN_KEY", ""), "Admin API key of the server (env PICOSEND_ADMIN_KEY)")
+	migrationKey := fs.String("migration-key", envOr("PICOSEND_MIGRATION_KEY", ""), "Base64 AES-256 key to seal the export with (env PICOSEND_MIGRATION_KEY)")
+	output := fs.String("output", "", "File to write the export to, stdout when unset")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: picosend export --admin-key <key> [--migration-key <key>] [--output <file>]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *adminKey == "" {
+		fs.Usage()
+		return errors.New("--admin-key is required")
+	}
+
+	resp, err := adminAPIRequest(http.MethodGet, strings.TrimRight(*server, "/")+"/admin/api/export", *adminKey, *migrationKey, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	out := stdout
+	if *output != "" {
+		file, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	// The bundle is passed through as is, decoding it only reports what it holds
+	tee := io.TeeReader(resp.Body, out)
+	var bundle ExportBundle
+	if err := json.NewDecoder(tee).Decode(&bundle); err != nil {
+		return fmt.Errorf("writing export: %w", err)
+	}
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return fmt.Errorf("writing export: %w", err)
+	}
+	if bundle.Sealed == nil {
+		fmt.Fprintln(stderr, "Warning: the export is not sealed, pass --migration-key to protect it")
+	}
+	fmt.Fprintf(stderr, "Exported %d secrets\n", bundle.Count)
+	return nil
+}
+
+// runImport stores the secrets of a runExport file on a server and lists those it skipped
+func runImport(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("picosend import", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	server := fs.String("server", envOr("PICOSEND_URL", DefaultServerURL), "picosend server URL (env PICOSEND_URL)")
+	adminKey := fs.String("admin-key", envOr("PICOSEND_ADMIN_KEY", ""), "Admin API key of the server (env PICOSEND_ADMIN_KEY)")
+	migrationKey := fs.String("migration-key", envOr("PICOSEND_MIGRATION_KEY", ""), "Base64 AES-256 key the export is sealed with (env PICOSEND_MIGRATION_KEY)")
+	input := fs.String("input", "", "File to read the export from, stdin when unset")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: picosend import --admin-key <key> [--migration-key <key>] [--input <file>]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *adminKey == "" {
+		fs.Usage()
+		return errors.New("--admin-key is required")
+	}
+
+	in := stdin
+	if *input != "" {
+		file, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+	resp, err := adminAPIRequest(http.MethodPost, strings.TrimRight(*server, "/")+"/admin/api/import", *adminKey, *migrationKey, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var imported AdminImportResponse
+	if err := json.NewDecoder(resp.Body).Decode(&imported); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Imported %d secrets\n", imported.Imported)
+	for _, skip := range imported.Skipped {
+		fmt.Fprintf(stderr, "Skipped %s: %s\n", skip.ID, skip.Error)
+	}
+	return nil
+}
+
+// runRekey moves a server's encryption at rest to a new master key while it keeps serving
+func runRekey(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("picosend rekey", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	server := fs.String("server", envOr("PICOSEND_URL", DefaultServerURL), "picosend server URL (env PICOSEND_URL)")
+	adminKey := fs.String("admin-key", envOr("PICOSEND_ADMIN_KEY", ""), "Admin API key of the server (env PICOSEND_ADMIN_KEY)")
+	keyFile := fs.String("encryption-key-file", "", "File containing the new base64 32-byte master key")
+	kmsKey := fs.String("kms-key", "", "New KMS key URI, using the server's KMS credentials")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: picosend rekey --admin-key <key> (--encryption-key-file <file> | --kms-key <uri>)")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *adminKey == "" || (*keyFile == "") == (*kmsKey == "") {
+		fs.Usage()
+		return errors.New("--admin-key and one of --encryption-key-file and --kms-key are required")
+	}
+
+	req := AdminRekeyRequest{KMSKey: *kmsKey}
+	if *keyFile != "" {
+		key, err := loadMasterKey("", *keyFile)
+		if err != nil {
+			return err
+		}
+		req.EncryptionKey = base64.StdEncoding.EncodeToString(key)
+		wipeBytes(key)
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	resp, err := adminAPIRequest(http.MethodPost, strings.TrimRight(*server, "/")+"/admin/api/rekey", *adminKey, "", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var rekeyed AdminRekeyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&rekeyed); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Rewrapped %d data keys\n", rekeyed.Rewrapped)
+	fmt.Fprintln(stderr, "Set the new key in the server's configuration before it restarts")
+	return nil
+}
+
+// adminAPIRequest calls an admin endpoint, with the migration key when set. Exports can be
+// large and rekeys slow, so there is no timeout beyond the connection's.
+func adminAPIRequest(method, endpoint, adminKey, migrationKey string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+adminKey)
+	if migrationKey != "" {
+		req.Header.Set(MigrationKeyHeader, migrationKey)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	return resp, nil
+}
+
+// Credentials is the plaintext of a credentials secret, encrypted as a whole on the client
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	URL      string `json:"url,omitempty"`
+	Notes    string `json:"notes,omitempty"`
+}
+
+func (c Credentials) print(w io.Writer) {
+	for _, field := range []struct{ label, value string }{
+		{"Username", c.Username},
+		{"Password", c.Password},
+		{"URL", c.URL},
+		{"Notes", c.Notes},
+	} {
+		if field.value != "" {
+			fmt.Fprintf(w, "%s: %s\n", field.label, field.value)
+		}
+	}
+}
+
+// uploadChunks sends content in CLIChunkSize pieces to a secret created with chunked set, then commits it
+func uploadChunks(secretURL, managementToken, content string) error {
+	client := &http.Client{Timeout: CLITimeout}
+	send := func(method, endpoint, contentType string, body []byte) error {
+		req, err := http.NewRequest(method, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", "Bearer "+managementToken)
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			return responseError(resp)
+		}
+		return nil
+	}
+
+	count := 0
+	for start := 0; start < len(content); start += CLIChunkSize {
+		end := min(start+CLIChunkSize, len(content))
+		if err := send(http.MethodPut, fmt.Sprintf("%s/chunks/%d", secretURL, count), "application/octet-stream", []byte(content[start:end])); err != nil {
+			return fmt.Errorf("chunk %d: %w", count, err)
+		}
+		count++
+	}
+
+	commit, _ := json.Marshal(CommitUploadRequest{Chunks: count})
+	return send(http.MethodPost, secretURL+"/chunks/commit", "application/json", commit)
+}
+
+// answerChallenge fetches the server's reveal challenge and solves it. Returns empty values
+// when the server doesn't ask for one, or doesn't know the secret, which reading reports.
+func answerChallenge(endpoint string) (token, solution string, err error) {
+	client := &http.Client{Timeout: CLITimeout}
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", nil
+	}
+
+	var challenge ChallengeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&challenge); err != nil {
+		return "", "", fmt.Errorf("invalid challenge: %w", err)
+	}
+	switch challenge.Mode {
+	case ChallengeNone, ChallengeToken:
+		return challenge.Token, "", nil
+	case ChallengePOW:
+		if challenge.Difficulty > MaxPOWDifficulty {
+			return "", "", fmt.Errorf("challenge difficulty %d is too high", challenge.Difficulty)
+		}
+		return challenge.Token, solvePOW(challenge.Token, challenge.Difficulty), nil
+	default:
+		return "", "", fmt.Errorf("server requires a %s captcha, open the link in a browser", challenge.Mode)
+	}
+}
+
+// getJSON fetches endpoint and decodes a JSON response into out
+func getJSON(endpoint string, out interface{}) error {
+	client := &http.Client{Timeout: CLITimeout}
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// postJSON posts body as JSON, with a bearer token when set, and decodes a JSON response into out
+func postJSON(endpoint, bearer string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	client := &http.Client{Timeout: CLITimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// responseError describes a failed response by the message in its error body. Servers from
+// before the JSON error format answered with plain text, which is shown as is.
+func responseError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	var body ErrorResponse
+	if json.Unmarshal(msg, &body) == nil && body.Error != "" {
+		return fmt.Errorf("server returned %s: %s", resp.Status, body.Error)
+	}
+	return fmt.Errorf("server returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// encryptContent encrypts plaintext the same way the web client does:
+// AES-256-CBC with PKCS#7 padding, the random IV prepended, base64 encoded
+func encryptContent(plaintext, key []byte) (string, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	padded := append(append([]byte(nil), plaintext...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	out := make([]byte, aes.BlockSize+len(padded))
+	iv := out[:aes.BlockSize]
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out[aes.BlockSize:], padded)
+
+	return base64.StdEncoding.EncodeToString(out), nil
+}
+
+// decryptContent reverses encryptContent
+func decryptContent(content string, key []byte) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("invalid ciphertext length")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext := make([]byte, len(data)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(plaintext, data[aes.BlockSize:])
+
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, errors.New("unable to decrypt secret: wrong key or corrupted data")
+	}
+	for _, b := range plaintext[len(plaintext)-padding:] {
+		if int(b) != padding {
+			return nil, errors.New("unable to decrypt secret: wrong key or corrupted data")
+		}
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
+
+// hashPassphraseForTransport hashes a passphrase like the web client: base64(SHA-256(passphrase))
+func hashPassphraseForTransport(passphrase string) string {
+	sum := sha256.Sum256([]byte(passphrase))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestEncryptDecryptContent(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+
+	for _, plaintext := range []string{"a", "exactly16bytes!!", strings.Repeat("long secret ", 100)} {
+		content, err := encryptContent([]byte(plaintext), key)
+		if err != nil {
+			t.Fatalf("Failed to encrypt: %v", err)
+		}
+
+		decrypted, err := decryptContent(content, key)
+		if err != nil {
+			t.Fatalf("Failed to decrypt: %v", err)
+		}
+		if string(decrypted) != plaintext {
+			t.Errorf("Expected %q, got %q", plaintext, decrypted)
+		}
+	}
+}
+
+func TestDecryptContent_WrongKey(t *testing.T) {
+	content, _ := encryptContent([]byte("secret"), bytes.Repeat([]byte{1}, 32))
+
+	if decrypted, err := decryptContent(content, bytes.Repeat([]byte{2}, 32)); err == nil && string(decrypted) == "secret" {
+		t.Error("Expected decryption with the wrong key to fail")
+	}
+}
+
+func TestCLI_SendAndRead(t *testing.T) {
+	_, server := setupTestServer(t)
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	code := runCLI([]string{"send", "--server", server.URL, "--passphrase", "hunter2"}, strings.NewReader("my cli secret"), &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Expected send to succeed, got exit code %d: %s", code, stderr.String())
+	}
+
+	shareURL := strings.TrimSpace(stdout.String())
+	if !strings.HasPrefix(shareURL, server.URL+"/s/") || !strings.Contains(shareURL, "#") {
+		t.Fatalf("Unexpected share URL %q", shareURL)
+	}
+	if !strings.Contains(stderr.String(), "Management token:") {
+		t.Error("Expected management token on stderr")
+	}
+
+	// Wrong passphrase must fail without burning the secret
+	stdout.Reset()
+	if code := runCLI([]string{"read", "--passphrase", "wrong", shareURL}, nil, &stdout, &stderr); code == 0 {
+		t.Error("Expected read with the wrong passphrase to fail")
+	}
+
+	stdout.Reset()
+	if code := runCLI([]string{"read", "--passphrase", "hunter2", shareURL}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected read to succeed, got exit code %d: %s", code, stderr.String())
+	}
+	if stdout.String() != "my cli secret" {
+		t.Errorf("Expected 'my cli secret', got %q", stdout.String())
+	}
+
+	// Second read must fail, the secret is gone
+	if code := runCLI([]string{"read", "--passphrase", "hunter2", shareURL}, nil, &stdout, &stderr); code == 0 {
+		t.Error("Expected second read to fail")
+	}
+}
+
+func TestCLI_SendAndReadCredentials(t *testing.T) {
+	_, server := setupTestServer(t)
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	credentials := `{"username":"admin","password":"s3cret","url":"https://example.com"}`
+	if code := runCLI([]string{"send", "--server", server.URL, "--type", "credentials"}, strings.NewReader(credentials), &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected send to succeed, got exit code %d: %s", code, stderr.String())
+	}
+	shareURL := strings.TrimSpace(stdout.String())
+
+	stdout.Reset()
+	if code := runCLI([]string{"read", shareURL}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected read to succeed, got exit code %d: %s", code, stderr.String())
+	}
+	expected := "Username: admin\nPassword: s3cret\nURL: https://example.com\n"
+	if stdout.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, stdout.String())
+	}
+
+	// Credentials must be valid JSON
+	if code := runCLI([]string{"send", "--server", server.URL, "--type", "credentials"}, strings.NewReader("not json"), &stdout, &stderr); code == 0 {
+		t.Error("Expected send of invalid credentials to fail")
+	}
+}
+
+func TestCLI_SendAndReadChunked(t *testing.T) {
+	_, server := setupTestServer(t)
+	defer server.Close()
+
+	// Larger than a single request allows, so it is uploaded in chunks
+	secret := strings.Repeat("0123456789abcdef", MaxSecretLength/8)
+	var stdout, stderr bytes.Buffer
+	if code := runCLI([]string{"send", "--server", server.URL}, strings.NewReader(secret), &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected send to succeed, got exit code %d: %s", code, stderr.String())
+	}
+	shareURL := strings.TrimSpace(stdout.String())
+
+	stdout.Reset()
+	if code := runCLI([]string{"read", shareURL}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected read to succeed, got exit code %d: %s", code, stderr.String())
+	}
+	if stdout.String() != secret {
+		t.Errorf("Expected %d bytes back, got %d", len(secret), stdout.Len())
+	}
+}
+
+func TestCLI_SendAndReadWithPIN(t *testing.T) {
+	_, server := setupTestServer(t)
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	if code := runCLI([]string{"send", "--server", server.URL, "--pin"}, strings.NewReader("pin secret"), &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected send to succeed, got exit code %d: %s", code, stderr.String())
+	}
+	shareURL := strings.TrimSpace(stdout.String())
+	_, pin, found := strings.Cut(stderr.String(), "Pickup PIN: ")
+	if !found {
+		t.Fatalf("Expected pickup PIN on stderr, got %q", stderr.String())
+	}
+	pin = strings.TrimSpace(pin)
+
+	for _, args := range [][]string{{"read", shareURL}, {"read", "--pin", "wrong", shareURL}} {
+		stderr.Reset()
+		if code := runCLI(args, nil, &stdout, &stderr); code == 0 {
+			t.Errorf("Expected %v to fail", args)
+		}
+	}
+	// The server's message is shown, not its JSON error body
+	if !strings.Contains(stderr.String(), "Invalid PIN") || strings.Contains(stderr.String(), "request_id") {
+		t.Errorf("Unexpected error output %q", stderr.String())
+	}
+
+	stdout.Reset()
+	if code := runCLI([]string{"read", "--pin", pin, shareURL}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected read to succeed, got exit code %d: %s", code, stderr.String())
+	}
+	if stdout.String() != "pin secret" {
+		t.Errorf("Expected 'pin secret', got %q", stdout.String())
+	}
+}
+
+func TestCLI_InvalidInput(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	tests := [][]string{
+		{"read"},
+		{"read", "http://localhost/s/abc"},
+		{"read", "http://localhost/other#AAAA"},
+		{"unknown"},
+	}
+	for _, args := range tests {
+		if code := runCLI(args, nil, &stdout, &stderr); code == 0 {
+			t.Errorf("Expected %v to fail", args)
+		}
+	}
+
+	if code := runCLI([]string{"send", "--server", "http://127.0.0.1:0"}, strings.NewReader(""), &stdout, &stderr); code == 0 {
+		t.Error("Expected sending an empty secret to fail")
+	}
+}
+
+func TestCLI_ReadWithChallenge(t *testing.T) {
+	_, server := setupTestServer(t, func(cfg *Config) {
+		cfg.Challenge.Mode = ChallengePOW
+		cfg.Challenge.POWDifficulty = 8
+	})
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	if code := runCLI([]string{"send", "--server", server.URL}, strings.NewReader("proof of work"), &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected send to succeed, got exit code %d: %s", code, stderr.String())
+	}
+	shareURL := strings.TrimSpace(stdout.String())
+
+	stdout.Reset()
+	if code := runCLI([]string{"read", shareURL}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected read to solve the challenge, got exit code %d: %s", code, stderr.String())
+	}
+	if stdout.String() != "proof of work" {
+		t.Errorf("Expected secret back, got %q", stdout.String())
+	}
+}
@@ -0,0 +1,723 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	MinClusterKeyLength   = 32
+	ClusterRequestTimeout = 5 * time.Second // Timeout for replicating one change to a node
+	ClusterSyncTimeout    = 2 * time.Minute // Timeout for fetching every secret from a node on start
+	ClusterClockSkew      = time.Minute     // How far a signed request's time may be from this node's clock
+	ClusterBodyOverhead   = 1 << 20         // Bytes a replicated secret may add to its content
+
+	// A read holds a secret on the other nodes for at most this long, enough to reserve it and
+	// use it up everywhere with time to spare
+	ClusterReservationTTL = 3 * ClusterRequestTimeout
+	ClusterRetryDelay     = 20 * time.Millisecond // Base delay before retrying a read another node holds
+)
+
+var (
+	ErrClusterUnavailable = errors.New("not enough cluster nodes are reachable")
+	ErrReadInProgress     = errors.New("secret is being read on another node")
+)
+
+// clusterAD binds sealed replication messages to their purpose
+var clusterAD = []byte("picosend-cluster-v1")
+
+// ClusterConfig lists the other nodes secrets are replicated to
+type ClusterConfig struct {
+	Peers []string // Base URLs of the other nodes' cluster routes; empty disables clustering
+	Key   string   // Shared secret the nodes derive their signing and sealing keys from
+}
+
+// derivedKey returns the key for one purpose, so the cluster key itself never leaves the
+// node and a key leaking from one use doesn't compromise the others
+func (c ClusterConfig) derivedKey(purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(c.Key))
+	mac.Write(clusterAD)
+	mac.Write([]byte(" " + purpose))
+	return mac.Sum(nil)
+}
+
+// Enabled reports whether the node is part of a cluster
+func (c ClusterConfig) Enabled() bool {
+	return len(c.Peers) > 0
+}
+
+// tokenKey returns the key the nodes sign tokens for purpose with, so tokens issued by one node
+// work on the others. Nil when running alone, for a random key per process.
+func (c ClusterConfig) tokenKey(purpose string) []byte {
+	if !c.Enabled() {
+		return nil
+	}
+	return c.derivedKey("token " + purpose)
+}
+
+// Validate checks the peer URLs and the key. Peers must be reached over https: requests are
+// signed, but their metadata and the reads they consume would otherwise travel in the clear.
+func (c ClusterConfig) Validate() error {
+	if len(c.Key) < MinClusterKeyLength {
+		return fmt.Errorf("cluster-key of at least %d characters is required when cluster-peers is set", MinClusterKeyLength)
+	}
+	for _, peer := range c.Peers {
+		u, err := url.Parse(peer)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("invalid cluster peer %q (expected an https URL)", peer)
+		}
+	}
+	return nil
+}
+
+// Replicator copies a store's changes to the other nodes of a cluster
+type Replicator interface {
+	// Replicate sends a new secret to the other nodes. It fails unless a majority of the
+	// cluster, counting this node, holds the secret.
+	Replicate(e *ExportedSecret) error
+	// Reserve holds a secret for the read with token on the other nodes. It fails unless a
+	// majority of the cluster, counting this node, granted it: with ErrSecretNotFound when too
+	// many nodes no longer hold the secret, ErrReadInProgress when other reads hold it.
+	Reserve(id, token string) error
+	// Release drops the reservation of a read that didn't go ahead
+	Release(id, token string)
+	// Consume uses up the read with token on the other nodes and reports whether enough of
+	// them agreed to make a majority with this node
+	Consume(id, token string, reader ReadRecord) bool
+	Burn(id string)
+	SetExpiry(id string, expiresAt time.Time)
+}
+
+// SetReplicator makes the store replicate secrets through r, nil for none
+func (s *SecretStore) SetReplicator(r Replicator) {
+	s.updateSettings(func(settings *storeSettings) { settings.replicator = r })
+}
+
+func (s *SecretStore) getReplicator() Replicator {
+	return s.settings.Load().replicator
+}
+
+// replicate sends a secret just stored to the other nodes. Without a majority holding it the
+// secret is taken back, since reads could never reach a quorum.
+func (s *SecretStore) replicate(replicator Replicator, id string, secret *Secret, content []byte) error {
+	sh, key := s.shardFor(id), keyOf(id)
+	sh.mu.Lock()
+	if sh.secrets[key] != secret {
+		// A slug can be read before its create returns
+		sh.mu.Unlock()
+		return nil
+	}
+	e := exportSecret(secret)
+	sh.mu.Unlock()
+	e.Content = content
+	err := replicator.Replicate(e)
+	wipeBytes(e.TOTPSeed)
+	if err == nil {
+		return nil
+	}
+
+	sh.mu.Lock()
+	if sh.secrets[key] == secret {
+		size := secret.size
+		delete(sh.secrets, key)
+		wipeSecret(secret)
+		s.release(id, size)
+	}
+	sh.mu.Unlock()
+	replicator.Burn(id)
+	return err
+}
+
+// consumeReplicas uses up a read on the other nodes before this node serves it, and returns the
+// token of the read, which holds the local copy for take. The read first reserves the secret on
+// a majority of the nodes, this one included: each node grants one reservation at a time, so of
+// reads started together on several nodes only one goes ahead, and the others retry after a
+// random delay until it is done. Secrets this node doesn't hold aren't asked about, so probing
+// IDs costs the cluster nothing.
+func (s *SecretStore) consumeReplicas(replicator Replicator, id string, reader ReadRecord) (string, bool) {
+	token := generateToken()
+	deadline := time.Now().Add(ClusterRequestTimeout)
+	for {
+		err := s.ReserveReplica(id, token)
+		if errors.Is(err, ErrSecretNotFound) {
+			return "", false
+		}
+		if err == nil {
+			if err = replicator.Reserve(id, token); err == nil {
+				if replicator.Consume(id, token, reader) {
+					return token, true
+				}
+				s.ReleaseReplica(id, token)
+				return "", false
+			}
+			s.ReleaseReplica(id, token)
+			replicator.Release(id, token)
+			if errors.Is(err, ErrSecretNotFound) || errors.Is(err, ErrClusterUnavailable) {
+				return "", false
+			}
+		}
+		if time.Now().After(deadline) {
+			slog.Warn("Read refused, the secret stayed held by reads on other nodes", "id", id)
+			return "", false
+		}
+		time.Sleep(ClusterRetryDelay + time.Duration(rand.Int63n(int64(4*ClusterRetryDelay))))
+	}
+}
+
+// ReserveReplica holds a secret for the read with token, on this node for a local read or for
+// one another node serves. Fails with ErrReadInProgress while another read holds it.
+func (s *SecretStore) ReserveReplica(id, token string) error {
+	sh := s.shardFor(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	secret, exists := sh.secrets[keyOf(id)]
+	if !exists {
+		return ErrSecretNotFound
+	}
+	now := time.Now()
+	if now.After(secret.ExpiresAt) {
+		s.remove(sh, id, secret, StatusExpired)
+		return ErrSecretNotFound
+	}
+	if secret.reservation != "" && secret.reservation != token && now.Before(secret.reservedUntil) {
+		return ErrReadInProgress
+	}
+	secret.reservation, secret.reservedUntil = token, now.Add(ClusterReservationTTL)
+	return nil
+}
+
+// ReleaseReplica drops the reservation of a read that didn't go ahead
+func (s *SecretStore) ReleaseReplica(id, token string) {
+	sh := s.shardFor(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if secret, exists := sh.secrets[keyOf(id)]; exists && secret.reservation == token {
+		secret.reservation = ""
+	}
+}
+
+// releaseRead ends the reservation of the read with token as it uses up the secret. Returns
+// false when another read, still within its time, holds the secret.
+func (secret *Secret) releaseRead(token string, now time.Time) bool {
+	if secret.reservation != token && now.Before(secret.reservedUntil) {
+		return false
+	}
+	secret.reservation = ""
+	return true
+}
+
+// ImportReplica stores a secret another node replicated. Its expiry is left to that node to
+// report.
+func (s *SecretStore) ImportReplica(e *ExportedSecret) error {
+	return s.importSecret(e, true)
+}
+
+// ConsumeReplica uses up the read with token another node serves, without an event: that node
+// reports it. The read holds a majority of the nodes, so it goes ahead even where another
+// read's reservation hasn't lapsed yet. Returns false when the secret is unknown or used up.
+func (s *SecretStore) ConsumeReplica(id, token string, reader ReadRecord) bool {
+	sh := s.shardFor(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	secret, exists := sh.secrets[keyOf(id)]
+	if !exists {
+		return false
+	}
+	now := time.Now()
+	if now.After(secret.ExpiresAt) {
+		s.remove(sh, id, secret, StatusExpired)
+		return false
+	}
+	if secret.reservation == token {
+		secret.reservation = ""
+	}
+	secret.ReadsRemaining--
+	reader.Time = now
+	secret.Reads = append(secret.Reads, reader)
+	if secret.ReadsRemaining <= 0 {
+		s.discard(sh, id, secret, StatusRead, now)
+	}
+	return true
+}
+
+// BurnReplica removes a secret its sender burned on another node, without an event
+func (s *SecretStore) BurnReplica(id string) bool {
+	sh := s.shardFor(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	secret, exists := sh.secrets[keyOf(id)]
+	if exists {
+		s.discard(sh, id, secret, StatusBurned, time.Now())
+	}
+	return exists
+}
+
+// SetReplicaExpiry moves the expiry of a secret its sender extended on another node
+func (s *SecretStore) SetReplicaExpiry(id string, expiresAt time.Time) bool {
+	sh := s.shardFor(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	secret, exists := sh.secrets[keyOf(id)]
+	if !exists {
+		return false
+	}
+	if !secret.RemindAt.IsZero() {
+		secret.RemindAt = secret.RemindAt.Add(expiresAt.Sub(secret.ExpiresAt))
+	}
+	secret.ExpiresAt = expiresAt
+	sh.scheduleExpiry(keyOf(id), secret)
+	return true
+}
+
+// Cluster replicates secrets to the other nodes over their cluster routes. Every change goes
+// to all nodes at once; creates and reads need a majority of the cluster, burns and expiry
+// changes are sent on a best-effort basis. Membership is the static peer list: nodes don't
+// gossip or reconcile while running, a node that missed changes catches up by syncing on
+// restart.
+type Cluster struct {
+	peers   []string
+	authKey []byte      // Signs requests between nodes, derived from the cluster key
+	aead    cipher.AEAD // Seals secrets in transit with another key derived from the cluster key
+	client  *http.Client
+	logger  *slog.Logger
+
+	mu     sync.Mutex
+	nonces map[string]time.Time // Nonces of the signed requests seen within the clock skew
+	pruned time.Time
+}
+
+func NewCluster(config ClusterConfig, logger *slog.Logger) (*Cluster, error) {
+	aead, err := newGCM(config.derivedKey("seal"))
+	if err != nil {
+		return nil, err
+	}
+	peers := make([]string, len(config.Peers))
+	for i, peer := range config.Peers {
+		peers[i] = strings.TrimRight(peer, "/")
+	}
+	return &Cluster{
+		peers:   peers,
+		authKey: config.derivedKey("auth"),
+		aead:    aead,
+		client:  &http.Client{},
+		logger:  logger,
+		nonces:  make(map[string]time.Time),
+	}, nil
+}
+
+// majority is the number of nodes, this one included, a create or read needs
+func (c *Cluster) majority() int {
+	return (len(c.peers)+1)/2 + 1
+}
+
+// seal encrypts a replicated secret for the other nodes
+func (c *Cluster) seal(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeBytes(data)
+	return sealGCM(c.aead, data, clusterAD)
+}
+
+// open reverses seal
+func (c *Cluster) open(sealed []byte, v any) error {
+	data, err := openGCM(c.aead, sealed, clusterAD)
+	if err != nil {
+		return err
+	}
+	defer wipeBytes(data)
+	return json.Unmarshal(data, v)
+}
+
+// broadcast sends a request to every peer at once and returns how many answered 200
+func (c *Cluster) broadcast(method, path string, body []byte) int {
+	acked := 0
+	for _, status := range c.statuses(method, path, body) {
+		if status == http.StatusOK {
+			acked++
+		}
+	}
+	return acked
+}
+
+// statuses sends a request to every peer at once and returns the status each answered, 0 for
+// peers that couldn't be reached
+func (c *Cluster) statuses(method, path string, body []byte) []int {
+	statuses := make([]int, len(c.peers))
+	var wg sync.WaitGroup
+	for i, peer := range c.peers {
+		wg.Add(1)
+		go func(i int, peer string) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), ClusterRequestTimeout)
+			defer cancel()
+			resp, err := c.send(ctx, method, peer+path, body)
+			if err != nil {
+				c.logger.Warn("Cluster node unreachable", "peer", peer, "error", err)
+				return
+			}
+			resp.Body.Close()
+			statuses[i] = resp.StatusCode
+		}(i, peer)
+	}
+	wg.Wait()
+	return statuses
+}
+
+func (c *Cluster) send(ctx context.Context, method, endpoint string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce := generateToken()
+	req.Header.Set("X-Cluster-Time", timestamp)
+	req.Header.Set("X-Cluster-Nonce", nonce)
+	req.Header.Set("X-Cluster-Signature", c.sign(method, req.URL.RequestURI(), timestamp, nonce, body))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	return c.client.Do(req)
+}
+
+// sign returns the signature of a request between nodes: an HMAC over its method, URI, time,
+// nonce and body, so a captured request can't be altered or replayed
+func (c *Cluster) sign(method, uri, timestamp, nonce string, body []byte) string {
+	digest := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, c.authKey)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s", method, uri, timestamp, nonce, hex.EncodeToString(digest[:]))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks a request from another node was signed with the cluster key, recently, and
+// is not a replay of one already seen
+func (c *Cluster) verify(r *http.Request, body []byte) bool {
+	timestamp, nonce := r.Header.Get("X-Cluster-Time"), r.Header.Get("X-Cluster-Nonce")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || nonce == "" {
+		return false
+	}
+	now := time.Now()
+	if sent := time.Unix(seconds, 0); sent.Before(now.Add(-ClusterClockSkew)) || sent.After(now.Add(ClusterClockSkew)) {
+		return false
+	}
+	expected := c.sign(r.Method, r.URL.RequestURI(), timestamp, nonce, body)
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Cluster-Signature"))) {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Sub(c.pruned) > ClusterClockSkew {
+		for seen, at := range c.nonces {
+			if now.Sub(at) > 2*ClusterClockSkew {
+				delete(c.nonces, seen)
+			}
+		}
+		c.pruned = now
+	}
+	if _, replayed := c.nonces[nonce]; replayed {
+		return false
+	}
+	c.nonces[nonce] = now
+	return true
+}
+
+func secretPath(id string, suffix string) string {
+	return "/cluster/secrets/" + url.PathEscape(id) + suffix
+}
+
+func (c *Cluster) Replicate(e *ExportedSecret) error {
+	sealed, err := c.seal(e)
+	if err != nil {
+		return err
+	}
+	if c.broadcast(http.MethodPost, "/cluster/secrets", sealed)+1 < c.majority() {
+		return ErrClusterUnavailable
+	}
+	return nil
+}
+
+func (c *Cluster) Reserve(id, token string) error {
+	body, _ := json.Marshal(ClusterReservation{Token: token})
+	granted, held, missing := 1, 0, 0
+	for _, status := range c.statuses(http.MethodPut, secretPath(id, "/reservation"), body) {
+		switch status {
+		case http.StatusOK:
+			granted++
+		case http.StatusConflict:
+			held++
+		case http.StatusNotFound:
+			missing++
+		}
+	}
+	switch {
+	case granted >= c.majority():
+		return nil
+	case len(c.peers)+1-missing < c.majority():
+		return ErrSecretNotFound
+	case granted+held >= c.majority():
+		// Reads started on other nodes hold it, one of them will go ahead
+		return ErrReadInProgress
+	}
+	// Unreachable nodes might come back, but a read can't wait for them
+	return ErrClusterUnavailable
+}
+
+func (c *Cluster) Release(id, token string) {
+	body, _ := json.Marshal(ClusterReservation{Token: token})
+	c.broadcast(http.MethodDelete, secretPath(id, "/reservation"), body)
+}
+
+func (c *Cluster) Consume(id, token string, reader ReadRecord) bool {
+	body, err := json.Marshal(ClusterConsume{Token: token, Reader: reader})
+	if err != nil {
+		return false
+	}
+	if c.broadcast(http.MethodPost, secretPath(id, "/consume"), body)+1 < c.majority() {
+		c.logger.Warn("Read refused, not enough cluster nodes agreed", "id", id)
+		return false
+	}
+	return true
+}
+
+func (c *Cluster) Burn(id string) {
+	c.broadcast(http.MethodDelete, secretPath(id, ""), nil)
+}
+
+func (c *Cluster) SetExpiry(id string, expiresAt time.Time) {
+	body, _ := json.Marshal(ClusterExpiry{ExpiresAt: expiresAt})
+	c.broadcast(http.MethodPut, secretPath(id, "/expiry"), body)
+}
+
+// Sync copies the secrets of the first node that answers into store, for a node joining the
+// cluster or coming back after a restart. Returns the number of secrets copied.
+func (c *Cluster) Sync(store *SecretStore) (int, error) {
+	var lastErr error
+	for _, peer := range c.peers {
+		secrets, err := c.fetchAll(peer)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		count := 0
+		for _, e := range secrets {
+			if store.ImportReplica(e) == nil {
+				count++
+			}
+		}
+		wipeExported(secrets)
+		return count, nil
+	}
+	return 0, fmt.Errorf("no cluster node to sync from: %w", lastErr)
+}
+
+func (c *Cluster) fetchAll(peer string) ([]*ExportedSecret, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ClusterSyncTimeout)
+	defer cancel()
+	resp, err := c.send(ctx, http.MethodGet, peer+"/cluster/secrets", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %s", peer, resp.Status)
+	}
+	sealed, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var secrets []*ExportedSecret
+	if err := c.open(sealed, &secrets); err != nil {
+		return nil, fmt.Errorf("%s sent secrets that can't be opened: %w", peer, err)
+	}
+	return secrets, nil
+}
+
+// Check is a readiness check failing while too few nodes are reachable to create or read
+// secrets
+func (c *Cluster) Check(ctx context.Context) error {
+	var reachable atomic.Int32
+	var wg sync.WaitGroup
+	for _, peer := range c.peers {
+		wg.Add(1)
+		go func(peer string) {
+			defer wg.Done()
+			resp, err := c.send(ctx, http.MethodGet, peer+"/cluster/ping", nil)
+			if err == nil {
+				resp.Body.Close()
+				if resp.StatusCode == http.StatusOK {
+					reachable.Add(1)
+				}
+			}
+		}(peer)
+	}
+	wg.Wait()
+	if nodes := int(reachable.Load()) + 1; nodes < c.majority() {
+		return fmt.Errorf("%d of %d nodes reachable, %d needed", nodes, len(c.peers)+1, c.majority())
+	}
+	return nil
+}
+
+// ClusterExpiry is the new expiry of a secret extended on another node
+type ClusterExpiry struct {
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ClusterReservation names the read holding a secret, see ReserveReplica
+type ClusterReservation struct {
+	Token string `json:"token"`
+}
+
+// ClusterConsume is a read another node serves
+type ClusterConsume struct {
+	Token  string     `json:"token"`
+	Reader ReadRecord `json:"reader"`
+}
+
+// clusterRoutes adds the routes other nodes replicate through to r
+func (srv *Server) clusterRoutes(r *mux.Router) {
+	cluster := r.PathPrefix("/cluster").Subrouter()
+	cluster.Use(srv.requireClusterKey)
+	cluster.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+	cluster.HandleFunc("/secrets", srv.clusterExportHandler).Methods("GET")
+	cluster.HandleFunc("/secrets", srv.clusterReplicateHandler).Methods("POST")
+	cluster.HandleFunc("/secrets/{id}/reservation", srv.clusterReserveHandler).Methods("PUT")
+	cluster.HandleFunc("/secrets/{id}/reservation", srv.clusterReleaseHandler).Methods("DELETE")
+	cluster.HandleFunc("/secrets/{id}/consume", srv.clusterConsumeHandler).Methods("POST")
+	cluster.HandleFunc("/secrets/{id}/expiry", srv.clusterExpiryHandler).Methods("PUT")
+	cluster.HandleFunc("/secrets/{id}", srv.clusterBurnHandler).Methods("DELETE")
+}
+
+// requireClusterKey lets only requests signed by the other nodes of the cluster through. The
+// body is read up front since it is part of the signature.
+func (srv *Server) requireClusterKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Cluster-Signature") == "" {
+			apiError(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		limit := int64(max(srv.config.MaxUploadSize, srv.store.Limits().MaxSecretLength))*2 + ClusterBodyOverhead
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+		if err != nil {
+			apiError(w, r, http.StatusRequestEntityTooLarge, "Body too large")
+			return
+		}
+		if !srv.cluster.verify(r, body) {
+			apiError(w, r, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (srv *Server) clusterExportHandler(w http.ResponseWriter, r *http.Request) {
+	secrets, err := srv.store.Export()
+	if err != nil {
+		apiError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer wipeExported(secrets)
+	sealed, err := srv.cluster.seal(secrets)
+	if err != nil {
+		apiError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(sealed)
+}
+
+func (srv *Server) clusterReplicateHandler(w http.ResponseWriter, r *http.Request) {
+	sealed, err := io.ReadAll(r.Body)
+	if err != nil {
+		apiError(w, r, http.StatusBadRequest, "Invalid body")
+		return
+	}
+	var e ExportedSecret
+	if err := srv.cluster.open(sealed, &e); err != nil {
+		apiError(w, r, http.StatusBadRequest, "Invalid replicated secret")
+		return
+	}
+	defer wipeExported([]*ExportedSecret{&e})
+	if err := srv.store.ImportReplica(&e); err != nil {
+		apiError(w, r, http.StatusConflict, err.Error())
+	}
+}
+
+func (srv *Server) clusterReserveHandler(w http.ResponseWriter, r *http.Request) {
+	var req ClusterReservation
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		apiError(w, r, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	switch err := srv.store.ReserveReplica(mux.Vars(r)["id"], req.Token); {
+	case errors.Is(err, ErrSecretNotFound):
+		apiError(w, r, http.StatusNotFound, "Secret not found")
+	case err != nil:
+		apiError(w, r, http.StatusConflict, err.Error())
+	}
+}
+
+func (srv *Server) clusterReleaseHandler(w http.ResponseWriter, r *http.Request) {
+	var req ClusterReservation
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, r, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	srv.store.ReleaseReplica(mux.Vars(r)["id"], req.Token)
+}
+
+func (srv *Server) clusterConsumeHandler(w http.ResponseWriter, r *http.Request) {
+	var req ClusterConsume
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, r, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if !srv.store.ConsumeReplica(mux.Vars(r)["id"], req.Token, req.Reader) {
+		apiError(w, r, http.StatusNotFound, "Secret not found")
+	}
+}
+
+func (srv *Server) clusterExpiryHandler(w http.ResponseWriter, r *http.Request) {
+	var req ClusterExpiry
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, r, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if !srv.store.SetReplicaExpiry(mux.Vars(r)["id"], req.ExpiresAt) {
+		apiError(w, r, http.StatusNotFound, "Secret not found")
+	}
+}
+
+func (srv *Server) clusterBurnHandler(w http.ResponseWriter, r *http.Request) {
+	if !srv.store.BurnReplica(mux.Vars(r)["id"]) {
+		apiError(w, r, http.StatusNotFound, "Secret not found")
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testClusterKey = "test-cluster-key-0123456789abcdef"
+
+// setupCluster serves n test Servers replicating to each other
+func setupCluster(t *testing.T, n int) ([]*Server, []*httptest.Server) {
+	t.Helper()
+	// The servers start first so each node can be configured with the others' URLs
+	handlers := make([]http.Handler, n)
+	servers := make([]*httptest.Server, n)
+	for i := range servers {
+		i := i
+		servers[i] = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlers[i].ServeHTTP(w, r)
+		}))
+		t.Cleanup(servers[i].Close)
+	}
+
+	nodes := make([]*Server, n)
+	for i := range nodes {
+		var peers []string
+		for j, server := range servers {
+			if j != i {
+				peers = append(peers, server.URL)
+			}
+		}
+		nodes[i] = newTestServer(t, func(cfg *Config) { cfg.Cluster = ClusterConfig{Peers: peers, Key: testClusterKey} })
+		handlers[i] = nodes[i].routes()
+		// The test servers share a certificate their own clients trust
+		nodes[i].cluster.client = servers[0].Client()
+	}
+	return nodes, servers
+}
+
+func TestCluster_ReplicatesAndReadsOnce(t *testing.T) {
+	nodes, _ := setupCluster(t, 3)
+
+	id, err := nodes[0].store.StoreWithOptions("encrypted", time.Hour, SecretOptions{PassphraseHash: "hash", ManagementToken: "token"})
+	if err != nil {
+		t.Fatalf("Failed to store: %v", err)
+	}
+	for i, node := range nodes {
+		if secret, found := node.store.Peek(id); !found || secret.Passphrase == nil {
+			t.Fatalf("Expected node %d to hold the secret with its passphrase", i)
+		}
+	}
+
+	// A read on any node uses the secret up everywhere
+	if secret, found := nodes[1].store.Get(id); !found || string(secret.Content) != "encrypted" {
+		t.Fatal("Expected the read to succeed on another node")
+	}
+	for i, node := range nodes {
+		if _, found := node.store.Peek(id); found {
+			t.Errorf("Expected node %d to have dropped the read secret", i)
+		}
+	}
+}
+
+func TestCluster_ConcurrentReadsServeOnce(t *testing.T) {
+	nodes, _ := setupCluster(t, 3)
+	id, _ := nodes[0].store.Store("encrypted", time.Hour)
+
+	var served atomic.Int32
+	var wg sync.WaitGroup
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(node *Server) {
+			defer wg.Done()
+			if _, found := node.store.Get(id); found {
+				served.Add(1)
+			}
+		}(node)
+	}
+	wg.Wait()
+	if served.Load() != 1 {
+		t.Errorf("Expected the secret to be served exactly once, got %d", served.Load())
+	}
+	for i, node := range nodes {
+		if _, found := node.store.Peek(id); found {
+			t.Errorf("Expected node %d to have dropped the read secret", i)
+		}
+	}
+
+	// With reads to spare, concurrent reads take turns instead of failing
+	id, _ = nodes[0].store.StoreWithOptions("encrypted", time.Hour, SecretOptions{MaxReads: 3})
+	served.Store(0)
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(node *Server) {
+			defer wg.Done()
+			if _, found := node.store.Get(id); found {
+				served.Add(1)
+			}
+		}(node)
+	}
+	wg.Wait()
+	if served.Load() != 3 {
+		t.Errorf("Expected every read served, got %d", served.Load())
+	}
+}
+
+func TestCluster_ClaimOnAnotherNode(t *testing.T) {
+	nodes, servers := setupCluster(t, 3)
+	client := servers[0].Client()
+	id, _ := nodes[0].store.Store("encrypted", time.Hour)
+
+	// The metadata comes from one node and the claim goes to another
+	resp, err := client.Get(servers[0].URL + "/api/secrets/" + id)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	var meta SecretMetadataResponse
+	json.NewDecoder(resp.Body).Decode(&meta)
+	resp.Body.Close()
+
+	body, _ := json.Marshal(ClaimSecretRequest{ClaimToken: meta.ClaimToken})
+	resp, err = client.Post(servers[1].URL+"/api/secrets/"+id+"/claim", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	var claimed GetSecretResponse
+	json.NewDecoder(resp.Body).Decode(&claimed)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || claimed.Content != "encrypted" {
+		t.Errorf("Expected the claim token to work on another node, got %d", resp.StatusCode)
+	}
+}
+
+func TestCluster_SurvivesNodeFailure(t *testing.T) {
+	nodes, servers := setupCluster(t, 3)
+	id, _ := nodes[0].store.Store("encrypted", time.Hour)
+
+	servers[0].Close()
+	if secret, found := nodes[1].store.Get(id); !found || string(secret.Content) != "encrypted" {
+		t.Error("Expected the secret to survive the loss of the node it was created on")
+	}
+	if _, err := nodes[1].store.Store("encrypted", time.Hour); err != nil {
+		t.Errorf("Expected creates to work with a majority, got %v", err)
+	}
+
+	// Without a majority nothing is stored, or a read could never reach a quorum
+	servers[2].Close()
+	held := nodes[1].store.Count()
+	if _, err := nodes[1].store.Store("encrypted", time.Hour); !errors.Is(err, ErrClusterUnavailable) {
+		t.Errorf("Expected ErrClusterUnavailable, got %v", err)
+	}
+	if count := nodes[1].store.Count(); count != held {
+		t.Errorf("Expected the failed create to be taken back, got %d secrets", count)
+	}
+}
+
+func TestCluster_BurnAndExtend(t *testing.T) {
+	nodes, _ := setupCluster(t, 3)
+	id, _ := nodes[0].store.StoreWithOptions("encrypted", time.Hour, SecretOptions{ManagementToken: "token"})
+
+	expiresAt := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	if err := nodes[1].store.SetExpiry(id, "token", expiresAt, 24*time.Hour); err != nil {
+		t.Fatalf("Failed to extend: %v", err)
+	}
+	if secret, _ := nodes[2].store.Peek(id); secret == nil || !secret.ExpiresAt.Equal(expiresAt) {
+		t.Error("Expected the new expiry on every node")
+	}
+
+	if err := nodes[2].store.Burn(id, "token"); err != nil {
+		t.Fatalf("Failed to burn: %v", err)
+	}
+	if _, found := nodes[0].store.Peek(id); found {
+		t.Error("Expected the burn to reach every node")
+	}
+}
+
+func TestCluster_DestructionReachesEveryNode(t *testing.T) {
+	nodes, _ := setupCluster(t, 3)
+
+	// The attempt limit destroys the secret on every node
+	id, _ := nodes[0].store.StoreWithOptions("encrypted", time.Hour, SecretOptions{PassphraseHash: "hash", MaxAttempts: 1})
+	if !nodes[1].store.FailAttempt(id) {
+		t.Fatal("Expected the attempt to destroy the secret")
+	}
+	for i, node := range nodes {
+		if _, found := node.store.Peek(id); found {
+			t.Errorf("Expected node %d to have dropped the destroyed secret", i)
+		}
+	}
+
+	// So do a blocklist entry and an admin purge
+	blocked, _ := nodes[0].store.StoreWithOptions("encrypted", time.Hour, SecretOptions{CreatorHash: "creator"})
+	if removed := nodes[1].store.RemoveBlocked(BlocklistEntry{Type: BlockByCreator, Value: "creator"}); removed != 1 {
+		t.Fatalf("Expected the secret removed, got %d", removed)
+	}
+	if _, found := nodes[2].store.Peek(blocked); found {
+		t.Error("Expected the blocked secret gone from every node")
+	}
+	nodes[0].store.Store("encrypted", time.Hour)
+	if count := nodes[1].store.Purge(); count != 1 {
+		t.Fatalf("Expected one secret purged, got %d", count)
+	}
+	for i, node := range nodes {
+		if node.store.Count() != 0 {
+			t.Errorf("Expected node %d to be empty after the purge", i)
+		}
+	}
+}
+
+func TestCluster_Sync(t *testing.T) {
+	nodes, _ := setupCluster(t, 3)
+	id, _ := nodes[0].store.Store("encrypted", time.Hour)
+
+	// A restarted node comes back empty
+	nodes[2].store.WipeAll()
+	count, err := nodes[2].cluster.Sync(nodes[2].store)
+	if err != nil || count != 1 {
+		t.Fatalf("Expected one secret synced, got %d %v", count, err)
+	}
+	if _, found := nodes[2].store.Peek(id); !found {
+		t.Error("Expected the secret back")
+	}
+}
+
+func TestCluster_RoutesNeedKey(t *testing.T) {
+	nodes, servers := setupCluster(t, 3)
+	client := servers[0].Client()
+
+	resp, err := client.Get(servers[0].URL + "/cluster/secrets")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a signature, got %d", resp.StatusCode)
+	}
+
+	// A signed request is accepted once, a replay or a stale one is refused
+	for _, tc := range []struct {
+		sent   time.Time
+		nonce  string
+		status int
+	}{
+		{time.Now(), "nonce", http.StatusOK},
+		{time.Now(), "nonce", http.StatusUnauthorized},
+		{time.Now().Add(-2 * ClusterClockSkew), "stale", http.StatusUnauthorized},
+	} {
+		timestamp := strconv.FormatInt(tc.sent.Unix(), 10)
+		req, _ := http.NewRequest("GET", servers[0].URL+"/cluster/ping", nil)
+		req.Header.Set("X-Cluster-Time", timestamp)
+		req.Header.Set("X-Cluster-Nonce", tc.nonce)
+		req.Header.Set("X-Cluster-Signature", nodes[1].cluster.sign("GET", "/cluster/ping", timestamp, tc.nonce, nil))
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s at %v: expected %d, got %d", tc.nonce, tc.sent, tc.status, resp.StatusCode)
+		}
+	}
+
+	// A single node has no cluster routes
+	single := newTestServer(t)
+	rec := httptest.NewRecorder()
+	single.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/cluster/ping", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without clustering, got %d", rec.Code)
+	}
+}
+
+func TestLoadConfig_Cluster(t *testing.T) {
+	cfg, err := loadConfig(nil, envMap(map[string]string{"CLUSTER_PEERS": "https://node2:8080, https://node3:8080", "CLUSTER_KEY": testClusterKey}))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(cfg.Cluster.Peers) != 2 || cfg.Cluster.Peers[1] != "https://node3:8080" {
+		t.Errorf("Expected two peers, got %v", cfg.Cluster.Peers)
+	}
+
+	for _, env := range []map[string]string{
+		{"CLUSTER_PEERS": "https://node2:8080"},
+		{"CLUSTER_PEERS": "node2:8080", "CLUSTER_KEY": testClusterKey},
+		{"CLUSTER_PEERS": "http://node2:8080", "CLUSTER_KEY": testClusterKey},
+		{"CLUSTER_PEERS": "https://node2:8080", "CLUSTER_KEY": testClusterKey, "S3_BUCKET": "b", "S3_ACCESS_KEY_ID": "a", "S3_SECRET_ACCESS_KEY": "s"},
+	} {
+		if _, err := loadConfig(nil, envMap(env)); err == nil || !strings.Contains(err.Error(), "cluster") {
+			t.Errorf("Expected a cluster error for %v, got %v", env, err)
+		}
+	}
+}
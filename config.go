@@ -0,0 +1,594 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds runtime settings, read from command-line flags with environment variable defaults
+type Config struct {
+	ConfigFile  string // File of KEY=value settings below the environment, re-read on reload
+	Port        string
+	Listen      []string    // TCP addresses and Unix socket paths to listen on instead of Port
+	SocketMode  os.FileMode // Permissions of Unix sockets in Listen
+	BasePath    string      // URL prefix the server is mounted under, "" for the root
+	PublicURL   string      // Origin clients reach the server at, for links built without a request
+	AdminAPIKey string
+
+	ManagementListen string // Address serving the health probes and admin routes instead of the public listeners
+
+	LinkSigningKey string // Key signing the secret IDs in links; empty leaves IDs unsigned
+
+	RequireAPIKeys bool           // Creating secrets needs a key issued through the admin API
+	TrustedProxies []netip.Prefix // Proxies whose forwarding headers identify the client
+	LogLevel       slog.Level
+	LogFormat      string
+	SwaggerUI      bool
+	Demo           bool // Predictable IDs, lifetimes in seconds and fault injection for integration tests
+
+	EncryptionKey []byte    // Master key for encryption at rest; nil when disabled
+	KMS           KMSConfig // Key management service wrapping data keys instead of EncryptionKey
+	Vault         VaultConfig
+
+	Limits   Limits
+	IDFormat IDFormat // Format of generated secret IDs
+	// Custom slugs creators can't choose, on top of the built-in reservedSlugs
+	ReservedSlugs []string
+	// Failed secret lookups allowed per client in LookupFailureWindow; 0 disables throttling
+	LookupFailureLimit int
+	ReadGracePeriod    time.Duration // Time a secret's content is kept after its last read for a retry; 0 disables
+	MaxAttempts        int           // Wrong answers a secret survives when its sender sets no limit; 0 for none
+	ReaderDetails      bool          // Record the browser family and country of each read for the sender
+	AbuseReports       bool          // Let visitors report secret links to the operator
+	GeoIPDB            string        // MaxMind DB file countries of readers are looked up in; empty for none
+	EvictionPolicy     string        // What a create does when the store is full
+	Policy             *Policy       // Organization's rules for new secrets; nil for none
+	MaxUploadSize      int           // Maximum size of a chunked upload in bytes
+	InlineTypes        []string      // Media types file downloads may be shown in the browser as; all are attachments when empty
+	SecurityHeaders    SecurityHeaders
+	CSRF               CSRFConfig
+	CORS               CORSConfig
+	Challenge          ChallengeConfig // Check run before a secret is revealed
+	Branding           Branding
+	SecurityTxt        SecurityTxtConfig
+
+	Cluster ClusterConfig
+
+	S3    S3Config
+	SMTP  SMTPConfig
+	SMS   SMSConfig
+	OIDC  OIDCConfig
+	TLS   TLSConfig
+	Audit AuditConfig
+
+	EventBus EventBusConfig
+	Scan     ScanConfig
+}
+
+// SMTPConfig configures the outgoing mail server used for read-receipt emails
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+
+	DeliveryLimit int // Link emails sent per client network and DeliveryWindow
+}
+
+// Enabled reports whether enough SMTP settings are present to send email
+func (c SMTPConfig) Enabled() bool {
+	return c.Host != "" && c.From != ""
+}
+
+// Addr returns the host:port of the SMTP server
+func (c SMTPConfig) Addr() string {
+	return fmt.Sprintf("%s:%d", c.Host, c.Port)
+}
+
+// loadConfig parses args, falling back to environment variables (via getenv), then to the
+// config file if one is set, and then to built-in defaults
+func loadConfig(args []string, getenv func(string) string) (*Config, error) {
+	path := configFilePath(args, getenv)
+	if path == "" {
+		return parseConfig(args, getenv)
+	}
+
+	values, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool)
+	cfg, err := parseConfig(args, func(key string) string {
+		known[key] = true
+		if v := getenv(key); v != "" {
+			return v
+		}
+		return values[key]
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !known[key] {
+			return nil, fmt.Errorf("%s: unknown setting %s", path, key)
+		}
+	}
+	return cfg, nil
+}
+
+// configFilePath finds --config-file in args without parsing the other flags, whose
+// defaults depend on the file. Falls back to CONFIG_FILE.
+func configFilePath(args []string, getenv func(string) string) string {
+	for i, arg := range args {
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != "config-file" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return getenv("CONFIG_FILE")
+}
+
+// readConfigFile reads KEY=value lines named like the environment variables. Blank lines
+// and lines starting with # are skipped, and values may be quoted.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	values := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=value", path, i+1)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+	return values, nil
+}
+
+// parseConfig parses args with environment fallbacks from getenv and validates the result
+func parseConfig(args []string, getenv func(string) string) (*Config, error) {
+	env := func(key, fallback string) string {
+		if v := getenv(key); v != "" {
+			return v
+		}
+		return fallback
+	}
+	envInt := func(key string, fallback int) int {
+		if v, err := strconv.Atoi(getenv(key)); err == nil {
+			return v
+		}
+		return fallback
+	}
+	envBool := func(key string, fallback bool) bool {
+		if v, err := strconv.ParseBool(getenv(key)); err == nil {
+			return v
+		}
+		return fallback
+	}
+
+	cfg := &Config{Limits: DefaultLimits(), SecurityHeaders: DefaultSecurityHeaders()}
+	fs := flag.NewFlagSet("picosend", flag.ContinueOnError)
+	fs.StringVar(&cfg.ConfigFile, "config-file", env("CONFIG_FILE", ""), "File of KEY=value settings, named like the environment variables, re-read on SIGHUP (env CONFIG_FILE)")
+	fs.StringVar(&cfg.Port, "port", env("PORT", "8080"), "HTTP listen port (env PORT)")
+	fs.Func("listen", "Address to listen on instead of port, host:port or a Unix socket path; repeat for several (env LISTEN, comma-separated)", func(value string) error {
+		cfg.Listen = append(cfg.Listen, value)
+		return nil
+	})
+	var bindAddrs []string
+	fs.Func("bind-address", "IP address or network interface to listen on at port, e.g. 0.0.0.0 for IPv4 only; repeat for several (env BIND_ADDRESS, comma-separated)", func(value string) error {
+		bindAddrs = append(bindAddrs, value)
+		return nil
+	})
+	socketMode := fs.String("listen-socket-mode", env("LISTEN_SOCKET_MODE", fmt.Sprintf("%04o", DefaultSocketMode)), "Octal permissions of Unix sockets given with listen (env LISTEN_SOCKET_MODE)")
+	fs.StringVar(&cfg.ManagementListen, "management-listen", env("MANAGEMENT_LISTEN", ""), "Address serving the health probes and admin routes instead of the public listeners, e.g. 127.0.0.1:9090 (env MANAGEMENT_LISTEN)")
+	fs.StringVar(&cfg.BasePath, "base-path", env("BASE_PATH", ""), "URL path prefix to serve under, e.g. /tools/picosend (env BASE_PATH)")
+	fs.StringVar(&cfg.PublicURL, "public-url", env("PUBLIC_URL", ""), "Origin the server is reached at, e.g. https://secrets.example.com; needed to email links (env PUBLIC_URL)")
+	logLevel := fs.String("log-level", env("LOG_LEVEL", "info"), "Log level: debug, info, warn or error (env LOG_LEVEL)")
+	fs.StringVar(&cfg.LogFormat, "log-format", env("LOG_FORMAT", "text"), "Log format: text or json (env LOG_FORMAT)")
+	encryptionKey := fs.String("encryption-key", env("ENCRYPTION_KEY", ""), "Base64 32-byte master key enabling encryption at rest (env ENCRYPTION_KEY)")
+	encryptionKeyFile := fs.String("encryption-key-file", env("ENCRYPTION_KEY_FILE", ""), "File containing the encryption-key (env ENCRYPTION_KEY_FILE)")
+	fs.StringVar(&cfg.KMS.Key, "kms-key", env("KMS_KEY", ""), "KMS key wrapping data keys for encryption at rest: vault-transit://<key>, aws-kms://<key id> or gcp-kms://<key name> (env KMS_KEY)")
+	fs.StringVar(&cfg.Vault.Addr, "vault-addr", env("VAULT_ADDR", ""), "Vault server address for vault-kv-mount or a vault-transit kms-key (env VAULT_ADDR)")
+	fs.StringVar(&cfg.Vault.Token, "vault-token", env("VAULT_TOKEN", ""), "Vault token for vault-kv-mount or a vault-transit kms-key (env VAULT_TOKEN)")
+	fs.StringVar(&cfg.Vault.Mount, "vault-kv-mount", env("VAULT_KV_MOUNT", ""), "Vault KV v2 mount to store secret content in instead of memory, e.g. secret (env VAULT_KV_MOUNT)")
+	fs.StringVar(&cfg.Vault.Prefix, "vault-kv-prefix", env("VAULT_KV_PREFIX", DefaultVaultPrefix), "Path prefix for secrets stored in Vault (env VAULT_KV_PREFIX)")
+	fs.IntVar(&cfg.Vault.Threshold, "vault-kv-threshold", envInt("VAULT_KV_THRESHOLD", 0), "Secrets of at least this many bytes are stored in Vault; 0 stores all of them there (env VAULT_KV_THRESHOLD)")
+	fs.StringVar(&cfg.KMS.Region, "kms-region", env("KMS_REGION", ""), "AWS region of an aws-kms kms-key (env KMS_REGION)")
+	fs.StringVar(&cfg.KMS.AccessKeyID, "kms-access-key-id", env("KMS_ACCESS_KEY_ID", ""), "AWS access key ID for an aws-kms kms-key (env KMS_ACCESS_KEY_ID)")
+	fs.StringVar(&cfg.KMS.SecretAccessKey, "kms-secret-access-key", env("KMS_SECRET_ACCESS_KEY", ""), "AWS secret access key for an aws-kms kms-key (env KMS_SECRET_ACCESS_KEY)")
+	fs.StringVar(&cfg.KMS.SessionToken, "kms-session-token", env("KMS_SESSION_TOKEN", ""), "AWS session token for temporary credentials (env KMS_SESSION_TOKEN)")
+	fs.StringVar(&cfg.AdminAPIKey, "admin-api-key", env("ADMIN_API_KEY", ""), "API key for /admin/api endpoints; admin API is disabled when empty (env ADMIN_API_KEY)")
+	fs.StringVar(&cfg.LinkSigningKey, "link-signing-key", env("LINK_SIGNING_KEY", ""), "Key signing the secret IDs of links, so unsigned or altered IDs are rejected (env LINK_SIGNING_KEY)")
+
+	fs.BoolVar(&cfg.RequireAPIKeys, "require-api-keys", envBool("REQUIRE_API_KEYS", false), "Require an API key issued through the admin API to create secrets (env REQUIRE_API_KEYS)")
+	fs.BoolVar(&cfg.AbuseReports, "abuse-reports", envBool("ABUSE_REPORTS", false), "Let visitors report secret links for review through the admin API (env ABUSE_REPORTS)")
+
+	trustedProxies := fs.String("trusted-proxies", env("TRUSTED_PROXIES", ""), "Comma-separated CIDR ranges of reverse proxies whose Forwarded and X-Forwarded-For headers are trusted (env TRUSTED_PROXIES)")
+
+	fs.StringVar(&cfg.Branding.ProductName, "brand-name", env("BRAND_NAME", DefaultProductName), "Product name shown in page titles and headers (env BRAND_NAME)")
+	fs.StringVar(&cfg.Branding.LogoURL, "brand-logo-url", env("BRAND_LOGO_URL", ""), "Logo image URL shown in the page header (env BRAND_LOGO_URL)")
+	fs.StringVar(&cfg.Branding.AccentColor, "brand-accent-color", env("BRAND_ACCENT_COLOR", ""), "Hex accent color for buttons and links, e.g. #0b7285 (env BRAND_ACCENT_COLOR)")
+	fs.StringVar(&cfg.Branding.FooterText, "brand-footer-text", env("BRAND_FOOTER_TEXT", ""), "Text replacing the default page footer line (env BRAND_FOOTER_TEXT)")
+	fs.StringVar(&cfg.Branding.TemplatesDir, "templates-dir", env("TEMPLATES_DIR", ""), "Directory of page templates overriding the embedded ones (env TEMPLATES_DIR)")
+	securityContacts := fs.String("security-contact", env("SECURITY_CONTACT", ""), "Comma-separated emails or mailto:, tel: or https: URIs for reporting vulnerabilities; serves /.well-known/security.txt (env SECURITY_CONTACT)")
+	fs.StringVar(&cfg.SecurityTxt.Policy, "security-policy", env("SECURITY_POLICY", ""), "https: URL of the vulnerability disclosure policy in security.txt (env SECURITY_POLICY)")
+	fs.StringVar(&cfg.SecurityTxt.Encryption, "security-encryption", env("SECURITY_ENCRYPTION", ""), "https: URL of the key to encrypt reports with, in security.txt (env SECURITY_ENCRYPTION)")
+	fs.StringVar(&cfg.Branding.StaticDir, "static-dir", env("STATIC_DIR", ""), "Directory of files overriding the embedded static files (env STATIC_DIR)")
+
+	fs.BoolVar(&cfg.Demo, "demo", envBool("DEMO", false), "Demo mode for integration tests: predictable IDs, lifetimes in seconds and /demo/faults; never use with real secrets (env DEMO)")
+	fs.BoolVar(&cfg.SwaggerUI, "swagger-ui", envBool("SWAGGER_UI", false), "Serve Swagger UI at /api/docs, loading its assets from a CDN (env SWAGGER_UI)")
+
+	fs.IntVar(&cfg.Limits.MaxSecretLength, "max-secret-length", envInt("MAX_SECRET_LENGTH", MaxSecretLength), "Maximum secret length in characters (env MAX_SECRET_LENGTH)")
+	fs.StringVar(&cfg.EvictionPolicy, "eviction-policy", env("EVICTION_POLICY", EvictionReject), "What a create does when the store is full: reject, soonest-expiry or oldest (env EVICTION_POLICY)")
+	fs.IntVar(&cfg.Limits.MaxStoreBytes, "max-store-bytes", envInt("MAX_STORE_BYTES", 0), "Memory budget in bytes for the content of unread secrets; 0 limits only their number (env MAX_STORE_BYTES)")
+	fs.StringVar(&cfg.IDFormat.Format, "id-format", env("ID_FORMAT", IDFormatBase64URL), "Secret ID format: base64url, base58 or words (env ID_FORMAT)")
+	fs.IntVar(&cfg.IDFormat.Length, "id-length", envInt("ID_LENGTH", 0), "Secret ID length in characters, or words for the words format; 0 uses the format's default (env ID_LENGTH)")
+	fs.IntVar(&cfg.IDFormat.Digits, "id-digits", envInt("ID_DIGITS", 0), "Digits appended to word IDs, e.g. 3 for amber-falcon-917 (env ID_DIGITS)")
+	reservedSlugs := fs.String("reserved-slugs", env("RESERVED_SLUGS", ""), "Comma-separated custom slugs creators can't choose, on top of the built-in ones (env RESERVED_SLUGS)")
+	fs.IntVar(&cfg.IDFormat.MinEntropyBits, "id-min-entropy", envInt("ID_MIN_ENTROPY", 0), "Fewest random bits secret IDs may carry, at least 32; 0 uses 48 (env ID_MIN_ENTROPY)")
+	fs.IntVar(&cfg.MaxAttempts, "max-attempts", envInt("MAX_ATTEMPTS", 0), "Wrong passphrases, PINs or TOTP codes after which a secret is destroyed, unless its sender sets a limit; 0 for no limit (env MAX_ATTEMPTS)")
+	fs.IntVar(&cfg.LookupFailureLimit, "lookup-failure-limit", envInt("LOOKUP_FAILURE_LIMIT", 0), "Lookups of unknown secrets allowed per client IP in 10 minutes before it gets 429; 0 disables (env LOOKUP_FAILURE_LIMIT)")
+	fs.BoolVar(&cfg.ReaderDetails, "reader-details", envBool("READER_DETAILS", true), "Report the browser family and, with geoip-db, country of each read to the sender (env READER_DETAILS)")
+	fs.StringVar(&cfg.GeoIPDB, "geoip-db", env("GEOIP_DB", ""), "MaxMind DB file, e.g. GeoLite2-Country.mmdb, to look up readers' countries in (env GEOIP_DB)")
+	inlineTypes := fs.String("inline-types", env("INLINE_TYPES", ""), "Comma-separated media types file downloads may be shown in the browser as, e.g. image/png,application/pdf; empty always downloads them (env INLINE_TYPES)")
+	readGrace := fs.Int("read-grace-period", envInt("READ_GRACE_PERIOD", 0), "Seconds a secret's content is kept after its last read, so the recipient's page can retry a failed response; 0 wipes it at once (env READ_GRACE_PERIOD)")
+	policyFile := fs.String("policy-file", env("POLICY_FILE", ""), "JSON file of rules new secrets must follow, such as lifetime caps by size or a required passphrase, re-read on reload (env POLICY_FILE)")
+	fs.IntVar(&cfg.MaxUploadSize, "max-upload-size", envInt("MAX_UPLOAD_SIZE", DefaultUploadSize), "Maximum encrypted size in bytes of a secret uploaded in chunks (env MAX_UPLOAD_SIZE)")
+	fs.IntVar(&cfg.Limits.MinLifetime, "min-lifetime", envInt("MIN_LIFETIME", DefaultMinLifetime), "Shortest allowed secret lifetime in minutes (env MIN_LIFETIME)")
+	fs.IntVar(&cfg.Limits.MaxLifetime, "max-lifetime", envInt("MAX_LIFETIME", DefaultMaxLifetime), "Longest allowed secret lifetime in minutes (env MAX_LIFETIME)")
+	fs.IntVar(&cfg.Limits.DefaultLifetime, "default-lifetime", envInt("DEFAULT_LIFETIME", DefaultLifetime), "Lifetime in minutes used when none is requested (env DEFAULT_LIFETIME)")
+
+	fs.BoolVar(&cfg.SecurityHeaders.Enabled, "security-headers", envBool("SECURITY_HEADERS", true), "Add CSP, HSTS and related headers to HTML responses; disable if a proxy sets them (env SECURITY_HEADERS)")
+	fs.StringVar(&cfg.SecurityHeaders.ContentSecurityPolicy, "content-security-policy", env("CONTENT_SECURITY_POLICY", DefaultContentSecurityPolicy), "Content-Security-Policy for HTML responses (env CONTENT_SECURITY_POLICY)")
+	fs.BoolVar(&cfg.CSRF.Enabled, "csrf-protection", envBool("CSRF_PROTECTION", true), "Reject state-changing requests that browsers send from other origins (env CSRF_PROTECTION)")
+	trustedOrigins := fs.String("csrf-trusted-origins", env("CSRF_TRUSTED_ORIGINS", ""), "Comma-separated origins besides picosend's own allowed to call the API from a browser (env CSRF_TRUSTED_ORIGINS)")
+	corsOrigins := fs.String("cors-origins", env("CORS_ORIGINS", ""), "Comma-separated origins allowed to call the API cross-origin, or * for any; empty disables CORS (env CORS_ORIGINS)")
+	fs.StringVar(&cfg.CORS.Methods, "cors-methods", env("CORS_METHODS", DefaultCORSMethods), "Methods allowed in CORS requests (env CORS_METHODS)")
+	fs.StringVar(&cfg.CORS.Headers, "cors-headers", env("CORS_HEADERS", DefaultCORSHeaders), "Request headers allowed in CORS requests (env CORS_HEADERS)")
+	fs.IntVar(&cfg.CORS.MaxAge, "cors-max-age", envInt("CORS_MAX_AGE", DefaultCORSMaxAge), "Seconds browsers may cache a CORS preflight response (env CORS_MAX_AGE)")
+	fs.IntVar(&cfg.SecurityHeaders.HSTSMaxAge, "hsts-max-age", envInt("HSTS_MAX_AGE", DefaultHSTSMaxAge), "Strict-Transport-Security max-age in seconds, 0 disables HSTS (env HSTS_MAX_AGE)")
+
+	fs.StringVar(&cfg.Challenge.Mode, "reveal-challenge", env("REVEAL_CHALLENGE", ChallengeNone), "Check before revealing a secret so link scanners can't consume it: none, token, pow, turnstile or hcaptcha (env REVEAL_CHALLENGE)")
+	fs.IntVar(&cfg.Challenge.POWDifficulty, "pow-difficulty", envInt("POW_DIFFICULTY", DefaultPOWDifficulty), "Leading zero bits required by the pow reveal challenge (env POW_DIFFICULTY)")
+	fs.StringVar(&cfg.Challenge.SiteKey, "captcha-site-key", env("CAPTCHA_SITE_KEY", ""), "Turnstile or hCaptcha site key (env CAPTCHA_SITE_KEY)")
+	fs.StringVar(&cfg.Challenge.SecretKey, "captcha-secret-key", env("CAPTCHA_SECRET_KEY", ""), "Turnstile or hCaptcha secret key (env CAPTCHA_SECRET_KEY)")
+
+	clusterPeers := fs.String("cluster-peers", env("CLUSTER_PEERS", ""), "Comma-separated https URLs of the other cluster nodes secrets are replicated to; empty runs a single node (env CLUSTER_PEERS)")
+	fs.StringVar(&cfg.Cluster.Key, "cluster-key", env("CLUSTER_KEY", ""), "Shared key of the cluster nodes, at least 32 characters (env CLUSTER_KEY)")
+
+	fs.StringVar(&cfg.S3.Bucket, "s3-bucket", env("S3_BUCKET", ""), "S3 bucket for large secrets; enables object storage (env S3_BUCKET)")
+	fs.StringVar(&cfg.S3.Endpoint, "s3-endpoint", env("S3_ENDPOINT", ""), "S3-compatible endpoint URL, defaults to AWS for s3-region (env S3_ENDPOINT)")
+	fs.StringVar(&cfg.S3.Region, "s3-region", env("S3_REGION", "us-east-1"), "S3 region (env S3_REGION)")
+	fs.StringVar(&cfg.S3.Prefix, "s3-prefix", env("S3_PREFIX", DefaultS3Prefix), "Key prefix for stored objects (env S3_PREFIX)")
+	fs.StringVar(&cfg.S3.AccessKeyID, "s3-access-key-id", env("S3_ACCESS_KEY_ID", ""), "S3 access key ID (env S3_ACCESS_KEY_ID)")
+	fs.StringVar(&cfg.S3.SecretAccessKey, "s3-secret-access-key", env("S3_SECRET_ACCESS_KEY", ""), "S3 secret access key (env S3_SECRET_ACCESS_KEY)")
+	fs.StringVar(&cfg.S3.SessionToken, "s3-session-token", env("S3_SESSION_TOKEN", ""), "S3 session token for temporary credentials (env S3_SESSION_TOKEN)")
+	fs.BoolVar(&cfg.S3.PathStyle, "s3-path-style", envBool("S3_PATH_STYLE", false), "Use path-style bucket addressing, e.g. for MinIO (env S3_PATH_STYLE)")
+	fs.IntVar(&cfg.S3.Threshold, "s3-threshold", envInt("S3_THRESHOLD", DefaultBlobThreshold), "Secrets of at least this many bytes are stored in S3 (env S3_THRESHOLD)")
+
+	fs.StringVar(&cfg.SMTP.Host, "smtp-host", env("SMTP_HOST", ""), "SMTP server host; enables email notifications (env SMTP_HOST)")
+	fs.IntVar(&cfg.SMTP.Port, "smtp-port", envInt("SMTP_PORT", 587), "SMTP server port (env SMTP_PORT)")
+	fs.StringVar(&cfg.SMTP.Username, "smtp-username", env("SMTP_USERNAME", ""), "SMTP username (env SMTP_USERNAME)")
+	fs.StringVar(&cfg.SMTP.Password, "smtp-password", env("SMTP_PASSWORD", ""), "SMTP password (env SMTP_PASSWORD)")
+	fs.StringVar(&cfg.SMTP.From, "smtp-from", env("SMTP_FROM", ""), "Sender address for notification emails (env SMTP_FROM)")
+	fs.StringVar(&cfg.SMS.Provider, "sms-provider", env("SMS_PROVIDER", ""), "Provider pickup PINs can be texted through: twilio or vonage (env SMS_PROVIDER)")
+	fs.StringVar(&cfg.SMS.AccountID, "sms-account", env("SMS_ACCOUNT", ""), "Twilio account SID or Vonage API key (env SMS_ACCOUNT)")
+	fs.StringVar(&cfg.SMS.Token, "sms-token", env("SMS_TOKEN", ""), "Twilio auth token or Vonage API secret (env SMS_TOKEN)")
+	fs.StringVar(&cfg.SMS.From, "sms-from", env("SMS_FROM", ""), "Sender number or ID of PIN texts (env SMS_FROM)")
+	fs.IntVar(&cfg.SMS.Limit, "sms-limit", envInt("SMS_LIMIT", DefaultSMSLimit), "PIN texts per client network and hour (env SMS_LIMIT)")
+	fs.StringVar(&cfg.OIDC.Issuer, "oidc-issuer", env("OIDC_ISSUER", ""), "OpenID Connect provider users sign in with to create secrets, e.g. https://accounts.google.com (env OIDC_ISSUER)")
+	fs.StringVar(&cfg.OIDC.ClientID, "oidc-client-id", env("OIDC_CLIENT_ID", ""), "Client ID registered with the OIDC provider (env OIDC_CLIENT_ID)")
+	fs.StringVar(&cfg.OIDC.ClientSecret, "oidc-client-secret", env("OIDC_CLIENT_SECRET", ""), "Client secret registered with the OIDC provider (env OIDC_CLIENT_SECRET)")
+	oidcDomains := fs.String("oidc-allowed-domains", env("OIDC_ALLOWED_DOMAINS", ""), "Comma-separated email domains allowed to sign in; empty allows every account (env OIDC_ALLOWED_DOMAINS)")
+	oidcAdmins := fs.String("oidc-admin-emails", env("OIDC_ADMIN_EMAILS", ""), "Comma-separated emails of accounts that may open admin pages (env OIDC_ADMIN_EMAILS)")
+	fs.StringVar(&cfg.TLS.CertFile, "tls-cert", env("TLS_CERT", ""), "PEM certificate to serve HTTPS with on TCP listeners; plain HTTP when empty (env TLS_CERT)")
+	fs.StringVar(&cfg.TLS.KeyFile, "tls-key", env("TLS_KEY", ""), "PEM private key of the TLS certificate (env TLS_KEY)")
+	fs.StringVar(&cfg.TLS.ClientCAFile, "tls-client-ca", env("TLS_CLIENT_CA", ""), "PEM bundle of CAs API clients must present a certificate from; empty leaves the API open (env TLS_CLIENT_CA)")
+	tlsClientSANs := fs.String("tls-client-sans", env("TLS_CLIENT_SANS", ""), "Comma-separated DNS names, emails, URIs or IPs a client certificate must carry one of; empty allows any from the CA (env TLS_CLIENT_SANS)")
+	fs.IntVar(&cfg.SMTP.DeliveryLimit, "delivery-email-limit", envInt("DELIVERY_EMAIL_LIMIT", DefaultDeliveryLimit), "Secret links emailed per client network and hour (env DELIVERY_EMAIL_LIMIT)")
+
+	fs.StringVar(&cfg.Audit.Target, "audit-log", env("AUDIT_LOG", ""), "Audit trail of secret events: a file path, syslog for the local daemon, or syslog://, syslog+tcp:// or syslog+tls://host:port; disabled when empty (env AUDIT_LOG)")
+	fs.StringVar(&cfg.Audit.Format, "audit-format", env("AUDIT_FORMAT", AuditFormatJSON), "Format of audit records: json or cef (env AUDIT_FORMAT)")
+	fs.Int64Var(&cfg.Audit.MaxSize, "audit-max-size", int64(envInt("AUDIT_MAX_SIZE", DefaultAuditMaxSize)), "Size in bytes at which the audit file is rotated (env AUDIT_MAX_SIZE)")
+	auditRetention := fs.Int("audit-retention-days", envInt("AUDIT_RETENTION_DAYS", int(DefaultAuditRetention/(24*time.Hour))), "Days to keep rotated audit files (env AUDIT_RETENTION_DAYS)")
+	auditIPKey := fs.String("audit-ip-key", env("AUDIT_IP_KEY", ""), "Key for hashing client addresses in the audit log, so hashes stay stable across restarts (env AUDIT_IP_KEY)")
+	fs.StringVar(&cfg.EventBus.URL, "event-bus", env("EVENT_BUS", ""), "Message bus secret events are published to: nats://host:4222, tls://host:4222 or kafka+https://rest-proxy; disabled when empty (env EVENT_BUS)")
+	fs.StringVar(&cfg.EventBus.Topic, "event-bus-topic", env("EVENT_BUS_TOPIC", DefaultEventBusTopic), "NATS subject or Kafka topic secret events are published to (env EVENT_BUS_TOPIC)")
+	fs.StringVar(&cfg.Scan.Clamd, "scan-clamd", env("SCAN_CLAMD", ""), "clamd daemon that scans content sent in plain text or through the no-JavaScript form: tcp://host:3310 or unix:///path; disabled when empty (env SCAN_CLAMD)")
+	fs.StringVar(&cfg.Scan.NotifyWebhook, "scan-notify-webhook", env("SCAN_NOTIFY_WEBHOOK", ""), "URL notified when content is quarantined (env SCAN_NOTIFY_WEBHOOK)")
+	fs.StringVar(&cfg.Scan.NotifyWebhookKey, "scan-notify-webhook-key", env("SCAN_NOTIFY_WEBHOOK_KEY", ""), "Key quarantine notifications are signed with (env SCAN_NOTIFY_WEBHOOK_KEY)")
+	fs.StringVar(&cfg.Scan.NotifyEmail, "scan-notify-email", env("SCAN_NOTIFY_EMAIL", ""), "Address emailed when content is quarantined; needs smtp-host (env SCAN_NOTIFY_EMAIL)")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	level, err := parseLogLevel(*logLevel)
+	if err != nil {
+		return nil, err
+	}
+	cfg.LogLevel = level
+
+	if cfg.EncryptionKey, err = loadMasterKey(*encryptionKey, *encryptionKeyFile); err != nil {
+		return nil, err
+	}
+	if cfg.KMS.Enabled() {
+		if cfg.EncryptionKey != nil {
+			return nil, fmt.Errorf("encryption-key and kms-key can't be used together")
+		}
+		if err := cfg.KMS.Validate(cfg.Vault); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(cfg.Listen) == 0 {
+		for _, addr := range strings.Split(getenv("LISTEN"), ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				cfg.Listen = append(cfg.Listen, addr)
+			}
+		}
+	}
+	if len(bindAddrs) == 0 {
+		for _, addr := range strings.Split(getenv("BIND_ADDRESS"), ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				bindAddrs = append(bindAddrs, addr)
+			}
+		}
+	}
+	if len(bindAddrs) > 0 {
+		if len(cfg.Listen) > 0 {
+			return nil, fmt.Errorf("bind-address can't be combined with listen")
+		}
+		for _, addr := range bindAddrs {
+			cfg.Listen = append(cfg.Listen, net.JoinHostPort(strings.Trim(addr, "[]"), cfg.Port))
+		}
+	}
+	if err := validateListenAddrs(cfg.Listen); err != nil {
+		return nil, err
+	}
+	if cfg.ManagementListen != "" {
+		if err := validateListenAddrs([]string{cfg.ManagementListen}); err != nil {
+			return nil, fmt.Errorf("management-listen: %w", err)
+		}
+	}
+	mode, err := strconv.ParseUint(*socketMode, 8, 32)
+	if err != nil || mode > 0o777 {
+		return nil, fmt.Errorf("invalid listen-socket-mode %q (expected octal permissions such as 0660)", *socketMode)
+	}
+	cfg.SocketMode = os.FileMode(mode)
+
+	if cfg.BasePath, err = normalizeBasePath(cfg.BasePath); err != nil {
+		return nil, err
+	}
+	if cfg.PublicURL, err = normalizePublicURL(cfg.PublicURL); err != nil {
+		return nil, err
+	}
+
+	if cfg.TrustedProxies, err = parseTrustedProxies(*trustedProxies); err != nil {
+		return nil, err
+	}
+
+	if cfg.CSRF.TrustedOrigins, err = parseTrustedOrigins(*trustedOrigins); err != nil {
+		return nil, err
+	}
+	if cfg.CORS.Origins, err = parseCORSOrigins(*corsOrigins); err != nil {
+		return nil, err
+	}
+	if cfg.CORS.MaxAge < 0 {
+		return nil, fmt.Errorf("cors-max-age must not be negative")
+	}
+
+	if cfg.LogFormat != "text" && cfg.LogFormat != "json" {
+		return nil, fmt.Errorf("invalid log format %q (expected text or json)", cfg.LogFormat)
+	}
+
+	if err := cfg.Limits.Validate(); err != nil {
+		return nil, err
+	}
+
+	cfg.IDFormat = cfg.IDFormat.withDefaultLength()
+	if err := cfg.IDFormat.Validate(); err != nil {
+		return nil, err
+	}
+	for _, slug := range strings.Split(*reservedSlugs, ",") {
+		if slug = strings.ToLower(strings.TrimSpace(slug)); slug != "" {
+			cfg.ReservedSlugs = append(cfg.ReservedSlugs, slug)
+		}
+	}
+
+	if err := cfg.Challenge.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Branding.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Policy, err = loadPolicy(*policyFile); err != nil {
+		return nil, err
+	}
+	cfg.SecurityTxt.Contacts = parseSecurityContacts(*securityContacts)
+	if err := cfg.SecurityTxt.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := validateEvictionPolicy(cfg.EvictionPolicy); err != nil {
+		return nil, err
+	}
+
+	if cfg.MaxAttempts < 0 || cfg.MaxAttempts > MaxAttemptsLimit {
+		return nil, fmt.Errorf("max-attempts must be between 0 and %d", MaxAttemptsLimit)
+	}
+	if cfg.LookupFailureLimit < 0 {
+		return nil, fmt.Errorf("lookup-failure-limit must not be negative")
+	}
+
+	cfg.ReadGracePeriod = time.Duration(*readGrace) * time.Second
+	if cfg.InlineTypes, err = parseInlineTypes(*inlineTypes); err != nil {
+		return nil, err
+	}
+	if cfg.ReadGracePeriod < 0 || cfg.ReadGracePeriod > MaxReadGracePeriod {
+		return nil, fmt.Errorf("read-grace-period must be between 0 and %d seconds", int(MaxReadGracePeriod/time.Second))
+	}
+
+	if cfg.MaxUploadSize <= 0 {
+		return nil, fmt.Errorf("max-upload-size must be positive")
+	}
+
+	if cfg.AdminAPIKey != "" && len(cfg.AdminAPIKey) < MinAdminAPIKeyLength {
+		return nil, fmt.Errorf("admin-api-key must be at least %d characters", MinAdminAPIKeyLength)
+	}
+
+	if cfg.LinkSigningKey != "" && len(cfg.LinkSigningKey) < MinLinkSigningKeyLength {
+		return nil, fmt.Errorf("link-signing-key must be at least %d characters", MinLinkSigningKeyLength)
+	}
+
+	if cfg.RequireAPIKeys && cfg.AdminAPIKey == "" {
+		return nil, fmt.Errorf("admin-api-key is required to issue keys when require-api-keys is set")
+	}
+
+	if cfg.AbuseReports && cfg.AdminAPIKey == "" {
+		return nil, fmt.Errorf("admin-api-key is required to review reports when abuse-reports is set")
+	}
+
+	for _, peer := range strings.Split(*clusterPeers, ",") {
+		if peer = strings.TrimSpace(peer); peer != "" {
+			cfg.Cluster.Peers = append(cfg.Cluster.Peers, peer)
+		}
+	}
+	if cfg.Cluster.Enabled() {
+		if err := cfg.Cluster.Validate(); err != nil {
+			return nil, err
+		}
+		// Every node would write the same object, sealed under its own data key
+		if cfg.S3.Enabled() || cfg.Vault.Enabled() {
+			return nil, fmt.Errorf("cluster-peers can't be combined with s3-bucket or vault-kv-mount")
+		}
+	}
+
+	if cfg.S3.Enabled() && (cfg.S3.AccessKeyID == "" || cfg.S3.SecretAccessKey == "") {
+		return nil, fmt.Errorf("s3-access-key-id and s3-secret-access-key are required when s3-bucket is set")
+	}
+
+	if cfg.Vault.Enabled() {
+		if cfg.Vault.Addr == "" || cfg.Vault.Token == "" {
+			return nil, fmt.Errorf("vault-addr and vault-token are required when vault-kv-mount is set")
+		}
+		if cfg.S3.Enabled() {
+			return nil, fmt.Errorf("s3-bucket and vault-kv-mount can't be used together")
+		}
+		if cfg.Vault.Threshold < 0 {
+			return nil, fmt.Errorf("vault-kv-threshold must not be negative")
+		}
+	}
+
+	if err := cfg.Audit.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.Audit.MaxSize <= 0 {
+		return nil, fmt.Errorf("audit-max-size must be positive")
+	}
+	if *auditRetention <= 0 {
+		return nil, fmt.Errorf("audit-retention-days must be positive")
+	}
+	cfg.Audit.Retention = time.Duration(*auditRetention) * 24 * time.Hour
+	if *auditIPKey != "" {
+		cfg.Audit.IPKey = []byte(*auditIPKey)
+	}
+	if cfg.EventBus.Enabled() {
+		if err := cfg.EventBus.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Scan.Enabled() {
+		if err := cfg.Scan.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if !cfg.Scan.Enabled() && (cfg.Scan.NotifyWebhook != "" || cfg.Scan.NotifyEmail != "") {
+		return nil, fmt.Errorf("scan-notify-webhook and scan-notify-email need scan-clamd")
+	}
+	if cfg.Scan.NotifyEmail != "" && !cfg.SMTP.Enabled() {
+		return nil, fmt.Errorf("scan-notify-email needs smtp-host")
+	}
+
+	if cfg.SMTP.Host != "" && cfg.SMTP.From == "" {
+		return nil, fmt.Errorf("smtp-from is required when smtp-host is set")
+	}
+	if cfg.SMTP.DeliveryLimit < 1 {
+		return nil, fmt.Errorf("delivery-email-limit must be positive")
+	}
+	if cfg.SMS.Enabled() {
+		if err := cfg.SMS.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	cfg.OIDC.AllowedDomains = parseEmailList(*oidcDomains)
+	cfg.OIDC.AdminEmails = parseEmailList(*oidcAdmins)
+	if cfg.OIDC.Enabled() {
+		if err := cfg.OIDC.Validate(cfg.PublicURL); err != nil {
+			return nil, err
+		}
+	}
+	cfg.TLS.ClientSANs = parseSANList(*tlsClientSANs)
+	if err := cfg.TLS.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// DefaultConfig returns the settings used when no flags or environment variables are set
+func DefaultConfig() *Config {
+	cfg, err := loadConfig(nil, func(string) string { return "" })
+	if err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+// mustLoadConfig loads configuration from os.Args and the environment, exiting on error
+func mustLoadConfig() *Config {
+	cfg, err := loadConfig(os.Args[1:], os.Getenv)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	return cfg
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func envMap(values map[string]string) func(string) string {
+	return func(key string) string { return values[key] }
+}
+
+func TestLoadConfig_Defaults(t *testing.T) {
+	cfg, err := loadConfig(nil, envMap(nil))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if cfg.Port != "8080" {
+		t.Errorf("Expected default port 8080, got %s", cfg.Port)
+	}
+	if cfg.SMTP.Enabled() {
+		t.Error("Expected SMTP to be disabled by default")
+	}
+}
+
+func TestLoadConfig_EnvAndFlags(t *testing.T) {
+	env := envMap(map[string]string{
+		"PORT":      "8081",
+		"SMTP_HOST": "mail.example.com",
+		"SMTP_PORT": "2525",
+		"SMTP_FROM": "picosend@example.com",
+	})
+
+	cfg, err := loadConfig([]string{"--port", "9090"}, env)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Flags take precedence over environment variables
+	if cfg.Port != "9090" {
+		t.Errorf("Expected port 9090, got %s", cfg.Port)
+	}
+	if !cfg.SMTP.Enabled() {
+		t.Error("Expected SMTP to be enabled")
+	}
+	if cfg.SMTP.Addr() != "mail.example.com:2525" {
+		t.Errorf("Expected SMTP addr mail.example.com:2525, got %s", cfg.SMTP.Addr())
+	}
+}
+
+func TestLoadConfig_SMTPRequiresFrom(t *testing.T) {
+	_, err := loadConfig([]string{"--smtp-host", "mail.example.com"}, envMap(nil))
+	if err == nil {
+		t.Error("Expected error when smtp-from is missing")
+	}
+}
+
+func TestLoadConfig_LifetimeBounds(t *testing.T) {
+	cfg, err := loadConfig([]string{"--min-lifetime", "10", "--max-lifetime", "120", "--default-lifetime", "60"}, envMap(nil))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.Limits.MinLifetime != 10 || cfg.Limits.MaxLifetime != 120 || cfg.Limits.DefaultLifetime != 60 {
+		t.Errorf("Unexpected lifetime limits: %+v", cfg.Limits)
+	}
+
+	// The default lifetime must fall inside the allowed range
+	_, err = loadConfig(nil, envMap(map[string]string{"MAX_LIFETIME": "60"}))
+	if err == nil {
+		t.Error("Expected error when default-lifetime exceeds max-lifetime")
+	}
+}
+
+func TestLoadConfig_BasePath(t *testing.T) {
+	cfg, err := loadConfig(nil, envMap(map[string]string{"BASE_PATH": "tools/picosend/"}))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.BasePath != "/tools/picosend" {
+		t.Errorf("Expected base path /tools/picosend, got %q", cfg.BasePath)
+	}
+
+	for _, invalid := range []string{"/a/../b", "/a?b", "/a//b"} {
+		if _, err := loadConfig([]string{"--base-path", invalid}, envMap(nil)); err == nil {
+			t.Errorf("Expected error for base path %q", invalid)
+		}
+	}
+}
+
+func TestLoadConfig_RequireAPIKeysNeedsAdminKey(t *testing.T) {
+	if _, err := loadConfig([]string{"--require-api-keys"}, envMap(nil)); err == nil {
+		t.Error("Expected error when require-api-keys is set without admin-api-key")
+	}
+}
+
+func TestLoadConfig_OIDC(t *testing.T) {
+	args := []string{"--oidc-issuer", "https://accounts.example.com", "--oidc-client-id", "picosend", "--oidc-client-secret", "s3cr3t"}
+	if _, err := loadConfig(args, envMap(nil)); err == nil {
+		t.Error("Expected error when oidc-issuer is set without public-url")
+	}
+
+	cfg, err := loadConfig(args, envMap(map[string]string{
+		"PUBLIC_URL":           "https://secrets.example.com",
+		"OIDC_ALLOWED_DOMAINS": "Example.com, @corp.example.com",
+		"OIDC_ADMIN_EMAILS":    "Admin@Example.com",
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(cfg.OIDC.AllowedDomains) != 2 || cfg.OIDC.AllowedDomains[1] != "corp.example.com" || cfg.OIDC.AdminEmails[0] != "admin@example.com" {
+		t.Errorf("Unexpected OIDC lists %v %v", cfg.OIDC.AllowedDomains, cfg.OIDC.AdminEmails)
+	}
+}
+
+func TestLoadConfig_TrustedProxies(t *testing.T) {
+	cfg, err := loadConfig([]string{"--trusted-proxies", "10.0.0.0/8,127.0.0.1"}, envMap(nil))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(cfg.TrustedProxies) != 2 || cfg.TrustedProxies[1].String() != "127.0.0.1/32" {
+		t.Errorf("Unexpected trusted proxies %v", cfg.TrustedProxies)
+	}
+
+	if _, err := loadConfig(nil, envMap(map[string]string{"TRUSTED_PROXIES": "10.0.0.0/99"})); err == nil {
+		t.Error("Expected error for an invalid trusted proxy range")
+	}
+}
+
+func TestLoadConfig_EvictionPolicy(t *testing.T) {
+	cfg, err := loadConfig(nil, envMap(map[string]string{"EVICTION_POLICY": "oldest", "MAX_STORE_BYTES": "1048576"}))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.EvictionPolicy != EvictionOldest || cfg.Limits.MaxStoreBytes != 1048576 {
+		t.Errorf("Unexpected eviction policy %q or memory budget %d", cfg.EvictionPolicy, cfg.Limits.MaxStoreBytes)
+	}
+
+	if _, err := loadConfig([]string{"--eviction-policy", "random"}, envMap(nil)); err == nil {
+		t.Error("Expected error for an unknown eviction policy")
+	}
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "picosend.env")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfig_File(t *testing.T) {
+	path := writeConfigFile(t, `
+# Tunables
+MAX_SECRET_LENGTH=5000
+LOG_LEVEL = "debug"
+PORT=7000
+`)
+
+	cfg, err := loadConfig([]string{"--config-file=" + path}, envMap(map[string]string{"PORT": "8081"}))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.LogLevel.String() != "DEBUG" || cfg.Limits.MaxSecretLength != 5000 || cfg.ConfigFile != path {
+		t.Errorf("Expected settings from the file, got %+v", cfg)
+	}
+	// The environment takes precedence over the file
+	if cfg.Port != "8081" {
+		t.Errorf("Expected port 8081 from the environment, got %s", cfg.Port)
+	}
+
+	if _, err := loadConfig(nil, envMap(map[string]string{"CONFIG_FILE": path})); err != nil {
+		t.Errorf("Expected CONFIG_FILE to be read, got %v", err)
+	}
+}
+
+func TestLoadConfig_FileErrors(t *testing.T) {
+	tests := map[string]string{
+		"unknown setting": "MAX_UNRED_SECRETS=10\n",
+		"missing value":   "LOG_LEVEL\n",
+		"invalid setting": "LOG_LEVEL=verbose\n",
+		"missing file":    "",
+	}
+	for name, content := range tests {
+		path := filepath.Join(t.TempDir(), "missing.env")
+		if content != "" {
+			path = writeConfigFile(t, content)
+		}
+		if _, err := loadConfig([]string{"--config-file", path}, envMap(nil)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		} else if name == "unknown setting" && !strings.Contains(err.Error(), "MAX_UNRED_SECRETS") {
+			t.Errorf("Expected the unknown key to be named, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultCORSMethods = "GET, POST, PUT, PATCH, DELETE"
+	DefaultCORSHeaders = "Authorization, Content-Type, Range, If-Range, " + RequestIDHeader
+	DefaultCORSMaxAge  = 600 // Seconds browsers may cache a preflight response
+	corsExposedHeaders = "Retry-After, Content-Range, Accept-Ranges, ETag, " + RequestIDHeader
+)
+
+// CORSConfig lets frontends and browser extensions on other origins call the API. Only
+// /api/ routes answer cross-origin requests; pages and the admin API never do.
+type CORSConfig struct {
+	Origins []string // Allowed origins, or * for any; empty disables CORS
+	Methods string   // Sent as Access-Control-Allow-Methods
+	Headers string   // Request headers allowed in Access-Control-Allow-Headers
+	MaxAge  int      // Access-Control-Max-Age in seconds
+}
+
+// Enabled reports whether any origin is allowed
+func (c CORSConfig) Enabled() bool {
+	return len(c.Origins) > 0
+}
+
+// parseCORSOrigins parses a comma-separated list of origins, which may be just *
+func parseCORSOrigins(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "*" {
+		return []string{"*"}, nil
+	}
+	return parseTrustedOrigins(value)
+}
+
+// allowsOrigin reports whether a browser page on origin may call the API
+func (c CORSConfig) allowsOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, allowed := range c.Origins {
+		if allowed == "*" || allowed == origin {
+			return origin != "" && origin != "null"
+		}
+	}
+	return false
+}
+
+// corsAllowed reports whether the request is an API call from an origin CORS allows
+func (srv *Server) corsAllowed(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/") && srv.config.CORS.allowsOrigin(r.Header.Get("Origin"))
+}
+
+// corsMiddleware adds CORS headers to API responses for allowed origins. Credentials aren't
+// allowed: API clients authenticate with bearer tokens, not cookies.
+func (srv *Server) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if srv.config.CORS.Enabled() && strings.HasPrefix(r.URL.Path, "/api/") {
+			w.Header().Add("Vary", "Origin")
+			if srv.corsAllowed(r) {
+				w.Header().Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
+				w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// corsPreflightHandler answers the OPTIONS request browsers send before a cross-origin API call
+func (srv *Server) corsPreflightHandler(w http.ResponseWriter, r *http.Request) {
+	cors := srv.config.CORS
+	if !cors.allowsOrigin(r.Header.Get("Origin")) || r.Header.Get("Access-Control-Request-Method") == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Methods", cors.Methods)
+	w.Header().Set("Access-Control-Allow-Headers", cors.Headers)
+	w.Header().Set("Access-Control-Max-Age", strconv.Itoa(cors.MaxAge))
+	w.WriteHeader(http.StatusNoContent)
+}
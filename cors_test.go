@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	router := newTestServer(t, func(cfg *Config) { cfg.CORS.Origins = []string{"https://app.example.org"} }).routes()
+
+	// Preflight from an allowed origin
+	req := httptest.NewRequest("OPTIONS", "/api/secrets", nil)
+	req.Header.Set("Origin", "https://app.example.org")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "https://app.example.org" ||
+		rec.Header().Get("Access-Control-Allow-Methods") != DefaultCORSMethods || rec.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("Expected a preflight response, got %d %v", rec.Code, rec.Header())
+	}
+
+	// The actual request passes the cross-origin check and can read the response
+	req = httptest.NewRequest("POST", "/api/secrets", strings.NewReader("{}"))
+	req.Header.Set("Origin", "https://app.example.org")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code == http.StatusForbidden || rec.Header().Get("Access-Control-Allow-Origin") != "https://app.example.org" {
+		t.Errorf("Expected an allowed cross-origin call, got %d %v", rec.Code, rec.Header())
+	}
+
+	// Other origins and non-API routes get no CORS headers
+	for _, tt := range []struct{ method, path, origin string }{
+		{"OPTIONS", "/api/secrets", "https://evil.example"},
+		{"GET", "/api/config", "https://evil.example"},
+		{"GET", "/", "https://app.example.org"},
+	} {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("Origin", tt.origin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s %s from %s: expected no CORS headers, got %v", tt.method, tt.path, tt.origin, rec.Header())
+		}
+	}
+}
+
+func TestCORS_AnyOrigin(t *testing.T) {
+	cors := CORSConfig{Origins: []string{"*"}}
+	if !cors.allowsOrigin("chrome-extension://abcdef") || cors.allowsOrigin("null") {
+		t.Error("Expected * to allow any origin but the opaque null origin")
+	}
+	if (CORSConfig{}).allowsOrigin("https://app.example.org") {
+		t.Error("Expected no origin to be allowed by default")
+	}
+}
+
+func TestLoadConfig_CORS(t *testing.T) {
+	cfg, err := loadConfig([]string{"--cors-origins", "*"}, envMap(nil))
+	if err != nil || len(cfg.CORS.Origins) != 1 || cfg.CORS.Origins[0] != "*" || cfg.CORS.Headers != DefaultCORSHeaders {
+		t.Errorf("Unexpected CORS config %+v (%v)", cfg.CORS, err)
+	}
+	cfg, err = loadConfig([]string{"--cors-origins", "https://app.example.org, chrome-extension://abcdef"}, envMap(nil))
+	if err != nil || len(cfg.CORS.Origins) != 2 {
+		t.Errorf("Expected a web and an extension origin, got %v (%v)", cfg.CORS.Origins, err)
+	}
+	for _, args := range [][]string{{"--cors-origins", "app.example.org"}, {"--cors-max-age", "-1"}} {
+		if _, err := loadConfig(args, envMap(nil)); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CSRFConfig configures the check that state-changing requests from browsers come from
+// picosend's own pages, so a hostile page can't create or burn secrets from a visitor's browser
+type CSRFConfig struct {
+	Enabled        bool     // Disable when a gateway in front already enforces origins
+	TrustedOrigins []string // Other origins allowed to call the API from a browser, e.g. https://app.example.com
+}
+
+// originSchemes are the schemes of web pages and browser extensions
+var originSchemes = map[string]bool{"http": true, "https": true, "chrome-extension": true, "moz-extension": true, "safari-web-extension": true}
+
+// parseTrustedOrigins parses a comma-separated list of scheme://host[:port] origins
+func parseTrustedOrigins(value string) ([]string, error) {
+	var origins []string
+	for _, origin := range strings.Split(value, ",") {
+		if origin = strings.TrimSpace(origin); origin == "" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || !originSchemes[u.Scheme] || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return nil, fmt.Errorf("invalid trusted origin %q (expected e.g. https://app.example.com)", origin)
+		}
+		origins = append(origins, strings.ToLower(u.Scheme+"://"+u.Host))
+	}
+	return origins, nil
+}
+
+// allows reports whether a request to one of hosts may go ahead. Safe methods always may, except WebSocket
+// handshakes, which browsers send cross-origin without asking. Browsers name the page's
+// origin in Origin, or at least say whether it is foreign in Sec-Fetch-Site; requests with
+// neither come from API clients rather than browsers and are allowed.
+func (c CSRFConfig) allows(r *http.Request, hosts []string) bool {
+	if r.Method == "GET" || r.Method == "HEAD" || r.Method == "OPTIONS" {
+		if !isWebSocketUpgrade(r) {
+			return true
+		}
+	}
+
+	if origin := r.Header.Get("Origin"); origin != "" {
+		return c.trustedOrigin(origin, hosts)
+	}
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+		return true
+	}
+	return false
+}
+
+// trustedOrigin reports whether origin is a host the request was sent to or a trusted origin.
+// The scheme of the own host isn't compared, TLS is often terminated by a proxy.
+func (c CSRFConfig) trustedOrigin(origin string, hosts []string) bool {
+	origin = strings.ToLower(origin)
+	for _, trusted := range c.TrustedOrigins {
+		if origin == trusted {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	for _, host := range hosts {
+		if strings.EqualFold(u.Host, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// csrfMiddleware rejects state-changing requests sent by pages on other origins, unless CORS
+// allows the origin to call the API
+func (srv *Server) csrfMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if srv.config.CSRF.Enabled && !srv.config.CSRF.allows(r, srv.requestHosts(r)) && !srv.corsAllowed(r) {
+			localizedError(w, r, http.StatusForbidden, "error.cross_origin")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestHosts returns the host the request was sent to and, from a trusted proxy that
+// rewrites Host, the original one in X-Forwarded-Host
+func (srv *Server) requestHosts(r *http.Request) []string {
+	hosts := []string{r.Host}
+	if forwarded := r.Header.Get("X-Forwarded-Host"); forwarded != "" && isTrustedProxy(peerAddr(r), srv.config.TrustedProxies) {
+		host, _, _ := strings.Cut(forwarded, ",")
+		hosts = append(hosts, strings.TrimSpace(host))
+	}
+	return hosts
+}
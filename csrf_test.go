@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	router := newTestServer(t, func(cfg *Config) {
+		cfg.CSRF.TrustedOrigins = []string{"https://app.example.org"}
+		cfg.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("198.51.100.0/24")}
+	}).routes()
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		blocked bool
+	}{
+		{"API client", "POST", "/api/secrets", nil, false},
+		{"same origin", "POST", "/api/secrets", map[string]string{"Origin": "https://example.com"}, false},
+		{"same origin fetch metadata", "POST", "/api/secrets", map[string]string{"Sec-Fetch-Site": "same-origin"}, false},
+		{"trusted origin", "POST", "/api/secrets", map[string]string{"Origin": "https://APP.example.org"}, false},
+		{"other origin", "POST", "/api/secrets", map[string]string{"Origin": "https://evil.example"}, true},
+		{"opaque origin", "DELETE", "/api/secrets/abc", map[string]string{"Origin": "null"}, true},
+		{"cross-site fetch metadata", "PUT", "/api/theme", map[string]string{"Sec-Fetch-Site": "cross-site"}, true},
+		{"cross-site read", "GET", "/api/config", map[string]string{"Origin": "https://evil.example", "Sec-Fetch-Site": "cross-site"}, false},
+		{"cross-site WebSocket", "GET", "/ws/handoff/abc", map[string]string{"Origin": "https://evil.example",
+			"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": "dGhlIHNhbXBsZSBub25jZQ=="}, true},
+		{"forwarded host from untrusted peer", "POST", "/api/secrets", map[string]string{"Origin": "https://picosend.example", "X-Forwarded-Host": "picosend.example"}, true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader("{}"))
+		for name, value := range tt.headers {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if blocked := rec.Code == http.StatusForbidden; blocked != tt.blocked {
+			t.Errorf("%s: expected blocked=%v, got status %d", tt.name, tt.blocked, rec.Code)
+		}
+	}
+
+	// A trusted proxy that rewrites Host passes the original in X-Forwarded-Host
+	req := httptest.NewRequest("POST", "/api/secrets", strings.NewReader("{}"))
+	req.RemoteAddr = "198.51.100.10:1234"
+	req.Host = "127.0.0.1:8080"
+	req.Header.Set("Origin", "https://picosend.example")
+	req.Header.Set("X-Forwarded-Host", "picosend.example")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code == http.StatusForbidden {
+		t.Error("Expected the forwarded host of a trusted proxy to count as same origin")
+	}
+}
+
+func TestCSRFMiddleware_Disabled(t *testing.T) {
+	router := newTestServer(t, func(cfg *Config) { cfg.CSRF.Enabled = false }).routes()
+
+	req := httptest.NewRequest("POST", "/api/secrets", strings.NewReader("{}"))
+	req.Header.Set("Origin", "https://evil.example")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code == http.StatusForbidden {
+		t.Error("Expected cross-origin requests to pass with CSRF protection disabled")
+	}
+}
+
+func TestParseTrustedOrigins(t *testing.T) {
+	origins, err := parseTrustedOrigins(" https://App.example.org, http://localhost:3000/ ")
+	if err != nil || len(origins) != 2 || origins[0] != "https://app.example.org" || origins[1] != "http://localhost:3000" {
+		t.Errorf("Unexpected origins %v (%v)", origins, err)
+	}
+	for _, value := range []string{"app.example.org", "https://app.example.org/path", "ftp://app.example.org"} {
+		if _, err := parseTrustedOrigins(value); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
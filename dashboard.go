@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// statsBar is one interval of the dashboard's activity chart
+type statsBar struct {
+	Label         string // Interval start, HH:MM UTC
+	Created       int
+	Read          int
+	CreatedHeight int // Percent of the busiest interval
+	ReadHeight    int
+}
+
+type adminStatsPageData struct {
+	Lang     string
+	BasePath string
+	Brand    Branding
+	Theme    string
+
+	Window         string        // Period the history covers, e.g. "24 hours"
+	Interval       string        // Period of one chart bar
+	Totals         MetricsSample // Events during Window
+	CreatedPerHour float64
+	ReadPerHour    float64
+	ExpiredPercent int // Share of secrets closed during Window that expired unread
+
+	Stats              StoreStats
+	Limits             Limits
+	UtilizationPercent int // Unread secrets as a share of MaxUnreadSecrets
+	BytesUsed          string
+	MaxStoreBytes      string // Memory budget; empty when only the count is limited
+	BytesPercent       int    // Content bytes as a share of MaxStoreBytes
+	OldestAge          string
+	Bars               []statsBar
+	GeneratedAt        string
+}
+
+// adminStatsPageHandler renders the usage dashboard from the metrics collector and the store
+func (srv *Server) adminStatsPageHandler(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	history := srv.metrics.History(now)
+	stats := srv.store.Stats()
+	limits := srv.store.Limits()
+	window := MetricsBuckets * MetricsInterval
+
+	data := adminStatsPageData{
+		Lang:        DefaultLocale,
+		BasePath:    srv.config.BasePath,
+		Brand:       srv.config.Branding,
+		Theme:       requestTheme(w, r),
+		Window:      fmt.Sprintf("%d hours", int(window.Hours())),
+		Interval:    fmt.Sprintf("%d minutes", int(MetricsInterval.Minutes())),
+		Stats:       stats,
+		Limits:      limits,
+		BytesUsed:   formatBytes(stats.BytesUsed),
+		OldestAge:   stats.OldestSecretAge.Round(time.Second).String(),
+		GeneratedAt: now.UTC().Format("2006-01-02 15:04:05 UTC"),
+	}
+
+	busiest := 1
+	for _, sample := range history {
+		data.Totals.add(sample)
+		busiest = max(busiest, sample.Created, sample.Read)
+	}
+	hours := window.Hours()
+	data.CreatedPerHour = float64(data.Totals.Created) / hours
+	data.ReadPerHour = float64(data.Totals.Read) / hours
+	if closed := data.Totals.Read + data.Totals.Expired + data.Totals.Burned; closed > 0 {
+		data.ExpiredPercent = data.Totals.Expired * 100 / closed
+	}
+	if limits.MaxUnreadSecrets > 0 {
+		data.UtilizationPercent = stats.Count * 100 / limits.MaxUnreadSecrets
+	}
+	if limits.MaxStoreBytes > 0 {
+		data.MaxStoreBytes = formatBytes(limits.MaxStoreBytes)
+		data.BytesPercent = srv.store.BytesUsed() * 100 / limits.MaxStoreBytes
+	}
+
+	data.Bars = make([]statsBar, len(history))
+	for i, sample := range history {
+		data.Bars[i] = statsBar{
+			Label:         sample.Start.UTC().Format("15:04"),
+			Created:       sample.Created,
+			Read:          sample.Read,
+			CreatedHeight: sample.Created * 100 / busiest,
+			ReadHeight:    sample.Read * 100 / busiest,
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	srv.renderPage(w, locales[DefaultLocale], "admin-stats.html", data)
+}
+
+// formatBytes renders a byte count with a binary unit, e.g. 1.5 MiB
+func formatBytes(n int) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, exp := float64(n)/unit, 0
+	for value >= unit && exp < 3 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGT"[exp])
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminStatsPage(t *testing.T) {
+	srv, server := setupAdminTestServer(t)
+	defer server.Close()
+
+	srv.store.Store("content", time.Hour)
+	srv.metrics.RecordCreated(time.Now())
+
+	get := func(user, password string) *http.Response {
+		req, _ := http.NewRequest("GET", server.URL+"/admin/stats", nil)
+		if password != "" {
+			req.SetBasicAuth(user, password)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		return resp
+	}
+
+	resp := get("", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || !strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), "Basic ") {
+		t.Errorf("Expected a Basic authentication challenge, got %d %q", resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+	}
+	resp = get("admin", "wrong")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong key to be rejected, got %d", resp.StatusCode)
+	}
+
+	resp = get("admin", testAdminKey)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	for _, expected := range []string{"Usage statistics for the last 24 hours", "1 of 1000 unread secrets", `class="interval"`} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("Expected page to contain %q", expected)
+		}
+	}
+}
+
+func TestAdminStatsPage_DisabledWithoutKey(t *testing.T) {
+	_, server := setupTestServer(t)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/admin/stats")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, expected := range map[int]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KiB", 5 << 20: "5.0 MiB"} {
+		if got := formatBytes(n); got != expected {
+			t.Errorf("formatBytes(%d) = %q, expected %q", n, got, expected)
+		}
+	}
+}
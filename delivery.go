@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultDeliveryLimit      = 10        // Link emails per client network and window
+	DeliveryWindow            = time.Hour // Period link emails are counted over
+	MaxDeliveriesPerRecipient = 5         // Link emails one address receives per window from all senders
+)
+
+// deliveryCount counts the link emails of one client or recipient in the current window
+type deliveryCount struct {
+	count int
+	since time.Time
+}
+
+// DeliveryLimiter caps how many secret links the server emails, per sending network and per
+// recipient address, so the mailer can't be used to flood an inbox or send spam
+type DeliveryLimiter struct {
+	limit  int // Emails per client network and window
+	window time.Duration
+
+	mu         sync.Mutex
+	clients    map[netip.Prefix]*deliveryCount
+	recipients map[string]*deliveryCount
+}
+
+func NewDeliveryLimiter(limit int, window time.Duration) *DeliveryLimiter {
+	return &DeliveryLimiter{
+		limit:      limit,
+		window:     window,
+		clients:    make(map[netip.Prefix]*deliveryCount),
+		recipients: make(map[string]*deliveryCount),
+	}
+}
+
+// Allow counts an email from addr to the recipient and reports whether both are within their
+// limits. Once the tables are full, emails from new clients or to new recipients are refused.
+func (l *DeliveryLimiter) Allow(addr netip.Addr, recipient string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	client := currentCount(l.clients, throttleKey(addr), l.window, now)
+	to := currentCount(l.recipients, strings.ToLower(recipient), l.window, now)
+	if client == nil || to == nil || client.count >= l.limit || to.count >= MaxDeliveriesPerRecipient {
+		return false
+	}
+	client.count++
+	to.count++
+	return true
+}
+
+// currentCount returns the count for key in this window, starting a new one if needed.
+// Returns nil when the table is full.
+func currentCount[K comparable](counts map[K]*deliveryCount, key K, window time.Duration, now time.Time) *deliveryCount {
+	count, ok := counts[key]
+	if ok && now.Sub(count.since) < window {
+		return count
+	}
+	if !ok && len(counts) >= MaxThrottledClients {
+		return nil
+	}
+	count = &deliveryCount{since: now}
+	counts[key] = count
+	return count
+}
+
+// Prune forgets clients and recipients whose window has passed
+func (l *DeliveryLimiter) Prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, count := range l.clients {
+		if now.Sub(count.since) >= l.window {
+			delete(l.clients, key)
+		}
+	}
+	for key, count := range l.recipients {
+		if now.Sub(count.since) >= l.window {
+			delete(l.recipients, key)
+		}
+	}
+}
+
+// secretLink returns the public link to a secret without the key fragment, which the server
+// never has
+func (srv *Server) secretLink(id string) string {
+	return srv.config.PublicURL + srv.config.BasePath + "/s/" + srv.signID(id)
+}
+
+// deliverLink emails the link to a new secret to its recipient in the given language
+func (srv *Server) deliverLink(to string, locale *Locale, id string, expiresAt time.Time, opts SecretOptions) {
+	data := emailTemplateData{
+		ID:                 srv.signID(id),
+		Link:               srv.secretLink(id),
+		ExpiresAt:          expiresAt.UTC().Format("2006-01-02 15:04:05 UTC"),
+		ReadsRemaining:     max(opts.MaxReads, 1),
+		PassphraseRequired: opts.PassphraseHash != "",
+		PINRequired:        opts.PIN != "",
+	}
+	name := fmt.Sprintf("delivery.%s.txt", locale.Tag)
+	if srv.emailNotifier.templates.Lookup(name) == nil {
+		name = fmt.Sprintf("delivery.%s.txt", DefaultLocale)
+	}
+	srv.emailNotifier.queue(to, name, data)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/smtp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDeliveryLimiter(t *testing.T) {
+	limiter := NewDeliveryLimiter(2, time.Hour)
+	now := time.Now()
+	client := netip.MustParseAddr("203.0.113.7")
+
+	if !limiter.Allow(client, "a@example.com", now) || !limiter.Allow(client, "b@example.com", now) {
+		t.Fatal("Expected emails within the client limit to be allowed")
+	}
+	if limiter.Allow(client, "c@example.com", now) {
+		t.Error("Expected the client to be limited")
+	}
+	if !limiter.Allow(client, "c@example.com", now.Add(time.Hour)) {
+		t.Error("Expected the limit to reset after the window")
+	}
+
+	for i := 0; i < MaxDeliveriesPerRecipient; i++ {
+		limiter.Allow(netip.AddrFrom4([4]byte{198, 51, 100, byte(i)}), "Target@example.com", now)
+	}
+	if limiter.Allow(netip.MustParseAddr("192.0.2.1"), "target@example.com", now) {
+		t.Error("Expected the recipient to be limited across clients, ignoring case")
+	}
+}
+
+func TestCreateSecret_DeliverTo(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.SMTP = SMTPConfig{Host: "mail.example.com", Port: 25, From: "picosend@example.com", DeliveryLimit: 1}
+		cfg.PublicURL = "https://secrets.example.com"
+		cfg.BasePath = "/tools"
+	})
+	var mu sync.Mutex
+	var sent []string
+	srv.emailNotifier.send = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, to[0]+"\n"+string(msg))
+		return nil
+	}
+	router := srv.routes()
+
+	create := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/secrets", strings.NewReader(body))
+		req.Header.Set("Accept-Language", "de")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := create(`{"content": "encrypted", "deliver_to": "recipient@example.com", "require_pin": true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the secret to be created, got %d %s", rec.Code, rec.Body.String())
+	}
+	var created CreateSecretResponse
+	json.NewDecoder(rec.Body).Decode(&created)
+	srv.emailNotifier.Close()
+
+	if len(sent) != 1 {
+		t.Fatalf("Expected one email, got %d", len(sent))
+	}
+	email := sent[0]
+	if !strings.HasPrefix(email, "recipient@example.com\n") || !strings.Contains(email, "https://secrets.example.com/tools/s/"+created.ID+"\r\n") {
+		t.Errorf("Expected the link without a key sent to the recipient, got %s", email)
+	}
+	if !strings.Contains(email, "Subject: Ein Geheimnis") || !strings.Contains(email, "Abhol-PIN") || strings.Contains(email, created.PIN) {
+		t.Errorf("Expected a German email mentioning, but not containing, the PIN, got %s", email)
+	}
+
+	if rec := create(`{"content": "encrypted", "deliver_to": "other@example.com"}`); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the client's email limit to apply, got %d", rec.Code)
+	}
+	if rec := create(`{"content": "encrypted", "deliver_to": "Someone <someone@example.com>"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid address to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestCreateSecret_DeliverToDisabled(t *testing.T) {
+	// SMTP alone isn't enough, links need a public URL that doesn't come from the request
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.SMTP = SMTPConfig{Host: "mail.example.com", Port: 25, From: "picosend@example.com", DeliveryLimit: 1}
+	})
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("POST", "/api/secrets", strings.NewReader(`{"content": "encrypted", "deliver_to": "recipient@example.com"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a public URL, got %d", rec.Code)
+	}
+}
+
+func TestLoadConfig_PublicURL(t *testing.T) {
+	cfg, err := loadConfig(nil, envMap(map[string]string{"PUBLIC_URL": "https://secrets.example.com/"}))
+	if err != nil || cfg.PublicURL != "https://secrets.example.com" {
+		t.Errorf("Expected the trailing slash to be stripped, got %q, %v", cfg.PublicURL, err)
+	}
+	for _, value := range []string{"secrets.example.com", "ftp://secrets.example.com", "https://secrets.example.com/tools"} {
+		if _, err := loadConfig([]string{"--public-url", value}, envMap(nil)); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
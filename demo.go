@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DemoIDSeed          = 1           // Seed of the ID sequence in demo mode, the same on every start
+	DemoCleanupInterval = time.Second // Demo lifetimes count seconds, so expiry is checked as often
+	MaxFaultLatency     = 30 * time.Second
+	MaxFaults           = 100
+)
+
+// lifetimeUnit is how long one minute of a requested lifetime lasts: a minute, or a second in
+// demo mode so integration tests can watch secrets expire
+func (srv *Server) lifetimeUnit() time.Duration {
+	if srv.config.Demo {
+		return time.Second
+	}
+	return time.Minute
+}
+
+// demoRandom is a seeded, and so repeatable, source of ID randomness safe for concurrent use
+type demoRandom struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func newDemoRandom(seed int64) *demoRandom {
+	return &demoRandom{rng: rand.New(rand.NewSource(seed))}
+}
+
+func (d *demoRandom) Read(p []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.rng.Read(p)
+}
+
+// Fault is a failure injected into matching requests in demo mode
+type Fault struct {
+	Path      string `json:"path"`       // Path prefix matched relative to the base path; empty matches /api/
+	Status    int    `json:"status"`     // Status answered instead of handling the request; 0 only adds latency
+	LatencyMS int    `json:"latency_ms"` // Delay before the request is handled or failed
+	Count     int    `json:"count"`      // Requests left to affect; 0 keeps the fault until faults are cleared
+}
+
+// Validate checks the status and latency are ones a client could see from a real server
+func (f Fault) Validate() error {
+	if f.Status != 0 && (f.Status < 400 || f.Status > 599) {
+		return errFaultStatus
+	}
+	if f.LatencyMS < 0 || time.Duration(f.LatencyMS)*time.Millisecond > MaxFaultLatency {
+		return errFaultLatency
+	}
+	if f.Count < 0 {
+		return errFaultCount
+	}
+	return nil
+}
+
+var (
+	errFaultStatus  = errors.New("status must be 0 or between 400 and 599")
+	errFaultLatency = errors.New("latency_ms must be between 0 and 30000")
+	errFaultCount   = errors.New("count must not be negative")
+)
+
+// FaultInjector holds the faults requests are checked against, in the order they were added
+type FaultInjector struct {
+	mu     sync.Mutex
+	faults []*Fault
+}
+
+func NewFaultInjector() *FaultInjector {
+	return &FaultInjector{}
+}
+
+// Add appends a fault. Returns false when MaxFaults are already set.
+func (fi *FaultInjector) Add(fault Fault) bool {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	if len(fi.faults) >= MaxFaults {
+		return false
+	}
+	if fault.Path == "" {
+		fault.Path = "/api/"
+	}
+	fi.faults = append(fi.faults, &fault)
+	return true
+}
+
+// List returns copies of the faults still in effect
+func (fi *FaultInjector) List() []Fault {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	faults := make([]Fault, 0, len(fi.faults))
+	for _, fault := range fi.faults {
+		faults = append(faults, *fault)
+	}
+	return faults
+}
+
+// Clear removes all faults
+func (fi *FaultInjector) Clear() {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.faults = nil
+}
+
+// take returns the first fault matching path and counts the request against it
+func (fi *FaultInjector) take(path string) (Fault, bool) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	for i, fault := range fi.faults {
+		if !strings.HasPrefix(path, fault.Path) {
+			continue
+		}
+		taken := *fault
+		if fault.Count > 0 {
+			fault.Count--
+			if fault.Count == 0 {
+				fi.faults = append(fi.faults[:i], fi.faults[i+1:]...)
+			}
+		}
+		return taken, true
+	}
+	return Fault{}, false
+}
+
+// Middleware delays or fails requests matching a fault. The fault endpoints themselves are
+// never affected, so tests can always clear them.
+func (fi *FaultInjector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/demo/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		fault, ok := fi.take(r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if fault.LatencyMS > 0 {
+			select {
+			case <-time.After(time.Duration(fault.LatencyMS) * time.Millisecond):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if fault.Status == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if fault.Status == http.StatusTooManyRequests || fault.Status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", "1")
+		}
+		apiError(w, r, fault.Status, "Injected fault")
+	})
+}
+
+func (srv *Server) listFaultsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(srv.faults.List())
+}
+
+// addFaultHandler injects a fault into the requests that follow
+func (srv *Server) addFaultHandler(w http.ResponseWriter, r *http.Request) {
+	var fault Fault
+	if err := json.NewDecoder(r.Body).Decode(&fault); err != nil {
+		apiError(w, r, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if err := fault.Validate(); err != nil {
+		apiError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !srv.faults.Add(fault) {
+		apiError(w, r, http.StatusConflict, "too many faults")
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (srv *Server) clearFaultsHandler(w http.ResponseWriter, r *http.Request) {
+	srv.faults.Clear()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDemoMode_PredictableIDs(t *testing.T) {
+	ids := func() []string {
+		srv := newTestServer(t, func(cfg *Config) { cfg.Demo = true })
+		var ids []string
+		for i := 0; i < 3; i++ {
+			id, err := srv.store.Store("encrypted", time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, id)
+		}
+		return ids
+	}
+	first, second := ids(), ids()
+	if strings.Join(first, ",") != strings.Join(second, ",") {
+		t.Errorf("Expected the same IDs on every start, got %v and %v", first, second)
+	}
+	if first[0] == first[1] {
+		t.Errorf("Expected distinct IDs, got %v", first)
+	}
+}
+
+func TestDemoMode_LifetimeInSeconds(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.Demo = true })
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("POST", "/api/secrets", strings.NewReader(`{"content": "encrypted", "lifetime": 5}`)))
+	var created CreateSecretResponse
+	json.NewDecoder(rec.Body).Decode(&created)
+
+	state, found := srv.store.Status(created.ID)
+	if !found {
+		t.Fatalf("Expected the secret to be stored, got %d %s", rec.Code, rec.Body.String())
+	}
+	if lifetime := state.ExpiresAt.Sub(state.CreatedAt); lifetime != 5*time.Second {
+		t.Errorf("Expected a 5 second lifetime, got %v", lifetime)
+	}
+}
+
+func TestDemoMode_Faults(t *testing.T) {
+	_, server := setupTestServer(t, func(cfg *Config) { cfg.Demo = true })
+	defer server.Close()
+
+	post := func(path, body string) int {
+		resp, err := http.Post(server.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := post("/demo/faults", `{"status": 200}`); code != http.StatusBadRequest {
+		t.Errorf("Expected a successful status to be rejected as a fault, got %d", code)
+	}
+	if code := post("/demo/faults", `{"path": "/api/secrets", "status": 429, "count": 2}`); code != http.StatusCreated {
+		t.Fatalf("Expected the fault to be added, got %d", code)
+	}
+
+	var codes []int
+	for i := 0; i < 3; i++ {
+		codes = append(codes, post("/api/secrets", `{"content": "encrypted"}`))
+	}
+	if codes[0] != http.StatusTooManyRequests || codes[1] != http.StatusTooManyRequests || codes[2] != http.StatusOK {
+		t.Errorf("Expected two injected 429s followed by success, got %v", codes)
+	}
+
+	post("/demo/faults", `{"status": 500}`)
+	req, _ := http.NewRequest("DELETE", server.URL+"/demo/faults", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if code := post("/api/secrets", `{"content": "encrypted"}`); code != http.StatusOK {
+		t.Errorf("Expected no faults once cleared, got %d", code)
+	}
+}
+
+func TestDemoMode_DisabledByDefault(t *testing.T) {
+	srv := newTestServer(t)
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("POST", "/demo/faults", strings.NewReader(`{"status": 500}`)))
+	if rec.Code != http.StatusNotFound && rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected no fault endpoints outside demo mode, got %d", rec.Code)
+	}
+}
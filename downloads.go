@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	MaxDownloadFilenameLength = 255 // Longest filename sent in Content-Disposition, in bytes
+	DefaultDownloadFilename   = "secret"
+)
+
+// scriptableTypes can run script in the page of the instance when a browser renders them, so
+// they are never served inline, whatever the operator allows
+var scriptableTypes = map[string]bool{
+	"text/html":              true,
+	"application/xhtml+xml":  true,
+	"image/svg+xml":          true,
+	"text/xml":               true,
+	"application/xml":        true,
+	"text/javascript":        true,
+	"application/javascript": true,
+}
+
+// parseInlineTypes reads the comma-separated media types downloads may be shown inline as
+func parseInlineTypes(value string) ([]string, error) {
+	var types []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		mediaType, _, err := mime.ParseMediaType(item)
+		if err != nil || !strings.Contains(mediaType, "/") || strings.Contains(mediaType, "*") {
+			return nil, fmt.Errorf("inline-types: %q is not a media type", item)
+		}
+		if scriptableTypes[mediaType] {
+			return nil, fmt.Errorf("inline-types: %s can run script and is always downloaded", mediaType)
+		}
+		types = append(types, mediaType)
+	}
+	return types, nil
+}
+
+// sanitizeFilename reduces a client-supplied name to a base name safe to put in a header and
+// save to disk: no directories, control or quote characters, or leading dots
+func sanitizeFilename(name string) string {
+	name = strings.ToValidUTF8(name, "")
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`"*:<>?|`, r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	for len(name) > MaxDownloadFilenameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" {
+		return DefaultDownloadFilename
+	}
+	return name
+}
+
+// setDownloadHeaders marks a response as a file download named after the request's filename
+// parameter. The content is shown inline only as a media type the operator allows, and sent
+// as application/octet-stream otherwise. nosniff is set even when security headers are left to
+// a proxy, so browsers never guess a type from the content.
+func (srv *Server) setDownloadHeaders(w http.ResponseWriter, r *http.Request, mediaType string) {
+	filename := sanitizeFilename(r.URL.Query().Get("filename"))
+	disposition := "attachment"
+	if srv.inlineAllowed(mediaType) {
+		disposition = "inline"
+	} else {
+		mediaType = "application/octet-stream"
+	}
+	header := mime.FormatMediaType(disposition, map[string]string{"filename": filename})
+	if header == "" {
+		header = mime.FormatMediaType(disposition, map[string]string{"filename": DefaultDownloadFilename})
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.Header().Set("Content-Disposition", header)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+}
+
+// inlineAllowed reports whether content of the media type may be rendered by the browser
+func (srv *Server) inlineAllowed(mediaType string) bool {
+	base, _, err := mime.ParseMediaType(mediaType)
+	if err != nil || scriptableTypes[base] {
+		return false
+	}
+	for _, allowed := range srv.config.InlineTypes {
+		if base == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// downloadMediaType is the media type of a named file, from its extension
+func downloadMediaType(filename string) string {
+	if mediaType := mime.TypeByExtension(filepath.Ext(filename)); mediaType != "" {
+		return mediaType
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"report.pdf", "report.pdf"},
+		{"../../etc/passwd", "passwd"},
+		{`C:\Users\me\key.pem`, "key.pem"},
+		{"evil\"\r\nX-Injected: 1.txt", "evilX-Injected 1.txt"},
+		{".htaccess", "htaccess"},
+		{"...", DefaultDownloadFilename},
+		{"", DefaultDownloadFilename},
+		{"Schlüssel.txt", "Schlüssel.txt"},
+		{strings.Repeat("ü", 200), strings.Repeat("ü", 127)},
+	}
+	for _, tt := range tests {
+		if got := sanitizeFilename(tt.name); got != tt.want {
+			t.Errorf("sanitizeFilename(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseInlineTypes(t *testing.T) {
+	types, err := parseInlineTypes(" image/png, Application/PDF ,")
+	if err != nil || len(types) != 2 || types[1] != "application/pdf" {
+		t.Errorf("Expected two types, got %v %v", types, err)
+	}
+	for _, value := range []string{"image/svg+xml", "text/html", "image/*", "png"} {
+		if _, err := parseInlineTypes(value); err == nil {
+			t.Errorf("Expected %q to be refused", value)
+		}
+	}
+}
+
+func TestPlainText_ReadAsFile(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.InlineTypes = []string{"image/png"} })
+	read := func(filename string) *httptest.ResponseRecorder {
+		rec := createPlainText(t, srv, "", "file content", nil)
+		u, _ := url.Parse(strings.TrimSpace(rec.Body.String()))
+		req := httptest.NewRequest("GET", "/api/secrets/"+strings.TrimPrefix(u.Path, "/s/")+"?filename="+url.QueryEscape(filename), nil)
+		req.Header.Set("Accept", "text/plain")
+		req.Header.Set(SecretKeyHeader, u.Fragment)
+		rec = httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct{ filename, contentType, disposition string }{
+		{"photo.png", "image/png", `inline; filename=photo.png`},
+		{"page.html", "application/octet-stream", `attachment; filename=page.html`},
+		{"../notes.txt", "application/octet-stream", `attachment; filename=notes.txt`},
+		{"bericht für dich.pdf", "application/octet-stream", `attachment; filename*=utf-8''bericht%20f%C3%BCr%20dich.pdf`},
+	}
+	for _, tt := range tests {
+		rec := read(tt.filename)
+		if rec.Code != http.StatusOK || rec.Body.String() != "file content" {
+			t.Fatalf("Expected the content for %s, got %d %q", tt.filename, rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("Content-Type"); got != tt.contentType {
+			t.Errorf("%s: expected Content-Type %s, got %s", tt.filename, tt.contentType, got)
+		}
+		if got := rec.Header().Get("Content-Disposition"); got != tt.disposition {
+			t.Errorf("%s: expected Content-Disposition %s, got %s", tt.filename, tt.disposition, got)
+		}
+	}
+}
+
+func TestDownloadHeaders_WithoutSecurityHeaders(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.SecurityHeaders.Enabled = false })
+	rec := httptest.NewRecorder()
+	srv.setDownloadHeaders(rec, httptest.NewRequest("GET", "/api/secrets/abc/content?filename=a.html", nil), "text/html")
+
+	if rec.Header().Get("X-Content-Type-Options") != "nosniff" || rec.Header().Get("Content-Type") != "application/octet-stream" {
+		t.Errorf("Expected a nosniff octet-stream download, got %v", rec.Header())
+	}
+	if rec.Header().Get("Content-Disposition") != "attachment; filename=a.html" {
+		t.Errorf("Unexpected Content-Disposition %q", rec.Header().Get("Content-Disposition"))
+	}
+}
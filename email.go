@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	MaxNotifyEmailLength = 254 // Maximum length of a notification email address (RFC 5321)
+	EmailMaxConcurrent   = 8   // Maximum number of emails being sent at once
+)
+
+//go:embed templates/email/*.txt
+var emailTemplatesFS embed.FS
+
+// emailTemplateData is the data available to notification email templates
+type emailTemplateData struct {
+	ID             string
+	Time           string
+	CreatedAt      string
+	ExpiresAt      string
+	ReadsRemaining int
+	Label          string
+	Reference      string
+	Browser        string // Reader's browser family, for read receipts
+	OS             string
+	Country        string
+	ClientIP       string // Requester's address and User-Agent, for canary alerts
+	UserAgent      string
+	Signature      string // Signature clamd matched and the sender's creator hash, for quarantine alerts
+	CreatorHash    string
+
+	Link               string // Link to the secret without its key, in link emails
+	PassphraseRequired bool
+	PINRequired        bool
+}
+
+// validateEmailAddress checks that addr, given in the named request field, is a single bare
+// email address
+func validateEmailAddress(field, addr string) error {
+	if len(addr) > MaxNotifyEmailLength {
+		return fmt.Errorf("%s exceeds maximum length of %d characters", field, MaxNotifyEmailLength)
+	}
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil || parsed.Address != addr {
+		return fmt.Errorf("%s must be a valid email address", field)
+	}
+	return nil
+}
+
+// EmailNotifier sends read-receipt and expiry emails to senders who asked for them, and
+// secret links to recipients
+type EmailNotifier struct {
+	config    SMTPConfig
+	templates *template.Template
+	send      func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+	slots     chan struct{}
+	wg        sync.WaitGroup
+}
+
+// NewEmailNotifier creates a notifier using the given SMTP settings
+func NewEmailNotifier(config SMTPConfig) (*EmailNotifier, error) {
+	tmpl, err := template.ParseFS(emailTemplatesFS, "templates/email/*.txt")
+	if err != nil {
+		return nil, err
+	}
+	return &EmailNotifier{
+		config:    config,
+		templates: tmpl,
+		send:      smtp.SendMail,
+		slots:     make(chan struct{}, EmailMaxConcurrent),
+	}, nil
+}
+
+// HandleEvent sends an email for read, expiry, expiry reminder and canary events on secrets
+// with a notify address. Safe to use as a store listener.
+func (n *EmailNotifier) HandleEvent(event SecretEvent) {
+	if event.NotifyEmail == "" || (event.Type != StatusRead && event.Type != StatusExpired && event.Type != EventExpiring && event.Type != EventCanary) {
+		return
+	}
+
+	data := emailTemplateData{
+		ID:             event.ID,
+		Time:           event.Time.UTC().Format("2006-01-02 15:04:05 UTC"),
+		CreatedAt:      event.CreatedAt.UTC().Format("2006-01-02 15:04:05 UTC"),
+		ExpiresAt:      event.ExpiresAt.UTC().Format("2006-01-02 15:04:05 UTC"),
+		ReadsRemaining: event.ReadsRemaining,
+		Label:          event.Label,
+		Reference:      event.Reference,
+	}
+	if reader := event.Reader; reader != nil {
+		data.Browser, data.OS, data.Country = reader.Browser, reader.OS, reader.Country
+	}
+	if hit := event.Canary; hit != nil {
+		data.ClientIP, data.UserAgent, data.Country = hit.ClientIP, hit.UserAgent, hit.Country
+	}
+	n.queue(event.NotifyEmail, string(event.Type)+".txt", data)
+}
+
+// queue sends the named template to a single recipient in the background
+func (n *EmailNotifier) queue(to, name string, data emailTemplateData) {
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		n.slots <- struct{}{}
+		defer func() { <-n.slots }()
+
+		if err := n.sendTemplate(to, name, data); err != nil {
+			slog.Warn("Failed to send notification email", "template", name, "error", err)
+		}
+	}()
+}
+
+// sendTemplate renders the named template and sends it to a single recipient
+func (n *EmailNotifier) sendTemplate(to, name string, data emailTemplateData) error {
+	var rendered bytes.Buffer
+	if err := n.templates.ExecuteTemplate(&rendered, name, data); err != nil {
+		return err
+	}
+
+	// Templates start with their own header lines, followed by a blank line and the body
+	headers, body, found := strings.Cut(rendered.String(), "\n\n")
+	if !found {
+		return fmt.Errorf("email template %s has no header section", name)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	for _, line := range strings.Split(headers, "\n") {
+		// Translated subjects need encoding, plain ASCII ones are left as they are
+		if subject, ok := strings.CutPrefix(line, "Subject: "); ok {
+			line = "Subject: " + mime.QEncoding.Encode("UTF-8", subject)
+		}
+		fmt.Fprintf(&msg, "%s\r\n", line)
+	}
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("Auto-Submitted: auto-generated\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if n.config.Username != "" {
+		auth = smtp.PlainAuth("", n.config.Username, n.config.Password, n.config.Host)
+	}
+
+	return n.send(n.config.Addr(), auth, n.config.From, []string{to}, msg.Bytes())
+}
+
+// Close waits for queued emails to be sent
+func (n *EmailNotifier) Close() {
+	n.wg.Wait()
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/smtp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type sentEmail struct {
+	addr string
+	from string
+	to   []string
+	msg  string
+}
+
+func newTestEmailNotifier(t *testing.T) (*EmailNotifier, func() []sentEmail) {
+	notifier, err := NewEmailNotifier(SMTPConfig{Host: "mail.example.com", Port: 25, From: "picosend@example.com"})
+	if err != nil {
+		t.Fatalf("Failed to create email notifier: %v", err)
+	}
+
+	var mu sync.Mutex
+	var sent []sentEmail
+	notifier.send = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, sentEmail{addr: addr, from: from, to: to, msg: string(msg)})
+		return nil
+	}
+
+	return notifier, func() []sentEmail {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]sentEmail(nil), sent...)
+	}
+}
+
+func TestEmailNotifier_ReadAndExpired(t *testing.T) {
+	notifier, sent := newTestEmailNotifier(t)
+	testStore := NewSecretStore()
+	testStore.Subscribe(notifier.HandleEvent)
+
+	readID, _ := testStore.StoreWithOptions("top secret content", 24*time.Hour, SecretOptions{NotifyEmail: "sender@example.com", Reference: "OPS-1234"})
+	testStore.StoreWithOptions("top secret content", time.Millisecond, SecretOptions{NotifyEmail: "sender@example.com"})
+	testStore.Store("no notification", 24*time.Hour)
+
+	testStore.Get(readID)
+	time.Sleep(5 * time.Millisecond)
+	testStore.CleanupExpired()
+	notifier.Close()
+
+	emails := sent()
+	if len(emails) != 2 {
+		t.Fatalf("Expected 2 emails, got %d", len(emails))
+	}
+
+	subjects := ""
+	for _, e := range emails {
+		if e.addr != "mail.example.com:25" || e.from != "picosend@example.com" || e.to[0] != "sender@example.com" {
+			t.Errorf("Unexpected envelope: %+v", e)
+		}
+		if strings.Contains(e.msg, "top secret content") {
+			t.Error("Email must never contain secret content")
+		}
+		subjects += e.msg
+	}
+	if !strings.Contains(subjects, "Subject: Your PicoSend secret was viewed") {
+		t.Error("Expected a read notification email")
+	}
+	if !strings.Contains(subjects, "Subject: Your PicoSend secret expired unread") {
+		t.Error("Expected an expiry notification email")
+	}
+	if !strings.Contains(subjects, readID) {
+		t.Error("Expected the secret ID in the read notification")
+	}
+	if !strings.Contains(subjects, "Reference: OPS-1234") || strings.Contains(subjects, "Label:") {
+		t.Error("Expected the reference, and no empty label, in the read notification")
+	}
+}
+
+func TestEmailNotifier_ExpiryReminder(t *testing.T) {
+	notifier, sent := newTestEmailNotifier(t)
+	testStore := NewSecretStore()
+	testStore.Subscribe(notifier.HandleEvent)
+
+	testStore.StoreWithOptions("secret", time.Hour, SecretOptions{NotifyEmail: "sender@example.com", RemindBefore: time.Hour, Label: "VPN"})
+	testStore.CleanupExpired()
+	notifier.Close()
+
+	emails := sent()
+	if len(emails) != 1 || !strings.Contains(emails[0].msg, "Subject: Your PicoSend secret expires soon unread") || !strings.Contains(emails[0].msg, "Label: VPN") {
+		t.Fatalf("Expected a reminder email, got %+v", emails)
+	}
+}
+
+func TestEmailNotifier_IgnoresBurn(t *testing.T) {
+	notifier, sent := newTestEmailNotifier(t)
+	testStore := NewSecretStore()
+	testStore.Subscribe(notifier.HandleEvent)
+
+	id, _ := testStore.StoreWithOptions("secret", 24*time.Hour, SecretOptions{NotifyEmail: "sender@example.com", ManagementToken: "token"})
+	testStore.Burn(id, "token")
+	notifier.Close()
+
+	if len(sent()) != 0 {
+		t.Errorf("Expected no email for a burned secret, got %d", len(sent()))
+	}
+}
+
+func TestValidateEmailAddress(t *testing.T) {
+	valid := []string{"user@example.com", "first.last+tag@sub.example.org"}
+	invalid := []string{"", "not-an-email", "User <user@example.com>", "a@example.com, b@example.com", "user@example.com\r\nBcc: x@example.com"}
+
+	for _, addr := range valid {
+		if err := validateEmailAddress("notify_email", addr); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", addr, err)
+		}
+	}
+	for _, addr := range invalid {
+		if err := validateEmailAddress("notify_email", addr); err == nil {
+			t.Errorf("Expected %q to be invalid", addr)
+		}
+	}
+}
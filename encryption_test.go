@@ -9,16 +9,11 @@ import (
 	"strings"
 	"testing"
 	"time"
-
-	"github.com/gorilla/mux"
 )
 
 // Test that encrypted content is stored as-is without decryption on server
 func TestCreateSecretHandlerWithEncryptedContent(t *testing.T) {
-	// Reset store for clean test
-	store = NewSecretStore()
-
-	// Create a mock encrypted content (base64 encoded with IV prepended)
+	srv := newTestServer(t)
 	// This simulates what the frontend would send
 	testContent := base64.StdEncoding.EncodeToString([]byte("mock encrypted data with iv prefix"))
 
@@ -32,7 +27,7 @@ func TestCreateSecretHandlerWithEncryptedContent(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	createSecretHandler(w, req)
+	srv.createSecretHandler(w, req)
 
 	if w.Code != http.StatusOK {
 		t.Errorf("Expected status 200, got %d", w.Code)
@@ -49,20 +44,19 @@ func TestCreateSecretHandlerWithEncryptedContent(t *testing.T) {
 	}
 
 	// Verify the encrypted content is stored as-is
-	secret, found := store.Get(resp.ID)
+	secret, found := srv.store.Get(resp.ID)
 	if !found {
 		t.Fatal("Secret not found in store")
 	}
 
-	if secret.Content != testContent {
+	if string(secret.Content) != testContent {
 		t.Error("Encrypted content was modified by server")
 	}
 }
 
 // Test that server accepts encrypted content without encryption key
 func TestCreateSecretHandlerNoEncryptionKeyRequired(t *testing.T) {
-	// Reset store for clean test
-	store = NewSecretStore()
+	srv := newTestServer(t)
 
 	testContent := base64.StdEncoding.EncodeToString([]byte("mock encrypted content"))
 
@@ -76,7 +70,7 @@ func TestCreateSecretHandlerNoEncryptionKeyRequired(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	createSecretHandler(w, req)
+	srv.createSecretHandler(w, req)
 
 	if w.Code != http.StatusOK {
 		t.Errorf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
@@ -85,10 +79,7 @@ func TestCreateSecretHandlerNoEncryptionKeyRequired(t *testing.T) {
 
 // Test encrypted content length validation
 func TestEncryptedContentLengthValidation(t *testing.T) {
-	// Reset store for clean test
-	store = NewSecretStore()
-
-	// Create content larger than allowed (MaxSecretLength * 2 for base64)
+	srv := newTestServer(t)
 	largeContent := strings.Repeat("a", MaxSecretLength*2+1)
 	encodedContent := base64.StdEncoding.EncodeToString([]byte(largeContent))
 
@@ -102,19 +93,16 @@ func TestEncryptedContentLengthValidation(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	createSecretHandler(w, req)
+	srv.createSecretHandler(w, req)
 
 	if w.Code != http.StatusBadRequest {
 		t.Errorf("Expected status 400 for oversized content, got %d", w.Code)
 	}
 }
 
-// Test that encrypted content returned by verify endpoint
-func TestVerifySecretHandlerReturnsEncryptedContent(t *testing.T) {
-	// Reset store for clean test
-	store = NewSecretStore()
-
-	// Create a secret with encrypted content via the API
+// Test that encrypted content returned by claim endpoint
+func TestClaimSecretHandlerReturnsEncryptedContent(t *testing.T) {
+	srv := newTestServer(t)
 	testContent := base64.StdEncoding.EncodeToString([]byte("encrypted test content"))
 
 	createReq := CreateSecretRequest{
@@ -127,7 +115,7 @@ func TestVerifySecretHandlerReturnsEncryptedContent(t *testing.T) {
 	createReqHTTP.Header.Set("Content-Type", "application/json")
 	createW := httptest.NewRecorder()
 
-	createSecretHandler(createW, createReqHTTP)
+	srv.createSecretHandler(createW, createReqHTTP)
 
 	if createW.Code != http.StatusOK {
 		t.Fatalf("Failed to create secret, got status %d", createW.Code)
@@ -136,20 +124,8 @@ func TestVerifySecretHandlerReturnsEncryptedContent(t *testing.T) {
 	var createResp CreateSecretResponse
 	json.NewDecoder(createW.Body).Decode(&createResp)
 
-	// Now verify the secret
-	verifyReqBody := VerifySecretRequest{
-		VerificationCode: "ABC123",
-	}
-	verifyJsonBody, _ := json.Marshal(verifyReqBody)
-
-	req := httptest.NewRequest("POST", "/api/secrets/"+createResp.ID+"/verify", bytes.NewBuffer(verifyJsonBody))
-	req.Header.Set("Content-Type", "application/json")
-	w := httptest.NewRecorder()
-
-	// Setup mux vars
-	req = mux.SetURLVars(req, map[string]string{"id": createResp.ID})
-
-	verifySecretHandler(w, req)
+	// Now claim the secret
+	w := claimSecret(t, srv, createResp.ID, ClaimSecretRequest{})
 
 	if w.Code != http.StatusOK {
 		t.Errorf("Expected status 200, got %d", w.Code)
@@ -169,6 +145,8 @@ func TestVerifySecretHandlerReturnsEncryptedContent(t *testing.T) {
 
 // Test empty content validation
 func TestCreateSecretHandlerEmptyContent(t *testing.T) {
+	srv := newTestServer(t)
+
 	reqBody := CreateSecretRequest{
 		Content:  "",
 		Lifetime: 60,
@@ -179,7 +157,7 @@ func TestCreateSecretHandlerEmptyContent(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	createSecretHandler(w, req)
+	srv.createSecretHandler(w, req)
 
 	if w.Code != http.StatusBadRequest {
 		t.Errorf("Expected status 400, got %d", w.Code)
@@ -188,8 +166,7 @@ func TestCreateSecretHandlerEmptyContent(t *testing.T) {
 
 // Test default lifetime when not specified
 func TestCreateSecretHandlerDefaultLifetime(t *testing.T) {
-	// Reset store for clean test
-	store = NewSecretStore()
+	srv := newTestServer(t)
 
 	testContent := base64.StdEncoding.EncodeToString([]byte("test content"))
 
@@ -203,7 +180,7 @@ func TestCreateSecretHandlerDefaultLifetime(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	createSecretHandler(w, req)
+	srv.createSecretHandler(w, req)
 
 	if w.Code != http.StatusOK {
 		t.Errorf("Expected status 200, got %d", w.Code)
@@ -213,7 +190,7 @@ func TestCreateSecretHandlerDefaultLifetime(t *testing.T) {
 	json.NewDecoder(w.Body).Decode(&resp)
 
 	// Verify the secret has the correct expiration (approximately 24 hours)
-	secret, _ := store.Get(resp.ID)
+	secret, _ := srv.store.Get(resp.ID)
 	expectedExpiry := secret.CreatedAt.Add(24 * time.Hour)
 	timeDiff := secret.ExpiresAt.Sub(expectedExpiry)
 
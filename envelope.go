@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const DataKeyLength = 32 // AES-256 data keys, one per secret
+
+var (
+	ErrDecryptionFailed   = errors.New("failed to decrypt stored secret")
+	ErrEncryptionDisabled = errors.New("encryption at rest is not enabled")
+)
+
+// KeyWrapper wraps per-secret data keys under a master key held outside the store
+type KeyWrapper interface {
+	WrapKey(dataKey []byte) ([]byte, error)
+	UnwrapKey(wrapped []byte) ([]byte, error)
+}
+
+// localKeyWrapper wraps data keys with AES-256-GCM under a master key supplied via config
+type localKeyWrapper struct {
+	aead cipher.AEAD
+}
+
+// NewLocalKeyWrapper creates a wrapper from a 32-byte master key
+func NewLocalKeyWrapper(masterKey []byte) (KeyWrapper, error) {
+	aead, err := newGCM(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return &localKeyWrapper{aead: aead}, nil
+}
+
+func (w *localKeyWrapper) WrapKey(dataKey []byte) ([]byte, error) {
+	return sealGCM(w.aead, dataKey, []byte("picosend-data-key"))
+}
+
+func (w *localKeyWrapper) UnwrapKey(wrapped []byte) ([]byte, error) {
+	return openGCM(w.aead, wrapped, []byte("picosend-data-key"))
+}
+
+// EnvelopeEncryptor encrypts secret content at rest with a fresh data key per secret.
+// The content is bound to the secret ID so sealed blobs can't be swapped between secrets.
+type EnvelopeEncryptor struct {
+	wrapper  KeyWrapper
+	previous []KeyWrapper // Master keys being rotated away from, still tried on Open
+}
+
+func NewEnvelopeEncryptor(wrapper KeyWrapper) *EnvelopeEncryptor {
+	return &EnvelopeEncryptor{wrapper: wrapper}
+}
+
+// Seal encrypts content for the given secret ID, returning the sealed content and wrapped data key
+func (e *EnvelopeEncryptor) Seal(id string, content []byte) (sealed, wrappedKey []byte, err error) {
+	dataKey := make([]byte, DataKeyLength)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+	defer wipeBytes(dataKey)
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	sealed, err = sealGCM(aead, content, []byte(id))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wrappedKey, err = e.wrapper.WrapKey(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sealed, wrappedKey, nil
+}
+
+// Open reverses Seal
+func (e *EnvelopeEncryptor) Open(id string, sealed, wrappedKey []byte) ([]byte, error) {
+	dataKey, err := e.unwrapKey(wrappedKey)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	defer wipeBytes(dataKey)
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	content, err := openGCM(aead, sealed, []byte(id))
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return content, nil
+}
+
+// unwrapKey unwraps a data key with the current master key, then with the previous ones
+func (e *EnvelopeEncryptor) unwrapKey(wrappedKey []byte) ([]byte, error) {
+	dataKey, err := e.wrapper.UnwrapKey(wrappedKey)
+	for _, previous := range e.previous {
+		if err == nil {
+			break
+		}
+		dataKey, err = previous.UnwrapKey(wrappedKey)
+	}
+	return dataKey, err
+}
+
+// Rotate returns an encryptor that seals under wrapper's master key and still opens
+// everything e opens
+func (e *EnvelopeEncryptor) Rotate(wrapper KeyWrapper) *EnvelopeEncryptor {
+	return &EnvelopeEncryptor{wrapper: wrapper, previous: append([]KeyWrapper{e.wrapper}, e.previous...)}
+}
+
+// Rewrap wraps a data key under the current master key. It returns nil when the key already
+// is, so an interrupted rotation can be run again.
+func (e *EnvelopeEncryptor) Rewrap(wrappedKey []byte) ([]byte, error) {
+	if dataKey, err := e.wrapper.UnwrapKey(wrappedKey); err == nil {
+		wipeBytes(dataKey)
+		return nil, nil
+	}
+	for _, previous := range e.previous {
+		dataKey, err := previous.UnwrapKey(wrappedKey)
+		if err != nil {
+			continue
+		}
+		defer wipeBytes(dataKey)
+		return e.wrapper.WrapKey(dataKey)
+	}
+	return nil, ErrDecryptionFailed
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealGCM encrypts with a random nonce, returning nonce||ciphertext
+func sealGCM(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// openGCM decrypts nonce||ciphertext produced by sealGCM
+func openGCM(aead cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed data too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// wipeBytes zeroes b in place
+func wipeBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// loadMasterKey reads a base64-encoded 32-byte master key from value, or from the file at path
+func loadMasterKey(value, path string) ([]byte, error) {
+	if value == "" && path == "" {
+		return nil, nil
+	}
+	if value != "" && path != "" {
+		return nil, errors.New("set only one of encryption-key and encryption-key-file")
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading encryption key file: %w", err)
+		}
+		value = strings.TrimSpace(string(data))
+	}
+
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(key) != DataKeyLength {
+		return nil, fmt.Errorf("encryption key must be %d bytes, base64 encoded", DataKeyLength)
+	}
+	return key, nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestEncryptor(t *testing.T) *EnvelopeEncryptor {
+	wrapper, err := NewLocalKeyWrapper(bytes.Repeat([]byte{42}, DataKeyLength))
+	if err != nil {
+		t.Fatalf("Failed to create key wrapper: %v", err)
+	}
+	return NewEnvelopeEncryptor(wrapper)
+}
+
+func TestEnvelopeEncryptor_RoundTrip(t *testing.T) {
+	encryptor := newTestEncryptor(t)
+
+	sealed, wrappedKey, err := encryptor.Seal("id1", []byte("ciphertext from client"))
+	if err != nil {
+		t.Fatalf("Failed to seal: %v", err)
+	}
+	if bytes.Contains(sealed, []byte("ciphertext from client")) {
+		t.Error("Sealed content must not contain the original content")
+	}
+
+	content, err := encryptor.Open("id1", sealed, wrappedKey)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	if string(content) != "ciphertext from client" {
+		t.Errorf("Expected original content, got %q", content)
+	}
+}
+
+func TestEnvelopeEncryptor_BoundToID(t *testing.T) {
+	encryptor := newTestEncryptor(t)
+
+	sealed, wrappedKey, _ := encryptor.Seal("id1", []byte("content"))
+
+	if _, err := encryptor.Open("id2", sealed, wrappedKey); err != ErrDecryptionFailed {
+		t.Errorf("Expected sealed content to be bound to its ID, got %v", err)
+	}
+}
+
+func TestEnvelopeEncryptor_WrongMasterKey(t *testing.T) {
+	sealed, wrappedKey, _ := newTestEncryptor(t).Seal("id1", []byte("content"))
+
+	otherWrapper, _ := NewLocalKeyWrapper(bytes.Repeat([]byte{7}, DataKeyLength))
+	if _, err := NewEnvelopeEncryptor(otherWrapper).Open("id1", sealed, wrappedKey); err != ErrDecryptionFailed {
+		t.Errorf("Expected decryption with another master key to fail, got %v", err)
+	}
+}
+
+func TestSecretStore_EncryptionAtRest(t *testing.T) {
+	store := NewSecretStore()
+	store.SetEncryptor(newTestEncryptor(t))
+
+	id, err := store.Store("client ciphertext", 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to store secret: %v", err)
+	}
+
+	raw := store.shardFor(id).secrets[keyOf(id)]
+	if strings.Contains(string(raw.Content), "client ciphertext") || raw.WrappedKey == nil {
+		t.Error("Expected content to be sealed in memory")
+	}
+
+	secret, found := store.Get(id)
+	if !found {
+		t.Fatal("Expected to find the secret")
+	}
+	if string(secret.Content) != "client ciphertext" {
+		t.Errorf("Expected decrypted content, got %q", secret.Content)
+	}
+}
+
+func TestLoadMasterKey(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, DataKeyLength))
+
+	if key, err := loadMasterKey("", ""); key != nil || err != nil {
+		t.Errorf("Expected no key when unset, got %v %v", key, err)
+	}
+
+	if key, err := loadMasterKey(encoded, ""); err != nil || len(key) != DataKeyLength {
+		t.Errorf("Expected valid key, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "key")
+	os.WriteFile(path, []byte(encoded+"\n"), 0600)
+	if key, err := loadMasterKey("", path); err != nil || len(key) != DataKeyLength {
+		t.Errorf("Expected valid key from file, got %v", err)
+	}
+
+	if _, err := loadMasterKey("dG9vIHNob3J0", ""); err == nil {
+		t.Error("Expected error for short key")
+	}
+	if _, err := loadMasterKey(encoded, path); err == nil {
+		t.Error("Expected error when both key and key file are set")
+	}
+}
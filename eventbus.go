@@ -0,0 +1,442 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	EventBusSchemaVersion = 1 // Bumped whenever a field of BusEvent changes meaning or goes away
+	DefaultEventBusTopic  = "picosend.events"
+	EventBusQueueSize     = 10000            // Events held while the bus is unreachable
+	EventBusTimeout       = 10 * time.Second // Timeout for connecting and for one publish
+	EventBusMaxBackoff    = 30 * time.Second // Longest delay between publish attempts
+	EventBusShutdownGrace = 5 * time.Second  // Time allowed for queued events on shutdown
+
+	EventCreated SecretStatus = "created" // Only an event; created secrets are unread
+)
+
+// eventBusTopicChars are the characters allowed in topics, valid for both NATS and Kafka
+const eventBusTopicChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789._-"
+
+// EventBusConfig selects the message bus secret events are published to
+type EventBusConfig struct {
+	URL   string // nats://, tls:// or kafka+http(s):// for a Kafka REST proxy; "" disables the bus
+	Topic string // NATS subject or Kafka topic
+}
+
+// Enabled reports whether an event bus is configured
+func (c EventBusConfig) Enabled() bool {
+	return c.URL != ""
+}
+
+// Validate checks the bus URL has a known scheme and the topic is usable on it
+func (c EventBusConfig) Validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil || u.Host == "" {
+		return errors.New("event-bus must be a nats://, tls://, kafka+http:// or kafka+https:// URL")
+	}
+	switch u.Scheme {
+	case "nats", "tls", "kafka+http", "kafka+https":
+	default:
+		return fmt.Errorf("unknown event-bus scheme %q (expected nats, tls, kafka+http or kafka+https)", u.Scheme)
+	}
+	if c.Topic == "" || strings.Trim(c.Topic, eventBusTopicChars) != "" || strings.HasPrefix(c.Topic, ".") || strings.HasSuffix(c.Topic, ".") {
+		return errors.New("event-bus-topic must be letters, digits, dots, dashes and underscores")
+	}
+	return nil
+}
+
+// BusEvent is the JSON payload published for every secret event. It never includes secret
+// content, passphrases, labels or client addresses. Consumers should check SchemaVersion and
+// deduplicate on EventID, as an event can be delivered more than once.
+type BusEvent struct {
+	SchemaVersion  int            `json:"schema_version"`
+	EventID        string         `json:"event_id"`
+	Type           string         `json:"type"` // created, read, expired, burned, evicted, blocked, destroyed, expiring or canary
+	SecretID       string         `json:"secret_id"`
+	Time           string         `json:"time"`
+	CreatedAt      string         `json:"created_at,omitempty"`
+	ExpiresAt      string         `json:"expires_at,omitempty"`
+	ReadsRemaining int            `json:"reads_remaining"`
+	Reader         *WebhookReader `json:"reader,omitempty"` // Only for read, when reader details are enabled
+}
+
+// busPublisher sends one payload to a topic and returns once the bus has accepted it
+type busPublisher interface {
+	Publish(ctx context.Context, topic, key string, payload []byte) error
+	Close() error
+}
+
+type queuedEvent struct {
+	key     string
+	payload []byte
+}
+
+// EventBus publishes secret events to a message bus with at-least-once delivery: an event
+// leaves the queue only once the bus acknowledged it, and is retried until then. Events are
+// published one at a time, in the order they happened.
+type EventBus struct {
+	publisher      busPublisher
+	topic          string
+	queue          chan queuedEvent
+	initialBackoff time.Duration
+	pending        atomic.Int64 // Events queued or being published
+	dropped        sync.Once
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewEventBus creates the publisher for the configured bus and starts delivering events
+func NewEventBus(cfg EventBusConfig) (*EventBus, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	u, _ := url.Parse(cfg.URL)
+	var publisher busPublisher
+	if strings.HasPrefix(u.Scheme, "kafka+") {
+		publisher = newKafkaRESTPublisher(u)
+	} else {
+		publisher = &natsPublisher{url: u}
+	}
+	return newEventBus(publisher, cfg.Topic, time.Second), nil
+}
+
+func newEventBus(publisher busPublisher, topic string, initialBackoff time.Duration) *EventBus {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &EventBus{
+		publisher:      publisher,
+		topic:          topic,
+		queue:          make(chan queuedEvent, EventBusQueueSize),
+		initialBackoff: initialBackoff,
+		ctx:            ctx,
+		cancel:         cancel,
+		done:           make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// HandleEvent queues the event for publishing. It never blocks: when the bus has been down
+// long enough to fill the queue, new events are dropped. Safe to use as a store listener.
+func (b *EventBus) HandleEvent(event SecretEvent) {
+	if b == nil {
+		return
+	}
+	payload := BusEvent{
+		SchemaVersion:  EventBusSchemaVersion,
+		EventID:        generateEventID(),
+		Type:           string(event.Type),
+		SecretID:       event.ID,
+		Time:           event.Time.UTC().Format(time.RFC3339Nano),
+		ReadsRemaining: event.ReadsRemaining,
+	}
+	if !event.CreatedAt.IsZero() {
+		payload.CreatedAt = event.CreatedAt.UTC().Format(time.RFC3339)
+	}
+	if !event.ExpiresAt.IsZero() {
+		payload.ExpiresAt = event.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	if reader := event.Reader; reader != nil && reader.Browser+reader.Country != "" {
+		payload.Reader = &WebhookReader{Country: reader.Country, Browser: reader.Browser, OS: reader.OS}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("Failed to encode bus event", "error", err)
+		return
+	}
+
+	b.pending.Add(1)
+	select {
+	case b.queue <- queuedEvent{key: event.ID, payload: body}:
+	default:
+		b.pending.Add(-1)
+		b.dropped.Do(func() { slog.Error("Event bus queue is full, dropping events", "size", EventBusQueueSize) })
+	}
+}
+
+// RecordCreated publishes the creation of a secret, which the store doesn't emit an event for
+func (b *EventBus) RecordCreated(secret *Secret) {
+	if b == nil || secret == nil {
+		return
+	}
+	b.HandleEvent(SecretEvent{
+		Type:           EventCreated,
+		ID:             secret.ID,
+		Time:           secret.CreatedAt,
+		CreatedAt:      secret.CreatedAt,
+		ExpiresAt:      secret.ExpiresAt,
+		ReadsRemaining: secret.ReadsRemaining,
+	})
+}
+
+// run publishes queued events in order, retrying each with exponential backoff until the bus
+// accepts it or the bus is closed
+func (b *EventBus) run() {
+	defer close(b.done)
+	for {
+		select {
+		case event := <-b.queue:
+			b.deliver(event)
+			b.pending.Add(-1)
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
+
+func (b *EventBus) deliver(event queuedEvent) {
+	backoff := b.initialBackoff
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(b.ctx, EventBusTimeout)
+		err := b.publisher.Publish(ctx, b.topic, event.key, event.payload)
+		cancel()
+		if err == nil {
+			return
+		}
+		if attempt == 1 || attempt%10 == 0 {
+			slog.Warn("Event bus publish failed, retrying", "attempts", attempt, "error", err)
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff = min(backoff*2, EventBusMaxBackoff)
+		case <-b.ctx.Done():
+			return
+		}
+	}
+}
+
+// Close gives queued events up to EventBusShutdownGrace to be published, then stops and
+// reports how many were left unpublished
+func (b *EventBus) Close() {
+	if b == nil {
+		return
+	}
+	deadline := time.Now().Add(EventBusShutdownGrace)
+	for b.pending.Load() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if count := b.pending.Load(); count > 0 {
+		slog.Warn("Event bus closed with unpublished events", "count", count)
+	}
+	b.cancel()
+	<-b.done
+	b.publisher.Close()
+}
+
+// generateEventID returns a random ID consumers deduplicate redelivered events on
+func generateEventID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// natsPublisher publishes over the NATS client protocol. Each publish is followed by a PING
+// and completes on the server's PONG, which the server only sends after processing the
+// publish. For delivery to survive a NATS restart, capture the subject in a JetStream stream.
+type natsPublisher struct {
+	url *url.URL
+
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// connect dials the server, upgrading to TLS for tls:// URLs or when the server requires it,
+// and authenticates with the URL's user and password, or its user as a token
+func (p *natsPublisher) connect(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", p.url.Host)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	reader := bufio.NewReader(conn)
+
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	info, ok := strings.CutPrefix(strings.TrimSpace(line), "INFO ")
+	if !ok {
+		conn.Close()
+		return fmt.Errorf("unexpected greeting from NATS server: %q", line)
+	}
+	var server struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	json.Unmarshal([]byte(info), &server)
+	if p.url.Scheme == "tls" || server.TLSRequired {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: p.url.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return err
+		}
+		conn, reader = tlsConn, bufio.NewReader(tlsConn)
+	}
+
+	options := map[string]any{"verbose": false, "pedantic": false, "name": "picosend", "lang": "go", "version": Version, "protocol": 1}
+	if user := p.url.User; user != nil {
+		if pass, ok := user.Password(); ok {
+			options["user"], options["pass"] = user.Username(), pass
+		} else {
+			options["auth_token"] = user.Username()
+		}
+	}
+	connect, _ := json.Marshal(options)
+	p.conn, p.reader = conn, reader
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		p.Close()
+		return err
+	}
+	if err := p.awaitPong(); err != nil {
+		p.Close()
+		return err
+	}
+	return nil
+}
+
+// awaitPong reads until the server's PONG, answering its PINGs and failing on -ERR
+func (p *natsPublisher) awaitPong() error {
+	for {
+		line, err := p.reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		switch line = strings.TrimSpace(line); {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := p.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS server error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+func (p *natsPublisher) Publish(ctx context.Context, topic, key string, payload []byte) error {
+	if p.conn == nil {
+		if err := p.connect(ctx); err != nil {
+			return err
+		}
+	}
+	deadline, _ := ctx.Deadline()
+	p.conn.SetDeadline(deadline)
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "PUB %s %d\r\n", topic, len(payload))
+	msg.Write(payload)
+	msg.WriteString("\r\nPING\r\n")
+	_, err := p.conn.Write(msg.Bytes())
+	if err == nil {
+		err = p.awaitPong()
+	}
+	if err != nil {
+		// Reconnect on the next attempt rather than reading a half-finished exchange
+		p.Close()
+	}
+	return err
+}
+
+func (p *natsPublisher) Close() error {
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn, p.reader = nil, nil
+	return err
+}
+
+// kafkaRESTPublisher produces to Kafka through a Confluent-compatible REST proxy (API v2).
+// Events are keyed by secret ID, so a secret's events land on one partition in order.
+type kafkaRESTPublisher struct {
+	endpoint string
+	user     *url.Userinfo
+	client   *http.Client
+}
+
+func newKafkaRESTPublisher(u *url.URL) *kafkaRESTPublisher {
+	endpoint := *u
+	endpoint.Scheme = strings.TrimPrefix(u.Scheme, "kafka+")
+	endpoint.User = nil
+	return &kafkaRESTPublisher{
+		endpoint: strings.TrimSuffix(endpoint.String(), "/"),
+		user:     u.User,
+		client:   &http.Client{Timeout: EventBusTimeout},
+	}
+}
+
+// kafkaRecords is the body of a REST proxy produce request
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+func (p *kafkaRESTPublisher) Publish(ctx context.Context, topic, key string, payload []byte) error {
+	body, _ := json.Marshal(kafkaRecords{Records: []kafkaRecord{{Key: key, Value: payload}}})
+	req, err := http.NewRequestWithContext(ctx, "POST", p.endpoint+"/topics/"+url.PathEscape(topic), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	if p.user != nil {
+		pass, _ := p.user.Password()
+		req.SetBasicAuth(p.user.Username(), pass)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Kafka REST proxy returned status %d", resp.StatusCode)
+	}
+	// The proxy answers 200 even when the broker rejected a record
+	var result struct {
+		Offsets []struct {
+			ErrorCode *int   `json:"error_code"`
+			Error     string `json:"error"`
+		} `json:"offsets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("invalid Kafka REST proxy response: %w", err)
+	}
+	if len(result.Offsets) != 1 {
+		return errors.New("Kafka REST proxy did not acknowledge the record")
+	}
+	if offset := result.Offsets[0]; offset.ErrorCode != nil {
+		return fmt.Errorf("Kafka rejected the record: %s", offset.Error)
+	}
+	return nil
+}
+
+func (p *kafkaRESTPublisher) Close() error {
+	return nil
+}
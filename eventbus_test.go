@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeNATS accepts NATS clients and collects what they publish
+type fakeNATS struct {
+	listener net.Listener
+	mu       sync.Mutex
+	connects []string
+	messages []string
+}
+
+func newFakeNATS(t *testing.T) *fakeNATS {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	n := &fakeNATS{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go n.serve(conn)
+		}
+	}()
+	return n
+}
+
+func (n *fakeNATS) serve(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprint(conn, "INFO {\"server_id\":\"test\"}\r\n")
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case fields[0] == "CONNECT":
+			n.mu.Lock()
+			n.connects = append(n.connects, strings.TrimSpace(strings.TrimPrefix(line, "CONNECT")))
+			n.mu.Unlock()
+		case fields[0] == "PING":
+			fmt.Fprint(conn, "PONG\r\n")
+		case fields[0] == "PUB":
+			var size int
+			fmt.Sscan(fields[len(fields)-1], &size)
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			n.mu.Lock()
+			n.messages = append(n.messages, fields[1]+" "+string(payload[:size]))
+			n.mu.Unlock()
+		}
+	}
+}
+
+func (n *fakeNATS) received() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.messages...)
+}
+
+func TestEventBus_NATS(t *testing.T) {
+	nats := newFakeNATS(t)
+	bus, err := NewEventBus(EventBusConfig{URL: "nats://user:pass@" + nats.listener.Addr().String(), Topic: "secrets.events"})
+	if err != nil {
+		t.Fatalf("Failed to create bus: %v", err)
+	}
+	bus.HandleEvent(SecretEvent{Type: StatusRead, ID: "abc", Time: time.Now(), ReadsRemaining: 1})
+	bus.HandleEvent(SecretEvent{Type: StatusBurned, ID: "abc", Time: time.Now()})
+	bus.Close()
+
+	messages := nats.received()
+	if len(messages) != 2 || !strings.HasPrefix(messages[0], "secrets.events ") {
+		t.Fatalf("Expected two events on the subject, got %v", messages)
+	}
+	var event BusEvent
+	json.Unmarshal([]byte(strings.TrimPrefix(messages[0], "secrets.events ")), &event)
+	if event.SchemaVersion != EventBusSchemaVersion || event.Type != "read" || event.SecretID != "abc" || event.EventID == "" || event.ReadsRemaining != 1 {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	nats.mu.Lock()
+	defer nats.mu.Unlock()
+	if !strings.Contains(nats.connects[0], `"user":"user"`) {
+		t.Errorf("Expected the URL's credentials in CONNECT, got %s", nats.connects[0])
+	}
+}
+
+func TestEventBus_RetriesUntilAccepted(t *testing.T) {
+	var mu sync.Mutex
+	var attempts int
+	var records []kafkaRecord
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if user, pass, _ := r.BasicAuth(); user != "svc" || pass != "secret" || r.URL.Path != "/topics/picosend.events" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch attempts {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			fmt.Fprint(w, `{"offsets":[{"partition":null,"offset":null,"error_code":50003,"error":"broker unavailable"}]}`)
+		default:
+			var body kafkaRecords
+			json.NewDecoder(r.Body).Decode(&body)
+			records = append(records, body.Records...)
+			fmt.Fprint(w, `{"offsets":[{"partition":0,"offset":1,"error_code":null,"error":null}]}`)
+		}
+	}))
+	defer proxy.Close()
+
+	cfg := EventBusConfig{URL: strings.Replace(proxy.URL, "http://", "kafka+http://svc:secret@", 1), Topic: DefaultEventBusTopic}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected a valid config, got %v", err)
+	}
+	u, _ := url.Parse(cfg.URL)
+	bus := newEventBus(newKafkaRESTPublisher(u), cfg.Topic, time.Millisecond)
+	bus.HandleEvent(SecretEvent{Type: StatusExpired, ID: "abc", Time: time.Now()})
+	bus.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 3 || len(records) != 1 || records[0].Key != "abc" {
+		t.Errorf("Expected the event published on the third attempt keyed by secret ID, got %d attempts %+v", attempts, records)
+	}
+}
+
+func TestServer_PublishesToEventBus(t *testing.T) {
+	nats := newFakeNATS(t)
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.EventBus = EventBusConfig{URL: "nats://" + nats.listener.Addr().String(), Topic: DefaultEventBusTopic}
+	})
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("POST", "/api/secrets", strings.NewReader(`{"content":"top secret","lifetime":5}`)))
+	var resp CreateSecretResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	srv.store.Get(resp.ID)
+	srv.eventBus.Close()
+
+	var types []string
+	for _, message := range nats.received() {
+		var event BusEvent
+		json.Unmarshal([]byte(strings.TrimPrefix(message, DefaultEventBusTopic+" ")), &event)
+		if strings.Contains(message, "top secret") {
+			t.Error("Expected no content in bus events")
+		}
+		types = append(types, event.Type)
+	}
+	if strings.Join(types, ",") != "created,read" {
+		t.Errorf("Expected created and read events, got %v", types)
+	}
+}
+
+func TestLoadConfig_EventBus(t *testing.T) {
+	cfg, err := loadConfig(nil, envMap(map[string]string{"EVENT_BUS": "nats://nats:4222"}))
+	if err != nil || cfg.EventBus.Topic != DefaultEventBusTopic {
+		t.Fatalf("Expected the default topic, got %+v %v", cfg.EventBus, err)
+	}
+
+	for _, env := range []map[string]string{
+		{"EVENT_BUS": "amqp://rabbit:5672"},
+		{"EVENT_BUS": "nats://"},
+		{"EVENT_BUS": "nats://nats:4222", "EVENT_BUS_TOPIC": "secrets events"},
+		{"EVENT_BUS": "kafka+https://proxy", "EVENT_BUS_TOPIC": ".events"},
+	} {
+		if _, err := loadConfig(nil, envMap(env)); err == nil || !strings.Contains(err.Error(), "event-bus") {
+			t.Errorf("Expected an event-bus error for %v, got %v", env, err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import "time"
+
+// EventExpiring is emitted once for a secret that is still unread its sender's reminder time
+// before it expires. It is only an event; the secret's status stays unread.
+const EventExpiring SecretStatus = "expiring"
+
+// SecretEvent describes a lifecycle change of a secret. It never carries secret content.
+type SecretEvent struct {
+	Type           SecretStatus // The status the secret moved to, EventExpiring or EventCanary
+	ID             string
+	Time           time.Time
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+	ReadsRemaining int
+	Webhook        *Webhook    // Sender's webhook registration, nil if none
+	NotifyEmail    string      // Sender's address for email notifications, empty if none
+	Label          string      // Sender's label, for receipts
+	Reference      string      // Sender's reference, for receipts
+	Reader         *ReadRecord // Summary of the reader for read events, nil otherwise
+	Canary         *CanaryHit  // Who revealed a canary, for canary events only
+}
+
+// Subscribe registers fn to be called for every secret event.
+// fn is called while a shard lock is held, so it must not block or call back into the store.
+func (s *SecretStore) Subscribe(fn func(SecretEvent)) {
+	s.updateSettings(func(settings *storeSettings) { settings.listeners = append(settings.listeners, fn) })
+}
+
+// emit builds an event for the secret and passes it to all listeners.
+// Must be called with the secret's shard lock held so events for a secret stay in order.
+func (s *SecretStore) emit(eventType SecretStatus, id string, secret *Secret, now time.Time) {
+	s.emitCanary(eventType, id, secret, now, nil)
+}
+
+// emitCanary is emit with the details of a canary hit, nil for other events
+func (s *SecretStore) emitCanary(eventType SecretStatus, id string, secret *Secret, now time.Time, hit *CanaryHit) {
+	listeners := s.settings.Load().listeners
+	if len(listeners) == 0 {
+		return
+	}
+	// Every node sees a secret expire, the node it was created on reports it
+	if secret.Replica && (eventType == StatusExpired || eventType == EventExpiring) {
+		return
+	}
+
+	event := SecretEvent{
+		Type:           eventType,
+		ID:             id,
+		Time:           now,
+		CreatedAt:      secret.CreatedAt,
+		ExpiresAt:      secret.ExpiresAt,
+		ReadsRemaining: secret.ReadsRemaining,
+		Webhook:        secret.Webhook,
+		NotifyEmail:    secret.NotifyEmail,
+		Label:          secret.Label,
+		Reference:      secret.Reference,
+		Canary:         hit,
+	}
+	if eventType == StatusRead && len(secret.Reads) > 0 {
+		reader := secret.Reads[len(secret.Reads)-1]
+		event.Reader = &reader
+	}
+	for _, fn := range listeners {
+		fn(event)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Eviction policies decide what happens to a create when the store is full
+const (
+	EvictionReject        = "reject"         // Refuse new secrets until there is room
+	EvictionSoonestExpiry = "soonest-expiry" // Evict the secrets that would expire first
+	EvictionOldest        = "oldest"         // Evict the secrets created first
+)
+
+// validateEvictionPolicy checks that policy is one of the known eviction policies
+func validateEvictionPolicy(policy string) error {
+	switch policy {
+	case EvictionReject, EvictionSoonestExpiry, EvictionOldest:
+		return nil
+	}
+	return fmt.Errorf("invalid eviction policy %q (expected %s, %s or %s)", policy, EvictionReject, EvictionSoonestExpiry, EvictionOldest)
+}
+
+// SetEvictionPolicy chooses what happens to new secrets when the store is full
+func (s *SecretStore) SetEvictionPolicy(policy string) {
+	s.updateSettings(func(settings *storeSettings) { settings.evictionPolicy = policy })
+}
+
+// evictFor removes one secret to make room for content of size bytes, as chosen by the
+// eviction policy. Expired secrets are removed first, as expired. Returns false if nothing
+// was removed, because the policy is reject, the store is empty or the content exceeds the
+// whole memory budget.
+func (s *SecretStore) evictFor(size int, limits Limits) bool {
+	policy := s.settings.Load().evictionPolicy
+	if policy == "" || policy == EvictionReject || (limits.MaxStoreBytes > 0 && size > limits.MaxStoreBytes) {
+		return false
+	}
+
+	// A candidate may be read or burned between the scan and taking its shard's lock, in
+	// which case there is room anyway or another candidate is picked
+	for attempt := 0; attempt < 3; attempt++ {
+		id, found := s.evictionCandidate(policy)
+		if !found {
+			return false
+		}
+		sh, key := s.shardFor(id), keyOf(id)
+		sh.mu.Lock()
+		secret, exists := sh.secrets[key]
+		if exists {
+			status := StatusEvicted
+			if time.Now().After(secret.ExpiresAt) {
+				status = StatusExpired
+			}
+			s.remove(sh, id, secret, status)
+		}
+		sh.mu.Unlock()
+		if exists {
+			return true
+		}
+	}
+	return false
+}
+
+// evictionCandidate returns the ID of the secret policy would evict next, preferring
+// secrets that have already expired
+func (s *SecretStore) evictionCandidate(policy string) (string, bool) {
+	var (
+		candidate string
+		rank      time.Time
+	)
+	now := time.Now()
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for _, secret := range sh.secrets {
+			var r time.Time // Expired secrets rank first
+			switch {
+			case now.After(secret.ExpiresAt):
+			case policy == EvictionSoonestExpiry:
+				r = secret.ExpiresAt
+			default:
+				r = secret.CreatedAt
+			}
+			if candidate == "" || r.Before(rank) {
+				candidate, rank = secret.ID, r
+			}
+		}
+		sh.mu.Unlock()
+	}
+	return candidate, candidate != ""
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expiryEntry is a time a secret in a shard is due for a look: its expiry or its reminder
+type expiryEntry struct {
+	at  time.Time
+	key secretKey
+}
+
+// expiryQueue is a min-heap of due times, so a cleanup sweep only visits the secrets whose
+// time has come instead of every secret in the shard. Entries aren't removed when a secret
+// is read, deleted or has its expiry moved; they are dropped when they come up and the
+// secret is gone or not actually due, which keeps every store operation O(log n) at most.
+type expiryQueue []expiryEntry
+
+func (q expiryQueue) Len() int           { return len(q) }
+func (q expiryQueue) Less(i, j int) bool { return q[i].at.Before(q[j].at) }
+func (q expiryQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *expiryQueue) Push(x any)        { *q = append(*q, x.(expiryEntry)) }
+
+func (q *expiryQueue) Pop() any {
+	old := *q
+	entry := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return entry
+}
+
+// scheduleExpiry queues the secret's expiry and pending reminder. Must be called with sh.mu
+// held whenever either time is set or moved.
+func (sh *storeShard) scheduleExpiry(key secretKey, secret *Secret) {
+	heap.Push(&sh.expiries, expiryEntry{at: secret.ExpiresAt, key: key})
+	if !secret.RemindAt.IsZero() {
+		heap.Push(&sh.expiries, expiryEntry{at: secret.RemindAt, key: key})
+	}
+}
+
+// nextDue pops entries due before now until one points to a stored secret and returns it.
+// A secret with several entries due is returned for each; checking it again is harmless.
+// Must be called with sh.mu held.
+func (sh *storeShard) nextDue(now time.Time) (*Secret, bool) {
+	for len(sh.expiries) > 0 && sh.expiries[0].at.Before(now) {
+		entry := heap.Pop(&sh.expiries).(expiryEntry)
+		if secret, ok := sh.secrets[entry.key]; ok {
+			return secret, true
+		}
+	}
+	return nil, false
+}
+
+// compactExpiries rebuilds the queue from the stored secrets once entries left behind by
+// reads and deletes outnumber the live ones, so early reads can't grow it without bound.
+// Must be called with sh.mu held.
+func (sh *storeShard) compactExpiries() {
+	if len(sh.expiries) <= 2*len(sh.secrets)+64 {
+		return
+	}
+	sh.expiries = sh.expiries[:0]
+	for key, secret := range sh.secrets {
+		sh.expiries = append(sh.expiries, expiryEntry{at: secret.ExpiresAt, key: key})
+		if !secret.RemindAt.IsZero() {
+			sh.expiries = append(sh.expiries, expiryEntry{at: secret.RemindAt, key: key})
+		}
+	}
+	heap.Init(&sh.expiries)
+}
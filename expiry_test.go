@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSecretStore_CleanupFollowsMovedExpiry(t *testing.T) {
+	store := NewSecretStore()
+	early, _ := store.StoreWithOptions("early", time.Hour, SecretOptions{ManagementToken: "token"})
+	late, _ := store.StoreWithOptions("late", 50*time.Millisecond, SecretOptions{ManagementToken: "token"})
+
+	// Moving an expiry earlier is picked up by the next sweep, moving it later outlives the old entry
+	secret, _ := store.Peek(early)
+	if err := store.SetExpiry(early, "token", secret.CreatedAt.Add(50*time.Millisecond), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	secret, _ = store.Peek(late)
+	if err := store.SetExpiry(late, "token", secret.CreatedAt.Add(time.Hour), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if cleaned := store.CleanupExpired(); cleaned != 1 {
+		t.Errorf("Expected 1 secret cleaned, got %d", cleaned)
+	}
+	if _, found := store.Peek(early); found {
+		t.Error("Expected the secret with the earlier expiry to be gone")
+	}
+	if _, found := store.Peek(late); !found {
+		t.Error("Expected the secret with the later expiry to be kept")
+	}
+}
+
+func TestSecretStore_ExpiryQueueCompacts(t *testing.T) {
+	store := newShardedSecretStore(1)
+	for i := 0; i < 500; i++ {
+		id, _ := store.Store("secret", time.Hour)
+		store.Get(id)
+	}
+	kept, _ := store.Store("secret", time.Hour)
+
+	store.CleanupExpired()
+	sh := store.shardFor(kept)
+	if len(sh.expiries) != 1 {
+		t.Errorf("Expected entries of read secrets to be dropped, %d left", len(sh.expiries))
+	}
+	if _, found := store.Peek(kept); !found {
+		t.Error("Expected the unread secret to be kept")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"math"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Bounds of generated passwords, in characters, and passphrases, in words
+const (
+	DefaultPasswordLength   = 20
+	MinPasswordLength       = 8
+	MaxPasswordLength       = 128
+	DefaultPassphraseWords  = 8
+	MinPassphraseWords      = 6
+	MaxPassphraseWords      = 32
+	passwordSymbols         = "!#$%&*+-.:;=?@^_~"
+	passwordLetters         = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	passwordDigits          = "0123456789"
+	PassphraseWordSeparator = "-"
+)
+
+type GeneratedPasswordResponse struct {
+	Password    string `json:"password"`
+	EntropyBits int    `json:"entropy_bits"` // Approximate strength against an attacker who knows the settings
+}
+
+// randomIndex returns a uniformly random index below n
+func randomIndex(n int) int {
+	i, _ := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	return int(i.Int64())
+}
+
+// generatePassword returns length random characters from letters and digits, and symbols if
+// asked for, with at least one of each so it passes common composition rules
+func generatePassword(length int, symbols bool) string {
+	classes := []string{passwordLetters, passwordDigits}
+	if symbols {
+		classes = append(classes, passwordSymbols)
+	}
+	alphabet := strings.Join(classes, "")
+
+	password := make([]byte, length)
+	for {
+		for i := range password {
+			password[i] = alphabet[randomIndex(len(alphabet))]
+		}
+		complete := true
+		for _, class := range classes {
+			complete = complete && strings.ContainsAny(string(password), class)
+		}
+		if complete {
+			return string(password)
+		}
+	}
+}
+
+// generatePassphrase returns words picked at random from the embedded wordlist
+func generatePassphrase(words int) string {
+	picked := make([]string, words)
+	for i := range picked {
+		picked[i] = idWords[randomIndex(len(idWords))]
+	}
+	return strings.Join(picked, PassphraseWordSeparator)
+}
+
+// queryInt parses an integer query parameter, returning fallback when it is absent
+func queryInt(r *http.Request, name string, fallback int) (int, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, true
+	}
+	n, err := strconv.Atoi(value)
+	return n, err == nil
+}
+
+// generatePasswordHandler returns a random password, with symbols unless symbols=false.
+// The password is never stored or logged; the client encrypts it like any other secret.
+func (srv *Server) generatePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	length, ok := queryInt(r, "length", DefaultPasswordLength)
+	if !ok || length < MinPasswordLength || length > MaxPasswordLength {
+		localizedError(w, r, http.StatusBadRequest, "error.password_length_range", MinPasswordLength, MaxPasswordLength)
+		return
+	}
+	symbols := true
+	if value := r.URL.Query().Get("symbols"); value != "" {
+		var err error
+		if symbols, err = strconv.ParseBool(value); err != nil {
+			localizedError(w, r, http.StatusBadRequest, "error.password_symbols_invalid")
+			return
+		}
+	}
+
+	alphabet := len(passwordLetters) + len(passwordDigits)
+	if symbols {
+		alphabet += len(passwordSymbols)
+	}
+	writeGeneratedPassword(w, generatePassword(length, symbols), float64(length)*math.Log2(float64(alphabet)))
+}
+
+// generatePassphraseHandler returns a passphrase of random words from the embedded wordlist
+func (srv *Server) generatePassphraseHandler(w http.ResponseWriter, r *http.Request) {
+	words, ok := queryInt(r, "words", DefaultPassphraseWords)
+	if !ok || words < MinPassphraseWords || words > MaxPassphraseWords {
+		localizedError(w, r, http.StatusBadRequest, "error.passphrase_words_range", MinPassphraseWords, MaxPassphraseWords)
+		return
+	}
+	writeGeneratedPassword(w, generatePassphrase(words), float64(words)*math.Log2(float64(len(idWords))))
+}
+
+func writeGeneratedPassword(w http.ResponseWriter, password string, entropyBits float64) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(GeneratedPasswordResponse{Password: password, EntropyBits: int(entropyBits)})
+}
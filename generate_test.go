@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGeneratePasswordHandler(t *testing.T) {
+	router := newTestServer(t).routes()
+
+	get := func(path string) (*httptest.ResponseRecorder, GeneratedPasswordResponse) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		var resp GeneratedPasswordResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return rec, resp
+	}
+
+	rec, resp := get("/api/generate/password")
+	if rec.Code != http.StatusOK || len(resp.Password) != DefaultPasswordLength || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("Expected a %d character password, got %d %+v", DefaultPasswordLength, rec.Code, resp)
+	}
+	if !strings.ContainsAny(resp.Password, passwordSymbols) || !strings.ContainsAny(resp.Password, passwordDigits) {
+		t.Errorf("Expected symbols and digits in %q", resp.Password)
+	}
+	if _, again := get("/api/generate/password"); again.Password == resp.Password {
+		t.Error("Expected a different password each time")
+	}
+
+	rec, resp = get("/api/generate/password?length=12&symbols=false")
+	if rec.Code != http.StatusOK || len(resp.Password) != 12 || strings.ContainsAny(resp.Password, passwordSymbols) {
+		t.Errorf("Expected 12 characters without symbols, got %d %+v", rec.Code, resp)
+	}
+	if resp.EntropyBits != 71 {
+		t.Errorf("Expected 71 bits for 12 alphanumeric characters, got %d", resp.EntropyBits)
+	}
+
+	for _, query := range []string{"length=7", "length=129", "length=long", "symbols=maybe"} {
+		if rec, _ := get("/api/generate/password?" + query); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestGeneratePassphraseHandler(t *testing.T) {
+	router := newTestServer(t).routes()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/generate/passphrase?words=10", nil))
+	var resp GeneratedPasswordResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	words := strings.Split(resp.Password, PassphraseWordSeparator)
+	if rec.Code != http.StatusOK || len(words) != 10 || resp.EntropyBits != 80 {
+		t.Fatalf("Expected 10 words with 80 bits, got %d %+v", rec.Code, resp)
+	}
+	for _, word := range words {
+		if !idWordIndex[word] {
+			t.Errorf("Expected %q to come from the wordlist", word)
+		}
+	}
+
+	for _, words := range []string{"5", "33"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/generate/passphrase?words="+words, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("words=%s: expected status 400, got %d", words, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+)
+
+// GeoIPDB looks up the country of IP addresses in a MaxMind DB file, such as GeoLite2 Country
+// or City, see https://maxmind.github.io/MaxMind-DB/. The file is read into memory once.
+type GeoIPDB struct {
+	tree       []byte // Binary search tree
+	section    []byte // Data section records point into
+	nodeCount  uint
+	recordSize uint
+	ipv4Start  uint // Node reached by the ::/96 prefix IPv4 addresses live under in IPv6 trees
+	ipVersion  uint
+}
+
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+var errMMDBInvalid = errors.New("invalid MaxMind DB")
+
+// OpenGeoIPDB reads and checks a MaxMind DB file
+func OpenGeoIPDB(path string) (*GeoIPDB, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := newGeoIPDB(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return db, nil
+}
+
+func newGeoIPDB(data []byte) (*GeoIPDB, error) {
+	start := bytes.LastIndex(data, mmdbMetadataMarker)
+	if start < 0 {
+		return nil, errMMDBInvalid
+	}
+	metadata := data[start+len(mmdbMetadataMarker):]
+	value, _, err := (&mmdbDecoder{data: metadata}).decode(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := value.(map[string]any)
+	if !ok {
+		return nil, errMMDBInvalid
+	}
+	uintField := func(name string) uint {
+		v, _ := fields[name].(uint64)
+		return uint(v)
+	}
+
+	db := &GeoIPDB{
+		nodeCount:  uintField("node_count"),
+		recordSize: uintField("record_size"),
+		ipVersion:  uintField("ip_version"),
+	}
+	if db.recordSize != 24 && db.recordSize != 28 && db.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported record size %d", db.recordSize)
+	}
+	treeSize := db.nodeCount * db.recordSize / 4
+	if db.nodeCount == 0 || treeSize+16 > uint(start) {
+		return nil, errMMDBInvalid
+	}
+	db.tree = data[:treeSize]
+	db.section = data[treeSize+16 : start]
+
+	if db.ipVersion == 6 {
+		for i := 0; i < 96 && db.ipv4Start < db.nodeCount; i++ {
+			db.ipv4Start = db.record(db.ipv4Start, 0)
+		}
+	}
+	return db, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a node
+func (db *GeoIPDB) record(node, bit uint) uint {
+	b := db.tree[node*db.recordSize/4:]
+	switch db.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// Country returns the ISO 3166-1 code of the country addr is located in, falling back to the
+// country the network is registered in. Returns "" for unknown addresses.
+func (db *GeoIPDB) Country(addr netip.Addr) string {
+	if db == nil || !addr.IsValid() {
+		return ""
+	}
+	addr = addr.Unmap()
+
+	var ip []byte
+	node := uint(0)
+	switch {
+	case addr.Is4() && db.ipVersion == 6:
+		ip, node = addr.AsSlice(), db.ipv4Start
+	case addr.Is4() || db.ipVersion == 6:
+		ip = addr.AsSlice()
+	default:
+		return "" // IPv6 address in an IPv4-only database
+	}
+
+	for i := 0; i < len(ip)*8 && node < db.nodeCount; i++ {
+		node = db.record(node, uint(ip[i/8]>>(7-i%8)&1))
+	}
+	if node <= db.nodeCount {
+		return ""
+	}
+
+	value, _, err := (&mmdbDecoder{data: db.section}).decode(node-db.nodeCount-16, 0)
+	if err != nil {
+		return ""
+	}
+	fields, _ := value.(map[string]any)
+	for _, name := range []string{"country", "registered_country"} {
+		country, _ := fields[name].(map[string]any)
+		if code, ok := country["iso_code"].(string); ok {
+			return code
+		}
+	}
+	return ""
+}
+
+// mmdbDecoder decodes values of the MaxMind DB data section format
+type mmdbDecoder struct {
+	data []byte
+}
+
+// mmdbMaxDepth bounds nesting, so a malformed file can't recurse without end
+const mmdbMaxDepth = 32
+
+// decode returns the value at offset and the offset following it
+func (d *mmdbDecoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > mmdbMaxDepth || offset >= uint(len(d.data)) {
+		return nil, 0, errMMDBInvalid
+	}
+	control := d.data[offset]
+	offset++
+	kind := uint(control >> 5)
+
+	if kind == 1 { // Pointer, followed to the value it points at
+		size := uint(control>>3) & 0x3
+		if offset+size+1 > uint(len(d.data)) {
+			return nil, 0, errMMDBInvalid
+		}
+		b := d.data[offset : offset+size+1]
+		var target uint
+		switch size {
+		case 0:
+			target = uint(control&0x7)<<8 | uint(b[0])
+		case 1:
+			target = (uint(control&0x7)<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+		case 2:
+			target = (uint(control&0x7)<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+		default:
+			target = uint(binary.BigEndian.Uint32(b))
+		}
+		value, _, err := d.decode(target, depth+1)
+		return value, offset + size + 1, err
+	}
+
+	if kind == 0 { // Extended type in the next byte
+		if offset >= uint(len(d.data)) {
+			return nil, 0, errMMDBInvalid
+		}
+		kind = 7 + uint(d.data[offset])
+		offset++
+	}
+
+	size := uint(control & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(d.data)) {
+			return nil, 0, errMMDBInvalid
+		}
+		extra := uint(0)
+		for _, b := range d.data[offset : offset+n] {
+			extra = extra<<8 | uint(b)
+		}
+		size = []uint{29, 285, 65821}[n-1] + extra
+		offset += n
+	}
+
+	switch kind {
+	case 7: // Map
+		m := make(map[string]any, min(size, 64))
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			value, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, errMMDBInvalid
+			}
+			m[name] = value
+			offset = next
+		}
+		return m, offset, nil
+	case 11: // Array
+		a := make([]any, 0, min(size, 64))
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	case 14: // Boolean, held in the size
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(d.data)) {
+		return nil, 0, errMMDBInvalid
+	}
+	b := d.data[offset : offset+size]
+	offset += size
+	switch kind {
+	case 2: // UTF-8 string
+		return string(b), offset, nil
+	case 3: // Double
+		if size != 8 {
+			return nil, 0, errMMDBInvalid
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case 15: // Float
+		if size != 4 {
+			return nil, 0, errMMDBInvalid
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case 5, 6, 8, 9, 10: // Unsigned and signed integers, big-endian without leading zeros
+		if size > 16 {
+			return nil, 0, errMMDBInvalid
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c) // uint128 values are truncated, none are used here
+		}
+		return v, offset, nil
+	case 4: // Bytes
+		return b, offset, nil
+	}
+	return nil, 0, errMMDBInvalid
+}
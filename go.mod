@@ -3,3 +3,8 @@ module picosend
 go 1.21
 
 require github.com/gorilla/mux v1.8.0
+
+require (
+	golang.org/x/crypto v0.24.0
+	golang.org/x/sys v0.21.0
+)
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	MaxReadGracePeriod = 5 * time.Minute // Longest configurable grace period after a secret's last read
+	MinBurnTokenLength = 16              // Burn tokens are chosen by the client, so short ones are refused
+	MaxBurnTokenLength = 128
+)
+
+// retainedSecret is a secret whose last read was released but that is kept for the grace
+// period, so a recipient whose response was cut off or garbled can fetch it again. It holds
+// the content as the client sent it, still end-to-end encrypted, and stays charged to the
+// store's count and memory budget until it is wiped.
+type retainedSecret struct {
+	secret    *Secret  // Copy holding the content in protected memory
+	burnToken [32]byte // SHA-256 of the token the recipient fetches the content again with
+	until     time.Time
+	size      int // Bytes charged to the memory budget
+}
+
+// Retain keeps the content of a secret whose last read was just released until the grace
+// period ends, for whoever holds burnToken. The secret is already marked read. secret is
+// the copy returned by Get and stays owned by the caller. The read just gave back the secret's
+// slot and bytes, so they are charged again without checking the limits: the content never
+// left memory.
+func (s *SecretStore) Retain(secret *Secret, burnToken string, until time.Time) {
+	buffer := newLockedBuffer(secret.Content)
+	retained := &retainedSecret{
+		secret: &Secret{
+			ID:        secret.ID,
+			Content:   buffer.Bytes(),
+			Type:      secret.Type,
+			CreatedAt: secret.CreatedAt,
+			Recipient: secret.Recipient,
+			buffer:    buffer,
+		},
+		burnToken: sha256.Sum256([]byte(burnToken)),
+		until:     until,
+		size:      len(secret.Content),
+	}
+	s.count.Add(1)
+	s.bytes.Add(int64(retained.size))
+
+	sh, key := s.shardFor(secret.ID), keyOf(secret.ID)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if previous, ok := sh.retained[key]; ok {
+		s.dropRetained(sh, key, previous)
+	}
+	sh.retained[key] = retained
+}
+
+// Reread returns a copy of a retained secret's content, provided the burn token matches and
+// the grace period hasn't ended. It can be fetched again until then.
+func (s *SecretStore) Reread(id, burnToken string, now time.Time) (*Secret, bool) {
+	sh, key := s.shardFor(id), keyOf(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	retained, ok := sh.retained[key]
+	if !ok {
+		return nil, false
+	}
+	if now.After(retained.until) {
+		s.dropRetained(sh, key, retained)
+		return nil, false
+	}
+	if !checkTokenHash(retained.burnToken, burnToken) {
+		return nil, false
+	}
+	secret := retained.secret
+	return &Secret{
+		ID:        secret.ID,
+		Content:   append([]byte(nil), secret.Content...),
+		Type:      secret.Type,
+		CreatedAt: secret.CreatedAt,
+		Recipient: secret.Recipient,
+	}, true
+}
+
+// Discard wipes a retained secret before its grace period ends, once the recipient has
+// decrypted it. Returns false if there is nothing retained for id and burnToken.
+func (s *SecretStore) Discard(id, burnToken string) bool {
+	sh, key := s.shardFor(id), keyOf(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	retained, ok := sh.retained[key]
+	if !ok || !checkTokenHash(retained.burnToken, burnToken) {
+		return false
+	}
+	s.dropRetained(sh, key, retained)
+	return true
+}
+
+// pruneRetained wipes retained secrets whose grace period has ended. Must be called with sh.mu held.
+func (s *SecretStore) pruneRetained(sh *storeShard, now time.Time) {
+	for key, retained := range sh.retained {
+		if now.After(retained.until) {
+			s.dropRetained(sh, key, retained)
+		}
+	}
+}
+
+// dropRetained wipes a retained secret and frees its share of the budget. Must be called with
+// sh.mu held.
+func (s *SecretStore) dropRetained(sh *storeShard, key secretKey, retained *retainedSecret) {
+	wipeSecret(retained.secret)
+	delete(sh.retained, key)
+	s.count.Add(-1)
+	s.bytes.Add(-int64(retained.size))
+}
+
+// validBurnToken reports whether a client-chosen burn token is long enough to be unguessable
+func validBurnToken(token string) bool {
+	return len(token) >= MinBurnTokenLength && len(token) <= MaxBurnTokenLength
+}
+
+// burnToken returns the burn token sent as "Authorization: Bearer <token>"
+func burnToken(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token, ok && token != ""
+}
+
+// rereadSecretHandler returns a secret's content again during the grace period after its
+// last read, to the recipient holding the burn token sent with the claim
+func (srv *Server) rereadSecretHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	token, ok := burnToken(r)
+	if !ok {
+		localizedError(w, r, http.StatusUnauthorized, "error.burn_token_required")
+		return
+	}
+
+	secret, found := srv.store.Reread(id, token, time.Now())
+	if !found {
+		localizedError(w, r, http.StatusNotFound, "error.not_found")
+		return
+	}
+	writeSecret(w, secret, time.Time{})
+}
+
+// discardSecretHandler wipes a secret's retained content before the grace period ends
+func (srv *Server) discardSecretHandler(w http.ResponseWriter, r *http.Request) {
+	token, ok := burnToken(r)
+	if !ok {
+		localizedError(w, r, http.StatusUnauthorized, "error.burn_token_required")
+		return
+	}
+	if !srv.store.Discard(mux.Vars(r)["id"], token) {
+		localizedError(w, r, http.StatusNotFound, "error.not_found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkDownload replies with an error and returns false when a download claim can't be served:
+// the content is only kept for the grace period, under the burn token, and only for the last
+// read, since a secret keeps a single retained copy and other readers' copies must not be
+// replaced
+func (srv *Server) checkDownload(w http.ResponseWriter, r *http.Request, meta *Secret, burnToken string) bool {
+	if srv.config.ReadGracePeriod <= 0 {
+		localizedError(w, r, http.StatusBadRequest, "error.download_unavailable")
+		return false
+	}
+	if burnToken == "" {
+		localizedError(w, r, http.StatusBadRequest, "error.burn_token_required")
+		return false
+	}
+	if meta.ReadsRemaining > 1 {
+		localizedError(w, r, http.StatusBadRequest, "error.download_last_read")
+		return false
+	}
+	return true
+}
+
+// startDownload answers a download claim: the last read is used up, and the content is retained
+// for the grace period instead of being sent, so a slow or flaky connection can fetch it in parts
+func (srv *Server) startDownload(w http.ResponseWriter, secret *Secret, burnToken string) {
+	defer wipeSecret(secret)
+	retainedUntil := time.Now().Add(srv.config.ReadGracePeriod)
+	srv.store.Retain(secret, burnToken, retainedUntil)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(GetSecretResponse{
+		Type:                 secret.Type,
+		CreatedAt:            secret.CreatedAt.Format("2006-01-02 15:04:05 UTC"),
+		ReadsRemaining:       secret.ReadsRemaining,
+		RecipientFingerprint: secret.Recipient,
+		RetainedUntil:        retainedUntil.UTC().Format(time.RFC3339),
+		ContentLength:        len(secret.Content),
+	})
+}
+
+// downloadSecretHandler serves retained content as raw bytes to the holder of the burn token,
+// with Range requests so an interrupted download resumes where it stopped. It doesn't use up
+// anything: the content stays until the grace period ends or the client discards it.
+func (srv *Server) downloadSecretHandler(w http.ResponseWriter, r *http.Request) {
+	token, ok := burnToken(r)
+	if !ok {
+		localizedError(w, r, http.StatusUnauthorized, "error.burn_token_required")
+		return
+	}
+
+	secret, found := srv.store.Reread(mux.Vars(r)["id"], token, time.Now())
+	if !found {
+		localizedError(w, r, http.StatusNotFound, "error.not_found")
+		return
+	}
+	defer wipeSecret(secret)
+
+	// The ETag lets If-Range tell a resumed download apart from different content
+	sum := sha256.Sum256(secret.Content)
+	w.Header().Set("ETag", `"`+base64.RawURLEncoding.EncodeToString(sum[:12])+`"`)
+	// The content is still end-to-end encrypted, there is nothing a browser could show
+	srv.setDownloadHeaders(w, r, "application/octet-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(secret.Content))
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSecretStore_Retain(t *testing.T) {
+	store := NewSecretStore()
+	id, _ := store.Store("ciphertext", time.Hour)
+	secret, _ := store.Get(id)
+	now := time.Now()
+	store.Retain(secret, "burn-token-0123456789", now.Add(time.Minute))
+	wipeSecret(secret)
+
+	if state, _ := store.Status(id); state.Status != StatusRead {
+		t.Errorf("Expected a retained secret to be reported as read, got %s", state.Status)
+	}
+	if _, ok := store.Reread(id, "wrong-token-0123456789", now); ok {
+		t.Error("Expected a wrong burn token to be refused")
+	}
+	for i := 0; i < 2; i++ {
+		again, ok := store.Reread(id, "burn-token-0123456789", now)
+		if !ok || string(again.Content) != "ciphertext" {
+			t.Fatalf("Expected the retained content on attempt %d, got %v", i, ok)
+		}
+	}
+	if _, ok := store.Reread(id, "burn-token-0123456789", now.Add(2*time.Minute)); ok {
+		t.Error("Expected the content to be gone after the grace period")
+	}
+
+	id, _ = store.Store("ciphertext", time.Hour)
+	secret, _ = store.Get(id)
+	store.Retain(secret, "burn-token-0123456789", now.Add(time.Minute))
+	if !store.Discard(id, "burn-token-0123456789") {
+		t.Fatal("Expected the retained content to be discarded")
+	}
+	if _, ok := store.Reread(id, "burn-token-0123456789", now); ok {
+		t.Error("Expected discarded content to be gone")
+	}
+}
+
+func TestSecretStore_RetainKeepsBudget(t *testing.T) {
+	store := NewSecretStore()
+	store.SetLimits(Limits{MaxUnreadSecrets: 1, MaxStoreBytes: 1 << 20})
+	id, _ := store.Store("ciphertext", time.Hour)
+	secret, _ := store.Get(id)
+	store.Retain(secret, "burn-token-0123456789", time.Now().Add(time.Minute))
+	wipeSecret(secret)
+
+	// The retained content holds its slot and bytes until it is discarded
+	if store.Count() != 1 || store.BytesUsed() != len("ciphertext") {
+		t.Errorf("Expected the retained content charged, got %d secrets and %d bytes", store.Count(), store.BytesUsed())
+	}
+	if _, err := store.Store("ciphertext", time.Hour); err == nil {
+		t.Error("Expected the store to be full while the content is retained")
+	}
+	store.Discard(id, "burn-token-0123456789")
+	if store.Count() != 0 || store.BytesUsed() != 0 {
+		t.Errorf("Expected the budget freed, got %d secrets and %d bytes", store.Count(), store.BytesUsed())
+	}
+
+	// So does content whose grace period ends
+	id, _ = store.Store("ciphertext", time.Hour)
+	secret, _ = store.Get(id)
+	store.Retain(secret, "burn-token-0123456789", time.Now().Add(-time.Second))
+	store.CleanupExpired()
+	if store.Count() != 0 || store.BytesUsed() != 0 {
+		t.Errorf("Expected the budget freed after the grace period, got %d secrets and %d bytes", store.Count(), store.BytesUsed())
+	}
+}
+
+func TestReadGracePeriod(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.ReadGracePeriod = time.Minute })
+	router := srv.routes()
+	id, _ := srv.store.Store("ciphertext", time.Hour)
+	const token = "burn-token-0123456789"
+
+	rec := claimSecret(t, srv, id, ClaimSecretRequest{BurnToken: token})
+	var resp GetSecretResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusOK || resp.RetainedUntil == "" {
+		t.Fatalf("Expected the claim to report the grace period, got %d %+v", rec.Code, resp)
+	}
+
+	retry := func(method, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/secrets/"+id+"/retry", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := retry("POST", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a burn token, got %d", rec.Code)
+	}
+	rec = retry("POST", token)
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusOK || resp.Content != "ciphertext" {
+		t.Fatalf("Expected the content again, got %d %q", rec.Code, resp.Content)
+	}
+	if rec := retry("DELETE", token); rec.Code != http.StatusNoContent {
+		t.Errorf("Expected the retained content to be wiped, got %d", rec.Code)
+	}
+	if rec := retry("POST", token); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 once wiped, got %d", rec.Code)
+	}
+
+	if rec := claimSecret(t, srv, id, ClaimSecretRequest{ClaimToken: "x", BurnToken: "short"}); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected a read secret to stay gone, got %d", rec.Code)
+	}
+	id, _ = srv.store.Store("ciphertext", time.Hour)
+	if rec := claimSecret(t, srv, id, ClaimSecretRequest{BurnToken: "short"}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a short burn token to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestReadGracePeriod_Disabled(t *testing.T) {
+	srv := newTestServer(t)
+	id, _ := srv.store.Store("ciphertext", time.Hour)
+
+	rec := claimSecret(t, srv, id, ClaimSecretRequest{BurnToken: "burn-token-0123456789"})
+	var resp GetSecretResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusOK || resp.RetainedUntil != "" {
+		t.Fatalf("Expected no grace period, got %d %+v", rec.Code, resp)
+	}
+	if _, ok := srv.store.Reread(id, "burn-token-0123456789", time.Now()); ok {
+		t.Error("Expected nothing to be retained")
+	}
+}
+
+func TestDownloadClaim(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.ReadGracePeriod = time.Minute })
+	router := srv.routes()
+	id, _ := srv.store.Store("0123456789abcdef", time.Hour)
+	const token = "burn-token-0123456789"
+
+	rec := claimSecret(t, srv, id, ClaimSecretRequest{BurnToken: token, Download: true})
+	var resp GetSecretResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if rec.Code != http.StatusOK || resp.Content != "" || resp.ContentLength != 16 || resp.RetainedUntil == "" {
+		t.Fatalf("Expected the claim to leave the content for download, got %d %+v", rec.Code, resp)
+	}
+	if _, found := srv.store.Peek(id); found {
+		t.Error("Expected the claim to use up the read")
+	}
+
+	download := func(token string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/secrets/"+id+"/content", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := download("", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without the burn token, got %d", rec.Code)
+	}
+
+	// A cut off download resumes where it stopped
+	rec = download(token, map[string]string{"Range": "bytes=0-9"})
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "0123456789" {
+		t.Fatalf("Expected the first part, got %d %q", rec.Code, rec.Body.String())
+	}
+	rec = download(token, map[string]string{"Range": "bytes=10-", "If-Range": rec.Header().Get("ETag")})
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "abcdef" || rec.Header().Get("Content-Range") != "bytes 10-15/16" {
+		t.Errorf("Expected the rest, got %d %q %v", rec.Code, rec.Body.String(), rec.Header())
+	}
+	if rec := download(token, nil); rec.Code != http.StatusOK || rec.Body.String() != "0123456789abcdef" {
+		t.Errorf("Expected the whole content again, got %d", rec.Code)
+	}
+}
+
+func TestDownloadClaim_OnlyLastRead(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.ReadGracePeriod = time.Minute })
+	id, _ := srv.store.StoreWithOptions("ciphertext", time.Hour, SecretOptions{MaxReads: 2})
+
+	// Another reader's retained copy would be replaced by this one
+	rec := claimSecret(t, srv, id, ClaimSecretRequest{BurnToken: "burn-token-0123456789", Download: true})
+	var body ErrorResponse
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusBadRequest || body.Code != "download_last_read" {
+		t.Errorf("Expected download_last_read, got %d %q", rec.Code, body.Code)
+	}
+	if meta, found := srv.store.Peek(id); !found || meta.ReadsRemaining != 2 {
+		t.Error("Expected the read to be kept")
+	}
+
+	if rec := claimSecret(t, srv, id, ClaimSecretRequest{}); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the first read, got %d", rec.Code)
+	}
+	if rec := claimSecret(t, srv, id, ClaimSecretRequest{BurnToken: "burn-token-0123456789", Download: true}); rec.Code != http.StatusOK {
+		t.Errorf("Expected a download claim of the last read, got %d", rec.Code)
+	}
+}
+
+func TestDownloadClaim_NeedsGracePeriod(t *testing.T) {
+	srv := newTestServer(t)
+	id, _ := srv.store.Store("ciphertext", time.Hour)
+
+	rec := claimSecret(t, srv, id, ClaimSecretRequest{BurnToken: "burn-token-0123456789", Download: true})
+	var body ErrorResponse
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusBadRequest || body.Code != "download_unavailable" {
+		t.Errorf("Expected download_unavailable, got %d %q", rec.Code, body.Code)
+	}
+	if _, found := srv.store.Peek(id); !found {
+		t.Error("Expected the secret to be kept")
+	}
+}
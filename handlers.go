@@ -2,110 +2,894 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 )
 
 type CreateSecretRequest struct {
-	Content  string `json:"content"`
-	Lifetime int    `json:"lifetime"` // Lifetime in minutes
+	Content         string   `json:"content"`
+	Type            string   `json:"type,omitempty"`             // text (default) or credentials
+	Lifetime        int      `json:"lifetime"`                   // Lifetime in minutes
+	PassphraseHash  string   `json:"passphrase_hash,omitempty"`  // Optional client-side hash of a passphrase
+	MaxReads        int      `json:"max_reads,omitempty"`        // Number of reads before deletion (default 1)
+	WebhookURL      string   `json:"webhook_url,omitempty"`      // Optional callback for read/expired/burned events
+	NotifyEmail     string   `json:"notify_email,omitempty"`     // Optional address emailed on read or unread expiry
+	AllowedIPs      []string `json:"allowed_ips,omitempty"`      // Optional CIDR ranges or addresses allowed to retrieve the secret
+	DeniedIPs       []string `json:"denied_ips,omitempty"`       // Optional CIDR ranges or addresses never allowed to retrieve it
+	AllowedReaders  []string `json:"allowed_readers,omitempty"`  // Optional emails or subjects of the single sign-on accounts allowed to retrieve it
+	Chunked         bool     `json:"chunked,omitempty"`          // Content is uploaded separately in chunks and committed
+	NotBefore       string   `json:"not_before,omitempty"`       // Optional RFC 3339 time before which the secret can't be read
+	RequirePIN      bool     `json:"require_pin,omitempty"`      // Generate a pickup PIN the recipient must enter
+	Recipient       string   `json:"recipient,omitempty"`        // Directory name of the recipient the content is encrypted to
+	Label           string   `json:"label,omitempty"`            // Optional non-sensitive note for the sender, never shown to the recipient
+	Reference       string   `json:"reference,omitempty"`        // Optional sender reference such as a ticket number
+	HideAfter       int      `json:"hide_after,omitempty"`       // Seconds the view page shows the revealed content; 0 keeps it shown
+	HoldToView      bool     `json:"hold_to_view,omitempty"`     // The view page only shows the content while a button is held
+	RemindBefore    int      `json:"remind_before,omitempty"`    // Minutes before expiry to notify the sender if still unread
+	DeletionMessage string   `json:"deletion_message,omitempty"` // Optional public note shown once the secret is burned or expired
+	DeliverTo       string   `json:"deliver_to,omitempty"`       // Optional recipient address the server emails the link to, without its key
+	PINPhone        string   `json:"pin_phone,omitempty"`        // Optional E.164 number the pickup PIN is texted to instead of returned; implies require_pin
+	TOTPSecret      string   `json:"totp_secret,omitempty"`      // Optional base32 TOTP seed shared with the recipient; each read needs a current code
+	DeliverLanguage string   `json:"deliver_language,omitempty"` // Language of the email and text; defaults to the sender's Accept-Language
+	MaxAttempts     int      `json:"max_attempts,omitempty"`     // Wrong passphrases, PINs or TOTP codes after which the secret is destroyed; 0 uses the server default
+	Canary          bool     `json:"canary,omitempty"`           // Decoy: reveals don't use up reads but alert the webhook and notify_email with the requester's address
+	Slug            string   `json:"slug,omitempty"`             // Optional custom ID such as a printed pickup name; needs an API key or single sign-on
 }
 
 type CreateSecretResponse struct {
-	ID string `json:"id"`
+	ID              string `json:"id"`
+	ManagementToken string `json:"management_token"`         // Lets the sender burn the secret before it is read
+	WebhookSecret   string `json:"webhook_secret,omitempty"` // HMAC key used to sign webhook payloads
+	PIN             string `json:"pin,omitempty"`            // Pickup PIN to give the recipient out-of-band; returned only here
+	Link            string `json:"link,omitempty"`           // Link with the key, only for text/plain creates where the server chose the key
 }
 
 type GetSecretResponse struct {
-	Content   string `json:"content"`
+	Content              string `json:"content"`
+	Type                 string `json:"type"`
+	CreatedAt            string `json:"created_at"`
+	ReadsRemaining       int    `json:"reads_remaining"`
+	RecipientFingerprint string `json:"recipient_fingerprint,omitempty"` // Set when the content is sealed to a recipient key
+	RetainedUntil        string `json:"retained_until,omitempty"`        // End of the read grace period, set when the content was retained
+	ContentLength        int    `json:"content_length,omitempty"`        // Bytes to download for download claims, which leave Content empty
+}
+
+type ConfigResponse struct {
+	MinLifetime     int   `json:"min_lifetime"`     // Minutes
+	MaxLifetime     int   `json:"max_lifetime"`     // Minutes
+	DefaultLifetime int   `json:"default_lifetime"` // Minutes
+	LifetimeOptions []int `json:"lifetime_options"` // Suggested lifetimes in minutes within the allowed range
+	APIKeyRequired  bool  `json:"api_key_required"` // Creating secrets needs an API key
+	LoginRequired   bool  `json:"login_required"`   // Creating secrets needs an API key or a single sign-on session
+	Demo            bool  `json:"demo,omitempty"`   // Demo mode: lifetimes count seconds instead of minutes
+
+	MaxSecretLength int `json:"max_secret_length"` // Characters of a secret before it is encrypted
+	MaxUploadSize   int `json:"max_upload_size"`   // Encrypted bytes of a secret uploaded in chunks
+
+	Features ConfigFeatures `json:"features"`
+	Policy   *Policy        `json:"policy,omitempty"` // Rules new secrets must follow
+}
+
+// ConfigFeatures reports which optional features of secrets the instance offers, so clients
+// only show the options that will work
+type ConfigFeatures struct {
+	Passphrases        bool `json:"passphrases"`         // Always offered; the policy may require one
+	Uploads            bool `json:"uploads"`             // Large secrets uploaded in chunks
+	Downloads          bool `json:"downloads"`           // Download claims and retries within the read grace period
+	EmailNotifications bool `json:"email_notifications"` // Read receipts and expiry emails to senders with notify_email
+	LinkDelivery       bool `json:"link_delivery"`       // Emailing links to recipients with deliver_to
+	PINTexting         bool `json:"pin_texting"`         // Texting pickup PINs to recipients with pin_phone
+	ReaderDetails      bool `json:"reader_details"`      // Recording who read a secret for its sender
+	AbuseReports       bool `json:"abuse_reports"`       // Reporting secret links to the operator
+}
+
+// UpdateSecretRequest changes a secret on behalf of its sender
+type UpdateSecretRequest struct {
+	ExpiresIn int `json:"expires_in"` // Minutes from now until the secret expires
+}
+
+// lifetimePresets are the lifetimes offered by the web UI, in minutes
+var lifetimePresets = []int{5, 60, 24 * 60, 7 * 24 * 60}
+
+type SecretStatusResponse struct {
+	ID        string `json:"id"`
+	Status    string `json:"status"` // unread, read, expired or burned
 	CreatedAt string `json:"created_at"`
+	ExpiresAt string `json:"expires_at"`
+	ClosedAt  string `json:"closed_at,omitempty"`
+
+	MaxReads       int `json:"max_reads"`
+	ReadsRemaining int `json:"reads_remaining"`
+
+	DeletionMessage string `json:"deletion_message,omitempty"` // Sender's public note for visitors once the secret is gone
+
+	// Only reported when the request carries the secret's management token
+	Label     string         `json:"label,omitempty"`
+	Reference string         `json:"reference,omitempty"`
+	Reads     []ReadResponse `json:"reads,omitempty"`
 }
 
-type VerifySecretRequest struct {
-	VerificationCode string `json:"verification_code"`
+// SecretMetadataResponse describes a secret without releasing or consuming its content
+type SecretMetadataResponse struct {
+	ID                   string `json:"id"`
+	Type                 string `json:"type"`
+	CreatedAt            string `json:"created_at"`
+	ExpiresAt            string `json:"expires_at"`
+	ReadsRemaining       int    `json:"reads_remaining"`
+	PassphraseRequired   bool   `json:"passphrase_required"`
+	PINRequired          bool   `json:"pin_required"`
+	TOTPRequired         bool   `json:"totp_required"`
+	LoginRequired        bool   `json:"login_required"`                  // Only some single sign-on accounts may read the secret
+	NotBefore            string `json:"not_before,omitempty"`            // RFC 3339 time the secret unlocks, if time-locked
+	RecipientFingerprint string `json:"recipient_fingerprint,omitempty"` // Key the content is sealed to, if any
+	ClaimToken           string `json:"claim_token"`                     // One-time token for POST /api/secrets/{id}/claim
+	HideAfter            int    `json:"hide_after,omitempty"`            // Display options the sender chose for the view page
+	HoldToView           bool   `json:"hold_to_view,omitempty"`
 }
 
-func createSecretHandler(w http.ResponseWriter, r *http.Request) {
+type ClaimSecretRequest struct {
+	ClaimToken        string `json:"claim_token"`                  // From GET /api/secrets/{id} or the view page
+	PassphraseHash    string `json:"passphrase_hash,omitempty"`    // Required for passphrase-protected secrets
+	PIN               string `json:"pin,omitempty"`                // Required for secrets created with a pickup PIN
+	TOTP              string `json:"totp,omitempty"`               // Current code for secrets bound to a TOTP seed
+	Challenge         string `json:"challenge,omitempty"`          // Token from GET /api/secrets/{id}/challenge
+	ChallengeSolution string `json:"challenge_solution,omitempty"` // Proof of work or captcha response
+	// Random token chosen by the client to fetch the content again during the read grace period
+	BurnToken string `json:"burn_token,omitempty"`
+	// Leave the content out of the response, to be downloaded from GET /api/secrets/{id}/content
+	// with the burn token during the grace period, resuming with Range requests
+	Download bool `json:"download,omitempty"`
+}
+
+// requestError is a client error to reply with, translated when it has a message key
+type requestError struct {
+	Code    int
+	Key     string // Locale message key, formatted with Args
+	Args    []any
+	Message string // Untranslated message, used when Key is empty
+}
+
+// text returns the error message in locale's language
+func (e *requestError) text(locale *Locale) string {
+	if e.Key == "" {
+		return e.Message
+	}
+	return locale.T(e.Key, e.Args...)
+}
+
+// errorCode returns the code of the error in API responses
+func (e *requestError) errorCode() string {
+	if e.Key == "" {
+		return statusErrorCode(e.Code)
+	}
+	return keyErrorCode(e.Key)
+}
+
+func (e *requestError) reply(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, e.Code, e.errorCode(), e.text(requestLocale(w, r)))
+}
+
+func (srv *Server) createSecretHandler(w http.ResponseWriter, r *http.Request) {
+	apiKey, ok := srv.requestAPIKey(w, r)
+	if !ok {
+		return
+	}
+
+	if isPlainText(r) {
+		srv.createPlainTextSecret(w, r, apiKey)
+		return
+	}
+
 	var req CreateSecretRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		localizedError(w, r, http.StatusBadRequest, "error.invalid_json")
 		return
 	}
 
-	if req.Content == "" {
-		http.Error(w, "Content cannot be empty", http.StatusBadRequest)
+	response, reqErr := srv.createSecret(r, apiKey, req)
+	if reqErr != nil {
+		reqErr.reply(w, r)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// createSecret validates and stores one secret created with apiKey, which may be nil
+func (srv *Server) createSecret(r *http.Request, apiKey *APIKey, req CreateSecretRequest) (CreateSecretResponse, *requestError) {
+	if req.Chunked && req.Content != "" {
+		return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Message: "Content must be uploaded in chunks when chunked is set"}
+	}
+	if req.Content == "" && !req.Chunked {
+		return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Key: "error.content_empty"}
+	}
+
+	// Operators block the networks and content of abusive secrets
+	creator := srv.abuse.CreatorHash(clientAddr(r, srv.config.TrustedProxies))
+	if srv.blockedCreation(Fingerprints{Creator: creator, Content: contentHash([]byte(req.Content))}) {
+		return CreateSecretResponse{}, &requestError{Code: http.StatusForbidden, Key: "error.creation_blocked"}
+	}
+
+	// An API key and its tenant can only tighten the server-wide limits
+	limits := srv.secretLimits(apiKey)
+	var tenant string
+	var tenantLimits TenantLimits
+	if apiKey != nil && apiKey.Tenant != "" {
+		tenant = apiKey.Tenant
+		tenantLimits, _ = srv.tenants.Limits(tenant)
+	}
+
 	// Validate encrypted content length (base64 encoded, so can be larger than plaintext)
-	if len(req.Content) > MaxSecretLength*2 {
-		http.Error(w, fmt.Sprintf("Content exceeds maximum length of %d characters", MaxSecretLength*2), http.StatusBadRequest)
-		return
+	maxLength := limits.MaxSecretLength * 2
+	if len(req.Content) > maxLength {
+		return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Key: "error.content_too_long", Args: []any{maxLength}}
+	}
+
+	// Use the default lifetime if none was specified, otherwise enforce the configured bounds
+	if req.Lifetime == 0 {
+		req.Lifetime = limits.DefaultLifetime
+	}
+	if req.Lifetime < limits.MinLifetime || req.Lifetime > limits.MaxLifetime {
+		return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Key: "error.lifetime_range", Args: []any{limits.MinLifetime, limits.MaxLifetime}}
+	}
+	lifetime := time.Duration(req.Lifetime) * srv.lifetimeUnit()
+
+	if reqErr := srv.policy.Load().Check(req); reqErr != nil {
+		return CreateSecretResponse{}, reqErr
+	}
+
+	if req.Type != "" && req.Type != SecretTypeText && req.Type != SecretTypeCredentials {
+		return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Key: "error.type_invalid", Args: []any{SecretTypeText, SecretTypeCredentials}}
+	}
+
+	if len(req.PassphraseHash) > MaxPassphraseHashLength {
+		return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Key: "error.passphrase_hash_too_long", Args: []any{MaxPassphraseHashLength}}
+	}
+
+	if req.MaxReads < 0 || req.MaxReads > MaxReadsLimit {
+		return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Key: "error.max_reads_range", Args: []any{MaxReadsLimit}}
+	}
+	if req.MaxAttempts < 0 || req.MaxAttempts > MaxAttemptsLimit {
+		return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Key: "error.max_attempts_range", Args: []any{MaxAttemptsLimit}}
+	}
+	if req.MaxAttempts == 0 {
+		req.MaxAttempts = srv.config.MaxAttempts
+	}
+
+	if len(req.Label) > MaxSecretLabelLength {
+		return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Key: "error.label_too_long", Args: []any{MaxSecretLabelLength}}
+	}
+	if len(req.Reference) > MaxSecretLabelLength {
+		return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Key: "error.reference_too_long", Args: []any{MaxSecretLabelLength}}
+	}
+	if len(req.DeletionMessage) > MaxDeletionMessageLength {
+		return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Key: "error.deletion_message_too_long", Args: []any{MaxDeletionMessageLength}}
+	}
+	if req.HideAfter < 0 || req.HideAfter > MaxHideAfter {
+		return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Key: "error.hide_after_range", Args: []any{MaxHideAfter}}
+	}
+
+	if req.RemindBefore != 0 {
+		if req.RemindBefore < 0 || req.RemindBefore >= req.Lifetime {
+			return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Key: "error.remind_before_range", Args: []any{req.Lifetime - 1}}
+		}
+		if req.WebhookURL == "" && req.NotifyEmail == "" {
+			return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Key: "error.remind_before_target"}
+		}
+	}
+	if req.Canary && req.WebhookURL == "" && req.NotifyEmail == "" {
+		return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Key: "error.canary_target"}
+	}
+
+	var slugID string
+	if req.Slug != "" {
+		var reqErr *requestError
+		if slugID, reqErr = srv.reserveSlug(r, apiKey, tenant, strings.ToLower(req.Slug)); reqErr != nil {
+			return CreateSecretResponse{}, reqErr
+		}
+	}
+
+	var notBefore time.Time
+	if req.NotBefore != "" {
+		parsed, err := time.Parse(time.RFC3339, req.NotBefore)
+		if err != nil {
+			return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Key: "error.not_before_invalid"}
+		}
+		// The secret must still exist when it unlocks
+		if !parsed.Before(time.Now().Add(lifetime)) {
+			return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Key: "error.not_before_range"}
+		}
+		notBefore = parsed
+	}
+
+	// Content sealed to a directory key is tagged with its fingerprint, so readers know which
+	// identity opens it
+	var recipient string
+	if req.Recipient != "" {
+		entry, found := srv.recipients.Lookup(strings.ToLower(req.Recipient))
+		if !found {
+			return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Key: "error.recipient_not_found"}
+		}
+		recipient = entry.Fingerprint
+	}
+
+	var webhook *Webhook
+	if req.WebhookURL != "" {
+		if err := validateWebhookURL(req.WebhookURL); err != nil {
+			return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+		webhook = &Webhook{URL: req.WebhookURL, SigningKey: generateToken()}
+	}
+
+	if req.NotifyEmail != "" {
+		if srv.emailNotifier == nil {
+			return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Key: "error.email_disabled"}
+		}
+		if err := validateEmailAddress("notify_email", req.NotifyEmail); err != nil {
+			return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+	}
+
+	if req.DeliverTo != "" {
+		if srv.deliveries == nil {
+			return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Key: "error.delivery_disabled"}
+		}
+		if req.Chunked {
+			return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Key: "error.delivery_chunked"}
+		}
+		if err := validateEmailAddress("deliver_to", req.DeliverTo); err != nil {
+			return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Message: err.Error()}
+		}
 	}
 
-	// Parse lifetime (default to 24 hours if not specified or invalid)
-	lifetime := time.Duration(req.Lifetime) * time.Minute
-	if req.Lifetime <= 0 {
-		lifetime = 24 * time.Hour
+	if req.PINPhone != "" {
+		if srv.messenger == nil {
+			return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Key: "error.sms_disabled"}
+		}
+		if err := validatePhoneNumber(req.PINPhone); err != nil {
+			return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+		req.RequirePIN = true
 	}
 
-	// Store encrypted content as-is (no decryption on server)
-	id, err := store.Store(req.Content, lifetime)
+	var totpSeed []byte
+	if req.TOTPSecret != "" {
+		seed, err := parseTOTPSecret(req.TOTPSecret)
+		if err != nil {
+			return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Message: err.Error()}
+		}
+		totpSeed = seed
+	}
+
+	ipFilter, err := parseIPFilter(req.AllowedIPs, req.DeniedIPs)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+
+	readers, err := parseReaderFilter(req.AllowedReaders)
+	if err != nil {
+		return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if readers != nil && srv.oidc == nil {
+		return CreateSecretResponse{}, &requestError{Code: http.StatusBadRequest, Key: "error.readers_unsupported"}
+	}
+
+	// Counted before the API key quota, which would otherwise need a refund
+	if req.DeliverTo != "" && !srv.deliveries.Allow(clientAddr(r, srv.config.TrustedProxies), req.DeliverTo, time.Now()) {
+		return CreateSecretResponse{}, &requestError{Code: http.StatusTooManyRequests, Key: "error.delivery_limit"}
+	}
+	if req.PINPhone != "" && !srv.smsLimits.Allow(clientAddr(r, srv.config.TrustedProxies), req.PINPhone, time.Now()) {
+		return CreateSecretResponse{}, &requestError{Code: http.StatusTooManyRequests, Key: "error.sms_limit"}
+	}
+	language := req.DeliverLanguage
+	if language == "" {
+		language = r.Header.Get("Accept-Language")
+	}
+	recipientLocale := negotiateLocale(language)
+
+	if apiKey != nil {
+		if err := srv.apiKeys.Consume(apiKey, time.Now()); err != nil {
+			return CreateSecretResponse{}, &requestError{Code: http.StatusTooManyRequests, Key: "error.api_key_quota"}
+		}
+	}
+
+	var pin string
+	if req.RequirePIN {
+		pin = generatePIN()
+	}
+	// A texted PIN is sent before the secret is stored, so a failed text leaves nothing behind
+	// that no one could open
+	if req.PINPhone != "" {
+		if err := srv.messenger.Send(r.Context(), req.PINPhone, recipientLocale.T("sms.pin", pin)); err != nil {
+			if apiKey != nil {
+				srv.apiKeys.Refund(apiKey)
+			}
+			srv.logger.Error("Failed to text pickup PIN", "provider", srv.config.SMS.Provider, "error", err)
+			return CreateSecretResponse{}, &requestError{Code: http.StatusBadGateway, Key: "error.sms_failed"}
+		}
+	}
+
+	opts := SecretOptions{
+		PassphraseHash:  req.PassphraseHash,
+		ManagementToken: generateToken(),
+		MaxReads:        req.MaxReads,
+		Webhook:         webhook,
+		NotifyEmail:     req.NotifyEmail,
+		IPFilter:        ipFilter,
+		Readers:         readers,
+		Type:            req.Type,
+		NotBefore:       notBefore,
+		PIN:             pin,
+		TOTPSecret:      totpSeed,
+		Recipient:       recipient,
+		Tenant:          tenant,
+		TenantMaxUnread: tenantLimits.MaxUnreadSecrets,
+		Label:           req.Label,
+		Reference:       req.Reference,
+		Display:         DisplayOptions{HideAfter: req.HideAfter, HoldToView: req.HoldToView},
+		RemindBefore:    time.Duration(req.RemindBefore) * srv.lifetimeUnit(),
+		DeletionMessage: req.DeletionMessage,
+		CreatorHash:     creator,
+		MaxAttempts:     req.MaxAttempts,
+		Canary:          req.Canary,
+		ID:              slugID,
+		MaxLifetime:     time.Duration(srv.policy.Load().MaxLifetime(req)) * srv.lifetimeUnit(),
+	}
+
+	// Store encrypted content as-is (no decryption on server). Chunked secrets get their
+	// ID now and are stored under it once the upload is committed.
+	var id string
+	if req.Chunked {
+		id = slugID
+		if id == "" {
+			id = srv.store.NewID(tenant)
+		}
+		opts.ID = id
+		err = srv.uploads.Begin(lifetime, opts)
+	} else {
+		id, err = srv.store.StoreWithOptions(req.Content, lifetime, opts)
+	}
+	if err != nil {
+		if apiKey != nil {
+			srv.apiKeys.Refund(apiKey)
+		}
+		switch {
+		case errors.Is(err, ErrIDTaken):
+			// Another create took the slug since it was checked
+			return CreateSecretResponse{}, &requestError{Code: http.StatusConflict, Key: "error.slug_taken"}
+		case errors.Is(err, ErrTenantFull):
+			return CreateSecretResponse{}, &requestError{Code: http.StatusTooManyRequests, Key: "error.tenant_full"}
+		case errors.Is(err, ErrClusterUnavailable):
+			return CreateSecretResponse{}, &requestError{Code: http.StatusServiceUnavailable, Key: "error.cluster_unavailable"}
+		case errors.Is(err, ErrHashingBusy):
+			return CreateSecretResponse{}, &requestError{Code: http.StatusServiceUnavailable, Key: "error.hashing_busy"}
+		case tenant != "":
+			// Tenants share the store, so they aren't told its size or how full it is
+			return CreateSecretResponse{}, &requestError{Code: http.StatusTooManyRequests, Key: "error.store_unavailable"}
+		default:
+			return CreateSecretResponse{}, &requestError{Code: http.StatusTooManyRequests, Message: err.Error()}
+		}
+	}
+
+	if !req.Chunked {
+		srv.recordCreated(r, id)
+	}
+	if req.DeliverTo != "" {
+		srv.deliverLink(req.DeliverTo, recipientLocale, id, time.Now().Add(lifetime), opts)
+	}
+
+	response := CreateSecretResponse{ID: srv.signID(id), ManagementToken: opts.ManagementToken}
+	// A texted PIN isn't returned, so the sender only ever holds the link
+	if req.PINPhone == "" {
+		response.PIN = pin
+	}
+	if webhook != nil {
+		response.WebhookSecret = webhook.SigningKey
+	}
+	return response, nil
+}
+
+// recordCreated audits and counts a secret that was stored and is now readable
+func (srv *Server) recordCreated(r *http.Request, id string) {
+	srv.audit(r, AuditEventCreated, id)
+	srv.tenants.RecordCreated(id)
+	srv.metrics.RecordCreated(time.Now())
+	if srv.eventBus != nil {
+		secret, _ := srv.store.Peek(id)
+		srv.eventBus.RecordCreated(secret)
+	}
+}
+
+// getSecretHandler returns a secret's metadata and a one-time claim token. Without the key it
+// never releases or consumes content, so link scanners fetching it can't burn the secret; only
+// a text/plain request carrying the key in X-Secret-Key uses up a read, see readPlainText.
+func (srv *Server) getSecretHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	meta, found := srv.store.Peek(id)
+	if !found {
+		localizedError(w, r, http.StatusNotFound, "error.not_found")
+		return
+	}
+	if negotiate(r, "application/json", "text/plain") == "text/plain" {
+		srv.readPlainText(w, r, id, meta)
 		return
 	}
 
+	response := SecretMetadataResponse{
+		ID:                   srv.signID(meta.ID),
+		Type:                 meta.Type,
+		CreatedAt:            meta.CreatedAt.UTC().Format("2006-01-02 15:04:05 UTC"),
+		ExpiresAt:            meta.ExpiresAt.UTC().Format("2006-01-02 15:04:05 UTC"),
+		ReadsRemaining:       meta.ReadsRemaining,
+		PassphraseRequired:   meta.Passphrase != nil,
+		PINRequired:          meta.PIN != nil,
+		TOTPRequired:         meta.TOTP != nil,
+		LoginRequired:        meta.Readers != nil,
+		RecipientFingerprint: meta.Recipient,
+		ClaimToken:           srv.claims.Issue(id, time.Now()),
+		HideAfter:            meta.Display.HideAfter,
+		HoldToView:           meta.Display.HoldToView,
+	}
+	if !meta.NotBefore.IsZero() {
+		response.NotBefore = meta.NotBefore.UTC().Format(time.RFC3339)
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(CreateSecretResponse{ID: id})
+	json.NewEncoder(w).Encode(response)
 }
 
-func getSecretHandler(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
+// claimSecretHandler releases a secret's content in exchange for a claim token, consuming a read
+func (srv *Server) claimSecretHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
 
-	secret, found := store.Get(id)
+	var req ClaimSecretRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "error.invalid_json")
+		return
+	}
+
+	meta, found := srv.store.Peek(id)
 	if !found {
-		http.Error(w, "Secret not found", http.StatusNotFound)
+		localizedError(w, r, http.StatusNotFound, "error.not_found")
+		return
+	}
+
+	// Time-locked secrets are refused outright until they unlock, tokens and all
+	if !srv.checkUnlocked(w, r, meta) {
 		return
 	}
 
+	if req.ClaimToken == "" {
+		localizedError(w, r, http.StatusForbidden, "error.claim_token_required")
+		return
+	}
+	if req.BurnToken != "" && !validBurnToken(req.BurnToken) {
+		localizedError(w, r, http.StatusBadRequest, "error.burn_token_invalid", MinBurnTokenLength, MaxBurnTokenLength)
+		return
+	}
+	if req.Download && !srv.checkDownload(w, r, meta, req.BurnToken) {
+		return
+	}
+	if !srv.claims.Valid(id, req.ClaimToken, time.Now()) {
+		localizedError(w, r, http.StatusForbidden, "error.invalid_claim_token")
+		return
+	}
+
+	// Rejected networks and accounts never get to try a passphrase
+	if !srv.checkReader(w, r, meta) {
+		return
+	}
+
+	if !srv.checkChallenge(w, r, id, req.Challenge, req.ChallengeSolution) {
+		return
+	}
+
+	// Check the passphrase and PIN before releasing the ciphertext; a wrong answer does not
+	// use up the claim token. It counts against the secret's attempt limit, if there is one,
+	// unless none was given: the view page claims without one to learn that one is needed.
+	if reqErr := srv.checkAnswer(r, id, meta.Passphrase, req.PassphraseHash, "error.invalid_passphrase"); reqErr != nil {
+		reqErr.reply(w, r)
+		return
+	}
+
+	// The PIN travels separately from the link, so the link alone can't release the content
+	if meta.PIN != nil {
+		if req.PIN == "" {
+			localizedError(w, r, http.StatusForbidden, "error.pin_required")
+			return
+		}
+		if reqErr := srv.checkAnswer(r, id, meta.PIN, req.PIN, "error.invalid_pin"); reqErr != nil {
+			reqErr.reply(w, r)
+			return
+		}
+	}
+
+	// A TOTP code proves the reader holds the seed shared with them, and is checked last as each
+	// attempt counts against the per-period limit
+	if retry, err := srv.store.VerifyTOTP(id, req.TOTP, time.Now()); err != nil {
+		switch {
+		case errors.Is(err, ErrTOTPRequired):
+			localizedError(w, r, http.StatusForbidden, "error.totp_required")
+		case errors.Is(err, ErrTOTPThrottled):
+			w.Header().Set("Retry-After", strconv.Itoa(int(retry.Round(time.Second)/time.Second)+1))
+			localizedError(w, r, http.StatusTooManyRequests, "error.totp_attempts")
+		case errors.Is(err, ErrTOTPInvalid):
+			srv.wrongAnswer(w, r, id, "error.invalid_totp")
+		default:
+			localizedError(w, r, http.StatusNotFound, "error.not_found")
+		}
+		return
+	}
+
+	if !srv.claims.Redeem(id, req.ClaimToken, time.Now()) {
+		localizedError(w, r, http.StatusForbidden, "error.invalid_claim_token")
+		return
+	}
+
+	secret, found := srv.readSecret(r, id, meta)
+	if !found {
+		localizedError(w, r, http.StatusNotFound, "error.not_found")
+		return
+	}
+	if req.Download {
+		srv.startDownload(w, secret, req.BurnToken)
+		return
+	}
+
+	// After the last read the content is kept for the grace period, so the recipient can
+	// fetch it again if this response doesn't arrive intact
+	var retainedUntil time.Time
+	if grace := srv.config.ReadGracePeriod; grace > 0 && req.BurnToken != "" && secret.ReadsRemaining <= 0 && !meta.Canary {
+		retainedUntil = time.Now().Add(grace)
+		srv.store.Retain(secret, req.BurnToken, retainedUntil)
+	}
+
+	writeSecret(w, secret, retainedUntil)
+}
+
+// checkUnlocked replies with 425 and returns false while a time-locked secret is still locked
+func (srv *Server) checkUnlocked(w http.ResponseWriter, r *http.Request, meta *Secret) bool {
+	if reqErr := lockedError(meta); reqErr != nil {
+		w.Header().Set("Retry-After", meta.NotBefore.UTC().Format(http.TimeFormat))
+		reqErr.reply(w, r)
+		return false
+	}
+	return true
+}
+
+// lockedError returns the error for a time-locked secret that is still locked, nil otherwise
+func lockedError(meta *Secret) *requestError {
+	if time.Now().Before(meta.NotBefore) {
+		return &requestError{Code: http.StatusTooEarly, Key: "error.secret_locked", Args: []any{meta.NotBefore.UTC().Format(time.RFC3339)}}
+	}
+	return nil
+}
+
+// checkReader replies with an error and returns false when the client's network or
+// single sign-on account isn't allowed to read the secret
+func (srv *Server) checkReader(w http.ResponseWriter, r *http.Request, meta *Secret) bool {
+	if reqErr := srv.readerError(r, meta); reqErr != nil {
+		reqErr.reply(w, r)
+		return false
+	}
+	return true
+}
+
+// readerError returns why the client of r may not read the secret, nil if it may
+func (srv *Server) readerError(r *http.Request, meta *Secret) *requestError {
+	if !meta.IPFilter.Allows(clientAddr(r, srv.config.TrustedProxies)) {
+		return &requestError{Code: http.StatusForbidden, Key: "error.network_denied"}
+	}
+
+	// Secrets bound to accounts need the reader to sign in as one of them
+	if identity, signedIn := srv.requestIdentity(r); !meta.Readers.Allows(identity, signedIn) {
+		if !signedIn {
+			return &requestError{Code: http.StatusUnauthorized, Key: "error.reader_login_required"}
+		}
+		return &requestError{Code: http.StatusForbidden, Key: "error.reader_denied"}
+	}
+	return nil
+}
+
+// writeSecret sends a retrieved secret and wipes the returned copy of its content.
+// retainedUntil is the end of the read grace period, zero when the content wasn't retained.
+func writeSecret(w http.ResponseWriter, secret *Secret, retainedUntil time.Time) {
+	defer wipeSecret(secret)
+	resp := GetSecretResponse{
+		Content:              string(secret.Content),
+		Type:                 secret.Type,
+		CreatedAt:            secret.CreatedAt.Format("2006-01-02 15:04:05 UTC"),
+		ReadsRemaining:       secret.ReadsRemaining,
+		RecipientFingerprint: secret.Recipient,
+	}
+	if !retainedUntil.IsZero() {
+		resp.RetainedUntil = retainedUntil.UTC().Format(time.RFC3339)
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(GetSecretResponse{
-		Content:   secret.Content,
-		CreatedAt: secret.CreatedAt.Format("2006-01-02 15:04:05 UTC"),
-	})
+	json.NewEncoder(w).Encode(resp)
 }
 
-func verifySecretHandler(w http.ResponseWriter, r *http.Request) {
+// burnSecretHandler lets the sender destroy an unread secret using the management token
+// returned at creation time, supplied as "Authorization: Bearer <token>".
+func (srv *Server) burnSecretHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	var req VerifySecretRequest
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		localizedError(w, r, http.StatusUnauthorized, "error.management_token_required")
+		return
+	}
+
+	err := srv.store.Burn(id, token)
+	if err == nil {
+		srv.audit(r, string(StatusBurned), id)
+	}
+	if errors.Is(err, ErrSecretNotFound) {
+		// Uncommitted chunked uploads can be abandoned the same way
+		if abortErr := srv.uploads.Abort(id, token); !errors.Is(abortErr, ErrUploadNotFound) {
+			err = abortErr
+		}
+	}
+	switch {
+	case errors.Is(err, ErrSecretNotFound):
+		localizedError(w, r, http.StatusNotFound, "error.not_found")
+	case errors.Is(err, ErrInvalidManagementToken):
+		localizedError(w, r, http.StatusForbidden, "error.invalid_management_token")
+	case err != nil:
+		apiError(w, r, http.StatusInternalServerError, err.Error())
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// updateSecretHandler lets the sender extend or shorten the remaining lifetime of an unread
+// secret with the management token. The secret can't outlive the server's maximum lifetime,
+// counted from its creation.
+func (srv *Server) updateSecretHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	token, ok := managementToken(w, r)
+	if !ok {
+		return
+	}
+
+	var req UpdateSecretRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		localizedError(w, r, http.StatusBadRequest, "error.invalid_json")
 		return
 	}
 
-	// Basic validation - just check that a verification code was provided
-	if req.VerificationCode == "" || len(req.VerificationCode) != 6 {
-		http.Error(w, "Invalid verification code", http.StatusBadRequest)
+	now := time.Now()
+	maxLifetime := time.Duration(srv.store.Limits().MaxLifetime) * srv.lifetimeUnit()
+	err := ErrExpiryOutOfRange
+	if req.ExpiresIn >= 1 {
+		err = srv.store.SetExpiry(id, token, now.Add(time.Duration(req.ExpiresIn)*srv.lifetimeUnit()), maxLifetime)
+	}
+	switch {
+	case errors.Is(err, ErrSecretNotFound):
+		localizedError(w, r, http.StatusNotFound, "error.not_found")
+		return
+	case errors.Is(err, ErrInvalidManagementToken):
+		localizedError(w, r, http.StatusForbidden, "error.invalid_management_token")
+		return
+	case errors.Is(err, ErrExpiryOutOfRange):
+		latest := 0
+		if meta, found := srv.store.Peek(id); found {
+			if meta.MaxLifetime > 0 {
+				maxLifetime = min(maxLifetime, meta.MaxLifetime)
+			}
+			latest = int(meta.CreatedAt.Add(maxLifetime).Sub(now) / srv.lifetimeUnit())
+		}
+		localizedError(w, r, http.StatusBadRequest, "error.expires_in_range", max(latest, 1))
 		return
 	}
 
-	// Get and delete the secret
-	secret, found := store.Get(id)
+	state, found := srv.store.Status(id)
 	if !found {
-		http.Error(w, "Secret not found", http.StatusNotFound)
+		localizedError(w, r, http.StatusNotFound, "error.not_found")
 		return
 	}
+	srv.audit(r, "extended", id)
+	// Open status streams report the new expiry
+	srv.statusStreams.HandleEvent(SecretEvent{ID: id})
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(GetSecretResponse{
-		Content:   secret.Content,
-		CreatedAt: secret.CreatedAt.Format("2006-01-02 15:04:05 UTC"),
-	})
+	json.NewEncoder(w).Encode(srv.secretStatusResponse(state))
 }
 
+// secretStatusHandler reports whether a secret is still unread, was read, expired or burned,
+// without revealing or consuming its content. The sender's label and reference are added when
+// the request is authenticated with the management token.
+func (srv *Server) secretStatusHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	state, found := srv.store.Status(id)
+	if !found {
+		localizedError(w, r, http.StatusNotFound, "error.not_found")
+		return
+	}
+	response := srv.secretStatusResponse(state)
+
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		details, err := srv.store.SenderDetails(id, token)
+		if errors.Is(err, ErrInvalidManagementToken) {
+			localizedError(w, r, http.StatusForbidden, "error.invalid_management_token")
+			return
+		}
+		response.Label, response.Reference = details.Label, details.Reference
+		response.Reads = newReadResponses(details.Reads)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (srv *Server) secretStatusResponse(state *SecretState) SecretStatusResponse {
+	response := SecretStatusResponse{
+		ID:        srv.signID(state.ID),
+		Status:    string(state.Status),
+		CreatedAt: state.CreatedAt.UTC().Format("2006-01-02 15:04:05 UTC"),
+		ExpiresAt: state.ExpiresAt.UTC().Format("2006-01-02 15:04:05 UTC"),
+
+		MaxReads:       state.MaxReads,
+		ReadsRemaining: state.ReadsRemaining,
+
+		DeletionMessage: state.DeletionMessage,
+	}
+	if !state.ClosedAt.IsZero() {
+		response.ClosedAt = state.ClosedAt.UTC().Format("2006-01-02 15:04:05 UTC")
+	}
+	return response
+}
+
+// configHandler exposes the server limits and features clients need to build a valid create
+// request. It is public, so it only reveals what the create form would show anyway.
+func (srv *Server) configHandler(w http.ResponseWriter, r *http.Request) {
+	limits := srv.store.Limits()
+	policy := srv.policy.Load()
+
+	// Lifetimes the policy bans aren't offered
+	options := []int{}
+	for _, preset := range lifetimePresets {
+		if preset >= limits.MinLifetime && preset <= limits.MaxLifetime && (policy == nil || !slices.Contains(policy.BannedLifetimes, preset)) {
+			options = append(options, preset)
+		}
+	}
+	if len(options) == 0 {
+		options = append(options, limits.DefaultLifetime)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ConfigResponse{
+		MinLifetime:     limits.MinLifetime,
+		MaxLifetime:     limits.MaxLifetime,
+		DefaultLifetime: limits.DefaultLifetime,
+		LifetimeOptions: options,
+		APIKeyRequired:  srv.config.RequireAPIKeys,
+		LoginRequired:   srv.oidc != nil,
+		Demo:            srv.config.Demo,
+
+		MaxSecretLength: limits.MaxSecretLength,
+		MaxUploadSize:   srv.uploads.MaxSize(),
+
+		Features: ConfigFeatures{
+			Passphrases:        true,
+			Uploads:            true,
+			Downloads:          srv.config.ReadGracePeriod > 0,
+			EmailNotifications: srv.emailNotifier != nil,
+			LinkDelivery:       srv.deliveries != nil,
+			PINTexting:         srv.messenger != nil,
+			ReaderDetails:      srv.config.ReaderDetails,
+			AbuseReports:       srv.config.AbuseReports,
+		},
+		Policy: policy,
+	})
+}
@@ -16,7 +16,7 @@ import (
 
 // Test create secret handler with encrypted content (client-side encryption model)
 func TestCreateSecretHandler(t *testing.T) {
-	store = NewSecretStore() // Reset store for clean test
+	srv := newTestServer(t)
 
 	// Create a mock encrypted content (base64 encoded)
 	// With client-side encryption, the server just stores this as-is
@@ -32,7 +32,7 @@ func TestCreateSecretHandler(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	createSecretHandler(w, req)
+	srv.createSecretHandler(w, req)
 
 	if w.Code != http.StatusOK {
 		t.Errorf("Expected status 200, got %d. Body: %s", w.Code, w.Body.String())
@@ -50,6 +50,8 @@ func TestCreateSecretHandler(t *testing.T) {
 }
 
 func TestCreateSecretHandler_EmptyContent(t *testing.T) {
+	srv := newTestServer(t)
+
 	reqBody := CreateSecretRequest{
 		Content:  "",
 		Lifetime: 60,
@@ -60,7 +62,7 @@ func TestCreateSecretHandler_EmptyContent(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	createSecretHandler(w, req)
+	srv.createSecretHandler(w, req)
 
 	if w.Code != http.StatusBadRequest {
 		t.Errorf("Expected status 400, got %d", w.Code)
@@ -68,57 +70,79 @@ func TestCreateSecretHandler_EmptyContent(t *testing.T) {
 }
 
 func TestCreateSecretHandler_InvalidJSON(t *testing.T) {
+	srv := newTestServer(t)
+
 	req := httptest.NewRequest("POST", "/api/secrets", strings.NewReader("invalid json"))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	createSecretHandler(w, req)
+	srv.createSecretHandler(w, req)
 
 	if w.Code != http.StatusBadRequest {
 		t.Errorf("Expected status 400, got %d", w.Code)
 	}
 }
 
+// claimSecret reads a secret in two steps like the web UI: it fetches the metadata for a claim
+// token, unless req already has one, then claims the content
+func claimSecret(t *testing.T, srv *Server, id string, req ClaimSecretRequest) *httptest.ResponseRecorder {
+	t.Helper()
+	if req.ClaimToken == "" {
+		w := httptest.NewRecorder()
+		srv.getSecretHandler(w, mux.SetURLVars(httptest.NewRequest("GET", "/api/secrets/"+id, nil), map[string]string{"id": id}))
+		var meta SecretMetadataResponse
+		json.NewDecoder(w.Body).Decode(&meta)
+		req.ClaimToken = meta.ClaimToken
+	}
+
+	body, _ := json.Marshal(req)
+	r := httptest.NewRequest("POST", "/api/secrets/"+id+"/claim", bytes.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	srv.claimSecretHandler(w, mux.SetURLVars(r, map[string]string{"id": id}))
+	return w
+}
+
 func TestGetSecretHandler(t *testing.T) {
-	// First create a secret
-	store = NewSecretStore() // Reset store for clean test
+	srv := newTestServer(t)
 	secretContent := base64.StdEncoding.EncodeToString([]byte("encrypted test content"))
-	secretID, err := store.Store(secretContent, 24*time.Hour)
+	secretID, err := srv.store.StoreWithOptions(secretContent, 24*time.Hour, SecretOptions{Type: SecretTypeCredentials, PassphraseHash: "hash"})
 	if err != nil {
 		t.Fatalf("Failed to store secret: %v", err)
 	}
 
-	// Test retrieving the secret
-	req := httptest.NewRequest("GET", "/api/secrets/"+secretID, nil)
-	w := httptest.NewRecorder()
-
-	// Setup mux vars
-	req = mux.SetURLVars(req, map[string]string{"id": secretID})
-
-	getSecretHandler(w, req)
-
-	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
-	}
+	// Fetching the metadata any number of times never consumes the secret
+	for i := 0; i < 2; i++ {
+		req := mux.SetURLVars(httptest.NewRequest("GET", "/api/secrets/"+secretID, nil), map[string]string{"id": secretID})
+		w := httptest.NewRecorder()
+		srv.getSecretHandler(w, req)
 
-	var response GetSecretResponse
-	err = json.Unmarshal(w.Body.Bytes(), &response)
-	if err != nil {
-		t.Errorf("Failed to parse response: %v", err)
-	}
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		if strings.Contains(w.Body.String(), secretContent) {
+			t.Fatal("Expected metadata without content")
+		}
 
-	// Content should be returned as-is (encrypted)
-	if response.Content != secretContent {
-		t.Errorf("Expected content '%s', got '%s'", secretContent, response.Content)
+		var response SecretMetadataResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		if response.ID != secretID || response.Type != SecretTypeCredentials || !response.PassphraseRequired {
+			t.Errorf("Unexpected metadata: %+v", response)
+		}
+		if response.CreatedAt == "" || response.ExpiresAt == "" || response.ClaimToken == "" {
+			t.Errorf("Expected timestamps and a claim token, got %+v", response)
+		}
 	}
 
-	if response.CreatedAt == "" {
-		t.Error("Expected non-empty CreatedAt")
+	if srv.store.Count() != 1 {
+		t.Errorf("Expected secret to remain stored, got %d secrets", srv.store.Count())
 	}
 }
 
 func TestGetSecretHandler_NotFound(t *testing.T) {
-	store = NewSecretStore() // Reset store for clean test
+	srv := newTestServer(t)
 
 	req := httptest.NewRequest("GET", "/api/secrets/nonexistent", nil)
 	w := httptest.NewRecorder()
@@ -126,74 +150,28 @@ func TestGetSecretHandler_NotFound(t *testing.T) {
 	// Setup mux vars
 	req = mux.SetURLVars(req, map[string]string{"id": "nonexistent"})
 
-	getSecretHandler(w, req)
+	srv.getSecretHandler(w, req)
 
 	if w.Code != http.StatusNotFound {
 		t.Errorf("Expected status 404, got %d", w.Code)
 	}
 }
 
-func TestGetSecretHandler_OnlyOnce(t *testing.T) {
-	// First create a secret
-	store = NewSecretStore() // Reset store for clean test
-	secretContent := base64.StdEncoding.EncodeToString([]byte("encrypted test content"))
-	secretID, err := store.Store(secretContent, 24*time.Hour)
-	if err != nil {
-		t.Fatalf("Failed to store secret: %v", err)
-	}
-
-	// First retrieval should succeed
-	req1 := httptest.NewRequest("GET", "/api/secrets/"+secretID, nil)
-	w1 := httptest.NewRecorder()
-	req1 = mux.SetURLVars(req1, map[string]string{"id": secretID})
-
-	getSecretHandler(w1, req1)
-
-	if w1.Code != http.StatusOK {
-		t.Errorf("Expected status 200 on first retrieval, got %d", w1.Code)
-	}
-
-	// Second retrieval should fail
-	req2 := httptest.NewRequest("GET", "/api/secrets/"+secretID, nil)
-	w2 := httptest.NewRecorder()
-	req2 = mux.SetURLVars(req2, map[string]string{"id": secretID})
-
-	getSecretHandler(w2, req2)
-
-	if w2.Code != http.StatusNotFound {
-		t.Errorf("Expected status 404 on second retrieval, got %d", w2.Code)
-	}
-}
-
-func TestVerifySecretHandler(t *testing.T) {
-	// First create a secret
-	store = NewSecretStore() // Reset store for clean test
+func TestClaimSecretHandler(t *testing.T) {
+	srv := newTestServer(t)
 	secretContent := base64.StdEncoding.EncodeToString([]byte("encrypted test content"))
-	secretID, err := store.Store(secretContent, 24*time.Hour)
+	secretID, err := srv.store.Store(secretContent, 24*time.Hour)
 	if err != nil {
 		t.Fatalf("Failed to store secret: %v", err)
 	}
 
-	// Test verify endpoint
-	reqBody := VerifySecretRequest{VerificationCode: "ABC123"}
-	jsonBody, _ := json.Marshal(reqBody)
-
-	req := httptest.NewRequest("POST", "/api/secrets/"+secretID+"/verify", bytes.NewBuffer(jsonBody))
-	req.Header.Set("Content-Type", "application/json")
-	w := httptest.NewRecorder()
-
-	// Setup mux vars
-	req = mux.SetURLVars(req, map[string]string{"id": secretID})
-
-	verifySecretHandler(w, req)
-
+	w := claimSecret(t, srv, secretID, ClaimSecretRequest{})
 	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+		t.Fatalf("Expected status 200, got %d", w.Code)
 	}
 
 	var response GetSecretResponse
-	err = json.Unmarshal(w.Body.Bytes(), &response)
-	if err != nil {
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
 		t.Errorf("Failed to parse response: %v", err)
 	}
 
@@ -201,89 +179,91 @@ func TestVerifySecretHandler(t *testing.T) {
 	if response.Content != secretContent {
 		t.Errorf("Expected content '%s', got '%s'", secretContent, response.Content)
 	}
+	if response.CreatedAt == "" {
+		t.Error("Expected non-empty CreatedAt")
+	}
 }
 
-func TestVerifySecretHandler_InvalidCode(t *testing.T) {
-	store = NewSecretStore() // Reset store for clean test
-	secretID, err := store.Store(base64.StdEncoding.EncodeToString([]byte("test content")), 24*time.Hour)
+func TestClaimSecretHandler_OnlyOnce(t *testing.T) {
+	srv := newTestServer(t)
+	secretID, err := srv.store.Store(base64.StdEncoding.EncodeToString([]byte("encrypted test content")), 24*time.Hour)
 	if err != nil {
 		t.Fatalf("Failed to store secret: %v", err)
 	}
 
-	// Test with invalid code (too short)
-	reqBody := VerifySecretRequest{VerificationCode: "ABC"}
-	jsonBody, _ := json.Marshal(reqBody)
-
-	req := httptest.NewRequest("POST", "/api/secrets/"+secretID+"/verify", bytes.NewBuffer(jsonBody))
-	req.Header.Set("Content-Type", "application/json")
-	w := httptest.NewRecorder()
-
-	req = mux.SetURLVars(req, map[string]string{"id": secretID})
-
-	verifySecretHandler(w, req)
-
-	if w.Code != http.StatusBadRequest {
-		t.Errorf("Expected status 400, got %d", w.Code)
+	if w := claimSecret(t, srv, secretID, ClaimSecretRequest{}); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 on first retrieval, got %d", w.Code)
+	}
+	if w := claimSecret(t, srv, secretID, ClaimSecretRequest{}); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 on second retrieval, got %d", w.Code)
 	}
 }
 
-func TestVerifySecretHandler_EmptyCode(t *testing.T) {
-	store = NewSecretStore() // Reset store for clean test
-	secretID, err := store.Store(base64.StdEncoding.EncodeToString([]byte("test content")), 24*time.Hour)
+func TestClaimSecretHandler_ClaimToken(t *testing.T) {
+	srv := newTestServer(t)
+	secretID, err := srv.store.StoreWithOptions("content", 24*time.Hour, SecretOptions{MaxReads: 3})
 	if err != nil {
 		t.Fatalf("Failed to store secret: %v", err)
 	}
+	otherID, _ := srv.store.Store("other", 24*time.Hour)
 
-	// Test with empty code
-	reqBody := VerifySecretRequest{VerificationCode: ""}
-	jsonBody, _ := json.Marshal(reqBody)
-
-	req := httptest.NewRequest("POST", "/api/secrets/"+secretID+"/verify", bytes.NewBuffer(jsonBody))
-	req.Header.Set("Content-Type", "application/json")
+	// Without a token, nothing is released
+	body, _ := json.Marshal(ClaimSecretRequest{})
+	req := mux.SetURLVars(httptest.NewRequest("POST", "/api/secrets/"+secretID+"/claim", bytes.NewReader(body)), map[string]string{"id": secretID})
 	w := httptest.NewRecorder()
+	srv.claimSecretHandler(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 without a claim token, got %d", w.Code)
+	}
 
-	req = mux.SetURLVars(req, map[string]string{"id": secretID})
+	if w := claimSecret(t, srv, secretID, ClaimSecretRequest{ClaimToken: "forged.token"}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a forged claim token, got %d", w.Code)
+	}
+	otherToken := srv.claims.Issue(otherID, time.Now())
+	if w := claimSecret(t, srv, secretID, ClaimSecretRequest{ClaimToken: otherToken}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for another secret's claim token, got %d", w.Code)
+	}
 
-	verifySecretHandler(w, req)
+	// Tokens are single use, even when the secret allows more reads
+	token := srv.claims.Issue(secretID, time.Now())
+	if w := claimSecret(t, srv, secretID, ClaimSecretRequest{ClaimToken: token}); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for a fresh claim token, got %d", w.Code)
+	}
+	if w := claimSecret(t, srv, secretID, ClaimSecretRequest{ClaimToken: token}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a reused claim token, got %d", w.Code)
+	}
 
-	if w.Code != http.StatusBadRequest {
-		t.Errorf("Expected status 400, got %d", w.Code)
+	expired := srv.claims.Issue(secretID, time.Now().Add(-2*ClaimTokenTTL))
+	if w := claimSecret(t, srv, secretID, ClaimSecretRequest{ClaimToken: expired}); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for an expired claim token, got %d", w.Code)
+	}
+	if state, _ := srv.store.Status(secretID); state.ReadsRemaining != 2 {
+		t.Errorf("Expected only the valid claim to consume a read, %d reads remaining", state.ReadsRemaining)
 	}
 }
 
-func TestVerifySecretHandler_NotFound(t *testing.T) {
-	store = NewSecretStore() // Reset store for clean test
-
-	reqBody := VerifySecretRequest{VerificationCode: "ABC123"}
-	jsonBody, _ := json.Marshal(reqBody)
+func TestClaimSecretHandler_NotFound(t *testing.T) {
+	srv := newTestServer(t)
 
-	req := httptest.NewRequest("POST", "/api/secrets/nonexistent/verify", bytes.NewBuffer(jsonBody))
-	req.Header.Set("Content-Type", "application/json")
-	w := httptest.NewRecorder()
-
-	req = mux.SetURLVars(req, map[string]string{"id": "nonexistent"})
-
-	verifySecretHandler(w, req)
-
-	if w.Code != http.StatusNotFound {
+	if w := claimSecret(t, srv, "nonexistent", ClaimSecretRequest{}); w.Code != http.StatusNotFound {
 		t.Errorf("Expected status 404, got %d", w.Code)
 	}
 }
 
-func TestVerifySecretHandler_InvalidJSON(t *testing.T) {
-	store = NewSecretStore() // Reset store for clean test
-	secretID, err := store.Store(base64.StdEncoding.EncodeToString([]byte("test content")), 24*time.Hour)
+func TestClaimSecretHandler_InvalidJSON(t *testing.T) {
+	srv := newTestServer(t)
+	secretID, err := srv.store.Store(base64.StdEncoding.EncodeToString([]byte("test content")), 24*time.Hour)
 	if err != nil {
 		t.Fatalf("Failed to store secret: %v", err)
 	}
 
-	req := httptest.NewRequest("POST", "/api/secrets/"+secretID+"/verify", strings.NewReader("invalid json"))
+	req := httptest.NewRequest("POST", "/api/secrets/"+secretID+"/claim", strings.NewReader("invalid json"))
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
 	req = mux.SetURLVars(req, map[string]string{"id": secretID})
 
-	verifySecretHandler(w, req)
+	srv.claimSecretHandler(w, req)
 
 	if w.Code != http.StatusBadRequest {
 		t.Errorf("Expected status 400, got %d", w.Code)
@@ -291,7 +271,7 @@ func TestVerifySecretHandler_InvalidJSON(t *testing.T) {
 }
 
 func TestCreateSecretHandler_ContentTooLong(t *testing.T) {
-	store = NewSecretStore() // Reset store for clean test
+	srv := newTestServer(t)
 
 	// Test with content that exceeds MaxSecretLength*2 characters (for base64 encoding)
 	longContent := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", MaxSecretLength*2+1)))
@@ -305,7 +285,7 @@ func TestCreateSecretHandler_ContentTooLong(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	createSecretHandler(w, req)
+	srv.createSecretHandler(w, req)
 
 	if w.Code != http.StatusBadRequest {
 		t.Errorf("Expected status 400 for content too long, got %d", w.Code)
@@ -317,7 +297,7 @@ func TestCreateSecretHandler_ContentTooLong(t *testing.T) {
 }
 
 func TestCreateSecretHandler_ContentAtLimit(t *testing.T) {
-	store = NewSecretStore() // Reset store for clean test
+	srv := newTestServer(t)
 
 	// Test with content exactly at the MaxSecretLength*2 character limit
 	// Note: The limit is on the encoded (base64) content length, not the original content
@@ -341,7 +321,7 @@ func TestCreateSecretHandler_ContentAtLimit(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	createSecretHandler(w, req)
+	srv.createSecretHandler(w, req)
 
 	if w.Code != http.StatusOK {
 		t.Errorf("Expected status 200 for content at limit, got %d. Body: %s", w.Code, w.Body.String())
@@ -349,7 +329,7 @@ func TestCreateSecretHandler_ContentAtLimit(t *testing.T) {
 }
 
 func TestCreateSecretHandler_MaxSecretsLimit(t *testing.T) {
-	store = NewSecretStore() // Reset store for clean test
+	srv := newTestServer(t)
 
 	// Create a simple encrypted content
 	encryptedContent := base64.StdEncoding.EncodeToString([]byte("test content"))
@@ -366,7 +346,7 @@ func TestCreateSecretHandler_MaxSecretsLimit(t *testing.T) {
 		req.Header.Set("Content-Type", "application/json")
 		w := httptest.NewRecorder()
 
-		createSecretHandler(w, req)
+		srv.createSecretHandler(w, req)
 
 		if w.Code != http.StatusOK {
 			t.Fatalf("Expected status 200 for secret %d, got %d. Body: %s", i, w.Code, w.Body.String())
@@ -384,7 +364,7 @@ func TestCreateSecretHandler_MaxSecretsLimit(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	createSecretHandler(w, req)
+	srv.createSecretHandler(w, req)
 
 	if w.Code != http.StatusTooManyRequests {
 		t.Errorf("Expected status 429, got %d. Body: %s", w.Code, w.Body.String())
@@ -395,3 +375,660 @@ func TestCreateSecretHandler_MaxSecretsLimit(t *testing.T) {
 		t.Errorf("Expected error message to contain '%s', got '%s'", expectedError, w.Body.String())
 	}
 }
+
+func TestClaimSecretHandler_Passphrase(t *testing.T) {
+	srv := newTestServer(t)
+	secretID, err := srv.store.StoreWithOptions("encrypted content", 24*time.Hour, SecretOptions{PassphraseHash: "correct-hash"})
+	if err != nil {
+		t.Fatalf("Failed to store secret: %v", err)
+	}
+
+	// The same claim token is reused across attempts, as the view page does
+	token := srv.claims.Issue(secretID, time.Now())
+	claim := func(passphraseHash string) *httptest.ResponseRecorder {
+		return claimSecret(t, srv, secretID, ClaimSecretRequest{ClaimToken: token, PassphraseHash: passphraseHash})
+	}
+
+	// Missing or wrong passphrase must be rejected without burning the secret or the token
+	for _, hash := range []string{"", "wrong-hash"} {
+		if w := claim(hash); w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403 for passphrase %q, got %d", hash, w.Code)
+		}
+	}
+	if srv.store.Count() != 1 {
+		t.Fatalf("Expected secret to survive failed attempts, got %d secrets", srv.store.Count())
+	}
+
+	w := claim("correct-hash")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 with correct passphrase, got %d", w.Code)
+	}
+
+	var response GetSecretResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if response.Content != "encrypted content" {
+		t.Errorf("Expected content 'encrypted content', got '%s'", response.Content)
+	}
+
+	if srv.store.Count() != 0 {
+		t.Errorf("Expected secret to be deleted after successful claim, got %d secrets", srv.store.Count())
+	}
+}
+
+func TestCreateSecretHandler_PassphraseHashTooLong(t *testing.T) {
+	srv := newTestServer(t)
+
+	jsonBody, _ := json.Marshal(CreateSecretRequest{
+		Content:        "encrypted",
+		Lifetime:       60,
+		PassphraseHash: strings.Repeat("a", MaxPassphraseHashLength+1),
+	})
+	req := httptest.NewRequest("POST", "/api/secrets", bytes.NewBuffer(jsonBody))
+	w := httptest.NewRecorder()
+
+	srv.createSecretHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestBurnSecretHandler(t *testing.T) {
+	srv := newTestServer(t)
+	server := httptest.NewServer(srv.routes())
+	defer server.Close()
+
+	jsonBody, _ := json.Marshal(CreateSecretRequest{Content: "encrypted", Lifetime: 60})
+	resp, err := http.Post(server.URL+"/api/secrets", "application/json", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var created CreateSecretResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("Failed to decode create response: %v", err)
+	}
+	if created.ManagementToken == "" {
+		t.Fatal("Expected a management token in the create response")
+	}
+
+	burn := func(token string) int {
+		req, _ := http.NewRequest("DELETE", server.URL+"/api/secrets/"+created.ID, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to burn secret: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := burn(""); code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without token, got %d", code)
+	}
+	if code := burn("wrong-token"); code != http.StatusForbidden {
+		t.Errorf("Expected status 403 with wrong token, got %d", code)
+	}
+	if srv.store.Count() != 1 {
+		t.Fatalf("Expected secret to survive rejected burns, got %d secrets", srv.store.Count())
+	}
+
+	if code := burn(created.ManagementToken); code != http.StatusNoContent {
+		t.Errorf("Expected status 204 with valid token, got %d", code)
+	}
+	if srv.store.Count() != 0 {
+		t.Errorf("Expected secret to be burned, got %d secrets", srv.store.Count())
+	}
+
+	if code := burn(created.ManagementToken); code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for burned secret, got %d", code)
+	}
+}
+
+func TestUpdateSecretHandler(t *testing.T) {
+	srv := newTestServer(t)
+	router := srv.routes()
+
+	id, err := srv.store.StoreWithOptions("encrypted", time.Hour, SecretOptions{ManagementToken: "token", RemindBefore: 10 * time.Minute})
+	if err != nil {
+		t.Fatalf("Failed to store secret: %v", err)
+	}
+
+	patch := func(token, body string) (int, SecretStatusResponse) {
+		req := httptest.NewRequest("PATCH", "/api/secrets/"+id, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		var resp SecretStatusResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		return rec.Code, resp
+	}
+
+	if code, _ := patch("", `{"expires_in": 120}`); code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without token, got %d", code)
+	}
+	if code, _ := patch("wrong", `{"expires_in": 120}`); code != http.StatusForbidden {
+		t.Errorf("Expected status 403 with wrong token, got %d", code)
+	}
+	for _, body := range []string{`{"expires_in": 0}`, `{"expires_in": 10081}`} {
+		if code, _ := patch("token", body); code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", body, code)
+		}
+	}
+
+	code, resp := patch("token", `{"expires_in": 120}`)
+	if code != http.StatusOK || resp.Status != string(StatusUnread) {
+		t.Fatalf("Expected the secret to be extended, got %d %+v", code, resp)
+	}
+	meta, _ := srv.store.Peek(id)
+	if remaining := time.Until(meta.ExpiresAt); remaining < 119*time.Minute || remaining > 120*time.Minute {
+		t.Errorf("Expected about 2 hours left, got %v", remaining)
+	}
+	sh := srv.store.shardFor(id)
+	if remindAt := sh.secrets[keyOf(id)].RemindAt; !remindAt.Equal(meta.ExpiresAt.Add(-10 * time.Minute)) {
+		t.Errorf("Expected the reminder to move with the expiry, got %v", remindAt)
+	}
+
+	if code, _ := patch("token", `{"expires_in": 1}`); code != http.StatusOK {
+		t.Errorf("Expected the secret to be shortened, got %d", code)
+	}
+}
+
+func TestSecretStatusHandler(t *testing.T) {
+	srv := newTestServer(t)
+	secretID, err := srv.store.Store("encrypted content", 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to store secret: %v", err)
+	}
+
+	status := func() (int, SecretStatusResponse) {
+		req := httptest.NewRequest("GET", "/api/secrets/"+secretID+"/status", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": secretID})
+		w := httptest.NewRecorder()
+		srv.secretStatusHandler(w, req)
+
+		var response SecretStatusResponse
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if strings.Contains(w.Body.String(), "encrypted content") {
+				t.Error("Status response must not contain secret content")
+			}
+		}
+		return w.Code, response
+	}
+
+	code, response := status()
+	if code != http.StatusOK || response.Status != "unread" {
+		t.Errorf("Expected unread status, got %d %+v", code, response)
+	}
+
+	srv.store.Get(secretID)
+
+	code, response = status()
+	if code != http.StatusOK || response.Status != "read" {
+		t.Errorf("Expected read status, got %d %+v", code, response)
+	}
+	if response.ClosedAt == "" {
+		t.Error("Expected closed_at to be set after read")
+	}
+}
+
+func TestSecretStatusHandler_SenderDetails(t *testing.T) {
+	srv := newTestServer(t)
+	router := srv.routes()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/secrets", strings.NewReader(`{"content": "encrypted", "label": "DB password for Dana", "reference": "OPS-1234"}`)))
+	var created CreateSecretResponse
+	json.NewDecoder(rec.Body).Decode(&created)
+
+	status := func(token string) (int, string) {
+		req := httptest.NewRequest("GET", "/api/secrets/"+created.ID+"/status", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Code, rec.Body.String()
+	}
+
+	if _, body := status(""); strings.Contains(body, "Dana") || strings.Contains(body, "OPS-1234") {
+		t.Errorf("Expected no sender details without the management token, got %s", body)
+	}
+	if code, _ := status("wrong"); code != http.StatusForbidden {
+		t.Errorf("Expected a wrong token to be rejected, got %d", code)
+	}
+
+	// The recipient's view of the secret never includes them
+	meta := httptest.NewRecorder()
+	router.ServeHTTP(meta, httptest.NewRequest("GET", "/api/secrets/"+created.ID, nil))
+	if strings.Contains(meta.Body.String(), "Dana") {
+		t.Error("Expected the label to be hidden from the recipient")
+	}
+
+	claimSecret(t, srv, created.ID, ClaimSecretRequest{})
+	code, body := status(created.ManagementToken)
+	if code != http.StatusOK || !strings.Contains(body, `"label":"DB password for Dana"`) || !strings.Contains(body, `"reference":"OPS-1234"`) {
+		t.Errorf("Expected the sender details after the read, got %d %s", code, body)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/secrets", strings.NewReader(`{"content": "encrypted", "label": "`+strings.Repeat("x", MaxSecretLabelLength+1)+`"}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an oversized label to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestSecretStatusHandler_NotFound(t *testing.T) {
+	srv := newTestServer(t)
+
+	req := httptest.NewRequest("GET", "/api/secrets/nonexistent/status", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "nonexistent"})
+	w := httptest.NewRecorder()
+
+	srv.secretStatusHandler(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+}
+
+func TestCreateSecretHandler_InvalidMaxReads(t *testing.T) {
+	srv := newTestServer(t)
+
+	for _, maxReads := range []int{-1, MaxReadsLimit + 1} {
+		jsonBody, _ := json.Marshal(CreateSecretRequest{Content: "encrypted", Lifetime: 60, MaxReads: maxReads})
+		req := httptest.NewRequest("POST", "/api/secrets", bytes.NewBuffer(jsonBody))
+		w := httptest.NewRecorder()
+
+		srv.createSecretHandler(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for max_reads %d, got %d", maxReads, w.Code)
+		}
+	}
+}
+
+func TestCreateSecretHandler_LifetimeOutOfRange(t *testing.T) {
+	srv := newTestServer(t)
+
+	for _, lifetime := range []int{-1, DefaultMinLifetime - 1, DefaultMaxLifetime + 1} {
+		jsonBody, _ := json.Marshal(CreateSecretRequest{Content: "encrypted", Lifetime: lifetime})
+		req := httptest.NewRequest("POST", "/api/secrets", bytes.NewBuffer(jsonBody))
+		w := httptest.NewRecorder()
+
+		srv.createSecretHandler(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for lifetime %d, got %d", lifetime, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), "Lifetime must be between") {
+			t.Errorf("Expected descriptive lifetime error, got %q", w.Body.String())
+		}
+	}
+
+	if srv.store.Count() != 0 {
+		t.Errorf("Expected no secrets stored, got %d", srv.store.Count())
+	}
+}
+
+func TestCreateSecretHandler_DisplayOptions(t *testing.T) {
+	srv := newTestServer(t)
+	router := srv.routes()
+
+	for _, hideAfter := range []int{-1, MaxHideAfter + 1} {
+		jsonBody, _ := json.Marshal(CreateSecretRequest{Content: "encrypted", Lifetime: 60, HideAfter: hideAfter})
+		w := httptest.NewRecorder()
+		srv.createSecretHandler(w, httptest.NewRequest("POST", "/api/secrets", bytes.NewBuffer(jsonBody)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for hide_after %d, got %d", hideAfter, w.Code)
+		}
+	}
+
+	jsonBody, _ := json.Marshal(CreateSecretRequest{Content: "encrypted", Lifetime: 60, HideAfter: 30, HoldToView: true})
+	w := httptest.NewRecorder()
+	srv.createSecretHandler(w, httptest.NewRequest("POST", "/api/secrets", bytes.NewBuffer(jsonBody)))
+	var createResp CreateSecretResponse
+	json.NewDecoder(w.Body).Decode(&createResp)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/secrets/"+createResp.ID, nil))
+	var meta SecretMetadataResponse
+	json.NewDecoder(w.Body).Decode(&meta)
+	if meta.HideAfter != 30 || !meta.HoldToView {
+		t.Errorf("Expected the display options in the metadata, got %+v", meta)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/s/"+createResp.ID, nil))
+	for _, expected := range []string{"const HIDE_AFTER =  30 ;", "const HOLD_TO_VIEW =  true ;"} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("Expected the view page to contain %q", expected)
+		}
+	}
+}
+
+func TestCreateSecretHandler_RemindBefore(t *testing.T) {
+	srv := newTestServer(t)
+
+	for _, req := range []CreateSecretRequest{
+		{Content: "encrypted", Lifetime: 60, RemindBefore: 30},
+		{Content: "encrypted", Lifetime: 60, RemindBefore: 60, WebhookURL: "https://example.com/hook"},
+		{Content: "encrypted", Lifetime: 60, RemindBefore: -1, WebhookURL: "https://example.com/hook"},
+	} {
+		jsonBody, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		srv.createSecretHandler(w, httptest.NewRequest("POST", "/api/secrets", bytes.NewBuffer(jsonBody)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %+v, got %d", req, w.Code)
+		}
+	}
+
+	jsonBody, _ := json.Marshal(CreateSecretRequest{Content: "encrypted", Lifetime: 60, RemindBefore: 59, WebhookURL: "https://example.com/hook"})
+	w := httptest.NewRecorder()
+	srv.createSecretHandler(w, httptest.NewRequest("POST", "/api/secrets", bytes.NewBuffer(jsonBody)))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected a reminder within the lifetime to be accepted, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCreateSecretHandler_DeletionMessage(t *testing.T) {
+	srv := newTestServer(t)
+	router := srv.routes()
+	message := "This credential was for the staging DB; contact ops if you missed it"
+
+	create := func(req CreateSecretRequest) *httptest.ResponseRecorder {
+		jsonBody, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/api/secrets", bytes.NewBuffer(jsonBody)))
+		return w
+	}
+	viewPage := func(id string) string {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/s/"+id, nil))
+		return w.Body.String()
+	}
+
+	if w := create(CreateSecretRequest{Content: "encrypted", DeletionMessage: strings.Repeat("x", MaxDeletionMessageLength+1)}); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an oversized deletion message to be rejected, got %d", w.Code)
+	}
+
+	var burned, read CreateSecretResponse
+	json.NewDecoder(create(CreateSecretRequest{Content: "encrypted", DeletionMessage: message}).Body).Decode(&burned)
+	json.NewDecoder(create(CreateSecretRequest{Content: "encrypted", DeletionMessage: message}).Body).Decode(&read)
+	if strings.Contains(viewPage(burned.ID), "staging DB") {
+		t.Error("Expected no deletion message while the secret is unread")
+	}
+
+	req := httptest.NewRequest("DELETE", "/api/secrets/"+burned.ID, nil)
+	req.Header.Set("Authorization", "Bearer "+burned.ManagementToken)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	if !strings.Contains(viewPage(burned.ID), "This credential was for the staging DB") {
+		t.Error("Expected the view page to show the deletion message after the burn")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/secrets/"+burned.ID+"/status", nil))
+	var status SecretStatusResponse
+	json.NewDecoder(w.Body).Decode(&status)
+	if status.DeletionMessage != message {
+		t.Errorf("Expected the status to carry the deletion message, got %+v", status)
+	}
+
+	claimSecret(t, srv, read.ID, ClaimSecretRequest{})
+	if strings.Contains(viewPage(read.ID), "staging DB") {
+		t.Error("Expected no deletion message once the secret was read")
+	}
+}
+
+func TestCreateSecretHandler_Type(t *testing.T) {
+	srv := newTestServer(t)
+
+	jsonBody, _ := json.Marshal(CreateSecretRequest{Content: "encrypted", Lifetime: 60, Type: "picture"})
+	req := httptest.NewRequest("POST", "/api/secrets", bytes.NewBuffer(jsonBody))
+	w := httptest.NewRecorder()
+
+	srv.createSecretHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for unknown type, got %d", w.Code)
+	}
+
+	for _, secretType := range []string{"", SecretTypeCredentials} {
+		jsonBody, _ = json.Marshal(CreateSecretRequest{Content: "encrypted", Lifetime: 60, Type: secretType})
+		req = httptest.NewRequest("POST", "/api/secrets", bytes.NewBuffer(jsonBody))
+		w = httptest.NewRecorder()
+
+		srv.createSecretHandler(w, req)
+
+		var createResp CreateSecretResponse
+		json.NewDecoder(w.Body).Decode(&createResp)
+
+		w = claimSecret(t, srv, createResp.ID, ClaimSecretRequest{})
+
+		var getResp GetSecretResponse
+		json.NewDecoder(w.Body).Decode(&getResp)
+
+		expected := secretType
+		if expected == "" {
+			expected = SecretTypeText
+		}
+		if getResp.Type != expected {
+			t.Errorf("Expected type %q, got %q", expected, getResp.Type)
+		}
+	}
+}
+
+func TestConfigHandler(t *testing.T) {
+	srv := newTestServer(t)
+	limits := srv.store.Limits()
+	limits.MinLifetime = 30
+	limits.MaxLifetime = 2 * 24 * 60
+	srv.store.SetLimits(limits)
+
+	req := httptest.NewRequest("GET", "/api/config", nil)
+	w := httptest.NewRecorder()
+
+	srv.configHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var resp ConfigResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.MinLifetime != 30 || resp.MaxLifetime != 2*24*60 || resp.DefaultLifetime != DefaultLifetime {
+		t.Errorf("Unexpected lifetime bounds: %+v", resp)
+	}
+	// Only presets inside the configured range are offered
+	if len(resp.LifetimeOptions) != 2 || resp.LifetimeOptions[0] != 60 || resp.LifetimeOptions[1] != 24*60 {
+		t.Errorf("Expected lifetime options [60 1440], got %v", resp.LifetimeOptions)
+	}
+	if resp.MaxSecretLength != limits.MaxSecretLength || resp.MaxUploadSize != DefaultUploadSize {
+		t.Errorf("Expected the size limits, got %d and %d", resp.MaxSecretLength, resp.MaxUploadSize)
+	}
+	if !resp.Features.Passphrases || resp.Features.Downloads || resp.Features.PINTexting {
+		t.Errorf("Unexpected features %+v", resp.Features)
+	}
+}
+
+func TestClaimSecretHandler_MultipleReads(t *testing.T) {
+	srv := newTestServer(t)
+	secretID, err := srv.store.StoreWithOptions("encrypted content", 24*time.Hour, SecretOptions{MaxReads: 2})
+	if err != nil {
+		t.Fatalf("Failed to store secret: %v", err)
+	}
+
+	for _, expected := range []int{http.StatusOK, http.StatusOK, http.StatusNotFound} {
+		w := claimSecret(t, srv, secretID, ClaimSecretRequest{})
+		if w.Code != expected {
+			t.Errorf("Expected status %d, got %d", expected, w.Code)
+		}
+	}
+}
+
+func TestClaimSecretHandler_NotBefore(t *testing.T) {
+	srv := newTestServer(t)
+	unlocksAt := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	jsonBody, _ := json.Marshal(CreateSecretRequest{Content: "encrypted", Lifetime: 120, NotBefore: unlocksAt.Format(time.RFC3339)})
+	w := httptest.NewRecorder()
+	srv.createSecretHandler(w, httptest.NewRequest("POST", "/api/secrets", bytes.NewBuffer(jsonBody)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var created CreateSecretResponse
+	json.NewDecoder(w.Body).Decode(&created)
+
+	w = httptest.NewRecorder()
+	srv.getSecretHandler(w, mux.SetURLVars(httptest.NewRequest("GET", "/api/secrets/"+created.ID, nil), map[string]string{"id": created.ID}))
+	var meta SecretMetadataResponse
+	json.NewDecoder(w.Body).Decode(&meta)
+	if meta.NotBefore != unlocksAt.UTC().Format(time.RFC3339) {
+		t.Errorf("Expected not_before %s, got %q", unlocksAt.UTC().Format(time.RFC3339), meta.NotBefore)
+	}
+
+	w = claimSecret(t, srv, created.ID, ClaimSecretRequest{ClaimToken: meta.ClaimToken})
+	if w.Code != http.StatusTooEarly {
+		t.Fatalf("Expected status 425 before unlock, got %d", w.Code)
+	}
+	if retryAfter, err := http.ParseTime(w.Header().Get("Retry-After")); err != nil || !retryAfter.Equal(unlocksAt) {
+		t.Errorf("Expected Retry-After %s, got %q", unlocksAt, w.Header().Get("Retry-After"))
+	}
+	if !strings.Contains(w.Body.String(), unlocksAt.UTC().Format(time.RFC3339)) {
+		t.Errorf("Expected unlock time in error, got %q", w.Body.String())
+	}
+	if _, found := srv.store.Peek(created.ID); !found {
+		t.Error("Expected locked secret to remain stored")
+	}
+
+	unlocked, err := srv.store.StoreWithOptions("encrypted", time.Hour, SecretOptions{NotBefore: time.Now().Add(-time.Minute)})
+	if err != nil {
+		t.Fatalf("Failed to store secret: %v", err)
+	}
+	if w := claimSecret(t, srv, unlocked, ClaimSecretRequest{}); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 after unlock, got %d", w.Code)
+	}
+}
+
+func TestClaimSecretHandler_PIN(t *testing.T) {
+	srv := newTestServer(t)
+
+	jsonBody, _ := json.Marshal(CreateSecretRequest{Content: "encrypted", Lifetime: 60, RequirePIN: true})
+	w := httptest.NewRecorder()
+	srv.createSecretHandler(w, httptest.NewRequest("POST", "/api/secrets", bytes.NewBuffer(jsonBody)))
+	var created CreateSecretResponse
+	json.NewDecoder(w.Body).Decode(&created)
+	if len(created.PIN) != PINLength || strings.Trim(created.PIN, "0123456789") != "" {
+		t.Fatalf("Expected a %d-digit PIN, got %q", PINLength, created.PIN)
+	}
+
+	w = httptest.NewRecorder()
+	srv.getSecretHandler(w, mux.SetURLVars(httptest.NewRequest("GET", "/api/secrets/"+created.ID, nil), map[string]string{"id": created.ID}))
+	if strings.Contains(w.Body.String(), created.PIN) {
+		t.Error("Expected metadata not to reveal the PIN")
+	}
+	var meta SecretMetadataResponse
+	json.NewDecoder(w.Body).Decode(&meta)
+	if !meta.PINRequired {
+		t.Error("Expected pin_required in metadata")
+	}
+
+	// Missing and wrong PINs keep both the secret and the claim token
+	for _, pin := range []string{"", "wrong"} {
+		w := claimSecret(t, srv, created.ID, ClaimSecretRequest{ClaimToken: meta.ClaimToken, PIN: pin})
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403 for PIN %q, got %d", pin, w.Code)
+		}
+	}
+	if _, found := srv.store.Peek(created.ID); !found {
+		t.Fatal("Expected secret to survive wrong PINs")
+	}
+
+	w = claimSecret(t, srv, created.ID, ClaimSecretRequest{ClaimToken: meta.ClaimToken, PIN: created.PIN})
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 with the right PIN, got %d", w.Code)
+	}
+
+	// Secrets created without one need no PIN
+	jsonBody, _ = json.Marshal(CreateSecretRequest{Content: "encrypted", Lifetime: 60})
+	w = httptest.NewRecorder()
+	srv.createSecretHandler(w, httptest.NewRequest("POST", "/api/secrets", bytes.NewBuffer(jsonBody)))
+	if strings.Contains(w.Body.String(), `"pin"`) {
+		t.Errorf("Expected no PIN without require_pin, got %s", w.Body.String())
+	}
+}
+
+func TestCreateSecretHandler_InvalidNotBefore(t *testing.T) {
+	srv := newTestServer(t)
+
+	for _, notBefore := range []string{"tomorrow", time.Now().Add(2 * time.Hour).Format(time.RFC3339)} {
+		jsonBody, _ := json.Marshal(CreateSecretRequest{Content: "encrypted", Lifetime: 60, NotBefore: notBefore})
+		w := httptest.NewRecorder()
+		srv.createSecretHandler(w, httptest.NewRequest("POST", "/api/secrets", bytes.NewBuffer(jsonBody)))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for not_before %q, got %d", notBefore, w.Code)
+		}
+	}
+}
+
+func TestCreateSecretHandler_Webhook(t *testing.T) {
+	srv := newTestServer(t)
+
+	jsonBody, _ := json.Marshal(CreateSecretRequest{Content: "encrypted", Lifetime: 60, WebhookURL: "https://example.com/hook"})
+	req := httptest.NewRequest("POST", "/api/secrets", bytes.NewBuffer(jsonBody))
+	w := httptest.NewRecorder()
+
+	srv.createSecretHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var response CreateSecretResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if response.WebhookSecret == "" {
+		t.Error("Expected a webhook secret when webhook_url is set")
+	}
+}
+
+func TestCreateSecretHandler_InvalidWebhook(t *testing.T) {
+	srv := newTestServer(t)
+
+	jsonBody, _ := json.Marshal(CreateSecretRequest{Content: "encrypted", Lifetime: 60, WebhookURL: "javascript:alert(1)"})
+	req := httptest.NewRequest("POST", "/api/secrets", bytes.NewBuffer(jsonBody))
+	w := httptest.NewRecorder()
+
+	srv.createSecretHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestCreateSecretHandler_NotifyEmailDisabled(t *testing.T) {
+	srv := newTestServer(t)
+
+	jsonBody, _ := json.Marshal(CreateSecretRequest{Content: "encrypted", Lifetime: 60, NotifyEmail: "sender@example.com"})
+	req := httptest.NewRequest("POST", "/api/secrets", bytes.NewBuffer(jsonBody))
+	w := httptest.NewRecorder()
+
+	srv.createSecretHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 when SMTP is not configured, got %d", w.Code)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	MaxHandoffChannels = 1000             // Channels open at once, waiting or paired
+	HandoffWaitTimeout = 10 * time.Minute // How long the first party waits for the other
+	HandoffIdleTimeout = 5 * time.Minute  // Paired connections without messages for this long are closed
+)
+
+// handoffReady is sent to both parties once they are connected to each other
+const handoffReady = `{"type":"ready"}`
+
+// Handoff channel names are chosen by the sender and shared in the link, so they must be
+// long enough not to be guessed
+var handoffChannelPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{16,64}$`)
+
+var (
+	ErrHandoffFull     = errors.New("too many open handoff channels")
+	ErrHandoffOccupied = errors.New("handoff channel already has two parties")
+)
+
+// handoffParty is one side of a live handoff
+type handoffParty struct {
+	conn    *wsConn
+	channel string
+
+	mu   sync.Mutex
+	peer *handoffParty // Set once the other party connects
+}
+
+func (p *handoffParty) getPeer() *handoffParty {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.peer
+}
+
+// HandoffRelay pairs the two parties of a live handoff and passes messages between their
+// connections as they arrive. Nothing is stored: a message sent before both parties are
+// connected is refused rather than buffered.
+type HandoffRelay struct {
+	mu       sync.Mutex
+	channels map[string][]*handoffParty // Parties connected to each channel, at most two
+	closed   bool
+}
+
+func NewHandoffRelay() *HandoffRelay {
+	return &HandoffRelay{channels: make(map[string][]*handoffParty)}
+}
+
+// join adds a party to its channel. The first party waits; the second is paired with it and
+// both are told they are connected.
+func (h *HandoffRelay) join(party *handoffParty) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	parties := h.channels[party.channel]
+	switch {
+	case h.closed || (len(parties) == 0 && len(h.channels) >= MaxHandoffChannels):
+		return ErrHandoffFull
+	case len(parties) >= 2:
+		return ErrHandoffOccupied
+	}
+	h.channels[party.channel] = append(parties, party)
+	if len(parties) == 0 {
+		return nil
+	}
+
+	first := parties[0]
+	first.mu.Lock()
+	first.peer = party
+	first.mu.Unlock()
+	party.peer = first
+
+	// The joining party isn't reading yet, so it is told first; the waiting party could
+	// otherwise reply before the joining party knows it is connected
+	party.conn.WriteMessage(wsOpText, []byte(handoffReady))
+	first.conn.WriteMessage(wsOpText, []byte(handoffReady))
+	return nil
+}
+
+// leave removes a party from its channel and disconnects its peer, ending the handoff
+func (h *HandoffRelay) leave(party *handoffParty) {
+	h.mu.Lock()
+	parties := h.channels[party.channel]
+	for i, p := range parties {
+		if p == party {
+			parties = append(parties[:i], parties[i+1:]...)
+			break
+		}
+	}
+	if len(parties) == 0 {
+		delete(h.channels, party.channel)
+	} else {
+		h.channels[party.channel] = parties
+	}
+	h.mu.Unlock()
+
+	party.conn.Close(WSCloseNormal, "")
+	if peer := party.getPeer(); peer != nil {
+		peer.conn.Close(WSCloseNormal, "peer disconnected")
+	}
+}
+
+// relay passes the party's messages on to its peer until either side disconnects
+func (h *HandoffRelay) relay(party *handoffParty) {
+	defer h.leave(party)
+
+	// A party left waiting is disconnected once HandoffWaitTimeout passes
+	party.conn.SetReadDeadline(time.Now().Add(HandoffWaitTimeout))
+	for {
+		opcode, message, err := party.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		peer := party.getPeer()
+		if peer == nil {
+			party.conn.Close(WSClosePolicyViolation, "no peer connected")
+			return
+		}
+		if err := peer.conn.WriteMessage(opcode, message); err != nil {
+			return
+		}
+		party.conn.SetReadDeadline(time.Now().Add(HandoffIdleTimeout))
+	}
+}
+
+// Close disconnects all parties and refuses new ones, so open handoffs don't outlive a shutdown
+func (h *HandoffRelay) Close() {
+	h.mu.Lock()
+	h.closed = true
+	var parties []*handoffParty
+	for _, channel := range h.channels {
+		parties = append(parties, channel...)
+	}
+	h.mu.Unlock()
+
+	for _, party := range parties {
+		party.conn.Close(WSCloseGoingAway, "server shutting down")
+	}
+}
+
+// handoffHandler connects a sender and a recipient over WebSocket and relays the encrypted
+// payload between them without storing it
+func (srv *Server) handoffHandler(w http.ResponseWriter, r *http.Request) {
+	channel := mux.Vars(r)["channel"]
+	if !handoffChannelPattern.MatchString(channel) {
+		apiError(w, r, http.StatusBadRequest, "Invalid handoff channel")
+		return
+	}
+	if !isWebSocketUpgrade(r) {
+		w.Header().Set("Upgrade", "websocket")
+		apiError(w, r, http.StatusUpgradeRequired, "Expected a WebSocket upgrade")
+		return
+	}
+
+	// Room for the largest encrypted secret and its JSON envelope
+	maxMessageSize := srv.store.Limits().MaxSecretLength*2 + 1024
+	conn, err := upgradeWebSocket(w, r, maxMessageSize)
+	if err != nil {
+		srv.logger.Error("WebSocket upgrade failed", "error", err)
+		return
+	}
+
+	party := &handoffParty{conn: conn, channel: channel}
+	if err := srv.handoffs.join(party); err != nil {
+		code := WSCloseTryAgainLater
+		if errors.Is(err, ErrHandoffOccupied) {
+			code = WSClosePolicyViolation
+		}
+		conn.Close(code, err.Error())
+		return
+	}
+	srv.handoffs.relay(party)
+}
+
+// liveHandoffHandler renders the page both parties of a live handoff use
+func (srv *Server) liveHandoffHandler(w http.ResponseWriter, r *http.Request) {
+	locale := requestLocale(w, r)
+	srv.renderPage(w, locale, "live.html", struct {
+		Lang     string
+		BasePath string
+		Brand    Branding
+		Theme    string
+		Nonce    string
+	}{
+		Lang:     locale.Tag,
+		BasePath: srv.config.BasePath,
+		Brand:    srv.config.Branding,
+		Theme:    requestTheme(w, r),
+		Nonce:    srv.scriptNonce(w),
+	})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testWebSocket is a minimal WebSocket client for exercising the handoff relay
+type testWebSocket struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialHandoff(t *testing.T, serverURL, channel string) *testWebSocket {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(serverURL, "http://"))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	io.WriteString(conn, "GET /ws/handoff/"+channel+" HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected a WebSocket upgrade, got %v %v", resp, err)
+	}
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Unexpected accept key %q", accept)
+	}
+	return &testWebSocket{conn: conn, reader: reader}
+}
+
+// send writes a masked text frame, as clients must
+func (ws *testWebSocket) send(message string) {
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x80 | wsOpText, 0x80 | byte(len(message))}
+	frame = append(frame, mask...)
+	for i := range message {
+		frame = append(frame, message[i]^mask[i%4])
+	}
+	ws.conn.Write(frame)
+}
+
+// receive reads one unmasked frame from the server
+func (ws *testWebSocket) receive() (int, string) {
+	var header [2]byte
+	if _, err := io.ReadFull(ws.reader, header[:]); err != nil {
+		return -1, ""
+	}
+	length := int(header[1] & 0x7f)
+	if length == 126 {
+		var ext [2]byte
+		io.ReadFull(ws.reader, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, length)
+	io.ReadFull(ws.reader, payload)
+	return int(header[0] & 0x0f), string(payload)
+}
+
+func TestHandoff_Relay(t *testing.T) {
+	_, server := setupTestServer(t)
+	defer server.Close()
+	channel := "Q2hhbm5lbC0wMTIzNDU2Nzg5"
+
+	sender := dialHandoff(t, server.URL, channel)
+	recipient := dialHandoff(t, server.URL, channel)
+	for _, ws := range []*testWebSocket{sender, recipient} {
+		if op, message := ws.receive(); op != wsOpText || message != handoffReady {
+			t.Fatalf("Expected both parties to be told they are connected, got %d %q", op, message)
+		}
+	}
+
+	sender.send(`{"type":"secret","content":"ciphertext"}`)
+	if _, message := recipient.receive(); message != `{"type":"secret","content":"ciphertext"}` {
+		t.Errorf("Expected the message to be relayed, got %q", message)
+	}
+	recipient.send(`{"type":"received"}`)
+	if _, message := sender.receive(); message != `{"type":"received"}` {
+		t.Errorf("Expected the reply to be relayed, got %q", message)
+	}
+
+	// A third party can't join, and one party leaving disconnects the other
+	intruder := dialHandoff(t, server.URL, channel)
+	if op, _ := intruder.receive(); op != wsOpClose {
+		t.Errorf("Expected a third party to be refused, got opcode %d", op)
+	}
+	recipient.conn.Close()
+	if op, _ := sender.receive(); op != wsOpClose {
+		t.Errorf("Expected the sender to be disconnected, got opcode %d", op)
+	}
+}
+
+func TestHandoff_NothingBufferedBeforePairing(t *testing.T) {
+	_, server := setupTestServer(t)
+	defer server.Close()
+
+	sender := dialHandoff(t, server.URL, "Q2hhbm5lbC0wMTIzNDU2Nzg5")
+	sender.send(`{"type":"secret","content":"ciphertext"}`)
+	if op, _ := sender.receive(); op != wsOpClose {
+		t.Errorf("Expected a message without a peer to be refused, got opcode %d", op)
+	}
+}
+
+func TestHandoff_InvalidRequests(t *testing.T) {
+	_, server := setupTestServer(t)
+	defer server.Close()
+
+	for path, expected := range map[string]int{
+		"/ws/handoff/short":                    http.StatusBadRequest,
+		"/ws/handoff/Q2hhbm5lbC0wMTIzNDU2Nzg5": http.StatusUpgradeRequired,
+		"/live":                                http.StatusOK,
+	} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != expected {
+			t.Errorf("%s: expected %d, got %d", path, expected, resp.StatusCode)
+		}
+	}
+}
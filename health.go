@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	ReadinessCheckTimeout   = 2 * time.Second // Timeout for each backend readiness check
+	CapacityWarningFraction = 0.9             // Store utilization reported as "pressure" in /readyz
+)
+
+// RegisterReadinessCheck adds a named check to /readyz, e.g. for an external storage backend
+func (srv *Server) RegisterReadinessCheck(name string, check func(ctx context.Context) error) {
+	srv.readinessMu.Lock()
+	defer srv.readinessMu.Unlock()
+	srv.readinessChecks[name] = check
+}
+
+// unregisterReadinessCheck removes the named check, if any
+func (srv *Server) unregisterReadinessCheck(name string) {
+	srv.readinessMu.Lock()
+	defer srv.readinessMu.Unlock()
+	delete(srv.readinessChecks, name)
+}
+
+type HealthResponse struct {
+	Status        string `json:"status"`
+	UptimeSeconds int64  `json:"uptime_seconds"`
+}
+
+type CapacityStatus struct {
+	Count       int     `json:"count"`
+	Max         int     `json:"max"`
+	Bytes       int     `json:"bytes"`               // Content bytes held in memory
+	MaxBytes    int     `json:"max_bytes,omitempty"` // Memory budget; absent when only the count is limited
+	Utilization float64 `json:"utilization"`         // The fuller of the count and the memory budget
+	Pressure    bool    `json:"pressure"`            // Utilization is at or above CapacityWarningFraction
+}
+
+// storeCapacity reports how full the store is, by number of secrets and by memory budget
+func (srv *Server) storeCapacity() CapacityStatus {
+	limits := srv.store.Limits()
+	capacity := CapacityStatus{
+		Count:    srv.store.Count(),
+		Max:      limits.MaxUnreadSecrets,
+		Bytes:    srv.store.BytesUsed(),
+		MaxBytes: limits.MaxStoreBytes,
+	}
+	if capacity.Max > 0 {
+		capacity.Utilization = float64(capacity.Count) / float64(capacity.Max)
+	}
+	if capacity.MaxBytes > 0 {
+		capacity.Utilization = max(capacity.Utilization, float64(capacity.Bytes)/float64(capacity.MaxBytes))
+	}
+	capacity.Pressure = capacity.Utilization >= CapacityWarningFraction
+	return capacity
+}
+
+type ReadinessResponse struct {
+	Status        string            `json:"status"` // ok or unavailable
+	UptimeSeconds int64             `json:"uptime_seconds"`
+	Capacity      CapacityStatus    `json:"capacity"`
+	Checks        map[string]string `json:"checks,omitempty"`
+}
+
+// healthzHandler is a liveness probe: it succeeds as long as the process can serve HTTP
+func (srv *Server) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(HealthResponse{
+		Status:        "ok",
+		UptimeSeconds: int64(time.Since(srv.startTime) / time.Second),
+	})
+}
+
+// readyzHandler is a readiness probe. It fails while shutting down or when a backend check fails.
+// A full store is reported as capacity pressure but does not fail readiness, since unread
+// secrets on this instance must remain reachable.
+func (srv *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	response := ReadinessResponse{
+		Status:        "ok",
+		UptimeSeconds: int64(time.Since(srv.startTime) / time.Second),
+		Capacity:      srv.storeCapacity(),
+	}
+
+	srv.readinessMu.RLock()
+	names := make([]string, 0, len(srv.readinessChecks))
+	for name := range srv.readinessChecks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checks := make([]func(ctx context.Context) error, len(names))
+	for i, name := range names {
+		checks[i] = srv.readinessChecks[name]
+	}
+	srv.readinessMu.RUnlock()
+
+	if len(checks) > 0 {
+		response.Checks = make(map[string]string, len(checks))
+	}
+	for i, check := range checks {
+		ctx, cancel := context.WithTimeout(r.Context(), ReadinessCheckTimeout)
+		err := check(ctx)
+		cancel()
+		if err != nil {
+			response.Checks[names[i]] = err.Error()
+			response.Status = "unavailable"
+		} else {
+			response.Checks[names[i]] = "ok"
+		}
+	}
+
+	if srv.shuttingDown.Load() {
+		response.Status = "unavailable"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if response.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
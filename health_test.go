@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthzHandler(t *testing.T) {
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	w := httptest.NewRecorder()
+
+	newTestServer(t).healthzHandler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	var response HealthResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if response.Status != "ok" {
+		t.Errorf("Expected status ok, got %s", response.Status)
+	}
+}
+
+func readyz(t *testing.T, srv *Server) (int, ReadinessResponse) {
+	req := httptest.NewRequest("GET", "/readyz", nil)
+	w := httptest.NewRecorder()
+
+	srv.readyzHandler(w, req)
+
+	var response ReadinessResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	return w.Code, response
+}
+
+func TestReadyzHandler_CapacityPressure(t *testing.T) {
+	srv := newTestServer(t)
+	srv.store.SetLimits(Limits{MaxSecretLength: MaxSecretLength, MaxUnreadSecrets: 10})
+
+	for i := 0; i < 9; i++ {
+		srv.store.Store("secret", 24*time.Hour)
+	}
+
+	code, response := readyz(t, srv)
+	if code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", code)
+	}
+	if response.Capacity.Count != 9 || response.Capacity.Max != 10 {
+		t.Errorf("Unexpected capacity: %+v", response.Capacity)
+	}
+	if !response.Capacity.Pressure {
+		t.Error("Expected capacity pressure at 90% utilization")
+	}
+}
+
+func TestReadyzHandler_BytePressure(t *testing.T) {
+	srv := newTestServer(t)
+	srv.store.SetLimits(Limits{MaxSecretLength: MaxSecretLength, MaxUnreadSecrets: 10, MaxStoreBytes: 100})
+	srv.store.Store(strings.Repeat("a", 95), 24*time.Hour)
+
+	_, response := readyz(t, srv)
+	if response.Capacity.Bytes != 95 || response.Capacity.MaxBytes != 100 {
+		t.Errorf("Unexpected capacity: %+v", response.Capacity)
+	}
+	if response.Capacity.Utilization != 0.95 || !response.Capacity.Pressure {
+		t.Errorf("Expected the memory budget to set utilization, got %+v", response.Capacity)
+	}
+}
+
+func TestReadyzHandler_FailingCheck(t *testing.T) {
+	srv := newTestServer(t)
+
+	srv.RegisterReadinessCheck("backend", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+
+	code, response := readyz(t, srv)
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", code)
+	}
+	if response.Checks["backend"] != "connection refused" {
+		t.Errorf("Expected failing check to be reported, got %v", response.Checks)
+	}
+}
+
+func TestReadyzHandler_ShuttingDown(t *testing.T) {
+	srv := newTestServer(t)
+
+	srv.shuttingDown.Store(true)
+
+	code, response := readyz(t, srv)
+	if code != http.StatusServiceUnavailable || response.Status != "unavailable" {
+		t.Errorf("Expected unavailable while shutting down, got %d %s", code, response.Status)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLocale is used when the client accepts none of the bundled languages. Its bundle
+// must contain every message key, other bundles fall back to it for missing keys.
+const DefaultLocale = "en"
+
+//go:embed locales/*.json
+var localesFS embed.FS
+
+// Locale holds the translated messages for one language
+type Locale struct {
+	Tag      string
+	messages map[string]string
+	fallback *Locale
+}
+
+// locales are the bundled languages keyed by their lowercase tag
+var locales = mustLoadLocales(localesFS)
+
+func mustLoadLocales(fsys fs.FS) map[string]*Locale {
+	loaded, err := loadLocales(fsys)
+	if err != nil {
+		panic(err)
+	}
+	return loaded
+}
+
+// loadLocales reads one JSON object of message key to text per locales/<tag>.json file
+func loadLocales(fsys fs.FS) (map[string]*Locale, error) {
+	files, err := fs.Glob(fsys, "locales/*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := make(map[string]*Locale, len(files))
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("locale %s: %w", file, err)
+		}
+		tag := strings.ToLower(strings.TrimSuffix(path.Base(file), ".json"))
+		loaded[tag] = &Locale{Tag: tag, messages: messages}
+	}
+
+	def, ok := loaded[DefaultLocale]
+	if !ok {
+		return nil, fmt.Errorf("default locale %s is missing", DefaultLocale)
+	}
+	for tag, locale := range loaded {
+		if tag != DefaultLocale {
+			locale.fallback = def
+		}
+	}
+	return loaded, nil
+}
+
+// T returns the message for key formatted with args. Missing translations fall back to
+// the default locale, and unknown keys are returned as is so they stand out.
+func (l *Locale) T(key string, args ...any) string {
+	message, ok := l.messages[key]
+	if !ok {
+		if l.fallback != nil {
+			return l.fallback.T(key, args...)
+		}
+		return key
+	}
+	if len(args) == 0 {
+		return message
+	}
+	return fmt.Sprintf(message, args...)
+}
+
+// negotiateLocale picks the bundled locale the client prefers most according to an
+// Accept-Language header. Region subtags match their base language, so de-AT selects de.
+func negotiateLocale(acceptLanguage string) *Locale {
+	type candidate struct {
+		tag     string
+		quality float64
+	}
+
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		if quality <= 0 {
+			continue
+		}
+		candidates = append(candidates, candidate{tag: tag, quality: quality})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].quality > candidates[j].quality })
+	for _, c := range candidates {
+		if locale, ok := locales[c.tag]; ok {
+			return locale
+		}
+		base, _, _ := strings.Cut(c.tag, "-")
+		if locale, ok := locales[base]; ok {
+			return locale
+		}
+	}
+	return locales[DefaultLocale]
+}
+
+// requestLocale negotiates the locale for r and marks the response as varying by language
+func requestLocale(w http.ResponseWriter, r *http.Request) *Locale {
+	locale := negotiateLocale(r.Header.Get("Accept-Language"))
+	w.Header().Add("Vary", "Accept-Language")
+	w.Header().Set("Content-Language", locale.Tag)
+	return locale
+}
+
+// localizedError replies with the message for key translated into the client's language
+func localizedError(w http.ResponseWriter, r *http.Request, code int, key string, args ...any) {
+	writeError(w, r, code, keyErrorCode(key), requestLocale(w, r).T(key, args...))
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateLocale(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected string
+	}{
+		{"", "en"},
+		{"de", "de"},
+		{"de-AT,de;q=0.9,en;q=0.8", "de"},
+		{"fr-FR,fr;q=0.9,es;q=0.5,en;q=0.4", "es"},
+		{"en;q=0.5, ru", "ru"},
+		{"RU-ru", "ru"},
+		{"es;q=0, de;q=0.1", "de"},
+		{"fr, it", "en"},
+		{"de;q=abc, es", "es"},
+	}
+
+	for _, tt := range tests {
+		if got := negotiateLocale(tt.header).Tag; got != tt.expected {
+			t.Errorf("negotiateLocale(%q) = %q, expected %q", tt.header, got, tt.expected)
+		}
+	}
+}
+
+func TestLocale_T(t *testing.T) {
+	de := locales["de"]
+	if got := de.T("error.lifetime_range", 5, 60); got != "Die Gültigkeitsdauer muss zwischen 5 und 60 Minuten liegen" {
+		t.Errorf("Unexpected translation %q", got)
+	}
+
+	// Missing keys fall back to English, unknown keys are returned unchanged
+	fallback := &Locale{Tag: "xx", messages: map[string]string{}, fallback: locales[DefaultLocale]}
+	if got := fallback.T("error.not_found"); got != "Secret not found" {
+		t.Errorf("Expected English fallback, got %q", got)
+	}
+	if got := de.T("no.such.key"); got != "no.such.key" {
+		t.Errorf("Expected unknown key to be returned, got %q", got)
+	}
+}
+
+func TestLocaleBundlesComplete(t *testing.T) {
+	verbs := regexp.MustCompile(`%[sd]`)
+	def := locales[DefaultLocale]
+	for tag, locale := range locales {
+		for key, message := range def.messages {
+			translated, ok := locale.messages[key]
+			if !ok {
+				t.Errorf("Locale %s is missing %s", tag, key)
+				continue
+			}
+			if got, want := verbs.FindAllString(translated, -1), verbs.FindAllString(message, -1); strings.Join(got, "") != strings.Join(want, "") {
+				t.Errorf("Locale %s message %s has placeholders %v, expected %v", tag, key, got, want)
+			}
+		}
+		for key := range locale.messages {
+			if _, ok := def.messages[key]; !ok {
+				t.Errorf("Locale %s has unknown key %s", tag, key)
+			}
+		}
+	}
+}
+
+func TestPagesLocalized(t *testing.T) {
+	_, server := setupTestServer(t)
+	defer server.Close()
+
+	for _, path := range []string{"/", "/s/example"} {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		req.Header.Set("Accept-Language", "de-DE,de;q=0.9")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %v", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.Header.Get("Content-Language") != "de" {
+			t.Errorf("%s: expected Content-Language de, got %q", path, resp.Header.Get("Content-Language"))
+		}
+		if !strings.Contains(resp.Header.Get("Vary"), "Accept-Language") {
+			t.Errorf("%s: expected Vary Accept-Language, got %q", path, resp.Header.Get("Vary"))
+		}
+		if !strings.Contains(string(body), `<html lang="de">`) || !strings.Contains(string(body), locales["de"].T("common.tagline")) {
+			t.Errorf("%s: expected German page", path)
+		}
+	}
+}
+
+func TestAPIErrorsLocalized(t *testing.T) {
+	_, server := setupTestServer(t)
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/secrets/missing", nil)
+	req.Header.Set("Accept-Language", "es")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to get secret: %v", err)
+	}
+	var body ErrorResponse
+	json.NewDecoder(resp.Body).Decode(&body)
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected status 404, got %d", resp.StatusCode)
+	}
+	if body.Error != "Secreto no encontrado" {
+		t.Errorf("Expected Spanish error, got %q", body.Error)
+	}
+	if body.Code != "not_found" {
+		t.Errorf("Expected the code not to be translated, got %q", body.Code)
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"crypto/rand"
+	_ "embed"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+var idSamplers = sync.Pool{New: func() any { return new(idSampler) }}
+
+// Secret ID formats
+const (
+	IDFormatBase64URL = "base64url" // URL-safe base64 characters
+	IDFormatBase58    = "base58"    // Letters and digits without look-alikes such as 0, O, I and l
+	IDFormatWords     = "words"     // Words from the embedded wordlist joined by IDWordSeparator, optionally followed by digits
+)
+
+const (
+	base64URLAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+	base58Alphabet    = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+	IDWordSeparator     = "-"
+	MinIDEntropyBits    = 48 // IDs must not be easier to guess than this unless configured otherwise
+	LowestIDEntropyBits = 32 // Lowest configurable minimum
+	MaxIDLength         = 64 // Maximum characters, or words for the words format
+	MaxIDDigits         = 6  // Maximum digits after the words
+
+	idGenerateAttempts = 16 // IDs generated before giving up on finding an unused one
+)
+
+//go:embed wordlist.txt
+var wordlistFile string
+
+var (
+	idWords     = strings.Fields(wordlistFile)
+	idWordIndex = func() map[string]bool {
+		index := make(map[string]bool, len(idWords))
+		for _, word := range idWords {
+			index[word] = true
+		}
+		return index
+	}()
+)
+
+// IDFormat describes how secret IDs are generated. Shorter IDs make shorter links but are
+// easier to guess.
+type IDFormat struct {
+	Format         string // base64url, base58 or words
+	Length         int    // Characters, or words for the words format; 0 uses the format's default
+	Digits         int    // Digits appended to word IDs, as in amber-falcon-917
+	MinEntropyBits int    // Fewest random bits IDs may carry; 0 uses MinIDEntropyBits
+}
+
+// DefaultIDFormat returns the built-in format: 16 base64url characters, 96 bits
+func DefaultIDFormat() IDFormat {
+	return IDFormat{Format: IDFormatBase64URL, Length: 16}
+}
+
+// withDefaultLength returns the format with a zero length replaced by the format's default
+func (f IDFormat) withDefaultLength() IDFormat {
+	if f.Length != 0 {
+		return f
+	}
+	switch f.Format {
+	case IDFormatWords:
+		f.Length = 8
+	default:
+		f.Length = 16
+	}
+	return f
+}
+
+// symbols returns the number of values each character or word can take
+func (f IDFormat) symbols() int {
+	switch f.Format {
+	case IDFormatBase64URL:
+		return len(base64URLAlphabet)
+	case IDFormatBase58:
+		return len(base58Alphabet)
+	case IDFormatWords:
+		return len(idWords)
+	}
+	return 0
+}
+
+// EntropyBits returns how many random bits an ID carries
+func (f IDFormat) EntropyBits() float64 {
+	return float64(f.Length)*math.Log2(float64(f.symbols())) + float64(f.Digits)*math.Log2(10)
+}
+
+// minEntropyBits returns the configured minimum, or MinIDEntropyBits when unset
+func (f IDFormat) minEntropyBits() int {
+	if f.MinEntropyBits == 0 {
+		return MinIDEntropyBits
+	}
+	return f.MinEntropyBits
+}
+
+// Validate checks the format name, and that the length is within bounds and gives IDs at
+// least the minimum entropy, which can't be set below LowestIDEntropyBits
+func (f IDFormat) Validate() error {
+	if f.symbols() == 0 {
+		return fmt.Errorf("invalid id-format %q (expected %s, %s or %s)", f.Format, IDFormatBase64URL, IDFormatBase58, IDFormatWords)
+	}
+	if f.Length <= 0 || f.Length > MaxIDLength {
+		return fmt.Errorf("id-length must be between 1 and %d", MaxIDLength)
+	}
+	if f.Digits < 0 || f.Digits > MaxIDDigits {
+		return fmt.Errorf("id-digits must be between 0 and %d", MaxIDDigits)
+	}
+	if f.Digits > 0 && f.Format != IDFormatWords {
+		return fmt.Errorf("id-digits requires id-format %s", IDFormatWords)
+	}
+	if f.MinEntropyBits != 0 && f.MinEntropyBits < LowestIDEntropyBits {
+		return fmt.Errorf("id-min-entropy must be at least %d bits", LowestIDEntropyBits)
+	}
+	if bits, required := f.EntropyBits(), f.minEntropyBits(); bits < float64(required) {
+		return fmt.Errorf("id-length %d gives %s IDs only %.0f bits, at least %d are required", f.Length, f.Format, bits, required)
+	}
+	return nil
+}
+
+// Generate returns a random ID in the format
+func (f IDFormat) Generate() string {
+	return f.generate(rand.Reader)
+}
+
+// generate returns an ID in the format drawn from random
+func (f IDFormat) generate(random io.Reader) string {
+	sampler := idSamplers.Get().(*idSampler)
+	sampler.random, sampler.left = random, 0
+	defer func() {
+		sampler.random = nil
+		idSamplers.Put(sampler)
+	}()
+	n := f.symbols()
+
+	if f.Format == IDFormatWords {
+		words := make([]string, f.Length, f.Length+1)
+		for i := range words {
+			words[i] = idWords[sampler.intn(n)]
+		}
+		if f.Digits > 0 {
+			limit := int(math.Pow10(f.Digits))
+			words = append(words, fmt.Sprintf("%0*d", f.Digits, sampler.intn(limit)))
+		}
+		return strings.Join(words, IDWordSeparator)
+	}
+
+	alphabet := base64URLAlphabet
+	if f.Format == IDFormatBase58 {
+		alphabet = base58Alphabet
+	}
+	var buf [MaxIDLength]byte
+	id := buf[:f.Length]
+	for i := range id {
+		id[i] = alphabet[sampler.intn(n)]
+	}
+	return string(id)
+}
+
+// idSampler draws uniform indexes from random. It reads random in batches and keeps only as
+// many bytes per index as the range needs, where crypto/rand.Int allocated big.Ints per call.
+// Samplers are pooled, as the batch escapes to the heap through the io.Reader.
+type idSampler struct {
+	random io.Reader
+	buf    [64]byte
+	left   int // Unused bytes at the end of buf
+}
+
+// next returns the next random byte, refilling the batch once it is used up
+func (s *idSampler) next() byte {
+	if s.left == 0 {
+		if _, err := io.ReadFull(s.random, s.buf[:]); err != nil {
+			panic(fmt.Sprintf("failed to read random bytes: %v", err))
+		}
+		s.left = len(s.buf)
+	}
+	s.left--
+	return s.buf[len(s.buf)-1-s.left]
+}
+
+// intn returns a uniform value in [0, n) for n up to 1<<32. Values past the largest multiple
+// of n that fits the bytes drawn are rejected, so no index is more likely than another.
+func (s *idSampler) intn(n int) int {
+	bound := uint64(256)
+	for bound < uint64(n) {
+		bound <<= 8
+	}
+	limit := bound - bound%uint64(n)
+	for {
+		var v uint64
+		for b := uint64(1); b < bound; b <<= 8 {
+			v = v<<8 | uint64(s.next())
+		}
+		if v < limit {
+			return int(v % uint64(n))
+		}
+	}
+}
+
+// Valid reports whether id could have been generated in the format, optionally scoped to a tenant
+func (f IDFormat) Valid(id string) bool {
+	if tenant, rest, found := strings.Cut(id, TenantSeparator); found {
+		if !tenantNamePattern.MatchString(tenant) {
+			return false
+		}
+		id = rest
+	}
+
+	switch f.Format {
+	case IDFormatWords:
+		words := strings.Split(id, IDWordSeparator)
+		if len(words) != f.Length+min(f.Digits, 1) {
+			return false
+		}
+		if f.Digits > 0 {
+			number := words[len(words)-1]
+			if len(number) != f.Digits || strings.Trim(number, "0123456789") != "" {
+				return false
+			}
+			words = words[:len(words)-1]
+		}
+		for _, word := range words {
+			if !idWordIndex[word] {
+				return false
+			}
+		}
+		return true
+	case IDFormatBase58:
+		return len(id) == f.Length && strings.Trim(id, base58Alphabet) == ""
+	default:
+		return len(id) == f.Length && strings.Trim(id, base64URLAlphabet) == ""
+	}
+}
+
+// SetIDFormat changes the format of IDs generated from now on
+func (s *SecretStore) SetIDFormat(format IDFormat) {
+	s.updateSettings(func(settings *storeSettings) { settings.idFormat = format })
+}
+
+// IDFormat returns the format of generated IDs
+func (s *SecretStore) IDFormat() IDFormat {
+	return s.settings.Load().idFormat
+}
+
+// SetIDRandom changes the source IDs are drawn from; nil restores crypto/rand. Anything else
+// makes IDs predictable and is only meant for demo mode.
+func (s *SecretStore) SetIDRandom(random io.Reader) {
+	if random == nil {
+		random = rand.Reader
+	}
+	s.updateSettings(func(settings *storeSettings) { settings.idRandom = random })
+}
+
+// NewID generates a secret ID, scoped to tenant unless it is empty. Short formats such as a
+// few words make collisions likely enough to matter, so IDs of live, retained or recently
+// finished secrets are skipped; reusing a tombstoned ID would report the old secret's status.
+func (s *SecretStore) NewID(tenant string) string {
+	settings := s.settings.Load()
+	var id string
+	for attempt := 0; attempt < idGenerateAttempts; attempt++ {
+		id = settings.idFormat.generate(settings.idRandom)
+		if tenant != "" {
+			id = tenant + TenantSeparator + id
+		}
+		if !s.idTaken(id) {
+			break
+		}
+	}
+	return id
+}
+
+// idTaken reports whether id belongs to a secret the store still knows about
+func (s *SecretStore) idTaken(id string) bool {
+	sh, key := s.shardFor(id), keyOf(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	_, secret := sh.secrets[key]
+	_, tombstone := sh.tombstones[key]
+	_, retained := sh.retained[key]
+	return secret || tombstone || retained
+}
+
+// requireValidSecretID answers 404 for secret routes whose ID neither matches the configured
+// format nor is a custom slug, or carries no valid link signature, without looking it up in
+// the store, and 410 for IDs on the blocklist, which pages explain themselves instead. Handlers
+// see the ID without its signature.
+func (srv *Server) requireValidSecretID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id, signed := srv.verifyID(vars["id"])
+		if !signed || !(srv.store.IDFormat().Valid(id) || validSlug(id)) {
+			localizedError(w, r, http.StatusNotFound, "error.not_found")
+			return
+		}
+		if id != vars["id"] {
+			stripped := make(map[string]string, len(vars))
+			for name, value := range vars {
+				stripped[name] = value
+			}
+			stripped["id"] = id
+			r = mux.SetURLVars(r, stripped)
+		}
+		if srv.abuse.Blocked(BlockByID, id) && isAPIPath(r.URL.Path) {
+			localizedError(w, r, http.StatusGone, "error.secret_blocked")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIDFormat_GenerateAndValid(t *testing.T) {
+	for _, format := range []IDFormat{
+		DefaultIDFormat(),
+		{Format: IDFormatBase58, Length: 12},
+		{Format: IDFormatWords, Length: 6},
+		{Format: IDFormatWords, Length: 3, Digits: 3},
+	} {
+		id := format.Generate()
+		if !format.Valid(id) || !format.Valid("acme"+TenantSeparator+id) {
+			t.Errorf("%+v: expected generated ID %q to be valid", format, id)
+		}
+		if format.Generate() == id {
+			t.Errorf("%+v: expected different IDs on subsequent calls", format)
+		}
+	}
+
+	words := IDFormat{Format: IDFormatWords, Length: 6}
+	if id := words.Generate(); len(strings.Split(id, IDWordSeparator)) != 6 {
+		t.Errorf("Expected 6 words, got %q", id)
+	}
+
+	for format, id := range map[IDFormat]string{
+		DefaultIDFormat():                             "too-short",
+		{Format: IDFormatBase64URL, Length: 9}:        "abc/../..",
+		{Format: IDFormatBase58, Length: 12}:          "0OIl0OIl0OIl",
+		{Format: IDFormatWords, Length: 6}:            "amber-falcon-notaword-lion-pearl-ruby",
+		{Format: IDFormatWords, Length: 2}:            "Acme.amber-falcon",
+		{Format: IDFormatBase64URL, Length: 4}:        ".abcd",
+		{Format: IDFormatWords, Length: 2, Digits: 3}: "amber-falcon-91",
+		{Format: IDFormatWords, Length: 3, Digits: 3}: "amber-falcon-917",
+		{Format: IDFormatWords, Length: 1, Digits: 3}: "amber-9x7",
+	} {
+		if format.Valid(id) {
+			t.Errorf("%+v: expected %q to be invalid", format, id)
+		}
+	}
+}
+
+// countingReader returns the byte values 0 to 255 in turn
+type countingReader struct{ next byte }
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = r.next
+		r.next++
+	}
+	return len(p), nil
+}
+
+func TestIDSampler_Uniform(t *testing.T) {
+	// Every byte value once per 256: values past the last whole multiple of n must be
+	// rejected for each index to come up equally often
+	for _, n := range []int{len(base58Alphabet), len(base64URLAlphabet), 10} {
+		sampler := idSampler{random: &countingReader{}}
+		counts := make(map[int]int)
+		for i := 0; i < n*100; i++ {
+			counts[sampler.intn(n)]++
+		}
+		for index := 0; index < n; index++ {
+			if counts[index] != 100 {
+				t.Errorf("n=%d: index %d drawn %d times, want 100", n, index, counts[index])
+				break
+			}
+		}
+	}
+}
+
+func TestIDFormat_GenerateAllocations(t *testing.T) {
+	format := DefaultIDFormat()
+	allocs := testing.AllocsPerRun(100, func() { format.Generate() })
+	t.Logf("%.0f allocations per ID, 49 with crypto/rand.Int", allocs)
+	if allocs > 1 {
+		t.Errorf("Expected only the ID string to be allocated, got %.0f allocations", allocs)
+	}
+}
+
+func TestIDFormat_Validate(t *testing.T) {
+	for _, format := range []IDFormat{
+		{Format: "hex", Length: 16},
+		{Format: IDFormatBase64URL, Length: 7},
+		{Format: IDFormatBase58, Length: MaxIDLength + 1},
+		{Format: IDFormatWords, Length: 5},
+		{Format: IDFormatWords, Length: 3, Digits: 3},
+		{Format: IDFormatWords, Length: 3, Digits: 3, MinEntropyBits: 31},
+		{Format: IDFormatWords, Length: 6, Digits: MaxIDDigits + 1},
+		{Format: IDFormatBase58, Length: 9, Digits: 3},
+	} {
+		if err := format.Validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", format)
+		}
+	}
+	for _, format := range []IDFormat{
+		DefaultIDFormat(),
+		{Format: IDFormatBase58, Length: 9},
+		(IDFormat{Format: IDFormatWords}).withDefaultLength(),
+		{Format: IDFormatWords, Length: 3, Digits: 3, MinEntropyBits: 32},
+	} {
+		if err := format.Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", format, err)
+		}
+	}
+}
+
+func TestIDFormat_Server(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.IDFormat = IDFormat{Format: IDFormatWords, Length: 8} })
+	router := srv.routes()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/secrets", strings.NewReader(`{"content": "encrypted"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	var created CreateSecretResponse
+	json.NewDecoder(rec.Body).Decode(&created)
+	if len(strings.Split(created.ID, IDWordSeparator)) != 8 {
+		t.Errorf("Expected a word ID, got %q", created.ID)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/secrets/"+created.ID, nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the secret to be found, got %d", rec.Code)
+	}
+
+	// A secret stored under an ID outside the format, and not a slug, can't be reached through the API
+	id, _ := srv.store.StoreWithOptions("encrypted", time.Hour, SecretOptions{ID: "ABCDEFGHIJKLMNOP"})
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/secrets/"+id+"/status", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected a malformed ID to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestLoadConfig_IDFormat(t *testing.T) {
+	cfg, err := loadConfig(nil, envMap(map[string]string{"ID_FORMAT": "base58"}))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.IDFormat != (IDFormat{Format: IDFormatBase58, Length: 16}) {
+		t.Errorf("Expected base58 with the default length, got %+v", cfg.IDFormat)
+	}
+
+	if _, err := loadConfig([]string{"--id-format", "words", "--id-length", "3"}, envMap(nil)); err == nil {
+		t.Error("Expected a too short ID length to be rejected")
+	}
+}
+
+func TestSecretStore_NewIDSkipsTakenIDs(t *testing.T) {
+	store := NewSecretStore()
+	// One word gives 256 IDs, take half of them
+	store.SetIDFormat(IDFormat{Format: IDFormatWords, Length: 1})
+	for _, word := range idWords[:128] {
+		if _, err := store.StoreWithOptions("x", time.Hour, SecretOptions{ID: word}); err != nil {
+			t.Fatalf("Failed to store secret: %v", err)
+		}
+	}
+
+	for i := 0; i < 20; i++ {
+		if id := store.NewID(""); store.idTaken(id) {
+			t.Fatalf("Expected an unused ID, got %q", id)
+		}
+	}
+}
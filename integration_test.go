@@ -4,19 +4,53 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
 
-func setupTestServer() *httptest.Server {
-	store = NewSecretStore() // Reset store for clean tests
-	return httptest.NewServer(setupRouter())
+// newTestServer creates a Server with default settings, adjusted by configure
+func newTestServer(t *testing.T, configure ...func(*Config)) *Server {
+	t.Helper()
+	cfg := DefaultConfig()
+	for _, fn := range configure {
+		fn(cfg)
+	}
+	srv, err := NewServer(cfg, nil)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// setupTestServer serves a new test Server over HTTP
+func setupTestServer(t *testing.T, configure ...func(*Config)) (*Server, *httptest.Server) {
+	t.Helper()
+	srv := newTestServer(t, configure...)
+	return srv, httptest.NewServer(srv.routes())
+}
+
+// claimSecretHTTP reads a secret from a running server the way the web UI does: it fetches the
+// metadata for a claim token, then claims the content
+func claimSecretHTTP(baseURL, id string) (*http.Response, error) {
+	var meta SecretMetadataResponse
+	resp, err := http.Get(baseURL + "/api/secrets/" + id)
+	if err != nil {
+		return nil, err
+	}
+	json.NewDecoder(resp.Body).Decode(&meta)
+	resp.Body.Close()
+
+	body, _ := json.Marshal(ClaimSecretRequest{ClaimToken: meta.ClaimToken})
+	return http.Post(baseURL+"/api/secrets/"+id+"/claim", "application/json", bytes.NewReader(body))
 }
 
 func TestFullSecretFlow(t *testing.T) {
-	server := setupTestServer()
+	_, server := setupTestServer(t)
 	defer server.Close()
 
 	// With client-side encryption, the server just stores encrypted content as-is
@@ -45,24 +79,21 @@ func TestFullSecretFlow(t *testing.T) {
 		t.Fatalf("Failed to decode create response: %v", err)
 	}
 
-	// Verify the secret via the verify endpoint
-	verifyReq := VerifySecretRequest{VerificationCode: "ABC123"}
-	verifyJsonBody, _ := json.Marshal(verifyReq)
-
-	verifyResp, err := http.Post(server.URL+"/api/secrets/"+createResp.ID+"/verify", "application/json", bytes.NewBuffer(verifyJsonBody))
+	// Claim the secret with a token from its metadata
+	claimResp, err := claimSecretHTTP(server.URL, createResp.ID)
 	if err != nil {
-		t.Fatalf("Failed to verify secret: %v", err)
+		t.Fatalf("Failed to claim secret: %v", err)
 	}
-	defer verifyResp.Body.Close()
+	defer claimResp.Body.Close()
 
-	if verifyResp.StatusCode != http.StatusOK {
-		t.Errorf("Expected status 200 for verify, got %d", verifyResp.StatusCode)
+	if claimResp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200 for claim, got %d", claimResp.StatusCode)
 	}
 
 	var getResp GetSecretResponse
-	err = json.NewDecoder(verifyResp.Body).Decode(&getResp)
+	err = json.NewDecoder(claimResp.Body).Decode(&getResp)
 	if err != nil {
-		t.Fatalf("Failed to decode verify response: %v", err)
+		t.Fatalf("Failed to decode claim response: %v", err)
 	}
 
 	// Content should be returned as-is (encrypted)
@@ -71,9 +102,9 @@ func TestFullSecretFlow(t *testing.T) {
 	}
 
 	// Try to access again - should fail since secret is deleted
-	secondResp, err := http.Post(server.URL+"/api/secrets/"+createResp.ID+"/verify", "application/json", bytes.NewBuffer(verifyJsonBody))
+	secondResp, err := claimSecretHTTP(server.URL, createResp.ID)
 	if err != nil {
-		t.Fatalf("Failed to make second verify request: %v", err)
+		t.Fatalf("Failed to make second claim request: %v", err)
 	}
 	defer secondResp.Body.Close()
 
@@ -83,21 +114,30 @@ func TestFullSecretFlow(t *testing.T) {
 }
 
 func TestDirectSecretRetrieval(t *testing.T) {
-	server := setupTestServer()
+	srv, server := setupTestServer(t)
 	defer server.Close()
 
 	// This test bypasses encryption by directly storing a secret in the store
 	// to test the retrieval mechanism
 	secretContent := base64.StdEncoding.EncodeToString([]byte("Direct retrieval test"))
-	secretID, err := store.Store(secretContent, 24*time.Hour)
+	secretID, err := srv.store.Store(secretContent, 24*time.Hour)
 	if err != nil {
 		t.Fatalf("Failed to store secret: %v", err)
 	}
 
-	// Test direct GET retrieval
-	resp, err := http.Get(server.URL + "/api/secrets/" + secretID)
+	// Fetching the link's API URL, as a scanner would, must not consume it
+	metaResp, err := http.Get(server.URL + "/api/secrets/" + secretID)
 	if err != nil {
-		t.Fatalf("Failed to get secret: %v", err)
+		t.Fatalf("Failed to get secret metadata: %v", err)
+	}
+	metaResp.Body.Close()
+	if srv.store.Count() != 1 {
+		t.Fatalf("Expected GET to leave the secret, got %d secrets", srv.store.Count())
+	}
+
+	resp, err := claimSecretHTTP(server.URL, secretID)
+	if err != nil {
+		t.Fatalf("Failed to claim secret: %v", err)
 	}
 	defer resp.Body.Close()
 
@@ -118,7 +158,7 @@ func TestDirectSecretRetrieval(t *testing.T) {
 }
 
 func TestHomePageHandler(t *testing.T) {
-	server := setupTestServer()
+	_, server := setupTestServer(t)
 	defer server.Close()
 
 	resp, err := http.Get(server.URL + "/")
@@ -138,7 +178,7 @@ func TestHomePageHandler(t *testing.T) {
 }
 
 func TestViewSecretPageHandler(t *testing.T) {
-	server := setupTestServer()
+	_, server := setupTestServer(t)
 	defer server.Close()
 
 	// Test with any ID (page should load regardless)
@@ -159,7 +199,7 @@ func TestViewSecretPageHandler(t *testing.T) {
 }
 
 func TestConcurrentSecretOperations(t *testing.T) {
-	server := setupTestServer()
+	srv, server := setupTestServer(t)
 	defer server.Close()
 
 	const numSecrets = 10
@@ -170,7 +210,7 @@ func TestConcurrentSecretOperations(t *testing.T) {
 	for i := 0; i < numSecrets; i++ {
 		go func(index int) {
 			secretContent := base64.StdEncoding.EncodeToString([]byte("Concurrent test secret"))
-			secretID, err := store.Store(secretContent, 24*time.Hour)
+			secretID, err := srv.store.Store(secretContent, 24*time.Hour)
 			if err != nil {
 				t.Errorf("Failed to store secret: %v", err)
 			}
@@ -192,7 +232,7 @@ func TestConcurrentSecretOperations(t *testing.T) {
 				return
 			}
 
-			resp, err := http.Get(server.URL + "/api/secrets/" + secretIDs[index])
+			resp, err := claimSecretHTTP(server.URL, secretIDs[index])
 			if err != nil {
 				t.Errorf("Failed to get secret %d: %v", index, err)
 				done <- false
@@ -215,3 +255,32 @@ func TestConcurrentSecretOperations(t *testing.T) {
 		<-done
 	}
 }
+
+func TestHomePageEmailNotificationField(t *testing.T) {
+	srv, server := setupTestServer(t)
+	defer server.Close()
+
+	fetch := func() string {
+		resp, err := http.Get(server.URL + "/")
+		if err != nil {
+			t.Fatalf("Failed to get home page: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	if strings.Contains(fetch(), `id="notifyEmail"`) {
+		t.Error("Expected no notification field when SMTP is not configured")
+	}
+
+	notifier, err := NewEmailNotifier(SMTPConfig{Host: "mail.example.com", Port: 25, From: "picosend@example.com"})
+	if err != nil {
+		t.Fatalf("Failed to create email notifier: %v", err)
+	}
+	srv.emailNotifier = notifier
+
+	if !strings.Contains(fetch(), `id="notifyEmail"`) {
+		t.Error("Expected notification field when SMTP is configured")
+	}
+}
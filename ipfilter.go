@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+const MaxIPRules = 32 // Maximum number of allowed plus denied networks per secret
+
+// IPFilter restricts which client addresses may retrieve a secret
+type IPFilter struct {
+	Allow []netip.Prefix // When non-empty, the client must be inside one of these networks
+	Deny  []netip.Prefix // Checked first, a match always rejects
+}
+
+// parseIPFilter builds a filter from CIDR ranges or single addresses. Returns nil when both lists are empty.
+func parseIPFilter(allow, deny []string) (*IPFilter, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+	if len(allow)+len(deny) > MaxIPRules {
+		return nil, fmt.Errorf("at most %d allowed_ips and denied_ips entries are supported", MaxIPRules)
+	}
+
+	allowed, err := parsePrefixes("allowed_ips", allow)
+	if err != nil {
+		return nil, err
+	}
+	denied, err := parsePrefixes("denied_ips", deny)
+	if err != nil {
+		return nil, err
+	}
+	return &IPFilter{Allow: allowed, Deny: denied}, nil
+}
+
+func parsePrefixes(field string, values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s entry %q is not an IP address or CIDR range", field, value)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s entry %q is not an IP address or CIDR range", field, value)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Allows reports whether addr may retrieve the secret. A nil filter allows everyone;
+// an invalid address is rejected by any filter.
+func (f *IPFilter) Allows(addr netip.Addr) bool {
+	if f == nil {
+		return true
+	}
+	if !addr.IsValid() {
+		return false
+	}
+
+	addr = addr.Unmap()
+	for _, prefix := range f.Deny {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	if len(f.Allow) == 0 {
+		return true
+	}
+	for _, prefix := range f.Allow {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
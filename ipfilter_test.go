@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestParseIPFilter(t *testing.T) {
+	filter, err := parseIPFilter(nil, nil)
+	if err != nil || filter != nil {
+		t.Errorf("Expected no filter for empty lists, got %v (%v)", filter, err)
+	}
+
+	filter, err = parseIPFilter([]string{"10.0.0.0/8", " 2001:db8::/32 "}, []string{"10.0.0.7"})
+	if err != nil {
+		t.Fatalf("Expected valid filter, got %v", err)
+	}
+
+	tests := []struct {
+		addr    string
+		allowed bool
+	}{
+		{"10.1.2.3", true},
+		{"::ffff:10.1.2.3", true}, // IPv4-mapped IPv6
+		{"10.0.0.7", false},       // Denied inside an allowed range
+		{"2001:db8::1", true},
+		{"192.0.2.1", false},
+	}
+	for _, tt := range tests {
+		if got := filter.Allows(netip.MustParseAddr(tt.addr)); got != tt.allowed {
+			t.Errorf("Expected Allows(%s) = %v, got %v", tt.addr, tt.allowed, got)
+		}
+	}
+
+	if filter.Allows(netip.Addr{}) {
+		t.Error("Expected an unknown client address to be rejected")
+	}
+
+	for _, invalid := range []string{"10.0.0.0/33", "not-an-ip", ""} {
+		if _, err := parseIPFilter([]string{invalid}, nil); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+func TestIPFilter_DenyOnly(t *testing.T) {
+	filter, err := parseIPFilter(nil, []string{"192.0.2.0/24"})
+	if err != nil {
+		t.Fatalf("Expected valid filter, got %v", err)
+	}
+	if filter.Allows(netip.MustParseAddr("192.0.2.1")) {
+		t.Error("Expected denied network to be rejected")
+	}
+	if !filter.Allows(netip.MustParseAddr("198.51.100.1")) {
+		t.Error("Expected other networks to be allowed")
+	}
+}
+
+func TestCreateSecretHandler_InvalidAllowedIPs(t *testing.T) {
+	srv := newTestServer(t)
+
+	jsonBody, _ := json.Marshal(CreateSecretRequest{Content: "encrypted", Lifetime: 60, AllowedIPs: []string{"10.0.0.0/99"}})
+	req := httptest.NewRequest("POST", "/api/secrets", bytes.NewBuffer(jsonBody))
+	w := httptest.NewRecorder()
+
+	srv.createSecretHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestRetrieval_OutsideAllowedNetwork(t *testing.T) {
+	srv := newTestServer(t)
+	filter, _ := parseIPFilter([]string{"10.0.0.0/8"}, nil)
+	secretID, err := srv.store.StoreWithOptions("encrypted content", 24*time.Hour, SecretOptions{IPFilter: filter})
+	if err != nil {
+		t.Fatalf("Failed to store secret: %v", err)
+	}
+
+	claim := func(remoteAddr string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(ClaimSecretRequest{ClaimToken: srv.claims.Issue(secretID, time.Now())})
+		req := httptest.NewRequest("POST", "/api/secrets/"+secretID+"/claim", bytes.NewBuffer(body))
+		req.RemoteAddr = remoteAddr
+		req = mux.SetURLVars(req, map[string]string{"id": secretID})
+		w := httptest.NewRecorder()
+		srv.claimSecretHandler(w, req)
+		return w
+	}
+
+	if w := claim("192.0.2.1:1234"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 outside the allowed network, got %d", w.Code)
+	}
+
+	// Rejected attempts must not burn the secret
+	if w := claim("10.1.2.3:1234"); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 inside the allowed network, got %d", w.Code)
+	}
+}
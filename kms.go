@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KMS key URI schemes
+const (
+	KMSVaultTransit = "vault-transit" // vault-transit://<key name>, optionally vault-transit://<mount>/<key name>
+	KMSAWS          = "aws-kms"       // aws-kms://<key ID, ARN or alias>
+	KMSGCP          = "gcp-kms"       // gcp-kms://projects/<p>/locations/<l>/keyRings/<r>/cryptoKeys/<k>
+)
+
+const (
+	KMSRequestTimeout = 10 * time.Second
+	// kmsEncryptionContext is bound to every data key wrapped by AWS or GCP KMS, so keys
+	// wrapped for another application can't be unwrapped through picosend
+	kmsEncryptionContext = "picosend-data-key"
+	gcpMetadataTokenURL  = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// KMSConfig selects a key management service that wraps per-secret data keys, instead of a
+// local master key. The master key then never leaves the KMS.
+type KMSConfig struct {
+	Key string // Key URI: vault-transit://, aws-kms:// or gcp-kms://; empty disables KMS
+
+	Region          string // AWS region for aws-kms
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // Optional, for temporary credentials
+}
+
+// Enabled reports whether a KMS key is configured
+func (c KMSConfig) Enabled() bool {
+	return c.Key != ""
+}
+
+// Validate checks the key URI and that the selected service has what it needs. vault-transit
+// keys use the Vault server of the vault settings.
+func (c KMSConfig) Validate(vault VaultConfig) error {
+	scheme, key, _ := strings.Cut(c.Key, "://")
+	if key == "" {
+		return fmt.Errorf("kms-key must be %s://, %s:// or %s:// followed by the key", KMSVaultTransit, KMSAWS, KMSGCP)
+	}
+	switch scheme {
+	case KMSVaultTransit:
+		if vault.Addr == "" || vault.Token == "" {
+			return errors.New("vault-addr and vault-token are required for a vault-transit kms-key")
+		}
+	case KMSAWS:
+		if c.Region == "" || c.AccessKeyID == "" || c.SecretAccessKey == "" {
+			return errors.New("kms-region, kms-access-key-id and kms-secret-access-key are required for an aws-kms kms-key")
+		}
+	case KMSGCP:
+		if !strings.HasPrefix(key, "projects/") || !strings.Contains(key, "/cryptoKeys/") {
+			return errors.New("gcp-kms key must be projects/<project>/locations/<location>/keyRings/<ring>/cryptoKeys/<key>")
+		}
+	default:
+		return fmt.Errorf("unknown kms-key scheme %q (expected %s, %s or %s)", scheme, KMSVaultTransit, KMSAWS, KMSGCP)
+	}
+	return nil
+}
+
+// NewKMSKeyWrapper creates the key wrapper for the configured service
+func NewKMSKeyWrapper(config KMSConfig, vault VaultConfig) (KeyWrapper, error) {
+	if err := config.Validate(vault); err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: KMSRequestTimeout}
+	scheme, key, _ := strings.Cut(config.Key, "://")
+	switch scheme {
+	case KMSVaultTransit:
+		mount, name, found := strings.Cut(key, "/")
+		if !found {
+			mount, name = "transit", key
+		}
+		return &vaultTransitWrapper{
+			base:   strings.TrimSuffix(vault.Addr, "/") + "/v1/" + mount,
+			key:    name,
+			token:  vault.Token,
+			client: client,
+		}, nil
+	case KMSAWS:
+		return &awsKMSWrapper{config: config, keyID: key, client: client, now: time.Now}, nil
+	default:
+		return &gcpKMSWrapper{key: key, client: client, tokenURL: gcpMetadataTokenURL, now: time.Now}, nil
+	}
+}
+
+// doKMSRequest sends req and decodes a 200 JSON response into out
+func doKMSRequest(client *http.Client, req *http.Request, out any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("kms returned status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func newKMSRequest(url string, body any) (*http.Request, []byte, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, data, nil
+}
+
+// vaultTransitWrapper wraps data keys with a HashiCorp Vault transit key
+type vaultTransitWrapper struct {
+	base   string // <addr>/v1/<mount>
+	key    string
+	token  string
+	client *http.Client
+}
+
+func (w *vaultTransitWrapper) call(operation string, body map[string]string) (map[string]string, error) {
+	req, _, err := newKMSRequest(w.base+"/"+operation+"/"+url.PathEscape(w.key), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", w.token)
+	var resp struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := doKMSRequest(w.client, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+func (w *vaultTransitWrapper) WrapKey(dataKey []byte) ([]byte, error) {
+	data, err := w.call("encrypt", map[string]string{"plaintext": base64.StdEncoding.EncodeToString(dataKey)})
+	if err != nil {
+		return nil, err
+	}
+	if data["ciphertext"] == "" {
+		return nil, errors.New("vault returned no ciphertext")
+	}
+	return []byte(data["ciphertext"]), nil
+}
+
+func (w *vaultTransitWrapper) UnwrapKey(wrapped []byte) ([]byte, error) {
+	data, err := w.call("decrypt", map[string]string{"ciphertext": string(wrapped)})
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(data["plaintext"])
+}
+
+// awsKMSWrapper wraps data keys with an AWS KMS key, signing requests like the S3 blob store
+type awsKMSWrapper struct {
+	config KMSConfig
+	keyID  string
+	client *http.Client
+	now    func() time.Time
+	url    string // Overrides the regional endpoint in tests
+}
+
+func (w *awsKMSWrapper) call(target string, body, out any) error {
+	endpoint := w.url
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://kms.%s.amazonaws.com/", w.config.Region)
+	}
+	req, data, err := newKMSRequest(endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+target)
+	if w.config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", w.config.SessionToken)
+	}
+	signAWSRequest(req, data, "kms", w.config.AccessKeyID, w.config.SecretAccessKey, w.config.Region, w.now())
+	return doKMSRequest(w.client, req, out)
+}
+
+func (w *awsKMSWrapper) WrapKey(dataKey []byte) ([]byte, error) {
+	var resp struct {
+		CiphertextBlob []byte
+	}
+	err := w.call("Encrypt", map[string]any{
+		"KeyId":             w.keyID,
+		"Plaintext":         dataKey,
+		"EncryptionContext": map[string]string{"purpose": kmsEncryptionContext},
+	}, &resp)
+	return resp.CiphertextBlob, err
+}
+
+func (w *awsKMSWrapper) UnwrapKey(wrapped []byte) ([]byte, error) {
+	var resp struct {
+		Plaintext []byte
+	}
+	err := w.call("Decrypt", map[string]any{
+		"KeyId":             w.keyID,
+		"CiphertextBlob":    wrapped,
+		"EncryptionContext": map[string]string{"purpose": kmsEncryptionContext},
+	}, &resp)
+	return resp.Plaintext, err
+}
+
+// gcpKMSWrapper wraps data keys with a Google Cloud KMS key. Access tokens come from the
+// metadata server of the instance's service account, as on GCE, GKE and Cloud Run.
+type gcpKMSWrapper struct {
+	key      string
+	client   *http.Client
+	tokenURL string
+	now      func() time.Time
+	url      string // Overrides https://cloudkms.googleapis.com in tests
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// accessToken returns a cached token, fetching a new one shortly before it expires
+func (w *gcpKMSWrapper) accessToken() (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.token != "" && w.now().Before(w.expires) {
+		return w.token, nil
+	}
+
+	req, err := http.NewRequest("GET", w.tokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	var resp struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := doKMSRequest(w.client, req, &resp); err != nil {
+		return "", fmt.Errorf("fetching gcp access token: %w", err)
+	}
+	w.token = resp.AccessToken
+	w.expires = w.now().Add(time.Duration(resp.ExpiresIn)*time.Second - time.Minute)
+	return w.token, nil
+}
+
+func (w *gcpKMSWrapper) call(operation string, body, out any) error {
+	token, err := w.accessToken()
+	if err != nil {
+		return err
+	}
+	base := w.url
+	if base == "" {
+		base = "https://cloudkms.googleapis.com"
+	}
+	req, _, err := newKMSRequest(base+"/v1/"+w.key+":"+operation, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return doKMSRequest(w.client, req, out)
+}
+
+func (w *gcpKMSWrapper) WrapKey(dataKey []byte) ([]byte, error) {
+	var resp struct {
+		Ciphertext []byte `json:"ciphertext"`
+	}
+	err := w.call("encrypt", map[string]any{
+		"plaintext":                   dataKey,
+		"additionalAuthenticatedData": []byte(kmsEncryptionContext),
+	}, &resp)
+	return resp.Ciphertext, err
+}
+
+func (w *gcpKMSWrapper) UnwrapKey(wrapped []byte) ([]byte, error) {
+	var resp struct {
+		Plaintext []byte `json:"plaintext"`
+	}
+	err := w.call("decrypt", map[string]any{
+		"ciphertext":                  wrapped,
+		"additionalAuthenticatedData": []byte(kmsEncryptionContext),
+	}, &resp)
+	return resp.Plaintext, err
+}
+
+// kmsCheck returns a readiness check that wraps and unwraps a throwaway key
+func kmsCheck(wrapper KeyWrapper) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		probe := make([]byte, DataKeyLength)
+		wrapped, err := wrapper.WrapKey(probe)
+		if err != nil {
+			return err
+		}
+		_, err = wrapper.UnwrapKey(wrapped)
+		return err
+	}
+}
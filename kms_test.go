@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeKMS wraps keys by handing out opaque handles, so a wrapped key is useless without it
+type fakeKMS struct {
+	mu   sync.Mutex
+	keys map[string][]byte
+	auth func(r *http.Request) bool
+}
+
+func newFakeKMS(auth func(r *http.Request) bool) *fakeKMS {
+	return &fakeKMS{keys: make(map[string][]byte), auth: auth}
+}
+
+func (f *fakeKMS) wrap(key []byte) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	handle := generateToken()
+	f.keys[handle] = key
+	return handle
+}
+
+func (f *fakeKMS) unwrap(handle string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key, ok := f.keys[handle]
+	return key, ok
+}
+
+func (f *fakeKMS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !f.auth(r) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	var body map[string]any
+	json.NewDecoder(r.Body).Decode(&body)
+	field := func(name string) []byte {
+		value, _ := body[name].(string)
+		data, _ := base64.StdEncoding.DecodeString(value)
+		return data
+	}
+
+	var resp any
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v1/transit/encrypt/"):
+		resp = map[string]any{"data": map[string]string{"ciphertext": "vault:v1:" + f.wrap(field("plaintext"))}}
+	case strings.HasPrefix(r.URL.Path, "/v1/transit/decrypt/"):
+		key, ok := f.unwrap(strings.TrimPrefix(body["ciphertext"].(string), "vault:v1:"))
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		resp = map[string]any{"data": map[string]string{"plaintext": base64.StdEncoding.EncodeToString(key)}}
+	case r.Header.Get("X-Amz-Target") == "TrentService.Encrypt" || strings.HasSuffix(r.URL.Path, ":encrypt"):
+		// AWS and GCP name the fields differently
+		handle := []byte(f.wrap(append(field("Plaintext"), field("plaintext")...)))
+		resp = map[string]any{"CiphertextBlob": handle, "ciphertext": handle}
+	case r.Header.Get("X-Amz-Target") == "TrentService.Decrypt" || strings.HasSuffix(r.URL.Path, ":decrypt"):
+		key, ok := f.unwrap(string(append(field("CiphertextBlob"), field("ciphertext")...)))
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		resp = map[string]any{"Plaintext": key, "plaintext": key}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func testKMSRoundTrip(t *testing.T, wrapper KeyWrapper) {
+	t.Helper()
+	encryptor := NewEnvelopeEncryptor(wrapper)
+	sealed, wrappedKey, err := encryptor.Seal("id1", []byte("ciphertext from client"))
+	if err != nil {
+		t.Fatalf("Failed to seal: %v", err)
+	}
+	content, err := encryptor.Open("id1", sealed, wrappedKey)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	if string(content) != "ciphertext from client" {
+		t.Errorf("Expected original content, got %q", content)
+	}
+	if err := kmsCheck(wrapper)(context.Background()); err != nil {
+		t.Errorf("Expected readiness check to pass, got %v", err)
+	}
+}
+
+func TestVaultTransitWrapper(t *testing.T) {
+	kms := newFakeKMS(func(r *http.Request) bool { return r.Header.Get("X-Vault-Token") == "test-token" })
+	server := httptest.NewServer(kms)
+	defer server.Close()
+
+	wrapper, err := NewKMSKeyWrapper(KMSConfig{Key: "vault-transit://picosend"}, VaultConfig{Addr: server.URL, Token: "test-token"})
+	if err != nil {
+		t.Fatalf("Failed to create wrapper: %v", err)
+	}
+	testKMSRoundTrip(t, wrapper)
+
+	denied, _ := NewKMSKeyWrapper(KMSConfig{Key: "vault-transit://picosend"}, VaultConfig{Addr: server.URL, Token: "wrong"})
+	if _, err := denied.WrapKey(make([]byte, DataKeyLength)); err == nil {
+		t.Error("Expected an error with a rejected token")
+	}
+}
+
+func TestAWSKMSWrapper(t *testing.T) {
+	kms := newFakeKMS(func(r *http.Request) bool {
+		return strings.Contains(r.Header.Get("Authorization"), "Credential=test-key/") &&
+			strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/kms/aws4_request") &&
+			r.Header.Get("X-Amz-Security-Token") == "session"
+	})
+	server := httptest.NewServer(kms)
+	defer server.Close()
+
+	wrapper, err := NewKMSKeyWrapper(KMSConfig{Key: "aws-kms://alias/picosend", Region: "eu-west-1",
+		AccessKeyID: "test-key", SecretAccessKey: "secret", SessionToken: "session"}, VaultConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create wrapper: %v", err)
+	}
+	wrapper.(*awsKMSWrapper).url = server.URL
+	testKMSRoundTrip(t, wrapper)
+}
+
+func TestGCPKMSWrapper(t *testing.T) {
+	var tokenRequests int
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		tokenRequests++
+		json.NewEncoder(w).Encode(map[string]any{"access_token": "gcp-token", "expires_in": 3600})
+	}))
+	defer metadata.Close()
+	kms := newFakeKMS(func(r *http.Request) bool { return r.Header.Get("Authorization") == "Bearer gcp-token" })
+	server := httptest.NewServer(kms)
+	defer server.Close()
+
+	wrapper, err := NewKMSKeyWrapper(KMSConfig{Key: "gcp-kms://projects/p/locations/global/keyRings/r/cryptoKeys/k"}, VaultConfig{})
+	if err != nil {
+		t.Fatalf("Failed to create wrapper: %v", err)
+	}
+	gcp := wrapper.(*gcpKMSWrapper)
+	gcp.url, gcp.tokenURL = server.URL, metadata.URL
+	testKMSRoundTrip(t, wrapper)
+	if tokenRequests != 1 {
+		t.Errorf("Expected the access token to be cached, fetched %d times", tokenRequests)
+	}
+
+	gcp.now = func() time.Time { return time.Now().Add(time.Hour) }
+	if _, err := wrapper.WrapKey(make([]byte, DataKeyLength)); err != nil || tokenRequests != 2 {
+		t.Errorf("Expected an expired token to be refreshed, got %v after %d fetches", err, tokenRequests)
+	}
+}
+
+func TestLoadConfig_KMS(t *testing.T) {
+	cfg, err := loadConfig([]string{"--kms-key", "vault-transit://picosend"},
+		envMap(map[string]string{"VAULT_ADDR": "http://vault:8200", "VAULT_TOKEN": "token"}))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.KMS.Key != "vault-transit://picosend" || cfg.Vault.Addr != "http://vault:8200" {
+		t.Errorf("Unexpected KMS config %+v", cfg.KMS)
+	}
+
+	for _, args := range [][]string{
+		{"--kms-key", "picosend"},
+		{"--kms-key", "azure-kv://picosend"},
+		{"--kms-key", "vault-transit://picosend"},
+		{"--kms-key", "aws-kms://alias/picosend", "--kms-region", "eu-west-1"},
+		{"--kms-key", "gcp-kms://picosend"},
+		{"--kms-key", "gcp-kms://projects/p/locations/global/keyRings/r/cryptoKeys/k",
+			"--encryption-key", base64.StdEncoding.EncodeToString(make([]byte, DataKeyLength))},
+	} {
+		if _, err := loadConfig(args, envMap(nil)); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
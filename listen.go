@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+const DefaultSocketMode = 0o660 // Unix sockets are shared with the reverse proxy's group
+
+type unixConnKey struct{}
+
+// isUnixSocketAddr reports whether a listen address is a Unix socket path rather than host:port
+func isUnixSocketAddr(addr string) bool {
+	return strings.HasPrefix(addr, "/") || strings.HasPrefix(addr, "./")
+}
+
+// validateListenAddrs checks each address is host:port or an absolute or ./ relative socket path
+func validateListenAddrs(addrs []string) error {
+	for _, addr := range addrs {
+		if isUnixSocketAddr(addr) {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("invalid listen address %q (expected host:port or a socket path)", addr)
+		}
+	}
+	return nil
+}
+
+// listen returns the sockets passed by systemd socket activation, or new listeners on addrs
+func (srv *Server) listen(addrs []string) ([]net.Listener, error) {
+	listeners, err := systemdListeners()
+	if err != nil || listeners != nil {
+		for _, listener := range listeners {
+			srv.logger.Info("Using socket from systemd", "addr", listener.Addr().String())
+		}
+		return listeners, err
+	}
+
+	for _, addr := range addrs {
+		bound, err := srv.listenOn(addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, bound...)
+	}
+	return listeners, nil
+}
+
+// listenOn binds addr, which may take several listeners when it names a network interface
+func (srv *Server) listenOn(addr string) ([]net.Listener, error) {
+	if !isUnixSocketAddr(addr) {
+		return listenTCP(addr)
+	}
+	listener, err := srv.listenUnix(addr)
+	if err != nil {
+		return nil, err
+	}
+	return []net.Listener{listener}, nil
+}
+
+// listenTCP binds a host:port address. Without a host it listens on all addresses, IPv4 and
+// IPv6 alike. An IP address binds only its own family, where Go would otherwise make 0.0.0.0
+// dual-stack too. A host naming a network interface binds each of the interface's addresses.
+func listenTCP(addr string) ([]net.Listener, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{listener}, nil
+	}
+
+	var ips []netip.Addr
+	if ip, err := netip.ParseAddr(host); err == nil {
+		ips = []netip.Addr{ip}
+	} else if ips, err = interfaceIPs(host); err != nil {
+		return nil, err
+	}
+	if ips == nil {
+		// A host name, bound to the first address it resolves to
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{listener}, nil
+	}
+
+	var listeners []net.Listener
+	for _, ip := range ips {
+		network := "tcp6"
+		if ip.Unmap().Is4() {
+			network, ip = "tcp4", ip.Unmap()
+		}
+		listener, err := net.Listen(network, net.JoinHostPort(ip.String(), port))
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// interfaceIPs returns the addresses of the network interface called name, with link-local
+// IPv6 addresses scoped to it, or nil if there is no such interface
+func interfaceIPs(name string) ([]netip.Addr, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, nil
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("listen on interface %s: %w", name, err)
+	}
+	var ips []netip.Addr
+	for _, addr := range addrs {
+		prefix, err := netip.ParsePrefix(addr.String())
+		if err != nil {
+			continue
+		}
+		ip := prefix.Addr()
+		if ip.Is6() && ip.IsLinkLocalUnicast() {
+			ip = ip.WithZone(name)
+		}
+		ips = append(ips, ip)
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("listen on interface %s: it has no addresses", name)
+	}
+	return ips, nil
+}
+
+func (srv *Server) listenUnix(addr string) (net.Listener, error) {
+
+	// A socket left behind by a crashed process would make the bind fail. Only sockets are
+	// removed, never a regular file given by mistake.
+	if info, err := os.Lstat(addr); err == nil && info.Mode()&fs.ModeSocket != 0 {
+		os.Remove(addr)
+	} else if err == nil {
+		return nil, fmt.Errorf("listen %s: file exists and is not a socket", addr)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(addr, srv.config.SocketMode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// markUnixConn records in the connection's context that it came through a Unix socket
+func markUnixConn(ctx context.Context, conn net.Conn) context.Context {
+	if _, ok := conn.(*net.UnixConn); ok {
+		return context.WithValue(ctx, unixConnKey{}, true)
+	}
+	return ctx
+}
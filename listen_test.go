@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServe_MultipleListeners(t *testing.T) {
+	dir, err := os.MkdirTemp("", "picosend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "picosend.sock")
+
+	// A stale socket from an earlier run is replaced
+	stale, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("Unix sockets unavailable: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	probe, _ := net.Listen("tcp", "127.0.0.1:0")
+	tcpAddr := probe.Addr().String()
+	probe.Close()
+
+	srv := newTestServer(t, func(cfg *Config) { cfg.Listen = []string{tcpAddr, socket} })
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- srv.serve(ctx, &http.Server{Handler: srv.routes()}, time.Minute)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	unixClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	for _, tt := range []struct {
+		name   string
+		client *http.Client
+		url    string
+	}{
+		{"tcp", http.DefaultClient, "http://" + tcpAddr + "/healthz"},
+		{"unix", unixClient, "http://picosend/healthz"},
+	} {
+		var resp *http.Response
+		for i := 0; i < 50; i++ {
+			if resp, err = tt.client.Get(tt.url); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", tt.name, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected status 200, got %d", tt.name, resp.StatusCode)
+		}
+	}
+
+	info, err := os.Stat(socket)
+	if err != nil || info.Mode().Perm() != DefaultSocketMode {
+		t.Errorf("Expected socket mode %o, got %v (%v)", DefaultSocketMode, info.Mode(), err)
+	}
+}
+
+func TestPeerAddr_UnixSocket(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "@"
+	if peerAddr(req).IsValid() {
+		t.Error("Expected no peer address for an unmarked request")
+	}
+	req = req.WithContext(context.WithValue(req.Context(), unixConnKey{}, true))
+	if addr := peerAddr(req); !addr.IsLoopback() {
+		t.Errorf("Expected a Unix socket peer to count as loopback, got %v", addr)
+	}
+}
+
+func TestLoadConfig_Listen(t *testing.T) {
+	cfg, err := loadConfig([]string{"--listen", "127.0.0.1:8080", "--listen", "/run/picosend.sock"},
+		envMap(map[string]string{"LISTEN": ":9090"}))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(cfg.Listen) != 2 || cfg.Listen[1] != "/run/picosend.sock" || cfg.SocketMode != DefaultSocketMode {
+		t.Errorf("Expected flags to replace LISTEN, got %v mode %o", cfg.Listen, cfg.SocketMode)
+	}
+
+	cfg, err = loadConfig(nil, envMap(map[string]string{"LISTEN": ":9090, /run/picosend.sock", "LISTEN_SOCKET_MODE": "0666"}))
+	if err != nil || len(cfg.Listen) != 2 || cfg.SocketMode != 0o666 {
+		t.Errorf("Expected two addresses from LISTEN and mode 0666, got %+v (%v)", cfg, err)
+	}
+
+	for _, args := range [][]string{{"--listen", "localhost"}, {"--listen-socket-mode", "rw"}, {"--listen-socket-mode", "1777"}} {
+		if _, err := loadConfig(args, envMap(nil)); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestListenTCP_AddressFamily(t *testing.T) {
+	listeners, err := listenTCP("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listeners[0].Close()
+	if len(listeners) != 1 || listeners[0].Addr().(*net.TCPAddr).IP.To4() == nil {
+		t.Errorf("Expected a single IPv4 listener, got %v", listeners)
+	}
+
+	// An interface binds each of its addresses
+	listeners, err = listenTCP("lo:0")
+	if err != nil {
+		t.Skipf("No loopback interface named lo: %v", err)
+	}
+	for _, l := range listeners {
+		defer l.Close()
+		if addr := l.Addr().(*net.TCPAddr); !addr.IP.IsLoopback() {
+			t.Errorf("Expected only loopback addresses, got %v", addr)
+		}
+	}
+	if len(listeners) == 0 {
+		t.Error("Expected listeners on the interface's addresses")
+	}
+}
+
+func TestLoadConfig_BindAddress(t *testing.T) {
+	cfg, err := loadConfig([]string{"--port", "9000"}, envMap(map[string]string{"BIND_ADDRESS": "0.0.0.0, ::1, eth0"}))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := []string{"0.0.0.0:9000", "[::1]:9000", "eth0:9000"}
+	if strings.Join(cfg.Listen, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected %v, got %v", want, cfg.Listen)
+	}
+
+	if _, err := loadConfig([]string{"--bind-address", "::", "--listen", ":8080"}, envMap(nil)); err == nil {
+		t.Error("Expected bind-address and listen to be rejected together")
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "json", slog.LevelDebug)
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	srv := newTestServer(t)
+	router := srv.routes()
+
+	req := httptest.NewRequest("GET", "/api/secrets/unknown/status", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	generated := w.Header().Get(RequestIDHeader)
+	if len(generated) != 16 {
+		t.Errorf("Expected generated 16-char request ID, got %q", generated)
+	}
+
+	req = httptest.NewRequest("GET", "/api/secrets/unknown/status", nil)
+	req.Header.Set(RequestIDHeader, "upstream-id.123")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Header().Get(RequestIDHeader) != "upstream-id.123" {
+		t.Errorf("Expected incoming request ID to be reused, got %q", w.Header().Get(RequestIDHeader))
+	}
+
+	req = httptest.NewRequest("GET", "/api/secrets/unknown/status", nil)
+	req.Header.Set(RequestIDHeader, "bad id\nwith newline")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Header().Get(RequestIDHeader) == "bad id\nwith newline" {
+		t.Error("Expected malformed request ID to be replaced")
+	}
+}
+
+func TestAccessLog_NeverLogsSecrets(t *testing.T) {
+	logs := captureLogs(t)
+	srv := newTestServer(t)
+	router := srv.routes()
+
+	id, _ := srv.store.Store("super-secret-ciphertext", 24*time.Hour)
+
+	req := httptest.NewRequest("GET", "/api/secrets/"+id, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	output := logs.String()
+	if strings.Contains(output, "super-secret-ciphertext") || strings.Contains(output, id) {
+		t.Errorf("Access log must not contain secret content or IDs: %s", output)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(output)), &entry); err != nil {
+		t.Fatalf("Expected a single JSON log line, got %q", output)
+	}
+	if entry["route"] != "/api/secrets/{id}" || entry["method"] != "GET" || entry["status"] != float64(200) {
+		t.Errorf("Unexpected access log entry: %v", entry)
+	}
+	if entry["request_id"] != w.Header().Get(RequestIDHeader) {
+		t.Errorf("Expected access log to include the request ID, got %v", entry["request_id"])
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for name, expected := range map[string]slog.Level{"debug": slog.LevelDebug, "INFO": slog.LevelInfo, "warn": slog.LevelWarn, "error": slog.LevelError} {
+		level, err := parseLogLevel(name)
+		if err != nil || level != expected {
+			t.Errorf("Expected %s to parse as %v, got %v (%v)", name, expected, level, err)
+		}
+	}
+
+	if _, err := parseLogLevel("verbose"); err == nil {
+		t.Error("Expected error for unknown log level")
+	}
+}
+
+func TestLoadConfig_Logging(t *testing.T) {
+	cfg, err := loadConfig([]string{"--log-level", "debug", "--log-format", "json"}, envMap(nil))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.LogLevel != slog.LevelDebug || cfg.LogFormat != "json" {
+		t.Errorf("Unexpected logging config: %v %s", cfg.LogLevel, cfg.LogFormat)
+	}
+
+	if _, err := loadConfig([]string{"--log-format", "xml"}, envMap(nil)); err == nil {
+		t.Error("Expected error for invalid log format")
+	}
+}
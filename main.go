@@ -1,21 +1,45 @@
 package main
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"embed"
 	"encoding/base64"
+	"errors"
 	"fmt"
-	"log"
-	"net/http"
+	"hash/maphash"
+	"io"
+	"log/slog"
+	"math/big"
+	"os"
+	"os/signal"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
-
-	"github.com/gorilla/mux"
 )
 
 const (
 	MaxSecretLength  = 65536 // Maximum secret content length in characters
 	MaxUnreadSecrets = 1000  // Maximum number of unread secrets in memory
+
+	MaxPassphraseHashLength  = 256  // Maximum length of a client-supplied passphrase hash
+	MaxReadsLimit            = 100  // Maximum number of times a single secret may be read
+	MaxAttemptsLimit         = 100  // Most wrong answers a secret can be set to survive
+	DefaultPINAttempts       = 5    // Wrong answers a secret with a pickup PIN survives when no limit is set
+	PINLength                = 6    // Digits in a pickup PIN
+	MaxSecretLabelLength     = 200  // Maximum length of a secret's label or reference
+	MaxDeletionMessageLength = 500  // Maximum length of the message shown once a secret is gone
+	MaxHideAfter             = 3600 // Longest auto-hide delay in seconds a sender can set
+
+	DefaultMinLifetime = 5           // Shortest secret lifetime in minutes
+	DefaultMaxLifetime = 7 * 24 * 60 // Longest secret lifetime in minutes (7 days)
+	DefaultLifetime    = 24 * 60     // Lifetime in minutes used when the request omits it (1 day)
+
+	ShutdownTimeout = 15 * time.Second // Time allowed for in-flight requests to drain on shutdown
 )
 
 //go:embed templates/*.html
@@ -24,50 +48,430 @@ var templatesFS embed.FS
 //go:embed static/*
 var staticFS embed.FS
 
+var (
+	ErrSecretNotFound         = errors.New("secret not found")
+	ErrInvalidManagementToken = errors.New("invalid management token")
+	ErrExpiryOutOfRange       = errors.New("expiry out of range")
+	ErrIDTaken                = errors.New("secret ID is taken")
+)
+
+// Secret types tell clients how to render decrypted content. Structured fields are
+// encrypted client-side together, so the server only ever sees the type.
+const (
+	SecretTypeText        = "text"
+	SecretTypeCredentials = "credentials" // JSON object with username, password, url and notes
+)
+
 type Secret struct {
-	ID        string    `json:"id"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
-	ExpiresAt time.Time `json:"expires_at"`
+	ID              string          `json:"id"`
+	Content         []byte          `json:"content"` // Backed by buffer while in the store
+	Type            string          `json:"type"`
+	CreatedAt       time.Time       `json:"created_at"`
+	ExpiresAt       time.Time       `json:"expires_at"`
+	Passphrase      *PassphraseHash `json:"-"`
+	PIN             *PassphraseHash `json:"-"` // argon2id hash of the pickup PIN, nil when none is required
+	TOTP            *TOTPGate       `json:"-"` // Seed reads must present a current code for, nil when none is required
+	ManagementToken [32]byte        `json:"-"` // SHA-256 of the sender's management token
+	MaxReads        int             `json:"max_reads"`
+	ReadsRemaining  int             `json:"reads_remaining"`
+	Webhook         *Webhook        `json:"-"`
+	NotifyEmail     string          `json:"-"`
+	WrappedKey      []byte          `json:"-"` // Data key for encryption at rest, nil when disabled
+	Blob            bool            `json:"-"` // Content lives in the blob store under the secret ID
+	IPFilter        *IPFilter       `json:"-"` // Networks allowed to retrieve the secret, nil allows any
+	Readers         *ReaderFilter   `json:"-"` // Signed-in accounts allowed to retrieve the secret, nil allows anyone
+	NotBefore       time.Time       `json:"-"` // The secret can't be read before this time; zero means immediately
+	Recipient       string          `json:"-"` // Fingerprint of the public key the content is encrypted to, empty for link keys
+	Label           string          `json:"-"` // Sender's non-sensitive label, never shown to recipients
+	Reference       string          `json:"-"` // Sender's reference such as a ticket number, never shown to recipients
+	Display         DisplayOptions  `json:"-"` // How the view page shows the revealed content
+	DeletionMessage string          `json:"-"` // Public note shown on the view page once the secret is burned or expired
+	RemindAt        time.Time       `json:"-"` // When to remind the sender the secret is still unread; zero for none or once sent
+	AttemptsLeft    int             `json:"-"` // Wrong passphrases, PINs or codes left before the secret is destroyed; 0 for no limit
+	Canary          bool            `json:"-"` // Decoy whose reveals alert the sender instead of using up reads
+	MaxLifetime     time.Duration   `json:"-"` // Longest lifetime from creation the sender may extend to; 0 for the server's
+	Reads           []ReadRecord    `json:"-"` // Summary of each read so far, reported to the sender
+	Fingerprints    Fingerprints    `json:"-"` // Creator and content hashes matched against the blocklist
+	Replica         bool            `json:"-"` // Copy of a secret created on another cluster node, which reports its expiry
+
+	buffer        *lockedBuffer // Protected memory holding Content; nil for copies and empty content
+	size          int           // Bytes of Content counted against MaxStoreBytes
+	reservation   string        // Token of the cluster read holding the secret, see ReserveReplica; empty for none
+	reservedUntil time.Time     // When the reservation lapses if its read never completes
+}
+
+// SecretOptions holds optional per-secret settings supplied at creation time
+type SecretOptions struct {
+	ID              string        // ID to store the secret under; empty generates one
+	PassphraseHash  string        // Client-side hash of the passphrase; empty means no passphrase
+	PIN             string        // Pickup PIN the recipient must enter; empty means none
+	TOTPSecret      []byte        // TOTP seed the recipient must present a code for; nil means none
+	ManagementToken string        // Token allowing the sender to manage the secret; empty disables management
+	MaxReads        int           // Number of reads before the secret is deleted; 0 means a single read
+	Webhook         *Webhook      // Callback notified when the secret is read, expires or is burned
+	NotifyEmail     string        // Address emailed when the secret is read or expires unread
+	IPFilter        *IPFilter     // Networks allowed to retrieve the secret; nil allows any
+	Readers         *ReaderFilter // Signed-in accounts allowed to retrieve the secret; nil allows anyone
+	Type            string        // How clients render the content; empty means SecretTypeText
+	NotBefore       time.Time     // Time before which the secret can't be read; zero means immediately
+	Recipient       string        // Fingerprint of the recipient key the client encrypted to; empty for link keys
+	Tenant          string        // Tenant the generated ID is scoped to; empty for none
+	TenantMaxUnread int           // Unread secrets the ID's tenant may hold; 0 means only the store limit applies
+	Label           string        // Sender's label, reported with the management token and in receipts
+	Reference       string        // Sender's reference, reported with the management token and in receipts
+	Display         DisplayOptions
+	DeletionMessage string        // Public note shown on the view page once the secret is burned or expired
+	RemindBefore    time.Duration // Time before expiry the sender is reminded of an unread secret; 0 for no reminder
+	CreatorHash     string        // Fingerprint of the creator's network, see AbuseDesk.CreatorHash; empty for none
+	MaxAttempts     int           // Wrong passphrases, PINs or codes after which the secret is destroyed; 0 for no limit, or DefaultPINAttempts with a PIN
+	Canary          bool          // Decoy that alerts the sender each time it is revealed, see TripCanary
+	MaxLifetime     time.Duration // Longest lifetime from creation SetExpiry allows; 0 for the server's
+
+	restore *ExportedSecret // State carried over by Import, applied before the secret is visible
+	replica bool            // Copy sent by another cluster node, not replicated again
+}
+
+// DisplayOptions tell the view page how to show revealed content. They are not sensitive and
+// only bind the page this server serves; API clients get the content regardless.
+type DisplayOptions struct {
+	HideAfter  int  // Seconds the content stays visible once revealed; 0 keeps it shown
+	HoldToView bool // The content is only shown while the recipient holds a button down
+}
+
+// Limits are store limits that can be adjusted at runtime
+type Limits struct {
+	MaxSecretLength  int `json:"max_secret_length"`  // Maximum plaintext length; encrypted content may be twice as long
+	MaxUnreadSecrets int `json:"max_unread_secrets"` // Maximum number of unread secrets in memory
+	MinLifetime      int `json:"min_lifetime"`       // Shortest allowed lifetime in minutes
+	MaxLifetime      int `json:"max_lifetime"`       // Longest allowed lifetime in minutes
+	DefaultLifetime  int `json:"default_lifetime"`   // Lifetime in minutes used when none is requested
+	MaxStoreBytes    int `json:"max_store_bytes"`    // Total content bytes held in memory; 0 means only MaxUnreadSecrets applies
+}
+
+// DefaultLimits returns the built-in store limits
+func DefaultLimits() Limits {
+	return Limits{
+		MaxSecretLength:  MaxSecretLength,
+		MaxUnreadSecrets: MaxUnreadSecrets,
+		MinLifetime:      DefaultMinLifetime,
+		MaxLifetime:      DefaultMaxLifetime,
+		DefaultLifetime:  DefaultLifetime,
+	}
+}
+
+// Validate checks that the limits are positive and the lifetime bounds are consistent
+func (l Limits) Validate() error {
+	if l.MaxSecretLength <= 0 || l.MaxUnreadSecrets <= 0 || l.MinLifetime <= 0 {
+		return errors.New("limits must be positive")
+	}
+	if l.MaxStoreBytes < 0 {
+		return errors.New("max_store_bytes must not be negative")
+	}
+	if l.MinLifetime > l.MaxLifetime {
+		return errors.New("min_lifetime must not exceed max_lifetime")
+	}
+	if l.DefaultLifetime < l.MinLifetime || l.DefaultLifetime > l.MaxLifetime {
+		return errors.New("default_lifetime must be between min_lifetime and max_lifetime")
+	}
+	return nil
 }
 
+// SecretStore holds secrets in memory, partitioned into shards by ID so concurrent
+// operations on different secrets rarely contend for the same lock
 type SecretStore struct {
-	mu      sync.RWMutex
-	secrets map[string]*Secret
+	shards []*storeShard
+	seed   maphash.Seed
+	count  atomic.Int64 // Secrets across all shards, checked against MaxUnreadSecrets
+	bytes  atomic.Int64 // Content bytes held in memory across all shards, checked against MaxStoreBytes
+
+	tenantCounts sync.Map // Tenant name -> *atomic.Int64 of its secrets, checked against TenantMaxUnread
+
+	// Settings are read on every operation, so they are swapped atomically rather than locked
+	settings   atomic.Pointer[storeSettings]
+	settingsMu sync.Mutex // Serializes settings updates
+
+	// Held for reading from sealing or copying a wrapped data key until it is stored or
+	// opened, so a rekey doesn't retire a master key something is still wrapped under
+	sealing sync.RWMutex
+	rekeyMu sync.Mutex // Serializes rekeys
+
+	blobDeletes sync.WaitGroup
+}
+
+// storeSettings is an immutable snapshot of a store's configuration
+type storeSettings struct {
+	limits         Limits
+	listeners      []func(SecretEvent)
+	encryptor      *EnvelopeEncryptor // Encrypts content at rest; nil when disabled
+	blobs          BlobStore          // Holds large content outside memory; nil when disabled
+	blobThreshold  int                // Minimum content size moved to blobs
+	idFormat       IDFormat           // Format of generated IDs
+	idRandom       io.Reader          // Source generated IDs are drawn from
+	evictionPolicy string             // What a create does when the store is full; empty rejects it
+	replicator     Replicator         // Copies changes to the other nodes of a cluster; nil when alone
+}
+
+// updateSettings applies fn to a copy of the current settings and publishes the result
+func (s *SecretStore) updateSettings(fn func(*storeSettings)) {
+	s.settingsMu.Lock()
+	defer s.settingsMu.Unlock()
+
+	next := *s.settings.Load()
+	fn(&next)
+	s.settings.Store(&next)
 }
 
 func NewSecretStore() *SecretStore {
-	return &SecretStore{
-		secrets: make(map[string]*Secret),
+	return newShardedSecretStore(StoreShards)
+}
+
+// newShardedSecretStore creates a store with n shards, each remembering its share of MaxTombstones
+func newShardedSecretStore(n int) *SecretStore {
+	s := &SecretStore{
+		shards: make([]*storeShard, n),
+		seed:   maphash.MakeSeed(),
 	}
+	s.settings.Store(&storeSettings{limits: DefaultLimits(), idFormat: DefaultIDFormat(), idRandom: rand.Reader})
+	for i := range s.shards {
+		s.shards[i] = newStoreShard(MaxUnreadSecrets/n, MaxTombstones/n)
+	}
+	return s
 }
 
 func (s *SecretStore) Store(content string, lifetime time.Duration) (string, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.StoreWithOptions(content, lifetime, SecretOptions{})
+}
+
+// StoreWithOptions stores a secret with the given per-secret options
+func (s *SecretStore) StoreWithOptions(content string, lifetime time.Duration, opts SecretOptions) (string, error) {
+	return s.storeContent([]byte(content), lifetime, opts)
+}
+
+// storeContent stores a secret, taking ownership of content: it is copied into protected
+// memory and the caller's slice is zeroed
+func (s *SecretStore) storeContent(content []byte, lifetime time.Duration, opts SecretOptions) (string, error) {
+	defer wipeBytes(content)
+	s.sealing.RLock()
+	defer s.sealing.RUnlock()
+
+	// Other cluster nodes get the content as the client sent it, they seal it themselves
+	replicator := s.getReplicator()
+	var replicated []byte
+	if replicator != nil && !opts.replica {
+		replicated = append([]byte(nil), content...)
+		defer wipeBytes(replicated)
+	}
+	prints := Fingerprints{Creator: opts.CreatorHash, Content: contentHash(content)}
+
+	// Derive the passphrase key before taking the lock, argon2id is deliberately slow
+	var passphrase, pin *PassphraseHash
+	if opts.PassphraseHash != "" {
+		var err error
+		if passphrase, err = hashPassphrase(opts.PassphraseHash); err != nil {
+			return "", err
+		}
+	}
+	// A six-digit PIN could be guessed within a secret's lifetime, so it always has a limit
+	attempts := opts.MaxAttempts
+	if opts.PIN != "" {
+		var err error
+		if pin, err = hashPassphrase(opts.PIN); err != nil {
+			return "", err
+		}
+		if attempts == 0 {
+			attempts = DefaultPINAttempts
+		}
+	}
+	var totp *TOTPGate
+	if opts.TOTPSecret != nil {
+		totp = newTOTPGate(opts.TOTPSecret)
+	}
+
+	id := opts.ID
+	if id == "" {
+		id = s.NewID(opts.Tenant)
+	}
+	// Hold the ID while the content is sealed and offloaded under it, so a concurrent create
+	// of the same slug fails instead of overwriting this one's blob
+	sh, key := s.shardFor(id), keyOf(id)
+	if !sh.claimID(key) {
+		return "", ErrIDTaken
+	}
+	defer sh.unclaimID(key)
+
+	// Seal the content at rest before taking the lock, the key wrapper may be remote
+	var wrappedKey []byte
+	if encryptor := s.getEncryptor(); encryptor != nil {
+		sealed, wrapped, err := encryptor.Seal(id, content)
+		if err != nil {
+			return "", fmt.Errorf("failed to encrypt secret: %w", err)
+		}
+		defer wipeBytes(sealed)
+		content, wrappedKey = sealed, wrapped
+	}
+
+	// Offload large content before taking the lock, the blob store is remote
+	blob := false
+	if blobs := s.blobStoreFor(len(content)); blobs != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), BlobRequestTimeout)
+		err := blobs.Put(ctx, id, content, time.Now().Add(lifetime))
+		cancel()
+		if err != nil {
+			return "", fmt.Errorf("failed to store secret content: %w", err)
+		}
+		content, blob = nil, true
+	}
+
+	// Reserve a slot and the content's bytes before inserting so concurrent creates can't
+	// overshoot the limits. The eviction policy may make room in a full store.
+	limits, size := s.Limits(), len(content)
+	err := s.reserve(size, limits)
+	for err != nil && s.evictFor(size, limits) {
+		err = s.reserve(size, limits)
+	}
+	if err != nil {
+		if blob {
+			s.deleteBlobAsync(id)
+		}
+		return "", err
+	}
+	if tenant := tenantOf(id); tenant != "" {
+		held := s.tenantCounter(tenant).Add(1)
+		if opts.TenantMaxUnread > 0 && held > int64(opts.TenantMaxUnread) {
+			s.release(id, size)
+			if blob {
+				s.deleteBlobAsync(id)
+			}
+			return "", ErrTenantFull
+		}
+	}
+
+	maxReads := opts.MaxReads
+	if maxReads <= 0 {
+		maxReads = 1
+	}
 
-	// Check if we've reached the maximum number of unread secrets
-	if len(s.secrets) >= MaxUnreadSecrets {
-		return "", fmt.Errorf("maximum number of unread secrets (%d) reached", MaxUnreadSecrets)
+	secretType := opts.Type
+	if secretType == "" {
+		secretType = SecretTypeText
 	}
 
-	id := generateID()
+	buffer := newLockedBuffer(content)
 	now := time.Now()
 	secret := &Secret{
-		ID:        id,
-		Content:   content,
-		CreatedAt: now,
-		ExpiresAt: now.Add(lifetime),
+		ID:              id,
+		Content:         buffer.Bytes(),
+		Type:            secretType,
+		CreatedAt:       now,
+		ExpiresAt:       now.Add(lifetime),
+		Passphrase:      passphrase,
+		PIN:             pin,
+		TOTP:            totp,
+		MaxReads:        maxReads,
+		ReadsRemaining:  maxReads,
+		Webhook:         opts.Webhook,
+		NotifyEmail:     opts.NotifyEmail,
+		WrappedKey:      wrappedKey,
+		Blob:            blob,
+		IPFilter:        opts.IPFilter,
+		Readers:         opts.Readers,
+		NotBefore:       opts.NotBefore,
+		Recipient:       opts.Recipient,
+		Label:           opts.Label,
+		Reference:       opts.Reference,
+		Display:         opts.Display,
+		DeletionMessage: opts.DeletionMessage,
+		AttemptsLeft:    attempts,
+		Canary:          opts.Canary,
+		MaxLifetime:     opts.MaxLifetime,
+		Fingerprints:    prints,
+		Replica:         opts.replica,
+		buffer:          buffer,
+		size:            size,
+	}
+	if opts.ManagementToken != "" {
+		secret.ManagementToken = sha256.Sum256([]byte(opts.ManagementToken))
+	}
+	if opts.RemindBefore > 0 {
+		secret.RemindAt = secret.ExpiresAt.Add(-opts.RemindBefore)
+	}
+	if opts.restore != nil {
+		opts.restore.restoreTo(secret)
+	}
+
+	// The claim on the ID kept it free
+	sh.mu.Lock()
+	sh.secrets[key] = secret
+	sh.scheduleExpiry(key, secret)
+	sh.mu.Unlock()
+	if replicated != nil {
+		if err := s.replicate(replicator, id, secret, replicated); err != nil {
+			return "", err
+		}
 	}
-	s.secrets[id] = secret
 	return id, nil
 }
 
 func (s *SecretStore) Get(id string) (*Secret, bool) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.GetWithReader(id, ReadRecord{})
+}
+
+// GetWithReader is Get, recording a summary of the reader for the sender. The record's time
+// is set to the time of the read.
+func (s *SecretStore) GetWithReader(id string, reader ReadRecord) (*Secret, bool) {
+	s.sealing.RLock()
+	defer s.sealing.RUnlock()
+	var reservation string
+	if replicator := s.getReplicator(); replicator != nil {
+		var ok bool
+		if reservation, ok = s.consumeReplicas(replicator, id, reader); !ok {
+			return nil, false
+		}
+	}
+	secret, found := s.take(id, reader, reservation)
+	if !found {
+		return nil, false
+	}
+	return s.open(id, secret)
+}
+
+// open loads and unseals the content of a copy returned by take, outside the shard lock
+func (s *SecretStore) open(id string, secret *Secret) (*Secret, bool) {
+	// Load offloaded content outside the lock
+	if secret.Blob {
+		data, err := s.fetchBlob(id, secret.ReadsRemaining <= 0)
+		if err != nil {
+			slog.Error("Failed to load secret content", "error", err)
+			return nil, false
+		}
+		secret.Content = data
+	}
 
-	secret, exists := s.secrets[id]
+	// Decrypt the at-rest layer outside the lock
+	if secret.WrappedKey != nil {
+		content, err := s.getEncryptor().Open(id, secret.Content, secret.WrappedKey)
+		wipeBytes(secret.WrappedKey)
+		wipeBytes(secret.Content)
+		secret.WrappedKey = nil
+		if err != nil {
+			slog.Error("Failed to decrypt secret at rest", "error", err)
+			return nil, false
+		}
+		secret.Content = content
+	}
+
+	return secret, true
+}
+
+// take consumes one read of a secret and returns a copy of it, content still sealed if
+// encryption at rest is enabled. The copy lives on the heap; callers wipe it once sent. In a
+// cluster, reservation is the token of the read holding the secret, see consumeReplicas.
+func (s *SecretStore) take(id string, reader ReadRecord, reservation string) (*Secret, bool) {
+	sh := s.shardFor(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	secret, exists := sh.secrets[keyOf(id)]
 	if !exists {
 		return nil, false
 	}
@@ -75,142 +479,468 @@ func (s *SecretStore) Get(id string) (*Secret, bool) {
 	// Check if secret has expired
 	if time.Now().After(secret.ExpiresAt) {
 		// Wipe and delete expired secret
-		wipeSecret(secret)
-		delete(s.secrets, id)
+		s.remove(sh, id, secret, StatusExpired)
 		return nil, false
 	}
 
-	// Create a copy of the secret for return
-	secretCopy := &Secret{
-		ID:        secret.ID,
-		Content:   secret.Content,
-		CreatedAt: secret.CreatedAt,
-		ExpiresAt: secret.ExpiresAt,
+	now := time.Now()
+	if !secret.releaseRead(reservation, now) {
+		return nil, false
 	}
+	secret.ReadsRemaining--
+	reader.Time = now
+	secret.Reads = append(secret.Reads, reader)
+	s.emit(StatusRead, id, secret, now)
 
-	// Wipe the original secret's content from memory
-	wipeSecret(secret)
+	secretCopy := secret.readCopy()
 
-	// Delete the secret from the store
-	delete(s.secrets, id)
+	// Once the last read is used, wipe the original secret's content from memory and delete it from the store
+	if secret.ReadsRemaining <= 0 {
+		s.remove(sh, id, secret, StatusRead)
+	}
 
 	return secretCopy, true
 }
 
-// wipeSecret securely overwrites secret data and creates a new secret with wiped content
+// readCopy returns a copy of the secret to hand to its reader, with its own copy of the content
+func (secret *Secret) readCopy() *Secret {
+	return &Secret{
+		ID:             secret.ID,
+		Content:        append([]byte(nil), secret.Content...),
+		Type:           secret.Type,
+		CreatedAt:      secret.CreatedAt,
+		ExpiresAt:      secret.ExpiresAt,
+		MaxReads:       secret.MaxReads,
+		ReadsRemaining: secret.ReadsRemaining,
+		WrappedKey:     append([]byte(nil), secret.WrappedKey...),
+		Blob:           secret.Blob,
+		Recipient:      secret.Recipient,
+	}
+}
+
+// Peek returns a copy of the secret metadata without its content and without consuming it
+func (s *SecretStore) Peek(id string) (*Secret, bool) {
+	sh := s.shardFor(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	secret, exists := sh.secrets[keyOf(id)]
+	if !exists {
+		return nil, false
+	}
+
+	if time.Now().After(secret.ExpiresAt) {
+		s.remove(sh, id, secret, StatusExpired)
+		return nil, false
+	}
+
+	return &Secret{
+		ID:             secret.ID,
+		Type:           secret.Type,
+		CreatedAt:      secret.CreatedAt,
+		ExpiresAt:      secret.ExpiresAt,
+		Passphrase:     secret.Passphrase.clone(),
+		PIN:            secret.PIN.clone(),
+		TOTP:           secret.TOTP, // Only compared with nil, codes are checked by VerifyTOTP
+		MaxReads:       secret.MaxReads,
+		ReadsRemaining: secret.ReadsRemaining,
+		IPFilter:       secret.IPFilter,
+		Readers:        secret.Readers,
+		NotBefore:      secret.NotBefore,
+		Recipient:      secret.Recipient,
+		Display:        secret.Display,
+		AttemptsLeft:   secret.AttemptsLeft,
+		Canary:         secret.Canary,
+		MaxLifetime:    secret.MaxLifetime,
+	}, true
+}
+
+// PeekContent returns a copy of the secret with its content, unsealed, without consuming a
+// read. It lets a key be checked against the ciphertext before a read is committed. The copy
+// lives on the heap; callers wipe it.
+func (s *SecretStore) PeekContent(id string) (*Secret, bool) {
+	s.sealing.RLock()
+	defer s.sealing.RUnlock()
+	sh := s.shardFor(id)
+	sh.mu.Lock()
+	secret, exists := sh.secrets[keyOf(id)]
+	if !exists || time.Now().After(secret.ExpiresAt) {
+		sh.mu.Unlock()
+		return nil, false
+	}
+	// The read isn't used, so open leaves an offloaded blob in place
+	secretCopy := secret.readCopy()
+	sh.mu.Unlock()
+	return s.open(id, secretCopy)
+}
+
+// Burn wipes and deletes a secret before it is read, provided the management token matches
+func (s *SecretStore) Burn(id, managementToken string) error {
+	if err := s.burn(id, managementToken); err != nil {
+		return err
+	}
+	if replicator := s.getReplicator(); replicator != nil {
+		replicator.Burn(id)
+	}
+	return nil
+}
+
+func (s *SecretStore) burn(id, managementToken string) error {
+	sh := s.shardFor(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	secret, exists := sh.secrets[keyOf(id)]
+	if !exists {
+		return ErrSecretNotFound
+	}
+
+	if time.Now().After(secret.ExpiresAt) {
+		s.remove(sh, id, secret, StatusExpired)
+		return ErrSecretNotFound
+	}
+
+	if !secret.checkManagementToken(managementToken) {
+		return ErrInvalidManagementToken
+	}
+
+	s.remove(sh, id, secret, StatusBurned)
+	return nil
+}
+
+// SetExpiry moves the expiry of a secret, provided the management token matches. The new
+// expiry must be after any time lock and within maxLifetime of the secret's creation;
+// otherwise ErrExpiryOutOfRange is returned. A pending expiry reminder moves with it.
+func (s *SecretStore) SetExpiry(id, managementToken string, expiresAt time.Time, maxLifetime time.Duration) error {
+	if err := s.setExpiry(id, managementToken, expiresAt, maxLifetime); err != nil {
+		return err
+	}
+	if replicator := s.getReplicator(); replicator != nil {
+		replicator.SetExpiry(id, expiresAt)
+	}
+	return nil
+}
+
+func (s *SecretStore) setExpiry(id, managementToken string, expiresAt time.Time, maxLifetime time.Duration) error {
+	sh := s.shardFor(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	secret, exists := sh.secrets[keyOf(id)]
+	if !exists {
+		return ErrSecretNotFound
+	}
+
+	if time.Now().After(secret.ExpiresAt) {
+		s.remove(sh, id, secret, StatusExpired)
+		return ErrSecretNotFound
+	}
+
+	if !secret.checkManagementToken(managementToken) {
+		return ErrInvalidManagementToken
+	}
+
+	if secret.MaxLifetime > 0 {
+		maxLifetime = min(maxLifetime, secret.MaxLifetime)
+	}
+	if expiresAt.After(secret.CreatedAt.Add(maxLifetime)) || !secret.NotBefore.Before(expiresAt) {
+		return ErrExpiryOutOfRange
+	}
+	if !secret.RemindAt.IsZero() {
+		secret.RemindAt = secret.RemindAt.Add(expiresAt.Sub(secret.ExpiresAt))
+	}
+	secret.ExpiresAt = expiresAt
+	sh.scheduleExpiry(keyOf(id), secret)
+	if secret.Blob {
+		s.updateBlobExpiryAsync(id, secret.CreatedAt, expiresAt)
+	}
+	return nil
+}
+
+// checkManagementToken compares the token against the stored hash in constant time
+func (secret *Secret) checkManagementToken(token string) bool {
+	return checkTokenHash(secret.ManagementToken, token)
+}
+
+// checkTokenHash compares a token against its stored SHA-256 hash in constant time. A zero
+// hash matches no token.
+func checkTokenHash(stored [32]byte, token string) bool {
+	var zero [32]byte
+	if token == "" || stored == zero {
+		return false
+	}
+	hash := sha256.Sum256([]byte(token))
+	return subtle.ConstantTimeCompare(hash[:], stored[:]) == 1
+}
+
+// wipeSecret zeroes a secret's content and clears its sensitive fields. Content held in
+// protected memory is zeroed and released; heap content is zeroed in place.
 func wipeSecret(secret *Secret) {
 	if secret == nil {
 		return
 	}
 
-	// Create byte slices to overwrite
-	contentBytes := []byte(secret.Content)
-	idBytes := []byte(secret.ID)
-
-	// Overwrite the byte slices with zeros
-	for i := range contentBytes {
-		contentBytes[i] = 0
-	}
-	for i := range idBytes {
-		idBytes[i] = 0
+	if secret.buffer != nil {
+		secret.buffer.Destroy()
+		secret.buffer = nil
+	} else {
+		wipeBytes(secret.Content)
 	}
+	secret.Content = nil
 
-	// Replace the string fields with empty strings
-	// This doesn't guarantee the original strings are wiped but provides some protection
-	secret.Content = ""
+	// IDs are strings and can't be zeroed, they are not secret on their own
 	secret.ID = ""
+
+	secret.Passphrase.wipe()
+	secret.Passphrase = nil
+	secret.PIN.wipe()
+	secret.PIN = nil
+	secret.TOTP.wipe()
+	secret.TOTP = nil
+	secret.ManagementToken = [32]byte{}
+	secret.Webhook = nil
+	secret.NotifyEmail = ""
+	wipeBytes(secret.WrappedKey)
+	secret.WrappedKey = nil
+	secret.IPFilter = nil
+	secret.Readers = nil
+}
+
+// SetEncryptor enables encryption at rest for secrets stored from now on
+func (s *SecretStore) SetEncryptor(encryptor *EnvelopeEncryptor) {
+	s.updateSettings(func(settings *storeSettings) { settings.encryptor = encryptor })
+}
+
+func (s *SecretStore) getEncryptor() *EnvelopeEncryptor {
+	return s.settings.Load().encryptor
+}
+
+// Limits returns the current store limits
+func (s *SecretStore) Limits() Limits {
+	return s.settings.Load().limits
+}
+
+// SetLimits replaces the store limits. Secrets already stored are kept even if they exceed the new limits.
+func (s *SecretStore) SetLimits(limits Limits) {
+	s.updateSettings(func(settings *storeSettings) { settings.limits = limits })
 }
 
 func (s *SecretStore) Count() int {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
-	return len(s.secrets)
+	return int(s.count.Load())
 }
 
-func (s *SecretStore) CleanupExpired() int {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// BytesUsed returns the content bytes held in memory, counted against MaxStoreBytes. Content
+// offloaded to the blob store isn't included.
+func (s *SecretStore) BytesUsed() int {
+	return int(s.bytes.Load())
+}
+
+// TenantCount returns the number of unread secrets scoped to tenant
+func (s *SecretStore) TenantCount(tenant string) int {
+	return int(s.tenantCounter(tenant).Load())
+}
+
+func (s *SecretStore) tenantCounter(tenant string) *atomic.Int64 {
+	counter, _ := s.tenantCounts.LoadOrStore(tenant, new(atomic.Int64))
+	return counter.(*atomic.Int64)
+}
 
+// reserve takes a slot and size bytes for a new secret, or reports which limit is reached
+func (s *SecretStore) reserve(size int, limits Limits) error {
+	if s.count.Add(1) > int64(limits.MaxUnreadSecrets) {
+		s.count.Add(-1)
+		return fmt.Errorf("maximum number of unread secrets (%d) reached", limits.MaxUnreadSecrets)
+	}
+	if used := s.bytes.Add(int64(size)); limits.MaxStoreBytes > 0 && used > int64(limits.MaxStoreBytes) {
+		s.count.Add(-1)
+		s.bytes.Add(-int64(size))
+		inUse := int(used) - size
+		return fmt.Errorf("memory budget of %s reached, %s in use (%d%%)",
+			formatBytes(limits.MaxStoreBytes), formatBytes(inUse), inUse*100/limits.MaxStoreBytes)
+	}
+	return nil
+}
+
+// reserveBytes takes size bytes of the memory budget for content not yet stored as a secret,
+// such as chunks of a pending upload
+func (s *SecretStore) reserveBytes(size int) error {
+	limits := s.Limits()
+	if used := s.bytes.Add(int64(size)); limits.MaxStoreBytes > 0 && used > int64(limits.MaxStoreBytes) {
+		s.bytes.Add(-int64(size))
+		return fmt.Errorf("memory budget of %s reached", formatBytes(limits.MaxStoreBytes))
+	}
+	return nil
+}
+
+// releaseBytes returns size bytes taken with reserveBytes
+func (s *SecretStore) releaseBytes(size int) {
+	s.bytes.Add(-int64(size))
+}
+
+// release frees the slots and the size bytes held by the secret stored under id
+func (s *SecretStore) release(id string, size int) {
+	s.count.Add(-1)
+	s.bytes.Add(-int64(size))
+	if tenant := tenantOf(id); tenant != "" {
+		s.tenantCounter(tenant).Add(-1)
+	}
+}
+
+// CleanupExpired removes expired secrets and sends due expiry reminders. Returns the number
+// of secrets removed.
+func (s *SecretStore) CleanupExpired() int {
 	now := time.Now()
 	count := 0
 
-	for id, secret := range s.secrets {
-		if now.After(secret.ExpiresAt) {
-			wipeSecret(secret)
-			delete(s.secrets, id)
-			count++
+	// Lock one shard at a time so cleanup never stalls the whole store. Only secrets whose
+	// expiry or reminder has come up are visited.
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for {
+			secret, ok := sh.nextDue(now)
+			if !ok {
+				break
+			}
+			if now.After(secret.ExpiresAt) {
+				s.remove(sh, secret.ID, secret, StatusExpired)
+				count++
+			} else if !secret.RemindAt.IsZero() && !now.Before(secret.RemindAt) {
+				// Only secrets nobody has opened yet are worth a reminder
+				if secret.ReadsRemaining == secret.MaxReads {
+					s.emit(EventExpiring, secret.ID, secret, now)
+				}
+				secret.RemindAt = time.Time{}
+			}
 		}
+		sh.compactExpiries()
+		sh.pruneTombstones(now)
+		s.pruneRetained(sh, now)
+		sh.mu.Unlock()
 	}
 
 	return count
 }
 
-func generateID() string {
-	bytes := make([]byte, 12) // 12 bytes = 16 chars in base64url (vs 32 chars in hex)
-	rand.Read(bytes)
-	return base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString(bytes)
+// WipeAll wipes and removes every secret in the store. Returns the number of secrets wiped.
+// The other nodes of a cluster keep their copies, see Purge.
+func (s *SecretStore) WipeAll() int {
+	return len(s.wipeAll())
 }
 
-var store = NewSecretStore()
-
-// setupRouter creates and configures the HTTP router with all routes.
-// This is exported for testing purposes.
-func setupRouter() *mux.Router {
-	r := mux.NewRouter()
-
-	// Static files
-	r.PathPrefix("/static/").Handler(http.FileServer(http.FS(staticFS)))
-	r.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
-		data, err := staticFS.ReadFile("static/robots.txt")
-		if err != nil {
-			http.Error(w, "File not found", http.StatusNotFound)
-			return
+// Purge wipes every secret like WipeAll and burns them on the other nodes of a cluster too
+func (s *SecretStore) Purge() int {
+	ids := s.wipeAll()
+	if replicator := s.getReplicator(); replicator != nil {
+		for _, id := range ids {
+			replicator.Burn(id)
 		}
-		w.Header().Set("Content-Type", "text/plain")
-		w.Write(data)
-	}).Methods("GET")
-
-	// Views
-	r.HandleFunc("/", homeHandler).Methods("GET")
-	r.HandleFunc("/s/{id}", viewSecretHandler).Methods("GET")
-
-	// API
-	r.HandleFunc("/api/secrets", createSecretHandler).Methods("POST")
-	r.HandleFunc("/api/secrets/{id}", getSecretHandler).Methods("GET")
-	r.HandleFunc("/api/secrets/{id}/verify", verifySecretHandler).Methods("POST")
-
-	return r
-}
-
-// runCleanupWorker runs the cleanup loop with a configurable interval.
-// It stops when the stop channel is closed. Returns the total number of secrets cleaned.
-func runCleanupWorker(interval time.Duration, stop <-chan struct{}) int {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-
-	total := 0
-	for {
-		select {
-		case <-ticker.C:
-			count := store.CleanupExpired()
-			if count > 0 {
-				log.Printf("Cleaned up %d expired secrets", count)
+	}
+	return len(ids)
+}
+
+// wipeAll wipes and removes every secret in the store and returns their IDs
+func (s *SecretStore) wipeAll() []string {
+	var ids []string
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for key, secret := range sh.secrets {
+			id, size := secret.ID, secret.size
+			if secret.Blob {
+				s.deleteBlobAsync(id)
 			}
-			total += count
-		case <-stop:
-			return total
+			wipeSecret(secret)
+			delete(sh.secrets, key)
+			s.release(id, size)
+			ids = append(ids, id)
+		}
+		for key, retained := range sh.retained {
+			s.dropRetained(sh, key, retained)
 		}
+		sh.tombstones = make(map[secretKey]*tombstone)
+		sh.tombstoneOrder = nil
+		sh.expiries = nil
+		sh.mu.Unlock()
 	}
+
+	// This runs on shutdown, let blob deletions finish before the process exits
+	s.blobDeletes.Wait()
+
+	return ids
+}
+
+func generateID() string {
+	bytes := make([]byte, 12) // 12 bytes = 16 chars in base64url (vs 32 chars in hex)
+	rand.Read(bytes)
+	return base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString(bytes)
 }
 
-func startCleanupWorker() {
-	runCleanupWorker(1*time.Minute, make(chan struct{}))
+// generateToken returns a random URL-safe token, used for management tokens and webhook keys
+func generateToken() string {
+	bytes := make([]byte, 24) // 24 bytes = 32 chars in base64url
+	rand.Read(bytes)
+	return base64.URLEncoding.WithPadding(base64.NoPadding).EncodeToString(bytes)
+}
+
+// generatePIN returns a random numeric pickup PIN of PINLength digits
+func generatePIN() string {
+	digits := make([]byte, PINLength)
+	for i := range digits {
+		n, _ := rand.Int(rand.Reader, big.NewInt(10))
+		digits[i] = byte('0' + n.Int64())
+	}
+	return string(digits)
 }
 
 func main() {
-	go startCleanupWorker()
+	// Client subcommands share the binary with the server
+	if len(os.Args) > 1 && slices.Contains([]string{"send", "read", "keygen", "register", "export", "import", "rekey", "version"}, os.Args[1]) {
+		os.Exit(runCLI(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+	}
 
-	r := setupRouter()
-	fmt.Println("Server starting on :8080")
-	log.Fatal(http.ListenAndServe(":8080", r))
+	cfg := mustLoadConfig()
+
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(cfg.LogLevel)
+	logger, err := newLogger(os.Stderr, cfg.LogFormat, logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+
+	if !memoryLockAvailable() {
+		slog.Warn("Secret memory can't be locked and may be swapped to disk; raise the memlock limit (ulimit -l) to prevent this")
+	}
+
+	srv, err := NewServer(cfg, logger)
+	if err != nil {
+		slog.Error("Failed to start server", "error", err)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// A node joining the cluster or coming back from a restart picks up the pending secrets
+	if srv.cluster != nil {
+		go func() {
+			count, err := srv.cluster.Sync(srv.store)
+			if err != nil {
+				slog.Warn("Failed to sync secrets from the cluster", "error", err)
+				return
+			}
+			slog.Info("Synced secrets from the cluster", "count", count)
+		}()
+	}
+
+	go watchConfig(ctx, cfg.ConfigFile, ConfigWatchInterval, func() {
+		reloadConfig(srv, logLevel, func() (*Config, error) { return loadConfig(os.Args[1:], os.Getenv) })
+	})
+
+	err = srv.Run(ctx)
+	srv.Close()
+	if err != nil {
+		slog.Error("Server stopped", "error", err)
+		os.Exit(1)
+	}
 }
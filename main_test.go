@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"strings"
 	"testing"
 	"time"
 )
@@ -39,7 +42,7 @@ func TestSecretStore_Get(t *testing.T) {
 		t.Error("Expected to find the secret")
 	}
 	
-	if secret.Content != content {
+	if string(secret.Content) != content {
 		t.Errorf("Expected content '%s', got '%s'", content, secret.Content)
 	}
 	
@@ -130,7 +133,7 @@ func TestSecretStore_Concurrent(t *testing.T) {
 				t.Errorf("Goroutine %d: Expected to find the secret", i)
 			}
 			
-			if secret.Content != content {
+			if string(secret.Content) != content {
 				t.Errorf("Goroutine %d: Expected content '%s', got '%s'", i, content, secret.Content)
 			}
 			
@@ -173,6 +176,36 @@ func TestSecretStore_MaxLimit(t *testing.T) {
 	}
 }
 
+func TestSecretStore_MaxStoreBytes(t *testing.T) {
+	store := NewSecretStore()
+	limits := DefaultLimits()
+	limits.MaxStoreBytes = 100
+	store.SetLimits(limits)
+
+	id, err := store.Store(strings.Repeat("a", 60), time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := store.Store(strings.Repeat("b", 50), time.Hour); err == nil || !strings.Contains(err.Error(), "60%") {
+		t.Errorf("Expected the memory budget to be reported as 60%% used, got %v", err)
+	}
+	if store.Count() != 1 || store.BytesUsed() != 60 {
+		t.Errorf("Expected a rejected secret not to be counted, got %d secrets of %d bytes", store.Count(), store.BytesUsed())
+	}
+	if _, err := store.Store(strings.Repeat("c", 40), time.Hour); err != nil {
+		t.Errorf("Expected a secret within the budget to be stored, got %v", err)
+	}
+
+	store.Get(id)
+	if store.BytesUsed() != 40 {
+		t.Errorf("Expected a read secret's bytes to be released, got %d", store.BytesUsed())
+	}
+	store.WipeAll()
+	if store.BytesUsed() != 0 {
+		t.Errorf("Expected no bytes in use after wiping, got %d", store.BytesUsed())
+	}
+}
+
 func TestSecretStore_MemoryCleanup(t *testing.T) {
 	store := NewSecretStore()
 
@@ -368,24 +401,24 @@ func TestWipeSecret_EmptySecret(t *testing.T) {
 	// Test wipeSecret with empty strings
 	secret := &Secret{
 		ID:      "",
-		Content: "",
+		Content: nil,
 	}
 	wipeSecret(secret)
 
 	if secret.ID != "" {
 		t.Error("Expected ID to remain empty")
 	}
-	if secret.Content != "" {
+	if len(secret.Content) != 0 {
 		t.Error("Expected Content to remain empty")
 	}
 }
 
 func TestRunCleanupWorker_CleansExpiredSecrets(t *testing.T) {
-	store = NewSecretStore() // Reset global store
+	srv := newTestServer(t)
 
 	// Store secrets with very short lifetime
 	for i := 0; i < 5; i++ {
-		_, err := store.Store("expired secret", 1*time.Millisecond)
+		_, err := srv.store.Store("expired secret", 1*time.Millisecond)
 		if err != nil {
 			t.Fatalf("Failed to store secret: %v", err)
 		}
@@ -393,15 +426,15 @@ func TestRunCleanupWorker_CleansExpiredSecrets(t *testing.T) {
 
 	// Store secrets with long lifetime
 	for i := 0; i < 3; i++ {
-		_, err := store.Store("valid secret", 24*time.Hour)
+		_, err := srv.store.Store("valid secret", 24*time.Hour)
 		if err != nil {
 			t.Fatalf("Failed to store secret: %v", err)
 		}
 	}
 
 	// Verify initial count
-	if store.Count() != 8 {
-		t.Fatalf("Expected 8 secrets, got %d", store.Count())
+	if srv.store.Count() != 8 {
+		t.Fatalf("Expected 8 secrets, got %d", srv.store.Count())
 	}
 
 	// Wait for short-lived secrets to expire
@@ -412,7 +445,7 @@ func TestRunCleanupWorker_CleansExpiredSecrets(t *testing.T) {
 	done := make(chan int)
 
 	go func() {
-		total := runCleanupWorker(10*time.Millisecond, stop)
+		total := srv.runCleanupWorker(10*time.Millisecond, stop)
 		done <- total
 	}()
 
@@ -428,19 +461,19 @@ func TestRunCleanupWorker_CleansExpiredSecrets(t *testing.T) {
 	}
 
 	// Should have 3 secrets remaining
-	if store.Count() != 3 {
-		t.Errorf("Expected 3 secrets remaining, got %d", store.Count())
+	if srv.store.Count() != 3 {
+		t.Errorf("Expected 3 secrets remaining, got %d", srv.store.Count())
 	}
 }
 
 func TestRunCleanupWorker_StopsOnSignal(t *testing.T) {
-	store = NewSecretStore() // Reset global store
+	srv := newTestServer(t)
 
 	stop := make(chan struct{})
 	done := make(chan bool)
 
 	go func() {
-		runCleanupWorker(100*time.Millisecond, stop)
+		srv.runCleanupWorker(100*time.Millisecond, stop)
 		done <- true
 	}()
 
@@ -457,11 +490,11 @@ func TestRunCleanupWorker_StopsOnSignal(t *testing.T) {
 }
 
 func TestRunCleanupWorker_NoExpiredSecrets(t *testing.T) {
-	store = NewSecretStore() // Reset global store
+	srv := newTestServer(t)
 
 	// Store only long-lived secrets
 	for i := 0; i < 3; i++ {
-		_, err := store.Store("valid secret", 24*time.Hour)
+		_, err := srv.store.Store("valid secret", 24*time.Hour)
 		if err != nil {
 			t.Fatalf("Failed to store secret: %v", err)
 		}
@@ -471,7 +504,7 @@ func TestRunCleanupWorker_NoExpiredSecrets(t *testing.T) {
 	done := make(chan int)
 
 	go func() {
-		total := runCleanupWorker(10*time.Millisecond, stop)
+		total := srv.runCleanupWorker(10*time.Millisecond, stop)
 		done <- total
 	}()
 
@@ -487,19 +520,19 @@ func TestRunCleanupWorker_NoExpiredSecrets(t *testing.T) {
 	}
 
 	// All secrets should remain
-	if store.Count() != 3 {
-		t.Errorf("Expected 3 secrets remaining, got %d", store.Count())
+	if srv.store.Count() != 3 {
+		t.Errorf("Expected 3 secrets remaining, got %d", srv.store.Count())
 	}
 }
 
 func TestRunCleanupWorker_EmptyStore(t *testing.T) {
-	store = NewSecretStore() // Reset global store
+	srv := newTestServer(t)
 
 	stop := make(chan struct{})
 	done := make(chan int)
 
 	go func() {
-		total := runCleanupWorker(10*time.Millisecond, stop)
+		total := srv.runCleanupWorker(10*time.Millisecond, stop)
 		done <- total
 	}()
 
@@ -512,4 +545,296 @@ func TestRunCleanupWorker_EmptyStore(t *testing.T) {
 	if total != 0 {
 		t.Errorf("Expected 0 secrets cleaned from empty store, got %d", total)
 	}
-}
\ No newline at end of file
+}
+
+func TestSecretStore_WipeAll(t *testing.T) {
+	store := NewSecretStore()
+
+	for i := 0; i < 3; i++ {
+		if _, err := store.Store("secret", 24*time.Hour); err != nil {
+			t.Fatalf("Failed to store secret: %v", err)
+		}
+	}
+
+	if wiped := store.WipeAll(); wiped != 3 {
+		t.Errorf("Expected 3 secrets wiped, got %d", wiped)
+	}
+
+	if store.Count() != 0 {
+		t.Errorf("Expected empty store after WipeAll, got %d", store.Count())
+	}
+}
+
+func TestServe_ShutdownWipesSecrets(t *testing.T) {
+	srv := newTestServer(t)
+
+	if _, err := srv.store.Store("secret", 24*time.Hour); err != nil {
+		t.Fatalf("Failed to store secret: %v", err)
+	}
+
+	httpServer := &http.Server{Addr: "127.0.0.1:0", Handler: srv.routes()}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- srv.serve(ctx, httpServer, time.Minute)
+	}()
+
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected clean shutdown, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Server did not shut down in time")
+	}
+
+	if srv.store.Count() != 0 {
+		t.Errorf("Expected store to be wiped on shutdown, got %d secrets", srv.store.Count())
+	}
+}
+
+func TestServe_ListenError(t *testing.T) {
+	srv := newTestServer(t)
+
+	httpServer := &http.Server{Addr: "invalid-address", Handler: srv.routes()}
+
+	err := srv.serve(context.Background(), httpServer, time.Minute)
+	if err == nil {
+		t.Error("Expected error for invalid listen address")
+	}
+}
+
+func TestSecretStore_Peek(t *testing.T) {
+	store := NewSecretStore()
+
+	id, err := store.StoreWithOptions("secret", 24*time.Hour, SecretOptions{PassphraseHash: "hash"})
+	if err != nil {
+		t.Fatalf("Failed to store secret: %v", err)
+	}
+
+	meta, found := store.Peek(id)
+	if !found {
+		t.Fatal("Expected to find the secret")
+	}
+	if len(meta.Content) != 0 {
+		t.Error("Expected Peek not to return content")
+	}
+	matches, _ := meta.Passphrase.Matches("hash")
+	mismatches, _ := meta.Passphrase.Matches("other")
+	if !matches || mismatches {
+		t.Error("Expected passphrase to match only the original hash")
+	}
+
+	// Peek must not consume the secret
+	if store.Count() != 1 {
+		t.Errorf("Expected 1 secret after Peek, got %d", store.Count())
+	}
+}
+
+func TestSecretStore_Burn(t *testing.T) {
+	store := NewSecretStore()
+
+	id, err := store.StoreWithOptions("secret", 24*time.Hour, SecretOptions{ManagementToken: "token"})
+	if err != nil {
+		t.Fatalf("Failed to store secret: %v", err)
+	}
+
+	if err := store.Burn(id, "wrong"); err != ErrInvalidManagementToken {
+		t.Errorf("Expected ErrInvalidManagementToken, got %v", err)
+	}
+
+	if err := store.Burn(id, "token"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+
+	if err := store.Burn(id, "token"); err != ErrSecretNotFound {
+		t.Errorf("Expected ErrSecretNotFound, got %v", err)
+	}
+}
+
+func TestSecretStore_BurnWithoutToken(t *testing.T) {
+	store := NewSecretStore()
+
+	id, err := store.Store("secret", 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to store secret: %v", err)
+	}
+
+	// Secrets created without a management token can never be burned
+	if err := store.Burn(id, ""); err != ErrInvalidManagementToken {
+		t.Errorf("Expected ErrInvalidManagementToken, got %v", err)
+	}
+}
+
+func TestSecretStore_Status(t *testing.T) {
+	store := NewSecretStore()
+
+	readID, _ := store.Store("secret", 24*time.Hour)
+	burnedID, _ := store.StoreWithOptions("secret", 24*time.Hour, SecretOptions{ManagementToken: "token"})
+	expiredID, _ := store.Store("secret", 1*time.Millisecond)
+
+	state, found := store.Status(readID)
+	if !found || state.Status != StatusUnread {
+		t.Fatalf("Expected unread status, got %+v", state)
+	}
+	if store.Count() != 3 {
+		t.Fatalf("Expected Status not to consume secrets, got %d", store.Count())
+	}
+
+	store.Get(readID)
+	store.Burn(burnedID, "token")
+	time.Sleep(5 * time.Millisecond)
+	store.CleanupExpired()
+
+	tests := map[string]SecretStatus{
+		readID:    StatusRead,
+		burnedID:  StatusBurned,
+		expiredID: StatusExpired,
+	}
+	for id, expected := range tests {
+		state, found := store.Status(id)
+		if !found {
+			t.Errorf("Expected status for %s to be remembered", expected)
+			continue
+		}
+		if state.Status != expected {
+			t.Errorf("Expected status %s, got %s", expected, state.Status)
+		}
+		if state.ClosedAt.IsZero() {
+			t.Errorf("Expected ClosedAt to be set for %s secret", expected)
+		}
+	}
+
+	if _, found := store.Status("nonexistent"); found {
+		t.Error("Expected unknown ID not to have a status")
+	}
+}
+
+func TestSecretStore_TombstoneLimit(t *testing.T) {
+	store := NewSecretStore()
+
+	first, _ := store.Store("secret", 24*time.Hour)
+	store.Get(first)
+
+	// Each shard keeps its share of MaxTombstones, so overfill every shard
+	for i := 0; i < 2*MaxTombstones; i++ {
+		id, _ := store.Store("secret", 24*time.Hour)
+		store.Get(id)
+	}
+
+	if _, found := store.Status(first); found {
+		t.Error("Expected oldest tombstone to be evicted")
+	}
+	if tombstones := store.Stats().Tombstones; tombstones > MaxTombstones {
+		t.Errorf("Expected at most %d tombstones, got %d", MaxTombstones, tombstones)
+	}
+}
+
+func TestSecretStore_MaxReads(t *testing.T) {
+	store := NewSecretStore()
+
+	id, err := store.StoreWithOptions("secret", 24*time.Hour, SecretOptions{MaxReads: 3})
+	if err != nil {
+		t.Fatalf("Failed to store secret: %v", err)
+	}
+
+	for i := 2; i >= 0; i-- {
+		secret, found := store.Get(id)
+		if !found {
+			t.Fatalf("Expected secret to be readable with %d reads remaining", i+1)
+		}
+		if secret.ReadsRemaining != i {
+			t.Errorf("Expected %d reads remaining, got %d", i, secret.ReadsRemaining)
+		}
+
+		state, _ := store.Status(id)
+		if i > 0 && (state.Status != StatusUnread || state.ReadsRemaining != i) {
+			t.Errorf("Expected unread status with %d reads remaining, got %+v", i, state)
+		}
+	}
+
+	if _, found := store.Get(id); found {
+		t.Error("Expected secret to be deleted after the last read")
+	}
+
+	state, found := store.Status(id)
+	if !found || state.Status != StatusRead || state.MaxReads != 3 {
+		t.Errorf("Expected read status with max_reads 3, got %+v", state)
+	}
+}
+
+func TestSecretStore_MaxReadsConcurrent(t *testing.T) {
+	store := NewSecretStore()
+
+	id, err := store.StoreWithOptions("secret", 24*time.Hour, SecretOptions{MaxReads: 5})
+	if err != nil {
+		t.Fatalf("Failed to store secret: %v", err)
+	}
+
+	results := make(chan bool, 20)
+	for i := 0; i < 20; i++ {
+		go func() {
+			_, found := store.Get(id)
+			results <- found
+		}()
+	}
+
+	reads := 0
+	for i := 0; i < 20; i++ {
+		if <-results {
+			reads++
+		}
+	}
+
+	if reads != 5 {
+		t.Errorf("Expected exactly 5 successful reads, got %d", reads)
+	}
+}
+
+func TestSecretStore_EvictionPolicy(t *testing.T) {
+	for _, policy := range []string{EvictionSoonestExpiry, EvictionOldest} {
+		store := NewSecretStore()
+		limits := DefaultLimits()
+		limits.MaxUnreadSecrets = 2
+		store.SetLimits(limits)
+		store.SetEvictionPolicy(policy)
+		var evicted []string
+		store.Subscribe(func(event SecretEvent) {
+			if event.Type == StatusEvicted {
+				evicted = append(evicted, event.ID)
+			}
+		})
+
+		first, _ := store.Store("first", 2*time.Hour)
+		second, _ := store.Store("second", time.Hour)
+		if _, err := store.Store("third", 3*time.Hour); err != nil {
+			t.Fatalf("%s: expected a full store to make room, got %v", policy, err)
+		}
+
+		expected := second
+		if policy == EvictionOldest {
+			expected = first
+		}
+		if len(evicted) != 1 || evicted[0] != expected {
+			t.Errorf("%s: expected %s to be evicted, got %v", policy, expected, evicted)
+		}
+		if state, _ := store.Status(expected); state.Status != StatusEvicted {
+			t.Errorf("%s: expected the evicted secret's status to be evicted, got %s", policy, state.Status)
+		}
+		if store.Count() != 2 {
+			t.Errorf("%s: expected 2 secrets, got %d", policy, store.Count())
+		}
+	}
+
+	store := NewSecretStore()
+	limits := DefaultLimits()
+	limits.MaxUnreadSecrets = 1
+	store.SetLimits(limits)
+	store.Store("first", time.Hour)
+	if _, err := store.Store("second", time.Hour); err == nil {
+		t.Error("Expected the reject policy to refuse secrets when full")
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// managementHandler returns the routes served on the management listener, mounted under the
+// configured base path like Handler. Keeping them off the public listeners means exposing the
+// main port, on purpose or by a proxy misconfiguration, never exposes the admin API or probes.
+func (srv *Server) managementHandler() http.Handler {
+	return mountHandler(srv.config.BasePath, srv.managementRoutes())
+}
+
+// managementRoutes creates the router with the health probes and admin routes, relative to
+// the base path
+func (srv *Server) managementRoutes() *mux.Router {
+	r := mux.NewRouter()
+	r.NotFoundHandler = notFoundHandler()
+	r.MethodNotAllowedHandler = methodNotAllowedHandler()
+	r.Use(requestIDMiddleware, srv.accessLogMiddleware, srv.securityHeadersMiddleware, srv.csrfMiddleware)
+
+	// Styles and scripts of the admin pages
+	r.PathPrefix("/static/").Handler(srv.static).Methods("GET", "HEAD")
+
+	srv.operationalRoutes(r)
+	return r
+}
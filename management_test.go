@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestManagementRoutes(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.ManagementListen = "127.0.0.1:9090"
+		cfg.AdminAPIKey = "admin-key"
+	})
+
+	for _, tt := range []struct {
+		path       string
+		public     int
+		management int
+	}{
+		{"/healthz", http.StatusNotFound, http.StatusOK},
+		{"/admin/api/stats", http.StatusNotFound, http.StatusOK},
+		{"/", http.StatusOK, http.StatusNotFound},
+		{"/api/config", http.StatusOK, http.StatusNotFound},
+	} {
+		for _, handler := range []struct {
+			name string
+			h    http.Handler
+			want int
+		}{
+			{"public", srv.routes(), tt.public},
+			{"management", srv.managementRoutes(), tt.management},
+		} {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.Header.Set("Authorization", "Bearer admin-key")
+			w := httptest.NewRecorder()
+			handler.h.ServeHTTP(w, req)
+			if w.Code != handler.want {
+				t.Errorf("%s %s: expected status %d, got %d", handler.name, tt.path, handler.want, w.Code)
+			}
+		}
+	}
+}
+
+func TestServe_ManagementListener(t *testing.T) {
+	probe, _ := net.Listen("tcp", "127.0.0.1:0")
+	publicAddr := probe.Addr().String()
+	probe.Close()
+	probe, _ = net.Listen("tcp", "127.0.0.1:0")
+	managementAddr := probe.Addr().String()
+	probe.Close()
+
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.Listen = []string{publicAddr}
+		cfg.ManagementListen = managementAddr
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- srv.serve(ctx, &http.Server{Handler: srv.Handler()}, time.Minute)
+	}()
+
+	get := func(url string) int {
+		var resp *http.Response
+		var err error
+		for i := 0; i < 50; i++ {
+			if resp, err = http.Get(url); err == nil {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", url, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := get("http://" + managementAddr + "/healthz"); code != http.StatusOK {
+		t.Errorf("Expected the management listener to serve /healthz, got %d", code)
+	}
+	if code := get("http://" + publicAddr + "/healthz"); code != http.StatusNotFound {
+		t.Errorf("Expected the public listener not to serve /healthz, got %d", code)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Expected a clean shutdown, got %v", err)
+	}
+	if _, err := net.Dial("tcp", managementAddr); err == nil {
+		t.Error("Expected the management listener to be closed")
+	}
+}
+
+func TestLoadConfig_ManagementListen(t *testing.T) {
+	cfg, err := loadConfig(nil, envMap(map[string]string{"MANAGEMENT_LISTEN": "127.0.0.1:9090"}))
+	if err != nil || cfg.ManagementListen != "127.0.0.1:9090" {
+		t.Errorf("Expected MANAGEMENT_LISTEN to be read, got %q (%v)", cfg.ManagementListen, err)
+	}
+	if _, err := loadConfig([]string{"--management-listen", "9090"}, envMap(nil)); err == nil {
+		t.Error("Expected an address without a port to be rejected")
+	}
+}
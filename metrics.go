@@ -0,0 +1,90 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	MetricsInterval = 10 * time.Minute // Time covered by one metrics bucket
+	MetricsBuckets  = 144              // Buckets kept, 24 hours at MetricsInterval
+)
+
+// MetricsSample counts secret lifecycle events during one interval
+type MetricsSample struct {
+	Start   time.Time
+	Created int
+	Read    int
+	Expired int
+	Burned  int
+}
+
+// add sums other into the sample's counts
+func (s *MetricsSample) add(other MetricsSample) {
+	s.Created += other.Created
+	s.Read += other.Read
+	s.Expired += other.Expired
+	s.Burned += other.Burned
+}
+
+// MetricsCollector counts secret events in a ring buffer of fixed intervals, so memory stays
+// constant and history older than MetricsBuckets intervals is forgotten
+type MetricsCollector struct {
+	mu      sync.Mutex
+	buckets [MetricsBuckets]MetricsSample
+}
+
+func NewMetricsCollector() *MetricsCollector {
+	return &MetricsCollector{}
+}
+
+// bucket returns the bucket for the interval containing t, clearing it when it still holds an
+// older interval. Must be called with m.mu held.
+func (m *MetricsCollector) bucket(t time.Time) *MetricsSample {
+	start := t.Truncate(MetricsInterval)
+	b := &m.buckets[start.Unix()/int64(MetricsInterval/time.Second)%MetricsBuckets]
+	if !b.Start.Equal(start) {
+		*b = MetricsSample{Start: start}
+	}
+	return b
+}
+
+// RecordCreated counts a secret created at now
+func (m *MetricsCollector) RecordCreated(now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.bucket(now).Created++
+}
+
+// HandleEvent counts reads, expiries and burns. Safe to use as a store listener.
+func (m *MetricsCollector) HandleEvent(event SecretEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b := m.bucket(event.Time)
+	switch event.Type {
+	case StatusRead:
+		b.Read++
+	case StatusExpired:
+		b.Expired++
+	case StatusBurned:
+		b.Burned++
+	}
+}
+
+// History returns the samples of the last MetricsBuckets intervals up to now, oldest first.
+// Intervals without events are included with zero counts.
+func (m *MetricsCollector) History(now time.Time) []MetricsSample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	samples := make([]MetricsSample, MetricsBuckets)
+	first := now.Truncate(MetricsInterval).Add(-(MetricsBuckets - 1) * MetricsInterval)
+	for i := range samples {
+		start := first.Add(time.Duration(i) * MetricsInterval)
+		samples[i] = MetricsSample{Start: start}
+		if b := m.buckets[start.Unix()/int64(MetricsInterval/time.Second)%MetricsBuckets]; b.Start.Equal(start) {
+			samples[i] = b
+		}
+	}
+	return samples
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMetricsCollector_History(t *testing.T) {
+	m := NewMetricsCollector()
+	now := time.Date(2024, 1, 2, 12, 34, 0, 0, time.UTC)
+
+	m.RecordCreated(now)
+	m.RecordCreated(now.Add(-MetricsInterval))
+	m.HandleEvent(SecretEvent{Type: StatusRead, Time: now})
+	m.HandleEvent(SecretEvent{Type: StatusExpired, Time: now})
+	m.HandleEvent(SecretEvent{Type: StatusBurned, Time: now.Add(-MetricsInterval)})
+
+	history := m.History(now)
+	if len(history) != MetricsBuckets {
+		t.Fatalf("Expected %d samples, got %d", MetricsBuckets, len(history))
+	}
+	last, previous := history[MetricsBuckets-1], history[MetricsBuckets-2]
+	if !last.Start.Equal(now.Truncate(MetricsInterval)) || last.Created != 1 || last.Read != 1 || last.Expired != 1 {
+		t.Errorf("Unexpected current interval %+v", last)
+	}
+	if previous.Created != 1 || previous.Burned != 1 {
+		t.Errorf("Unexpected previous interval %+v", previous)
+	}
+	if !history[0].Start.Before(previous.Start) {
+		t.Error("Expected samples oldest first")
+	}
+}
+
+func TestMetricsCollector_ForgetsOldIntervals(t *testing.T) {
+	m := NewMetricsCollector()
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	m.RecordCreated(now)
+
+	// A full window later the same bucket is reused for the new interval
+	later := now.Add(MetricsBuckets * MetricsInterval)
+	m.RecordCreated(later)
+
+	total := 0
+	for _, sample := range m.History(later) {
+		total += sample.Created
+	}
+	if total != 1 {
+		t.Errorf("Expected only the recent event to be counted, got %d", total)
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const (
+	ExportVersion      = 1                 // Format of export bundles, checked on import
+	MigrationKeyHeader = "X-Migration-Key" // Base64 AES-256 key export bundles are sealed with
+)
+
+// migrationAD binds sealed bundles to their purpose, so the migration key can't be used to
+// pass off other data
+var migrationAD = []byte("picosend-export-v1")
+
+var ErrExportInvalid = errors.New("invalid exported secret")
+
+// ExportedSecret is a pending secret as it moves between instances: the content as its sender
+// encrypted it, without the at-rest layer, and the state needed to keep enforcing its settings.
+// Passphrases, PINs and management tokens stay hashed; TOTP seeds and webhook signing keys
+// are included as they are, so bundles should be sealed with a migration key.
+type ExportedSecret struct {
+	ID              string          `json:"id"`
+	Content         []byte          `json:"content"`
+	Type            string          `json:"type"`
+	CreatedAt       time.Time       `json:"created_at"`
+	ExpiresAt       time.Time       `json:"expires_at"`
+	Passphrase      *PassphraseHash `json:"passphrase,omitempty"`
+	PIN             *PassphraseHash `json:"pin,omitempty"`
+	TOTPSeed        []byte          `json:"totp_seed,omitempty"`
+	TOTPLastStep    int64           `json:"totp_last_step,omitempty"`
+	ManagementToken []byte          `json:"management_token,omitempty"` // SHA-256 of the token
+	MaxReads        int             `json:"max_reads"`
+	ReadsRemaining  int             `json:"reads_remaining"`
+	Webhook         *Webhook        `json:"webhook,omitempty"`
+	NotifyEmail     string          `json:"notify_email,omitempty"`
+	IPFilter        *IPFilter       `json:"ip_filter,omitempty"`
+	Readers         *ReaderFilter   `json:"readers,omitempty"`
+	NotBefore       time.Time       `json:"not_before"`
+	Recipient       string          `json:"recipient,omitempty"`
+	Label           string          `json:"label,omitempty"`
+	Reference       string          `json:"reference,omitempty"`
+	Display         DisplayOptions  `json:"display"`
+	DeletionMessage string          `json:"deletion_message,omitempty"`
+	RemindAt        time.Time       `json:"remind_at"`
+	AttemptsLeft    int             `json:"attempts_left,omitempty"`
+	Canary          bool            `json:"canary,omitempty"`
+	Reads           []ReadRecord    `json:"reads,omitempty"`
+	CreatorHash     string          `json:"creator_hash,omitempty"`
+	MaxLifetime     time.Duration   `json:"max_lifetime,omitempty"`
+}
+
+// ExportBundle is the document the export endpoint returns and the import endpoint takes
+type ExportBundle struct {
+	Version    int               `json:"version"`
+	ExportedAt time.Time         `json:"exported_at"`
+	Count      int               `json:"count"`
+	Secrets    []*ExportedSecret `json:"secrets,omitempty"`
+	Sealed     []byte            `json:"sealed,omitempty"` // Secrets as JSON, sealed with the migration key
+}
+
+// ImportSkip names a secret an import left out and why
+type ImportSkip struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+type AdminImportResponse struct {
+	Imported int          `json:"imported"`
+	Skipped  []ImportSkip `json:"skipped,omitempty"`
+}
+
+// exportSecret copies a stored secret's state, without its content. Must be called with the
+// secret's shard locked.
+func exportSecret(secret *Secret) *ExportedSecret {
+	e := &ExportedSecret{
+		ID:              secret.ID,
+		Type:            secret.Type,
+		CreatedAt:       secret.CreatedAt,
+		ExpiresAt:       secret.ExpiresAt,
+		Passphrase:      secret.Passphrase.clone(),
+		PIN:             secret.PIN.clone(),
+		MaxReads:        secret.MaxReads,
+		ReadsRemaining:  secret.ReadsRemaining,
+		NotifyEmail:     secret.NotifyEmail,
+		IPFilter:        secret.IPFilter,
+		Readers:         secret.Readers,
+		NotBefore:       secret.NotBefore,
+		Recipient:       secret.Recipient,
+		Label:           secret.Label,
+		Reference:       secret.Reference,
+		Display:         secret.Display,
+		DeletionMessage: secret.DeletionMessage,
+		RemindAt:        secret.RemindAt,
+		AttemptsLeft:    secret.AttemptsLeft,
+		Canary:          secret.Canary,
+		Reads:           append([]ReadRecord(nil), secret.Reads...),
+		CreatorHash:     secret.Fingerprints.Creator,
+		MaxLifetime:     secret.MaxLifetime,
+	}
+	if secret.TOTP != nil {
+		e.TOTPSeed = append([]byte(nil), secret.TOTP.seed...)
+		e.TOTPLastStep = secret.TOTP.lastStep
+	}
+	var zero [32]byte
+	if secret.ManagementToken != zero {
+		e.ManagementToken = append([]byte(nil), secret.ManagementToken[:]...)
+	}
+	if secret.Webhook != nil {
+		webhook := *secret.Webhook
+		e.Webhook = &webhook
+	}
+	return e
+}
+
+// Export returns every pending secret, oldest first, for Import into another store. Offloaded
+// content is fetched and the at-rest layer removed, so the target seals it with its own key.
+// Secrets stay in place; reads after the export are not reflected in it.
+func (s *SecretStore) Export() ([]*ExportedSecret, error) {
+	s.sealing.RLock()
+	defer s.sealing.RUnlock()
+	var exported []*ExportedSecret
+	var stored []*Secret // Content as stored, opened outside the locks
+	now := time.Now()
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for _, secret := range sh.secrets {
+			if now.After(secret.ExpiresAt) {
+				continue
+			}
+			exported = append(exported, exportSecret(secret))
+			// open deletes offloaded content it takes to be read for the last time
+			copied := &Secret{Content: append([]byte(nil), secret.Content...), Blob: secret.Blob, ReadsRemaining: 1}
+			if secret.WrappedKey != nil {
+				copied.WrappedKey = append([]byte(nil), secret.WrappedKey...)
+			}
+			stored = append(stored, copied)
+		}
+		sh.mu.Unlock()
+	}
+
+	for i, e := range exported {
+		secret, ok := s.open(e.ID, stored[i])
+		if !ok {
+			wipeExported(exported)
+			return nil, fmt.Errorf("failed to load secret %s", e.ID)
+		}
+		e.Content = secret.Content
+	}
+	sort.Slice(exported, func(i, j int) bool { return exported[i].CreatedAt.Before(exported[j].CreatedAt) })
+	return exported, nil
+}
+
+// Import stores an exported secret under its original ID, with its expiry, reads left and
+// protections as they were. The content is sealed and offloaded like a new secret's, and the
+// store's limits apply. Returns ErrIDTaken when the ID is in use.
+func (s *SecretStore) Import(e *ExportedSecret) error {
+	return s.importSecret(e, false)
+}
+
+// importSecret is Import, storing the secret as a replica for another cluster node when set
+func (s *SecretStore) importSecret(e *ExportedSecret, replica bool) error {
+	lifetime := time.Until(e.ExpiresAt)
+	switch {
+	case e.ID == "" || e.MaxReads < 1 || e.ReadsRemaining < 1 || e.ReadsRemaining > e.MaxReads:
+		return ErrExportInvalid
+	case len(e.ManagementToken) != 0 && len(e.ManagementToken) != 32:
+		return ErrExportInvalid
+	case lifetime <= 0:
+		return errors.New("secret has expired")
+	}
+
+	_, err := s.storeContent(e.Content, lifetime, SecretOptions{
+		ID:              e.ID,
+		MaxReads:        e.MaxReads,
+		Webhook:         e.Webhook,
+		NotifyEmail:     e.NotifyEmail,
+		IPFilter:        e.IPFilter,
+		Readers:         e.Readers,
+		Type:            e.Type,
+		NotBefore:       e.NotBefore,
+		Recipient:       e.Recipient,
+		Label:           e.Label,
+		Reference:       e.Reference,
+		Display:         e.Display,
+		DeletionMessage: e.DeletionMessage,
+		CreatorHash:     e.CreatorHash,
+		MaxAttempts:     e.AttemptsLeft,
+		Canary:          e.Canary,
+		MaxLifetime:     e.MaxLifetime,
+		restore:         e,
+		replica:         replica,
+	})
+	return err
+}
+
+// restoreTo carries the state SecretOptions has no room for over to a secret being imported,
+// before it becomes visible
+func (e *ExportedSecret) restoreTo(secret *Secret) {
+	secret.CreatedAt, secret.ExpiresAt = e.CreatedAt, e.ExpiresAt
+	secret.Passphrase, secret.PIN = e.Passphrase, e.PIN
+	if e.TOTPSeed != nil {
+		secret.TOTP = &TOTPGate{seed: append([]byte(nil), e.TOTPSeed...), lastStep: e.TOTPLastStep}
+	}
+	copy(secret.ManagementToken[:], e.ManagementToken)
+	secret.ReadsRemaining = e.ReadsRemaining
+	secret.RemindAt = e.RemindAt
+	secret.Reads = e.Reads
+}
+
+// wipeExported zeroes the content and TOTP seeds of exported secrets
+func wipeExported(exported []*ExportedSecret) {
+	for _, e := range exported {
+		wipeBytes(e.Content)
+		wipeBytes(e.TOTPSeed)
+	}
+}
+
+// migrationAEAD returns the cipher for the migration key in r's X-Migration-Key header, or nil
+// when there is none
+func migrationAEAD(r *http.Request) (cipher.AEAD, error) {
+	value := r.Header.Get(MigrationKeyHeader)
+	if value == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(key) != DataKeyLength {
+		return nil, fmt.Errorf("%s must be %d bytes, base64 encoded", MigrationKeyHeader, DataKeyLength)
+	}
+	defer wipeBytes(key)
+	return newGCM(key)
+}
+
+// adminExportHandler returns every pending secret for import into another instance, sealed
+// with the migration key when one is given
+func (srv *Server) adminExportHandler(w http.ResponseWriter, r *http.Request) {
+	aead, err := migrationAEAD(r)
+	if err != nil {
+		apiError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	secrets, err := srv.store.Export()
+	if err != nil {
+		apiError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer wipeExported(secrets)
+
+	bundle := ExportBundle{Version: ExportVersion, ExportedAt: time.Now().UTC(), Count: len(secrets), Secrets: secrets}
+	if aead != nil {
+		data, err := json.Marshal(secrets)
+		if err == nil {
+			bundle.Sealed, err = sealGCM(aead, data, migrationAD)
+		}
+		wipeBytes(data)
+		if err != nil {
+			apiError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		bundle.Secrets = nil
+	}
+	for _, e := range secrets {
+		srv.audit(r, "exported", e.ID)
+	}
+	srv.logger.Info("Exported secrets", "count", len(secrets), "sealed", aead != nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="picosend-export.json"`)
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(bundle)
+}
+
+// adminImportHandler stores the secrets of an export bundle. Secrets that can't be imported,
+// because they expired in transit, their ID is taken or the store is full, are listed with the
+// reason and the rest are imported regardless.
+func (srv *Server) adminImportHandler(w http.ResponseWriter, r *http.Request) {
+	aead, err := migrationAEAD(r)
+	if err != nil {
+		apiError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	var bundle ExportBundle
+	if err := json.NewDecoder(r.Body).Decode(&bundle); err != nil {
+		apiError(w, r, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if bundle.Version != ExportVersion {
+		apiError(w, r, http.StatusBadRequest, fmt.Sprintf("Unsupported export version %d", bundle.Version))
+		return
+	}
+	if bundle.Sealed != nil {
+		if aead == nil {
+			apiError(w, r, http.StatusBadRequest, "The export is sealed, "+MigrationKeyHeader+" is required")
+			return
+		}
+		data, err := openGCM(aead, bundle.Sealed, migrationAD)
+		if err == nil {
+			err = json.Unmarshal(data, &bundle.Secrets)
+		}
+		wipeBytes(data)
+		if err != nil {
+			apiError(w, r, http.StatusBadRequest, "The export can't be opened with this migration key")
+			return
+		}
+	}
+	defer wipeExported(bundle.Secrets)
+
+	response := AdminImportResponse{}
+	for _, e := range bundle.Secrets {
+		if err := srv.store.Import(e); err != nil {
+			response.Skipped = append(response.Skipped, ImportSkip{ID: e.ID, Error: err.Error()})
+			continue
+		}
+		srv.audit(r, "imported", e.ID)
+		response.Imported++
+	}
+	srv.logger.Info("Imported secrets", "count", response.Imported, "skipped", len(response.Skipped))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
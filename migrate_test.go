@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testMigrationKey = base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, DataKeyLength))
+
+func TestExportImport_RoundTrip(t *testing.T) {
+	source, sourceServer := setupAdminTestServer(t)
+	defer sourceServer.Close()
+	target, targetServer := setupAdminTestServer(t)
+	defer targetServer.Close()
+
+	id, _ := source.store.StoreWithOptions("encrypted", time.Hour, SecretOptions{
+		PassphraseHash:  "hash",
+		TOTPSecret:      []byte("0123456789abcdef0123"),
+		ManagementToken: "token",
+		MaxReads:        3,
+		Label:           "db password",
+	})
+	source.store.Get(id)
+	want, _ := source.store.Peek(id)
+
+	var stdout, stderr bytes.Buffer
+	if code := runCLI([]string{"export", "--server", sourceServer.URL, "--admin-key", testAdminKey, "--migration-key", testMigrationKey}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected export to succeed, got exit code %d: %s", code, stderr.String())
+	}
+	if strings.Contains(stdout.String(), "db password") {
+		t.Error("Expected the sealed export not to show the secrets")
+	}
+
+	export := stdout.String()
+	stdout.Reset()
+	if code := runCLI([]string{"import", "--server", targetServer.URL, "--admin-key", testAdminKey, "--migration-key", testMigrationKey}, strings.NewReader(export), &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected import to succeed, got exit code %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Imported 1 secrets") {
+		t.Errorf("Unexpected import output %q", stdout.String())
+	}
+
+	got, found := target.store.Peek(id)
+	if !found {
+		t.Fatal("Expected the secret under its original ID")
+	}
+	if got.Passphrase == nil || got.TOTP == nil || got.ReadsRemaining != 2 || !got.ExpiresAt.Equal(want.ExpiresAt) {
+		t.Errorf("Expected the secret's state to carry over, got %+v", got)
+	}
+	if details, err := target.store.SenderDetails(id, "token"); err != nil || details.Label != "db password" {
+		t.Errorf("Expected the management token and label to carry over, got %+v %v", details, err)
+	}
+	if secret, _ := target.store.Get(id); secret == nil || string(secret.Content) != "encrypted" {
+		t.Error("Expected the content to carry over")
+	}
+
+	// Importing again skips the secret, its ID is taken
+	stdout.Reset()
+	stderr.Reset()
+	runCLI([]string{"import", "--server", targetServer.URL, "--admin-key", testAdminKey, "--migration-key", testMigrationKey}, strings.NewReader(export), &stdout, &stderr)
+	if !strings.Contains(stderr.String(), "Skipped "+id) {
+		t.Errorf("Expected the secret to be skipped, got %q", stderr.String())
+	}
+}
+
+func TestAdminImport_SealedNeedsKey(t *testing.T) {
+	source, sourceServer := setupAdminTestServer(t)
+	defer sourceServer.Close()
+	_, targetServer := setupAdminTestServer(t)
+	defer targetServer.Close()
+	source.store.Store("encrypted", time.Hour)
+
+	resp, err := adminAPIRequest("GET", sourceServer.URL+"/admin/api/export", testAdminKey, testMigrationKey, nil)
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	export, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	wrongKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{8}, DataKeyLength))
+	for _, key := range []string{"", wrongKey, "short"} {
+		if _, err := adminAPIRequest("POST", targetServer.URL+"/admin/api/import", testAdminKey, key, bytes.NewReader(export)); err == nil || !strings.Contains(err.Error(), "400") {
+			t.Errorf("Expected 400 importing with key %q, got %v", key, err)
+		}
+	}
+
+	// The admin key is still required
+	resp = adminRequest(t, targetServer, "POST", "/admin/api/import", "", export)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without the admin key, got %d", resp.StatusCode)
+	}
+}
+
+func TestSecretStore_ImportSkipsExpired(t *testing.T) {
+	store := NewSecretStore()
+	exported := &ExportedSecret{ID: "expired", Content: []byte("encrypted"), MaxReads: 1, ReadsRemaining: 1, ExpiresAt: time.Now().Add(-time.Minute)}
+	if err := store.Import(exported); err == nil {
+		t.Error("Expected an expired secret to be refused")
+	}
+	exported.ExpiresAt, exported.ReadsRemaining = time.Now().Add(time.Hour), 0
+	if err := store.Import(exported); err != ErrExportInvalid {
+		t.Errorf("Expected a read secret to be refused, got %v", err)
+	}
+}
+
+func TestAdminExport_Unsealed(t *testing.T) {
+	srv, server := setupAdminTestServer(t)
+	defer server.Close()
+	srv.store.Store("encrypted", time.Hour)
+
+	resp := adminRequest(t, server, "GET", "/admin/api/export", testAdminKey, nil)
+	defer resp.Body.Close()
+	var bundle ExportBundle
+	json.NewDecoder(resp.Body).Decode(&bundle)
+	if resp.StatusCode != http.StatusOK || bundle.Version != ExportVersion || len(bundle.Secrets) != 1 || string(bundle.Secrets[0].Content) != "encrypted" {
+		t.Errorf("Expected the secret in the clear, got %d %+v", resp.StatusCode, bundle)
+	}
+}
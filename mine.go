@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const MaxLookupSecrets = 100 // Maximum number of secrets looked up by one request
+
+// SecretLookup names a secret and the management token its sender got when creating it
+type SecretLookup struct {
+	ID              string `json:"id"`
+	ManagementToken string `json:"management_token"`
+}
+
+type LookupSecretsRequest struct {
+	Secrets []SecretLookup `json:"secrets"`
+}
+
+// SecretLookupResult is the outcome of one item of a lookup, in request order
+type SecretLookupResult struct {
+	ID     string                `json:"id"`
+	Secret *SecretStatusResponse `json:"secret,omitempty"` // Set when the token matched
+	Status int                   `json:"status"`           // HTTP status the item would have got as a single request
+	Error  string                `json:"error,omitempty"`
+}
+
+type LookupSecretsResponse struct {
+	Results []SecretLookupResult `json:"results"`
+}
+
+// lookupSecretsHandler reports the status of several secrets to their sender at once, with
+// the label, reference and reads the status endpoint only shows for a management token. It
+// backs the /mine page, which would otherwise poll every secret on its own.
+func (srv *Server) lookupSecretsHandler(w http.ResponseWriter, r *http.Request) {
+	var req LookupSecretsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "error.invalid_json")
+		return
+	}
+	if len(req.Secrets) == 0 {
+		localizedError(w, r, http.StatusBadRequest, "error.lookup_empty")
+		return
+	}
+	if len(req.Secrets) > MaxLookupSecrets {
+		localizedError(w, r, http.StatusBadRequest, "error.lookup_too_large", MaxLookupSecrets)
+		return
+	}
+
+	locale := requestLocale(w, r)
+	results := make([]SecretLookupResult, len(req.Secrets))
+	for i, item := range req.Secrets {
+		response, reqErr := srv.lookupSecret(r, item)
+		if reqErr != nil {
+			results[i] = SecretLookupResult{ID: item.ID, Status: reqErr.Code, Error: reqErr.text(locale)}
+			continue
+		}
+		results[i] = SecretLookupResult{ID: item.ID, Secret: response, Status: http.StatusOK}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LookupSecretsResponse{Results: results})
+}
+
+// lookupSecret returns the status of one secret of a lookup. Unknown secrets count against the
+// client's failed lookups like a 404 from the status endpoint would.
+func (srv *Server) lookupSecret(r *http.Request, item SecretLookup) (*SecretStatusResponse, *requestError) {
+	notFound := &requestError{Code: http.StatusNotFound, Key: "error.not_found"}
+	id, signed := srv.verifyID(item.ID)
+	if !signed || !(srv.store.IDFormat().Valid(id) || validSlug(id)) {
+		srv.recordLookupFailure(r)
+		return nil, notFound
+	}
+	if srv.abuse.Blocked(BlockByID, id) {
+		return nil, &requestError{Code: http.StatusGone, Key: "error.secret_blocked"}
+	}
+	if item.ManagementToken == "" {
+		return nil, &requestError{Code: http.StatusUnauthorized, Key: "error.management_token_required"}
+	}
+
+	state, found := srv.store.Status(id)
+	if !found {
+		srv.recordLookupFailure(r)
+		return nil, notFound
+	}
+	details, err := srv.store.SenderDetails(id, item.ManagementToken)
+	if errors.Is(err, ErrInvalidManagementToken) {
+		return nil, &requestError{Code: http.StatusForbidden, Key: "error.invalid_management_token"}
+	}
+	response := srv.secretStatusResponse(state)
+	response.Label, response.Reference = details.Label, details.Reference
+	response.Reads = newReadResponses(details.Reads)
+	return &response, nil
+}
+
+// recordLookupFailure counts a lookup of an unknown secret against the client of r
+func (srv *Server) recordLookupFailure(r *http.Request) {
+	if srv.lookupThrottle == nil {
+		return
+	}
+	if addr := clientAddr(r, srv.config.TrustedProxies); addr.IsValid() {
+		srv.lookupThrottle.RecordFailure(addr, time.Now())
+	}
+}
+
+// mineHandler serves the sender dashboard. The page keeps the management tokens in the
+// browser's storage and asks the API for their secrets, so the server holds no list of them.
+func (srv *Server) mineHandler(w http.ResponseWriter, r *http.Request) {
+	locale := requestLocale(w, r)
+	srv.renderPage(w, locale, "mine.html", struct {
+		Lang     string
+		BasePath string
+		Brand    Branding
+		Theme    string
+		Nonce    string
+
+		MaxLookup int
+	}{
+		Lang:     locale.Tag,
+		BasePath: srv.config.BasePath,
+		Brand:    srv.config.Branding,
+		Theme:    requestTheme(w, r),
+		Nonce:    srv.scriptNonce(w),
+
+		MaxLookup: MaxLookupSecrets,
+	})
+}
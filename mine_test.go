@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func lookupSecrets(t *testing.T, srv *Server, req LookupSecretsRequest) (*httptest.ResponseRecorder, LookupSecretsResponse) {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("POST", "/api/secrets/lookup", bytes.NewReader(body)))
+	var resp LookupSecretsResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	return rec, resp
+}
+
+func TestLookupSecrets(t *testing.T) {
+	srv := newTestServer(t)
+	token := "token"
+	id, _ := srv.store.StoreWithOptions("encrypted", time.Hour, SecretOptions{Label: "vpn for alice", ManagementToken: token})
+	other, _ := srv.store.StoreWithOptions("encrypted", time.Hour, SecretOptions{ManagementToken: "other"})
+
+	rec, resp := lookupSecrets(t, srv, LookupSecretsRequest{Secrets: []SecretLookup{
+		{ID: id, ManagementToken: token},
+		{ID: other, ManagementToken: token},
+		{ID: other},
+		{ID: "not-a-secret", ManagementToken: token},
+	}})
+	if rec.Code != http.StatusOK || len(resp.Results) != 4 {
+		t.Fatalf("Expected 200 with four results, got %d %+v", rec.Code, resp)
+	}
+	if got := resp.Results[0]; got.Status != http.StatusOK || got.ID != id || got.Secret == nil || got.Secret.Status != "unread" || got.Secret.Label != "vpn for alice" {
+		t.Errorf("Expected the status and label of the first secret, got %+v", got)
+	}
+	for i, want := range []int{http.StatusForbidden, http.StatusUnauthorized, http.StatusNotFound} {
+		if got := resp.Results[i+1]; got.Status != want || got.Secret != nil || got.Error == "" {
+			t.Errorf("Item %d: expected %d with an error, got %+v", i+2, want, got)
+		}
+	}
+
+	// Reads and the final status show up like on the status endpoint
+	srv.store.Get(id)
+	if _, resp := lookupSecrets(t, srv, LookupSecretsRequest{Secrets: []SecretLookup{{ID: id, ManagementToken: token}}}); resp.Results[0].Secret == nil || resp.Results[0].Secret.Status != "read" {
+		t.Errorf("Expected the secret to be read, got %+v", resp.Results)
+	}
+}
+
+func TestLookupSecrets_Limits(t *testing.T) {
+	srv := newTestServer(t)
+
+	if rec, _ := lookupSecrets(t, srv, LookupSecretsRequest{}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an empty lookup, got %d", rec.Code)
+	}
+	if rec, _ := lookupSecrets(t, srv, LookupSecretsRequest{Secrets: make([]SecretLookup, MaxLookupSecrets+1)}); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for too many secrets, got %d", rec.Code)
+	}
+}
+
+func TestLookupSecrets_CountsUnknownSecrets(t *testing.T) {
+	srv := newTestServer(t)
+	srv.lookupThrottle = NewLookupThrottle(2, time.Minute)
+	id, _ := srv.store.Store("encrypted", time.Hour)
+
+	_, resp := lookupSecrets(t, srv, LookupSecretsRequest{Secrets: []SecretLookup{{ID: "unknown1", ManagementToken: "t"}, {ID: "unknown2", ManagementToken: "t"}}})
+	if len(resp.Results) != 2 {
+		t.Fatalf("Expected two results, got %+v", resp)
+	}
+	if rec, _ := lookupSecrets(t, srv, LookupSecretsRequest{Secrets: []SecretLookup{{ID: id, ManagementToken: "t"}}}); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 after two unknown secrets, got %d", rec.Code)
+	}
+}
+
+func TestMinePage(t *testing.T) {
+	srv := newTestServer(t)
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/mine", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "/api/secrets/lookup") {
+		t.Errorf("Expected the dashboard to use the lookup endpoint, got %d", rec.Code)
+	}
+
+	// The home page only offers to remember a secret, the token isn't stored unasked
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(rec.Body.String(), `id="rememberBtn"`) || !strings.Contains(rec.Body.String(), `href="/mine"`) {
+		t.Error("Expected the home page to link the dashboard and offer to remember secrets")
+	}
+}
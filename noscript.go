@@ -0,0 +1,239 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// NoScriptKeyParam is the query parameter that carries the key of links created without
+// JavaScript. The fragment never reaches the server, so the key has to travel where it does.
+const NoScriptKeyParam = "key"
+
+// MaxNoScriptFormFields caps what the fields of a no-JavaScript form may add to the secret
+const MaxNoScriptFormFields = 4096
+
+// noScriptForm is the reveal form the view page shows browsers without JavaScript
+type noScriptForm struct {
+	Key        string // Key from the link's query, empty when the link keeps it in the fragment
+	ClaimToken string
+	Passphrase bool // The secret asks for a passphrase
+	PIN        bool // The secret asks for a pickup PIN
+	Supported  bool // False for secrets that need a code, challenge or recipient key
+}
+
+// noScriptPage answers the create and reveal forms of browsers without JavaScript
+type noScriptPage struct {
+	Lang     string
+	BasePath string
+	Brand    Branding
+	Theme    string
+	Error    string        // Why the form was refused
+	Form     *noScriptForm // Reveal form, shown again after a wrong passphrase or PIN
+
+	// Set once a secret was created
+	Link         string
+	PIN          string
+	ReadsAllowed int // Reads the link allows
+
+	// Set once a secret was revealed
+	Revealed       bool
+	Content        string
+	CreatedAt      string
+	ReadsRemaining int
+}
+
+// noScriptForm returns the reveal form for a secret, given the key from the link's query
+func (srv *Server) noScriptForm(meta *Secret, key, claimToken string) *noScriptForm {
+	return &noScriptForm{
+		Key:        key,
+		ClaimToken: claimToken,
+		Passphrase: meta.Passphrase != nil,
+		PIN:        meta.PIN != nil,
+		Supported:  meta.TOTP == nil && meta.Recipient == "" && srv.challenger == nil,
+	}
+}
+
+// renderNoScript renders page with status. The page may hold a link with its key or revealed
+// content, so it is never cached.
+func (srv *Server) renderNoScript(w http.ResponseWriter, r *http.Request, page *noScriptPage, status int) {
+	locale := requestLocale(w, r)
+	page.Lang = locale.Tag
+	page.BasePath = srv.config.BasePath
+	page.Brand = srv.config.Branding
+	page.Theme = requestTheme(w, r)
+	w.Header().Set("Cache-Control", "no-store")
+	srv.renderPageStatus(w, locale, "noscript.html", page, status)
+}
+
+// noScriptError renders reqErr, with the reveal form again if form is set
+func (srv *Server) noScriptError(w http.ResponseWriter, r *http.Request, reqErr *requestError, form *noScriptForm) {
+	srv.renderNoScript(w, r, &noScriptPage{Error: reqErr.text(requestLocale(w, r)), Form: form}, reqErr.Code)
+}
+
+// noScriptCreateHandler creates a secret from the home page's form when the browser runs no
+// JavaScript. The server encrypts the content, so unlike the JavaScript flow it sees the
+// plaintext and the key, and the link carries the key in its query for the same reason.
+func (srv *Server) noScriptCreateHandler(w http.ResponseWriter, r *http.Request) {
+	// Percent-encoding at most triples the content
+	r.Body = http.MaxBytesReader(w, r.Body, int64(srv.store.Limits().MaxSecretLength)*3+MaxNoScriptFormFields)
+	if err := r.ParseForm(); err != nil {
+		srv.noScriptError(w, r, &requestError{Code: http.StatusBadRequest, Message: err.Error()}, nil)
+		return
+	}
+
+	apiKey, reqErr := srv.creatorAPIKey(r, r.PostFormValue("api_key"))
+	if reqErr != nil {
+		srv.noScriptError(w, r, reqErr, nil)
+		return
+	}
+
+	req := CreateSecretRequest{RequirePIN: r.PostFormValue("require_pin") != ""}
+	for name, field := range map[string]*int{"lifetime": &req.Lifetime, "max_reads": &req.MaxReads} {
+		if value := r.PostFormValue(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				srv.noScriptError(w, r, &requestError{Code: http.StatusBadRequest, Key: "error.invalid_query_parameter", Args: []any{name}}, nil)
+				return
+			}
+			*field = n
+		}
+	}
+	if passphrase := r.PostFormValue("passphrase"); passphrase != "" {
+		req.PassphraseHash = hashPassphraseForTransport(passphrase)
+	}
+
+	// Browsers send line breaks as CRLF, the JavaScript flow stores them as they're typed
+	plaintext := []byte(strings.ReplaceAll(r.PostFormValue("secret"), "\r\n", "\n"))
+	defer wipeBytes(plaintext)
+	if maxLength := srv.secretLimits(apiKey).MaxSecretLength; len(plaintext) > maxLength {
+		srv.noScriptError(w, r, &requestError{Code: http.StatusBadRequest, Key: "error.content_too_long", Args: []any{maxLength}}, nil)
+		return
+	}
+	if len(plaintext) == 0 {
+		srv.noScriptError(w, r, &requestError{Code: http.StatusBadRequest, Key: "error.content_empty"}, nil)
+		return
+	}
+	if reqErr := srv.scanPlaintext(r, plaintext); reqErr != nil {
+		srv.noScriptError(w, r, reqErr, nil)
+		return
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		srv.noScriptError(w, r, &requestError{Code: http.StatusInternalServerError, Message: err.Error()}, nil)
+		return
+	}
+	defer wipeBytes(key)
+	var err error
+	if req.Content, err = encryptContent(plaintext, key); err != nil {
+		srv.noScriptError(w, r, &requestError{Code: http.StatusInternalServerError, Message: err.Error()}, nil)
+		return
+	}
+
+	response, reqErr := srv.createSecret(r, apiKey, req)
+	if reqErr != nil {
+		srv.noScriptError(w, r, reqErr, nil)
+		return
+	}
+	srv.renderNoScript(w, r, &noScriptPage{
+		Link:         srv.shareLink(r, response.ID) + "?" + NoScriptKeyParam + "=" + base64.RawURLEncoding.EncodeToString(key),
+		PIN:          response.PIN,
+		ReadsAllowed: max(req.MaxReads, 1),
+	}, http.StatusOK)
+}
+
+// noScriptRevealHandler reveals a secret through the view page's form when the browser runs
+// no JavaScript. The form sends the key from the link's query, and the server decrypts the
+// content. Secrets that need a code, challenge or recipient key are left to the JavaScript flow.
+func (srv *Server) noScriptRevealHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxNoScriptFormFields)
+	notFound := &requestError{Code: http.StatusNotFound, Key: "error.not_found"}
+	id := mux.Vars(r)["id"]
+	meta, found := srv.store.Peek(id)
+	if !found {
+		srv.noScriptError(w, r, notFound, nil)
+		return
+	}
+
+	form := srv.noScriptForm(meta, r.PostFormValue(NoScriptKeyParam), r.PostFormValue("claim_token"))
+	key, err := base64.RawURLEncoding.DecodeString(form.Key)
+	if err != nil || len(key) != 32 {
+		srv.noScriptError(w, r, &requestError{Code: http.StatusBadRequest, Key: "view.nojs_missing_key"}, nil)
+		return
+	}
+	defer wipeBytes(key)
+	if !form.Supported {
+		srv.noScriptError(w, r, &requestError{Code: http.StatusNotAcceptable, Key: "view.nojs_unsupported"}, nil)
+		return
+	}
+	if reqErr := lockedError(meta); reqErr != nil {
+		srv.noScriptError(w, r, reqErr, nil)
+		return
+	}
+	if reqErr := srv.readerError(r, meta); reqErr != nil {
+		srv.noScriptError(w, r, reqErr, nil)
+		return
+	}
+	if !srv.claims.Valid(id, form.ClaimToken, time.Now()) {
+		srv.noScriptError(w, r, &requestError{Code: http.StatusForbidden, Key: "error.invalid_claim_token"}, nil)
+		return
+	}
+
+	// Wrong answers count against the attempt limit like in the claim flow, and the form is
+	// shown again with the same claim token
+	var passphraseHash string
+	if passphrase := r.PostFormValue("passphrase"); passphrase != "" {
+		passphraseHash = hashPassphraseForTransport(passphrase)
+	}
+	if reqErr := srv.checkAnswer(r, id, meta.Passphrase, passphraseHash, "error.invalid_passphrase"); reqErr != nil {
+		srv.noScriptRetry(w, r, reqErr, form)
+		return
+	}
+	if pin := r.PostFormValue("pin"); meta.PIN != nil && pin == "" {
+		srv.noScriptRetry(w, r, &requestError{Code: http.StatusForbidden, Key: "error.pin_required"}, form)
+		return
+	} else if reqErr := srv.checkAnswer(r, id, meta.PIN, pin, "error.invalid_pin"); reqErr != nil {
+		srv.noScriptRetry(w, r, reqErr, form)
+		return
+	}
+
+	if !srv.claims.Redeem(id, form.ClaimToken, time.Now()) {
+		srv.noScriptError(w, r, &requestError{Code: http.StatusForbidden, Key: "error.invalid_claim_token"}, nil)
+		return
+	}
+	secret, found := srv.readSecret(r, id, meta)
+	if !found {
+		srv.noScriptError(w, r, notFound, nil)
+		return
+	}
+	defer wipeSecret(secret)
+
+	// The read is used up by now; a wrong key can't be told apart before the content is taken
+	plaintext, err := decryptContent(string(secret.Content), key)
+	if err != nil {
+		srv.noScriptError(w, r, &requestError{Code: http.StatusBadRequest, Key: "error.secret_key_invalid"}, nil)
+		return
+	}
+	defer wipeBytes(plaintext)
+	srv.renderNoScript(w, r, &noScriptPage{
+		Revealed:       true,
+		Content:        string(plaintext),
+		CreatedAt:      secret.CreatedAt.Format("2006-01-02 15:04:05 UTC"),
+		ReadsRemaining: secret.ReadsRemaining,
+	}, http.StatusOK)
+}
+
+// noScriptRetry renders reqErr with the reveal form again, unless the wrong answer destroyed
+// the secret
+func (srv *Server) noScriptRetry(w http.ResponseWriter, r *http.Request, reqErr *requestError, form *noScriptForm) {
+	if reqErr.Code == http.StatusGone {
+		form = nil
+	}
+	srv.noScriptError(w, r, reqErr, form)
+}
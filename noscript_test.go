@@ -0,0 +1,107 @@
+package main
+
+import (
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postForm sends a form like a browser without JavaScript would
+func postForm(srv *Server, path string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	return rec
+}
+
+// noScriptRevealForm fetches the view page of link and returns the fields of its reveal form
+func noScriptRevealForm(t *testing.T, srv *Server, link string) (string, url.Values) {
+	t.Helper()
+	target, _ := url.Parse(link)
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("GET", target.RequestURI(), nil))
+	form := url.Values{}
+	for _, field := range regexp.MustCompile(`<input type="hidden" name="(\w+)" value="([^"]*)">`).FindAllStringSubmatch(rec.Body.String(), -1) {
+		form.Set(field[1], html.UnescapeString(field[2]))
+	}
+	if form.Get("key") == "" || form.Get("claim_token") == "" {
+		t.Fatalf("Expected a reveal form with the key and a claim token, got %d", rec.Code)
+	}
+	return target.RequestURI(), form
+}
+
+func TestNoScript_CreateAndReveal(t *testing.T) {
+	srv := newTestServer(t)
+
+	rec := postForm(srv, "/s", url.Values{"secret": {"line one\r\nline <two>"}, "lifetime": {"60"}, "max_reads": {"2"}, "passphrase": {"hunter2"}})
+	match := regexp.MustCompile(`id="secretLink" value="([^"]+)"`).FindStringSubmatch(rec.Body.String())
+	if rec.Code != http.StatusOK || match == nil || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("Expected the link on an uncached page, got %d %v", rec.Code, rec.Header())
+	}
+	link := html.UnescapeString(match[1])
+	if !strings.Contains(link, "/s/") || !strings.Contains(link, "?key=") {
+		t.Fatalf("Expected the key in the link's query, got %q", link)
+	}
+
+	// A wrong passphrase shows the form again
+	path, form := noScriptRevealForm(t, srv, link)
+	form.Set("passphrase", "wrong")
+	if rec := postForm(srv, path, form); rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), `name="claim_token"`) {
+		t.Fatalf("Expected 403 with the form again, got %d", rec.Code)
+	}
+
+	form.Set("passphrase", "hunter2")
+	rec = postForm(srv, path, form)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "line one\nline &lt;two&gt;") {
+		t.Fatalf("Expected the decrypted content, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	// The claim token was used up
+	if rec := postForm(srv, path, form); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a used claim token, got %d", rec.Code)
+	}
+}
+
+func TestNoScript_RevealNeedsKeyInQuery(t *testing.T) {
+	srv := newTestServer(t)
+	id, _ := srv.store.Store("encrypted", time.Hour)
+
+	// Links made by JavaScript keep the key in the fragment, which never reaches the server
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/s/"+id, nil))
+	if !strings.Contains(rec.Body.String(), html.EscapeString(locales[DefaultLocale].T("view.nojs_missing_key"))) {
+		t.Error("Expected the view page to explain the link needs JavaScript")
+	}
+
+	rec = postForm(srv, "/s/"+id, url.Values{"claim_token": {"token"}})
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a key, got %d", rec.Code)
+	}
+	if _, found := srv.store.Peek(id); !found {
+		t.Error("Expected the secret to be kept")
+	}
+}
+
+func TestNoScript_CreateRequiresAPIKey(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.RequireAPIKeys = true })
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(rec.Body.String(), `id="nojsAPIKey"`) {
+		t.Error("Expected the form to ask for an API key")
+	}
+
+	if rec := postForm(srv, "/s", url.Values{"secret": {"content"}}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without an API key, got %d", rec.Code)
+	}
+	_, token := srv.apiKeys.Create("ci", "", APIKeyLimits{})
+	if rec := postForm(srv, "/s", url.Values{"secret": {"content"}, "api_key": {token}}); rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 with an API key, got %d", rec.Code)
+	}
+}
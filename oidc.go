@@ -0,0 +1,632 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OIDCSessionCookie   = "picosend_session"
+	OIDCStateCookie     = "picosend_login"
+	OIDCSessionLifetime = 8 * time.Hour
+	OIDCLoginTimeout    = 10 * time.Minute // Time to complete the login at the provider
+	OIDCRequestTimeout  = 10 * time.Second
+	OIDCKeysRefresh     = time.Minute // Least time between signing key fetches for an unknown key ID
+	OIDCClockSkew       = time.Minute // Leeway for the ID token's expiry and issue time
+	MaxOIDCPending      = 10000       // Logins in progress; more are refused until some finish or time out
+	MaxOIDCSessions     = 100000
+)
+
+var (
+	ErrOIDCLoginExpired = errors.New("login expired or was started in another browser")
+	ErrOIDCNotAllowed   = errors.New("account is not allowed to sign in")
+)
+
+// OIDCConfig configures single sign-on with an OpenID Connect provider for creating secrets
+// and opening admin pages. Reading a secret still needs only the link.
+type OIDCConfig struct {
+	Issuer         string // Provider URL its discovery document is found under
+	ClientID       string
+	ClientSecret   string
+	AllowedDomains []string // Email domains allowed to sign in; empty allows every account of the provider
+	AdminEmails    []string // Accounts that may open admin pages
+}
+
+// Enabled reports whether an OIDC provider is configured
+func (c OIDCConfig) Enabled() bool {
+	return c.Issuer != ""
+}
+
+// Validate checks the provider settings. The redirect URL is built from publicURL, which must be set.
+func (c OIDCConfig) Validate(publicURL string) error {
+	u, err := url.Parse(c.Issuer)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("invalid oidc-issuer %q (expected e.g. https://accounts.example.com)", c.Issuer)
+	}
+	if c.ClientID == "" || c.ClientSecret == "" {
+		return errors.New("oidc-client-id and oidc-client-secret are required when oidc-issuer is set")
+	}
+	if publicURL == "" {
+		return errors.New("public-url is required to build the login redirect when oidc-issuer is set")
+	}
+	return nil
+}
+
+// parseEmailList parses a comma-separated list of emails or domains, lowercased
+func parseEmailList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			list = append(list, strings.TrimPrefix(item, "@"))
+		}
+	}
+	return list
+}
+
+// OIDCIdentity is a signed-in account
+type OIDCIdentity struct {
+	Subject string
+	Email   string // Empty when the provider didn't release a verified email
+	Expires time.Time
+}
+
+// oidcLogin is a login waiting for the provider to redirect back
+type oidcLogin struct {
+	nonce    string
+	verifier string // PKCE code verifier
+	next     string // Path to return to after signing in
+	expires  time.Time
+}
+
+// oidcDiscovery holds the endpoints read from the provider's discovery document
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCProvider signs users in with the authorization code flow and keeps their sessions in
+// memory, so a restart signs everyone out
+type OIDCProvider struct {
+	config      OIDCConfig
+	redirectURL string
+	client      *http.Client
+
+	mu          sync.Mutex
+	discovery   *oidcDiscovery // Fetched on first use
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+	pending     map[string]oidcLogin    // By state
+	sessions    map[string]OIDCIdentity // By SHA-256 of the session token
+}
+
+// NewOIDCProvider creates a provider whose logins return to redirectURL
+func NewOIDCProvider(config OIDCConfig, redirectURL string) *OIDCProvider {
+	return &OIDCProvider{
+		config:      config,
+		redirectURL: redirectURL,
+		client:      &http.Client{Timeout: OIDCRequestTimeout},
+		pending:     make(map[string]oidcLogin),
+		sessions:    make(map[string]OIDCIdentity),
+	}
+}
+
+// getJSON fetches endpoint and decodes a 200 JSON response into out
+func (p *OIDCProvider) getJSON(ctx context.Context, endpoint string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s returned status %d", endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// endpoints returns the provider's discovery document, fetching it on first use
+func (p *OIDCProvider) endpoints(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	discovery := p.discovery
+	p.mu.Unlock()
+	if discovery != nil {
+		return discovery, nil
+	}
+
+	discovery = &oidcDiscovery{}
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.config.Issuer, "/")+"/.well-known/openid-configuration", discovery); err != nil {
+		return nil, fmt.Errorf("failed to fetch OIDC discovery document: %w", err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != strings.TrimSuffix(p.config.Issuer, "/") {
+		return nil, fmt.Errorf("OIDC discovery document is for issuer %q", discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document is missing endpoints")
+	}
+
+	p.mu.Lock()
+	p.discovery = discovery
+	p.mu.Unlock()
+	return discovery, nil
+}
+
+// Begin starts a login returning to next and returns the provider URL to send the browser to,
+// and the state to remember in the browser
+func (p *OIDCProvider) Begin(ctx context.Context, next string, now time.Time) (string, string, error) {
+	discovery, err := p.endpoints(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	login := oidcLogin{nonce: generateToken(), verifier: generateToken(), next: next, expires: now.Add(OIDCLoginTimeout)}
+	state := generateToken()
+	p.mu.Lock()
+	if len(p.pending) >= MaxOIDCPending {
+		p.mu.Unlock()
+		return "", "", errors.New("too many logins in progress")
+	}
+	p.pending[state] = login
+	p.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(login.verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.redirectURL},
+		"scope":                 {"openid email"},
+		"state":                 {state},
+		"nonce":                 {login.nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), state, nil
+}
+
+// Complete redeems the code the provider redirected back with for the login started with
+// state, and returns the account and the path to return to
+func (p *OIDCProvider) Complete(ctx context.Context, state, code string, now time.Time) (OIDCIdentity, string, error) {
+	p.mu.Lock()
+	login, ok := p.pending[state]
+	delete(p.pending, state)
+	p.mu.Unlock()
+	if !ok || now.After(login.expires) {
+		return OIDCIdentity{}, "", ErrOIDCLoginExpired
+	}
+
+	discovery, err := p.endpoints(ctx)
+	if err != nil {
+		return OIDCIdentity{}, "", err
+	}
+	rawIDToken, err := p.exchange(ctx, discovery.TokenEndpoint, code, login.verifier)
+	if err != nil {
+		return OIDCIdentity{}, "", err
+	}
+	claims, err := p.verifyIDToken(ctx, discovery, rawIDToken, now)
+	if err != nil {
+		return OIDCIdentity{}, "", err
+	}
+	if claims.Nonce != login.nonce {
+		return OIDCIdentity{}, "", errors.New("ID token nonce does not match the login")
+	}
+
+	identity := OIDCIdentity{Subject: claims.Subject, Expires: now.Add(OIDCSessionLifetime)}
+	if claims.Email != "" && claims.EmailVerified != nil && *claims.EmailVerified {
+		identity.Email = strings.ToLower(claims.Email)
+	}
+	if !p.allowed(identity) {
+		return OIDCIdentity{}, "", ErrOIDCNotAllowed
+	}
+	return identity, login.next, nil
+}
+
+// allowed reports whether identity's email domain may sign in
+func (p *OIDCProvider) allowed(identity OIDCIdentity) bool {
+	if len(p.config.AllowedDomains) == 0 {
+		return true
+	}
+	_, domain, ok := strings.Cut(identity.Email, "@")
+	return ok && slices.Contains(p.config.AllowedDomains, domain)
+}
+
+// IsAdmin reports whether identity may open admin pages
+func (p *OIDCProvider) IsAdmin(identity OIDCIdentity) bool {
+	return identity.Email != "" && slices.Contains(p.config.AdminEmails, identity.Email)
+}
+
+// exchange redeems an authorization code at the token endpoint and returns the ID token
+func (p *OIDCProvider) exchange(ctx context.Context, endpoint, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to redeem OIDC code: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("OIDC token endpoint returned status %d", resp.StatusCode)
+	}
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil || token.IDToken == "" {
+		return "", errors.New("OIDC token response has no ID token")
+	}
+	return token.IDToken, nil
+}
+
+// idTokenClaims are the ID token claims picosend checks or uses
+type idTokenClaims struct {
+	Issuer        string          `json:"iss"`
+	Subject       string          `json:"sub"`
+	Audience      json.RawMessage `json:"aud"` // A string or an array of them
+	Expiry        int64           `json:"exp"`
+	IssuedAt      int64           `json:"iat"`
+	Nonce         string          `json:"nonce"`
+	Email         string          `json:"email"`
+	EmailVerified *bool           `json:"email_verified"`
+}
+
+// hasAudience reports whether the token was issued to clientID
+func (c idTokenClaims) hasAudience(clientID string) bool {
+	var single string
+	if json.Unmarshal(c.Audience, &single) == nil {
+		return single == clientID
+	}
+	var list []string
+	return json.Unmarshal(c.Audience, &list) == nil && slices.Contains(list, clientID)
+}
+
+// verifyIDToken checks the signature of a compact JWT against the provider's keys, and that it
+// was issued by the provider to this client and is current
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, discovery *oidcDiscovery, raw string, now time.Time) (idTokenClaims, error) {
+	var claims idTokenClaims
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return claims, errors.New("malformed ID token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return claims, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, errors.New("malformed ID token signature")
+	}
+
+	key, err := p.signingKey(ctx, discovery, header.Kid, now)
+	if err != nil {
+		return claims, err
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return claims, err
+	}
+
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return claims, err
+	}
+	switch {
+	case claims.Issuer != discovery.Issuer:
+		return claims, errors.New("ID token is from another issuer")
+	case !claims.hasAudience(p.config.ClientID):
+		return claims, errors.New("ID token is for another client")
+	case now.After(time.Unix(claims.Expiry, 0).Add(OIDCClockSkew)):
+		return claims, errors.New("ID token has expired")
+	case time.Unix(claims.IssuedAt, 0).After(now.Add(OIDCClockSkew)):
+		return claims, errors.New("ID token is issued in the future")
+	case claims.Subject == "":
+		return claims, errors.New("ID token has no subject")
+	}
+	return claims, nil
+}
+
+// decodeJWTPart decodes a base64url JSON part of a JWT into out
+func decodeJWTPart(part string, out any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil || json.Unmarshal(data, out) != nil {
+		return errors.New("malformed ID token")
+	}
+	return nil
+}
+
+// verifyJWTSignature checks an RS256 or ES256 signature over signed
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+	switch alg {
+	case "RS256":
+		if key, ok := key.(*rsa.PublicKey); ok && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+	case "ES256":
+		if key, ok := key.(*ecdsa.PublicKey); ok && len(signature) == 64 {
+			r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+			if ecdsa.Verify(key, digest[:], r, s) {
+				return nil
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported ID token algorithm %q", alg)
+	}
+	return errors.New("invalid ID token signature")
+}
+
+// signingKey returns the provider key with kid, fetching the key set again when the key is
+// unknown, as after the provider rotated its keys
+func (p *OIDCProvider) signingKey(ctx context.Context, discovery *oidcDiscovery, kid string, now time.Time) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	fetched := p.keysFetched
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if !fetched.IsZero() && now.Sub(fetched) < OIDCKeysRefresh {
+		return nil, fmt.Errorf("unknown ID token key %q", kid)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, discovery.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("failed to fetch OIDC signing keys: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if key, err := jwk.publicKey(); err == nil && (jwk.Use == "" || jwk.Use == "sig") {
+			keys[jwk.Kid] = key
+		}
+	}
+
+	p.mu.Lock()
+	p.keys, p.keysFetched = keys, now
+	p.mu.Unlock()
+	if key, ok = keys[kid]; !ok {
+		return nil, fmt.Errorf("unknown ID token key %q", kid)
+	}
+	return key, nil
+}
+
+// jsonWebKey is an RSA or P-256 key from a JWK set
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := func(value string) *big.Int {
+		data, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(data) == 0 {
+			return nil
+		}
+		return new(big.Int).SetBytes(data)
+	}
+	switch {
+	case k.Kty == "RSA":
+		n, e := decode(k.N), decode(k.E)
+		if n == nil || e == nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case k.Kty == "EC" && k.Crv == "P-256":
+		x, y := decode(k.X), decode(k.Y)
+		if x == nil || y == nil || !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("invalid EC key")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// sessionKey hashes a session token, so the tokens themselves are never kept
+func sessionKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return string(sum[:])
+}
+
+// CreateSession signs identity in and returns the token for the session cookie
+func (p *OIDCProvider) CreateSession(identity OIDCIdentity) (string, error) {
+	token := make([]byte, 32)
+	rand.Read(token)
+	encoded := base64.RawURLEncoding.EncodeToString(token)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.sessions) >= MaxOIDCSessions {
+		return "", errors.New("too many sessions")
+	}
+	p.sessions[sessionKey(encoded)] = identity
+	return encoded, nil
+}
+
+// Session returns the account signed in with token
+func (p *OIDCProvider) Session(token string, now time.Time) (OIDCIdentity, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	identity, ok := p.sessions[sessionKey(token)]
+	if !ok || now.After(identity.Expires) {
+		return OIDCIdentity{}, false
+	}
+	return identity, true
+}
+
+// EndSession signs out the session with token
+func (p *OIDCProvider) EndSession(token string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.sessions, sessionKey(token))
+}
+
+// Prune forgets expired sessions and abandoned logins
+func (p *OIDCProvider) Prune(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for state, login := range p.pending {
+		if now.After(login.expires) {
+			delete(p.pending, state)
+		}
+	}
+	for key, identity := range p.sessions {
+		if now.After(identity.Expires) {
+			delete(p.sessions, key)
+		}
+	}
+}
+
+// requestIdentity returns the account the request's session cookie belongs to
+func (srv *Server) requestIdentity(r *http.Request) (OIDCIdentity, bool) {
+	if srv.oidc == nil {
+		return OIDCIdentity{}, false
+	}
+	cookie, err := r.Cookie(OIDCSessionCookie)
+	if err != nil || cookie.Value == "" {
+		return OIDCIdentity{}, false
+	}
+	return srv.oidc.Session(cookie.Value, time.Now())
+}
+
+// loginURL returns the path that signs in and then returns to next, relative to the base path
+func (srv *Server) loginURL(next string) string {
+	return srv.config.BasePath + "/auth/login?" + url.Values{"next": {next}}.Encode()
+}
+
+// authCookie creates a cookie for the sign-in flow, scoped to the server's paths
+func (srv *Server) authCookie(name, value string, maxAge time.Duration) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     srv.config.BasePath + "/",
+		MaxAge:   int(maxAge / time.Second),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(srv.config.PublicURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// safeNextPath returns next when it is a path on this server, or else "/". Absolute and
+// scheme-relative URLs would turn the login into an open redirect.
+func safeNextPath(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// loginHandler sends the browser to the provider to sign in
+func (srv *Server) loginHandler(w http.ResponseWriter, r *http.Request) {
+	if srv.oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+	authURL, state, err := srv.oidc.Begin(r.Context(), safeNextPath(r.URL.Query().Get("next")), time.Now())
+	if err != nil {
+		srv.logger.Error("Failed to start login", "error", err)
+		localizedError(w, r, http.StatusBadGateway, "error.login_unavailable")
+		return
+	}
+	// Ties the login to this browser, so a login started elsewhere can't be completed here
+	http.SetCookie(w, srv.authCookie(OIDCStateCookie, state, OIDCLoginTimeout))
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// loginCallbackHandler completes a login when the provider redirects back, and starts a session
+func (srv *Server) loginCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if srv.oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+	query := r.URL.Query()
+	state := query.Get("state")
+	http.SetCookie(w, srv.authCookie(OIDCStateCookie, "", -time.Second))
+	if cookie, err := r.Cookie(OIDCStateCookie); err != nil || state == "" || cookie.Value != state {
+		localizedError(w, r, http.StatusForbidden, "error.login_failed")
+		return
+	}
+	if query.Get("error") != "" {
+		srv.logger.Info("Login refused by the provider", "error", query.Get("error"))
+		localizedError(w, r, http.StatusForbidden, "error.login_failed")
+		return
+	}
+
+	identity, next, err := srv.oidc.Complete(r.Context(), state, query.Get("code"), time.Now())
+	if errors.Is(err, ErrOIDCNotAllowed) {
+		localizedError(w, r, http.StatusForbidden, "error.login_not_allowed")
+		return
+	}
+	if err != nil {
+		srv.logger.Warn("Login failed", "error", err)
+		localizedError(w, r, http.StatusForbidden, "error.login_failed")
+		return
+	}
+	token, err := srv.oidc.CreateSession(identity)
+	if err != nil {
+		srv.logger.Error("Failed to start session", "error", err)
+		localizedError(w, r, http.StatusServiceUnavailable, "error.login_unavailable")
+		return
+	}
+	srv.logger.Info("Signed in", "subject", identity.Subject, "email", identity.Email)
+
+	http.SetCookie(w, srv.authCookie(OIDCSessionCookie, token, OIDCSessionLifetime))
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, srv.config.BasePath+next, http.StatusSeeOther)
+}
+
+// logoutHandler ends the session and returns to the home page
+func (srv *Server) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if srv.oidc == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if cookie, err := r.Cookie(OIDCSessionCookie); err == nil {
+		srv.oidc.EndSession(cookie.Value)
+	}
+	http.SetCookie(w, srv.authCookie(OIDCSessionCookie, "", -time.Second))
+	http.Redirect(w, r, srv.config.BasePath+"/", http.StatusSeeOther)
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeOIDCProvider is an OpenID Connect provider that signs in whoever is set in email
+type fakeOIDCProvider struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	email     string
+	noVerify  bool   // Leave email_verified out of ID tokens, as some providers do
+	nonce     string // Nonce of the last login, set by the test from the authorization URL
+	challenge string // PKCE challenge of the last login
+}
+
+func newFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeOIDCProvider{key: key, email: "alice@example.com"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                p.URL,
+			AuthorizationEndpoint: p.URL + "/authorize",
+			TokenEndpoint:         p.URL + "/token",
+			JWKSURI:               p.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []jsonWebKey{{
+			Kty: "RSA",
+			Kid: "test",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if id != "picosend" || secret != "client-secret" || r.FormValue("code") != "good-code" ||
+			base64.RawURLEncoding.EncodeToString(verifier[:]) != p.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		claims := map[string]any{
+			"iss": p.URL, "aud": "picosend", "sub": "user-1", "email": p.email, "email_verified": true,
+			"nonce": p.nonce, "iat": time.Now().Unix(), "exp": time.Now().Add(time.Hour).Unix(),
+		}
+		if p.noVerify {
+			delete(claims, "email_verified")
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": p.idToken(claims)})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+// idToken signs claims as an RS256 JWT
+func (p *fakeOIDCProvider) idToken(claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func newOIDCTestServer(t *testing.T, provider *fakeOIDCProvider, configure ...func(*Config)) *Server {
+	return newTestServer(t, append([]func(*Config){func(cfg *Config) {
+		cfg.PublicURL = "https://picosend.example.com"
+		cfg.OIDC = OIDCConfig{Issuer: provider.URL, ClientID: "picosend", ClientSecret: "client-secret"}
+	}}, configure...)...)
+}
+
+// signIn runs a login through the fake provider and returns the callback response
+func signIn(t *testing.T, srv *Server, provider *fakeOIDCProvider, next string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/auth/login?next="+url.QueryEscape(next), nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("Expected the login to redirect to the provider, got %d %s", rec.Code, rec.Body.String())
+	}
+	authURL, _ := url.Parse(rec.Header().Get("Location"))
+	query := authURL.Query()
+	if !strings.HasPrefix(authURL.String(), provider.URL+"/authorize?") || query.Get("redirect_uri") != "https://picosend.example.com/auth/callback" {
+		t.Fatalf("Unexpected authorization URL %s", authURL)
+	}
+	provider.nonce, provider.challenge = query.Get("nonce"), query.Get("code_challenge")
+
+	callback := httptest.NewRequest("GET", "/auth/callback?code=good-code&state="+url.QueryEscape(query.Get("state")), nil)
+	for _, cookie := range rec.Result().Cookies() {
+		callback.AddCookie(cookie)
+	}
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, callback)
+	return rec
+}
+
+// sessionCookie returns the session cookie set by a response
+func sessionCookie(rec *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == OIDCSessionCookie && cookie.Value != "" {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestOIDC_LoginGatesCreation(t *testing.T) {
+	provider := newFakeOIDCProvider(t)
+	srv := newOIDCTestServer(t, provider)
+	body := `{"content":"c2VjcmV0"}`
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/auth/login?next=%2F" {
+		t.Errorf("Expected the home page to send visitors to sign in, got %d %s", rec.Code, rec.Header().Get("Location"))
+	}
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("POST", "/api/secrets", strings.NewReader(body)))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 creating without a session, got %d", rec.Code)
+	}
+
+	rec = signIn(t, srv, provider, "/")
+	session := sessionCookie(rec)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/" || session == nil {
+		t.Fatalf("Expected the callback to start a session and return home, got %d %s", rec.Code, rec.Body.String())
+	}
+	if !session.HttpOnly || !session.Secure {
+		t.Errorf("Expected an HttpOnly, Secure session cookie, got %+v", session)
+	}
+
+	req := httptest.NewRequest("POST", "/api/secrets", strings.NewReader(body))
+	req.AddCookie(session)
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected a signed-in create to succeed, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(session)
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "alice@example.com") {
+		t.Errorf("Expected the home page to show the account, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/auth/logout", nil)
+	req.AddCookie(session)
+	srv.routes().ServeHTTP(httptest.NewRecorder(), req)
+	if _, ok := srv.oidc.Session(session.Value, time.Now()); ok {
+		t.Error("Expected signing out to end the session")
+	}
+}
+
+func TestOIDC_ReadingNeedsNoLogin(t *testing.T) {
+	provider := newFakeOIDCProvider(t)
+	srv := newOIDCTestServer(t, provider)
+	id, _ := srv.store.Store("content", time.Hour)
+
+	if rec := claimSecret(t, srv, id, ClaimSecretRequest{}); rec.Code != http.StatusOK {
+		t.Errorf("Expected an anonymous read to succeed, got %d", rec.Code)
+	}
+}
+
+func TestOIDC_CallbackRejections(t *testing.T) {
+	provider := newFakeOIDCProvider(t)
+	srv := newOIDCTestServer(t, provider, func(cfg *Config) {
+		cfg.OIDC.AllowedDomains = []string{"example.com"}
+	})
+
+	// A callback without the state cookie of the browser that started the login
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/auth/callback?code=good-code&state=forged", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a callback without the state cookie, got %d", rec.Code)
+	}
+
+	provider.email = "mallory@elsewhere.com"
+	if rec := signIn(t, srv, provider, "/"); rec.Code != http.StatusForbidden || sessionCookie(rec) != nil {
+		t.Errorf("Expected 403 for an account outside the allowed domains, got %d", rec.Code)
+	}
+}
+
+func TestOIDC_VerifyIDToken(t *testing.T) {
+	provider := newFakeOIDCProvider(t)
+	p := NewOIDCProvider(OIDCConfig{Issuer: provider.URL, ClientID: "picosend"}, "")
+	discovery := &oidcDiscovery{Issuer: provider.URL, JWKSURI: provider.URL + "/keys"}
+	now := time.Now()
+	valid := map[string]any{"iss": provider.URL, "aud": []string{"other", "picosend"}, "sub": "user-1", "iat": now.Unix(), "exp": now.Add(time.Hour).Unix()}
+
+	if _, err := p.verifyIDToken(context.Background(), discovery, provider.idToken(valid), now); err != nil {
+		t.Errorf("Expected a valid token to verify, got %v", err)
+	}
+
+	tampered := provider.idToken(valid)
+	parts := strings.Split(tampered, ".")
+	claims, _ := json.Marshal(map[string]any{"iss": provider.URL, "aud": "picosend", "sub": "admin", "iat": now.Unix(), "exp": now.Add(time.Hour).Unix()})
+	parts[1] = base64.RawURLEncoding.EncodeToString(claims)
+	if _, err := p.verifyIDToken(context.Background(), discovery, strings.Join(parts, "."), now); err == nil {
+		t.Error("Expected a token with altered claims to be rejected")
+	}
+
+	for name, change := range map[string]func(map[string]any){
+		"wrong audience": func(c map[string]any) { c["aud"] = "other" },
+		"wrong issuer":   func(c map[string]any) { c["iss"] = "https://evil.example.com" },
+		"expired":        func(c map[string]any) { c["exp"] = now.Add(-time.Hour).Unix() },
+	} {
+		claims := map[string]any{}
+		for k, v := range valid {
+			claims[k] = v
+		}
+		change(claims)
+		if _, err := p.verifyIDToken(context.Background(), discovery, provider.idToken(claims), now); err == nil {
+			t.Errorf("Expected a token with %s to be rejected", name)
+		}
+	}
+}
+
+func TestSafeNextPath(t *testing.T) {
+	for next, expected := range map[string]string{
+		"/admin/stats":         "/admin/stats",
+		"":                     "/",
+		"https://evil.example": "/",
+		"//evil.example":       "/",
+		"/\\evil.example":      "/",
+	} {
+		if got := safeNextPath(next); got != expected {
+			t.Errorf("safeNextPath(%q) = %q, expected %q", next, got, expected)
+		}
+	}
+}
+
+func TestOIDC_AdminPage(t *testing.T) {
+	provider := newFakeOIDCProvider(t)
+	srv := newOIDCTestServer(t, provider, func(cfg *Config) {
+		cfg.OIDC.AdminEmails = []string{"alice@example.com"}
+	})
+
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/admin/stats", nil))
+	if rec.Code != http.StatusFound {
+		t.Errorf("Expected the dashboard to send visitors to sign in, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/admin/stats", nil)
+	req.AddCookie(sessionCookie(signIn(t, srv, provider, "/admin/stats")))
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected an admin account to open the dashboard, got %d", rec.Code)
+	}
+}
+
+func TestOIDC_AllowedReaders(t *testing.T) {
+	provider := newFakeOIDCProvider(t)
+	srv := newOIDCTestServer(t, provider)
+	readers, _ := parseReaderFilter([]string{"alice@example.com"})
+	id, _ := srv.store.StoreWithOptions("content", time.Hour, SecretOptions{Readers: readers, MaxReads: 2})
+
+	claim := func(session *http.Cookie) int {
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/api/secrets/"+id, nil))
+		var meta SecretMetadataResponse
+		json.NewDecoder(rec.Body).Decode(&meta)
+		if !meta.LoginRequired {
+			t.Error("Expected the metadata to report that a login is required")
+		}
+
+		req := httptest.NewRequest("POST", "/api/secrets/"+id+"/claim", strings.NewReader(`{"claim_token":"`+meta.ClaimToken+`"}`))
+		if session != nil {
+			req.AddCookie(session)
+		}
+		rec = httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := claim(nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 reading without a session, got %d", code)
+	}
+	provider.email = "mallory@example.com"
+	if code := claim(sessionCookie(signIn(t, srv, provider, "/"))); code != http.StatusForbidden {
+		t.Errorf("Expected 403 reading as another account, got %d", code)
+	}
+	provider.email = "Alice@Example.com"
+	if code := claim(sessionCookie(signIn(t, srv, provider, "/"))); code != http.StatusOK {
+		t.Errorf("Expected the allowed reader to read the secret, got %d", code)
+	}
+}
+
+func TestCreateSecret_AllowedReadersNeedOIDC(t *testing.T) {
+	srv := newTestServer(t)
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("POST", "/api/secrets", strings.NewReader(`{"content":"c2VjcmV0","allowed_readers":["bob@example.com"]}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 binding readers without single sign-on, got %d", rec.Code)
+	}
+}
+
+func TestOIDC_EmailWithoutVerifiedClaim(t *testing.T) {
+	provider := newFakeOIDCProvider(t)
+	provider.noVerify = true
+
+	// Only verified emails count for the allowed domains
+	srv := newOIDCTestServer(t, provider, func(cfg *Config) { cfg.OIDC.AllowedDomains = []string{"example.com"} })
+	if rec := signIn(t, srv, provider, "/"); rec.Code != http.StatusForbidden || sessionCookie(rec) != nil {
+		t.Errorf("Expected 403 for an unverified email in an allowed domain, got %d", rec.Code)
+	}
+
+	// Nor for admin pages and allowed readers
+	srv = newOIDCTestServer(t, provider, func(cfg *Config) { cfg.OIDC.AdminEmails = []string{"alice@example.com"} })
+	session := sessionCookie(signIn(t, srv, provider, "/"))
+	if session == nil {
+		t.Fatal("Expected an account without a verified email to sign in")
+	}
+	req := httptest.NewRequest("GET", "/admin/stats", nil)
+	req.AddCookie(session)
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code == http.StatusOK {
+		t.Error("Expected an unverified admin email not to open the dashboard")
+	}
+
+	readers, _ := parseReaderFilter([]string{"alice@example.com"})
+	id, _ := srv.store.StoreWithOptions("content", time.Hour, SecretOptions{Readers: readers})
+	req = httptest.NewRequest("POST", "/api/secrets/"+id+"/claim", strings.NewReader(`{"claim_token":"`+srv.claims.Issue(id, time.Now())+`"}`))
+	req.AddCookie(session)
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 reading as an unverified allowed reader, got %d", rec.Code)
+	}
+}
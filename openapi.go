@@ -0,0 +1,56 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+)
+
+// SwaggerUIBase is where the Swagger UI assets are loaded from. They are not bundled
+// to keep the binary small, so the docs page needs outbound access to the CDN.
+const SwaggerUIBase = "https://unpkg.com/swagger-ui-dist@5.17.14"
+
+//go:embed api/openapi.json
+var openAPISpec []byte
+
+// openAPIHandler serves the OpenAPI 3 document describing the public /api routes.
+// Under a base path the document gets a relative server URL so clients call the prefixed routes.
+func (srv *Server) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	spec := openAPISpec
+	if srv.config.BasePath != "" {
+		var doc map[string]any
+		if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+			apiError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		doc["servers"] = []map[string]string{{"url": srv.config.BasePath}}
+		spec, _ = json.Marshal(doc)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(spec)
+}
+
+// apiDocsHandler renders Swagger UI for the OpenAPI document. It is off unless enabled
+// because it pulls scripts from a third-party CDN.
+func (srv *Server) apiDocsHandler(w http.ResponseWriter, r *http.Request) {
+	if !srv.config.SwaggerUI {
+		http.NotFound(w, r)
+		return
+	}
+
+	// The default policy only allows same-origin scripts
+	w.Header().Set("Content-Security-Policy", "default-src 'self'; script-src 'self' "+SwaggerUIBase+"/; "+
+		"style-src 'self' 'unsafe-inline' "+SwaggerUIBase+"/; img-src 'self' data:; connect-src 'self'; "+
+		"object-src 'none'; base-uri 'none'; frame-ancestors 'none'")
+	data := struct {
+		BasePath      string
+		SwaggerUIBase string
+		Nonce         string
+	}{
+		BasePath:      srv.config.BasePath,
+		SwaggerUIBase: SwaggerUIBase,
+		Nonce:         srv.scriptNonce(w),
+	}
+	srv.renderPage(w, locales[DefaultLocale], "api-docs.html", data)
+}
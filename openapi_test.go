@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestOpenAPISpec_CoversAPIRoutes(t *testing.T) {
+	var spec struct {
+		OpenAPI string                                `json:"openapi"`
+		Paths   map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("Failed to parse OpenAPI spec: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Errorf("Expected OpenAPI 3 document, got version %q", spec.OpenAPI)
+	}
+
+	// Every public /api route must be documented so generated clients stay complete
+	err := newTestServer(t).routes().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		// The CORS preflight catch-all is registered as /api/
+		if err != nil || !strings.HasPrefix(path, "/api/") || path == "/api/" || path == "/api/openapi.json" || path == "/api/docs" {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			if _, ok := spec.Paths[path][strings.ToLower(method)]; !ok {
+				t.Errorf("Expected %s %s to be documented in the OpenAPI spec", method, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to walk routes: %v", err)
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	_, server := setupTestServer(t)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/openapi.json")
+	if err != nil {
+		t.Fatalf("Failed to get spec: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Expected JSON content type, got %s", resp.Header.Get("Content-Type"))
+	}
+}
+
+func TestAPIDocsHandler(t *testing.T) {
+	srv, server := setupTestServer(t)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/docs")
+	if err != nil {
+		t.Fatalf("Failed to get docs: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404 when Swagger UI is disabled, got %d", resp.StatusCode)
+	}
+
+	srv.config.SwaggerUI = true
+
+	resp, err = http.Get(server.URL + "/api/docs")
+	if err != nil {
+		t.Fatalf("Failed to get docs: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200 when Swagger UI is enabled, got %d", resp.StatusCode)
+	}
+	if !strings.Contains(resp.Header.Get("Content-Security-Policy"), SwaggerUIBase) {
+		t.Errorf("Expected CSP to allow the Swagger UI CDN, got %q", resp.Header.Get("Content-Security-Policy"))
+	}
+}
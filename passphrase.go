@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"runtime"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2id parameters used for hashing secret passphrases
+const (
+	argon2Time    = 1
+	argon2Memory  = 64 * 1024 // 64 MiB
+	argon2Threads = 4
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+
+	argon2WaitTimeout = time.Second // Longest a request waits for a free hashing slot
+)
+
+var ErrHashingBusy = errors.New("too many passphrases are being hashed")
+
+// argon2Slots bounds concurrent derivations, as each one holds argon2Memory: without it a burst
+// of requests with passphrases or PINs could exhaust the server's memory
+var argon2Slots = make(chan struct{}, runtime.GOMAXPROCS(0))
+
+// deriveKey runs argon2id once a hashing slot is free, or fails with ErrHashingBusy if none
+// frees up within argon2WaitTimeout
+func deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	timer := time.NewTimer(argon2WaitTimeout)
+	defer timer.Stop()
+	select {
+	case argon2Slots <- struct{}{}:
+	case <-timer.C:
+		return nil, ErrHashingBusy
+	}
+	defer func() { <-argon2Slots }()
+	return argon2.IDKey([]byte(passphrase), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen), nil
+}
+
+// PassphraseHash holds the argon2id-derived key and salt for a protected secret
+type PassphraseHash struct {
+	Salt []byte
+	Key  []byte
+}
+
+// hashPassphrase derives an argon2id key from the passphrase using a random salt
+func hashPassphrase(passphrase string) (*PassphraseHash, error) {
+	salt := make([]byte, argon2SaltLen)
+	rand.Read(salt)
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &PassphraseHash{Salt: salt, Key: key}, nil
+}
+
+// Matches reports whether the passphrase derives to the stored key, using a constant-time
+// comparison. It fails with ErrHashingBusy when too many derivations are running.
+func (h *PassphraseHash) Matches(passphrase string) (bool, error) {
+	if h == nil {
+		return true, nil
+	}
+	key, err := deriveKey(passphrase, h.Salt)
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(key, h.Key) == 1, nil
+}
+
+// clone returns a deep copy so callers can compare outside the store lock
+func (h *PassphraseHash) clone() *PassphraseHash {
+	if h == nil {
+		return nil
+	}
+	return &PassphraseHash{
+		Salt: append([]byte(nil), h.Salt...),
+		Key:  append([]byte(nil), h.Key...),
+	}
+}
+
+// wipe zeroes the derived key and salt
+func (h *PassphraseHash) wipe() {
+	if h == nil {
+		return
+	}
+	for i := range h.Key {
+		h.Key[i] = 0
+	}
+	for i := range h.Salt {
+		h.Salt[i] = 0
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	SecretKeyHeader       = "X-Secret-Key"       // Key from a link's fragment, for reading as plain text
+	ManagementTokenHeader = "X-Management-Token" // Management token of a secret created from plain text
+	PickupPINHeader       = "X-Pickup-PIN"       // Pickup PIN of a secret created or read as plain text
+)
+
+// negotiate returns the offered media type the Accept header ranks highest. Types the
+// client doesn't name, including through */*, lose to fallback, which is also used on a tie.
+func negotiate(r *http.Request, fallback string, offers ...string) string {
+	best, bestQ := fallback, -1.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if mediaType == fallback && q >= bestQ {
+			best, bestQ = fallback, q
+			continue
+		}
+		for _, offer := range offers {
+			if mediaType == offer && q > 0 && q > bestQ {
+				best, bestQ = offer, q
+			}
+		}
+	}
+	return best
+}
+
+// isPlainText reports whether the request body is sent as text/plain
+func isPlainText(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "text/plain"
+}
+
+// plainTextCreateRequest reads the options of a plain-text create from its query parameters
+func plainTextCreateRequest(query url.Values) (CreateSecretRequest, *requestError) {
+	req := CreateSecretRequest{
+		Type:            query.Get("type"),
+		Label:           query.Get("label"),
+		Reference:       query.Get("reference"),
+		DeletionMessage: query.Get("deletion_message"),
+		NotBefore:       query.Get("not_before"),
+	}
+	for name, field := range map[string]*int{"lifetime": &req.Lifetime, "max_reads": &req.MaxReads, "hide_after": &req.HideAfter} {
+		if value := query.Get(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return req, &requestError{Code: http.StatusBadRequest, Key: "error.invalid_query_parameter", Args: []any{name}}
+			}
+			*field = n
+		}
+	}
+	if value := query.Get("require_pin"); value != "" {
+		requirePIN, err := strconv.ParseBool(value)
+		if err != nil {
+			return req, &requestError{Code: http.StatusBadRequest, Key: "error.invalid_query_parameter", Args: []any{"require_pin"}}
+		}
+		req.RequirePIN = requirePIN
+	}
+	return req, nil
+}
+
+// createPlainTextSecret stores a secret sent as a raw text/plain body, for curl --data-binary.
+// The server encrypts it like the web client would with a key it doesn't keep, and returns
+// the link with that key in the fragment. Unlike the JSON API, the server sees the content.
+func (srv *Server) createPlainTextSecret(w http.ResponseWriter, r *http.Request, apiKey *APIKey) {
+	req, reqErr := plainTextCreateRequest(r.URL.Query())
+	if reqErr != nil {
+		reqErr.reply(w, r)
+		return
+	}
+
+	maxLength := srv.secretLimits(apiKey).MaxSecretLength
+	plaintext, err := io.ReadAll(io.LimitReader(r.Body, int64(maxLength)+1))
+	defer wipeBytes(plaintext)
+	if err != nil {
+		apiError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(plaintext) > maxLength {
+		localizedError(w, r, http.StatusBadRequest, "error.content_too_long", maxLength)
+		return
+	}
+	if len(plaintext) == 0 {
+		localizedError(w, r, http.StatusBadRequest, "error.content_empty")
+		return
+	}
+	if reqErr := srv.scanPlaintext(r, plaintext); reqErr != nil {
+		reqErr.reply(w, r)
+		return
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		apiError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer wipeBytes(key)
+	if req.Content, err = encryptContent(plaintext, key); err != nil {
+		apiError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response, reqErr := srv.createSecret(r, apiKey, req)
+	if reqErr != nil {
+		reqErr.reply(w, r)
+		return
+	}
+	response.Link = srv.shareLink(r, response.ID) + "#" + base64.StdEncoding.EncodeToString(key)
+
+	if negotiate(r, "text/plain", "application/json") == "application/json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	w.Header().Set(ManagementTokenHeader, response.ManagementToken)
+	if response.PIN != "" {
+		w.Header().Set(PickupPINHeader, response.PIN)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, response.Link)
+}
+
+// readPlainText consumes a read and answers with the decrypted content, for clients that ask
+// for text/plain and send the key from the link, and the pickup PIN if there is one. Secrets
+// that need a passphrase, code, challenge or recipient key are left to the claim flow. The
+// key is required before anything else: Accept alone doesn't need a CORS preflight, so a
+// foreign page could otherwise burn secrets from a visitor's browser. A key that doesn't
+// decrypt the content is refused before the read is used.
+func (srv *Server) readPlainText(w http.ResponseWriter, r *http.Request, id string, meta *Secret) {
+	key, err := base64.StdEncoding.DecodeString(r.Header.Get(SecretKeyHeader))
+	if err != nil || len(key) != 32 {
+		localizedError(w, r, http.StatusBadRequest, "error.secret_key_required", SecretKeyHeader)
+		return
+	}
+	defer wipeBytes(key)
+
+	if !srv.checkUnlocked(w, r, meta) || !srv.checkReader(w, r, meta) {
+		return
+	}
+	if meta.Passphrase != nil || meta.TOTP != nil || meta.Recipient != "" || srv.challenger != nil {
+		localizedError(w, r, http.StatusNotAcceptable, "error.plain_text_unavailable")
+		return
+	}
+	if pin := r.Header.Get(PickupPINHeader); meta.PIN != nil && pin == "" {
+		localizedError(w, r, http.StatusForbidden, "error.pin_required")
+		return
+	} else if reqErr := srv.checkAnswer(r, id, meta.PIN, pin, "error.invalid_pin"); reqErr != nil {
+		reqErr.reply(w, r)
+		return
+	}
+
+	// The key is checked against the ciphertext first, so a wrong one leaves the read unused.
+	// Canaries don't use up reads and alert on any attempt, right key or not.
+	if !meta.Canary {
+		stored, found := srv.store.PeekContent(id)
+		if !found {
+			localizedError(w, r, http.StatusNotFound, "error.not_found")
+			return
+		}
+		checked, err := decryptContent(string(stored.Content), key)
+		wipeSecret(stored)
+		wipeBytes(checked)
+		if err != nil {
+			localizedError(w, r, http.StatusBadRequest, "error.secret_key_invalid")
+			return
+		}
+	}
+
+	secret, found := srv.readSecret(r, id, meta)
+	if !found {
+		localizedError(w, r, http.StatusNotFound, "error.not_found")
+		return
+	}
+	defer wipeSecret(secret)
+
+	plaintext, err := decryptContent(string(secret.Content), key)
+	if err != nil {
+		localizedError(w, r, http.StatusBadRequest, "error.secret_key_invalid")
+		return
+	}
+	defer wipeBytes(plaintext)
+	// A filename asks for the content as a file, typed by its extension
+	if filename := r.URL.Query().Get("filename"); filename != "" {
+		srv.setDownloadHeaders(w, r, downloadMediaType(sanitizeFilename(filename)))
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(plaintext)
+}
+
+// shareLink returns the link to a secret without its key, on the public URL when one is
+// configured and on the host the request was sent to otherwise
+func (srv *Server) shareLink(r *http.Request, signedID string) string {
+	if srv.config.PublicURL != "" {
+		return srv.config.PublicURL + srv.config.BasePath + "/s/" + signedID
+	}
+	return requestBaseURL(r, srv.config.BasePath) + "/s/" + signedID
+}
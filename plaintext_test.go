@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNegotiate(t *testing.T) {
+	for _, tt := range []struct {
+		accept string
+		want   string
+	}{
+		{"", "application/json"},
+		{"*/*", "application/json"},
+		{"text/plain", "text/plain"},
+		{"text/plain, application/json", "application/json"},
+		{"application/json;q=0.5, text/plain", "text/plain"},
+		{"text/plain;q=0.5, application/json", "application/json"},
+		{"text/plain;q=0", "application/json"},
+		{"text/html, */*;q=0.8", "application/json"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", tt.accept)
+		if got := negotiate(r, "application/json", "text/plain"); got != tt.want {
+			t.Errorf("negotiate(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+// createPlainText posts content as text/plain with query and returns the recorder
+func createPlainText(t *testing.T, srv *Server, query, content string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/api/secrets?"+query, strings.NewReader(content))
+	req.Header.Set("Content-Type", "text/plain")
+	for name, values := range header {
+		req.Header.Set(name, values[0])
+	}
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	return rec
+}
+
+// readPlainTextLink reads the secret behind link with Accept: text/plain
+func readPlainTextLink(t *testing.T, srv *Server, link string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/api/secrets/"+strings.TrimPrefix(u.Path, "/s/"), nil)
+	req.Header.Set("Accept", "text/plain")
+	req.Header.Set(SecretKeyHeader, u.Fragment)
+	for name, values := range header {
+		req.Header.Set(name, values[0])
+	}
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPlainText_CreateAndRead(t *testing.T) {
+	srv := newTestServer(t)
+
+	rec := createPlainText(t, srv, "lifetime=30&max_reads=2", "db password: hunter2\n", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	link := strings.TrimSpace(rec.Body.String())
+	if !strings.HasPrefix(link, "http://example.com/s/") || !strings.Contains(link, "#") {
+		t.Fatalf("Unexpected link %q", link)
+	}
+	if rec.Header().Get(ManagementTokenHeader) == "" {
+		t.Error("Expected the management token in a header")
+	}
+
+	// The stored content is encrypted with the key in the link, like the web client's
+	u, _ := url.Parse(link)
+	meta, _ := srv.store.Peek(strings.TrimPrefix(u.Path, "/s/"))
+	if meta == nil || meta.ReadsRemaining != 2 {
+		t.Fatalf("Expected 2 reads, got %+v", meta)
+	}
+
+	// Without the key nothing is consumed
+	noKey := readPlainTextLink(t, srv, strings.Split(link, "#")[0], nil)
+	if noKey.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without a key, got %d", noKey.Code)
+	}
+
+	for i := 0; i < 2; i++ {
+		rec := readPlainTextLink(t, srv, link, nil)
+		if rec.Code != http.StatusOK || rec.Body.String() != "db password: hunter2\n" {
+			t.Fatalf("Read %d: got %d %q", i+1, rec.Code, rec.Body.String())
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+			t.Errorf("Content-Type = %q", ct)
+		}
+	}
+	if rec := readPlainTextLink(t, srv, link, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 after the last read, got %d", rec.Code)
+	}
+}
+
+func TestPlainText_JSONResponseAndOptions(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.PublicURL = "https://secrets.example.com" })
+
+	rec := createPlainText(t, srv, "require_pin=true&label=deploy", "token", http.Header{"Accept": {"application/json"}})
+	var created CreateSecretResponse
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("Expected a JSON response, got %d: %v", rec.Code, err)
+	}
+	if !strings.HasPrefix(created.Link, "https://secrets.example.com/s/"+created.ID+"#") || created.PIN == "" {
+		t.Fatalf("Unexpected response %+v", created)
+	}
+
+	if rec := readPlainTextLink(t, srv, created.Link, nil); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403 without the PIN, got %d", rec.Code)
+	}
+	rec = readPlainTextLink(t, srv, created.Link, http.Header{PickupPINHeader: {created.PIN}})
+	if rec.Code != http.StatusOK || rec.Body.String() != "token" {
+		t.Errorf("Expected the content with the PIN, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	for _, query := range []string{"lifetime=soon", "require_pin=maybe", "lifetime=999999"} {
+		if rec := createPlainText(t, srv, query, "content", nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, rec.Code)
+		}
+	}
+	if rec := createPlainText(t, srv, "", "", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for empty content, got %d", rec.Code)
+	}
+}
+
+func TestPlainText_ReadRestrictions(t *testing.T) {
+	srv := newTestServer(t)
+	id, _ := srv.store.StoreWithOptions("ciphertext", time.Hour, SecretOptions{PassphraseHash: "hash"})
+
+	req := httptest.NewRequest("GET", "/api/secrets/"+id, nil)
+	req.Header.Set("Accept", "text/plain")
+	req.Header.Set(SecretKeyHeader, "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=")
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotAcceptable {
+		t.Errorf("Expected status 406 for a passphrase-protected secret, got %d", rec.Code)
+	}
+	if meta, found := srv.store.Peek(id); !found || meta.ReadsRemaining != 1 {
+		t.Error("Expected the secret not to be consumed")
+	}
+
+	// Clients that don't ask for text/plain still get the metadata
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/api/secrets/"+id, nil))
+	var meta SecretMetadataResponse
+	if err := json.NewDecoder(rec.Body).Decode(&meta); err != nil || !meta.PassphraseRequired {
+		t.Errorf("Expected JSON metadata, got %d: %v", rec.Code, err)
+	}
+}
+
+func TestPlainText_WrongKeyKeepsRead(t *testing.T) {
+	srv := newTestServer(t)
+	key, wrongKey := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	// CBC padding lets a wrong key through now and then, so the content is one it fails on
+	var content string
+	for content == "" {
+		content, _ = encryptContent([]byte("content"), key)
+		if _, err := decryptContent(content, wrongKey); err == nil {
+			content = ""
+		}
+	}
+	id, _ := srv.store.Store(content, time.Hour)
+
+	read := func(key []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/secrets/"+id, nil)
+		req.Header.Set("Accept", "text/plain")
+		req.Header.Set(SecretKeyHeader, base64.StdEncoding.EncodeToString(key))
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, req)
+		return rec
+	}
+	rec := read(wrongKey)
+	var body ErrorResponse
+	json.NewDecoder(rec.Body).Decode(&body)
+	if rec.Code != http.StatusBadRequest || body.Code != "secret_key_invalid" {
+		t.Errorf("Expected secret_key_invalid, got %d %q", rec.Code, body.Code)
+	}
+	if meta, found := srv.store.Peek(id); !found || meta.ReadsRemaining != 1 {
+		t.Fatal("Expected the wrong key to leave the read unused")
+	}
+	if rec := read(key); rec.Code != http.StatusOK || rec.Body.String() != "content" {
+		t.Errorf("Expected the right key to read the content, got %d %q", rec.Code, rec.Body.String())
+	}
+}
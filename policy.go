@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+)
+
+// Policy holds an organization's rules for new secrets, on top of the server's limits. It is
+// read from the JSON file named by POLICY_FILE and checked whenever a secret is created.
+type Policy struct {
+	// Lifetime caps by size: a secret is held to the lowest cap of the rules it is large enough for
+	MaxLifetimeBySize []SizeLifetimeRule `json:"max_lifetime_by_size,omitempty"`
+	// Secrets with more encrypted content than this need a passphrase; 0 for none
+	RequirePassphraseOver int   `json:"require_passphrase_over,omitempty"`
+	BannedLifetimes       []int `json:"banned_lifetimes,omitempty"` // Minutes
+	RequireWebhook        bool  `json:"require_webhook,omitempty"`  // Every secret must report to a webhook_url
+}
+
+// SizeLifetimeRule caps the lifetime of secrets of at least MinSize bytes of encrypted content
+type SizeLifetimeRule struct {
+	MinSize     int `json:"min_size"`
+	MaxLifetime int `json:"max_lifetime"` // Minutes
+}
+
+// loadPolicy reads a policy file. Unknown fields are refused, so a misspelt rule can't pass
+// for an enforced one. An empty path means no policy.
+func loadPolicy(path string) (*Policy, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading policy file: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var policy Policy
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("parsing policy file: %w", err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("policy file: %w", err)
+	}
+	return &policy, nil
+}
+
+// Validate checks that sizes and lifetimes make sense
+func (p *Policy) Validate() error {
+	for _, rule := range p.MaxLifetimeBySize {
+		if rule.MinSize < 0 || rule.MaxLifetime < 1 {
+			return errors.New("max_lifetime_by_size needs a min_size of at least 0 and a max_lifetime of at least 1")
+		}
+	}
+	if p.RequirePassphraseOver < 0 {
+		return errors.New("require_passphrase_over must not be negative")
+	}
+	for _, lifetime := range p.BannedLifetimes {
+		if lifetime < 1 {
+			return errors.New("banned_lifetimes must be positive")
+		}
+	}
+	return nil
+}
+
+// policySize is the size of req's content the policy goes by. Chunked secrets are checked
+// before their content arrives, so they count as larger than any size in the policy.
+func policySize(req CreateSecretRequest) int {
+	if req.Chunked {
+		return math.MaxInt
+	}
+	return len(req.Content)
+}
+
+// MaxLifetime returns the longest lifetime in minutes the size rules allow req, also when the
+// sender extends it later; 0 when no rule applies or the policy is nil
+func (p *Policy) MaxLifetime(req CreateSecretRequest) int {
+	if p == nil {
+		return 0
+	}
+	size := policySize(req)
+	maxLifetime := 0
+	for _, rule := range p.MaxLifetimeBySize {
+		if size >= rule.MinSize && (maxLifetime == 0 || rule.MaxLifetime < maxLifetime) {
+			maxLifetime = rule.MaxLifetime
+		}
+	}
+	return maxLifetime
+}
+
+// Check returns the first rule req breaks, or nil. req.Lifetime must already be defaulted.
+// A nil policy allows everything.
+func (p *Policy) Check(req CreateSecretRequest) *requestError {
+	if p == nil {
+		return nil
+	}
+	size := policySize(req)
+	if maxLifetime := p.MaxLifetime(req); maxLifetime > 0 && req.Lifetime > maxLifetime {
+		return &requestError{Code: http.StatusBadRequest, Key: "error.policy_lifetime", Args: []any{maxLifetime}}
+	}
+	if slices.Contains(p.BannedLifetimes, req.Lifetime) {
+		return &requestError{Code: http.StatusBadRequest, Key: "error.policy_lifetime_banned", Args: []any{req.Lifetime}}
+	}
+	if p.RequirePassphraseOver > 0 && size > p.RequirePassphraseOver && req.PassphraseHash == "" {
+		return &requestError{Code: http.StatusBadRequest, Key: "error.policy_passphrase_required", Args: []any{p.RequirePassphraseOver}}
+	}
+	if p.RequireWebhook && req.WebhookURL == "" {
+		return &requestError{Code: http.StatusBadRequest, Key: "error.policy_webhook_required"}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPolicy_Check(t *testing.T) {
+	policy := &Policy{
+		MaxLifetimeBySize:     []SizeLifetimeRule{{MinSize: 0, MaxLifetime: 10080}, {MinSize: 1000, MaxLifetime: 60}},
+		RequirePassphraseOver: 2000,
+		BannedLifetimes:       []int{5},
+		RequireWebhook:        true,
+	}
+	small := strings.Repeat("a", 10)
+	large := strings.Repeat("a", 3000)
+
+	tests := []struct {
+		name string
+		req  CreateSecretRequest
+		code string // Expected error code, empty when allowed
+	}{
+		{"allowed", CreateSecretRequest{Content: small, Lifetime: 1440, WebhookURL: "https://example.com"}, ""},
+		{"size cap", CreateSecretRequest{Content: large, Lifetime: 1440, PassphraseHash: "hash", WebhookURL: "https://example.com"}, "policy_lifetime"},
+		{"chunked counts as large", CreateSecretRequest{Chunked: true, Lifetime: 1440, PassphraseHash: "hash", WebhookURL: "https://example.com"}, "policy_lifetime"},
+		{"banned lifetime", CreateSecretRequest{Content: small, Lifetime: 5, WebhookURL: "https://example.com"}, "policy_lifetime_banned"},
+		{"passphrase", CreateSecretRequest{Content: large, Lifetime: 60, WebhookURL: "https://example.com"}, "policy_passphrase_required"},
+		{"webhook", CreateSecretRequest{Content: small, Lifetime: 60}, "policy_webhook_required"},
+	}
+	for _, tt := range tests {
+		code := ""
+		if reqErr := policy.Check(tt.req); reqErr != nil {
+			code = reqErr.errorCode()
+		}
+		if code != tt.code {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.code, code)
+		}
+	}
+
+	var none *Policy
+	if none.Check(tests[1].req) != nil || none.MaxLifetime(tests[1].req) != 0 {
+		t.Error("Expected no policy to allow everything")
+	}
+}
+
+func TestLoadConfig_Policy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	os.WriteFile(path, []byte(`{"max_lifetime_by_size": [{"min_size": 0, "max_lifetime": 60}], "banned_lifetimes": [5]}`), 0o600)
+	cfg, err := loadConfig(nil, envMap(map[string]string{"POLICY_FILE": path}))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.Policy == nil || len(cfg.Policy.MaxLifetimeBySize) != 1 || cfg.Policy.BannedLifetimes[0] != 5 {
+		t.Errorf("Expected the policy to be loaded, got %+v", cfg.Policy)
+	}
+
+	// A misspelt rule would silently not be enforced
+	os.WriteFile(path, []byte(`{"require_webhooks": true}`), 0o600)
+	if _, err := loadConfig(nil, envMap(map[string]string{"POLICY_FILE": path})); err == nil {
+		t.Error("Expected an unknown field to be refused")
+	}
+	os.WriteFile(path, []byte(`{"max_lifetime_by_size": [{"min_size": 100}]}`), 0o600)
+	if _, err := loadConfig(nil, envMap(map[string]string{"POLICY_FILE": path})); err == nil {
+		t.Error("Expected a size rule without a lifetime to be refused")
+	}
+}
+
+func TestCreateSecretHandler_Policy(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.Policy = &Policy{MaxLifetimeBySize: []SizeLifetimeRule{{MinSize: 100, MaxLifetime: 60}}, BannedLifetimes: []int{5}}
+	})
+	create := func(req CreateSecretRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		rec := httptest.NewRecorder()
+		srv.routes().ServeHTTP(rec, httptest.NewRequest("POST", "/api/secrets", bytes.NewReader(body)))
+		return rec
+	}
+
+	rec := create(CreateSecretRequest{Content: strings.Repeat("a", 200), Lifetime: 1440})
+	var errResp ErrorResponse
+	json.NewDecoder(rec.Body).Decode(&errResp)
+	if rec.Code != http.StatusBadRequest || errResp.Code != "policy_lifetime" {
+		t.Errorf("Expected 400 policy_lifetime, got %d %+v", rec.Code, errResp)
+	}
+
+	// The cap also holds when the sender extends the secret
+	rec = create(CreateSecretRequest{Content: strings.Repeat("a", 200), Lifetime: 60})
+	var created CreateSecretResponse
+	json.NewDecoder(rec.Body).Decode(&created)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 within the cap, got %d", rec.Code)
+	}
+	req := httptest.NewRequest("PATCH", "/api/secrets/"+created.ID, strings.NewReader(`{"expires_in": 1440}`))
+	req.Header.Set("Authorization", "Bearer "+created.ManagementToken)
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 extending past the policy's cap, got %d", rec.Code)
+	}
+
+	// Banned lifetimes aren't offered
+	rec = httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/api/config", nil))
+	var config ConfigResponse
+	json.NewDecoder(rec.Body).Decode(&config)
+	if config.Policy == nil || len(config.LifetimeOptions) == 0 || config.LifetimeOptions[0] == 5 {
+		t.Errorf("Expected the policy without the banned lifetime option, got %+v", config)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// parseTrustedProxies parses a comma-separated list of CIDR ranges or single addresses
+func parseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	prefixes, err := parsePrefixes("trusted-proxies", entries)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %w", err)
+	}
+	return prefixes, nil
+}
+
+// isTrustedProxy reports whether addr is inside one of the trusted networks
+func isTrustedProxy(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr returns the address of the client, or the zero Addr if it can't be determined.
+// Forwarding headers are only believed from trustedProxies: the chain is walked from the nearest
+// hop back, and the first address that isn't itself a trusted proxy is the client. Entries
+// further left were supplied by the client and could be spoofed, so they are ignored.
+func clientAddr(r *http.Request, trustedProxies []netip.Prefix) netip.Addr {
+	addr := peerAddr(r)
+	if !addr.IsValid() || !isTrustedProxy(addr, trustedProxies) {
+		return addr
+	}
+
+	hops := forwardedFor(r.Header)
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := parseForwardedAddr(hops[i])
+		if err != nil {
+			// Unknown or obfuscated hop, the last trusted proxy is the best answer
+			return addr
+		}
+		addr = hop
+		if !isTrustedProxy(addr, trustedProxies) {
+			return addr
+		}
+	}
+	return addr
+}
+
+// peerAddr returns the address of the connecting peer. Peers on a Unix socket count as loopback,
+// so a reverse proxy connecting through one can be trusted like one on 127.0.0.1.
+func peerAddr(r *http.Request) netip.Addr {
+	if r.Context().Value(unixConnKey{}) != nil {
+		return netip.AddrFrom4([4]byte{127, 0, 0, 1})
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap().WithZone("")
+}
+
+// forwardedFor returns the client chain from the RFC 7239 Forwarded header, or from
+// X-Forwarded-For when there is none, ordered from the original client to the nearest proxy
+func forwardedFor(h http.Header) []string {
+	var hops []string
+	if values := h.Values("Forwarded"); len(values) > 0 {
+		for _, element := range strings.Split(strings.Join(values, ","), ",") {
+			for _, pair := range strings.Split(element, ";") {
+				name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(name, "for") {
+					hops = append(hops, strings.Trim(value, `"`))
+				}
+			}
+		}
+		return hops
+	}
+
+	for _, value := range h.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(value, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// parseForwardedAddr parses a forwarding hop, which may carry a port and IPv6 brackets
+func parseForwardedAddr(hop string) (netip.Addr, error) {
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		hop = host
+	}
+	addr, err := netip.ParseAddr(strings.Trim(hop, "[]"))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addr.Unmap().WithZone(""), nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientAddr(t *testing.T) {
+	proxies, err := parseTrustedProxies("10.0.0.0/8, 2001:db8::1")
+	if err != nil {
+		t.Fatalf("Expected valid trusted proxies, got %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{"direct", "198.51.100.7:1234", nil, "198.51.100.7"},
+		{"spoofed from untrusted peer", "198.51.100.7:1234", map[string]string{"X-Forwarded-For": "203.0.113.9"}, "198.51.100.7"},
+		{"trusted proxy", "10.0.0.2:1234", map[string]string{"X-Forwarded-For": "203.0.113.9"}, "203.0.113.9"},
+		{"spoofed entry before real client", "10.0.0.2:1234", map[string]string{"X-Forwarded-For": "1.2.3.4, 203.0.113.9"}, "203.0.113.9"},
+		{"proxy chain", "10.0.0.2:1234", map[string]string{"X-Forwarded-For": "203.0.113.9, 10.0.0.5"}, "203.0.113.9"},
+		{"IPv6 proxy", "[2001:db8::1]:443", map[string]string{"X-Forwarded-For": "2001:db8::42"}, "2001:db8::42"},
+		{"no header", "10.0.0.2:1234", nil, "10.0.0.2"},
+		{"garbage hop", "10.0.0.2:1234", map[string]string{"X-Forwarded-For": "not-an-ip"}, "10.0.0.2"},
+		{"forwarded", "10.0.0.2:1234", map[string]string{"Forwarded": `for=192.0.2.60;proto=https, for="[2001:db8:cafe::17]:4711"`}, "2001:db8:cafe::17"},
+		{"forwarded preferred", "10.0.0.2:1234", map[string]string{"Forwarded": "for=192.0.2.60", "X-Forwarded-For": "203.0.113.9"}, "192.0.2.60"},
+		{"obfuscated forwarded", "10.0.0.2:1234", map[string]string{"Forwarded": "for=_hidden"}, "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		for name, value := range tt.headers {
+			req.Header.Set(name, value)
+		}
+		if got := clientAddr(req, proxies).String(); got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	if proxies, err := parseTrustedProxies(" "); err != nil || proxies != nil {
+		t.Errorf("Expected no proxies for an empty list, got %v (%v)", proxies, err)
+	}
+	if _, err := parseTrustedProxies("10.0.0.0/8,nope"); err == nil {
+		t.Error("Expected error for an invalid entry")
+	}
+}
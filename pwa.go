@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// The site is an installable web app whose manifest registers it as a share target, so text
+// shared from a mobile share sheet opens the home page pre-filled. The service worker in
+// static/sw.js receives the shared text and hands it to the page; the text is encrypted in the
+// browser like anything typed in and never reaches the server as plaintext.
+
+// pwaBackgroundColor is shown while the installed app starts
+const pwaBackgroundColor = "#1f2937"
+
+// webManifest is a Web App Manifest, see https://www.w3.org/TR/appmanifest/
+type webManifest struct {
+	Lang            string                 `json:"lang"`
+	Name            string                 `json:"name"`
+	ShortName       string                 `json:"short_name"`
+	Description     string                 `json:"description"`
+	StartURL        string                 `json:"start_url"`
+	Scope           string                 `json:"scope"`
+	Display         string                 `json:"display"`
+	BackgroundColor string                 `json:"background_color"`
+	ThemeColor      string                 `json:"theme_color"`
+	Icons           []webManifestIcon      `json:"icons"`
+	ShareTarget     webManifestShareTarget `json:"share_target"`
+}
+
+type webManifestIcon struct {
+	Src   string `json:"src"`
+	Sizes string `json:"sizes"`
+	Type  string `json:"type"`
+}
+
+// webManifestShareTarget maps shared data to form fields, see https://w3c.github.io/web-share-target/
+type webManifestShareTarget struct {
+	Action  string            `json:"action"`
+	Method  string            `json:"method"`
+	Enctype string            `json:"enctype"`
+	Params  map[string]string `json:"params"`
+}
+
+// manifestHandler serves the web app manifest with the instance's branding and base path
+func (srv *Server) manifestHandler(w http.ResponseWriter, r *http.Request) {
+	locale := requestLocale(w, r)
+	base := srv.config.BasePath
+	brand := srv.config.Branding
+	themeColor := pwaBackgroundColor
+	if brand.AccentColor != "" {
+		themeColor = brand.AccentColor
+	}
+
+	var icons []webManifestIcon
+	for _, size := range []string{"192", "512"} {
+		icons = append(icons, webManifestIcon{
+			Src:   base + "/static/images/icon-" + size + ".png",
+			Sizes: size + "x" + size,
+			Type:  "image/png",
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/manifest+json")
+	json.NewEncoder(w).Encode(webManifest{
+		Lang:            locale.Tag,
+		Name:            brand.ProductName,
+		ShortName:       brand.ProductName,
+		Description:     locale.T("common.tagline"),
+		StartURL:        base + "/",
+		Scope:           base + "/",
+		Display:         "standalone",
+		BackgroundColor: pwaBackgroundColor,
+		ThemeColor:      themeColor,
+		Icons:           icons,
+		ShareTarget: webManifestShareTarget{
+			Action:  base + "/share",
+			Method:  "POST",
+			Enctype: "multipart/form-data",
+			Params:  map[string]string{"title": "title", "text": "text", "url": "url"},
+		},
+	})
+}
+
+// serviceWorkerHandler serves the service worker from the base path, so its scope covers the
+// whole site rather than only /static/
+func (srv *Server) serviceWorkerHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Service-Worker-Allowed", srv.config.BasePath+"/")
+	srv.static.serve(w, r, "static/sw.js")
+}
+
+// shareHandler is reached only when the service worker isn't running yet, e.g. right after the
+// app was installed. The shared text is dropped unread and the browser is sent to the home
+// page, where the service worker gets registered for the next share.
+func (srv *Server) shareHandler(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, srv.config.BasePath+"/", http.StatusSeeOther)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestManifestHandler(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.BasePath = "/tools/picosend"
+		cfg.Branding.ProductName = "Acme Secrets"
+	})
+	server := httptest.NewServer(srv.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/tools/picosend/manifest.webmanifest")
+	if err != nil {
+		t.Fatalf("Failed to get manifest: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "application/manifest+json" {
+		t.Errorf("Expected manifest content type, got %q", resp.Header.Get("Content-Type"))
+	}
+
+	var manifest webManifest
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		t.Fatalf("Failed to decode manifest: %v", err)
+	}
+	if manifest.Name != "Acme Secrets" || manifest.StartURL != "/tools/picosend/" || manifest.Scope != "/tools/picosend/" {
+		t.Errorf("Expected branded manifest under the base path, got %+v", manifest)
+	}
+	if target := manifest.ShareTarget; target.Action != "/tools/picosend/share" || target.Method != "POST" || target.Params["text"] != "text" {
+		t.Errorf("Unexpected share target %+v", target)
+	}
+	for _, icon := range manifest.Icons {
+		iconResp, err := http.Get(server.URL + icon.Src)
+		if err != nil {
+			t.Fatalf("Failed to get icon: %v", err)
+		}
+		iconResp.Body.Close()
+		if iconResp.StatusCode != http.StatusOK || iconResp.Header.Get("Content-Type") != "image/png" {
+			t.Errorf("%s: expected a PNG, got %d %q", icon.Src, iconResp.StatusCode, iconResp.Header.Get("Content-Type"))
+		}
+	}
+}
+
+func TestServiceWorkerHandler(t *testing.T) {
+	srv := newTestServer(t)
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, httptest.NewRequest("GET", "/sw.js", nil))
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Header().Get("Content-Type"), "javascript") {
+		t.Errorf("Expected JavaScript, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if rec.Header().Get("Service-Worker-Allowed") != "/" {
+		t.Errorf("Expected the worker to be allowed the whole site, got %q", rec.Header().Get("Service-Worker-Allowed"))
+	}
+}
+
+func TestShareHandler_DropsContent(t *testing.T) {
+	srv := newTestServer(t)
+	body := &trackingReader{Reader: strings.NewReader("text=my+secret")}
+	req := httptest.NewRequest("POST", "/share", body)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	srv.routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/" {
+		t.Errorf("Expected redirect to the home page, got %d %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if body.read {
+		t.Error("Expected the shared content not to be read")
+	}
+}
+
+// trackingReader records whether anything was read from it
+type trackingReader struct {
+	*strings.Reader
+	read bool
+}
+
+func (r *trackingReader) Read(p []byte) (int, error) {
+	r.read = true
+	return r.Reader.Read(p)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	MaxAllowedReaders   = 20  // Accounts a secret can be bound to
+	MaxReaderSubjectLen = 255 // Longest provider subject accepted in allowed_readers
+)
+
+// ReaderFilter binds a secret to the single sign-on accounts that may retrieve it
+type ReaderFilter struct {
+	Emails   []string // Verified emails, lowercased
+	Subjects []string // Provider subject identifiers, for accounts without an email
+}
+
+// parseReaderFilter builds a filter from emails and provider subjects; entries with an @ are
+// emails. Returns nil when the list is empty.
+func parseReaderFilter(readers []string) (*ReaderFilter, error) {
+	if len(readers) == 0 {
+		return nil, nil
+	}
+	if len(readers) > MaxAllowedReaders {
+		return nil, fmt.Errorf("at most %d allowed_readers entries are supported", MaxAllowedReaders)
+	}
+
+	filter := &ReaderFilter{}
+	for _, reader := range readers {
+		reader = strings.TrimSpace(reader)
+		switch {
+		case strings.Contains(reader, "@"):
+			if err := validateEmailAddress("allowed_readers entry", reader); err != nil {
+				return nil, err
+			}
+			filter.Emails = append(filter.Emails, strings.ToLower(reader))
+		case reader == "" || len(reader) > MaxReaderSubjectLen:
+			return nil, fmt.Errorf("allowed_readers entries must be emails or subjects of at most %d characters", MaxReaderSubjectLen)
+		default:
+			filter.Subjects = append(filter.Subjects, reader)
+		}
+	}
+	return filter, nil
+}
+
+// Allows reports whether the signed-in identity may retrieve the secret. A nil filter allows
+// everyone, signed in or not.
+func (f *ReaderFilter) Allows(identity OIDCIdentity, signedIn bool) bool {
+	if f == nil {
+		return true
+	}
+	if !signedIn {
+		return false
+	}
+	return (identity.Email != "" && slices.Contains(f.Emails, identity.Email)) || slices.Contains(f.Subjects, identity.Subject)
+}
@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestParseReaderFilter(t *testing.T) {
+	if filter, err := parseReaderFilter(nil); filter != nil || err != nil {
+		t.Errorf("Expected no filter for an empty list, got %v, %v", filter, err)
+	}
+
+	filter, err := parseReaderFilter([]string{"Bob@Example.com", " 1084299 "})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(filter.Emails) != 1 || filter.Emails[0] != "bob@example.com" || len(filter.Subjects) != 1 || filter.Subjects[0] != "1084299" {
+		t.Errorf("Unexpected filter %+v", filter)
+	}
+
+	for _, invalid := range [][]string{{"bob@"}, {""}, make([]string, MaxAllowedReaders+1)} {
+		if _, err := parseReaderFilter(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestReaderFilter_Allows(t *testing.T) {
+	filter, _ := parseReaderFilter([]string{"bob@example.com", "user-7"})
+
+	tests := []struct {
+		name     string
+		identity OIDCIdentity
+		signedIn bool
+		expected bool
+	}{
+		{"matching email", OIDCIdentity{Subject: "user-1", Email: "bob@example.com"}, true, true},
+		{"matching subject", OIDCIdentity{Subject: "user-7"}, true, true},
+		{"other account", OIDCIdentity{Subject: "user-2", Email: "eve@example.com"}, true, false},
+		{"signed out", OIDCIdentity{}, false, false},
+	}
+	for _, tt := range tests {
+		if got := filter.Allows(tt.identity, tt.signedIn); got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+
+	var none *ReaderFilter
+	if !none.Allows(OIDCIdentity{}, false) {
+		t.Error("Expected a nil filter to allow anyone")
+	}
+}
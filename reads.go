@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ReadRecord summarizes one read of a secret for its sender, to confirm the right person opened
+// it. It is kept coarse on purpose: no IP address, no full User-Agent.
+type ReadRecord struct {
+	Time    time.Time
+	Country string // ISO 3166-1 code from the GeoIP database; empty when none is configured or the address is unknown
+	Browser string // Browser or client family, e.g. Firefox or curl
+	OS      string // Operating system family, e.g. Android; empty when unknown
+}
+
+// browserFamilies and osFamilies map a User-Agent substring to a family. They are checked in
+// order because browsers include each other's tokens: Edge claims to be Chrome, and Chrome
+// claims to be Safari.
+var (
+	browserFamilies = [][2]string{
+		{"Edg", "Edge"}, {"OPR/", "Opera"}, {"Opera", "Opera"}, {"SamsungBrowser", "Samsung Internet"},
+		{"Firefox/", "Firefox"}, {"FxiOS", "Firefox"}, {"CriOS", "Chrome"}, {"Chrome/", "Chrome"},
+		{"Safari/", "Safari"}, {"curl/", "curl"}, {"Wget/", "Wget"}, {"python-requests", "Python"},
+		{"Python-urllib", "Python"}, {"Go-http-client", "Go"}, {"okhttp", "OkHttp"},
+	}
+	osFamilies = [][2]string{
+		{"Windows", "Windows"}, {"iPhone", "iOS"}, {"iPad", "iOS"}, {"Macintosh", "macOS"},
+		{"Android", "Android"}, {"CrOS", "ChromeOS"}, {"Linux", "Linux"},
+	}
+)
+
+// userAgentFamily returns the browser and operating system families of a User-Agent
+func userAgentFamily(userAgent string) (browser, os string) {
+	if userAgent == "" {
+		return "", ""
+	}
+	browser = "Other"
+	for _, family := range browserFamilies {
+		if strings.Contains(userAgent, family[0]) {
+			browser = family[1]
+			break
+		}
+	}
+	for _, family := range osFamilies {
+		if strings.Contains(userAgent, family[0]) {
+			os = family[1]
+			break
+		}
+	}
+	return browser, os
+}
+
+// readRecord summarizes the client reading a secret, or returns an empty record when reader
+// details are disabled. The store fills in the time.
+func (srv *Server) readRecord(r *http.Request) ReadRecord {
+	if !srv.config.ReaderDetails {
+		return ReadRecord{}
+	}
+	browser, os := userAgentFamily(r.UserAgent())
+	return ReadRecord{
+		Country: srv.geoIP.Country(clientAddr(r, srv.config.TrustedProxies)),
+		Browser: browser,
+		OS:      os,
+	}
+}
+
+// ReadResponse is a ReadRecord as reported to the sender
+type ReadResponse struct {
+	Time    string `json:"time"`
+	Country string `json:"country,omitempty"`
+	Browser string `json:"browser,omitempty"`
+	OS      string `json:"os,omitempty"`
+}
+
+func newReadResponses(reads []ReadRecord) []ReadResponse {
+	var responses []ReadResponse
+	for _, read := range reads {
+		responses = append(responses, ReadResponse{
+			Time:    read.Time.UTC().Format("2006-01-02 15:04:05 UTC"),
+			Country: read.Country,
+			Browser: read.Browser,
+			OS:      read.OS,
+		})
+	}
+	return responses
+}
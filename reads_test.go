@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testGeoIPDB builds an IPv4 MaxMind DB placing 1.0.0.0/8 in Germany, with the country
+// record behind a pointer as real databases share them
+func testGeoIPDB() []byte {
+	str := func(s string) []byte { return append([]byte{2<<5 | byte(len(s))}, s...) }
+	uint16Field := func(v byte) []byte { return []byte{5<<5 | 1, v} }
+
+	// The tree follows the bits of 00000001: nodes 0-6 go left, node 7 goes right to the data
+	const nodeCount = 8
+	var tree []byte
+	record := func(v int) []byte { return []byte{byte(v >> 16), byte(v >> 8), byte(v)} }
+	for node := 0; node < 7; node++ {
+		tree = append(tree, record(node+1)...)
+		tree = append(tree, record(nodeCount)...)
+	}
+
+	var data []byte
+	data = append(data, 7<<5|1)
+	data = append(data, str("iso_code")...)
+	data = append(data, str("DE")...)
+	countryOffset := 0
+	recordOffset := len(data)
+	data = append(data, 7<<5|1)
+	data = append(data, str("country")...)
+	data = append(data, 1<<5, byte(countryOffset)) // Pointer to the country map
+	tree = append(tree, record(nodeCount)...)
+	tree = append(tree, record(nodeCount+16+recordOffset)...)
+
+	db := append(tree, make([]byte, 16)...)
+	db = append(db, data...)
+	db = append(db, mmdbMetadataMarker...)
+	db = append(db, 7<<5|3)
+	db = append(db, str("node_count")...)
+	db = append(db, 6<<5|1, nodeCount)
+	db = append(db, str("record_size")...)
+	db = append(db, uint16Field(24)...)
+	db = append(db, str("ip_version")...)
+	db = append(db, uint16Field(4)...)
+	return db
+}
+
+func TestGeoIPDB_Country(t *testing.T) {
+	db, err := newGeoIPDB(testGeoIPDB())
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	for addr, want := range map[string]string{
+		"1.2.3.4":          "DE",
+		"::ffff:1.255.0.1": "DE",
+		"2.0.0.1":          "",
+		"2001:db8::1":      "",
+	} {
+		if got := db.Country(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("%s: expected %q, got %q", addr, want, got)
+		}
+	}
+
+	if _, err := newGeoIPDB([]byte("not a database")); err == nil {
+		t.Error("Expected a file without metadata to be rejected")
+	}
+	truncated := testGeoIPDB()
+	if _, err := newGeoIPDB(truncated[40:]); err == nil {
+		t.Error("Expected a truncated database to be rejected")
+	}
+}
+
+func TestUserAgentFamily(t *testing.T) {
+	for ua, want := range map[string][2]string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0":           {"Edge", "Windows"},
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1": {"Safari", "iOS"},
+		"Mozilla/5.0 (Android 14; Mobile; rv:121.0) Gecko/121.0 Firefox/121.0":                                                                    {"Firefox", "Android"},
+		"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36":                                   {"Chrome", "Linux"},
+		"curl/8.4.0":  {"curl", ""},
+		"SomeBot/1.0": {"Other", ""},
+		"":            {"", ""},
+	} {
+		if browser, os := userAgentFamily(ua); browser != want[0] || os != want[1] {
+			t.Errorf("%q: expected %v, got %s/%s", ua, want, browser, os)
+		}
+	}
+}
+
+func TestSecretStatusHandler_ReaderDetails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "GeoLite2-Country.mmdb")
+	if err := os.WriteFile(path, testGeoIPDB(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	srv := newTestServer(t, func(cfg *Config) { cfg.GeoIPDB = path })
+	router := srv.routes()
+
+	var events []SecretEvent
+	srv.store.Subscribe(func(event SecretEvent) { events = append(events, event) })
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/secrets", strings.NewReader(`{"content": "encrypted"}`)))
+	var created CreateSecretResponse
+	json.NewDecoder(rec.Body).Decode(&created)
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/secrets/"+created.ID, nil))
+	var meta SecretMetadataResponse
+	json.NewDecoder(rec.Body).Decode(&meta)
+
+	body, _ := json.Marshal(ClaimSecretRequest{ClaimToken: meta.ClaimToken})
+	req := httptest.NewRequest("POST", "/api/secrets/"+created.ID+"/claim", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Android 14; Mobile; rv:121.0) Gecko/121.0 Firefox/121.0")
+	req.RemoteAddr = "1.2.3.4:5678"
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected the claim to succeed, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	status := func(token string) SecretStatusResponse {
+		req := httptest.NewRequest("GET", "/api/secrets/"+created.ID+"/status", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		var response SecretStatusResponse
+		json.NewDecoder(rec.Body).Decode(&response)
+		return response
+	}
+	if reads := status("").Reads; reads != nil {
+		t.Errorf("Expected no reader details without the management token, got %+v", reads)
+	}
+	reads := status(created.ManagementToken).Reads
+	if len(reads) != 1 || reads[0].Country != "DE" || reads[0].Browser != "Firefox" || reads[0].OS != "Android" || reads[0].Time == "" {
+		t.Errorf("Expected one read from Firefox on Android in DE, got %+v", reads)
+	}
+
+	if len(events) != 1 || events[0].Reader == nil || events[0].Reader.Country != "DE" {
+		t.Errorf("Expected the read event to carry the reader, got %+v", events)
+	}
+}
+
+func TestLoadConfig_GeoIPDB(t *testing.T) {
+	cfg, err := loadConfig([]string{"--geoip-db", "/nonexistent.mmdb"}, envMap(nil))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := NewServer(cfg, nil); err == nil {
+		t.Error("Expected a missing database to fail at startup")
+	}
+	if !cfg.ReaderDetails {
+		t.Error("Expected reader details to be on by default")
+	}
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// age encodes X25519 keys as bech32 with these human-readable parts
+const (
+	ageRecipientHRP = "age"
+	ageIdentityHRP  = "age-secret-key-"
+)
+
+var (
+	ErrRecipientNotFound       = errors.New("recipient not found")
+	ErrRecipientExists         = errors.New("recipient already registered")
+	ErrInvalidRecipientToken   = errors.New("invalid recipient management token")
+	ErrInvalidRecipientKey     = errors.New("public key must be an age recipient (age1...) or a base64 X25519 key")
+	ErrWrongRecipientIdentity  = errors.New("secret is encrypted to a different key")
+	ErrInvalidRecipientContent = errors.New("unable to decrypt secret: wrong identity or corrupted data")
+)
+
+// Recipient names are lowercase handles or email addresses
+var recipientNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._@+-]{0,63}$`)
+
+// Recipient is a registered X25519 public key that senders can encrypt secrets to. Only a
+// hash of the management token is kept.
+type Recipient struct {
+	Name        string
+	PublicKey   [32]byte
+	Fingerprint string
+	CreatedAt   time.Time
+
+	tokenHash [sha256.Size]byte
+}
+
+// RecipientInfo is the public view of a recipient returned by the directory
+type RecipientInfo struct {
+	Name        string `json:"name"`
+	PublicKey   string `json:"public_key"`  // age recipient encoding
+	Fingerprint string `json:"fingerprint"` // SHA256:<base64> of the raw key, stored on secrets encrypted to it
+	CreatedAt   string `json:"created_at"`
+}
+
+// RecipientDirectory maps recipient names to their public keys, in memory
+type RecipientDirectory struct {
+	mu     sync.RWMutex
+	byName map[string]*Recipient
+}
+
+func NewRecipientDirectory() *RecipientDirectory {
+	return &RecipientDirectory{byName: make(map[string]*Recipient)}
+}
+
+// Register adds a recipient and returns it along with a management token for removing it,
+// which is not stored and can't be recovered. Names are first come, first served.
+func (d *RecipientDirectory) Register(name string, publicKey [32]byte) (RecipientInfo, string, error) {
+	token := generateToken()
+	recipient := &Recipient{
+		Name:        name,
+		PublicKey:   publicKey,
+		Fingerprint: keyFingerprint(publicKey),
+		CreatedAt:   time.Now(),
+		tokenHash:   sha256.Sum256([]byte(token)),
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, taken := d.byName[name]; taken {
+		return RecipientInfo{}, "", ErrRecipientExists
+	}
+	d.byName[name] = recipient
+	return recipient.info(), token, nil
+}
+
+// Lookup returns the recipient registered under name
+func (d *RecipientDirectory) Lookup(name string) (*Recipient, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	recipient, ok := d.byName[name]
+	return recipient, ok
+}
+
+// Remove deletes a recipient, provided the management token matches
+func (d *RecipientDirectory) Remove(name, token string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	recipient, ok := d.byName[name]
+	if !ok {
+		return ErrRecipientNotFound
+	}
+	if sha256.Sum256([]byte(token)) != recipient.tokenHash {
+		return ErrInvalidRecipientToken
+	}
+	delete(d.byName, name)
+	return nil
+}
+
+func (r *Recipient) info() RecipientInfo {
+	return RecipientInfo{
+		Name:        r.Name,
+		PublicKey:   encodeAgeRecipient(r.PublicKey),
+		Fingerprint: r.Fingerprint,
+		CreatedAt:   r.CreatedAt.UTC().Format("2006-01-02 15:04:05 UTC"),
+	}
+}
+
+// keyFingerprint identifies a public key without repeating it
+func keyFingerprint(publicKey [32]byte) string {
+	sum := sha256.Sum256(publicKey[:])
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// parseRecipientKey accepts an age X25519 recipient (age1...) or a base64 raw X25519 public key
+func parseRecipientKey(value string) ([32]byte, error) {
+	var key [32]byte
+	value = strings.TrimSpace(value)
+
+	var raw []byte
+	if strings.HasPrefix(strings.ToLower(value), ageRecipientHRP+"1") {
+		hrp, data, err := bech32Decode(value)
+		if err != nil || hrp != ageRecipientHRP {
+			return key, ErrInvalidRecipientKey
+		}
+		raw = data
+	} else {
+		var err error
+		if raw, err = base64.StdEncoding.DecodeString(value); err != nil {
+			return key, ErrInvalidRecipientKey
+		}
+	}
+
+	if _, err := ecdh.X25519().NewPublicKey(raw); err != nil {
+		return key, ErrInvalidRecipientKey
+	}
+	copy(key[:], raw)
+	return key, nil
+}
+
+// parseIdentity reads an age identity file (AGE-SECRET-KEY-1..., comments allowed) or a base64
+// raw X25519 private key
+func parseIdentity(data []byte) (*ecdh.PrivateKey, error) {
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var raw []byte
+		if strings.HasPrefix(line, "AGE-SECRET-KEY-1") {
+			hrp, decoded, err := bech32Decode(line)
+			if err != nil || hrp != ageIdentityHRP {
+				return nil, errors.New("invalid age identity")
+			}
+			raw = decoded
+		} else {
+			decoded, err := base64.StdEncoding.DecodeString(line)
+			if err != nil {
+				return nil, errors.New("identity must be an age identity or a base64 X25519 private key")
+			}
+			raw = decoded
+		}
+		return ecdh.X25519().NewPrivateKey(raw)
+	}
+	return nil, errors.New("identity file contains no key")
+}
+
+// encodeAgeRecipient formats a public key the way age does
+func encodeAgeRecipient(publicKey [32]byte) string {
+	return bech32Encode(ageRecipientHRP, publicKey[:])
+}
+
+// encodeAgeIdentity formats a private key the way age does
+func encodeAgeIdentity(privateKey *ecdh.PrivateKey) string {
+	return strings.ToUpper(bech32Encode(ageIdentityHRP, privateKey.Bytes()))
+}
+
+// sealToRecipient encrypts plaintext to an X25519 public key as a NaCl sealed box, base64
+// encoded. Only the holder of the matching private key can open it.
+func sealToRecipient(plaintext []byte, publicKey [32]byte) (string, error) {
+	sealed, err := box.SealAnonymous(nil, plaintext, &publicKey, rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openWithIdentity reverses sealToRecipient
+func openWithIdentity(content string, identity *ecdh.PrivateKey) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return nil, err
+	}
+	var publicKey, privateKey [32]byte
+	copy(publicKey[:], identity.PublicKey().Bytes())
+	copy(privateKey[:], identity.Bytes())
+	defer wipeBytes(privateKey[:])
+
+	plaintext, ok := box.OpenAnonymous(nil, sealed, &publicKey, &privateKey)
+	if !ok {
+		return nil, ErrInvalidRecipientContent
+	}
+	return plaintext, nil
+}
+
+// bech32 as specified by BIP 173, which age uses for keys. age keys exceed the 90 character
+// limit of the specification, so it isn't enforced.
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	out := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]>>5)
+	}
+	out = append(out, 0)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]&31)
+	}
+	return out
+}
+
+// convertBits regroups data from groups of from bits to groups of to bits
+func convertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	var acc uint32
+	var bits uint
+	var out []byte
+	maxv := uint32(1)<<to - 1
+	for _, b := range data {
+		if uint32(b)>>from != 0 {
+			return nil, errors.New("invalid data range")
+		}
+		acc = acc<<from | uint32(b)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(to-bits)&maxv))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxv != 0 {
+		return nil, errors.New("invalid padding")
+	}
+	return out, nil
+}
+
+func bech32Encode(hrp string, data []byte) string {
+	values, _ := convertBits(data, 8, 5, true)
+	polymod := bech32Polymod(append(append(bech32HRPExpand(hrp), values...), 0, 0, 0, 0, 0, 0)) ^ 1
+
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, v := range values {
+		sb.WriteByte(bech32Charset[v])
+	}
+	for i := 0; i < 6; i++ {
+		sb.WriteByte(bech32Charset[(polymod>>uint(5*(5-i)))&31])
+	}
+	return sb.String()
+}
+
+func bech32Decode(s string) (string, []byte, error) {
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, errors.New("mixed case")
+	}
+	s = strings.ToLower(s)
+	pos := strings.LastIndexByte(s, '1')
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, errors.New("invalid separator position")
+	}
+
+	hrp := s[:pos]
+	values := make([]byte, 0, len(s)-pos-1)
+	for i := pos + 1; i < len(s); i++ {
+		v := strings.IndexByte(bech32Charset, s[i])
+		if v < 0 {
+			return "", nil, fmt.Errorf("invalid character %q", s[i])
+		}
+		values = append(values, byte(v))
+	}
+	if bech32Polymod(append(bech32HRPExpand(hrp), values...)) != 1 {
+		return "", nil, errors.New("invalid checksum")
+	}
+
+	data, err := convertBits(values[:len(values)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+	return hrp, data, nil
+}
+
+type RegisterRecipientRequest struct {
+	Name      string `json:"name"`
+	PublicKey string `json:"public_key"` // age1... or base64 X25519 public key
+}
+
+type RegisterRecipientResponse struct {
+	RecipientInfo
+	ManagementToken string `json:"management_token"` // Removes the entry; shown only once
+}
+
+// registerRecipientHandler adds a public key to the directory. Needs an API key when the
+// server requires them for creating secrets.
+func (srv *Server) registerRecipientHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := srv.requestAPIKey(w, r); !ok {
+		return
+	}
+
+	var req RegisterRecipientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "error.invalid_json")
+		return
+	}
+
+	name := strings.ToLower(strings.TrimSpace(req.Name))
+	if !recipientNamePattern.MatchString(name) {
+		localizedError(w, r, http.StatusBadRequest, "error.recipient_name_invalid")
+		return
+	}
+	publicKey, err := parseRecipientKey(req.PublicKey)
+	if err != nil {
+		localizedError(w, r, http.StatusBadRequest, "error.recipient_key_invalid")
+		return
+	}
+
+	info, token, err := srv.recipients.Register(name, publicKey)
+	if err != nil {
+		localizedError(w, r, http.StatusConflict, "error.recipient_exists")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(RegisterRecipientResponse{RecipientInfo: info, ManagementToken: token})
+}
+
+// getRecipientHandler looks up a recipient's public key in the directory
+func (srv *Server) getRecipientHandler(w http.ResponseWriter, r *http.Request) {
+	recipient, found := srv.recipients.Lookup(strings.ToLower(mux.Vars(r)["name"]))
+	if !found {
+		localizedError(w, r, http.StatusNotFound, "error.recipient_not_found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recipient.info())
+}
+
+// deleteRecipientHandler removes a recipient using the management token returned at registration
+func (srv *Server) deleteRecipientHandler(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		localizedError(w, r, http.StatusUnauthorized, "error.management_token_required")
+		return
+	}
+
+	switch err := srv.recipients.Remove(strings.ToLower(mux.Vars(r)["name"]), token); {
+	case errors.Is(err, ErrRecipientNotFound):
+		localizedError(w, r, http.StatusNotFound, "error.recipient_not_found")
+	case errors.Is(err, ErrInvalidRecipientToken):
+		localizedError(w, r, http.StatusForbidden, "error.invalid_management_token")
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
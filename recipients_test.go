@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecipientKeyEncoding(t *testing.T) {
+	identity, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	publicKey := [32]byte(identity.PublicKey().Bytes())
+
+	encoded := encodeAgeRecipient(publicKey)
+	if !strings.HasPrefix(encoded, "age1") {
+		t.Fatalf("Expected an age recipient, got %q", encoded)
+	}
+	for _, value := range []string{encoded, base64.StdEncoding.EncodeToString(publicKey[:])} {
+		parsed, err := parseRecipientKey(value)
+		if err != nil || parsed != publicKey {
+			t.Errorf("Expected %q to parse to the public key, got %v", value, err)
+		}
+	}
+
+	corrupted := encoded[:len(encoded)-1] + "q"
+	if corrupted == encoded {
+		corrupted = encoded[:len(encoded)-1] + "p"
+	}
+	for _, value := range []string{"", "age1", corrupted, base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := parseRecipientKey(value); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+
+	file := "# public key: " + encoded + "\n" + encodeAgeIdentity(identity) + "\n"
+	parsed, err := parseIdentity([]byte(file))
+	if err != nil || !parsed.Equal(identity) {
+		t.Fatalf("Expected identity file to parse, got %v", err)
+	}
+}
+
+func TestSealToRecipient(t *testing.T) {
+	identity, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	other, _ := ecdh.X25519().GenerateKey(rand.Reader)
+
+	content, err := sealToRecipient([]byte("for your eyes only"), [32]byte(identity.PublicKey().Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to seal: %v", err)
+	}
+	plaintext, err := openWithIdentity(content, identity)
+	if err != nil || string(plaintext) != "for your eyes only" {
+		t.Errorf("Expected sealed content to open, got %q, %v", plaintext, err)
+	}
+	if _, err := openWithIdentity(content, other); err == nil {
+		t.Error("Expected another identity to fail")
+	}
+}
+
+func TestRecipientDirectoryHandlers(t *testing.T) {
+	_, server := setupTestServer(t)
+	defer server.Close()
+
+	identity, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	publicKey := encodeAgeRecipient([32]byte(identity.PublicKey().Bytes()))
+
+	register := func(name, key string) *http.Response {
+		body, _ := json.Marshal(RegisterRecipientRequest{Name: name, PublicKey: key})
+		resp, err := http.Post(server.URL+"/api/recipients", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Failed to register: %v", err)
+		}
+		return resp
+	}
+
+	resp := register("Alice@example.com", publicKey)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	var registered RegisterRecipientResponse
+	json.NewDecoder(resp.Body).Decode(&registered)
+	resp.Body.Close()
+	if registered.Name != "alice@example.com" || registered.ManagementToken == "" || !strings.HasPrefix(registered.Fingerprint, "SHA256:") {
+		t.Errorf("Unexpected registration %+v", registered)
+	}
+
+	for _, tc := range []struct{ name, key string }{
+		{"alice@example.com", publicKey},
+		{"bob", "not a key"},
+		{"", publicKey},
+		{"bob/../admin", publicKey},
+	} {
+		resp := register(tc.name, tc.key)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusConflict && resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected %q to be rejected, got %d", tc.name, resp.StatusCode)
+		}
+	}
+
+	resp, _ = http.Get(server.URL + "/api/recipients/alice@example.com")
+	var info RecipientInfo
+	json.NewDecoder(resp.Body).Decode(&info)
+	resp.Body.Close()
+	if info.Name != "alice@example.com" || info.PublicKey != publicKey || info.Fingerprint != registered.Fingerprint {
+		t.Errorf("Expected directory entry for the registered key, got %+v", info)
+	}
+
+	remove := func(token string) int {
+		req, _ := http.NewRequest("DELETE", server.URL+"/api/recipients/alice@example.com", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to delete: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := remove("wrong"); code != http.StatusForbidden {
+		t.Errorf("Expected status 403 for a wrong token, got %d", code)
+	}
+	if code := remove(registered.ManagementToken); code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", code)
+	}
+	resp, _ = http.Get(server.URL + "/api/recipients/alice@example.com")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404 after removal, got %d", resp.StatusCode)
+	}
+}
+
+func TestCLI_SendToRecipient(t *testing.T) {
+	srv, server := setupTestServer(t)
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	if code := runCLI([]string{"keygen"}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected keygen to succeed, got exit code %d: %s", code, stderr.String())
+	}
+	identityFile := filepath.Join(t.TempDir(), "key.txt")
+	os.WriteFile(identityFile, stdout.Bytes(), 0o600)
+	publicKey := strings.TrimSpace(strings.TrimPrefix(stderr.String(), "Public key: "))
+
+	if code := runCLI([]string{"register", "--server", server.URL, "--name", "alice", "--public-key", publicKey}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected register to succeed, got exit code %d: %s", code, stderr.String())
+	}
+
+	stdout.Reset()
+	if code := runCLI([]string{"send", "--server", server.URL, "--to", "alice"}, strings.NewReader("sealed secret"), &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected send to succeed, got exit code %d: %s", code, stderr.String())
+	}
+	shareURL := strings.TrimSpace(stdout.String())
+	if strings.Contains(shareURL, "#") {
+		t.Errorf("Expected no key in the link, got %q", shareURL)
+	}
+
+	// Without the identity, or with another one, reading fails before a read is used
+	otherFile := filepath.Join(t.TempDir(), "other.txt")
+	other, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	os.WriteFile(otherFile, []byte(encodeAgeIdentity(other)), 0o600)
+	for _, args := range [][]string{{"read", shareURL}, {"read", "--identity", otherFile, shareURL}} {
+		if code := runCLI(args, nil, &stdout, &stderr); code == 0 {
+			t.Errorf("Expected %v to fail", args)
+		}
+	}
+	if srv.store.Count() != 1 {
+		t.Fatal("Expected failed reads not to consume the secret")
+	}
+
+	stdout.Reset()
+	if code := runCLI([]string{"read", "--identity", identityFile, shareURL}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected read to succeed, got exit code %d: %s", code, stderr.String())
+	}
+	if stdout.String() != "sealed secret" {
+		t.Errorf("Expected 'sealed secret', got %q", stdout.String())
+	}
+
+	// Unknown recipients are rejected
+	if code := runCLI([]string{"send", "--server", server.URL, "--to", "mallory"}, strings.NewReader("x"), &stdout, &stderr); code == 0 {
+		t.Error("Expected send to an unknown recipient to fail")
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// AdminRekeyRequest names the new master key: a base64 key like ENCRYPTION_KEY, or a key
+// URI like KMS_KEY, which uses the server's KMS and Vault credentials
+type AdminRekeyRequest struct {
+	EncryptionKey string `json:"encryption_key,omitempty"`
+	KMSKey        string `json:"kms_key,omitempty"`
+}
+
+type AdminRekeyResponse struct {
+	Rewrapped int `json:"rewrapped"`
+}
+
+// Rekey moves encryption at rest to wrapper's master key without taking secrets offline.
+// Secrets stored from now on are sealed under the new key right away, and the data keys of
+// stored secrets are wrapped under it one at a time, outside the shard locks since the
+// wrapper may be remote. Content is not re-encrypted, offloaded content stays where it is.
+// The old master key opens whatever isn't rewrapped yet; if some keys fail, it is kept and
+// Rekey can be run again with the same key. Returns the number of keys rewrapped.
+func (s *SecretStore) Rekey(wrapper KeyWrapper) (int, error) {
+	s.rekeyMu.Lock()
+	defer s.rekeyMu.Unlock()
+	current := s.getEncryptor()
+	if current == nil {
+		return 0, ErrEncryptionDisabled
+	}
+	rotating := current.Rotate(wrapper)
+	// Wait for secrets sealed under the old key to be stored, so the walk below sees them
+	s.sealing.Lock()
+	s.SetEncryptor(rotating)
+	s.sealing.Unlock()
+
+	type wrappedKey struct {
+		id  string
+		key []byte
+	}
+	var pending []wrappedKey
+	for _, sh := range s.shards {
+		sh.mu.Lock()
+		for _, secret := range sh.secrets {
+			if secret.WrappedKey != nil {
+				pending = append(pending, wrappedKey{secret.ID, append([]byte(nil), secret.WrappedKey...)})
+			}
+		}
+		sh.mu.Unlock()
+	}
+
+	rewrapped, failed := 0, 0
+	for _, item := range pending {
+		key, err := rotating.Rewrap(item.key)
+		if err != nil {
+			failed++
+			continue
+		}
+		if key == nil {
+			continue
+		}
+		sh := s.shardFor(item.id)
+		sh.mu.Lock()
+		// The secret may have been read or removed meanwhile
+		if secret, ok := sh.secrets[keyOf(item.id)]; ok && bytes.Equal(secret.WrappedKey, item.key) {
+			secret.WrappedKey = key
+			rewrapped++
+		}
+		sh.mu.Unlock()
+	}
+	if failed > 0 {
+		return rewrapped, fmt.Errorf("%d data keys could not be rewrapped, the old master key is kept to open them", failed)
+	}
+
+	// Wait for reads that copied a key wrapped under the old master key before retiring it
+	s.sealing.Lock()
+	s.SetEncryptor(NewEnvelopeEncryptor(wrapper))
+	s.sealing.Unlock()
+	return rewrapped, nil
+}
+
+// rekeyWrapper builds the key wrapper a rekey request names
+func (srv *Server) rekeyWrapper(req AdminRekeyRequest) (KeyWrapper, error) {
+	switch {
+	case (req.EncryptionKey == "") == (req.KMSKey == ""):
+		return nil, errors.New("set one of encryption_key and kms_key")
+	case req.EncryptionKey != "":
+		key, err := loadMasterKey(req.EncryptionKey, "")
+		if err != nil {
+			return nil, err
+		}
+		defer wipeBytes(key)
+		return NewLocalKeyWrapper(key)
+	default:
+		kms := srv.config.KMS
+		kms.Key = req.KMSKey
+		return NewKMSKeyWrapper(kms, srv.config.Vault)
+	}
+}
+
+// adminRekeyHandler rotates the master key of encryption at rest while the server keeps
+// serving. The new key only lives in memory: set it in the configuration before restarting.
+func (srv *Server) adminRekeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req AdminRekeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, r, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	wrapper, err := srv.rekeyWrapper(req)
+	if err != nil {
+		apiError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	// A key that can't wrap would leave new secrets unreadable
+	if err := kmsCheck(wrapper)(r.Context()); err != nil {
+		apiError(w, r, http.StatusBadRequest, fmt.Sprintf("The new key can't be used: %v", err))
+		return
+	}
+
+	rewrapped, err := srv.store.Rekey(wrapper)
+	if errors.Is(err, ErrEncryptionDisabled) {
+		apiError(w, r, http.StatusConflict, "Encryption at rest is not enabled")
+		return
+	}
+	// New secrets are sealed under the new key even when some old ones failed
+	if req.KMSKey != "" {
+		srv.RegisterReadinessCheck("kms", kmsCheck(wrapper))
+	} else {
+		srv.unregisterReadinessCheck("kms")
+	}
+	if err != nil {
+		srv.logger.Error("Rekey incomplete", "rewrapped", rewrapped, "error", err)
+		apiError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	scheme, _, _ := strings.Cut(req.KMSKey, "://")
+	srv.logger.Info("Encryption at rest rekeyed", "rewrapped", rewrapped, "kms", scheme)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AdminRekeyResponse{Rewrapped: rewrapped})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNewMasterKey = bytes.Repeat([]byte{9}, DataKeyLength)
+
+// failingWrapper can't unwrap anything, like a KMS that's down
+type failingWrapper struct{ KeyWrapper }
+
+func (failingWrapper) UnwrapKey([]byte) ([]byte, error) { return nil, errors.New("unavailable") }
+
+func TestSecretStore_Rekey(t *testing.T) {
+	store := NewSecretStore()
+	store.SetEncryptor(newTestEncryptor(t))
+	id, _ := store.StoreWithOptions("client ciphertext", time.Hour, SecretOptions{MaxReads: 2})
+
+	wrapper, _ := NewLocalKeyWrapper(testNewMasterKey)
+	rewrapped, err := store.Rekey(wrapper)
+	if err != nil || rewrapped != 1 {
+		t.Fatalf("Expected one key rewrapped, got %d %v", rewrapped, err)
+	}
+	if store.getEncryptor().previous != nil {
+		t.Error("Expected the old master key to be retired")
+	}
+
+	// Only the new master key opens the secret now
+	raw := store.shardFor(id).secrets[keyOf(id)]
+	if _, err := newTestEncryptor(t).Open(id, raw.Content, raw.WrappedKey); err == nil {
+		t.Error("Expected the old master key not to open the secret")
+	}
+	if secret, _ := store.Get(id); secret == nil || string(secret.Content) != "client ciphertext" {
+		t.Error("Expected the secret to stay readable")
+	}
+
+	// Running it again has nothing to do
+	if rewrapped, err := store.Rekey(wrapper); err != nil || rewrapped != 0 {
+		t.Errorf("Expected nothing to rewrap, got %d %v", rewrapped, err)
+	}
+
+	if _, err := NewSecretStore().Rekey(wrapper); err != ErrEncryptionDisabled {
+		t.Errorf("Expected rekey without encryption at rest to fail, got %v", err)
+	}
+}
+
+func TestSecretStore_RekeyKeepsOldKeyOnFailure(t *testing.T) {
+	store := NewSecretStore()
+	old := newTestEncryptor(t)
+	store.SetEncryptor(&EnvelopeEncryptor{wrapper: failingWrapper{old.wrapper}})
+	id, _ := store.Store("client ciphertext", time.Hour)
+
+	wrapper, _ := NewLocalKeyWrapper(testNewMasterKey)
+	if _, err := store.Rekey(wrapper); err == nil {
+		t.Fatal("Expected keys that can't be unwrapped to fail the rekey")
+	}
+	if len(store.getEncryptor().previous) != 1 {
+		t.Error("Expected the old master key to be kept")
+	}
+	if _, err := store.Store("new ciphertext", time.Hour); err != nil {
+		t.Errorf("Expected new secrets to be sealed under the new key, got %v", err)
+	}
+	if _, found := store.Peek(id); !found {
+		t.Error("Expected the secret to be kept")
+	}
+}
+
+func TestAdminRekey(t *testing.T) {
+	srv, server := setupAdminTestServer(t, func(cfg *Config) { cfg.EncryptionKey = bytes.Repeat([]byte{42}, DataKeyLength) })
+	defer server.Close()
+	id, _ := srv.store.Store("client ciphertext", time.Hour)
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(testNewMasterKey)), 0o600)
+	var stdout, stderr bytes.Buffer
+	if code := runCLI([]string{"rekey", "--server", server.URL, "--admin-key", testAdminKey, "--encryption-key-file", keyFile}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected rekey to succeed, got exit code %d: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Rewrapped 1 data keys") {
+		t.Errorf("Unexpected rekey output %q", stdout.String())
+	}
+	if secret, _ := srv.store.Get(id); secret == nil || string(secret.Content) != "client ciphertext" {
+		t.Error("Expected the secret to stay readable")
+	}
+
+	for _, body := range []string{`{}`, `{"encryption_key": "short"}`, `{"encryption_key": "a", "kms_key": "b"}`} {
+		resp := adminRequest(t, server, "POST", "/admin/api/rekey", testAdminKey, []byte(body))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected 400 for %s, got %d", body, resp.StatusCode)
+		}
+	}
+}
+
+func TestAdminRekey_EncryptionDisabled(t *testing.T) {
+	_, server := setupAdminTestServer(t)
+	defer server.Close()
+
+	body, _ := json.Marshal(AdminRekeyRequest{EncryptionKey: base64.StdEncoding.EncodeToString(testNewMasterKey)})
+	resp := adminRequest(t, server, "POST", "/admin/api/rekey", testAdminKey, body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected 409 without encryption at rest, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ConfigWatchInterval is how often the config file is checked for changes, so an updated
+// Kubernetes ConfigMap applies without sending SIGHUP
+const ConfigWatchInterval = 10 * time.Second
+
+// Reload applies the settings of cfg that can change at runtime: store limits, the maximum
+// upload size and the policy. The TLS certificate and client CA bundle are read again from their files.
+// Secrets and open connections are kept. Other settings need a restart.
+func (srv *Server) Reload(cfg *Config) {
+	srv.store.SetLimits(cfg.Limits)
+	srv.store.SetEvictionPolicy(cfg.EvictionPolicy)
+	srv.uploads.SetMaxSize(cfg.MaxUploadSize)
+	srv.policy.Store(cfg.Policy)
+	if srv.tlsFiles != nil {
+		if err := srv.tlsFiles.Reload(); err != nil {
+			srv.logger.Error("Failed to reload TLS certificate, keeping current one", "error", err)
+		}
+	}
+}
+
+// reloadConfig loads the configuration again and applies it to srv and the log level.
+// An invalid configuration is logged and the current settings are kept.
+func reloadConfig(srv *Server, logLevel *slog.LevelVar, load func() (*Config, error)) bool {
+	cfg, err := load()
+	if err != nil {
+		slog.Error("Failed to reload configuration, keeping current settings", "error", err)
+		return false
+	}
+
+	logLevel.Set(cfg.LogLevel)
+	srv.Reload(cfg)
+	slog.Info("Configuration reloaded",
+		"log_level", cfg.LogLevel,
+		"max_unread_secrets", cfg.Limits.MaxUnreadSecrets,
+		"max_store_bytes", cfg.Limits.MaxStoreBytes,
+		"max_secret_length", cfg.Limits.MaxSecretLength,
+		"max_upload_size", cfg.MaxUploadSize,
+	)
+	return true
+}
+
+// watchConfig calls reload on SIGHUP and, when path is set, whenever the file's content
+// changes. It returns when ctx is done.
+func watchConfig(ctx context.Context, path string, interval time.Duration, reload func()) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	var poll <-chan time.Time
+	var content []byte
+	if path != "" {
+		content, _ = os.ReadFile(path)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-hangup:
+			reload()
+		case <-poll:
+			// Compare content rather than modification times, ConfigMap updates swap symlinks
+			current, err := os.ReadFile(path)
+			if err != nil || bytes.Equal(current, content) {
+				continue
+			}
+			content = current
+			reload()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
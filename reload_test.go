@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReloadConfig(t *testing.T) {
+	srv := newTestServer(t)
+	id, _ := srv.store.Store("encrypted", time.Hour)
+
+	logLevel := new(slog.LevelVar)
+	cfg := DefaultConfig()
+	cfg.LogLevel = slog.LevelDebug
+	cfg.Limits.MaxUnreadSecrets = 10
+	cfg.MaxUploadSize = 1024
+
+	if !reloadConfig(srv, logLevel, func() (*Config, error) { return cfg, nil }) {
+		t.Fatal("Expected reload to succeed")
+	}
+	if logLevel.Level() != slog.LevelDebug {
+		t.Errorf("Expected debug log level, got %v", logLevel.Level())
+	}
+	if srv.store.Limits().MaxUnreadSecrets != 10 || srv.uploads.MaxSize() != 1024 {
+		t.Errorf("Expected new limits, got %+v and upload size %d", srv.store.Limits(), srv.uploads.MaxSize())
+	}
+	if _, found := srv.store.Peek(id); !found {
+		t.Error("Expected secrets to survive a reload")
+	}
+
+	// A broken configuration keeps the current settings
+	if reloadConfig(srv, logLevel, func() (*Config, error) { return nil, errors.New("invalid") }) {
+		t.Error("Expected reload to fail")
+	}
+	if logLevel.Level() != slog.LevelDebug || srv.store.Limits().MaxUnreadSecrets != 10 {
+		t.Error("Expected settings to be unchanged after a failed reload")
+	}
+}
+
+func TestWatchConfig_FileChange(t *testing.T) {
+	path := writeConfigFile(t, "MAX_SECRET_LENGTH=10\n")
+
+	reloads := make(chan struct{}, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go watchConfig(ctx, path, 10*time.Millisecond, func() { reloads <- struct{}{} })
+
+	select {
+	case <-reloads:
+		t.Fatal("Expected no reload while the file is unchanged")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(path, []byte("MAX_SECRET_LENGTH=20\n"), 0o600); err != nil {
+		t.Fatalf("Failed to update config file: %v", err)
+	}
+	select {
+	case <-reloads:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a reload after the file changed")
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const DefaultS3Prefix = "picosend/"
+
+// S3Config configures an S3-compatible bucket used to hold large encrypted payloads
+type S3Config struct {
+	Endpoint        string // e.g. https://s3.eu-west-1.amazonaws.com or http://minio:9000; derived from Region when empty
+	Region          string
+	Bucket          string
+	Prefix          string // Key prefix for stored objects, also the target of the bucket's lifecycle rule
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // Optional, for temporary credentials
+	PathStyle       bool   // Address the bucket as endpoint/bucket instead of bucket.endpoint, as MinIO needs
+	Threshold       int    // Content at least this many bytes is stored in the bucket
+}
+
+// Enabled reports whether an S3 bucket is configured
+func (c S3Config) Enabled() bool {
+	return c.Bucket != ""
+}
+
+// S3BlobStore stores blobs as objects in an S3-compatible bucket using plain signature V4 requests
+type S3BlobStore struct {
+	config S3Config
+	base   *url.URL
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewS3BlobStore creates a blob store for the configured bucket
+func NewS3BlobStore(config S3Config) (*S3BlobStore, error) {
+	endpoint := config.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", config.Region)
+	}
+	base, err := url.Parse(endpoint)
+	if err != nil || base.Host == "" || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", endpoint)
+	}
+
+	if config.PathStyle {
+		base.Path = "/" + config.Bucket
+	} else {
+		base.Host = config.Bucket + "." + base.Host
+		base.Path = ""
+	}
+
+	return &S3BlobStore{
+		config: config,
+		base:   base,
+		client: &http.Client{Timeout: BlobRequestTimeout},
+		now:    time.Now,
+	}, nil
+}
+
+// Put uploads data as a private object. Objects carry their expiry as metadata, but deletion
+// relies on picosend and, as a safety net, a lifecycle rule on the bucket prefix.
+func (b *S3BlobStore) Put(ctx context.Context, id string, data []byte, expiresAt time.Time) error {
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set("X-Amz-Meta-Expires-At", expiresAt.UTC().Format(time.RFC3339))
+
+	resp, err := b.do(ctx, "PUT", b.config.Prefix+id, header, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("s3 put returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Get downloads the object stored under id
+func (b *S3BlobStore) Get(ctx context.Context, id string) ([]byte, error) {
+	resp, err := b.do(ctx, "GET", b.config.Prefix+id, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusNotFound:
+		return nil, ErrBlobNotFound
+	default:
+		return nil, fmt.Errorf("s3 get returned status %d", resp.StatusCode)
+	}
+}
+
+// Delete removes the object stored under id. S3 returns 204 for missing keys too.
+func (b *S3BlobStore) Delete(ctx context.Context, id string) error {
+	resp, err := b.do(ctx, "DELETE", b.config.Prefix+id, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("s3 delete returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Check verifies the bucket is reachable with the configured credentials, for use as a readiness check
+func (b *S3BlobStore) Check(ctx context.Context) error {
+	resp, err := b.do(ctx, "HEAD", "", nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("s3 bucket returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (b *S3BlobStore) do(ctx context.Context, method, key string, header http.Header, body []byte) (*http.Response, error) {
+	u := *b.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if b.config.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", b.config.SessionToken)
+	}
+
+	signS3Request(req, body, b.config.AccessKeyID, b.config.SecretAccessKey, b.config.Region, b.now())
+	return b.client.Do(req)
+}
+
+// signS3Request adds an AWS signature V4 Authorization header covering the host and every header already set
+func signS3Request(req *http.Request, body []byte, accessKeyID, secretAccessKey, region string, now time.Time) {
+	signAWSRequest(req, body, "s3", accessKeyID, secretAccessKey, region, now)
+}
+
+// signAWSRequest signs a request to any AWS service with signature V4
+func signAWSRequest(req *http.Request, body []byte, service, accessKeyID, secretAccessKey, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// Canonical headers are lowercase, sorted and include host
+	canonical := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		canonical[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(canonical))
+	for name := range canonical {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + canonical[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// s3EscapePath URI-encodes every byte except unreserved characters and slashes, as signature V4 requires
+func s3EscapePath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	var sb strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	ScanTimeout         = 30 * time.Second // Timeout for connecting to clamd and scanning one secret
+	ScanChunkSize       = 64 * 1024        // Bytes sent per INSTREAM chunk
+	MaxQuarantinedItems = 100              // Items kept in quarantine; the oldest is dropped beyond it
+	MaxQuarantineBytes  = 16 << 20         // Content kept in quarantine; the oldest items are dropped beyond it
+)
+
+// ScanConfig selects the clamd daemon that checks content the server sees in plain text, and
+// where admins are told about content it flags. Only clamd is supported: ICAP services are out
+// of scope, put clamd in front of the same signatures instead.
+type ScanConfig struct {
+	Clamd            string // tcp://host:3310 or unix:///path/to/clamd.sock; "" disables scanning
+	NotifyWebhook    string // URL notified of quarantined content; "" for none
+	NotifyWebhookKey string // Key the notifications are signed with, as sender webhooks are
+	NotifyEmail      string // Address emailed about quarantined content; "" for none
+}
+
+// Enabled reports whether a scanner is configured
+func (c ScanConfig) Enabled() bool {
+	return c.Clamd != ""
+}
+
+// Validate checks the clamd address has a known scheme and the notification settings are
+// complete
+func (c ScanConfig) Validate() error {
+	if _, _, err := clamdAddress(c.Clamd); err != nil {
+		return err
+	}
+	if c.NotifyWebhook != "" {
+		if u, err := url.Parse(c.NotifyWebhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("scan-notify-webhook must be an absolute http or https URL")
+		}
+		if c.NotifyWebhookKey == "" {
+			return errors.New("scan-notify-webhook-key is required when scan-notify-webhook is set")
+		}
+	}
+	if c.NotifyEmail != "" {
+		return validateEmailAddress("scan-notify-email", c.NotifyEmail)
+	}
+	return nil
+}
+
+// clamdAddress splits a clamd URL into the network and address to dial
+func clamdAddress(value string) (network, addr string, err error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return "", "", errors.New("scan-clamd must be a tcp:// or unix:// URL")
+	}
+	switch {
+	case u.Scheme == "tcp" && u.Host != "":
+		return "tcp", u.Host, nil
+	case u.Scheme == "unix" && u.Path != "":
+		return "unix", u.Path, nil
+	}
+	return "", "", errors.New("scan-clamd must be a tcp://host:port or unix:///path URL")
+}
+
+// ContentScanner checks content with clamd's INSTREAM command, one connection per scan
+type ContentScanner struct {
+	network, addr string
+	timeout       time.Duration
+}
+
+func NewContentScanner(cfg ScanConfig) (*ContentScanner, error) {
+	network, addr, err := clamdAddress(cfg.Clamd)
+	if err != nil {
+		return nil, err
+	}
+	return &ContentScanner{network: network, addr: addr, timeout: ScanTimeout}, nil
+}
+
+// Scan sends content to clamd and returns the name of the signature it matched, or "" when
+// it is clean. Content clamd can't scan, for example beyond its StreamMaxLength, is an error.
+func (s *ContentScanner) Scan(ctx context.Context, content []byte) (string, error) {
+	reply, err := s.command(ctx, "zINSTREAM", func(conn net.Conn) error {
+		var size [4]byte
+		for len(content) > 0 {
+			chunk := content[:min(len(content), ScanChunkSize)]
+			content = content[len(chunk):]
+			binary.BigEndian.PutUint32(size[:], uint32(len(chunk)))
+			if _, err := conn.Write(size[:]); err != nil {
+				return err
+			}
+			if _, err := conn.Write(chunk); err != nil {
+				return err
+			}
+		}
+		binary.BigEndian.PutUint32(size[:], 0)
+		_, err := conn.Write(size[:])
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	result := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case result == "OK":
+		return "", nil
+	case strings.HasSuffix(result, " FOUND"):
+		return strings.TrimSuffix(result, " FOUND"), nil
+	}
+	return "", fmt.Errorf("clamd: %s", reply)
+}
+
+// Check pings clamd, for the readiness probe
+func (s *ContentScanner) Check(ctx context.Context) error {
+	reply, err := s.command(ctx, "zPING", nil)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("clamd: unexpected reply %q", reply)
+	}
+	return nil
+}
+
+// command sends a null-terminated clamd command, then whatever send writes, and returns the
+// null-terminated reply
+func (s *ContentScanner) command(ctx context.Context, name string, send func(conn net.Conn) error) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(ctx, s.network, s.addr)
+	if err != nil {
+		return "", fmt.Errorf("clamd: %w", err)
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	if _, err := conn.Write([]byte(name + "\x00")); err != nil {
+		return "", fmt.Errorf("clamd: %w", err)
+	}
+	if send != nil {
+		if err := send(conn); err != nil {
+			return "", fmt.Errorf("clamd: %w", err)
+		}
+	}
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		return "", fmt.Errorf("clamd: %w", err)
+	}
+	return strings.TrimSpace(strings.TrimSuffix(reply, "\x00")), nil
+}
+
+// QuarantinedItem is content the scanner flagged, kept for admins to inspect
+type QuarantinedItem struct {
+	ID            string    `json:"id"`
+	Signature     string    `json:"signature"` // Name of the signature clamd matched
+	Size          int       `json:"size"`
+	SHA256        string    `json:"sha256"`                 // Of the content, to look it up elsewhere
+	CreatorHash   string    `json:"creator_hash,omitempty"` // Blocklist value for the sender, see AbuseDesk.CreatorHash
+	QuarantinedAt time.Time `json:"quarantined_at"`
+
+	content *lockedBuffer
+}
+
+// Quarantine holds content the scanner refused in protected memory until an admin deletes
+// it, dropping the oldest items beyond MaxQuarantinedItems or MaxQuarantineBytes
+type Quarantine struct {
+	mu    sync.Mutex
+	items []*QuarantinedItem // Oldest first
+	bytes int
+}
+
+func NewQuarantine() *Quarantine {
+	return &Quarantine{}
+}
+
+// Add quarantines content as item, taking ownership of content: it is copied into protected
+// memory and the caller's slice is zeroed. Returns the item with its size and hash filled in.
+func (q *Quarantine) Add(item QuarantinedItem, content []byte) QuarantinedItem {
+	item.Size, item.SHA256 = len(content), contentHash(content)
+	stored := item
+	stored.content = newLockedBuffer(content)
+	wipeBytes(content)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.items = append(q.items, &stored)
+	q.bytes += stored.Size
+	for len(q.items) > MaxQuarantinedItems || (q.bytes > MaxQuarantineBytes && len(q.items) > 1) {
+		q.drop(0)
+	}
+	return item
+}
+
+// Items lists the quarantined items, oldest first, without their content
+func (q *Quarantine) Items() []QuarantinedItem {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items := make([]QuarantinedItem, len(q.items))
+	for i, item := range q.items {
+		items[i] = *item
+		items[i].content = nil
+	}
+	return items
+}
+
+// Content returns a copy of the content quarantined under id. The caller wipes it.
+func (q *Quarantine) Content(id string) ([]byte, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, item := range q.items {
+		if item.ID == id {
+			return append([]byte(nil), item.content.Bytes()...), true
+		}
+	}
+	return nil, false
+}
+
+// Delete wipes and forgets the item quarantined under id
+func (q *Quarantine) Delete(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, item := range q.items {
+		if item.ID == id {
+			q.drop(i)
+			return true
+		}
+	}
+	return false
+}
+
+// drop wipes the item at index i. Must be called with q.mu held.
+func (q *Quarantine) drop(i int) {
+	item := q.items[i]
+	item.content.Destroy()
+	q.bytes -= item.Size
+	q.items = append(q.items[:i], q.items[i+1:]...)
+}
+
+// QuarantineAlert is the JSON body POSTed to scan-notify-webhook when content is quarantined
+type QuarantineAlert struct {
+	Event       string `json:"event"` // Always quarantined
+	Timestamp   string `json:"timestamp"`
+	ID          string `json:"id"`
+	Signature   string `json:"signature"`
+	Size        int    `json:"size"`
+	SHA256      string `json:"sha256"`
+	CreatorHash string `json:"creator_hash,omitempty"`
+}
+
+// notifyQuarantined tells admins about a quarantined item through the configured webhook and
+// email address
+func (srv *Server) notifyQuarantined(item QuarantinedItem) {
+	if srv.scanAlerts != nil {
+		srv.scanAlerts.Send(Webhook{URL: srv.config.Scan.NotifyWebhook, SigningKey: srv.config.Scan.NotifyWebhookKey}, "quarantined", QuarantineAlert{
+			Event:       "quarantined",
+			Timestamp:   item.QuarantinedAt.UTC().Format(time.RFC3339),
+			ID:          item.ID,
+			Signature:   item.Signature,
+			Size:        item.Size,
+			SHA256:      item.SHA256,
+			CreatorHash: item.CreatorHash,
+		})
+	}
+	if srv.emailNotifier != nil && srv.config.Scan.NotifyEmail != "" {
+		srv.emailNotifier.queue(srv.config.Scan.NotifyEmail, "quarantined.txt", emailTemplateData{
+			ID:          item.ID,
+			Time:        item.QuarantinedAt.UTC().Format("2006-01-02 15:04:05 UTC"),
+			Signature:   item.Signature,
+			CreatorHash: item.CreatorHash,
+		})
+	}
+}
+
+// scanPlaintext checks content the server is about to encrypt for a sender. Infected content is
+// refused and kept in the quarantine, where admins can inspect it, and they are notified. It is
+// also filed as a malware report under the quarantine ID with the creator's hash, so the sender
+// can be blocked like any reported one. Without a scanner everything passes; when the scanner
+// can't be reached nothing does.
+func (srv *Server) scanPlaintext(r *http.Request, plaintext []byte) *requestError {
+	if srv.scanner == nil {
+		return nil
+	}
+	signature, err := srv.scanner.Scan(r.Context(), plaintext)
+	if err != nil {
+		srv.logger.Error("Failed to scan content", "error", err)
+		return &requestError{Code: http.StatusServiceUnavailable, Key: "error.scan_unavailable"}
+	}
+	if signature == "" {
+		return nil
+	}
+
+	item := QuarantinedItem{
+		ID:            generateID(),
+		Signature:     signature,
+		CreatorHash:   srv.abuse.CreatorHash(clientAddr(r, srv.config.TrustedProxies)),
+		QuarantinedAt: time.Now(),
+	}
+	item = srv.quarantine.Add(item, append([]byte(nil), plaintext...))
+	srv.abuse.Report(item.ID, "malware", "clamd: "+signature, Fingerprints{Creator: item.CreatorHash}, item.QuarantinedAt)
+	srv.logger.Warn("Infected content quarantined", "id", item.ID, "signature", signature, "creator_hash", item.CreatorHash)
+	srv.notifyQuarantined(item)
+	return &requestError{Code: http.StatusUnprocessableEntity, Key: "error.content_infected"}
+}
+
+func (srv *Server) adminListQuarantineHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(srv.quarantine.Items())
+}
+
+// adminQuarantinedContentHandler downloads quarantined content as it was sent. It is infected,
+// so it is served as an attachment that browsers won't render.
+func (srv *Server) adminQuarantinedContentHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	content, ok := srv.quarantine.Content(id)
+	if !ok {
+		apiError(w, r, http.StatusNotFound, "quarantined item not found")
+		return
+	}
+	defer wipeBytes(content)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+id+`.quarantined"`)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(content)
+}
+
+// adminDeleteQuarantinedHandler wipes a quarantined item once an admin has dealt with it
+func (srv *Server) adminDeleteQuarantinedHandler(w http.ResponseWriter, r *http.Request) {
+	if !srv.quarantine.Delete(mux.Vars(r)["id"]) {
+		apiError(w, r, http.StatusNotFound, "quarantined item not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// eicar is the standard antivirus test string, assembled so this file doesn't trip scanners
+var eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$` + "EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*"
+
+// newFakeClamd answers clamd's PING and INSTREAM commands, finding the EICAR string
+func newFakeClamd(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				command, err := reader.ReadString(0)
+				if err != nil {
+					return
+				}
+				if command == "zPING\x00" {
+					io.WriteString(conn, "PONG\x00")
+					return
+				}
+				var content bytes.Buffer
+				for {
+					var size uint32
+					if binary.Read(reader, binary.BigEndian, &size) != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					io.CopyN(&content, reader, int64(size))
+				}
+				if strings.Contains(content.String(), "EICAR-STANDARD") {
+					io.WriteString(conn, "stream: Eicar-Test-Signature FOUND\x00")
+				} else {
+					io.WriteString(conn, "stream: OK\x00")
+				}
+			}()
+		}
+	}()
+	return "tcp://" + listener.Addr().String()
+}
+
+func TestContentScanner(t *testing.T) {
+	scanner, err := NewContentScanner(ScanConfig{Clamd: newFakeClamd(t)})
+	if err != nil {
+		t.Fatalf("Failed to create scanner: %v", err)
+	}
+	if err := scanner.Check(context.Background()); err != nil {
+		t.Errorf("Expected clamd to answer a ping, got %v", err)
+	}
+	// Content spanning several chunks is scanned whole
+	content := strings.Repeat("a", ScanChunkSize) + eicar
+	if signature, err := scanner.Scan(context.Background(), []byte(content)); err != nil || signature != "Eicar-Test-Signature" {
+		t.Errorf("Expected the signature, got %q %v", signature, err)
+	}
+	if signature, err := scanner.Scan(context.Background(), []byte("clean")); err != nil || signature != "" {
+		t.Errorf("Expected clean content to pass, got %q %v", signature, err)
+	}
+}
+
+func TestScan_QuarantinesInfectedContent(t *testing.T) {
+	alerts := make(chan QuarantineAlert, 2)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert QuarantineAlert
+		json.NewDecoder(r.Body).Decode(&alert)
+		alerts <- alert
+	}))
+	defer hook.Close()
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.AdminAPIKey = testAdminKey
+		cfg.Scan = ScanConfig{Clamd: newFakeClamd(t), NotifyWebhook: hook.URL, NotifyWebhookKey: "key", NotifyEmail: "admin@example.com"}
+		cfg.SMTP = SMTPConfig{Host: "mail.example.com", Port: 25, From: "picosend@example.com", DeliveryLimit: 1}
+	})
+	var mu sync.Mutex
+	var sent []string
+	srv.emailNotifier.send = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, to[0]+"\n"+string(msg))
+		return nil
+	}
+
+	if rec := createPlainText(t, srv, "", "clean", nil); rec.Code != http.StatusOK {
+		t.Fatalf("Expected clean content to be stored, got %d", rec.Code)
+	}
+	if rec := createPlainText(t, srv, "", eicar, nil); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for infected plain text, got %d", rec.Code)
+	}
+	if rec := postForm(srv, "/s", url.Values{"secret": {eicar}}); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 for infected form content, got %d", rec.Code)
+	}
+	if srv.store.Count() != 1 {
+		t.Errorf("Expected only the clean secret to be stored, got %d", srv.store.Count())
+	}
+
+	// Both attempts wait in quarantine for an admin
+	router := srv.routes()
+	admin := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+testAdminKey)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	var items []QuarantinedItem
+	json.NewDecoder(admin("GET", "/admin/api/quarantine").Body).Decode(&items)
+	if len(items) != 2 || items[0].Signature != "Eicar-Test-Signature" || items[0].Size != len(eicar) || items[0].CreatorHash == "" {
+		t.Fatalf("Expected both attempts quarantined, got %+v", items)
+	}
+	if rec := admin("GET", "/admin/api/quarantine/"+items[0].ID); rec.Body.String() != eicar || rec.Header().Get("Content-Disposition") == "" {
+		t.Errorf("Expected the quarantined content as an attachment, got %q", rec.Body.String())
+	}
+	if rec := admin("DELETE", "/admin/api/quarantine/"+items[0].ID); rec.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 deleting the item, got %d", rec.Code)
+	}
+	if rec := admin("GET", "/admin/api/quarantine/"+items[0].ID); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected the deleted item gone, got %d", rec.Code)
+	}
+
+	// Admins are notified, and the sender can be blocked like a reported one
+	for range items {
+		if alert := <-alerts; alert.Event != "quarantined" || alert.Signature != "Eicar-Test-Signature" {
+			t.Errorf("Unexpected alert %+v", alert)
+		}
+	}
+	srv.emailNotifier.Close()
+	if len(sent) != 2 || !strings.HasPrefix(sent[0], "admin@example.com\n") || !strings.Contains(sent[0], items[0].ID) {
+		t.Errorf("Expected an email per quarantined item, got %q", sent)
+	}
+	reports := srv.abuse.Reports()
+	if len(reports) != 2 || reports[0].Reasons["malware"] != 1 || reports[0].Details[0] != "clamd: Eicar-Test-Signature" || reports[0].CreatorHash == "" {
+		t.Errorf("Expected both attempts reported as malware, got %+v", reports)
+	}
+}
+
+func TestScan_FailsClosed(t *testing.T) {
+	probe, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := probe.Addr().String()
+	probe.Close()
+	srv := newTestServer(t, func(cfg *Config) { cfg.Scan.Clamd = "tcp://" + addr })
+
+	if rec := createPlainText(t, srv, "", "clean", nil); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 while clamd is down, got %d", rec.Code)
+	}
+}
+
+func TestLoadConfig_Scan(t *testing.T) {
+	for value, valid := range map[string]bool{
+		"tcp://clamav:3310":            true,
+		"unix:///run/clamav/clamd.ctl": true,
+		"clamav:3310":                  false,
+		"tcp://":                       false,
+		"icap://scanner":               false,
+	} {
+		_, err := loadConfig(nil, envMap(map[string]string{"SCAN_CLAMD": value}))
+		if valid && err != nil || !valid && (err == nil || !strings.Contains(err.Error(), "scan-clamd")) {
+			t.Errorf("%s: unexpected result %v", value, err)
+		}
+	}
+
+	// Quarantine notifications need complete settings
+	for _, env := range []map[string]string{
+		{"SCAN_CLAMD": "tcp://clamav:3310", "SCAN_NOTIFY_WEBHOOK": "https://hooks.example.com/scan"},
+		{"SCAN_CLAMD": "tcp://clamav:3310", "SCAN_NOTIFY_WEBHOOK": "hooks.example.com", "SCAN_NOTIFY_WEBHOOK_KEY": "key"},
+		{"SCAN_CLAMD": "tcp://clamav:3310", "SCAN_NOTIFY_EMAIL": "admin@example.com"},
+		{"SCAN_NOTIFY_EMAIL": "admin@example.com", "SMTP_HOST": "mail.example.com", "SMTP_FROM": "picosend@example.com"},
+	} {
+		if _, err := loadConfig(nil, envMap(env)); err == nil || !strings.Contains(err.Error(), "scan-") {
+			t.Errorf("Expected a scan error for %v, got %v", env, err)
+		}
+	}
+	env := map[string]string{"SCAN_CLAMD": "tcp://clamav:3310", "SCAN_NOTIFY_WEBHOOK": "https://hooks.example.com/scan", "SCAN_NOTIFY_WEBHOOK_KEY": "key", "SCAN_NOTIFY_EMAIL": "admin@example.com", "SMTP_HOST": "mail.example.com", "SMTP_FROM": "picosend@example.com"}
+	if _, err := loadConfig(nil, envMap(env)); err != nil {
+		t.Errorf("Expected complete notification settings to load, got %v", err)
+	}
+}
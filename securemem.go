@@ -0,0 +1,63 @@
+package main
+
+// lockedBuffer holds secret content outside the Go heap. Where the platform allows, its pages
+// are locked into RAM so they are never written to swap. The garbage collector never copies
+// it, so zeroing it on Destroy removes the only stored copy of the content.
+type lockedBuffer struct {
+	data   []byte
+	region []byte // Whole allocation including page padding, nil when heap allocated
+	locked bool
+}
+
+// newLockedBuffer copies content into protected memory. Returns nil for empty content.
+func newLockedBuffer(content []byte) *lockedBuffer {
+	if len(content) == 0 {
+		return nil
+	}
+
+	region, locked, err := allocLocked(len(content))
+	if err != nil {
+		// Out of mappings, fall back to the heap rather than failing the request
+		region = nil
+	}
+
+	b := &lockedBuffer{region: region, locked: locked}
+	if region != nil {
+		b.data = region[:len(content):len(content)]
+	} else {
+		b.data = make([]byte, len(content))
+	}
+	copy(b.data, content)
+	return b
+}
+
+// Bytes returns the content. The slice is only valid until Destroy.
+func (b *lockedBuffer) Bytes() []byte {
+	if b == nil {
+		return nil
+	}
+	return b.data
+}
+
+// Destroy zeroes the content and releases the memory
+func (b *lockedBuffer) Destroy() {
+	if b == nil {
+		return
+	}
+	if b.region != nil {
+		wipeBytes(b.region)
+		freeLocked(b.region, b.locked)
+	} else {
+		wipeBytes(b.data)
+	}
+	b.data, b.region = nil, nil
+}
+
+// memoryLockAvailable reports whether secret memory can be locked, checked once at startup so
+// operators learn that content may be swapped. Locking can still fail later if many secrets
+// exceed the memlock limit; those buffers are kept unlocked.
+func memoryLockAvailable() bool {
+	b := newLockedBuffer([]byte{0})
+	defer b.Destroy()
+	return b.locked
+}
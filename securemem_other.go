@@ -0,0 +1,12 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+// Memory locking is not implemented on this platform, content is kept on the heap
+func allocLocked(n int) ([]byte, bool, error) {
+	return nil, false, errors.New("memory locking not supported")
+}
+
+func freeLocked(region []byte, locked bool) {}
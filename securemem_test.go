@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestLockedBuffer(t *testing.T) {
+	content := []byte("ciphertext")
+	b := newLockedBuffer(content)
+	if !bytes.Equal(b.Bytes(), content) {
+		t.Fatalf("Expected buffer to hold the content, got %q", b.Bytes())
+	}
+
+	content[0] = 'X'
+	if b.Bytes()[0] != 'c' {
+		t.Error("Expected buffer to hold its own copy of the content")
+	}
+
+	b.Destroy()
+	if b.Bytes() != nil {
+		t.Error("Expected destroyed buffer to be empty")
+	}
+
+	if newLockedBuffer(nil) != nil {
+		t.Error("Expected no buffer for empty content")
+	}
+	var empty *lockedBuffer
+	empty.Destroy()
+}
+
+func TestWipeSecret_ZeroesContent(t *testing.T) {
+	content := []byte("ciphertext")
+	wipeSecret(&Secret{Content: content})
+
+	if !bytes.Equal(content, make([]byte, len(content))) {
+		t.Errorf("Expected content to be zeroed in place, got %q", content)
+	}
+}
+
+func TestSecretStore_ContentProtected(t *testing.T) {
+	store := NewSecretStore()
+
+	content := []byte("ciphertext")
+	id, err := store.storeContent(content, time.Hour, SecretOptions{})
+	if err != nil {
+		t.Fatalf("Failed to store secret: %v", err)
+	}
+	if !bytes.Equal(content, make([]byte, len(content))) {
+		t.Error("Expected the caller's copy to be zeroed once stored")
+	}
+
+	buffer := store.shardFor(id).secrets[keyOf(id)].buffer
+	if buffer == nil {
+		t.Fatal("Expected content to be held in protected memory")
+	}
+
+	secret, found := store.Get(id)
+	if !found || string(secret.Content) != "ciphertext" {
+		t.Fatalf("Expected to read the content back, got %q", secret.Content)
+	}
+	if buffer.Bytes() != nil {
+		t.Error("Expected protected memory to be released after the last read")
+	}
+}
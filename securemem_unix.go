@@ -0,0 +1,27 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// allocLocked maps anonymous memory for n bytes and tries to lock it into RAM
+func allocLocked(n int) ([]byte, bool, error) {
+	pageSize := os.Getpagesize()
+	size := (n + pageSize - 1) / pageSize * pageSize
+	region, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, false, err
+	}
+	return region, unix.Mlock(region) == nil, nil
+}
+
+func freeLocked(region []byte, locked bool) {
+	if locked {
+		unix.Munlock(region)
+	}
+	unix.Munmap(region)
+}
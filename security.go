@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultContentSecurityPolicy allows only same-origin resources. Inline scripts run only with
+// the nonce each page gets from scriptNonce, so injected markup can't run code on the pages
+// handling keys and plaintext. Inline styles are still allowed, and the QR code is rendered
+// to a data: URL.
+const DefaultContentSecurityPolicy = "default-src 'self'; script-src 'self'; " +
+	"style-src 'self' 'unsafe-inline'; img-src 'self' data:; connect-src 'self'; " +
+	"object-src 'none'; base-uri 'none'; form-action 'self'; frame-ancestors 'none'"
+
+const DefaultHSTSMaxAge = 365 * 24 * 60 * 60 // One year, in seconds
+
+// SecurityHeaders configures the headers added to HTML responses
+type SecurityHeaders struct {
+	Enabled               bool   // Disable when a reverse proxy already sets these headers
+	ContentSecurityPolicy string // Sent as Content-Security-Policy; omitted when empty
+	HSTSMaxAge            int    // Strict-Transport-Security max-age in seconds; 0 disables HSTS
+}
+
+// DefaultSecurityHeaders returns the built-in security header settings
+func DefaultSecurityHeaders() SecurityHeaders {
+	return SecurityHeaders{
+		Enabled:               true,
+		ContentSecurityPolicy: DefaultContentSecurityPolicy,
+		HSTSMaxAge:            DefaultHSTSMaxAge,
+	}
+}
+
+// scriptNonce generates the nonce the inline scripts of a page carry, as nonce="{{.Nonce}}",
+// and allows it in the page's Content-Security-Policy: the one the handler already set, or
+// the configured one. Pages must be rendered after the handler sets its own policy.
+func (srv *Server) scriptNonce(w http.ResponseWriter) string {
+	nonce := generateToken()
+	policy := w.Header().Get("Content-Security-Policy")
+	if headers := srv.config.SecurityHeaders; policy == "" && headers.Enabled {
+		policy = headers.ContentSecurityPolicy
+	}
+	if policy != "" {
+		w.Header().Set("Content-Security-Policy", withScriptNonce(policy, nonce))
+	}
+	return nonce
+}
+
+// withScriptNonce adds a nonce source to the script-src directive of policy, or to a new one
+// copying default-src, which script-src would otherwise fall back to. Browsers that support
+// nonces then ignore 'unsafe-inline' for scripts, so custom policies can keep it for older ones.
+func withScriptNonce(policy, nonce string) string {
+	source := " 'nonce-" + nonce + "'"
+	directives := strings.Split(policy, ";")
+	var fallback string
+	for i, directive := range directives {
+		name, sources, _ := strings.Cut(strings.TrimSpace(directive), " ")
+		switch {
+		case name == "script-src" && strings.TrimSpace(sources) == "'none'":
+			return policy
+		case name == "script-src":
+			directives[i] = strings.TrimRight(directive, " ") + source
+			return strings.Join(directives, ";")
+		case name == "default-src":
+			fallback = strings.TrimSpace(sources)
+		}
+	}
+	if fallback == "" || fallback == "'none'" {
+		// Scripts are either not restricted at all or not allowed by choice
+		return policy
+	}
+	return strings.Join(append(directives, " script-src "+fallback+source), ";")
+}
+
+// securityHeadersMiddleware sets nosniff on every response and adds CSP, HSTS, referrer and
+// frame-denial headers to HTML responses once the handler has chosen its content type
+func (srv *Server) securityHeadersMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers := srv.config.SecurityHeaders
+		if !headers.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		next.ServeHTTP(&securityHeadersWriter{ResponseWriter: w, headers: headers}, r)
+	})
+}
+
+type securityHeadersWriter struct {
+	http.ResponseWriter
+	headers     SecurityHeaders
+	wroteHeader bool
+}
+
+func (sw *securityHeadersWriter) WriteHeader(status int) {
+	if !sw.wroteHeader {
+		sw.wroteHeader = true
+		sw.applyHTMLHeaders()
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *securityHeadersWriter) Write(b []byte) (int, error) {
+	if !sw.wroteHeader {
+		// Mirror net/http's content sniffing so templates that don't set a type are covered
+		if sw.Header().Get("Content-Type") == "" {
+			sw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		sw.WriteHeader(http.StatusOK)
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+func (sw *securityHeadersWriter) applyHTMLHeaders() {
+	h := sw.Header()
+	if !strings.HasPrefix(h.Get("Content-Type"), "text/html") {
+		return
+	}
+
+	// Handlers that need a different policy set their own
+	if sw.headers.ContentSecurityPolicy != "" && h.Get("Content-Security-Policy") == "" {
+		h.Set("Content-Security-Policy", sw.headers.ContentSecurityPolicy)
+	}
+	// Browsers ignore HSTS received over plain HTTP, so it is safe to send
+	// even when TLS is terminated by a proxy in front of us
+	if sw.headers.HSTSMaxAge > 0 {
+		h.Set("Strict-Transport-Security", "max-age="+strconv.Itoa(sw.headers.HSTSMaxAge)+"; includeSubDomains")
+	}
+	h.Set("X-Frame-Options", "DENY")
+	// Share link paths contain the secret ID, don't leak them to linked sites
+	h.Set("Referrer-Policy", "no-referrer")
+}
+
+// Flush passes through to the underlying writer so streaming responses keep working
+func (sw *securityHeadersWriter) Flush() {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (sw *securityHeadersWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
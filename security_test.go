@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSecurityHeaders_HTMLResponses(t *testing.T) {
+	_, server := setupTestServer(t)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatalf("Failed to get home page: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	// Inline scripts run only with the page's nonce
+	_, nonce, _ := strings.Cut(string(body), `<script nonce="`)
+	nonce, _, _ = strings.Cut(nonce, `"`)
+	if nonce == "" || strings.Contains(string(body), "<script>") {
+		t.Fatal("Expected every inline script to carry a nonce")
+	}
+	expected := map[string]string{
+		"Content-Security-Policy": strings.Replace(DefaultContentSecurityPolicy, "script-src 'self'", "script-src 'self' 'nonce-"+nonce+"'", 1),
+		"X-Content-Type-Options":  "nosniff",
+		"X-Frame-Options":         "DENY",
+		"Referrer-Policy":         "no-referrer",
+	}
+	for header, value := range expected {
+		if got := resp.Header.Get(header); got != value {
+			t.Errorf("Expected %s %q, got %q", header, value, got)
+		}
+	}
+	if !strings.HasPrefix(resp.Header.Get("Strict-Transport-Security"), "max-age=31536000") {
+		t.Errorf("Expected HSTS header, got %q", resp.Header.Get("Strict-Transport-Security"))
+	}
+}
+
+func TestSecurityHeaders_JSONResponses(t *testing.T) {
+	_, server := setupTestServer(t)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/config")
+	if err != nil {
+		t.Fatalf("Failed to get config: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.Header.Get("X-Content-Type-Options") != "nosniff" {
+		t.Error("Expected nosniff on API responses")
+	}
+	if resp.Header.Get("Content-Security-Policy") != "" {
+		t.Error("Expected no CSP on non-HTML responses")
+	}
+}
+
+func TestSecurityHeaders_Configurable(t *testing.T) {
+	srv, server := setupTestServer(t)
+	defer server.Close()
+
+	srv.config.SecurityHeaders = SecurityHeaders{Enabled: true, ContentSecurityPolicy: "default-src 'none'"}
+
+	resp, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatalf("Failed to get home page: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.Header.Get("Content-Security-Policy") != "default-src 'none'" {
+		t.Errorf("Expected custom CSP, got %q", resp.Header.Get("Content-Security-Policy"))
+	}
+	if resp.Header.Get("Strict-Transport-Security") != "" {
+		t.Error("Expected HSTS to be disabled when max-age is 0")
+	}
+
+	srv.config.SecurityHeaders.Enabled = false
+	resp, err = http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatalf("Failed to get home page: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.Header.Get("Content-Security-Policy") != "" || resp.Header.Get("X-Frame-Options") != "" {
+		t.Error("Expected no security headers when disabled")
+	}
+}
+
+func TestWithScriptNonce(t *testing.T) {
+	for _, tt := range []struct {
+		policy string
+		want   string
+	}{
+		{"default-src 'self'; script-src 'self' 'unsafe-inline'", "default-src 'self'; script-src 'self' 'unsafe-inline' 'nonce-abc'"},
+		{"default-src 'self' https://cdn.example.com; img-src *", "default-src 'self' https://cdn.example.com; img-src *; script-src 'self' https://cdn.example.com 'nonce-abc'"},
+		{"default-src 'none'", "default-src 'none'"},
+		{"default-src 'self'; script-src 'none'", "default-src 'self'; script-src 'none'"},
+		{"frame-ancestors 'none'", "frame-ancestors 'none'"},
+	} {
+		if got := withScriptNonce(tt.policy, "abc"); got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.policy, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,553 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// CleanupInterval is how often expired secrets and abandoned uploads are removed
+const CleanupInterval = time.Minute
+
+// Server is one picosend instance: a secret store with the handlers, settings and background
+// work around it. Servers share no state, so several can run in one process.
+type Server struct {
+	config *Config
+	logger *slog.Logger
+
+	store          *SecretStore
+	uploads        *UploadStore
+	claims         *ClaimTokens
+	uploadLinks    *UploadLinks
+	apiKeys        *APIKeyRegistry
+	tenants        *TenantRegistry
+	metrics        *MetricsCollector
+	lookupThrottle *LookupThrottle // Blocks clients guessing secret IDs; nil when disabled
+	recipients     *RecipientDirectory
+	statusStreams  *StatusStreams
+	handoffs       *HandoffRelay
+	webhooks       *WebhookNotifier
+	emailNotifier  *EmailNotifier   // Sends read-receipt emails; nil when SMTP is not configured
+	deliveries     *DeliveryLimiter // Limits secret links emailed to recipients; nil when not enabled
+	messenger      Messenger        // Texts pickup PINs to recipients; nil when no SMS provider is set
+	scanner        *ContentScanner  // Scans content the server sees in plain text; nil when not configured
+	quarantine     *Quarantine      // Content the scanner refused, kept for admins to inspect
+	scanAlerts     *WebhookNotifier // Notifies admins of quarantined content; nil without scan-notify-webhook
+	smsLimits      *DeliveryLimiter
+	oidc           *OIDCProvider // Signs in users for creating secrets; nil when single sign-on is off
+	tlsFiles       *TLSFiles     // Certificate served on TCP listeners; nil when TLS is off
+	auditLog       *AuditLog     // Records secret lifecycle events; nil when auditing is disabled
+	eventBus       *EventBus     // Publishes secret events to a message bus; nil when not configured
+	challenger     *Challenger   // Checks reveal challenges; nil when reading needs only the link
+	geoIP          *GeoIPDB      // Looks up readers' countries; nil when no database is configured
+	abuse          *AbuseDesk
+	faults         *FaultInjector // Injects failures into requests in demo mode; nil otherwise
+	cluster        *Cluster       // Replicates secrets to the other nodes; nil when running alone
+	static         *staticHandler
+	pages          *Pages
+
+	policy atomic.Pointer[Policy] // Rules for new secrets, swapped on reload; nil for none
+
+	startTime    time.Time
+	shuttingDown atomic.Bool // Set once graceful shutdown starts so /readyz takes the instance out of rotation
+
+	readinessMu     sync.RWMutex
+	readinessChecks map[string]func(ctx context.Context) error
+
+	wellKnownMu sync.RWMutex
+	wellKnown   map[string]wellKnownDocument // Documents under /.well-known/ by name
+}
+
+// NewServer creates a server with an empty store configured by cfg. A nil logger uses slog.Default.
+func NewServer(cfg *Config, logger *slog.Logger) (*Server, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	srv := &Server{
+		config:          cfg,
+		logger:          logger,
+		store:           NewSecretStore(),
+		claims:          NewClaimTokens(cfg.Cluster.tokenKey("claim")),
+		uploadLinks:     NewUploadLinks(),
+		apiKeys:         NewAPIKeyRegistry(),
+		tenants:         NewTenantRegistry(),
+		metrics:         NewMetricsCollector(),
+		recipients:      NewRecipientDirectory(),
+		statusStreams:   NewStatusStreams(),
+		handoffs:        NewHandoffRelay(),
+		abuse:           NewAbuseDesk(),
+		quarantine:      NewQuarantine(),
+		webhooks:        NewWebhookNotifier(false),
+		startTime:       time.Now(),
+		readinessChecks: map[string]func(ctx context.Context) error{},
+		wellKnown:       map[string]wellKnownDocument{},
+	}
+	srv.uploads = NewUploadStore(srv.store, cfg.MaxUploadSize)
+	srv.policy.Store(cfg.Policy)
+	static, err := newStaticHandler(staticFS, cfg.Branding.StaticDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load static files: %w", err)
+	}
+	srv.static = static
+	srv.static.setDefault("static/robots.txt", robotsTxt(cfg.BasePath))
+	if cfg.SecurityTxt.Enabled() {
+		srv.RegisterWellKnown("security.txt", "text/plain; charset=utf-8", srv.securityTxt)
+	}
+	if srv.pages, err = loadPages(cfg.BasePath, cfg.Branding.TemplatesDir, srv.static); err != nil {
+		return nil, err
+	}
+	srv.store.SetLimits(cfg.Limits)
+	srv.store.SetIDFormat(cfg.IDFormat)
+	srv.store.SetEvictionPolicy(cfg.EvictionPolicy)
+	if cfg.LookupFailureLimit > 0 {
+		srv.lookupThrottle = NewLookupThrottle(cfg.LookupFailureLimit, LookupFailureWindow)
+	}
+	if cfg.Demo {
+		srv.faults = NewFaultInjector()
+		srv.store.SetIDRandom(newDemoRandom(DemoIDSeed))
+		logger.Warn("Demo mode enabled: secret IDs are predictable, do not store real secrets")
+	}
+	if cfg.GeoIPDB != "" && cfg.ReaderDetails {
+		if srv.geoIP, err = OpenGeoIPDB(cfg.GeoIPDB); err != nil {
+			return nil, fmt.Errorf("failed to load GeoIP database: %w", err)
+		}
+	}
+
+	if cfg.EncryptionKey != nil {
+		wrapper, err := NewLocalKeyWrapper(cfg.EncryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key: %w", err)
+		}
+		srv.store.SetEncryptor(NewEnvelopeEncryptor(wrapper))
+		logger.Info("Encryption at rest enabled")
+	}
+
+	if cfg.KMS.Enabled() {
+		wrapper, err := NewKMSKeyWrapper(cfg.KMS, cfg.Vault)
+		if err != nil {
+			return nil, fmt.Errorf("invalid KMS configuration: %w", err)
+		}
+		srv.store.SetEncryptor(NewEnvelopeEncryptor(wrapper))
+		srv.RegisterReadinessCheck("kms", kmsCheck(wrapper))
+		scheme, _, _ := strings.Cut(cfg.KMS.Key, "://")
+		logger.Info("Encryption at rest enabled", "kms", scheme)
+	}
+
+	if cfg.S3.Enabled() {
+		blobs, err := NewS3BlobStore(cfg.S3)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 configuration: %w", err)
+		}
+		srv.store.SetBlobStore(blobs, cfg.S3.Threshold)
+		srv.RegisterReadinessCheck("s3", blobs.Check)
+		logger.Info("Object storage enabled", "bucket", cfg.S3.Bucket, "threshold", cfg.S3.Threshold)
+	}
+
+	if cfg.Cluster.Enabled() {
+		if srv.cluster, err = NewCluster(cfg.Cluster, logger); err != nil {
+			return nil, fmt.Errorf("invalid cluster configuration: %w", err)
+		}
+		srv.store.SetReplicator(srv.cluster)
+		srv.RegisterReadinessCheck("cluster", srv.cluster.Check)
+		logger.Info("Clustering enabled", "peers", len(cfg.Cluster.Peers))
+	}
+
+	if cfg.Vault.Enabled() {
+		blobs, err := NewVaultBlobStore(cfg.Vault)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Vault configuration: %w", err)
+		}
+		srv.store.SetBlobStore(blobs, cfg.Vault.Threshold)
+		srv.RegisterReadinessCheck("vault", blobs.Check)
+		logger.Info("Vault storage enabled", "mount", cfg.Vault.Mount, "threshold", cfg.Vault.Threshold)
+	}
+
+	if cfg.SMTP.Enabled() {
+		notifier, err := NewEmailNotifier(cfg.SMTP)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load email templates: %w", err)
+		}
+		srv.emailNotifier = notifier
+		srv.store.Subscribe(notifier.HandleEvent)
+		// Emailed links can't be built from the request's Host, which the client controls
+		if cfg.PublicURL != "" {
+			srv.deliveries = NewDeliveryLimiter(cfg.SMTP.DeliveryLimit, DeliveryWindow)
+		}
+	}
+
+	if cfg.SMS.Enabled() {
+		messenger, err := NewMessenger(cfg.SMS)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SMS configuration: %w", err)
+		}
+		srv.messenger = messenger
+		srv.smsLimits = NewDeliveryLimiter(cfg.SMS.Limit, DeliveryWindow)
+		logger.Info("PIN texting enabled", "provider", cfg.SMS.Provider)
+	}
+
+	if cfg.OIDC.Enabled() {
+		srv.oidc = NewOIDCProvider(cfg.OIDC, cfg.PublicURL+cfg.BasePath+"/auth/callback")
+		logger.Info("Single sign-on enabled", "issuer", cfg.OIDC.Issuer)
+	}
+
+	if cfg.TLS.Enabled() {
+		files, err := NewTLSFiles(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		srv.tlsFiles = files
+		logger.Info("TLS enabled", "client_certificates", cfg.TLS.ClientAuth())
+	}
+
+	if cfg.Challenge.Enabled() {
+		srv.challenger = NewChallenger(cfg.Challenge, cfg.Cluster.tokenKey("challenge"))
+		logger.Info("Reveal challenge enabled", "mode", cfg.Challenge.Mode)
+	}
+
+	if cfg.Audit.Enabled() {
+		auditLog, err := NewAuditLog(cfg.Audit)
+		if err != nil {
+			return nil, err
+		}
+		srv.auditLog = auditLog
+		srv.store.Subscribe(auditLog.HandleEvent)
+		logger.Info("Audit log enabled", "target", cfg.Audit.Target)
+	}
+
+	if cfg.EventBus.Enabled() {
+		bus, err := NewEventBus(cfg.EventBus)
+		if err != nil {
+			return nil, fmt.Errorf("invalid event bus configuration: %w", err)
+		}
+		srv.eventBus = bus
+		srv.store.Subscribe(bus.HandleEvent)
+		scheme, _, _ := strings.Cut(cfg.EventBus.URL, "://")
+		logger.Info("Event bus enabled", "scheme", scheme, "topic", cfg.EventBus.Topic)
+	}
+
+	if cfg.Scan.Enabled() {
+		if srv.scanner, err = NewContentScanner(cfg.Scan); err != nil {
+			return nil, fmt.Errorf("invalid scanner configuration: %w", err)
+		}
+		srv.RegisterReadinessCheck("clamd", srv.scanner.Check)
+		// The admin sets the address, so unlike sender webhooks it may be on the local network
+		if cfg.Scan.NotifyWebhook != "" {
+			srv.scanAlerts = NewWebhookNotifier(true)
+		}
+		logger.Info("Content scanning enabled", "clamd", cfg.Scan.Clamd)
+	}
+
+	srv.store.Subscribe(srv.tenants.HandleEvent)
+	srv.store.Subscribe(srv.metrics.HandleEvent)
+	srv.store.Subscribe(srv.webhooks.HandleEvent)
+	srv.store.Subscribe(srv.statusStreams.HandleEvent)
+	return srv, nil
+}
+
+// Handler returns the server's routes mounted under the configured base path
+func (srv *Server) Handler() http.Handler {
+	return mountHandler(srv.config.BasePath, srv.routes())
+}
+
+// routes creates the router with all routes, relative to the base path
+func (srv *Server) routes() *mux.Router {
+	r := mux.NewRouter()
+	r.NotFoundHandler = notFoundHandler()
+	r.MethodNotAllowedHandler = methodNotAllowedHandler()
+	r.Use(requestIDMiddleware, srv.accessLogMiddleware, srv.securityHeadersMiddleware, srv.corsMiddleware, srv.clientCertMiddleware, srv.csrfMiddleware)
+	if srv.faults != nil {
+		r.Use(srv.faults.Middleware)
+		r.HandleFunc("/demo/faults", srv.listFaultsHandler).Methods("GET")
+		r.HandleFunc("/demo/faults", srv.addFaultHandler).Methods("POST")
+		r.HandleFunc("/demo/faults", srv.clearFaultsHandler).Methods("DELETE")
+	}
+
+	// CORS preflight for every API route
+	r.PathPrefix("/api/").Methods("OPTIONS").HandlerFunc(srv.corsPreflightHandler)
+
+	// Static files
+	r.PathPrefix("/static/").Handler(srv.static).Methods("GET", "HEAD")
+	r.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		srv.static.serve(w, r, "static/robots.txt")
+	}).Methods("GET", "HEAD")
+	r.HandleFunc("/.well-known/{name}", srv.wellKnownHandler).Methods("GET", "HEAD")
+	r.HandleFunc("/manifest.webmanifest", srv.manifestHandler).Methods("GET")
+	r.HandleFunc("/sw.js", srv.serviceWorkerHandler).Methods("GET", "HEAD")
+	r.HandleFunc("/share", srv.shareHandler).Methods("POST")
+	r.HandleFunc("/report/{id}", srv.reportHandler).Methods("POST")
+
+	// Single sign-on
+	r.HandleFunc("/auth/login", srv.loginHandler).Methods("GET")
+	r.HandleFunc("/auth/callback", srv.loginCallbackHandler).Methods("GET")
+	r.HandleFunc("/auth/logout", srv.logoutHandler).Methods("POST")
+
+	// Views
+	r.HandleFunc("/", srv.homeHandler).Methods("GET")
+	// The view page tells whether a secret exists, so it is throttled like the API
+	r.Handle("/s/{id}", srv.throttleLookups(srv.requireValidSecretID(http.HandlerFunc(srv.viewSecretHandler)))).Methods("GET")
+	r.HandleFunc("/s", srv.noScriptCreateHandler).Methods("POST")
+	r.Handle("/s/{id}", srv.throttleLookups(srv.requireValidSecretID(http.HandlerFunc(srv.noScriptRevealHandler)))).Methods("POST")
+	r.HandleFunc("/u/{id}", srv.uploadLinkHandler).Methods("GET")
+	r.HandleFunc("/live", srv.liveHandoffHandler).Methods("GET")
+	r.HandleFunc("/mine", srv.mineHandler).Methods("GET")
+	r.HandleFunc("/ws/handoff/{channel}", srv.handoffHandler).Methods("GET")
+
+	// API
+	r.HandleFunc("/api/openapi.json", srv.openAPIHandler).Methods("GET")
+	r.HandleFunc("/api/docs", srv.apiDocsHandler).Methods("GET")
+	r.HandleFunc("/api/config", srv.configHandler).Methods("GET")
+	r.HandleFunc("/api/version", srv.versionHandler).Methods("GET")
+	r.HandleFunc("/api/theme", srv.setThemeHandler).Methods("PUT")
+	r.HandleFunc("/api/generate/password", srv.generatePasswordHandler).Methods("GET")
+	r.HandleFunc("/api/generate/passphrase", srv.generatePassphraseHandler).Methods("GET")
+	r.HandleFunc("/api/secrets", srv.createSecretHandler).Methods("POST")
+	r.HandleFunc("/api/secrets/batch", srv.batchCreateSecretsHandler).Methods("POST")
+	r.Handle("/api/secrets/lookup", srv.throttleLookups(http.HandlerFunc(srv.lookupSecretsHandler))).Methods("POST")
+
+	// Malformed IDs are rejected before the store is consulted
+	secret := r.PathPrefix("/api/secrets/{id}").Subrouter()
+	secret.Use(srv.throttleLookups, srv.requireValidSecretID)
+	secret.HandleFunc("", srv.getSecretHandler).Methods("GET")
+	secret.HandleFunc("", srv.updateSecretHandler).Methods("PATCH")
+	secret.HandleFunc("", srv.burnSecretHandler).Methods("DELETE")
+	secret.HandleFunc("/claim", srv.claimSecretHandler).Methods("POST")
+	secret.HandleFunc("/retry", srv.rereadSecretHandler).Methods("POST")
+	secret.HandleFunc("/retry", srv.discardSecretHandler).Methods("DELETE")
+	secret.HandleFunc("/content", srv.downloadSecretHandler).Methods("GET", "HEAD")
+	secret.HandleFunc("/status", srv.secretStatusHandler).Methods("GET")
+	secret.HandleFunc("/challenge", srv.challengeHandler).Methods("GET")
+	secret.HandleFunc("/events", srv.secretEventsHandler).Methods("GET")
+	secret.HandleFunc("/chunks", srv.listChunksHandler).Methods("GET")
+	secret.HandleFunc("/chunks/commit", srv.commitUploadHandler).Methods("POST")
+	secret.HandleFunc("/chunks/{index}", srv.putChunkHandler).Methods("PUT")
+
+	r.HandleFunc("/api/upload-links", srv.createUploadLinkHandler).Methods("POST")
+	r.HandleFunc("/api/upload-links/{id}", srv.uploadLinkStatusHandler).Methods("GET")
+	r.HandleFunc("/api/upload-links/{id}/submit", srv.submitUploadLinkHandler).Methods("POST")
+	r.HandleFunc("/api/recipients", srv.registerRecipientHandler).Methods("POST")
+	r.HandleFunc("/api/recipients/{name}", srv.getRecipientHandler).Methods("GET")
+	r.HandleFunc("/api/recipients/{name}", srv.deleteRecipientHandler).Methods("DELETE")
+
+	// Health probes and admin routes move to the management listener when there is one
+	if srv.config.ManagementListen == "" {
+		srv.operationalRoutes(r)
+	}
+	return r
+}
+
+// operationalRoutes adds the health probes and admin routes to r
+func (srv *Server) operationalRoutes(r *mux.Router) {
+	// Health probes
+	r.HandleFunc("/healthz", srv.healthzHandler).Methods("GET")
+	r.HandleFunc("/readyz", srv.readyzHandler).Methods("GET")
+
+	// Replication between cluster nodes
+	if srv.cluster != nil {
+		srv.clusterRoutes(r)
+	}
+
+	// Admin pages, for browsers
+	r.Handle("/admin/stats", srv.requireAdminLogin(http.HandlerFunc(srv.adminStatsPageHandler))).Methods("GET")
+
+	// Admin API
+	admin := r.PathPrefix("/admin/api").Subrouter()
+	admin.Use(srv.requireAdminKey)
+	admin.HandleFunc("/stats", srv.adminStatsHandler).Methods("GET")
+	admin.HandleFunc("/cleanup", srv.adminCleanupHandler).Methods("POST")
+	admin.HandleFunc("/purge", srv.adminPurgeHandler).Methods("POST")
+	admin.HandleFunc("/limits", srv.adminGetLimitsHandler).Methods("GET")
+	admin.HandleFunc("/limits", srv.adminSetLimitsHandler).Methods("PUT")
+	admin.HandleFunc("/keys", srv.adminListAPIKeysHandler).Methods("GET")
+	admin.HandleFunc("/keys", srv.adminCreateAPIKeyHandler).Methods("POST")
+	admin.HandleFunc("/keys/{id}", srv.adminUpdateAPIKeyHandler).Methods("PUT")
+	admin.HandleFunc("/keys/{id}", srv.adminRevokeAPIKeyHandler).Methods("DELETE")
+	admin.HandleFunc("/tenants", srv.adminListTenantsHandler).Methods("GET")
+	admin.HandleFunc("/tenants/{name}", srv.adminGetTenantHandler).Methods("GET")
+	admin.HandleFunc("/tenants/{name}", srv.adminPutTenantHandler).Methods("PUT")
+	admin.HandleFunc("/tenants/{name}", srv.adminDeleteTenantHandler).Methods("DELETE")
+	admin.HandleFunc("/reports", srv.adminListReportsHandler).Methods("GET")
+	admin.HandleFunc("/reports/{id}", srv.adminDismissReportHandler).Methods("DELETE")
+	admin.HandleFunc("/blocklist", srv.adminListBlocklistHandler).Methods("GET")
+	admin.HandleFunc("/blocklist", srv.adminBlockHandler).Methods("POST")
+	admin.HandleFunc("/blocklist/{type}/{value}", srv.adminUnblockHandler).Methods("DELETE")
+	admin.HandleFunc("/quarantine", srv.adminListQuarantineHandler).Methods("GET")
+	admin.HandleFunc("/quarantine/{id}", srv.adminQuarantinedContentHandler).Methods("GET")
+	admin.HandleFunc("/quarantine/{id}", srv.adminDeleteQuarantinedHandler).Methods("DELETE")
+	admin.HandleFunc("/export", srv.adminExportHandler).Methods("GET")
+	admin.HandleFunc("/import", srv.adminImportHandler).Methods("POST")
+	admin.HandleFunc("/rekey", srv.adminRekeyHandler).Methods("POST")
+}
+
+// runCleanupWorker runs the cleanup loop with a configurable interval.
+// It stops when the stop channel is closed. Returns the total number of secrets cleaned.
+func (srv *Server) runCleanupWorker(interval time.Duration, stop <-chan struct{}) int {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	total := 0
+	for {
+		select {
+		case <-ticker.C:
+			count := srv.store.CleanupExpired()
+			if count > 0 {
+				srv.logger.Info("Cleaned up expired secrets", "count", count)
+			}
+			if dropped := srv.uploads.Prune(time.Now()); dropped > 0 {
+				srv.logger.Info("Dropped abandoned uploads", "count", dropped)
+			}
+			srv.claims.Prune(time.Now())
+			srv.uploadLinks.Prune(time.Now())
+			if srv.lookupThrottle != nil {
+				srv.lookupThrottle.Prune(time.Now())
+			}
+			if srv.deliveries != nil {
+				srv.deliveries.Prune(time.Now())
+			}
+			if srv.smsLimits != nil {
+				srv.smsLimits.Prune(time.Now())
+			}
+			if srv.oidc != nil {
+				srv.oidc.Prune(time.Now())
+			}
+			total += count
+		case <-stop:
+			return total
+		}
+	}
+}
+
+// Run listens on the configured port and serves until ctx is cancelled, then shuts down
+// gracefully and wipes all secrets
+func (srv *Server) Run(ctx context.Context) error {
+	httpServer := &http.Server{
+		Addr:    ":" + srv.config.Port,
+		Handler: srv.Handler(),
+	}
+	addrs := httpServer.Addr
+	if len(srv.config.Listen) > 0 {
+		addrs = strings.Join(srv.config.Listen, ",")
+	}
+	build := currentBuild()
+	srv.logger.Info("Server starting", "addr", addrs, "base_path", srv.config.BasePath,
+		"version", build.Version, "commit", build.Commit, "build_date", build.BuildDate)
+	cleanupInterval := CleanupInterval
+	if srv.config.Demo {
+		cleanupInterval = DemoCleanupInterval
+	}
+	return srv.serve(ctx, httpServer, cleanupInterval)
+}
+
+// serve serves HTTP until ctx is cancelled, then drains in-flight requests,
+// stops the cleanup worker and wipes all in-memory secrets before returning.
+// systemd is notified once the server is ready and again when it stops.
+func (srv *Server) serve(ctx context.Context, httpServer *http.Server, cleanupInterval time.Duration) error {
+	addrs := srv.config.Listen
+	if len(addrs) == 0 {
+		addrs = []string{httpServer.Addr}
+	}
+	listeners, err := srv.listen(addrs)
+	if err != nil {
+		return err
+	}
+	listeners = srv.wrapTLS(listeners)
+	if httpServer.ConnContext == nil {
+		httpServer.ConnContext = markUnixConn
+	}
+
+	// The management listener is bound by address even under socket activation, and stays
+	// plain HTTP as it is meant for loopback or a private network
+	var managementServer *http.Server
+	if srv.config.ManagementListen != "" {
+		bound, err := srv.listenOn(srv.config.ManagementListen)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return err
+		}
+		srv.logger.Info("Management listener starting", "addr", srv.config.ManagementListen)
+		managementServer = &http.Server{Handler: srv.managementHandler(), ConnContext: markUnixConn}
+		for _, listener := range bound {
+			go managementServer.Serve(listener)
+		}
+	}
+
+	httpServer.RegisterOnShutdown(srv.statusStreams.Close)
+	httpServer.RegisterOnShutdown(srv.handoffs.Close)
+
+	stopCleanup := make(chan struct{})
+	cleanupDone := make(chan struct{})
+	go func() {
+		srv.runCleanupWorker(cleanupInterval, stopCleanup)
+		close(cleanupDone)
+	}()
+
+	serveErr := make(chan error, len(listeners))
+	for _, listener := range listeners {
+		go func(listener net.Listener) {
+			serveErr <- httpServer.Serve(listener)
+		}(listener)
+	}
+
+	if err := sdNotify("READY=1"); err != nil {
+		srv.logger.Warn("Failed to notify systemd", "error", err)
+	}
+	watchdogCtx, stopWatchdog := context.WithCancel(ctx)
+	defer stopWatchdog()
+	if interval := sdWatchdogInterval(); interval > 0 {
+		go srv.runWatchdog(watchdogCtx, interval)
+	}
+
+	select {
+	case err = <-serveErr:
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+		httpServer.Close()
+	case <-ctx.Done():
+		srv.logger.Info("Shutting down server")
+		srv.shuttingDown.Store(true)
+		sdNotify("STOPPING=1")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+		defer cancel()
+		err = httpServer.Shutdown(shutdownCtx)
+	}
+	// Closed last, so /readyz keeps answering 503 while the public listeners drain
+	if managementServer != nil {
+		managementServer.Close()
+	}
+
+	close(stopCleanup)
+	<-cleanupDone
+
+	wiped := srv.store.WipeAll()
+	srv.logger.Info("Wiped secrets from memory", "count", wiped)
+
+	return err
+}
+
+// Close stops delivering notifications and bus events, waiting for queued ones to be sent, and
+// closes the audit log
+func (srv *Server) Close() {
+	srv.statusStreams.Close()
+	srv.handoffs.Close()
+	srv.webhooks.Close()
+	if srv.scanAlerts != nil {
+		srv.scanAlerts.Close()
+	}
+	if srv.emailNotifier != nil {
+		srv.emailNotifier.Close()
+	}
+	srv.auditLog.Close()
+	srv.eventBus.Close()
+}
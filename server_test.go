@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestServer_InstancesAreIsolated(t *testing.T) {
+	t.Parallel()
+	first := newTestServer(t)
+	second := newTestServer(t, func(cfg *Config) { cfg.AdminAPIKey = testAdminKey })
+
+	id, err := first.store.Store("encrypted", time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to store secret: %v", err)
+	}
+
+	req := mux.SetURLVars(httptest.NewRequest("GET", "/api/secrets/"+id, nil), map[string]string{"id": id})
+	w := httptest.NewRecorder()
+	second.getSecretHandler(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected a secret to be invisible to another server, got %d", w.Code)
+	}
+
+	// Only the second server has the admin API enabled
+	for _, tt := range []struct {
+		srv      *Server
+		expected int
+	}{{first, http.StatusNotFound}, {second, http.StatusOK}} {
+		req := httptest.NewRequest("GET", "/admin/api/stats", nil)
+		req.Header.Set("Authorization", "Bearer "+testAdminKey)
+		w := httptest.NewRecorder()
+		tt.srv.routes().ServeHTTP(w, req)
+		if w.Code != tt.expected {
+			t.Errorf("Expected admin stats to return %d, got %d", tt.expected, w.Code)
+		}
+	}
+}
+
+func TestNewServer_InvalidConfig(t *testing.T) {
+	t.Parallel()
+	cfg := DefaultConfig()
+	cfg.EncryptionKey = []byte("short")
+	if _, err := NewServer(cfg, nil); err == nil {
+		t.Error("Expected error for an invalid encryption key")
+	}
+}
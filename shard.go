@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/sha256"
+	"hash/maphash"
+	"sync"
+	"time"
+)
+
+// StoreShards is the number of independently locked partitions in a SecretStore.
+// Creates and reads of different secrets only contend when their IDs hash to the same shard.
+const StoreShards = 32
+
+// secretKey is the SHA-256 of a secret ID. Shards are keyed by it rather than the ID, so map
+// lookups compare hashes of the requested ID instead of the ID itself, and how long a lookup
+// takes reveals nothing about how much of a guessed ID matches a stored one.
+type secretKey [32]byte
+
+func keyOf(id string) secretKey {
+	return sha256.Sum256([]byte(id))
+}
+
+// storeShard is one partition of a SecretStore, holding the secrets and tombstones whose IDs hash to it
+type storeShard struct {
+	mu             sync.Mutex
+	secrets        map[secretKey]*Secret
+	tombstones     map[secretKey]*tombstone
+	tombstoneOrder []secretKey // Tombstone keys, oldest first
+	maxTombstones  int
+	retained       map[secretKey]*retainedSecret // Read secrets kept for the read grace period
+	expiries       expiryQueue                   // Expiry and reminder times of the secrets, soonest first
+	claimed        map[secretKey]bool            // IDs of creates still sealing or offloading their content
+}
+
+// newStoreShard creates a shard with room for its share of the default unread limit, so a
+// filling store doesn't grow the map on the request path
+func newStoreShard(maxSecrets, maxTombstones int) *storeShard {
+	return &storeShard{
+		secrets:       make(map[secretKey]*Secret, maxSecrets),
+		tombstones:    make(map[secretKey]*tombstone),
+		retained:      make(map[secretKey]*retainedSecret),
+		claimed:       make(map[secretKey]bool),
+		maxTombstones: maxTombstones,
+	}
+}
+
+// shardFor returns the shard responsible for id
+func (s *SecretStore) shardFor(id string) *storeShard {
+	return s.shards[maphash.String(s.seed, id)%uint64(len(s.shards))]
+}
+
+// claimID holds key for a create until it inserts its secret or gives up, so a concurrent
+// create of the same ID fails before it seals or offloads anything. Returns false when the ID
+// is in use or held.
+func (sh *storeShard) claimID(key secretKey) bool {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if _, taken := sh.secrets[key]; taken || sh.claimed[key] {
+		return false
+	}
+	sh.claimed[key] = true
+	return true
+}
+
+// unclaimID releases an ID claimID held
+func (sh *storeShard) unclaimID(key secretKey) {
+	sh.mu.Lock()
+	delete(sh.claimed, key)
+	sh.mu.Unlock()
+}
+
+// recordTombstone stores the final state, evicting the shard's oldest entries once its share
+// of MaxTombstones is reached. Must be called with sh.mu held.
+func (sh *storeShard) recordTombstone(id string, t *tombstone) {
+	for len(sh.tombstoneOrder) >= sh.maxTombstones {
+		sh.dropOldestTombstone()
+	}
+	key := keyOf(id)
+	sh.tombstones[key] = t
+	sh.tombstoneOrder = append(sh.tombstoneOrder, key)
+}
+
+// dropOldestTombstone removes the oldest remembered status. Must be called with sh.mu held.
+func (sh *storeShard) dropOldestTombstone() {
+	key := sh.tombstoneOrder[0]
+	sh.tombstoneOrder = sh.tombstoneOrder[1:]
+	delete(sh.tombstones, key)
+}
+
+// pruneTombstones forgets statuses older than TombstoneRetention. Must be called with sh.mu held.
+func (sh *storeShard) pruneTombstones(now time.Time) {
+	for len(sh.tombstoneOrder) > 0 {
+		t, ok := sh.tombstones[sh.tombstoneOrder[0]]
+		if ok && now.Sub(t.recorded) < TombstoneRetention {
+			return
+		}
+		sh.dropOldestTombstone()
+	}
+}
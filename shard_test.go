@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSecretStore_ConcurrentReadsReturnOnce(t *testing.T) {
+	store := NewSecretStore()
+
+	for i := 0; i < 100; i++ {
+		id, err := store.Store("secret", time.Hour)
+		if err != nil {
+			t.Fatalf("Failed to store secret: %v", err)
+		}
+
+		var reads atomic.Int32
+		var wg sync.WaitGroup
+		for j := 0; j < 8; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, found := store.Get(id); found {
+					reads.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if reads.Load() != 1 {
+			t.Fatalf("Expected exactly one successful read, got %d", reads.Load())
+		}
+	}
+}
+
+func TestSecretStore_ConcurrentCreatesRespectLimit(t *testing.T) {
+	store := NewSecretStore()
+	limits := store.Limits()
+	limits.MaxUnreadSecrets = 50
+	store.SetLimits(limits)
+
+	var stored atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := store.Store("secret", time.Hour); err == nil {
+				stored.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if stored.Load() != 50 || store.Count() != 50 {
+		t.Errorf("Expected exactly 50 secrets stored, got %d (count %d)", stored.Load(), store.Count())
+	}
+}
+
+func TestSecretStore_ShardsCoverAllSecrets(t *testing.T) {
+	store := NewSecretStore()
+
+	for i := 0; i < 200; i++ {
+		store.Store("secret", time.Hour)
+	}
+	store.Store("expired", -time.Minute)
+
+	if stats := store.Stats(); stats.Count != 201 {
+		t.Errorf("Expected stats to count 201 secrets across shards, got %d", stats.Count)
+	}
+	if cleaned := store.CleanupExpired(); cleaned != 1 {
+		t.Errorf("Expected 1 expired secret cleaned, got %d", cleaned)
+	}
+	if wiped := store.WipeAll(); wiped != 200 {
+		t.Errorf("Expected 200 secrets wiped, got %d", wiped)
+	}
+	if store.Count() != 0 {
+		t.Errorf("Expected empty store, got %d", store.Count())
+	}
+}
+
+// BenchmarkSecretStore_CreateRead compares a single lock (shards=1) with the sharded store
+// under parallel create-then-read load, the pattern of a busy instance
+func BenchmarkSecretStore_CreateRead(b *testing.B) {
+	for _, shards := range []int{1, StoreShards} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			store := newShardedSecretStore(shards)
+			limits := store.Limits()
+			limits.MaxUnreadSecrets = 1 << 30
+			store.SetLimits(limits)
+
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					id, err := store.Store("encrypted content", time.Hour)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if _, found := store.Get(id); !found {
+						b.Fatal("secret not found")
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkSecretStore_Status measures read-mostly traffic against a populated store
+func BenchmarkSecretStore_Status(b *testing.B) {
+	for _, shards := range []int{1, StoreShards} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			store := newShardedSecretStore(shards)
+			ids := make([]string, MaxUnreadSecrets)
+			for i := range ids {
+				ids[i], _ = store.Store("encrypted content", time.Hour)
+			}
+
+			var next atomic.Uint64
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					store.Status(ids[next.Add(1)%uint64(len(ids))])
+				}
+			})
+		})
+	}
+}
+
+// newBenchmarkStore returns a sharded store without an unread limit, so benchmarks can fill it
+func newBenchmarkStore() *SecretStore {
+	store := NewSecretStore()
+	limits := store.Limits()
+	limits.MaxUnreadSecrets = 1 << 30
+	store.SetLimits(limits)
+	return store
+}
+
+// BenchmarkSecretStore_Store measures parallel creates. Generating IDs with crypto/rand.Int
+// cost 54 allocations per create; reading random bytes in pooled batches brought it to 5.
+func BenchmarkSecretStore_Store(b *testing.B) {
+	store := newBenchmarkStore()
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := store.Store("encrypted content", time.Hour); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkSecretStore_Get measures parallel reads of distinct secrets stored beforehand
+func BenchmarkSecretStore_Get(b *testing.B) {
+	store := newBenchmarkStore()
+	ids := make([]string, b.N)
+	for i := range ids {
+		ids[i], _ = store.Store("encrypted content", time.Hour)
+	}
+
+	var next atomic.Int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, found := store.Get(ids[next.Add(1)-1]); !found {
+				b.Fatal("secret not found")
+			}
+		}
+	})
+}
+
+// BenchmarkSecretStore_CleanupExpired measures cleanup sweeps of a full store while other
+// goroutines sweep too, each holding one shard's lock at a time
+func BenchmarkSecretStore_CleanupExpired(b *testing.B) {
+	store := NewSecretStore()
+	for i := 0; i < MaxUnreadSecrets; i++ {
+		store.Store("encrypted content", time.Hour)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			store.CleanupExpired()
+		}
+	})
+}
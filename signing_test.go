@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testLinkSigningKey = "test-link-signing-key-0123456789abcdef"
+
+func TestSignedLinks(t *testing.T) {
+	_, server := setupTestServer(t, func(cfg *Config) { cfg.LinkSigningKey = testLinkSigningKey })
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/api/secrets", "application/json", strings.NewReader(`{"content": "encrypted"}`))
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	var created CreateSecretResponse
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+
+	id, signature, found := strings.Cut(created.ID, LinkSignatureSeparator)
+	if !found || signature == "" {
+		t.Fatalf("Expected a signed ID, got %q", created.ID)
+	}
+
+	for name, path := range map[string]string{
+		"unsigned":      "/api/secrets/" + id,
+		"altered":       "/api/secrets/" + id + LinkSignatureSeparator + strings.Repeat("A", len(signature)),
+		"unsigned view": "/s/" + id,
+	} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", name, resp.StatusCode)
+		}
+	}
+
+	resp, err = http.Get(server.URL + "/s/" + created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the signed link's view page, got %d", resp.StatusCode)
+	}
+
+	resp, err = claimSecretHTTP(server.URL, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var secret GetSecretResponse
+	json.NewDecoder(resp.Body).Decode(&secret)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || secret.Content != "encrypted" {
+		t.Errorf("Expected the signed ID to read the secret, got %d %+v", resp.StatusCode, secret)
+	}
+}
+
+func TestLoadConfig_LinkSigningKeyLength(t *testing.T) {
+	if _, err := loadConfig([]string{"--link-signing-key", "short"}, envMap(nil)); err == nil {
+		t.Error("Expected a short link signing key to be rejected")
+	}
+	if _, err := loadConfig(nil, envMap(map[string]string{"LINK_SIGNING_KEY": testLinkSigningKey})); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	MinSlugLength = 3
+	MaxSlugLength = 64
+)
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*[a-z0-9]$`)
+
+// reservedSlugs can't be chosen as custom IDs: path segments of the server's own routes, and
+// words a link could be mistaken for an official page by. Operators add their own with
+// RESERVED_SLUGS.
+var reservedSlugs = map[string]bool{
+	"admin": true, "api": true, "auth": true, "batch": true, "chunks": true, "claim": true,
+	"config": true, "demo": true, "docs": true, "events": true, "healthz": true, "help": true,
+	"live": true, "login": true, "logout": true, "lookup": true, "mine": true, "new": true,
+	"readyz": true, "report": true, "retry": true, "share": true, "static": true, "status": true,
+	"support": true, "www": true,
+}
+
+// validSlug reports whether id, optionally scoped to a tenant, has the form of a custom slug:
+// lowercase letters, digits and inner hyphens
+func validSlug(id string) bool {
+	if tenant, rest, found := strings.Cut(id, TenantSeparator); found {
+		if !tenantNamePattern.MatchString(tenant) {
+			return false
+		}
+		id = rest
+	}
+	return len(id) >= MinSlugLength && len(id) <= MaxSlugLength && slugPattern.MatchString(id)
+}
+
+// slugReserved reports whether slug is reserved by the server or the operator
+func (srv *Server) slugReserved(slug string) bool {
+	if reservedSlugs[slug] {
+		return true
+	}
+	for _, reserved := range srv.config.ReservedSlugs {
+		if slug == reserved {
+			return true
+		}
+	}
+	return false
+}
+
+// reserveSlug checks a custom slug requested by the creator of r and returns the ID to store
+// the secret under. Slugs are predictable by design, so only creators with an API key or a
+// single sign-on session may choose one. A slug still known to the store, even as the
+// tombstone of a finished secret, is taken, so a new secret never reports an old one's status.
+func (srv *Server) reserveSlug(r *http.Request, apiKey *APIKey, tenant, slug string) (string, *requestError) {
+	if apiKey == nil {
+		if _, signedIn := srv.requestIdentity(r); !signedIn {
+			return "", &requestError{Code: http.StatusForbidden, Key: "error.slug_login_required"}
+		}
+	}
+	if !validSlug(slug) {
+		return "", &requestError{Code: http.StatusBadRequest, Key: "error.slug_invalid", Args: []any{MinSlugLength, MaxSlugLength}}
+	}
+	if srv.slugReserved(slug) {
+		return "", &requestError{Code: http.StatusBadRequest, Key: "error.slug_reserved"}
+	}
+
+	id := slug
+	if tenant != "" {
+		id = tenant + TenantSeparator + slug
+	}
+	if srv.store.idTaken(id) || srv.abuse.Blocked(BlockByID, id) {
+		return "", &requestError{Code: http.StatusConflict, Key: "error.slug_taken"}
+	}
+	return id, nil
+}
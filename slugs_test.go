@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCreateSecretHandler_Slug(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.ReservedSlugs = []string{"payroll"} })
+	_, token := srv.apiKeys.Create("onboarding", "", APIKeyLimits{})
+	router := srv.routes()
+
+	create := func(slug string, authorized bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/secrets", strings.NewReader(`{"content": "encrypted", "slug": "`+slug+`"}`))
+		if authorized {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := create("Welcome-Kit-42", true)
+	var created CreateSecretResponse
+	json.NewDecoder(w.Body).Decode(&created)
+	if w.Code != http.StatusOK || created.ID != "welcome-kit-42" {
+		t.Fatalf("Expected the lowercased slug as ID, got %d %q", w.Code, created.ID)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/secrets/welcome-kit-42", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected the slug to be found, got %d", w.Code)
+	}
+
+	for _, tt := range []struct {
+		slug       string
+		authorized bool
+		want       int
+		code       string
+	}{
+		{"welcome-kit-42", true, http.StatusConflict, "slug_taken"},
+		{"team-handover", false, http.StatusForbidden, "slug_login_required"},
+		{"admin", true, http.StatusBadRequest, "slug_reserved"},
+		{"payroll", true, http.StatusBadRequest, "slug_reserved"},
+		{"-edge", true, http.StatusBadRequest, "slug_invalid"},
+		{"no_underscores", true, http.StatusBadRequest, "slug_invalid"},
+		{"ab", true, http.StatusBadRequest, "slug_invalid"},
+	} {
+		w := create(tt.slug, tt.authorized)
+		var body ErrorResponse
+		json.NewDecoder(w.Body).Decode(&body)
+		if w.Code != tt.want || body.Code != tt.code {
+			t.Errorf("%q: expected %d %s, got %d %s", tt.slug, tt.want, tt.code, w.Code, body.Code)
+		}
+	}
+}
+
+func TestCreateSecretHandler_SlugOfFinishedSecret(t *testing.T) {
+	srv := newTestServer(t)
+	_, token := srv.apiKeys.Create("onboarding", "", APIKeyLimits{})
+	id, _ := srv.store.StoreWithOptions("encrypted", time.Hour, SecretOptions{ID: "pickup"})
+	srv.store.Get(id)
+
+	// The tombstone keeps the slug, so a new secret can't inherit the old one's read status
+	req := httptest.NewRequest("POST", "/api/secrets", strings.NewReader(`{"content": "encrypted", "slug": "pickup"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	srv.routes().ServeHTTP(w, req)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for the slug of a read secret, got %d", w.Code)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	SMSTwilio = "twilio"
+	SMSVonage = "vonage"
+
+	SMSRequestTimeout = 10 * time.Second
+	DefaultSMSLimit   = 10 // PIN texts per client network and DeliveryWindow
+)
+
+// phoneNumberPattern matches E.164 numbers, the format both providers expect
+var phoneNumberPattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// SMSConfig selects the provider pickup PINs are texted through
+type SMSConfig struct {
+	Provider  string // twilio or vonage; empty disables texting
+	AccountID string // Twilio account SID or Vonage API key
+	Token     string // Twilio auth token or Vonage API secret
+	From      string // Sender number or alphanumeric sender ID
+	Limit     int    // PIN texts per client network and DeliveryWindow
+}
+
+// Enabled reports whether an SMS provider is configured
+func (c SMSConfig) Enabled() bool {
+	return c.Provider != ""
+}
+
+// Validate checks the provider is known and has its credentials
+func (c SMSConfig) Validate() error {
+	if c.Provider != SMSTwilio && c.Provider != SMSVonage {
+		return fmt.Errorf("unknown sms-provider %q (expected %s or %s)", c.Provider, SMSTwilio, SMSVonage)
+	}
+	if c.AccountID == "" || c.Token == "" || c.From == "" {
+		return fmt.Errorf("sms-account, sms-token and sms-from are required for sms-provider %s", c.Provider)
+	}
+	if c.Limit < 1 {
+		return errors.New("sms-limit must be positive")
+	}
+	return nil
+}
+
+// Messenger sends a text message to a phone number
+type Messenger interface {
+	Send(ctx context.Context, to, body string) error
+}
+
+// NewMessenger creates the messenger for the configured provider
+func NewMessenger(config SMSConfig) (Messenger, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: SMSRequestTimeout}
+	if config.Provider == SMSTwilio {
+		return &twilioMessenger{config: config, client: client}, nil
+	}
+	return &vonageMessenger{config: config, client: client}, nil
+}
+
+// validatePhoneNumber checks that number is in E.164 format, e.g. +14155550123
+func validatePhoneNumber(number string) error {
+	if !phoneNumberPattern.MatchString(number) {
+		return errors.New("pin_phone must be an E.164 phone number such as +14155550123")
+	}
+	return nil
+}
+
+// postSMSForm posts form to endpoint and decodes a 2xx JSON response into out
+func postSMSForm(ctx context.Context, client *http.Client, endpoint string, form url.Values, setAuth func(*http.Request), out any) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if setAuth != nil {
+		setAuth(req)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("sms provider returned status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// twilioMessenger sends texts through the Twilio Messages API
+type twilioMessenger struct {
+	config SMSConfig
+	client *http.Client
+	url    string // Overrides the API endpoint in tests
+}
+
+func (m *twilioMessenger) Send(ctx context.Context, to, body string) error {
+	endpoint := m.url
+	if endpoint == "" {
+		endpoint = "https://api.twilio.com"
+	}
+	endpoint += "/2010-04-01/Accounts/" + url.PathEscape(m.config.AccountID) + "/Messages.json"
+	form := url.Values{"To": {to}, "From": {m.config.From}, "Body": {body}}
+
+	var resp struct {
+		SID string `json:"sid"`
+	}
+	return postSMSForm(ctx, m.client, endpoint, form, func(req *http.Request) {
+		req.SetBasicAuth(m.config.AccountID, m.config.Token)
+	}, &resp)
+}
+
+// vonageMessenger sends texts through the Vonage SMS API, which reports failures per message
+// in a 200 response
+type vonageMessenger struct {
+	config SMSConfig
+	client *http.Client
+	url    string // Overrides the API endpoint in tests
+}
+
+func (m *vonageMessenger) Send(ctx context.Context, to, body string) error {
+	endpoint := m.url
+	if endpoint == "" {
+		endpoint = "https://rest.nexmo.com"
+	}
+	form := url.Values{
+		"api_key":    {m.config.AccountID},
+		"api_secret": {m.config.Token},
+		"from":       {m.config.From},
+		"to":         {strings.TrimPrefix(to, "+")},
+		"text":       {body},
+		"type":       {"unicode"},
+	}
+
+	var resp struct {
+		Messages []struct {
+			Status    string `json:"status"`
+			ErrorText string `json:"error-text"`
+		} `json:"messages"`
+	}
+	if err := postSMSForm(ctx, m.client, endpoint+"/sms/json", form, nil, &resp); err != nil {
+		return err
+	}
+	for _, message := range resp.Messages {
+		if message.Status != "0" {
+			return fmt.Errorf("vonage rejected the message: %s (status %s)", message.ErrorText, message.Status)
+		}
+	}
+	return nil
+}
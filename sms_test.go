@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTwilioMessenger(t *testing.T) {
+	var form map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if r.URL.Path != "/2010-04-01/Accounts/AC123/Messages.json" || user != "AC123" || pass != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		r.ParseForm()
+		form = map[string]string{"To": r.PostForm.Get("To"), "From": r.PostForm.Get("From"), "Body": r.PostForm.Get("Body")}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"sid": "SM1"}`))
+	}))
+	defer server.Close()
+
+	messenger, err := NewMessenger(SMSConfig{Provider: SMSTwilio, AccountID: "AC123", Token: "token", From: "+15005550006", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messenger.(*twilioMessenger).url = server.URL
+	if err := messenger.Send(context.Background(), "+14155550123", "PIN 123456"); err != nil {
+		t.Fatalf("Expected the text to be sent, got %v", err)
+	}
+	if form["To"] != "+14155550123" || form["From"] != "+15005550006" || form["Body"] != "PIN 123456" {
+		t.Errorf("Unexpected message: %v", form)
+	}
+}
+
+func TestVonageMessenger(t *testing.T) {
+	status := "0"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.URL.Path != "/sms/json" || r.PostForm.Get("api_key") != "key" || r.PostForm.Get("to") != "14155550123" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"messages": []map[string]string{{"status": status, "error-text": "Throttled"}}})
+	}))
+	defer server.Close()
+
+	messenger, err := NewMessenger(SMSConfig{Provider: SMSVonage, AccountID: "key", Token: "secret", From: "PicoSend", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messenger.(*vonageMessenger).url = server.URL
+	if err := messenger.Send(context.Background(), "+14155550123", "PIN"); err != nil {
+		t.Fatalf("Expected the text to be sent, got %v", err)
+	}
+	status = "1"
+	if err := messenger.Send(context.Background(), "+14155550123", "PIN"); err == nil || !strings.Contains(err.Error(), "Throttled") {
+		t.Errorf("Expected a rejected message to fail, got %v", err)
+	}
+}
+
+// fakeMessenger records texts instead of sending them
+type fakeMessenger struct {
+	sent []string
+	err  error
+}
+
+func (m *fakeMessenger) Send(ctx context.Context, to, body string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, to+": "+body)
+	return nil
+}
+
+func TestCreateSecret_PINPhone(t *testing.T) {
+	srv := newTestServer(t)
+	messenger := &fakeMessenger{}
+	srv.messenger, srv.smsLimits = messenger, NewDeliveryLimiter(2, time.Hour)
+	router := srv.routes()
+
+	create := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("POST", "/api/secrets", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := create(`{"content": "encrypted", "pin_phone": "+14155550123"}`)
+	var created CreateSecretResponse
+	json.NewDecoder(rec.Body).Decode(&created)
+	if rec.Code != http.StatusOK || created.PIN != "" {
+		t.Fatalf("Expected the secret to be created without returning the PIN, got %d %+v", rec.Code, created)
+	}
+	if len(messenger.sent) != 1 || !strings.HasPrefix(messenger.sent[0], "+14155550123: Your PicoSend pickup PIN is ") {
+		t.Fatalf("Expected the PIN to be texted, got %v", messenger.sent)
+	}
+	if secret, _ := srv.store.Peek(created.ID); secret == nil || secret.PIN == nil {
+		t.Error("Expected a texted PIN to be required")
+	}
+
+	if rec := create(`{"content": "encrypted", "pin_phone": "4155550123"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a number without a country code to be rejected, got %d", rec.Code)
+	}
+
+	messenger.err = errors.New("provider down")
+	before := srv.store.Count()
+	if rec := create(`{"content": "encrypted", "pin_phone": "+14155550123"}`); rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 when the text fails, got %d", rec.Code)
+	}
+	if srv.store.Count() != before {
+		t.Error("Expected no secret to be stored when the PIN couldn't be texted")
+	}
+
+	if rec := create(`{"content": "encrypted", "pin_phone": "+14155550123"}`); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the text limit to apply, got %d", rec.Code)
+	}
+}
+
+func TestLoadConfig_SMS(t *testing.T) {
+	if _, err := loadConfig([]string{"--sms-provider", "pigeon"}, envMap(nil)); err == nil {
+		t.Error("Expected an unknown SMS provider to be rejected")
+	}
+	if _, err := loadConfig(nil, envMap(map[string]string{"SMS_PROVIDER": "twilio", "SMS_ACCOUNT": "AC123"})); err == nil {
+		t.Error("Expected missing SMS credentials to be rejected")
+	}
+	cfg, err := loadConfig(nil, envMap(map[string]string{"SMS_PROVIDER": "vonage", "SMS_ACCOUNT": "key", "SMS_TOKEN": "secret", "SMS_FROM": "PicoSend"}))
+	if err != nil || !cfg.SMS.Enabled() {
+		t.Errorf("Expected SMS to be enabled, got %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	MaxStatusStreams        = 1000             // Maximum number of concurrently open status streams
+	StatusStreamKeepAlive   = 30 * time.Second // Interval of comment lines that keep idle proxies from closing the stream
+	StatusStreamRetryMillis = 5000             // Reconnect delay suggested to EventSource clients
+)
+
+// StatusStreams fans secret events out to the open status streams watching each secret
+type StatusStreams struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan struct{}]struct{}
+	open        int
+	done        chan struct{}
+	closeOnce   sync.Once
+}
+
+func NewStatusStreams() *StatusStreams {
+	return &StatusStreams{
+		subscribers: make(map[string]map[chan struct{}]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// HandleEvent wakes the streams watching the event's secret. It never blocks, as the store
+// calls it with a shard lock held; streams re-read the status when woken.
+func (s *StatusStreams) HandleEvent(event SecretEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subscribers[event.ID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// subscribe registers a stream for id. Returns false when MaxStatusStreams are already open.
+func (s *StatusStreams) subscribe(id string) (chan struct{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.open >= MaxStatusStreams {
+		return nil, false
+	}
+
+	ch := make(chan struct{}, 1)
+	if s.subscribers[id] == nil {
+		s.subscribers[id] = make(map[chan struct{}]struct{})
+	}
+	s.subscribers[id][ch] = struct{}{}
+	s.open++
+	return ch, true
+}
+
+func (s *StatusStreams) unsubscribe(id string, ch chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subscribers[id], ch)
+	if len(s.subscribers[id]) == 0 {
+		delete(s.subscribers, id)
+	}
+	s.open--
+}
+
+// Close ends all open streams, so they don't hold up a graceful shutdown
+func (s *StatusStreams) Close() {
+	s.closeOnce.Do(func() { close(s.done) })
+}
+
+// secretEventsHandler streams the status of a secret as Server-Sent Events. A "status" event
+// with the same body as the status endpoint is sent immediately and after every change; the
+// stream ends once the secret is read, expired or burned.
+func (srv *Server) secretEventsHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	state, found := srv.store.Status(id)
+	if !found {
+		localizedError(w, r, http.StatusNotFound, "error.not_found")
+		return
+	}
+
+	var changed chan struct{}
+	if state.Status == StatusUnread {
+		var ok bool
+		if changed, ok = srv.statusStreams.subscribe(id); !ok {
+			w.Header().Set("Retry-After", "30")
+			apiError(w, r, http.StatusServiceUnavailable, "Too many open status streams")
+			return
+		}
+		defer srv.statusStreams.unsubscribe(id, changed)
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Stop nginx from buffering the stream
+	fmt.Fprintf(w, "retry: %d\n\n", StatusStreamRetryMillis)
+
+	keepAlive := time.NewTicker(StatusStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		data, _ := json.Marshal(srv.secretStatusResponse(state))
+		fmt.Fprintf(w, "event: status\ndata: %s\n\n", data)
+		if err := rc.Flush(); err != nil || state.Status != StatusUnread {
+			return
+		}
+
+		// Expiry is otherwise only noticed by the cleanup worker, so check at the deadline
+		expiry := time.NewTimer(time.Until(state.ExpiresAt) + time.Millisecond)
+		waiting := true
+		for waiting {
+			select {
+			case <-changed:
+				waiting = false
+			case <-expiry.C:
+				waiting = false
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+				if err := rc.Flush(); err != nil {
+					expiry.Stop()
+					return
+				}
+			case <-r.Context().Done():
+				expiry.Stop()
+				return
+			case <-srv.statusStreams.done:
+				expiry.Stop()
+				return
+			}
+		}
+		expiry.Stop()
+
+		if state, found = srv.store.Status(id); !found {
+			return
+		}
+	}
+}
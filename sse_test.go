@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readStatusEvents collects the status events of a stream until it ends
+func readStatusEvents(t *testing.T, resp *http.Response, events chan<- SecretStatusResponse) {
+	defer close(events)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var status SecretStatusResponse
+		if err := json.Unmarshal([]byte(data), &status); err != nil {
+			t.Errorf("Invalid event data %q: %v", data, err)
+			return
+		}
+		events <- status
+	}
+}
+
+func nextStatusEvent(t *testing.T, events <-chan SecretStatusResponse) SecretStatusResponse {
+	t.Helper()
+	select {
+	case status, ok := <-events:
+		if !ok {
+			t.Fatal("Stream ended early")
+		}
+		return status
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for status event")
+	}
+	return SecretStatusResponse{}
+}
+
+func TestSecretEventsHandler_Read(t *testing.T) {
+	srv, server := setupTestServer(t)
+	defer server.Close()
+
+	id, _ := srv.store.StoreWithOptions("encrypted", time.Hour, SecretOptions{MaxReads: 2})
+
+	resp, err := http.Get(server.URL + "/api/secrets/" + id + "/events")
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected text/event-stream, got %q", resp.Header.Get("Content-Type"))
+	}
+
+	events := make(chan SecretStatusResponse)
+	go readStatusEvents(t, resp, events)
+
+	if status := nextStatusEvent(t, events); status.Status != "unread" || status.ReadsRemaining != 2 {
+		t.Errorf("Expected initial unread status, got %+v", status)
+	}
+
+	srv.store.Get(id)
+	if status := nextStatusEvent(t, events); status.Status != "unread" || status.ReadsRemaining != 1 {
+		t.Errorf("Expected one read remaining, got %+v", status)
+	}
+
+	srv.store.Get(id)
+	if status := nextStatusEvent(t, events); status.Status != "read" {
+		t.Errorf("Expected read status, got %+v", status)
+	}
+
+	if _, ok := <-events; ok {
+		t.Error("Expected the stream to end after the final status")
+	}
+}
+
+func TestSecretEventsHandler_Expiry(t *testing.T) {
+	srv, server := setupTestServer(t)
+	defer server.Close()
+
+	id, _ := srv.store.Store("encrypted", 100*time.Millisecond)
+
+	resp, err := http.Get(server.URL + "/api/secrets/" + id + "/events")
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	events := make(chan SecretStatusResponse)
+	go readStatusEvents(t, resp, events)
+
+	nextStatusEvent(t, events)
+	if status := nextStatusEvent(t, events); status.Status != "expired" {
+		t.Errorf("Expected expired status without waiting for cleanup, got %+v", status)
+	}
+}
+
+func TestSecretEventsHandler_NotFound(t *testing.T) {
+	_, server := setupTestServer(t)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/secrets/missing/events")
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// StaticCacheControl lets browsers keep static assets but revalidate them on every use. Plain
+// asset URLs aren't versioned, so this picks up a new release at once while unchanged files
+// only cost a 304.
+const StaticCacheControl = "public, no-cache"
+
+// FingerprintCacheControl lets browsers keep fingerprinted assets for a year without asking.
+// Their names change with their content, so a new release is picked up through new URLs.
+const FingerprintCacheControl = "public, max-age=31536000, immutable"
+
+// staticFile is a static file held in memory with an ETag and Subresource Integrity hash
+// derived from its content
+type staticFile struct {
+	data        []byte
+	etag        string
+	hash        string // Hex prefix of the SHA-256, used in fingerprinted names
+	integrity   string // SRI value like sha384-...
+	fingerprint bool   // Served under a content-hashed name
+}
+
+// staticHandler serves the embedded static files, overlaid by an optional directory. Embedded
+// files have no modification time, so without ETags browsers would download them again on
+// every page.
+type staticHandler struct {
+	files        map[string]staticFile // Path like static/css/pico.min.css -> file
+	fingerprints map[string]string     // Path -> content-hashed path like static/css/pico.min.1a2b3c4d5e6f.css
+}
+
+// newStaticHandler loads every file in fsys and then in overrideDir, if set, whose files replace
+// embedded files with the same path below static/. Files are read once, so changes on disk
+// need a restart.
+func newStaticHandler(fsys fs.FS, overrideDir string) (*staticHandler, error) {
+	h := &staticHandler{files: map[string]staticFile{}, fingerprints: map[string]string{}}
+	if err := h.load(fsys, ""); err != nil {
+		return nil, err
+	}
+	if overrideDir != "" {
+		if err := h.load(os.DirFS(overrideDir), "static"); err != nil {
+			return nil, err
+		}
+	}
+	h.fingerprint()
+	return h, nil
+}
+
+// fingerprint adds every loaded file under a name with a hash of its content, like
+// static/css/pico.min.1a2b3c4d5e6f.css. Pages link these names, so a cache or proxy that
+// holds on to an old copy can never serve it for a new release.
+func (h *staticHandler) fingerprint() {
+	for name, file := range h.files {
+		if file.fingerprint {
+			continue
+		}
+		ext := path.Ext(name)
+		hashed := strings.TrimSuffix(name, ext) + "." + file.hash + ext
+		file.fingerprint = true
+		h.files[hashed] = file
+		h.fingerprints[name] = hashed
+	}
+}
+
+// asset returns the path of the named file below static/ to link from pages, fingerprinted
+// if it's known, and its integrity hash, empty for unknown files
+func (h *staticHandler) asset(name string) (string, string) {
+	name = "static/" + strings.TrimPrefix(name, "/")
+	hashed, ok := h.fingerprints[name]
+	if !ok {
+		return name, ""
+	}
+	return hashed, h.files[name].integrity
+}
+
+// load adds the files in fsys under prefix
+func (h *staticHandler) load(fsys fs.FS, prefix string) error {
+	return fs.WalkDir(fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		h.files[path.Join(prefix, name)] = newStaticFile(data)
+		return nil
+	})
+}
+
+// setDefault adds a generated file unless one was loaded under the same name
+func (h *staticHandler) setDefault(name string, data []byte) {
+	if _, exists := h.files[name]; !exists {
+		h.files[name] = newStaticFile(data)
+	}
+}
+
+func newStaticFile(data []byte) staticFile {
+	sum := sha256.Sum256(data)
+	sri := sha512.Sum384(data)
+	return staticFile{
+		data:      data,
+		etag:      `"` + base64.RawURLEncoding.EncodeToString(sum[:12]) + `"`,
+		hash:      hex.EncodeToString(sum[:6]),
+		integrity: "sha384-" + base64.StdEncoding.EncodeToString(sri[:]),
+	}
+}
+
+// ServeHTTP serves the file named by the request path, relative to the router's root
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.serve(w, r, strings.TrimPrefix(r.URL.Path, "/"))
+}
+
+// serve writes the named file, or 304 when the client's copy is current. Directories are not listed.
+func (h *staticHandler) serve(w http.ResponseWriter, r *http.Request, name string) {
+	file, ok := h.files[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("ETag", file.etag)
+	if file.fingerprint {
+		w.Header().Set("Cache-Control", FingerprintCacheControl)
+	} else {
+		w.Header().Set("Cache-Control", StaticCacheControl)
+	}
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(file.data))
+}
@@ -0,0 +1,206 @@
+// picosend JavaScript SDK: create and read secrets from a page or from Node.js 19+, with the
+// same end-to-end encryption as the web interface. Content is encrypted with AES-256-CBC and a
+// random key before it is sent; the key only ever travels in the link's fragment.
+//
+//     <script src="https://picosend.example.com/static/js/picosend-sdk.js"></script>
+//     const client = new Picosend.Client();
+//     const { link } = await client.createSecret("hunter2", { lifetime: 60 });
+//     const { plaintext } = await client.readSecret(link);
+//
+// Pages on another origin must be listed in the server's CORS_ORIGINS.
+
+(function (root) {
+    "use strict";
+
+    const SDK_PATH = "/static/js/picosend-sdk.js";
+
+    // The server the script was loaded from, so a plain script tag needs no configuration
+    const scriptBase = (() => {
+        const script = typeof document !== "undefined" ? document.currentScript : null;
+        if (!script || !script.src.endsWith(SDK_PATH)) return "";
+        return script.src.slice(0, -SDK_PATH.length);
+    })();
+
+    // Error thrown for failed requests, with the HTTP status and the server's message
+    // status is the HTTP status, 0 for errors raised before a request; code and requestId come
+    // from the server's error response
+    class PicosendError extends Error {
+        constructor(status, message, code = "", requestId = "") {
+            super(message);
+            this.name = "PicosendError";
+            this.status = status;
+            this.code = code;
+            this.requestId = requestId;
+        }
+    }
+
+    // Convert between bytes and standard base64 in pieces, as spreading a large array into
+    // String.fromCharCode overflows the stack
+    function toBase64(bytes) {
+        let binary = "";
+        for (let i = 0; i < bytes.length; i += 0x8000) {
+            binary += String.fromCharCode(...bytes.subarray(i, i + 0x8000));
+        }
+        return btoa(binary);
+    }
+
+    function fromBase64(text) {
+        return Uint8Array.from(atob(text), (c) => c.charCodeAt(0));
+    }
+
+    // Generate a random 256-bit key, base64 encoded as it appears in links
+    function generateKey() {
+        return toBase64(crypto.getRandomValues(new Uint8Array(32)));
+    }
+
+    // Encrypt text with a base64 key. The result is the base64 IV followed by the ciphertext,
+    // the content format the server stores.
+    async function encrypt(plaintext, keyBase64) {
+        const key = await crypto.subtle.importKey("raw", fromBase64(keyBase64), { name: "AES-CBC" }, false, ["encrypt"]);
+        const iv = crypto.getRandomValues(new Uint8Array(16));
+        const encrypted = new Uint8Array(await crypto.subtle.encrypt({ name: "AES-CBC", iv: iv }, key, new TextEncoder().encode(plaintext)));
+        const combined = new Uint8Array(iv.length + encrypted.length);
+        combined.set(iv);
+        combined.set(encrypted, iv.length);
+        return toBase64(combined);
+    }
+
+    // Decrypt content produced by encrypt
+    async function decrypt(contentBase64, keyBase64) {
+        const key = await crypto.subtle.importKey("raw", fromBase64(keyBase64), { name: "AES-CBC" }, false, ["decrypt"]);
+        const combined = fromBase64(contentBase64);
+        const decrypted = await crypto.subtle.decrypt({ name: "AES-CBC", iv: combined.slice(0, 16) }, key, combined.slice(16));
+        return new TextDecoder().decode(decrypted);
+    }
+
+    // Hash a passphrase the way the web interface does, so the server never sees it
+    async function hashPassphrase(passphrase) {
+        const digest = await crypto.subtle.digest("SHA-256", new TextEncoder().encode(passphrase));
+        return toBase64(new Uint8Array(digest));
+    }
+
+    // Find the number whose SHA-256 with the token has the required leading zero bits
+    async function solveProofOfWork(token, difficulty) {
+        const encoder = new TextEncoder();
+        for (let n = 0; ; n++) {
+            const digest = new Uint8Array(await crypto.subtle.digest("SHA-256", encoder.encode(token + ":" + n)));
+            let zeros = 0;
+            for (const b of digest) {
+                zeros += b === 0 ? 8 : Math.clz32(b) - 24;
+                if (b !== 0) break;
+            }
+            if (zeros >= difficulty) return String(n);
+        }
+    }
+
+    // Split a link into the secret ID and the key in its fragment
+    function parseLink(link) {
+        const url = new URL(link);
+        const id = url.pathname.split("/").filter(Boolean).pop();
+        const key = decodeURIComponent(url.hash.slice(1));
+        if (!id || !key) throw new PicosendError(0, "The link is missing the secret ID or key");
+        return { id: id, key: key };
+    }
+
+    class Client {
+        // baseURL defaults to the server the script was loaded from; apiKey is sent when creating
+        constructor({ baseURL, apiKey } = {}) {
+            this.baseURL = (baseURL || scriptBase || (typeof location !== "undefined" ? location.origin : "")).replace(/\/+$/, "");
+            this.apiKey = apiKey || "";
+        }
+
+        async request(method, path, body, token) {
+            const headers = {};
+            if (body !== undefined) headers["Content-Type"] = "application/json";
+            if (token) headers.Authorization = "Bearer " + token;
+            const response = await fetch(this.baseURL + path, {
+                method: method,
+                headers: headers,
+                body: body === undefined ? undefined : JSON.stringify(body),
+            });
+            if (!response.ok) {
+                const error = await response.json().catch(() => ({}));
+                throw new PicosendError(response.status, error.error || response.statusText, error.code, error.request_id);
+            }
+            return response.status === 204 ? null : response.json();
+        }
+
+        // Encrypt plaintext and store it. Options are the fields of POST /api/secrets in
+        // camelCase, such as lifetime (minutes), maxReads, requirePIN or allowedIPs, plus
+        // passphrase, which is hashed before it is sent. Returns the link to send, the ID, the
+        // management token and the pickup PIN, if one was requested.
+        async createSecret(plaintext, options = {}) {
+            const { passphrase, ...fields } = options;
+            const key = generateKey();
+            const body = { content: await encrypt(plaintext, key) };
+            for (const [name, value] of Object.entries(fields)) {
+                body[name.replace(/[A-Z]+/g, (c) => "_" + c.toLowerCase())] = value;
+            }
+            if (passphrase) body.passphrase_hash = await hashPassphrase(passphrase);
+
+            const created = await this.request("POST", "/api/secrets", body, this.apiKey);
+            return {
+                link: this.baseURL + "/s/" + created.id + "#" + key,
+                id: created.id,
+                key: key,
+                managementToken: created.management_token,
+                pin: created.pin || "",
+                webhookSecret: created.webhook_secret || "",
+            };
+        }
+
+        // Read and decrypt the secret behind a link, consuming one of its reads. Secrets
+        // protected by a passphrase, PIN or authenticator code need them in options. Captcha
+        // challenges can't be answered without a page and fail with a PicosendError.
+        async readSecret(link, { passphrase, pin, totp } = {}) {
+            const { id, key } = parseLink(link);
+            const path = "/api/secrets/" + encodeURIComponent(id);
+            const meta = await this.request("GET", path);
+
+            const claim = { claim_token: meta.claim_token, pin: pin || "", totp: totp || "" };
+            if (passphrase) claim.passphrase_hash = await hashPassphrase(passphrase);
+            const challenge = await this.request("GET", path + "/challenge");
+            if (challenge.mode === "token" || challenge.mode === "pow") {
+                claim.challenge = challenge.token;
+                claim.challenge_solution = challenge.mode === "pow" ? await solveProofOfWork(challenge.token, challenge.difficulty) : "";
+            } else if (challenge.mode !== "none") {
+                throw new PicosendError(0, "This server requires a " + challenge.mode + " challenge, open the link in a browser");
+            }
+
+            const secret = await this.request("POST", path + "/claim", claim);
+            return {
+                plaintext: await decrypt(secret.content, key),
+                type: secret.type,
+                createdAt: secret.created_at,
+                readsRemaining: secret.reads_remaining,
+            };
+        }
+
+        // Report whether a secret is unread, read, expired or burned without consuming it.
+        // The management token adds the sender's label, reference and reads.
+        status(id, managementToken) {
+            return this.request("GET", "/api/secrets/" + encodeURIComponent(id) + "/status", undefined, managementToken);
+        }
+
+        // Delete an unread secret with the management token returned when it was created
+        burn(id, managementToken) {
+            return this.request("DELETE", "/api/secrets/" + encodeURIComponent(id), undefined, managementToken);
+        }
+    }
+
+    const Picosend = {
+        Client: Client,
+        PicosendError: PicosendError,
+        generateKey: generateKey,
+        encrypt: encrypt,
+        decrypt: decrypt,
+        hashPassphrase: hashPassphrase,
+        parseLink: parseLink,
+    };
+
+    if (typeof module === "object" && module.exports) {
+        module.exports = Picosend;
+    } else {
+        root.Picosend = Picosend;
+    }
+})(typeof globalThis !== "undefined" ? globalThis : this);
@@ -0,0 +1,16 @@
+// Theme toggle in the page header. The choice is stored in a cookie through the API, so the
+// server renders the next page in it without a flash of the other theme.
+{
+    const toggle = document.getElementById("themeToggle");
+    toggle.addEventListener("click", () => {
+        const root = document.documentElement;
+        const current = root.dataset.theme || (matchMedia("(prefers-color-scheme: dark)").matches ? "dark" : "light");
+        const next = current === "dark" ? "light" : "dark";
+        root.dataset.theme = next;
+        fetch(toggle.dataset.basePath + "/api/theme", {
+            method: "PUT",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify({ theme: next }),
+        });
+    });
+}
@@ -0,0 +1,31 @@
+// Service worker receiving text from the OS share sheet (see share_target in the manifest).
+// The shared text is kept in memory only until the page asks for it, so it never touches the
+// server or any storage.
+
+const SCOPE = new URL(self.registration.scope).pathname;
+let sharedText = null;
+
+self.addEventListener("install", () => self.skipWaiting());
+self.addEventListener("activate", (event) => event.waitUntil(self.clients.claim()));
+
+self.addEventListener("fetch", (event) => {
+    const url = new URL(event.request.url);
+    if (event.request.method !== "POST" || url.pathname !== SCOPE + "share") return;
+
+    event.respondWith((async () => {
+        const form = await event.request.formData();
+        const parts = [];
+        for (const name of ["title", "text", "url"]) {
+            const value = (form.get(name) || "").trim();
+            if (value && !parts.includes(value)) parts.push(value);
+        }
+        sharedText = parts.join("\n");
+        return Response.redirect(SCOPE + "?shared=1", 303);
+    })());
+});
+
+self.addEventListener("message", (event) => {
+    if (event.data?.type !== "shared-text" || !event.source) return;
+    event.source.postMessage({ type: "shared-text", text: sharedText });
+    sharedText = null;
+});
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestStaticFiles_CacheHeaders(t *testing.T) {
+	router := newTestServer(t).routes()
+
+	for _, path := range []string{"/static/css/pico.min.css", "/robots.txt"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		etag := rec.Header().Get("ETag")
+		if rec.Code != http.StatusOK || etag == "" || rec.Header().Get("Cache-Control") != StaticCacheControl {
+			t.Fatalf("%s: expected 200 with cache headers, got %d %v", path, rec.Code, rec.Header())
+		}
+
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("If-None-Match", etag)
+		rec = httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+			t.Errorf("%s: expected 304 for a current ETag, got %d", path, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/robots.txt", nil))
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("Expected robots.txt as text/plain, got %q", rec.Header().Get("Content-Type"))
+	}
+
+	for _, path := range []string{"/static/", "/static/css/", "/static/missing.css"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestStaticFiles_JavaScriptSDK(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newTestServer(t).routes().ServeHTTP(rec, httptest.NewRequest("GET", "/static/js/picosend-sdk.js", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Header().Get("Content-Type"), "javascript") {
+		t.Fatalf("Expected the SDK as JavaScript, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), "class Client") {
+		t.Error("Expected the SDK to define the client")
+	}
+}
+
+func TestStaticFiles_Fingerprinted(t *testing.T) {
+	router := newTestServer(t).routes()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	match := regexp.MustCompile(`<link href="(/static/css/pico\.min\.[0-9a-f]{12}\.css)" integrity="([^"]+)"`).FindStringSubmatch(rec.Body.String())
+	if match == nil {
+		t.Fatalf("Expected the home page to link a fingerprinted stylesheet with its integrity hash")
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", match[1], nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != FingerprintCacheControl {
+		t.Fatalf("Expected the fingerprinted file to be cached for good, got %d %v", rec.Code, rec.Header())
+	}
+	sum := sha512.Sum384(rec.Body.Bytes())
+	if want := "sha384-" + base64.StdEncoding.EncodeToString(sum[:]); html.UnescapeString(match[2]) != want {
+		t.Errorf("Expected integrity %q, got %q", want, match[2])
+	}
+
+	// The plain name keeps working for links from elsewhere, an outdated hash doesn't
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/static/css/pico.min.000000000000.css", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown hash, got %d", rec.Code)
+	}
+}
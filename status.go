@@ -0,0 +1,160 @@
+package main
+
+import "time"
+
+const (
+	TombstoneRetention = 24 * time.Hour // How long the final status of a removed secret is remembered
+	MaxTombstones      = 10000          // Maximum number of remembered final statuses
+)
+
+// SecretStatus describes the lifecycle state of a secret
+type SecretStatus string
+
+const (
+	StatusUnread  SecretStatus = "unread"
+	StatusRead    SecretStatus = "read"
+	StatusExpired SecretStatus = "expired"
+	StatusBurned  SecretStatus = "burned"
+	StatusEvicted SecretStatus = "evicted" // Removed unread to make room under an eviction policy
+	StatusBlocked SecretStatus = "blocked" // Taken down by an operator through the blocklist
+	// Wiped after as many wrong passphrases, PINs or codes as its sender allowed
+	StatusDestroyed SecretStatus = "destroyed"
+)
+
+// SecretState is the non-sensitive status of a secret, safe to report to anyone holding its ID
+type SecretState struct {
+	ID              string
+	Status          SecretStatus
+	CreatedAt       time.Time
+	ExpiresAt       time.Time
+	ClosedAt        time.Time // When the secret was read, expired or burned; zero while unread
+	MaxReads        int
+	ReadsRemaining  int
+	DeletionMessage string // Sender's public note for visitors once the secret is gone
+}
+
+// SenderDetails are the sender's notes on a secret. Unlike SecretState they are only reported
+// to the holder of the management token, so recipients never see them.
+type SenderDetails struct {
+	Label     string
+	Reference string
+	Reads     []ReadRecord
+}
+
+// tombstone remembers how a secret left the store, without any of its content
+type tombstone struct {
+	state    SecretState
+	recorded time.Time
+
+	sender          SenderDetails
+	managementToken [32]byte // Hash of the token that may read sender; zero when there are no details
+
+	fingerprints Fingerprints // Kept so a secret can be reported and blocked after it was read
+}
+
+// remove wipes and deletes a secret from its shard, recording the reason it left the store.
+// Expiry and burn events are emitted here; reads are emitted by Get. Must be called with sh.mu held.
+func (s *SecretStore) remove(sh *storeShard, id string, secret *Secret, status SecretStatus) {
+	now := time.Now()
+	if status != StatusRead {
+		s.emit(status, id, secret, now)
+	}
+	s.discard(sh, id, secret, status, now)
+}
+
+// discard is remove without the event, for a change another cluster node reports. Must be
+// called with sh.mu held.
+func (s *SecretStore) discard(sh *storeShard, id string, secret *Secret, status SecretStatus, now time.Time) {
+	t := &tombstone{
+		state: SecretState{
+			ID:              id,
+			Status:          status,
+			CreatedAt:       secret.CreatedAt,
+			ExpiresAt:       secret.ExpiresAt,
+			ClosedAt:        now,
+			MaxReads:        secret.MaxReads,
+			DeletionMessage: secret.DeletionMessage,
+		},
+		recorded:     now,
+		fingerprints: secret.Fingerprints,
+	}
+	if secret.Label != "" || secret.Reference != "" || len(secret.Reads) > 0 {
+		t.sender = SenderDetails{Label: secret.Label, Reference: secret.Reference, Reads: secret.Reads}
+		t.managementToken = secret.ManagementToken
+	}
+	sh.recordTombstone(id, t)
+
+	// A secret's last read deletes its blob in Get, once the content has been fetched
+	if secret.Blob && status != StatusRead {
+		s.deleteBlobAsync(id)
+	}
+
+	size := secret.size
+	wipeSecret(secret)
+	delete(sh.secrets, keyOf(id))
+	s.release(id, size)
+}
+
+// Status reports the state of a secret without revealing or consuming its content.
+// Returns false if the ID is unknown or its final status is no longer remembered.
+func (s *SecretStore) Status(id string) (*SecretState, bool) {
+	sh := s.shardFor(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if secret, exists := sh.secrets[keyOf(id)]; exists {
+		if time.Now().After(secret.ExpiresAt) {
+			s.remove(sh, id, secret, StatusExpired)
+		} else {
+			return &SecretState{
+				ID:              id,
+				Status:          StatusUnread,
+				CreatedAt:       secret.CreatedAt,
+				ExpiresAt:       secret.ExpiresAt,
+				MaxReads:        secret.MaxReads,
+				ReadsRemaining:  secret.ReadsRemaining,
+				DeletionMessage: secret.DeletionMessage,
+			}, true
+		}
+	}
+
+	t, ok := sh.tombstones[keyOf(id)]
+	if !ok {
+		return nil, false
+	}
+	state := t.state
+	return &state, true
+}
+
+// SenderDetails returns the label and reference of a secret, provided the management token
+// matches. They remain available as long as the secret's final status is remembered.
+func (s *SecretStore) SenderDetails(id, managementToken string) (SenderDetails, error) {
+	sh := s.shardFor(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	if secret, exists := sh.secrets[keyOf(id)]; exists {
+		if time.Now().After(secret.ExpiresAt) {
+			s.remove(sh, id, secret, StatusExpired)
+		} else {
+			if !secret.checkManagementToken(managementToken) {
+				return SenderDetails{}, ErrInvalidManagementToken
+			}
+			return SenderDetails{Label: secret.Label, Reference: secret.Reference, Reads: append([]ReadRecord(nil), secret.Reads...)}, nil
+		}
+	}
+
+	t, ok := sh.tombstones[keyOf(id)]
+	if !ok {
+		return SenderDetails{}, ErrSecretNotFound
+	}
+	var zero [32]byte
+	if t.managementToken == zero {
+		// Nothing to report, and the token isn't kept to check it
+		return SenderDetails{}, nil
+	}
+	if !checkTokenHash(t.managementToken, managementToken) {
+		return SenderDetails{}, ErrInvalidManagementToken
+	}
+	return t.sender, nil
+}
@@ -1,38 +1,247 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
 	"html/template"
+	"io/fs"
+	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
 	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
 )
 
-func homeHandler(w http.ResponseWriter, r *http.Request) {
+// Pages holds the page templates, parsed once per locale at startup so requests only
+// execute them and a malformed template stops the server from starting
+type Pages struct {
+	byLocale map[string]*template.Template // Locale tag -> all pages with T bound to the locale
+}
+
+// pageFuncs returns the functions available to page templates
+func pageFuncs(locale *Locale, basePath string, assets *staticHandler) template.FuncMap {
+	return template.FuncMap{
+		// T translates a message key, formatting any arguments into it
+		"T": locale.T,
+		// asset returns the URL of a static file under the base path, fingerprinted when
+		// assets knows the file
+		"asset": func(name string) string {
+			if assets == nil {
+				return basePath + "/static/" + strings.TrimPrefix(name, "/")
+			}
+			hashed, _ := assets.asset(name)
+			return basePath + "/" + hashed
+		},
+		// integrity returns the Subresource Integrity hash of a static file for the integrity
+		// attribute of <script> and <link>, so a tampered copy is refused by the browser
+		"integrity": func(name string) string {
+			if assets == nil {
+				return ""
+			}
+			_, integrity := assets.asset(name)
+			return integrity
+		},
+		// version is the server's build version, shown in page footers
+		"version": func() string { return Version },
+	}
+}
+
+// loadPages parses every page in templates/ for each bundled locale. Pages in overrideDir,
+// if set, replace the embedded pages and partials they redefine. Assets linked from pages
+// are looked up in assets.
+func loadPages(basePath, overrideDir string, assets *staticHandler) (*Pages, error) {
+	var overrides fs.FS
+	if overrideDir != "" {
+		overrides = os.DirFS(overrideDir)
+		if matches, _ := fs.Glob(overrides, "*.html"); len(matches) == 0 {
+			overrides = nil
+		}
+	}
+
+	pages := &Pages{byLocale: make(map[string]*template.Template, len(locales))}
+	for tag, locale := range locales {
+		tmpl, err := template.New("").Funcs(pageFuncs(locale, basePath, assets)).ParseFS(templatesFS, "templates/*.html")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse templates: %w", err)
+		}
+		if overrides != nil {
+			if tmpl, err = tmpl.ParseFS(overrides, "*.html"); err != nil {
+				return nil, fmt.Errorf("failed to parse templates in %s: %w", overrideDir, err)
+			}
+		}
+		pages.byLocale[tag] = tmpl
+	}
+	return pages, nil
+}
+
+// renderPage executes a page for locale. The page is rendered into a buffer first, so a
+// failure results in a 500 rather than a truncated page.
+func (srv *Server) renderPage(w http.ResponseWriter, locale *Locale, name string, data any) {
+	srv.renderPageStatus(w, locale, name, data, http.StatusOK)
+}
+
+// renderPageStatus is renderPage answering with status
+func (srv *Server) renderPageStatus(w http.ResponseWriter, locale *Locale, name string, data any, status int) {
+	var buf bytes.Buffer
+	if err := srv.pages.byLocale[locale.Tag].ExecuteTemplate(&buf, name, data); err != nil {
+		srv.logger.Error("Failed to render page", "page", name, "error", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	tmpl := template.Must(template.ParseFS(templatesFS, "templates/home.html"))
-	tmpl.Execute(w, nil)
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
 }
 
-func viewSecretHandler(w http.ResponseWriter, r *http.Request) {
-	// Build the base URL for Open Graph meta tags
+func (srv *Server) homeHandler(w http.ResponseWriter, r *http.Request) {
+	identity, signedIn := srv.requestIdentity(r)
+	if srv.oidc != nil && !signedIn {
+		http.Redirect(w, r, srv.loginURL("/"), http.StatusFound)
+		return
+	}
+
+	locale := requestLocale(w, r)
+	data := struct {
+		Lang               string
+		BasePath           string
+		Brand              Branding
+		Theme              string // light or dark when known, "" to follow prefers-color-scheme
+		EmailNotifications bool
+		LinkDelivery       bool   // The server can email links to recipients
+		PINTexting         bool   // The server can text pickup PINs to recipients
+		SignedInAs         string // Email or subject of the single sign-on session
+		SignedIn           bool
+		APIKeyRequired     bool   // The form without JavaScript asks for an API key
+		Nonce              string // Allows the page's inline scripts
+	}{
+		Lang:               locale.Tag,
+		BasePath:           srv.config.BasePath,
+		Brand:              srv.config.Branding,
+		Theme:              requestTheme(w, r),
+		EmailNotifications: srv.emailNotifier != nil,
+		LinkDelivery:       srv.deliveries != nil,
+		PINTexting:         srv.messenger != nil,
+		SignedInAs:         identity.Email,
+		SignedIn:           signedIn,
+		APIKeyRequired:     srv.config.RequireAPIKeys && srv.oidc == nil,
+		Nonce:              srv.scriptNonce(w),
+	}
+
+	if data.SignedInAs == "" {
+		data.SignedInAs = identity.Subject
+	}
+
+	srv.renderPage(w, locale, "home.html", data)
+}
+
+// requestBaseURL returns the URL of the server's root as the client addressed it
+func requestBaseURL(r *http.Request, basePath string) string {
+	host, loopback := urlHost(r.Host)
 	scheme := "https"
 	if r.Header.Get("X-Forwarded-Proto") != "" {
 		scheme = r.Header.Get("X-Forwarded-Proto")
-	} else if r.TLS == nil && !strings.Contains(r.Host, "localhost") && !strings.Contains(r.Host, "127.0.0.1") {
+	} else if r.TLS == nil && !loopback {
 		scheme = "http"
 	}
+	return scheme + "://" + host + basePath
+}
 
-	baseURL := scheme + "://" + r.Host
+// urlHost returns a Host header in the form URLs need, with IPv6 addresses in brackets and
+// the % of a zone escaped, and whether it names the local machine. Clients send IPv6 hosts
+// bracketed, but proxies and HTTP/1.0 clients may not.
+func urlHost(host string) (string, bool) {
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		hostname, port = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"), ""
+	}
+	if unescaped, err := url.PathUnescape(hostname); err == nil {
+		hostname = unescaped
+	}
+
+	ip, err := netip.ParseAddr(hostname)
+	if err != nil {
+		return host, strings.Contains(host, "localhost")
+	}
+	formatted := strings.Replace(ip.String(), "%", "%25", 1)
+	if ip.Is6() {
+		formatted = "[" + formatted + "]"
+	}
+	if port != "" {
+		formatted += ":" + port
+	}
+	return formatted, ip.IsLoopback()
+}
+
+func (srv *Server) viewSecretHandler(w http.ResponseWriter, r *http.Request) {
+	// Build the base URL for Open Graph meta tags
+	baseURL := requestBaseURL(r, srv.config.BasePath)
 	requestURL := baseURL + r.URL.Path
 
+	// requireValidSecretID checked the link's signature and stripped it
+	id := mux.Vars(r)["id"]
+
+	locale := requestLocale(w, r)
 	data := struct {
-		BaseURL    string
-		RequestURL string
+		Lang            string
+		BasePath        string
+		Brand           Branding
+		Theme           string
+		BaseURL         string
+		RequestURL      string
+		ClaimToken      string
+		Recipient       string // Fingerprint of the key the content is sealed to; such secrets can't be opened here
+		Display         DisplayOptions
+		ChallengeMode   string
+		CaptchaScript   string
+		CaptchaWidget   string
+		CaptchaSiteKey  string
+		DeletionMessage string        // Sender's note, shown once the secret was burned or expired
+		Blocked         bool          // The operator took the secret down
+		AbuseReports    bool          // Visitors may report the link
+		NoScript        *noScriptForm // Reveal form for browsers without JavaScript, nil when the secret is gone
+		Nonce           string        // Allows the page's inline scripts
 	}{
-		BaseURL:    baseURL,
-		RequestURL: requestURL,
+		Lang:          locale.Tag,
+		BasePath:      srv.config.BasePath,
+		Brand:         srv.config.Branding,
+		Theme:         requestTheme(w, r),
+		BaseURL:       baseURL,
+		RequestURL:    requestURL,
+		ClaimToken:    srv.claims.Issue(id, time.Now()),
+		ChallengeMode: ChallengeNone,
+		AbuseReports:  srv.config.AbuseReports,
+	}
+	if meta, found := srv.store.Peek(id); found {
+		data.Recipient, data.Display = meta.Recipient, meta.Display
+		data.NoScript = srv.noScriptForm(meta, r.URL.Query().Get(NoScriptKeyParam), data.ClaimToken)
+	} else if state, found := srv.store.Status(id); found && state.Status == StatusBlocked {
+		data.Blocked = true
+	} else if found && state.Status != StatusRead {
+		data.DeletionMessage = state.DeletionMessage
+	} else if !found {
+		markLookupFailed(r)
+	}
+	if srv.abuse.Blocked(BlockByID, id) {
+		data.Blocked = true
 	}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	tmpl := template.Must(template.ParseFS(templatesFS, "templates/view-secret.html"))
-	tmpl.Execute(w, data)
+	challenge := srv.config.Challenge
+	if challenge.Enabled() {
+		data.ChallengeMode = challenge.Mode
+	}
+	if provider, ok := captchaProviders[challenge.Mode]; ok {
+		data.CaptchaScript = provider.script
+		data.CaptchaWidget = provider.widget
+		data.CaptchaSiteKey = challenge.SiteKey
+		if headers := srv.config.SecurityHeaders; headers.Enabled && headers.ContentSecurityPolicy != "" {
+			w.Header().Set("Content-Security-Policy", captchaContentSecurityPolicy(headers.ContentSecurityPolicy, provider))
+		}
+	}
+	data.Nonce = srv.scriptNonce(w)
+
+	srv.renderPage(w, locale, "view-secret.html", data)
 }
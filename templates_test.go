@@ -0,0 +1,61 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLoadPages(t *testing.T) {
+	pages, err := loadPages("/tools/picosend", "", nil)
+	if err != nil {
+		t.Fatalf("Failed to load pages: %v", err)
+	}
+	for tag := range locales {
+		for _, name := range []string{"home.html", "view-secret.html", "api-docs.html"} {
+			if pages.byLocale[tag].Lookup(name) == nil {
+				t.Errorf("Expected %s to be parsed for locale %s", name, tag)
+			}
+		}
+	}
+
+	var out strings.Builder
+	tmpl := template.Must(template.New("").Funcs(pageFuncs(locales["de"], "/tools/picosend", nil)).Parse(`{{asset "css/pico.min.css"}} {{T "home.title"}}`))
+	tmpl.Execute(&out, nil)
+	if !strings.HasPrefix(out.String(), "/tools/picosend/static/css/pico.min.css ") || strings.Contains(out.String(), "home.title") {
+		t.Errorf("Unexpected template function output %q", out.String())
+	}
+}
+
+func TestRenderPage_ExecutionError(t *testing.T) {
+	srv := newTestServer(t)
+	srv.pages.byLocale[DefaultLocale] = template.Must(template.New("broken.html").Parse(`partial {{.Missing}}`))
+
+	rec := httptest.NewRecorder()
+	srv.renderPage(rec, locales[DefaultLocale], "broken.html", struct{}{})
+	if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "partial") {
+		t.Errorf("Expected a 500 without partial output, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRequestBaseURL_IPv6(t *testing.T) {
+	for _, tt := range []struct {
+		host string
+		want string
+	}{
+		{"[2001:db8::1]:8080", "http://[2001:db8::1]:8080/tools"},
+		{"2001:db8::1", "http://[2001:db8::1]/tools"},
+		{"[fe80::1%25eth0]:8080", "http://[fe80::1%25eth0]:8080/tools"},
+		{"[::1]:8080", "https://[::1]:8080/tools"},
+		{"192.0.2.1:8080", "http://192.0.2.1:8080/tools"},
+		{"secrets.example.com", "http://secrets.example.com/tools"},
+	} {
+		req := httptest.NewRequest("GET", "/s/id", nil)
+		req.Host = tt.host
+		if got := requestBaseURL(req, "/tools"); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.host, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// TenantSeparator joins a tenant name and the random part of a secret ID. It is not part of
+// the base64url alphabet, so unscoped IDs never contain it.
+const TenantSeparator = "."
+
+var tenantNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+var (
+	ErrTenantNotFound = errors.New("tenant not found")
+	ErrTenantInUse    = errors.New("tenant still has API keys")
+	ErrTenantFull     = errors.New("tenant has reached its maximum number of unread secrets")
+)
+
+// TenantLimits restrict what a tenant's keys can create. Zero means the server-wide limit applies.
+type TenantLimits struct {
+	MaxUnreadSecrets int `json:"max_unread_secrets"` // Unread secrets the tenant may hold at once
+	MaxLifetime      int `json:"max_lifetime"`       // Minutes
+	MaxSecretLength  int `json:"max_secret_length"`  // Characters
+}
+
+// Validate checks that no limit is negative
+func (l TenantLimits) Validate() error {
+	if l.MaxUnreadSecrets < 0 || l.MaxLifetime < 0 || l.MaxSecretLength < 0 {
+		return errors.New("tenant limits must not be negative")
+	}
+	return nil
+}
+
+// Tenant is a namespace for the secrets created with its API keys
+type Tenant struct {
+	Name      string
+	Limits    TenantLimits
+	CreatedAt time.Time
+
+	created, read, expired, burned int // Lifetime counters for the admin API
+}
+
+// TenantInfo is the view of a tenant returned by the admin API
+type TenantInfo struct {
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+	TenantLimits
+	Unread  int `json:"unread"` // Secrets currently held
+	Created int `json:"created"`
+	Read    int `json:"read"`
+	Expired int `json:"expired"`
+	Burned  int `json:"burned"`
+}
+
+// TenantRegistry stores tenants in memory and counts their secrets' lifecycle events
+type TenantRegistry struct {
+	mu      sync.Mutex
+	tenants map[string]*Tenant
+}
+
+func NewTenantRegistry() *TenantRegistry {
+	return &TenantRegistry{tenants: make(map[string]*Tenant)}
+}
+
+// Put creates a tenant or replaces the limits of an existing one. Counters are kept.
+func (reg *TenantRegistry) Put(name string, limits TenantLimits) TenantInfo {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	tenant, ok := reg.tenants[name]
+	if !ok {
+		tenant = &Tenant{Name: name, CreatedAt: time.Now()}
+		reg.tenants[name] = tenant
+	}
+	tenant.Limits = limits
+	return tenant.info()
+}
+
+// Limits returns the limits of a tenant
+func (reg *TenantRegistry) Limits(name string) (TenantLimits, bool) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	tenant, ok := reg.tenants[name]
+	if !ok {
+		return TenantLimits{}, false
+	}
+	return tenant.Limits, true
+}
+
+// Get returns one tenant
+func (reg *TenantRegistry) Get(name string) (TenantInfo, error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	tenant, ok := reg.tenants[name]
+	if !ok {
+		return TenantInfo{}, ErrTenantNotFound
+	}
+	return tenant.info(), nil
+}
+
+// List returns all tenants ordered by name
+func (reg *TenantRegistry) List() []TenantInfo {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	infos := make([]TenantInfo, 0, len(reg.tenants))
+	for _, tenant := range reg.tenants {
+		infos = append(infos, tenant.info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// Delete removes a tenant. Secrets already created under it are kept until read or expired.
+func (reg *TenantRegistry) Delete(name string) error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	if _, ok := reg.tenants[name]; !ok {
+		return ErrTenantNotFound
+	}
+	delete(reg.tenants, name)
+	return nil
+}
+
+// RecordCreated counts a secret created under the tenant its ID is scoped to
+func (reg *TenantRegistry) RecordCreated(id string) {
+	reg.count(id, func(tenant *Tenant) { tenant.created++ })
+}
+
+// HandleEvent counts reads, expiries and burns per tenant. Safe to use as a store listener.
+func (reg *TenantRegistry) HandleEvent(event SecretEvent) {
+	reg.count(event.ID, func(tenant *Tenant) {
+		switch event.Type {
+		case StatusRead:
+			tenant.read++
+		case StatusExpired:
+			tenant.expired++
+		case StatusBurned:
+			tenant.burned++
+		}
+	})
+}
+
+func (reg *TenantRegistry) count(id string, fn func(*Tenant)) {
+	name := tenantOf(id)
+	if name == "" {
+		return
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if tenant, ok := reg.tenants[name]; ok {
+		fn(tenant)
+	}
+}
+
+// info must be called with the registry lock held
+func (tenant *Tenant) info() TenantInfo {
+	return TenantInfo{
+		Name:         tenant.Name,
+		CreatedAt:    tenant.CreatedAt.UTC().Format(time.RFC3339),
+		TenantLimits: tenant.Limits,
+		Created:      tenant.created,
+		Read:         tenant.read,
+		Expired:      tenant.expired,
+		Burned:       tenant.burned,
+	}
+}
+
+// tenantOf returns the tenant a secret ID is scoped to, or "" for unscoped IDs
+func tenantOf(id string) string {
+	tenant, _, found := strings.Cut(id, TenantSeparator)
+	if !found {
+		return ""
+	}
+	return tenant
+}
+
+// restrict returns the limits tightened by a tenant's or API key's own limits, which can only
+// lower the server-wide ones
+func (l Limits) restrict(maxLifetime, maxSecretLength int) Limits {
+	if maxSecretLength > 0 && maxSecretLength < l.MaxSecretLength {
+		l.MaxSecretLength = maxSecretLength
+	}
+	if maxLifetime > 0 && maxLifetime < l.MaxLifetime {
+		l.MaxLifetime = max(maxLifetime, l.MinLifetime)
+		l.DefaultLifetime = min(l.DefaultLifetime, l.MaxLifetime)
+	}
+	return l
+}
+
+func (srv *Server) tenantInfo(info TenantInfo) TenantInfo {
+	info.Unread = srv.store.TenantCount(info.Name)
+	return info
+}
+
+func (srv *Server) adminListTenantsHandler(w http.ResponseWriter, r *http.Request) {
+	tenants := srv.tenants.List()
+	for i := range tenants {
+		tenants[i] = srv.tenantInfo(tenants[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tenants)
+}
+
+func (srv *Server) adminGetTenantHandler(w http.ResponseWriter, r *http.Request) {
+	info, err := srv.tenants.Get(mux.Vars(r)["name"])
+	if err != nil {
+		apiError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(srv.tenantInfo(info))
+}
+
+// adminPutTenantHandler creates a tenant or replaces its limits
+func (srv *Server) adminPutTenantHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if !tenantNamePattern.MatchString(name) {
+		apiError(w, r, http.StatusBadRequest, "tenant name must be 1-32 lowercase letters, digits or dashes")
+		return
+	}
+
+	var limits TenantLimits
+	if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+		apiError(w, r, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if err := limits.Validate(); err != nil {
+		apiError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	info := srv.tenants.Put(name, limits)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(srv.tenantInfo(info))
+}
+
+// adminDeleteTenantHandler removes a tenant once no API key is assigned to it
+func (srv *Server) adminDeleteTenantHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	for _, key := range srv.apiKeys.List() {
+		if key.Tenant == name {
+			apiError(w, r, http.StatusConflict, ErrTenantInUse.Error())
+			return
+		}
+	}
+
+	if err := srv.tenants.Delete(name); err != nil {
+		apiError(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
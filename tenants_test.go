@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecretStore_TenantCapacity(t *testing.T) {
+	store := NewSecretStore()
+	opts := SecretOptions{Tenant: "acme", TenantMaxUnread: 2}
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		id, err := store.StoreWithOptions("content", time.Hour, opts)
+		if err != nil {
+			t.Fatalf("Failed to store secret %d: %v", i+1, err)
+		}
+		if !strings.HasPrefix(id, "acme"+TenantSeparator) || tenantOf(id) != "acme" {
+			t.Errorf("Expected ID scoped to the tenant, got %q", id)
+		}
+		ids = append(ids, id)
+	}
+	if _, err := store.StoreWithOptions("content", time.Hour, opts); err != ErrTenantFull {
+		t.Errorf("Expected ErrTenantFull, got %v", err)
+	}
+	if store.Count() != 2 || store.TenantCount("acme") != 2 {
+		t.Errorf("Expected a rejected secret not to hold a slot, got %d and %d", store.Count(), store.TenantCount("acme"))
+	}
+
+	// Other tenants and unscoped secrets are unaffected
+	if _, err := store.StoreWithOptions("content", time.Hour, SecretOptions{Tenant: "globex", TenantMaxUnread: 2}); err != nil {
+		t.Errorf("Expected another tenant to have its own capacity, got %v", err)
+	}
+	if id, err := store.Store("content", time.Hour); err != nil || tenantOf(id) != "" {
+		t.Errorf("Expected an unscoped secret, got %q, %v", id, err)
+	}
+
+	store.Get(ids[0])
+	if store.TenantCount("acme") != 1 {
+		t.Errorf("Expected a read to free the tenant's slot, got %d", store.TenantCount("acme"))
+	}
+	store.WipeAll()
+	if store.TenantCount("acme") != 0 || store.TenantCount("globex") != 0 {
+		t.Error("Expected wiping to free all tenant slots")
+	}
+}
+
+func TestTenants_AdminAPI(t *testing.T) {
+	_, server := setupAdminTestServer(t)
+	defer server.Close()
+
+	resp := adminRequest(t, server, "POST", "/admin/api/keys", testAdminKey, []byte(`{"name": "acme-ci", "tenant": "acme"}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected a key for an unknown tenant to be rejected, got %d", resp.StatusCode)
+	}
+
+	for _, name := range []string{"Acme", "acme.corp", "-acme"} {
+		resp := adminRequest(t, server, "PUT", "/admin/api/tenants/"+name, testAdminKey, []byte(`{}`))
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected tenant name %q to be rejected, got %d", name, resp.StatusCode)
+		}
+	}
+
+	resp = adminRequest(t, server, "PUT", "/admin/api/tenants/acme", testAdminKey, []byte(`{"max_unread_secrets": 1, "max_lifetime": 60}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected tenant to be created, got %d", resp.StatusCode)
+	}
+
+	resp = adminRequest(t, server, "POST", "/admin/api/keys", testAdminKey, []byte(`{"name": "acme-ci", "tenant": "acme"}`))
+	var created AdminCreateAPIKeyResponse
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated || created.Tenant != "acme" {
+		t.Fatalf("Expected a key assigned to the tenant, got %d %+v", resp.StatusCode, created)
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		expected int
+	}{
+		{"lifetime above tenant limit", `{"content": "encrypted", "lifetime": 1440}`, http.StatusBadRequest},
+		{"within limits", `{"content": "encrypted", "lifetime": 60}`, http.StatusOK},
+		{"tenant full", `{"content": "encrypted", "lifetime": 60}`, http.StatusTooManyRequests},
+	}
+	var id string
+	for _, tt := range tests {
+		resp := adminRequest(t, server, "POST", "/api/secrets", created.Key, []byte(tt.body))
+		if resp.StatusCode == http.StatusOK {
+			var result CreateSecretResponse
+			json.NewDecoder(resp.Body).Decode(&result)
+			id = result.ID
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expected, resp.StatusCode)
+		}
+	}
+	if tenantOf(id) != "acme" {
+		t.Errorf("Expected the secret ID to be scoped to the tenant, got %q", id)
+	}
+
+	resp = adminRequest(t, server, "GET", "/admin/api/tenants/acme", testAdminKey, nil)
+	var info TenantInfo
+	json.NewDecoder(resp.Body).Decode(&info)
+	resp.Body.Close()
+	if info.Unread != 1 || info.Created != 1 || info.MaxUnreadSecrets != 1 {
+		t.Errorf("Expected one unread secret in the tenant stats, got %+v", info)
+	}
+
+	resp = adminRequest(t, server, "DELETE", "/admin/api/tenants/acme", testAdminKey, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected deleting a tenant with keys to conflict, got %d", resp.StatusCode)
+	}
+	adminRequest(t, server, "DELETE", "/admin/api/keys/"+created.ID, testAdminKey, nil).Body.Close()
+	resp = adminRequest(t, server, "DELETE", "/admin/api/tenants/acme", testAdminKey, nil)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected tenant to be deleted, got %d", resp.StatusCode)
+	}
+
+	resp = adminRequest(t, server, "GET", "/admin/api/tenants", testAdminKey, nil)
+	var tenants []TenantInfo
+	json.NewDecoder(resp.Body).Decode(&tenants)
+	resp.Body.Close()
+	if len(tenants) != 0 {
+		t.Errorf("Expected no tenants, got %+v", tenants)
+	}
+}
+
+func TestTenants_StoreCapacityIsHidden(t *testing.T) {
+	srv, server := setupAdminTestServer(t)
+	defer server.Close()
+
+	limits := srv.store.Limits()
+	limits.MaxUnreadSecrets = 1
+	srv.store.SetLimits(limits)
+	srv.store.Store("content", time.Hour)
+
+	srv.tenants.Put("acme", TenantLimits{})
+	_, token := srv.apiKeys.Create("acme-ci", "acme", APIKeyLimits{})
+
+	resp := adminRequest(t, server, "POST", "/api/secrets", token, []byte(`{"content": "encrypted"}`))
+	var body ErrorResponse
+	json.NewDecoder(resp.Body).Decode(&body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429, got %d", resp.StatusCode)
+	}
+	if strings.Contains(body.Error, "1") {
+		t.Errorf("Expected the store limit not to be revealed, got %q", body.Error)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Color themes of the web pages. Auto follows the browser's prefers-color-scheme.
+const (
+	ThemeAuto  = "auto"
+	ThemeLight = "light"
+	ThemeDark  = "dark"
+)
+
+const (
+	ThemeCookie       = "theme"
+	ThemeCookieMaxAge = 365 * 24 * time.Hour
+	// prefersColorSchemeHeader is the client hint carrying prefers-color-scheme, sent by
+	// Chromium browsers once a response asked for it in Accept-CH
+	prefersColorSchemeHeader = "Sec-CH-Prefers-Color-Scheme"
+)
+
+type ThemeRequest struct {
+	Theme string `json:"theme"` // light, dark or auto
+}
+
+type ThemeResponse struct {
+	Theme string `json:"theme"`
+}
+
+// requestTheme returns the light or dark theme chosen with the theme cookie, or else the one
+// the browser prefers according to its client hint. Returns "" when unknown, leaving the
+// choice to the stylesheet's prefers-color-scheme media query.
+func requestTheme(w http.ResponseWriter, r *http.Request) string {
+	w.Header().Set("Accept-CH", prefersColorSchemeHeader)
+	w.Header().Add("Vary", prefersColorSchemeHeader)
+	w.Header().Add("Vary", "Cookie")
+
+	if cookie, err := r.Cookie(ThemeCookie); err == nil && (cookie.Value == ThemeLight || cookie.Value == ThemeDark) {
+		return cookie.Value
+	}
+	switch strings.Trim(r.Header.Get(prefersColorSchemeHeader), `"`) {
+	case ThemeLight:
+		return ThemeLight
+	case ThemeDark:
+		return ThemeDark
+	}
+	return ""
+}
+
+// setThemeHandler remembers the visitor's theme in a cookie, or forgets it for auto
+func (srv *Server) setThemeHandler(w http.ResponseWriter, r *http.Request) {
+	var req ThemeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "error.invalid_json")
+		return
+	}
+
+	cookie := &http.Cookie{
+		Name:     ThemeCookie,
+		Value:    req.Theme,
+		Path:     srv.config.BasePath + "/",
+		MaxAge:   int(ThemeCookieMaxAge / time.Second),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+	switch req.Theme {
+	case ThemeLight, ThemeDark:
+	case ThemeAuto:
+		cookie.Value, cookie.MaxAge = "", -1
+	default:
+		localizedError(w, r, http.StatusBadRequest, "error.theme_invalid", ThemeLight, ThemeDark, ThemeAuto)
+		return
+	}
+	http.SetCookie(w, cookie)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ThemeResponse{Theme: req.Theme})
+}
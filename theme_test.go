@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSetThemeHandler(t *testing.T) {
+	router := newTestServer(t).routes()
+
+	put := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("PUT", "/api/theme", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := put(`{"theme": "dark"}`)
+	cookies := rec.Result().Cookies()
+	if rec.Code != http.StatusOK || len(cookies) != 1 || cookies[0].Name != ThemeCookie || cookies[0].Value != ThemeDark || !cookies[0].HttpOnly {
+		t.Fatalf("Expected a theme cookie, got %d %v", rec.Code, cookies)
+	}
+
+	rec = put(`{"theme": "auto"}`)
+	cookies = rec.Result().Cookies()
+	if rec.Code != http.StatusOK || len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("Expected auto to delete the cookie, got %d %v", rec.Code, cookies)
+	}
+
+	if rec := put(`{"theme": "purple"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown theme to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestPages_Theme(t *testing.T) {
+	router := newTestServer(t).routes()
+
+	tests := []struct {
+		name     string
+		cookie   string
+		hint     string
+		expected string
+	}{
+		{"cookie", "dark", "", `data-theme="dark"`},
+		{"cookie over client hint", "light", `"dark"`, `data-theme="light"`},
+		{"client hint", "", `"dark"`, `data-theme="dark"`},
+		{"unknown", "", "", `media="(prefers-color-scheme: dark)"`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tt.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: ThemeCookie, Value: tt.cookie})
+		}
+		if tt.hint != "" {
+			req.Header.Set("Sec-CH-Prefers-Color-Scheme", tt.hint)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if !strings.Contains(rec.Body.String(), tt.expected) {
+			t.Errorf("%s: expected page to contain %s", tt.name, tt.expected)
+		}
+		if tt.name == "unknown" && strings.Contains(rec.Body.String(), "data-theme=") {
+			t.Errorf("%s: expected no forced theme", tt.name)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	LookupFailureWindow = 10 * time.Minute // Period failed lookups are counted over
+	MaxThrottledClients = 100000           // Clients tracked at once; the least recently failing is dropped beyond it
+)
+
+// lookupFailures counts one client's failed lookups in the current window
+type lookupFailures struct {
+	count int
+	since time.Time
+	entry *list.Element // Position in LookupThrottle.recent
+}
+
+// LookupThrottle blocks clients that ask for too many unknown secrets, so IDs can't be
+// enumerated by brute force. IPv6 clients are counted per /64, since a single host usually
+// holds a whole /64.
+type LookupThrottle struct {
+	limit  int // Failed lookups allowed per client and window
+	window time.Duration
+
+	mu      sync.Mutex
+	clients map[netip.Prefix]*lookupFailures
+	recent  *list.List // Keys of clients, least recently failing first
+}
+
+func NewLookupThrottle(limit int, window time.Duration) *LookupThrottle {
+	return &LookupThrottle{limit: limit, window: window, clients: make(map[netip.Prefix]*lookupFailures), recent: list.New()}
+}
+
+// throttleKey returns the network a client's failures are counted under
+func throttleKey(addr netip.Addr) netip.Prefix {
+	addr = addr.Unmap()
+	bits := 32
+	if addr.Is6() {
+		bits = 64
+	}
+	prefix, _ := addr.Prefix(bits)
+	return prefix
+}
+
+// Blocked reports whether the client has used up its failed lookups, and when it may try again
+func (t *LookupThrottle) Blocked(addr netip.Addr, now time.Time) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	failures, ok := t.clients[throttleKey(addr)]
+	if !ok || failures.count < t.limit {
+		return 0, false
+	}
+	retry := failures.since.Add(t.window).Sub(now)
+	return retry, retry > 0
+}
+
+// RecordFailure counts a lookup of an unknown secret by the client. Once MaxThrottledClients
+// are tracked, the client that failed least recently is forgotten to make room, so a flood of
+// new networks can't stop others from being counted.
+func (t *LookupThrottle) RecordFailure(addr netip.Addr, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := throttleKey(addr)
+	failures, ok := t.clients[key]
+	if !ok {
+		if len(t.clients) >= MaxThrottledClients {
+			oldest := t.recent.Front()
+			delete(t.clients, oldest.Value.(netip.Prefix))
+			t.recent.Remove(oldest)
+		}
+		failures = &lookupFailures{since: now, entry: t.recent.PushBack(key)}
+		t.clients[key] = failures
+	} else {
+		t.recent.MoveToBack(failures.entry)
+	}
+	if now.Sub(failures.since) >= t.window {
+		failures.count, failures.since = 0, now
+	}
+	failures.count++
+}
+
+// Prune forgets clients whose window has passed. Returns the number removed.
+func (t *LookupThrottle) Prune(now time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	count := 0
+	for key, failures := range t.clients {
+		if now.Sub(failures.since) >= t.window {
+			delete(t.clients, key)
+			t.recent.Remove(failures.entry)
+			count++
+		}
+	}
+	return count
+}
+
+// lookupFailedKey holds the flag markLookupFailed sets in a throttled request's context
+type lookupFailedKey struct{}
+
+// markLookupFailed counts a request against the client like a 404 would, for pages that show
+// unknown secrets with 200
+func markLookupFailed(r *http.Request) {
+	if failed, ok := r.Context().Value(lookupFailedKey{}).(*bool); ok {
+		*failed = true
+	}
+}
+
+// throttleLookups answers 429 to clients that looked up too many unknown secrets, and counts
+// every 404 from the wrapped handler against the client, as well as requests it marks with
+// markLookupFailed
+func (srv *Server) throttleLookups(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if srv.lookupThrottle == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		addr := clientAddr(r, srv.config.TrustedProxies)
+		if !addr.IsValid() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if retry, blocked := srv.lookupThrottle.Blocked(addr, time.Now()); blocked {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retry.Round(time.Second)/time.Second)+1))
+			localizedError(w, r, http.StatusTooManyRequests, "error.too_many_lookups")
+			return
+		}
+
+		failed := false
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), lookupFailedKey{}, &failed)))
+		if failed || rec.status == http.StatusNotFound {
+			srv.lookupThrottle.RecordFailure(addr, time.Now())
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestLookupThrottle(t *testing.T) {
+	throttle := NewLookupThrottle(2, time.Minute)
+	now := time.Now()
+	client := netip.MustParseAddr("2001:db8::1")
+
+	throttle.RecordFailure(client, now)
+	if _, blocked := throttle.Blocked(client, now); blocked {
+		t.Error("Expected the client to be allowed below the limit")
+	}
+	// Another address in the same /64 counts against the same client
+	throttle.RecordFailure(netip.MustParseAddr("2001:db8::2"), now)
+	if retry, blocked := throttle.Blocked(client, now.Add(10*time.Second)); !blocked || retry != 50*time.Second {
+		t.Errorf("Expected the client to be blocked for 50s, got %v %v", retry, blocked)
+	}
+	if _, blocked := throttle.Blocked(netip.MustParseAddr("2001:db8:0:1::1"), now); blocked {
+		t.Error("Expected other networks not to be blocked")
+	}
+
+	if _, blocked := throttle.Blocked(client, now.Add(time.Minute)); blocked {
+		t.Error("Expected the block to end with the window")
+	}
+	if count := throttle.Prune(now.Add(time.Minute)); count != 1 {
+		t.Errorf("Expected 1 client to be pruned, got %d", count)
+	}
+}
+
+func TestLookupThrottle_EvictsLeastRecent(t *testing.T) {
+	throttle := NewLookupThrottle(1, time.Minute)
+	now := time.Now()
+	first := netip.MustParseAddr("10.0.0.0")
+	addr := first
+	for i := 0; i < MaxThrottledClients; i++ {
+		throttle.RecordFailure(addr, now)
+		addr = addr.Next()
+	}
+	throttle.RecordFailure(first, now)
+
+	// A new client is still counted, in place of the one that failed least recently
+	throttle.RecordFailure(addr, now)
+	if _, blocked := throttle.Blocked(addr, now); !blocked {
+		t.Error("Expected a new client to be counted in a full table")
+	}
+	if _, blocked := throttle.Blocked(first.Next(), now); blocked {
+		t.Error("Expected the least recently failing client to be forgotten")
+	}
+	if _, blocked := throttle.Blocked(first, now); !blocked {
+		t.Error("Expected a recently failing client to be kept")
+	}
+}
+
+func TestThrottleLookups(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.LookupFailureLimit = 2 })
+	router := srv.routes()
+	id, err := srv.store.Store("content", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(id string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/secrets/"+id, nil))
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := get(generateID()); rec.Code != http.StatusNotFound {
+			t.Fatalf("Expected 404 for an unknown secret, got %d", rec.Code)
+		}
+	}
+	rec := get(id)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After after the failure limit, got %d", rec.Code)
+	}
+}
+
+func TestThrottleLookups_ViewPages(t *testing.T) {
+	srv := newTestServer(t, func(cfg *Config) { cfg.LookupFailureLimit = 3 })
+	router := srv.routes()
+	id, _ := srv.store.Store("content", time.Hour)
+
+	view := func(method, id string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, "/s/"+id, nil))
+		return rec
+	}
+
+	// Malformed IDs are refused before the store is asked, unknown secrets still get the page,
+	// and all of them count against the client
+	if rec := view("GET", "Not_An_ID!"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for a malformed ID, got %d", rec.Code)
+	}
+	if rec := view("GET", generateID()); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the page for an unknown secret, got %d", rec.Code)
+	}
+	if rec := view("POST", generateID()); rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 revealing an unknown secret, got %d", rec.Code)
+	}
+	if rec := view("GET", id); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 after the failure limit, got %d", rec.Code)
+	}
+	if rec := view("POST", id); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 for the no-JavaScript form too, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// TLSConfig serves HTTPS on TCP listeners and optionally requires API clients to present a
+// certificate issued by ClientCAFile
+type TLSConfig struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string   // PEM bundle of CAs client certificates must chain to; empty disables the gate
+	ClientSANs   []string // DNS names, emails, URIs or IPs a client certificate must carry one of; empty allows any
+}
+
+// Enabled reports whether HTTPS is served
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// ClientAuth reports whether API requests need a client certificate
+func (c TLSConfig) ClientAuth() bool {
+	return c.ClientCAFile != ""
+}
+
+// Validate checks the certificate and key are given together and the client settings have a
+// certificate to serve with
+func (c TLSConfig) Validate() error {
+	if c.Enabled() && (c.CertFile == "" || c.KeyFile == "") {
+		return errors.New("tls-cert and tls-key must be set together")
+	}
+	if c.ClientAuth() && !c.Enabled() {
+		return errors.New("tls-client-ca requires tls-cert and tls-key")
+	}
+	if len(c.ClientSANs) > 0 && !c.ClientAuth() {
+		return errors.New("tls-client-sans requires tls-client-ca")
+	}
+	return nil
+}
+
+// parseSANList splits a comma-separated allow-list of subject alternative names
+func parseSANList(s string) []string {
+	var sans []string
+	for _, san := range strings.Split(s, ",") {
+		if san = strings.TrimSpace(san); san != "" {
+			sans = append(sans, san)
+		}
+	}
+	return sans
+}
+
+// TLSFiles holds the loaded certificate and client CA pool. Reload reads the files again so
+// rotated certificates apply on SIGHUP without dropping connections.
+type TLSFiles struct {
+	config TLSConfig
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+// NewTLSFiles loads the files named by config
+func NewTLSFiles(config TLSConfig) (*TLSFiles, error) {
+	files := &TLSFiles{config: config}
+	if err := files.Reload(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// Reload reads the certificate, key and client CA bundle again. On error the loaded ones are kept.
+func (f *TLSFiles) Reload() error {
+	cert, err := tls.LoadX509KeyPair(f.config.CertFile, f.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if f.config.ClientAuth() {
+		pem, err := os.ReadFile(f.config.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client CA bundle: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in client CA bundle %s", f.config.ClientCAFile)
+		}
+	}
+
+	f.mu.Lock()
+	f.cert, f.clientCAs = &cert, clientCAs
+	f.mu.Unlock()
+	return nil
+}
+
+// TLSConfig returns the configuration listeners handshake with. Each handshake picks up the
+// files loaded last. Client certificates are verified when given but only required by the
+// API gate, so browsers can still open pages without one.
+func (f *TLSFiles) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			f.mu.RLock()
+			defer f.mu.RUnlock()
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*f.cert},
+				NextProtos:   []string{"h2", "http/1.1"},
+			}
+			if f.clientCAs != nil {
+				config.ClientAuth = tls.VerifyClientCertIfGiven
+				config.ClientCAs = f.clientCAs
+			}
+			return config, nil
+		},
+	}
+}
+
+// wrapTLS serves TLS on TCP listeners. Unix sockets are left plain, they sit behind a local
+// reverse proxy that terminates TLS itself.
+func (srv *Server) wrapTLS(listeners []net.Listener) []net.Listener {
+	if srv.tlsFiles == nil {
+		return listeners
+	}
+	config := srv.tlsFiles.TLSConfig()
+	for i, listener := range listeners {
+		if listener.Addr().Network() == "tcp" {
+			listeners[i] = tls.NewListener(listener, config)
+		}
+	}
+	return listeners
+}
+
+// clientCertAllowed reports whether cert carries one of the allowed subject alternative names.
+// A DNS entry starting with "*." matches any name below that domain.
+func clientCertAllowed(cert *x509.Certificate, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, want := range allowed {
+		for _, name := range cert.DNSNames {
+			if strings.EqualFold(name, want) {
+				return true
+			}
+			if suffix, ok := strings.CutPrefix(want, "*"); ok && strings.HasPrefix(suffix, ".") &&
+				len(name) > len(suffix) && strings.HasSuffix(strings.ToLower(name), strings.ToLower(suffix)) {
+				return true
+			}
+		}
+		for _, email := range cert.EmailAddresses {
+			if strings.EqualFold(email, want) {
+				return true
+			}
+		}
+		for _, uri := range cert.URIs {
+			if uri.String() == want {
+				return true
+			}
+		}
+		for _, ip := range cert.IPAddresses {
+			if want := net.ParseIP(want); want != nil && ip.Equal(want) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// clientCertMiddleware requires a verified client certificate with an allowed SAN on API
+// routes when a client CA is configured. Pages, static files and health probes stay open.
+// Requests that didn't come over TLS, such as through a Unix socket, have no certificate and
+// are rejected too.
+func (srv *Server) clientCertMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !srv.config.TLS.ClientAuth() || !isAPIPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			localizedError(w, r, http.StatusUnauthorized, "error.client_cert_required")
+			return
+		}
+		if !clientCertAllowed(r.TLS.VerifiedChains[0][0], srv.config.TLS.ClientSANs) {
+			localizedError(w, r, http.StatusForbidden, "error.client_cert_denied")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
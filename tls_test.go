@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "picosend test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key}
+}
+
+// issue returns a certificate and key signed by the CA for the given template fields
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate) tls.Certificate {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientCertAllowed(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://example.org/ci/deployer")
+	cert := &x509.Certificate{
+		DNSNames:       []string{"deploy.ci.example.org"},
+		EmailAddresses: []string{"Robot@example.org"},
+		URIs:           []*url.URL{spiffe},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.7")},
+	}
+
+	for _, tt := range []struct {
+		allowed []string
+		want    bool
+	}{
+		{nil, true},
+		{[]string{"deploy.ci.example.org"}, true},
+		{[]string{"DEPLOY.ci.example.org"}, true},
+		{[]string{"*.ci.example.org"}, true},
+		{[]string{"*.example.org"}, true},
+		{[]string{"*.deploy.ci.example.org"}, false},
+		{[]string{"ci.example.org"}, false},
+		{[]string{"robot@example.org"}, true},
+		{[]string{"spiffe://example.org/ci/deployer"}, true},
+		{[]string{"spiffe://example.org/ci"}, false},
+		{[]string{"10.0.0.7"}, true},
+		{[]string{"10.0.0.8"}, false},
+		{[]string{"other.example.org", "10.0.0.7"}, true},
+	} {
+		if got := clientCertAllowed(cert, tt.allowed); got != tt.want {
+			t.Errorf("clientCertAllowed(%v) = %v, want %v", tt.allowed, got, tt.want)
+		}
+	}
+}
+
+func TestLoadConfig_TLS(t *testing.T) {
+	cfg, err := loadConfig(nil, envMap(map[string]string{
+		"TLS_CERT":        "/etc/picosend/tls.crt",
+		"TLS_KEY":         "/etc/picosend/tls.key",
+		"TLS_CLIENT_CA":   "/etc/picosend/clients.pem",
+		"TLS_CLIENT_SANS": "deploy.example.org, spiffe://example.org/ci",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.TLS.ClientAuth() || len(cfg.TLS.ClientSANs) != 2 || cfg.TLS.ClientSANs[1] != "spiffe://example.org/ci" {
+		t.Errorf("TLS = %+v", cfg.TLS)
+	}
+
+	for _, args := range [][]string{
+		{"--tls-cert", "tls.crt"},
+		{"--tls-client-ca", "clients.pem"},
+		{"--tls-cert", "tls.crt", "--tls-key", "tls.key", "--tls-client-sans", "deploy.example.org"},
+	} {
+		if _, err := loadConfig(args, envMap(nil)); err == nil {
+			t.Errorf("loadConfig(%v) accepted", args)
+		}
+	}
+}
+
+func TestServe_ClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	serverCert := ca.issue(t, &x509.Certificate{
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(serverCert.PrivateKey)
+	writePEM(t, filepath.Join(dir, "tls.crt"), "CERTIFICATE", serverCert.Certificate[0])
+	writePEM(t, filepath.Join(dir, "tls.key"), "PRIVATE KEY", keyDER)
+	writePEM(t, filepath.Join(dir, "clients.pem"), "CERTIFICATE", ca.cert.Raw)
+
+	probe, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := probe.Addr().String()
+	probe.Close()
+
+	srv := newTestServer(t, func(cfg *Config) {
+		cfg.Listen = []string{addr}
+		cfg.TLS = TLSConfig{
+			CertFile:     filepath.Join(dir, "tls.crt"),
+			KeyFile:      filepath.Join(dir, "tls.key"),
+			ClientCAFile: filepath.Join(dir, "clients.pem"),
+			ClientSANs:   []string{"*.ci.example.org"},
+		}
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- srv.serve(ctx, &http.Server{Handler: srv.routes()}, time.Minute)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs},
+		}}
+	}
+	clientAuth := []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	allowed := ca.issue(t, &x509.Certificate{DNSNames: []string{"deploy.ci.example.org"}, ExtKeyUsage: clientAuth})
+	denied := ca.issue(t, &x509.Certificate{DNSNames: []string{"laptop.example.org"}, ExtKeyUsage: clientAuth})
+	foreign := newTestCA(t).issue(t, &x509.Certificate{DNSNames: []string{"deploy.ci.example.org"}, ExtKeyUsage: clientAuth})
+
+	var err error
+	for i := 0; i < 50; i++ {
+		var resp *http.Response
+		if resp, err = client().Get("https://" + addr + "/healthz"); err == nil {
+			resp.Body.Close()
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("server did not come up: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name   string
+		client *http.Client
+		path   string
+		want   int
+	}{
+		{"health without certificate", client(), "/healthz", http.StatusOK},
+		{"page without certificate", client(), "/", http.StatusOK},
+		{"API without certificate", client(), "/api/config", http.StatusUnauthorized},
+		{"API with allowed certificate", client(allowed), "/api/config", http.StatusOK},
+		{"API with other SAN", client(denied), "/api/config", http.StatusForbidden},
+		{"admin API with other SAN", client(denied), "/admin/api/stats", http.StatusForbidden},
+	} {
+		resp, err := tt.client.Get("https://" + addr + tt.path)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, resp.StatusCode, tt.want)
+		}
+	}
+
+	// A certificate from an unknown CA fails the handshake
+	if resp, err := client(foreign).Get("https://" + addr + "/api/config"); err == nil {
+		resp.Body.Close()
+		t.Errorf("certificate from another CA accepted, status %d", resp.StatusCode)
+	}
+}
+
+func TestTLSFiles_ReloadKeepsCertificateOnError(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	cert := ca.issue(t, &x509.Certificate{DNSNames: []string{"picosend.example.org"}})
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	writePEM(t, filepath.Join(dir, "tls.crt"), "CERTIFICATE", cert.Certificate[0])
+	writePEM(t, filepath.Join(dir, "tls.key"), "PRIVATE KEY", keyDER)
+
+	files, err := NewTLSFiles(TLSConfig{CertFile: filepath.Join(dir, "tls.crt"), KeyFile: filepath.Join(dir, "tls.key")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "tls.crt"), []byte("rotating"), 0o600)
+	if err := files.Reload(); err == nil {
+		t.Fatal("Reload accepted a broken certificate")
+	}
+	config, _ := files.TLSConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	if len(config.Certificates) != 1 || string(config.Certificates[0].Certificate[0]) != string(cert.Certificate[0]) {
+		t.Error("certificate was not kept after a failed reload")
+	}
+}
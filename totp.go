@@ -0,0 +1,112 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	TOTPDigits          = 6
+	TOTPPeriod          = 30 * time.Second
+	TOTPSkew            = 1  // Periods either side of the current one accepted, for clock drift
+	TOTPAttemptsPerStep = 5  // Codes a secret accepts attempts for per period, bounding guessing
+	MinTOTPSecretBytes  = 10 // 80 bits, the length authenticator apps generate
+	MaxTOTPSecretBytes  = 64
+)
+
+var (
+	ErrTOTPRequired  = errors.New("totp code required")
+	ErrTOTPInvalid   = errors.New("invalid totp code")
+	ErrTOTPThrottled = errors.New("too many totp attempts")
+)
+
+// parseTOTPSecret decodes a base32 TOTP seed as shown by authenticator apps, ignoring case,
+// spaces and padding
+func parseTOTPSecret(encoded string) ([]byte, error) {
+	encoded = strings.ToUpper(strings.TrimRight(strings.ReplaceAll(encoded, " ", ""), "="))
+	seed, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(encoded)
+	if err != nil || len(seed) < MinTOTPSecretBytes || len(seed) > MaxTOTPSecretBytes {
+		return nil, fmt.Errorf("totp_secret must be a base32 seed of %d to %d bytes", MinTOTPSecretBytes, MaxTOTPSecretBytes)
+	}
+	return seed, nil
+}
+
+// totpCode returns the RFC 6238 code of seed for a time step: HMAC-SHA1, 6 digits
+func totpCode(seed []byte, step int64) string {
+	mac := hmac.New(sha1.New, seed)
+	binary.Write(mac, binary.BigEndian, step)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", TOTPDigits, value%1000000)
+}
+
+// TOTPGate holds the seed a secret's reads are checked against, and the state that stops codes
+// being guessed or replayed. It is only used under the store lock of its secret.
+type TOTPGate struct {
+	seed     []byte
+	lastStep int64 // Step of the last accepted code; it and earlier ones are refused
+	step     int64 // Step attempts are being counted in
+	attempts int
+}
+
+func newTOTPGate(seed []byte) *TOTPGate {
+	return &TOTPGate{seed: seed}
+}
+
+// verify checks code against the current step and its neighbours. A code is accepted once,
+// and after TOTPAttemptsPerStep attempts within a step the rest are refused until the next
+// one, which is returned as the time to retry.
+func (g *TOTPGate) verify(code string, now time.Time) (time.Duration, error) {
+	if code == "" {
+		return 0, ErrTOTPRequired
+	}
+	step := now.Unix() / int64(TOTPPeriod/time.Second)
+	if step != g.step {
+		g.step, g.attempts = step, 0
+	}
+	if g.attempts >= TOTPAttemptsPerStep {
+		next := time.Unix((step+1)*int64(TOTPPeriod/time.Second), 0)
+		return next.Sub(now), ErrTOTPThrottled
+	}
+	g.attempts++
+
+	for s := step - TOTPSkew; s <= step+TOTPSkew; s++ {
+		if s > g.lastStep && subtle.ConstantTimeCompare([]byte(totpCode(g.seed, s)), []byte(code)) == 1 {
+			g.lastStep = s
+			return 0, nil
+		}
+	}
+	return 0, ErrTOTPInvalid
+}
+
+// wipe zeroes the seed
+func (g *TOTPGate) wipe() {
+	if g != nil {
+		wipeBytes(g.seed)
+	}
+}
+
+// VerifyTOTP checks a code for a TOTP-gated secret. Secrets without a seed accept any code.
+// Returns how long to wait with ErrTOTPThrottled.
+func (s *SecretStore) VerifyTOTP(id, code string, now time.Time) (time.Duration, error) {
+	sh := s.shardFor(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+
+	secret, exists := sh.secrets[keyOf(id)]
+	if !exists {
+		return 0, ErrSecretNotFound
+	}
+	if secret.TOTP == nil {
+		return 0, nil
+	}
+	return secret.TOTP.verify(code, now)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// rfc6238Seed is the SHA-1 seed of the RFC 6238 test vectors
+var rfc6238Seed = []byte("12345678901234567890")
+
+func TestTOTPCode_RFC6238(t *testing.T) {
+	// The RFC lists 8-digit codes, whose last 6 digits are the 6-digit code
+	for seconds, expected := range map[int64]string{59: "287082", 1111111109: "081804", 1234567890: "005924", 2000000000: "279037"} {
+		if code := totpCode(rfc6238Seed, seconds/30); code != expected {
+			t.Errorf("At %d: expected %s, got %s", seconds, expected, code)
+		}
+	}
+}
+
+func TestParseTOTPSecret(t *testing.T) {
+	seed, err := parseTOTPSecret("gezd gnbv gy3t qojq gezd gnbv gy3t qojq")
+	if err != nil || string(seed) != string(rfc6238Seed) {
+		t.Errorf("Expected a lowercase, spaced seed to decode, got %q, %v", seed, err)
+	}
+	for _, invalid := range []string{"JBSWY3DP", "not base32!", base32.StdEncoding.EncodeToString(make([]byte, MaxTOTPSecretBytes+1))} {
+		if _, err := parseTOTPSecret(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestTOTPGate_Verify(t *testing.T) {
+	gate := newTOTPGate(append([]byte(nil), rfc6238Seed...))
+	now := time.Unix(1111111109, 0)
+	step := now.Unix() / 30
+
+	if _, err := gate.verify("", now); !errors.Is(err, ErrTOTPRequired) {
+		t.Errorf("Expected a missing code to be required, got %v", err)
+	}
+	if _, err := gate.verify(totpCode(rfc6238Seed, step-1), now); err != nil {
+		t.Errorf("Expected the previous period's code to be accepted, got %v", err)
+	}
+	if _, err := gate.verify(totpCode(rfc6238Seed, step-1), now); !errors.Is(err, ErrTOTPInvalid) {
+		t.Errorf("Expected a used code to be refused, got %v", err)
+	}
+	if _, err := gate.verify(totpCode(rfc6238Seed, step+2), now); !errors.Is(err, ErrTOTPInvalid) {
+		t.Errorf("Expected a code two periods ahead to be refused, got %v", err)
+	}
+
+	for i := 0; i < TOTPAttemptsPerStep; i++ {
+		gate.verify("000000", now)
+	}
+	retry, err := gate.verify(totpCode(rfc6238Seed, step), now)
+	if !errors.Is(err, ErrTOTPThrottled) || retry <= 0 || retry > TOTPPeriod {
+		t.Errorf("Expected attempts to be throttled until the next period, got %v, %v", retry, err)
+	}
+	if _, err := gate.verify(totpCode(rfc6238Seed, step+1), now.Add(TOTPPeriod)); err != nil {
+		t.Errorf("Expected attempts to reset in the next period, got %v", err)
+	}
+}
+
+func TestClaimSecret_TOTP(t *testing.T) {
+	srv := newTestServer(t)
+	id, _ := srv.store.StoreWithOptions("content", time.Hour, SecretOptions{TOTPSecret: append([]byte(nil), rfc6238Seed...), MaxReads: 2})
+
+	if rec := claimSecret(t, srv, id, ClaimSecretRequest{}); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 without a code, got %d", rec.Code)
+	}
+	if rec := claimSecret(t, srv, id, ClaimSecretRequest{TOTP: "000000"}); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a wrong code, got %d", rec.Code)
+	}
+
+	code := totpCode(rfc6238Seed, time.Now().Unix()/30)
+	if rec := claimSecret(t, srv, id, ClaimSecretRequest{TOTP: code}); rec.Code != http.StatusOK {
+		t.Fatalf("Expected the current code to release the secret, got %d %s", rec.Code, rec.Body.String())
+	}
+	// The second read of a multi-view secret needs a fresh code
+	if rec := claimSecret(t, srv, id, ClaimSecretRequest{TOTP: code}); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a replayed code to be refused, got %d", rec.Code)
+	}
+}
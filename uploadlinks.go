@@ -0,0 +1,344 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const MaxUploadLinkLabelLength = 200
+
+var (
+	ErrUploadLinkNotFound = errors.New("upload link not found")
+	ErrUploadLinkUsed     = errors.New("upload link already used")
+)
+
+// Upload link states reported to the integrator
+const (
+	UploadLinkPending   = "pending"
+	UploadLinkSubmitted = "submitted"
+)
+
+// UploadLink lets a third party submit one secret to the integrator who created it. The
+// integrator keeps the encryption key and puts it in the link's fragment, so the server only
+// ever sees the submitter's ciphertext.
+type UploadLink struct {
+	ID        string
+	Label     string // Shown to the submitter, e.g. what is being asked for
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Lifetime  time.Duration // Lifetime of the submitted secret
+	MaxReads  int
+
+	managementToken [32]byte // SHA-256 of the token the integrator checks the status with
+	apiKey          *APIKey  // Key the link was created with, charged for the submitted secret
+	submitting      bool     // A submission is being stored
+	secretID        string   // Set once a secret has been submitted
+	submittedAt     time.Time
+}
+
+// UploadLinks holds unexpired upload links in memory
+type UploadLinks struct {
+	mu    sync.Mutex
+	links map[string]*UploadLink
+}
+
+func NewUploadLinks() *UploadLinks {
+	return &UploadLinks{links: make(map[string]*UploadLink)}
+}
+
+// Create stores link under a new ID and returns the ID and the link's management token
+func (u *UploadLinks) Create(link UploadLink, apiKey *APIKey) (string, string) {
+	token := generateToken()
+	link.ID = generateToken()
+	link.managementToken = sha256.Sum256([]byte(token))
+	link.apiKey = apiKey
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.links[link.ID] = &link
+	return link.ID, token
+}
+
+// Get returns a copy of an unexpired link
+func (u *UploadLinks) Get(id string, now time.Time) (UploadLink, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	link, ok := u.links[id]
+	if !ok || now.After(link.ExpiresAt) {
+		return UploadLink{}, ErrUploadLinkNotFound
+	}
+	return *link, nil
+}
+
+// Status returns a copy of a link after checking the integrator's management token
+func (u *UploadLinks) Status(id, token string, now time.Time) (UploadLink, error) {
+	link, err := u.Get(id, now)
+	if err != nil {
+		return UploadLink{}, err
+	}
+	hash := sha256.Sum256([]byte(token))
+	if subtle.ConstantTimeCompare(hash[:], link.managementToken[:]) != 1 {
+		return UploadLink{}, ErrInvalidManagementToken
+	}
+	return link, nil
+}
+
+// Reserve claims a pending link for one submission, so concurrent submissions can't both be stored
+func (u *UploadLinks) Reserve(id string, now time.Time) (UploadLink, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	link, ok := u.links[id]
+	if !ok || now.After(link.ExpiresAt) {
+		return UploadLink{}, ErrUploadLinkNotFound
+	}
+	if link.submitting || link.secretID != "" {
+		return UploadLink{}, ErrUploadLinkUsed
+	}
+	link.submitting = true
+	return *link, nil
+}
+
+// Complete records the secret stored for a reserved link, or frees the link again when
+// secretID is empty because storing failed
+func (u *UploadLinks) Complete(id, secretID string, now time.Time) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if link, ok := u.links[id]; ok {
+		link.submitting = false
+		link.secretID, link.submittedAt = secretID, now
+	}
+}
+
+// Prune removes expired links. Returns the number removed.
+func (u *UploadLinks) Prune(now time.Time) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	count := 0
+	for id, link := range u.links {
+		if now.After(link.ExpiresAt) {
+			delete(u.links, id)
+			count++
+		}
+	}
+	return count
+}
+
+type CreateUploadLinkRequest struct {
+	Label     string `json:"label,omitempty"`
+	ExpiresIn int    `json:"expires_in"` // Minutes the link can be used; the default lifetime when 0
+	Lifetime  int    `json:"lifetime"`   // Minutes the submitted secret is kept; the default lifetime when 0
+	MaxReads  int    `json:"max_reads"`
+}
+
+type CreateUploadLinkResponse struct {
+	ID              string `json:"id"`               // Share <server>/u/<id>#<key> with the submitter
+	ManagementToken string `json:"management_token"` // For GET /api/upload-links/{id}
+	ExpiresAt       string `json:"expires_at"`
+}
+
+type UploadLinkStatusResponse struct {
+	ID          string `json:"id"`
+	Status      string `json:"status"` // pending or submitted
+	ExpiresAt   string `json:"expires_at"`
+	SecretID    string `json:"secret_id,omitempty"`
+	SubmittedAt string `json:"submitted_at,omitempty"`
+}
+
+type SubmitUploadLinkRequest struct {
+	Content string `json:"content"` // Encrypted with the key from the link's fragment
+	Type    string `json:"type,omitempty"`
+}
+
+// createUploadLinkHandler lets an API key holder mint a single-use link for receiving a secret
+func (srv *Server) createUploadLinkHandler(w http.ResponseWriter, r *http.Request) {
+	apiKey, ok := srv.requestAPIKey(w, r)
+	if !ok {
+		return
+	}
+	if apiKey == nil {
+		localizedError(w, r, http.StatusUnauthorized, "error.api_key_required")
+		return
+	}
+
+	var req CreateUploadLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "error.invalid_json")
+		return
+	}
+
+	limits := srv.secretLimits(apiKey)
+	if req.ExpiresIn == 0 {
+		req.ExpiresIn = limits.DefaultLifetime
+	}
+	if req.Lifetime == 0 {
+		req.Lifetime = limits.DefaultLifetime
+	}
+	for _, minutes := range []int{req.ExpiresIn, req.Lifetime} {
+		if minutes < limits.MinLifetime || minutes > limits.MaxLifetime {
+			localizedError(w, r, http.StatusBadRequest, "error.lifetime_range", limits.MinLifetime, limits.MaxLifetime)
+			return
+		}
+	}
+	if req.MaxReads < 0 || req.MaxReads > MaxReadsLimit {
+		localizedError(w, r, http.StatusBadRequest, "error.max_reads_range", MaxReadsLimit)
+		return
+	}
+	if len(req.Label) > MaxUploadLinkLabelLength {
+		localizedError(w, r, http.StatusBadRequest, "error.label_too_long", MaxUploadLinkLabelLength)
+		return
+	}
+
+	now := time.Now()
+	link := UploadLink{
+		Label:     strings.TrimSpace(req.Label),
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Duration(req.ExpiresIn) * srv.lifetimeUnit()),
+		Lifetime:  time.Duration(req.Lifetime) * srv.lifetimeUnit(),
+		MaxReads:  req.MaxReads,
+	}
+	id, token := srv.uploadLinks.Create(link, apiKey)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(CreateUploadLinkResponse{
+		ID:              id,
+		ManagementToken: token,
+		ExpiresAt:       link.ExpiresAt.UTC().Format(time.RFC3339),
+	})
+}
+
+// uploadLinkStatusHandler tells the integrator whether a secret was submitted and its ID
+func (srv *Server) uploadLinkStatusHandler(w http.ResponseWriter, r *http.Request) {
+	token, ok := managementToken(w, r)
+	if !ok {
+		return
+	}
+
+	link, err := srv.uploadLinks.Status(mux.Vars(r)["id"], token, time.Now())
+	switch {
+	case errors.Is(err, ErrUploadLinkNotFound):
+		localizedError(w, r, http.StatusNotFound, "error.upload_link_not_found")
+		return
+	case errors.Is(err, ErrInvalidManagementToken):
+		localizedError(w, r, http.StatusForbidden, "error.invalid_management_token")
+		return
+	}
+
+	resp := UploadLinkStatusResponse{
+		ID:        link.ID,
+		Status:    UploadLinkPending,
+		ExpiresAt: link.ExpiresAt.UTC().Format(time.RFC3339),
+	}
+	if link.secretID != "" {
+		resp.Status = UploadLinkSubmitted
+		resp.SecretID = srv.signID(link.secretID)
+		resp.SubmittedAt = link.submittedAt.UTC().Format(time.RFC3339)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// submitUploadLinkHandler stores the secret sent through an upload link. The link can't be used again.
+func (srv *Server) submitUploadLinkHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var req SubmitUploadLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "error.invalid_json")
+		return
+	}
+	if req.Content == "" {
+		localizedError(w, r, http.StatusBadRequest, "error.content_empty")
+		return
+	}
+	if req.Type != "" && req.Type != SecretTypeText && req.Type != SecretTypeCredentials {
+		localizedError(w, r, http.StatusBadRequest, "error.type_invalid", SecretTypeText, SecretTypeCredentials)
+		return
+	}
+
+	now := time.Now()
+	link, err := srv.uploadLinks.Reserve(id, now)
+	switch {
+	case errors.Is(err, ErrUploadLinkNotFound):
+		localizedError(w, r, http.StatusNotFound, "error.upload_link_not_found")
+		return
+	case errors.Is(err, ErrUploadLinkUsed):
+		localizedError(w, r, http.StatusConflict, "error.upload_link_used")
+		return
+	}
+	secretID, ok := srv.storeUploadLinkSecret(w, r, link, req)
+	srv.uploadLinks.Complete(id, secretID, time.Now())
+	if !ok {
+		return
+	}
+
+	srv.recordCreated(r, secretID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// storeUploadLinkSecret stores a submission within the limits of the link's API key, replying
+// with an error and returning false when it can't be stored
+func (srv *Server) storeUploadLinkSecret(w http.ResponseWriter, r *http.Request, link UploadLink, req SubmitUploadLinkRequest) (string, bool) {
+	// A key revoked since the link was created can't be charged any more
+	if !srv.apiKeys.Active(link.apiKey) {
+		localizedError(w, r, http.StatusNotFound, "error.upload_link_not_found")
+		return "", false
+	}
+
+	limits := srv.secretLimits(link.apiKey)
+	if maxLength := limits.MaxSecretLength * 2; len(req.Content) > maxLength {
+		localizedError(w, r, http.StatusBadRequest, "error.content_too_long", maxLength)
+		return "", false
+	}
+	if err := srv.apiKeys.Consume(link.apiKey, time.Now()); err != nil {
+		localizedError(w, r, http.StatusTooManyRequests, "error.api_key_quota")
+		return "", false
+	}
+
+	opts := SecretOptions{MaxReads: link.MaxReads, Type: req.Type}
+	if tenant := link.apiKey.Tenant; tenant != "" {
+		tenantLimits, _ := srv.tenants.Limits(tenant)
+		opts.Tenant, opts.TenantMaxUnread = tenant, tenantLimits.MaxUnreadSecrets
+	}
+	secretID, err := srv.store.StoreWithOptions(req.Content, link.Lifetime, opts)
+	if err != nil {
+		srv.apiKeys.Refund(link.apiKey)
+		localizedError(w, r, http.StatusTooManyRequests, "error.store_unavailable")
+		return "", false
+	}
+	return secretID, true
+}
+
+// uploadLinkHandler renders the page a submitter enters the secret on
+func (srv *Server) uploadLinkHandler(w http.ResponseWriter, r *http.Request) {
+	locale := requestLocale(w, r)
+	data := struct {
+		Lang      string
+		BasePath  string
+		Brand     Branding
+		Theme     string
+		ID        string
+		Label     string
+		Available bool
+		Nonce     string
+	}{
+		Lang:     locale.Tag,
+		BasePath: srv.config.BasePath,
+		Brand:    srv.config.Branding,
+		Theme:    requestTheme(w, r),
+		ID:       mux.Vars(r)["id"],
+		Nonce:    srv.scriptNonce(w),
+	}
+	if link, err := srv.uploadLinks.Get(data.ID, time.Now()); err == nil && link.secretID == "" {
+		data.Label, data.Available = link.Label, true
+	}
+
+	srv.renderPage(w, locale, "upload-link.html", data)
+}
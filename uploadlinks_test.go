@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUploadLinks_Flow(t *testing.T) {
+	srv := newTestServer(t)
+	router := srv.routes()
+	_, apiKey := srv.apiKeys.Create("intake", "", APIKeyLimits{})
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do("POST", "/api/upload-links", "", `{}`); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected creating without an API key to be rejected, got %d", rec.Code)
+	}
+
+	rec := do("POST", "/api/upload-links", apiKey, `{"label": "Database password", "lifetime": 60}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created CreateUploadLinkResponse
+	json.NewDecoder(rec.Body).Decode(&created)
+
+	rec = do("GET", "/u/"+created.ID, "", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Database password") || !strings.Contains(rec.Body.String(), "uploadForm") {
+		t.Errorf("Expected the upload page with its form, got %d", rec.Code)
+	}
+
+	if rec := do("GET", "/api/upload-links/"+created.ID, "wrong", ""); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a wrong management token to be rejected, got %d", rec.Code)
+	}
+	var status UploadLinkStatusResponse
+	json.NewDecoder(do("GET", "/api/upload-links/"+created.ID, created.ManagementToken, "").Body).Decode(&status)
+	if status.Status != UploadLinkPending || status.SecretID != "" {
+		t.Errorf("Expected a pending link, got %+v", status)
+	}
+
+	if rec := do("POST", "/api/upload-links/"+created.ID+"/submit", "", `{"content": "encrypted"}`); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := do("POST", "/api/upload-links/"+created.ID+"/submit", "", `{"content": "again"}`); rec.Code != http.StatusConflict {
+		t.Errorf("Expected a second submission to be rejected, got %d", rec.Code)
+	}
+
+	json.NewDecoder(do("GET", "/api/upload-links/"+created.ID, created.ManagementToken, "").Body).Decode(&status)
+	if status.Status != UploadLinkSubmitted || status.SecretID == "" {
+		t.Fatalf("Expected the submitted secret's ID, got %+v", status)
+	}
+	var claimed GetSecretResponse
+	json.NewDecoder(claimSecret(t, srv, status.SecretID, ClaimSecretRequest{}).Body).Decode(&claimed)
+	if claimed.Content != "encrypted" {
+		t.Errorf("Expected the submitted content, got %q", claimed.Content)
+	}
+
+	rec = do("GET", "/u/"+created.ID, "", "")
+	if strings.Contains(rec.Body.String(), "uploadForm") {
+		t.Error("Expected a used link to no longer show the form")
+	}
+}
+
+func TestUploadLinks_Expired(t *testing.T) {
+	links := NewUploadLinks()
+	now := time.Now()
+	id, _ := links.Create(UploadLink{ExpiresAt: now.Add(time.Minute)}, nil)
+
+	if _, err := links.Reserve(id, now.Add(2*time.Minute)); err != ErrUploadLinkNotFound {
+		t.Errorf("Expected an expired link to be refused, got %v", err)
+	}
+	if removed := links.Prune(now.Add(2 * time.Minute)); removed != 1 {
+		t.Errorf("Expected 1 link pruned, got %d", removed)
+	}
+}
+
+func TestUploadLinks_FailedSubmissionFreesLink(t *testing.T) {
+	links := NewUploadLinks()
+	now := time.Now()
+	id, _ := links.Create(UploadLink{ExpiresAt: now.Add(time.Hour)}, nil)
+
+	links.Reserve(id, now)
+	if _, err := links.Reserve(id, now); err != ErrUploadLinkUsed {
+		t.Errorf("Expected a reserved link to refuse another submission, got %v", err)
+	}
+	links.Complete(id, "", now)
+	if _, err := links.Reserve(id, now); err != nil {
+		t.Errorf("Expected the link to be usable after a failed submission, got %v", err)
+	}
+}
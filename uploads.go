@@ -0,0 +1,358 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	MaxChunkSize      = 1 << 20          // Maximum size of one uploaded chunk in bytes
+	MaxPendingUploads = 100              // Maximum number of uncommitted chunked uploads
+	MaxPendingBytes   = 256 << 20        // Chunks held across all uncommitted uploads, unless one upload may be larger
+	UploadTimeout     = 30 * time.Minute // Uncommitted uploads are dropped after this long without a chunk
+	MaxUploadChunks   = 4096             // Chunks are numbered from 0 up to this limit
+	DefaultUploadSize = 16 << 20         // Default maximum size of a chunked upload in bytes
+)
+
+var (
+	ErrUploadNotFound     = errors.New("upload not found")
+	ErrUploadIncomplete   = errors.New("upload is missing chunks")
+	ErrTooManyUploads     = errors.New("too many uploads in progress")
+	ErrUploadsFull        = errors.New("too much upload data in progress")
+	ErrUploadSizeExceeded = errors.New("upload exceeds the maximum size")
+)
+
+// pendingUpload is a secret whose encrypted content is still being uploaded in chunks.
+// It becomes a regular secret with the same ID when committed.
+type pendingUpload struct {
+	lifetime     time.Duration
+	opts         SecretOptions
+	tokenHash    [sha256.Size]byte
+	chunks       map[int]*lockedBuffer
+	size         int
+	lastActivity time.Time
+}
+
+// UploadStore holds chunked uploads until they are committed, aborted or time out. Chunks are
+// kept in protected memory like stored content and count against the store's memory budget.
+type UploadStore struct {
+	store      *SecretStore // Receives committed uploads
+	mu         sync.Mutex
+	uploads    map[string]*pendingUpload
+	maxSize    int
+	pending    int // Bytes of chunks across all uploads
+	maxPending int // Limit on pending, unless maxSize is larger
+}
+
+func NewUploadStore(store *SecretStore, maxSize int) *UploadStore {
+	return &UploadStore{store: store, uploads: make(map[string]*pendingUpload), maxSize: maxSize, maxPending: MaxPendingBytes}
+}
+
+// MaxSize returns the maximum size of an upload in bytes
+func (u *UploadStore) MaxSize() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.maxSize
+}
+
+// SetMaxSize changes the maximum upload size. Chunks already received are kept even if they exceed it.
+func (u *UploadStore) SetMaxSize(maxSize int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.maxSize = maxSize
+}
+
+// Begin reserves an upload for a secret created with opts, which must carry the ID and management token
+func (u *UploadStore) Begin(lifetime time.Duration, opts SecretOptions) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.pruneLocked(time.Now())
+	if len(u.uploads) >= MaxPendingUploads {
+		return ErrTooManyUploads
+	}
+	if _, exists := u.uploads[opts.ID]; exists {
+		return ErrIDTaken
+	}
+	u.uploads[opts.ID] = &pendingUpload{
+		lifetime:     lifetime,
+		opts:         opts,
+		tokenHash:    sha256.Sum256([]byte(opts.ManagementToken)),
+		chunks:       make(map[int]*lockedBuffer),
+		lastActivity: time.Now(),
+	}
+	return nil
+}
+
+// lookup returns the upload after checking the management token. Must be called with u.mu held.
+func (u *UploadStore) lookup(id, token string, now time.Time) (*pendingUpload, error) {
+	upload, ok := u.uploads[id]
+	if !ok || now.Sub(upload.lastActivity) > UploadTimeout {
+		return nil, ErrUploadNotFound
+	}
+	hash := sha256.Sum256([]byte(token))
+	if subtle.ConstantTimeCompare(hash[:], upload.tokenHash[:]) != 1 {
+		return nil, ErrInvalidManagementToken
+	}
+	return upload, nil
+}
+
+// PutChunk stores chunk number index, replacing an earlier upload of the same chunk so
+// interrupted transfers can be resumed. data is copied into protected memory and zeroed.
+func (u *UploadStore) PutChunk(id, token string, index int, data []byte) error {
+	defer wipeBytes(data)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	now := time.Now()
+	upload, err := u.lookup(id, token, now)
+	if err != nil {
+		return err
+	}
+	previous := upload.chunks[index]
+	growth := len(data) - len(previous.Bytes())
+	if upload.size+growth > u.maxSize {
+		return ErrUploadSizeExceeded
+	}
+	if u.pending+growth > max(u.maxPending, u.maxSize) {
+		return ErrUploadsFull
+	}
+	if err := u.store.reserveBytes(growth); err != nil {
+		return err
+	}
+	previous.Destroy()
+	upload.chunks[index] = newLockedBuffer(data)
+	upload.size += growth
+	u.pending += growth
+	upload.lastActivity = now
+	return nil
+}
+
+// UploadChunk describes a received chunk
+type UploadChunk struct {
+	Index int `json:"index"`
+	Size  int `json:"size"`
+}
+
+// Chunks lists the received chunks in order
+func (u *UploadStore) Chunks(id, token string) ([]UploadChunk, int, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	upload, err := u.lookup(id, token, time.Now())
+	if err != nil {
+		return nil, 0, err
+	}
+	chunks := make([]UploadChunk, 0, len(upload.chunks))
+	for index, chunk := range upload.chunks {
+		chunks = append(chunks, UploadChunk{Index: index, Size: len(chunk.Bytes())})
+	}
+	sort.Slice(chunks, func(i, j int) bool { return chunks[i].Index < chunks[j].Index })
+	return chunks, upload.size, nil
+}
+
+// Commit assembles chunks 0 to count-1 and stores them as the secret. Chunks are removed
+// from the upload store whether or not the secret could be stored.
+func (u *UploadStore) Commit(id, token string, count int) error {
+	u.mu.Lock()
+	upload, err := u.lookup(id, token, time.Now())
+	if err == nil && (count <= 0 || count != len(upload.chunks)) {
+		err = ErrUploadIncomplete
+	}
+	if err == nil {
+		for i := 0; i < count; i++ {
+			if _, ok := upload.chunks[i]; !ok {
+				err = ErrUploadIncomplete
+				break
+			}
+		}
+	}
+	if err != nil {
+		u.mu.Unlock()
+		return err
+	}
+	delete(u.uploads, id)
+	content := make([]byte, 0, upload.size)
+	for i := 0; i < count; i++ {
+		content = append(content, upload.chunks[i].Bytes()...)
+	}
+	// The stored secret takes its own share of the budget
+	u.dropChunks(upload)
+	u.mu.Unlock()
+
+	_, err = u.store.storeContent(content, upload.lifetime, upload.opts)
+	return err
+}
+
+// Abort drops an upload before it is committed
+func (u *UploadStore) Abort(id, token string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	upload, err := u.lookup(id, token, time.Now())
+	if err != nil {
+		return err
+	}
+	delete(u.uploads, id)
+	u.dropChunks(upload)
+	return nil
+}
+
+// Prune drops uploads that received no chunk within UploadTimeout and returns how many
+func (u *UploadStore) Prune(now time.Time) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.pruneLocked(now)
+}
+
+func (u *UploadStore) pruneLocked(now time.Time) int {
+	count := 0
+	for id, upload := range u.uploads {
+		if now.Sub(upload.lastActivity) > UploadTimeout {
+			delete(u.uploads, id)
+			u.dropChunks(upload)
+			count++
+		}
+	}
+	return count
+}
+
+// dropChunks destroys the upload's chunks and gives back their memory budget. Must be called
+// with u.mu held.
+func (u *UploadStore) dropChunks(upload *pendingUpload) {
+	for index, chunk := range upload.chunks {
+		chunk.Destroy()
+		delete(upload.chunks, index)
+	}
+	u.store.releaseBytes(upload.size)
+	u.pending -= upload.size
+	upload.size = 0
+}
+
+type UploadStatusResponse struct {
+	ID      string        `json:"id"`
+	Chunks  []UploadChunk `json:"chunks"`
+	Size    int           `json:"size"`
+	MaxSize int           `json:"max_size"`
+}
+
+type CommitUploadRequest struct {
+	Chunks int `json:"chunks"` // Number of chunks, numbered from 0
+}
+
+// uploadError maps upload errors to responses
+func (srv *Server) uploadError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrUploadNotFound):
+		localizedError(w, r, http.StatusNotFound, "error.not_found")
+	case errors.Is(err, ErrInvalidManagementToken):
+		localizedError(w, r, http.StatusForbidden, "error.invalid_management_token")
+	case errors.Is(err, ErrUploadSizeExceeded):
+		apiError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("Upload exceeds maximum size of %d bytes", srv.uploads.MaxSize()))
+	case errors.Is(err, ErrUploadIncomplete):
+		apiError(w, r, http.StatusConflict, err.Error())
+	case errors.Is(err, ErrTenantFull):
+		localizedError(w, r, http.StatusTooManyRequests, "error.tenant_full")
+	case errors.Is(err, ErrClusterUnavailable):
+		localizedError(w, r, http.StatusServiceUnavailable, "error.cluster_unavailable")
+	case errors.Is(err, ErrHashingBusy):
+		localizedError(w, r, http.StatusServiceUnavailable, "error.hashing_busy")
+	case tenantOf(mux.Vars(r)["id"]) != "":
+		localizedError(w, r, http.StatusTooManyRequests, "error.store_unavailable")
+	default:
+		apiError(w, r, http.StatusTooManyRequests, err.Error())
+	}
+}
+
+// managementToken extracts the bearer token, replying 401 when it is missing
+func managementToken(w http.ResponseWriter, r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		localizedError(w, r, http.StatusUnauthorized, "error.management_token_required")
+		return "", false
+	}
+	return token, true
+}
+
+// putChunkHandler receives one chunk of encrypted content as the raw request body
+func (srv *Server) putChunkHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	token, ok := managementToken(w, r)
+	if !ok {
+		return
+	}
+
+	index, err := strconv.Atoi(vars["index"])
+	if err != nil || index < 0 || index >= MaxUploadChunks {
+		apiError(w, r, http.StatusBadRequest, "Invalid chunk index")
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, MaxChunkSize+1))
+	if err != nil {
+		apiError(w, r, http.StatusBadRequest, "Failed to read chunk")
+		return
+	}
+	if len(data) == 0 || len(data) > MaxChunkSize {
+		apiError(w, r, http.StatusBadRequest, fmt.Sprintf("Chunks must be between 1 and %d bytes", MaxChunkSize))
+		return
+	}
+
+	if err := srv.uploads.PutChunk(vars["id"], token, index, data); err != nil {
+		srv.uploadError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listChunksHandler reports the chunks received so far, so a client can resume an upload
+func (srv *Server) listChunksHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	token, ok := managementToken(w, r)
+	if !ok {
+		return
+	}
+
+	chunks, size, err := srv.uploads.Chunks(id, token)
+	if err != nil {
+		srv.uploadError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(UploadStatusResponse{ID: srv.signID(id), Chunks: chunks, Size: size, MaxSize: srv.uploads.MaxSize()})
+}
+
+// commitUploadHandler turns a completed upload into a readable secret
+func (srv *Server) commitUploadHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	token, ok := managementToken(w, r)
+	if !ok {
+		return
+	}
+
+	var req CommitUploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		localizedError(w, r, http.StatusBadRequest, "error.invalid_json")
+		return
+	}
+
+	if err := srv.uploads.Commit(id, token, req.Chunks); err != nil {
+		srv.uploadError(w, r, err)
+		return
+	}
+	srv.recordCreated(r, id)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createChunkedSecret starts a chunked upload through the API
+func createChunkedSecret(t *testing.T, serverURL string) CreateSecretResponse {
+	t.Helper()
+	resp, err := http.Post(serverURL+"/api/secrets", "application/json", strings.NewReader(`{"chunked": true, "lifetime": 60}`))
+	if err != nil {
+		t.Fatalf("Failed to create secret: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	var created CreateSecretResponse
+	json.NewDecoder(resp.Body).Decode(&created)
+	return created
+}
+
+func uploadRequest(t *testing.T, method, url, token, body string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	return resp
+}
+
+func TestChunkedUpload(t *testing.T) {
+	_, server := setupTestServer(t)
+	defer server.Close()
+	created := createChunkedSecret(t, server.URL)
+	base := server.URL + "/api/secrets/" + created.ID
+
+	// Not readable until committed
+	resp := uploadRequest(t, "GET", base, "", "")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected uncommitted secret to be unreadable, got %d", resp.StatusCode)
+	}
+
+	// Chunks may arrive in any order, and a repeated chunk replaces the earlier one
+	for _, chunk := range []struct{ index, data string }{{"1", "second-"}, {"0", "partial"}, {"0", "first-"}, {"2", "third"}} {
+		resp := uploadRequest(t, "PUT", base+"/chunks/"+chunk.index, created.ManagementToken, chunk.data)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("Expected chunk %s to be stored, got %d", chunk.index, resp.StatusCode)
+		}
+	}
+
+	resp = uploadRequest(t, "GET", base+"/chunks", created.ManagementToken, "")
+	var status UploadStatusResponse
+	json.NewDecoder(resp.Body).Decode(&status)
+	resp.Body.Close()
+	if len(status.Chunks) != 3 || status.Size != len("first-second-third") || status.Chunks[0].Size != len("first-") {
+		t.Errorf("Unexpected upload status %+v", status)
+	}
+
+	resp = uploadRequest(t, "POST", base+"/chunks/commit", created.ManagementToken, `{"chunks": 4}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected commit with a missing chunk to fail with 409, got %d", resp.StatusCode)
+	}
+
+	resp = uploadRequest(t, "POST", base+"/chunks/commit", created.ManagementToken, `{"chunks": 3}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected commit to succeed, got %d", resp.StatusCode)
+	}
+
+	resp, err := claimSecretHTTP(server.URL, created.ID)
+	if err != nil {
+		t.Fatalf("Failed to claim secret: %v", err)
+	}
+	var secret GetSecretResponse
+	json.NewDecoder(resp.Body).Decode(&secret)
+	resp.Body.Close()
+	if secret.Content != "first-second-third" {
+		t.Errorf("Expected assembled content, got %q", secret.Content)
+	}
+
+	// The upload is gone once committed
+	resp = uploadRequest(t, "PUT", base+"/chunks/3", created.ManagementToken, "late")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected upload to be closed after commit, got %d", resp.StatusCode)
+	}
+}
+
+func TestChunkedUpload_Errors(t *testing.T) {
+	srv, server := setupTestServer(t)
+	defer server.Close()
+	srv.uploads = NewUploadStore(srv.store, 10)
+
+	created := createChunkedSecret(t, server.URL)
+	base := server.URL + "/api/secrets/" + created.ID
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		token    string
+		body     string
+		expected int
+	}{
+		{"missing token", "PUT", "/chunks/0", "", "data", http.StatusUnauthorized},
+		{"wrong token", "PUT", "/chunks/0", "wrong", "data", http.StatusForbidden},
+		{"invalid index", "PUT", "/chunks/-1", created.ManagementToken, "data", http.StatusBadRequest},
+		{"index too large", "PUT", "/chunks/4096", created.ManagementToken, "data", http.StatusBadRequest},
+		{"empty chunk", "PUT", "/chunks/0", created.ManagementToken, "", http.StatusBadRequest},
+		{"within size", "PUT", "/chunks/0", created.ManagementToken, "0123456789", http.StatusNoContent},
+		{"over size", "PUT", "/chunks/1", created.ManagementToken, "x", http.StatusRequestEntityTooLarge},
+		{"abort", "DELETE", "", created.ManagementToken, "", http.StatusNoContent},
+		{"aborted", "GET", "/chunks", created.ManagementToken, "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		resp := uploadRequest(t, tt.method, base+tt.path, tt.token, tt.body)
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expected, resp.StatusCode)
+		}
+	}
+
+	resp, _ := http.Post(server.URL+"/api/secrets", "application/json", strings.NewReader(`{"chunked": true, "content": "inline"}`))
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected inline content with chunked to be rejected, got %d", resp.StatusCode)
+	}
+}
+
+func TestUploadStore_MemoryBudget(t *testing.T) {
+	store := NewSecretStore()
+	store.SetLimits(Limits{MaxUnreadSecrets: 10, MaxSecretLength: MaxSecretLength, MaxStoreBytes: 10})
+	uploads := NewUploadStore(store, DefaultUploadSize)
+	for _, id := range []string{"a", "b"} {
+		if err := uploads.Begin(time.Hour, SecretOptions{ID: id, ManagementToken: "token"}); err != nil {
+			t.Fatalf("Failed to begin upload: %v", err)
+		}
+	}
+
+	// Pending chunks take their share of the budget like stored content
+	if err := uploads.PutChunk("a", "token", 0, []byte("123456")); err != nil {
+		t.Fatalf("Expected the chunk to fit, got %v", err)
+	}
+	if err := uploads.PutChunk("b", "token", 0, []byte("123456")); err == nil {
+		t.Error("Expected a chunk beyond the memory budget to be refused")
+	}
+	if store.BytesUsed() != 6 {
+		t.Errorf("Expected 6 bytes in use, got %d", store.BytesUsed())
+	}
+	uploads.Abort("a", "token")
+	if store.BytesUsed() != 0 {
+		t.Errorf("Expected an aborted upload to give back its bytes, got %d", store.BytesUsed())
+	}
+
+	if err := uploads.PutChunk("b", "token", 0, []byte("123456")); err != nil {
+		t.Fatalf("Expected the chunk to fit once the budget is free, got %v", err)
+	}
+	if err := uploads.Commit("b", "token", 1); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if store.BytesUsed() != 6 {
+		t.Errorf("Expected only the committed secret's bytes in use, got %d", store.BytesUsed())
+	}
+}
+
+func TestUploadStore_PendingBytesCap(t *testing.T) {
+	uploads := NewUploadStore(NewSecretStore(), 4)
+	uploads.maxPending = 12
+	for i := 0; i < 3; i++ {
+		id := strconv.Itoa(i)
+		uploads.Begin(time.Hour, SecretOptions{ID: id, ManagementToken: "token"})
+		if err := uploads.PutChunk(id, "token", 0, []byte("1234")); err != nil {
+			t.Fatalf("Upload %d: expected the chunk to fit, got %v", i, err)
+		}
+	}
+	uploads.Begin(time.Hour, SecretOptions{ID: "last", ManagementToken: "token"})
+	if err := uploads.PutChunk("last", "token", 0, []byte("x")); !errors.Is(err, ErrUploadsFull) {
+		t.Errorf("Expected ErrUploadsFull, got %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const DefaultVaultPrefix = "picosend/"
+
+// VaultConfig configures the HashiCorp Vault server used for the KV v2 storage backend and
+// vault-transit KMS keys
+type VaultConfig struct {
+	Addr      string // e.g. https://vault.example.com:8200
+	Token     string
+	Mount     string // KV v2 mount secret content is stored in; empty disables the backend
+	Prefix    string // Path prefix below the mount, e.g. picosend/
+	Threshold int    // Content at least this many bytes is stored in Vault; 0 stores everything there
+}
+
+// Enabled reports whether secret content is stored in Vault
+func (c VaultConfig) Enabled() bool {
+	return c.Mount != ""
+}
+
+// VaultBlobStore stores content as KV v2 secrets. Each entry's metadata carries its expiry and a
+// delete_version_after TTL, and picosend deletes the metadata, destroying every version, once
+// the secret is read, expires or is burned.
+type VaultBlobStore struct {
+	config VaultConfig
+	base   string // <addr>/v1/<mount>
+	client *http.Client
+}
+
+// NewVaultBlobStore creates a blob store for the configured KV v2 mount
+func NewVaultBlobStore(config VaultConfig) (*VaultBlobStore, error) {
+	addr, err := url.Parse(config.Addr)
+	if err != nil || addr.Host == "" || (addr.Scheme != "http" && addr.Scheme != "https") {
+		return nil, fmt.Errorf("invalid vault address %q", config.Addr)
+	}
+	return &VaultBlobStore{
+		config: config,
+		base:   strings.TrimSuffix(config.Addr, "/") + "/v1/" + strings.Trim(config.Mount, "/"),
+		client: &http.Client{Timeout: BlobRequestTimeout},
+	}, nil
+}
+
+func (b *VaultBlobStore) path(kind, id string) string {
+	return b.base + "/" + kind + "/" + b.config.Prefix + url.PathEscape(id)
+}
+
+// putMetadata sets the entry's expiry. Vault counts delete_version_after from the version's
+// creation, which happens just before createdAt, so a second is added for the difference.
+func (b *VaultBlobStore) putMetadata(ctx context.Context, id string, createdAt, expiresAt time.Time) error {
+	ttl := max(int(math.Ceil(expiresAt.Sub(createdAt).Seconds()))+1, 1)
+	return b.write(ctx, "POST", b.path("metadata", id), map[string]any{
+		"max_versions":         1,
+		"delete_version_after": fmt.Sprintf("%ds", ttl),
+		"custom_metadata":      map[string]string{"expires_at": expiresAt.UTC().Format(time.RFC3339)},
+	})
+}
+
+// Put writes the entry's metadata with its TTL first, so the data is never stored without one
+func (b *VaultBlobStore) Put(ctx context.Context, id string, data []byte, expiresAt time.Time) error {
+	if err := b.putMetadata(ctx, id, time.Now(), expiresAt); err != nil {
+		return err
+	}
+
+	entry := map[string]any{
+		"options": map[string]int{"cas": 0}, // Never overwrite an existing entry
+		"data":    map[string]string{"content": base64.StdEncoding.EncodeToString(data)},
+	}
+	if err := b.write(ctx, "POST", b.path("data", id), entry); err != nil {
+		b.Delete(ctx, id)
+		return err
+	}
+	return nil
+}
+
+// SetExpiry moves the TTL of an entry whose secret was extended or shortened
+func (b *VaultBlobStore) SetExpiry(ctx context.Context, id string, createdAt, expiresAt time.Time) error {
+	return b.putMetadata(ctx, id, createdAt, expiresAt)
+}
+
+// Get reads the latest version stored under id
+func (b *VaultBlobStore) Get(ctx context.Context, id string) ([]byte, error) {
+	resp, err := b.do(ctx, "GET", b.path("data", id), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound: // Also returned once delete_version_after has passed
+		return nil, ErrBlobNotFound
+	default:
+		return nil, fmt.Errorf("vault get returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data struct {
+			Data struct {
+				Content string `json:"content"`
+			} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(body.Data.Data.Content)
+}
+
+// Delete removes the metadata and every version stored under id. Vault returns 204 for missing paths too.
+func (b *VaultBlobStore) Delete(ctx context.Context, id string) error {
+	return b.write(ctx, "DELETE", b.path("metadata", id), nil)
+}
+
+// Check verifies the token is valid, for use as a readiness check
+func (b *VaultBlobStore) Check(ctx context.Context) error {
+	resp, err := b.do(ctx, "GET", strings.TrimSuffix(b.config.Addr, "/")+"/v1/auth/token/lookup-self", nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault token lookup returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// write sends body as JSON, expecting 200 or 204 in reply
+func (b *VaultBlobStore) write(ctx context.Context, method, url string, body any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	resp, err := b.do(ctx, method, url, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("vault %s returned status %d", strings.ToLower(method), resp.StatusCode)
+	}
+	return nil
+}
+
+func (b *VaultBlobStore) do(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", b.config.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return b.client.Do(req)
+}
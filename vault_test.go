@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeVaultKV is a minimal KV v2 mount at secret/ holding entries and their metadata in memory
+type fakeVaultKV struct {
+	mu       sync.Mutex
+	data     map[string]json.RawMessage
+	metadata map[string]map[string]any
+}
+
+func newFakeVaultKV() *fakeVaultKV {
+	return &fakeVaultKV{data: make(map[string]json.RawMessage), metadata: make(map[string]map[string]any)}
+}
+
+func (f *fakeVaultKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("X-Vault-Token") != "test-token" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch path := r.URL.Path; {
+	case path == "/v1/auth/token/lookup-self":
+		w.Write([]byte(`{"data":{}}`))
+	case strings.HasPrefix(path, "/v1/secret/metadata/") && r.Method == "POST":
+		var metadata map[string]any
+		json.NewDecoder(r.Body).Decode(&metadata)
+		f.metadata[strings.TrimPrefix(path, "/v1/secret/metadata/")] = metadata
+		w.WriteHeader(http.StatusNoContent)
+	case strings.HasPrefix(path, "/v1/secret/metadata/") && r.Method == "DELETE":
+		key := strings.TrimPrefix(path, "/v1/secret/metadata/")
+		delete(f.metadata, key)
+		delete(f.data, key)
+		w.WriteHeader(http.StatusNoContent)
+	case strings.HasPrefix(path, "/v1/secret/data/") && r.Method == "POST":
+		var entry struct {
+			Data json.RawMessage `json:"data"`
+		}
+		json.NewDecoder(r.Body).Decode(&entry)
+		f.data[strings.TrimPrefix(path, "/v1/secret/data/")] = entry.Data
+		w.Write([]byte(`{"data":{"version":1}}`))
+	case strings.HasPrefix(path, "/v1/secret/data/") && r.Method == "GET":
+		data, ok := f.data[strings.TrimPrefix(path, "/v1/secret/data/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"data": data}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestVaultBlobStore(t *testing.T) (*VaultBlobStore, *fakeVaultKV) {
+	t.Helper()
+	fake := newFakeVaultKV()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	blobs, err := NewVaultBlobStore(VaultConfig{Addr: server.URL, Token: "test-token", Mount: "secret", Prefix: DefaultVaultPrefix})
+	if err != nil {
+		t.Fatalf("Failed to create blob store: %v", err)
+	}
+	return blobs, fake
+}
+
+func TestVaultBlobStore_PutGetDelete(t *testing.T) {
+	blobs, fake := newTestVaultBlobStore(t)
+	ctx := context.Background()
+
+	if err := blobs.Put(ctx, "abc", []byte("encrypted payload"), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to put blob: %v", err)
+	}
+	metadata, ok := fake.metadata["picosend/abc"]
+	if !ok || metadata["delete_version_after"] != "3601s" || metadata["max_versions"] != float64(1) {
+		t.Errorf("Expected metadata with a one hour TTL at picosend/abc, got %v", fake.metadata)
+	}
+
+	data, err := blobs.Get(ctx, "abc")
+	if err != nil || string(data) != "encrypted payload" {
+		t.Errorf("Expected stored payload, got %q (%v)", data, err)
+	}
+
+	if err := blobs.Delete(ctx, "abc"); err != nil {
+		t.Fatalf("Failed to delete blob: %v", err)
+	}
+	if _, err := blobs.Get(ctx, "abc"); err != ErrBlobNotFound {
+		t.Errorf("Expected ErrBlobNotFound after delete, got %v", err)
+	}
+	if len(fake.metadata) != 0 {
+		t.Errorf("Expected metadata to be deleted, got %v", fake.metadata)
+	}
+
+	if err := blobs.Check(ctx); err != nil {
+		t.Errorf("Expected check to pass, got %v", err)
+	}
+}
+
+func TestSecretStore_VaultBackend(t *testing.T) {
+	blobs, fake := newTestVaultBlobStore(t)
+	store := NewSecretStore()
+	store.SetBlobStore(blobs, 0)
+
+	id, err := store.StoreWithOptions("small secret", time.Hour, SecretOptions{ManagementToken: "token"})
+	if err != nil {
+		t.Fatalf("Failed to store secret: %v", err)
+	}
+	if _, ok := fake.data["picosend/"+id]; !ok {
+		t.Fatal("Expected even small content to be stored in Vault")
+	}
+
+	secret, _ := store.Peek(id)
+	if err := store.SetExpiry(id, "token", secret.CreatedAt.Add(2*time.Hour), 24*time.Hour); err != nil {
+		t.Fatalf("Failed to extend secret: %v", err)
+	}
+	store.blobDeletes.Wait()
+	fake.mu.Lock()
+	ttl := fake.metadata["picosend/"+id]["delete_version_after"]
+	fake.mu.Unlock()
+	if ttl != "7201s" {
+		t.Errorf("Expected the Vault TTL to follow the extension, got %v", ttl)
+	}
+
+	got, ok := store.Get(id)
+	if !ok || string(got.Content) != "small secret" {
+		t.Fatalf("Expected content from Vault, got %+v", got)
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.data) != 0 {
+		t.Errorf("Expected the entry to be destroyed after the read, got %v", fake.data)
+	}
+}
+
+func TestLoadConfig_Vault(t *testing.T) {
+	cfg, err := loadConfig([]string{"--vault-kv-mount", "secret"},
+		envMap(map[string]string{"VAULT_ADDR": "http://vault:8200", "VAULT_TOKEN": "token"}))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.Vault.Mount != "secret" || cfg.Vault.Prefix != DefaultVaultPrefix || cfg.Vault.Threshold != 0 {
+		t.Errorf("Unexpected Vault config %+v", cfg.Vault)
+	}
+
+	for _, args := range [][]string{
+		{"--vault-kv-mount", "secret"},
+		{"--vault-kv-mount", "secret", "--vault-addr", "http://vault:8200", "--vault-token", "token", "--vault-kv-threshold", "-1"},
+		{"--vault-kv-mount", "secret", "--vault-addr", "http://vault:8200", "--vault-token", "token",
+			"--s3-bucket", "b", "--s3-access-key-id", "k", "--s3-secret-access-key", "s"},
+	} {
+		if _, err := loadConfig(args, envMap(nil)); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
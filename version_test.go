@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVersionHandler(t *testing.T) {
+	defer func(version, commit string) { Version, Commit = version, commit }(Version, Commit)
+	Version, Commit = "v1.2.3", "abc1234"
+	router := newTestServer(t).routes()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/api/version", nil))
+	var info BuildInfo
+	if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+		t.Fatalf("Failed to decode version: %v", err)
+	}
+	if info.Version != "v1.2.3" || info.Commit != "abc1234" || info.GoVersion == "" {
+		t.Errorf("Unexpected build info %+v", info)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if !strings.Contains(rec.Body.String(), "· v1.2.3") {
+		t.Error("Expected the version in the page footer")
+	}
+}
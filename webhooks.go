@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	MaxWebhookURLLength   = 2048             // Maximum length of a webhook callback URL
+	WebhookMaxAttempts    = 5                // Delivery attempts before a webhook event is dropped
+	WebhookInitialBackoff = 1 * time.Second  // Delay before the first retry, doubled on each attempt
+	WebhookRequestTimeout = 10 * time.Second // Timeout for a single delivery attempt
+	WebhookShutdownGrace  = 5 * time.Second  // Time allowed for queued deliveries on shutdown
+	WebhookMaxConcurrent  = 32               // Maximum number of deliveries in flight
+
+	WebhookSignatureHeader = "X-Picosend-Signature"
+	WebhookEventHeader     = "X-Picosend-Event"
+)
+
+var errWebhookPrivateAddress = errors.New("webhook address is not publicly routable")
+
+// Webhook is a sender-registered callback notified about a secret's lifecycle events
+type Webhook struct {
+	URL        string
+	SigningKey string // HMAC-SHA256 key returned to the sender at creation time
+}
+
+// WebhookPayload is the JSON body POSTed to webhook URLs. It never includes secret content.
+type WebhookPayload struct {
+	ID             string         `json:"id"`
+	Event          string         `json:"event"` // read, expired, burned, evicted, blocked, destroyed, expiring or canary
+	Timestamp      string         `json:"timestamp"`
+	ReadsRemaining int            `json:"reads_remaining"`
+	ExpiresAt      string         `json:"expires_at,omitempty"` // Only for expiring, when the secret will expire
+	Label          string         `json:"label,omitempty"`
+	Reference      string         `json:"reference,omitempty"`
+	Reader         *WebhookReader `json:"reader,omitempty"`    // Only for read, when reader details are enabled
+	Requester      *WebhookCanary `json:"requester,omitempty"` // Only for canary, who revealed the decoy
+}
+
+// WebhookReader summarizes who read a secret
+type WebhookReader struct {
+	Country string `json:"country,omitempty"`
+	Browser string `json:"browser,omitempty"`
+	OS      string `json:"os,omitempty"`
+}
+
+// WebhookCanary identifies who revealed a canary secret
+type WebhookCanary struct {
+	ClientIP  string `json:"client_ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	Country   string `json:"country,omitempty"`
+}
+
+// validateWebhookURL checks that the callback URL is an absolute http(s) URL
+func validateWebhookURL(raw string) error {
+	if len(raw) > MaxWebhookURLLength {
+		return fmt.Errorf("webhook_url exceeds maximum length of %d characters", MaxWebhookURLLength)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("webhook_url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// signWebhookPayload returns the hex-encoded HMAC-SHA256 of body under key
+func signWebhookPayload(key string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookNotifier delivers secret events to sender webhooks with retries
+type WebhookNotifier struct {
+	client         *http.Client
+	maxAttempts    int
+	initialBackoff time.Duration
+	slots          chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewWebhookNotifier creates a notifier. Unless allowPrivate is set, deliveries to
+// loopback, private and link-local addresses are refused to prevent SSRF.
+func NewWebhookNotifier(allowPrivate bool) *WebhookNotifier {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+				ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast() {
+				return errWebhookPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &WebhookNotifier{
+		client: &http.Client{
+			Timeout: WebhookRequestTimeout,
+			Transport: &http.Transport{
+				DialContext: dialer.DialContext,
+			},
+			// Never follow redirects, they could point at internal addresses
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		maxAttempts:    WebhookMaxAttempts,
+		initialBackoff: WebhookInitialBackoff,
+		slots:          make(chan struct{}, WebhookMaxConcurrent),
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+}
+
+// HandleEvent queues delivery of the event if the secret has a webhook. Safe to use as a store listener.
+func (n *WebhookNotifier) HandleEvent(event SecretEvent) {
+	if event.Webhook == nil {
+		return
+	}
+
+	payload := WebhookPayload{
+		ID:             event.ID,
+		Event:          string(event.Type),
+		Timestamp:      event.Time.UTC().Format(time.RFC3339),
+		ReadsRemaining: event.ReadsRemaining,
+		Label:          event.Label,
+		Reference:      event.Reference,
+	}
+	if reader := event.Reader; reader != nil && reader.Browser+reader.Country != "" {
+		payload.Reader = &WebhookReader{Country: reader.Country, Browser: reader.Browser, OS: reader.OS}
+	}
+	if hit := event.Canary; hit != nil {
+		payload.Requester = &WebhookCanary{ClientIP: hit.ClientIP, UserAgent: hit.UserAgent, Country: hit.Country}
+	}
+	if event.Type == EventExpiring {
+		payload.ExpiresAt = event.ExpiresAt.UTC().Format(time.RFC3339)
+	}
+	n.Send(*event.Webhook, string(event.Type), payload)
+}
+
+// Send queues delivery of payload to webhook as an event of eventType. Besides secret events it
+// carries notifications to admins.
+func (n *WebhookNotifier) Send(webhook Webhook, eventType string, payload any) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("Failed to encode webhook payload", "error", err)
+		return
+	}
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		n.deliver(webhook, eventType, body)
+	}()
+}
+
+// deliver POSTs the payload, retrying with exponential backoff on failure
+func (n *WebhookNotifier) deliver(webhook Webhook, eventType string, body []byte) {
+	select {
+	case n.slots <- struct{}{}:
+		defer func() { <-n.slots }()
+	case <-n.ctx.Done():
+		return
+	}
+
+	signature := "sha256=" + signWebhookPayload(webhook.SigningKey, body)
+	backoff := n.initialBackoff
+
+	for attempt := 1; attempt <= n.maxAttempts; attempt++ {
+		err := n.post(webhook.URL, eventType, signature, body)
+		if err == nil {
+			return
+		}
+		if errors.Is(err, errWebhookPrivateAddress) {
+			slog.Warn("Webhook delivery refused", "event", eventType, "error", err)
+			return
+		}
+		if attempt == n.maxAttempts {
+			slog.Warn("Webhook delivery failed", "event", eventType, "attempts", attempt, "error", err)
+			return
+		}
+
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-n.ctx.Done():
+			return
+		}
+	}
+}
+
+func (n *WebhookNotifier) post(url, eventType, signature string, body []byte) error {
+	req, err := http.NewRequestWithContext(n.ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "picosend-webhook")
+	req.Header.Set(WebhookEventHeader, eventType)
+	req.Header.Set(WebhookSignatureHeader, signature)
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close gives queued deliveries up to WebhookShutdownGrace to complete, then abandons
+// remaining retries and waits for in-flight requests to finish
+func (n *WebhookNotifier) Close() {
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(WebhookShutdownGrace):
+		n.cancel()
+		<-done
+	}
+	n.cancel()
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type webhookRecorder struct {
+	mu       sync.Mutex
+	payloads []WebhookPayload
+	failures int // Number of requests to reject before accepting
+	key      string
+	t        *testing.T
+}
+
+func (rec *webhookRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if rec.failures > 0 {
+		rec.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	expected := "sha256=" + signWebhookPayload(rec.key, body)
+	if r.Header.Get(WebhookSignatureHeader) != expected {
+		rec.t.Errorf("Invalid webhook signature %q", r.Header.Get(WebhookSignatureHeader))
+	}
+
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		rec.t.Errorf("Failed to parse webhook payload: %v", err)
+	}
+	if r.Header.Get(WebhookEventHeader) != payload.Event {
+		rec.t.Errorf("Expected event header %q, got %q", payload.Event, r.Header.Get(WebhookEventHeader))
+	}
+	rec.payloads = append(rec.payloads, payload)
+}
+
+func (rec *webhookRecorder) events() []string {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	events := make([]string, len(rec.payloads))
+	for i, p := range rec.payloads {
+		events[i] = p.Event
+	}
+	return events
+}
+
+func newTestNotifier() *WebhookNotifier {
+	n := NewWebhookNotifier(true)
+	n.initialBackoff = time.Millisecond
+	return n
+}
+
+func TestWebhookNotifier_DeliversSignedEvents(t *testing.T) {
+	rec := &webhookRecorder{key: "signing-key", t: t}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	notifier := newTestNotifier()
+	testStore := NewSecretStore()
+	testStore.Subscribe(notifier.HandleEvent)
+
+	webhook := &Webhook{URL: server.URL, SigningKey: "signing-key"}
+	readID, _ := testStore.StoreWithOptions("secret", 24*time.Hour, SecretOptions{Webhook: webhook})
+	burnID, _ := testStore.StoreWithOptions("secret", 24*time.Hour, SecretOptions{Webhook: webhook, ManagementToken: "token"})
+	testStore.StoreWithOptions("secret", time.Millisecond, SecretOptions{Webhook: webhook})
+	testStore.Store("secret without webhook", 24*time.Hour)
+
+	testStore.Get(readID)
+	testStore.Burn(burnID, "token")
+	time.Sleep(5 * time.Millisecond)
+	testStore.CleanupExpired()
+
+	notifier.Close()
+
+	events := map[string]bool{}
+	for _, e := range rec.events() {
+		events[e] = true
+	}
+	for _, expected := range []string{"read", "burned", "expired"} {
+		if !events[expected] {
+			t.Errorf("Expected %s webhook event, got %v", expected, rec.events())
+		}
+	}
+	if len(rec.events()) != 3 {
+		t.Errorf("Expected 3 webhook deliveries, got %d", len(rec.events()))
+	}
+}
+
+func TestWebhookNotifier_ExpiryReminder(t *testing.T) {
+	rec := &webhookRecorder{key: "key", t: t}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	notifier := newTestNotifier()
+	testStore := NewSecretStore()
+	testStore.Subscribe(notifier.HandleEvent)
+
+	webhook := &Webhook{URL: server.URL, SigningKey: "key"}
+	unreadID, _ := testStore.StoreWithOptions("secret", time.Hour, SecretOptions{Webhook: webhook, RemindBefore: time.Hour})
+	openedID, _ := testStore.StoreWithOptions("secret", time.Hour, SecretOptions{Webhook: webhook, RemindBefore: time.Hour, MaxReads: 2})
+	testStore.StoreWithOptions("secret", time.Hour, SecretOptions{Webhook: webhook, RemindBefore: time.Minute})
+	testStore.Get(openedID)
+
+	// Reminders are sent once, by the first cleanup after they are due
+	testStore.CleanupExpired()
+	testStore.CleanupExpired()
+	notifier.Close()
+
+	var reminders []WebhookPayload
+	for _, payload := range rec.payloads {
+		if payload.Event == string(EventExpiring) {
+			reminders = append(reminders, payload)
+		}
+	}
+	if len(reminders) != 1 || reminders[0].ID != unreadID || reminders[0].ExpiresAt == "" {
+		t.Errorf("Expected one reminder for the unread secret, got %+v", reminders)
+	}
+	if _, found := testStore.Peek(unreadID); !found {
+		t.Error("Expected the reminded secret to stay readable")
+	}
+}
+
+func TestWebhookNotifier_Retries(t *testing.T) {
+	rec := &webhookRecorder{key: "key", failures: 2, t: t}
+	server := httptest.NewServer(rec)
+	defer server.Close()
+
+	notifier := newTestNotifier()
+	notifier.HandleEvent(SecretEvent{
+		Type:    StatusRead,
+		ID:      "abc",
+		Time:    time.Now(),
+		Webhook: &Webhook{URL: server.URL, SigningKey: "key"},
+	})
+
+	deadline := time.Now().Add(time.Second)
+	for len(rec.events()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	notifier.Close()
+
+	if len(rec.events()) != 1 {
+		t.Errorf("Expected delivery to succeed after retries, got %d deliveries", len(rec.events()))
+	}
+}
+
+func TestWebhookNotifier_RefusesPrivateAddresses(t *testing.T) {
+	var called bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	notifier := NewWebhookNotifier(false)
+	err := notifier.post(server.URL, "read", "sig", []byte("{}"))
+	notifier.Close()
+
+	if err == nil || called {
+		t.Error("Expected delivery to loopback address to be refused")
+	}
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	valid := []string{"https://example.com/hook", "http://example.com:8080/path?x=1"}
+	invalid := []string{"ftp://example.com", "/relative", "https://", "not a url", "https://example.com/" + string(make([]byte, MaxWebhookURLLength))}
+
+	for _, u := range valid {
+		if err := validateWebhookURL(u); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", u, err)
+		}
+	}
+	for _, u := range invalid {
+		if err := validateWebhookURL(u); err == nil {
+			t.Errorf("Expected %q to be invalid", u)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket opcodes and close codes from RFC 6455
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+
+	WSCloseNormal          = 1000
+	WSCloseGoingAway       = 1001
+	WSCloseProtocolError   = 1002
+	WSClosePolicyViolation = 1008
+	WSCloseTooBig          = 1009
+	WSCloseTryAgainLater   = 1013
+)
+
+const (
+	webSocketGUID         = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11" // Fixed by RFC 6455 for the handshake
+	WebSocketWriteTimeout = 10 * time.Second
+)
+
+var (
+	ErrWebSocketClosed   = errors.New("websocket closed")
+	errWebSocketProtocol = errors.New("websocket protocol error")
+	errWebSocketTooBig   = errors.New("websocket message too big")
+)
+
+// wsConn is the server side of a WebSocket connection. It implements just enough of
+// RFC 6455 to exchange messages: no extensions, subprotocols or compression.
+type wsConn struct {
+	conn           net.Conn
+	reader         *bufio.Reader
+	maxMessageSize int
+
+	writeMu   sync.Mutex
+	closeOnce sync.Once
+}
+
+// isWebSocketUpgrade reports whether r asks for a WebSocket connection
+func isWebSocketUpgrade(r *http.Request) bool {
+	upgrade := false
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			upgrade = upgrade || strings.EqualFold(strings.TrimSpace(token), "upgrade")
+		}
+	}
+	return upgrade && strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		r.Header.Get("Sec-WebSocket-Version") == "13" && r.Header.Get("Sec-WebSocket-Key") != ""
+}
+
+// upgradeWebSocket completes the handshake for a request that passed isWebSocketUpgrade and
+// takes over its connection. Messages larger than maxMessageSize close the connection.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request, maxMessageSize int) (*wsConn, error) {
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, err
+	}
+	// Deadlines set by the HTTP server's timeouts would otherwise cut the connection short
+	conn.SetDeadline(time.Time{})
+
+	sum := sha1.Sum([]byte(r.Header.Get("Sec-WebSocket-Key") + webSocketGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, reader: rw.Reader, maxMessageSize: maxMessageSize}, nil
+}
+
+// ReadMessage returns the next text or binary message and its opcode, reassembling fragments
+// and answering pings. A close frame from the client is answered and returns ErrWebSocketClosed.
+func (c *wsConn) ReadMessage() (int, []byte, error) {
+	var (
+		opcode  int
+		message []byte
+	)
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, c.fail(err)
+		}
+
+		switch op {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			c.Close(WSCloseNormal, "")
+			return 0, nil, ErrWebSocketClosed
+		case wsOpContinuation:
+			if opcode == 0 {
+				return 0, nil, c.fail(errWebSocketProtocol)
+			}
+		case wsOpText, wsOpBinary:
+			if opcode != 0 {
+				return 0, nil, c.fail(errWebSocketProtocol)
+			}
+			opcode = op
+		default:
+			return 0, nil, c.fail(errWebSocketProtocol)
+		}
+
+		if len(message)+len(payload) > c.maxMessageSize {
+			return 0, nil, c.fail(errWebSocketTooBig)
+		}
+		message = append(message, payload...)
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+// readFrame reads and unmasks one frame. Frames from clients must be masked.
+func (c *wsConn) readFrame() (bool, int, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, op := header[0]&0x80 != 0, int(header[0]&0x0f)
+	masked, length := header[1]&0x80 != 0, uint64(header[1]&0x7f)
+	if header[0]&0x70 != 0 || !masked {
+		return false, 0, nil, errWebSocketProtocol
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if op >= wsOpClose && (length > 125 || !fin) {
+		return false, 0, nil, errWebSocketProtocol
+	}
+	// Check before allocating, the length is chosen by the client
+	if length > uint64(c.maxMessageSize) {
+		return false, 0, nil, errWebSocketTooBig
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// fail closes the connection with the close code matching err and returns err
+func (c *wsConn) fail(err error) error {
+	switch {
+	case errors.Is(err, errWebSocketTooBig):
+		c.Close(WSCloseTooBig, "message too big")
+	case errors.Is(err, errWebSocketProtocol):
+		c.Close(WSCloseProtocolError, "")
+	default:
+		c.conn.Close()
+	}
+	return err
+}
+
+// WriteMessage sends a text or binary message in a single frame
+func (c *wsConn) WriteMessage(opcode int, data []byte) error {
+	return c.writeFrame(opcode, data)
+}
+
+func (c *wsConn) writeFrame(opcode int, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|byte(opcode))
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, byte(length))
+	case length <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+	frame = append(frame, payload...)
+
+	c.conn.SetWriteDeadline(time.Now().Add(WebSocketWriteTimeout))
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// SetReadDeadline limits how long the next ReadMessage waits
+func (c *wsConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// Close sends a close frame with code and reason and closes the connection. Only the first
+// call has an effect.
+func (c *wsConn) Close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+		c.writeFrame(wsOpClose, append(payload, reason...))
+		c.conn.Close()
+	})
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	SecurityTxtLifetime   = 180 * 24 * time.Hour // Expires of security.txt lies this far ahead; RFC 9116 asks for less than a year
+	WellKnownCacheControl = "public, max-age=3600"
+
+	wellKnownStaticPrefix = "static/.well-known/" // Static files overriding generated documents
+)
+
+// SecurityTxtConfig fills /.well-known/security.txt, which tells researchers how to report
+// vulnerabilities. The document is only served when a contact is set.
+type SecurityTxtConfig struct {
+	Contacts   []string // mailto:, tel: or https: URIs, in order of preference
+	Policy     string   // https: URL of the disclosure policy; empty for none
+	Encryption string   // https: URL of the key reports should be encrypted with; empty for none
+}
+
+// Enabled reports whether security.txt is served
+func (c SecurityTxtConfig) Enabled() bool {
+	return len(c.Contacts) > 0
+}
+
+// Validate checks that contacts are URIs RFC 9116 allows and the other links use https
+func (c SecurityTxtConfig) Validate() error {
+	for _, contact := range c.Contacts {
+		u, err := url.Parse(contact)
+		if err != nil || (u.Scheme != "mailto" && u.Scheme != "tel" && (u.Scheme != "https" || u.Host == "")) {
+			return fmt.Errorf("invalid security-contact %q (expected an email address or a mailto:, tel: or https: URI)", contact)
+		}
+	}
+	for flag, link := range map[string]string{"security-policy": c.Policy, "security-encryption": c.Encryption} {
+		if u, err := url.Parse(link); link != "" && (err != nil || u.Scheme != "https" || u.Host == "") {
+			return fmt.Errorf("invalid %s %q (expected an https: URL)", flag, link)
+		}
+	}
+	return nil
+}
+
+// parseSecurityContacts splits a comma-separated list of contacts, turning bare email
+// addresses into mailto: URIs
+func parseSecurityContacts(value string) []string {
+	var contacts []string
+	for _, contact := range strings.Split(value, ",") {
+		contact = strings.TrimSpace(contact)
+		if contact == "" {
+			continue
+		}
+		if !strings.Contains(contact, ":") && strings.Contains(contact, "@") {
+			contact = "mailto:" + contact
+		}
+		contacts = append(contacts, contact)
+	}
+	return contacts
+}
+
+// wellKnownDocument is generated on each request, so dates in it stay current
+type wellKnownDocument struct {
+	contentType string
+	generate    func(now time.Time) []byte
+}
+
+// RegisterWellKnown serves the document generate returns at /.well-known/name, e.g. for
+// domain verification. A file of the same name in the static directory's .well-known folder
+// takes precedence.
+func (srv *Server) RegisterWellKnown(name, contentType string, generate func(now time.Time) []byte) {
+	srv.wellKnownMu.Lock()
+	defer srv.wellKnownMu.Unlock()
+	srv.wellKnown[name] = wellKnownDocument{contentType: contentType, generate: generate}
+}
+
+// wellKnownHandler serves a document registered with RegisterWellKnown. There are no user
+// accounts with passwords, so change-password is deliberately left unregistered and password
+// managers get 404 rather than a redirect.
+func (srv *Server) wellKnownHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if _, overridden := srv.static.files[wellKnownStaticPrefix+name]; overridden {
+		srv.static.serve(w, r, wellKnownStaticPrefix+name)
+		return
+	}
+
+	srv.wellKnownMu.RLock()
+	document, found := srv.wellKnown[name]
+	srv.wellKnownMu.RUnlock()
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", document.contentType)
+	w.Header().Set("Cache-Control", WellKnownCacheControl)
+	w.Write(document.generate(time.Now()))
+}
+
+// securityTxt generates security.txt as described in RFC 9116. Expires is moved forward on
+// each day, so the document never goes stale while the server is maintained.
+func (srv *Server) securityTxt(now time.Time) []byte {
+	config := srv.config.SecurityTxt
+	var b strings.Builder
+	for _, contact := range config.Contacts {
+		fmt.Fprintf(&b, "Contact: %s\n", contact)
+	}
+	fmt.Fprintf(&b, "Expires: %s\n", now.UTC().Truncate(24*time.Hour).Add(SecurityTxtLifetime).Format(time.RFC3339))
+	if config.Encryption != "" {
+		fmt.Fprintf(&b, "Encryption: %s\n", config.Encryption)
+	}
+	if config.Policy != "" {
+		fmt.Fprintf(&b, "Policy: %s\n", config.Policy)
+	}
+
+	tags := make([]string, 0, len(locales))
+	for tag := range locales {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	fmt.Fprintf(&b, "Preferred-Languages: %s\n", strings.Join(tags, ", "))
+	if srv.config.PublicURL != "" {
+		fmt.Fprintf(&b, "Canonical: %s%s/.well-known/security.txt\n", srv.config.PublicURL, srv.config.BasePath)
+	}
+	return []byte(b.String())
+}
+
+// robotsTxt keeps crawlers away from secret and upload links and the API below basePath.
+// Pages with links carry a noindex meta tag as well, for crawlers that skip robots.txt.
+func robotsTxt(basePath string) []byte {
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	for _, path := range []string{"/s/", "/u/", "/api/"} {
+		fmt.Fprintf(&b, "Disallow: %s%s\n", basePath, path)
+	}
+	return []byte(b.String())
+}
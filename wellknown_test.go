@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWellKnown_SecurityTxt(t *testing.T) {
+	router := newTestServer(t, func(cfg *Config) {
+		cfg.PublicURL = "https://secrets.example.com"
+		cfg.SecurityTxt = SecurityTxtConfig{
+			Contacts: []string{"mailto:security@example.com", "https://example.com/report"},
+			Policy:   "https://example.com/disclosure",
+		}
+	}).routes()
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", "/.well-known/security.txt", nil))
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("Expected security.txt as text/plain, got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	for _, line := range []string{
+		"Contact: mailto:security@example.com\nContact: https://example.com/report\n",
+		"Policy: https://example.com/disclosure\n",
+		"Preferred-Languages: de, en, es, ru\n",
+		"Canonical: https://secrets.example.com/.well-known/security.txt\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected %q in security.txt:\n%s", line, body)
+		}
+	}
+
+	// Expires stays ahead of the current date, within the year RFC 9116 allows
+	_, value, _ := strings.Cut(body, "Expires: ")
+	value, _, _ = strings.Cut(value, "\n")
+	expires, err := time.Parse(time.RFC3339, value)
+	if err != nil || expires.Before(time.Now().Add(179*24*time.Hour)) || expires.After(time.Now().Add(365*24*time.Hour)) {
+		t.Errorf("Expected Expires about 180 days ahead, got %q", value)
+	}
+
+	for _, path := range []string{"/.well-known/change-password", "/.well-known/unknown"} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestWellKnown_Documents(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".well-known"), 0o755)
+	os.WriteFile(filepath.Join(dir, ".well-known", "security.txt"), []byte("Contact: mailto:signed@example.com\n"), 0o644)
+	srv := newTestServer(t, func(cfg *Config) { cfg.Branding.StaticDir = dir })
+	srv.RegisterWellKnown("example-verification", "text/plain", func(time.Time) []byte { return []byte("token") })
+	router := srv.routes()
+
+	// Without a contact security.txt isn't generated, but a signed file can still be served
+	for path, want := range map[string]string{
+		"/.well-known/security.txt":         "Contact: mailto:signed@example.com\n",
+		"/.well-known/example-verification": "token",
+	} {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != want {
+			t.Errorf("%s: expected %q, got %d %q", path, want, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestRobotsTxt_BasePath(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newTestServer(t, func(cfg *Config) { cfg.BasePath = "/tools/picosend" }).routes().ServeHTTP(rec, httptest.NewRequest("GET", "/robots.txt", nil))
+	if !strings.Contains(rec.Body.String(), "Disallow: /tools/picosend/s/\n") {
+		t.Errorf("Expected rules below the base path, got %q", rec.Body.String())
+	}
+}
+
+func TestLoadConfig_SecurityTxt(t *testing.T) {
+	cfg, err := loadConfig(nil, envMap(map[string]string{"SECURITY_CONTACT": "security@example.com, https://example.com/report"}))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if strings.Join(cfg.SecurityTxt.Contacts, " ") != "mailto:security@example.com https://example.com/report" {
+		t.Errorf("Expected bare addresses to become mailto: URIs, got %v", cfg.SecurityTxt.Contacts)
+	}
+
+	for _, env := range []map[string]string{
+		{"SECURITY_CONTACT": "http://example.com/report"},
+		{"SECURITY_CONTACT": "security@example.com", "SECURITY_POLICY": "ftp://example.com/policy"},
+	} {
+		if _, err := loadConfig(nil, envMap(env)); err == nil {
+			t.Errorf("Expected %v to be rejected", env)
+		}
+	}
+}